@@ -0,0 +1,63 @@
+package main
+
+import (
+	"github.com/mmogo/mmo/shared"
+)
+
+// animator keeps an animated sprite for every entity that is drawn,
+// so that each entity is at its own point of its own animation
+type animator struct {
+	// sheets that instances are made from, by name
+	sheets map[string]*Sprite
+	// instances by entity ID
+	instances map[string]*instance
+}
+
+// instance is the sprite of one entity and the sheet it was made from
+type instance struct {
+	sheet  string
+	sprite *Sprite
+}
+
+func newAnimator() *animator {
+	return &animator{
+		sheets:    make(map[string]*Sprite),
+		instances: make(map[string]*instance),
+	}
+}
+
+// addSheet makes sheet available to be drawn as name
+func (a *animator) addSheet(name string, sheet *Sprite) {
+	a.sheets[name] = sheet
+}
+
+// animate advances the animation of entity by dt seconds and returns its sprite,
+// made from the sheet called name the first time entity is animated with it
+// returns nil if there is no such sheet
+func (a *animator) animate(name string, entity *shared.Entity, dt float64) *Sprite {
+	inst, ok := a.instances[entity.ID]
+	if !ok || inst.sheet != name {
+		sheet, ok := a.sheets[name]
+		if !ok {
+			return nil
+		}
+		inst = &instance{sheet: name, sprite: sheet.Instance()}
+		a.instances[entity.ID] = inst
+	}
+	inst.sprite.Animate(dt, entity.Facing, entity.Action)
+	return inst.sprite
+}
+
+// free drops the sprite of entity id
+func (a *animator) free(id string) {
+	delete(a.instances, id)
+}
+
+// prune frees the sprites of entities that have left world
+func (a *animator) prune(world *shared.World) {
+	for id := range a.instances {
+		if entity, ok := world.GetEntity(id); !ok || !entity.Active {
+			a.free(id)
+		}
+	}
+}
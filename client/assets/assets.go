@@ -1,5 +1,6 @@
 // Code generated by go-bindata.
 // sources:
+// assets/atlases/player.json
 // assets/sprites/char1.png
 // assets/sprites/grass.png
 // assets/sprites/loot.png
@@ -71,6 +72,26 @@ func (fi bindataFileInfo) Sys() interface{} {
 	return nil
 }
 
+var _atlasesPlayerJson = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\x03\x8d\x95\xc1\x8e\x83\x20\x10\x40\xef\xfd\x0a\xe3\xd9\xdd\x15\x50\xd4\xfd\x95\xcd\x1e\x4c\xb5\xc5\xac\x15\xa3\x18\x0f\x4d\xff\x7d\x01\x2b\x15\x0b\xd3\x1e\x9a\x74\x66\x1e\x41\x1f\xcc\x78\x3d\x04\x41\xd8\x5c\xca\x73\x1d\x7e\x07\xe1\xd8\x0f\x8d\xa8\xc7\xaf\x23\x2b\x07\xf4\xd9\x77\xe7\x30\x52\xf5\xb9\xa9\x04\x93\xf5\x9c\x60\x1d\xb3\xba\x39\x33\x21\x13\x88\x24\x89\xce\x1c\x79\x3b\x5d\xba\x51\xa7\x74\x62\xe0\xb3\x8a\x30\xd2\x51\xd9\xc9\x2d\x44\xc3\x35\x71\x95\x19\xb5\x69\xd5\xd6\x26\x92\xf1\xd4\xab\x28\x3c\x0d\xe5\xa5\x56\xd8\x4f\x1c\x05\xf1\xef\x2d\x5a\xeb\x6d\x7d\x12\x3b\x42\xee\x25\xf7\xdb\x30\x53\xff\xf1\x0e\x56\xf1\xb9\x7b\x1b\xdc\x31\x98\x46\x01\xa6\x1b\x66\xb8\xbb\xd8\x42\xa4\x88\x02\x52\xd8\x0f\xf6\x16\xa7\x9f\x0c\x22\x35\x78\xe7\xe5\x71\xd5\x6d\xeb\x74\xc8\x2f\xf2\x8f\x14\x18\x0a\xae\xce\xcd\x69\x51\x33\xea\x95\x17\x08\x23\x9f\x47\x00\xdc\x9b\x7c\x81\x6e\x29\x25\x72\xa1\x08\x71\xdb\xd4\x98\x7a\xf1\x05\x4b\x52\xaf\x4f\x80\x7c\x32\xfa\xcc\x5a\x4e\x05\x1b\xa6\x51\xf8\xa5\xa6\x78\x5d\x49\x63\xbf\x56\x9a\xae\x54\x46\x40\xad\x6e\xd0\xa9\xd5\x8f\x6e\xa9\x2c\x37\xa7\x4e\x01\xad\x05\x5a\xb1\xa2\x80\xb5\xba\x49\xb7\x56\x8b\xb5\xb4\xce\x65\xfb\xe7\x97\x8a\xe2\x64\x5d\x88\x10\x01\x6e\x2b\xca\x0c\x87\x29\x7c\x5f\x3d\xa8\xfb\xc6\x02\xb0\x7d\xb3\x4d\x4f\x21\x52\x00\x7a\x51\x62\x7a\x00\xa5\x18\x16\xec\x63\xdd\x8a\x77\xb4\x3d\x0f\xda\x72\x64\x80\xe5\xd4\xb4\x1c\xa2\x18\xb0\x4c\x4d\x77\xa0\x2c\x85\x2d\x7b\x50\xb7\x65\x00\xb6\xb8\xdc\xf4\x18\xca\x73\xc8\x72\x61\x5a\x02\xc7\xe8\x85\x65\x0f\xeb\xb1\x6c\xd3\xb6\x65\xc6\x39\x30\x20\x70\x6c\x3a\x10\x6f\xe7\xdf\xde\x86\x2c\x1a\x8e\x24\xa0\x65\x1f\xea\xb4\x0c\xc1\x16\x47\x4c\xcf\xe1\x24\x03\x2c\xcb\xaa\x01\xb7\x33\xcf\x65\xd9\xc7\xba\x2d\xef\x68\xcb\x32\x9b\x06\x4b\xf2\xf3\xe7\x23\x7e\xac\xdd\xcd\xf0\xaa\x2e\x2b\x78\xed\xe3\x74\xe5\x2c\x5d\xd6\x1e\xd4\xef\x76\xf8\x07\xc7\xa9\x1e\x25\x11\x09\x00\x00")
+
+func atlasesPlayerJsonBytes() ([]byte, error) {
+	return bindataRead(
+		_atlasesPlayerJson,
+		"atlases/player.json",
+	)
+}
+
+func atlasesPlayerJson() (*asset, error) {
+	bytes, err := atlasesPlayerJsonBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "atlases/player.json", size: 2321, mode: os.FileMode(436), modTime: time.Unix(1792368000, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
 var _spritesChar1Png = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xac\x9b\x79\x58\x53\x47\xdb\xff\x4f\x58\xc4\x8a\x02\x6d\xa9\x28\xb2\x5a\x05\x51\x21\x6e\x80\x10\x21\x41\x6a\xd9\x64\x29\x88\xa8\x2c\x41\x8b\xe0\xc2\xa2\x6c\x61\xcb\xa2\xa8\xf4\x91\x0a\x28\x4a\x54\x84\xa0\xb2\x08\x28\x51\x50\x90\x2d\xc1\xb6\x08\x08\x24\xc8\x16\xc3\x16\x84\x40\x80\x00\x21\x09\x90\xed\x24\xf9\x5d\x41\x9f\xe7\xa5\x7d\xdf\xff\x7e\xcf\xf9\x87\xeb\xca\x39\x73\xdf\x33\xf7\xcc\x70\x7f\xe6\x3b\x33\xff\xf2\xf2\x70\xda\xb0\x4e\x77\x1d\x00\x00\x1b\x5c\x9c\x7f\xf2\x06\x00\x65\x04\x00\xa8\x22\xd6\xae\x01\x00\xe0\x74\xd5\xc1\x04\x00\x30\x02\x5c\x7e\x72\x38\x96\xf0\x68\x76\xd8\xf3\x5c\x80\x7f\x3d\x4b\xe0\xfb\xe9\x44\xaa\xd2\xaf\xee\xcc\xc3\xd6\xa3\x3c\x37\xb1\x37\x4b\x7f\x71\x74\xf2\x6a\x50\xa4\xe0\x5b\xd7\xe1\xcf\xd3\xef\x12\xd3\xda\x9c\xbf\x31\x08\xf9\xae\xb5\xc0\x41\x2b\xda\x61\xd3\x5f\x0f\x42\x7a\x47\xb3\x96\x11\x91\x5d\xa3\x73\x1f\xaf\x2f\x9c\xe9\xd8\x5c\xbc\x37\x21\xd6\x78\x87\xd3\xe6\x1b\x8b\x4d\xae\xa7\xfc\x9e\xee\xe7\x39\xfc\x76\xef\x0a\xc7\x07\x33\xf3\x71\xa0\x7e\xb9\x62\xa0\x7b\xe4\xa2\x1d\x43\x33\x3c\x9c\xed\x59\x8b\x91\x50\x93\xfa\x4f\x25\xfb\xfa\xae\x05\xfe\x0b\xcf\xaf\x07\x06\x6e\xa2\xe1\x69\xf6\xb7\x09\xe0\x7f\xfe\xa8\x01\x80\xc1\xd0\xd3\x17\x61\x97\x0f\x0c\xdc\xac\xd6\xfa\x40\x73\x85\x66\x31\x4d\xe1\xa2\x36\x4f\x0c\x41\x04\x01\x3c\x6e\xfd\xec\xcf\xfd\xd8\x5f\xf5\x4c\xfd\x71\xca\x1c\xb7\xc7\x25\x05\x8c\xf5\x8e\x35\xde\xb6\xf2\x9e\x27\xe9\xd0\x04\x2e\x99\xf8\x4e\x19\xc0\xf3\xfe\x32\xa5\x22\x2d\xa4\xfe\xa4\x28\xf5\x10\x06\x15\xeb\xb3\xca\x42\x86\xf3\xbb\xaa\x66\x4e\x1b\x1f\x9f\xfe\x47\x89\x7a\x81\x8c\x64\x71\x95\x17\xc6\x48\x1c\xd8\xba\xca\xc4\x51\x9d\x3d\x76\x12\xd3\x23\x5e\x56\xfe\xa0\xeb\x03\xd5\xd5\xc6\x5d\xa9\xb2\x36\x42\xb5\x90\xee\xbe\xee\xb1\xb4\x51\x2f\xdd\x68\xe5\x4d\x36\x23\x0c\x03\xe0\xf6\x97\xea\xd4\xf6\xff\x40\x2e\x2b\xfa\xb6\x76\x23\x82\x97\x4d\x00\x99\xa6\x64\x2a\x08\x00\x25\xde\x17\x49\x71\xbf\x94\xef\xc2\x95\x6e\xbd\xef\x0f\x59\x6d\xac\x63\xa3\x43\x60\x47\x59\xa8\xd2\xd9\x6c\x46\x15\xf4\x49\x67\xe9\xda\x3b\x04\x90\x09\xdd\x25\x0f\xdf\x77\xab\xf2\x85\x98\x9e\x46\x61\x4c\xd6\xda\x5d\xfb\x2e\x13\x0e\x00\x6f\x66\x79\x6a\xfe\xe0\xe2\xd1\xe0\x3e\xc1\x62\x07\xc1\xe2\x1a\x3a\xec\xe2\x55\x90\x69\x8a\x3d\x29\x3a\x7b\xe9\x72\x1d\xb9\x26\x3a\xeb\xa3\x13\x46\x3a\x24\x36\x50\xb9\x97\x00\x42\x80\x13\xe7\x0f\x0c\xdc\x2c\x91\x24\xa3\x42\x39\x65\x37\x91\x33\x17\xab\x17\x96\x02\x7b\x07\x8d\xe0\xa2\x36\xa4\x87\x8c\x1e\xa2\x4b\xa4\x64\x8c\x4d\xcb\x82\xc6\x21\x5d\x8e\x2c\x3c\xa4\x6b\x5a\x16\xd4\x60\x0b\x9b\x89\xc3\xde\x8b\x07\x21\xc0\xb9\x9f\x6e\xbe\x32\x3f\x93\x14\x4f\xa5\x80\xf4\xb3\x9a\x62\xc1\xc3\x58\xdb\x1b\xd7\x14\xce\x6c\x44\x67\x81\x6d\xa9\x05\xc5\xa9\xb7\xd3\x3a\xa0\xf2\x92\x43\x54\x92\xc0\xcf\xa5\xc5\x10\xc0\xfd\x5c\xf8\xa7\xd1\xf5\x8e\x8d\x96\x81\xb3\x21\xb7\x12\xfa\xa8\xf9\x04\xbd\xe5\xa0\xae\x41\x45\x44\x91\x3f\x2b\xdc\x51\x3d\x35\x74\x52\xd3\x15\xe5\x28\x44\x35\x44\x89\x24\x99\x0b\x32\x5f\xd2\xd0\xc7\x3f\x70\xd5\x80\x82\x57\xf4\x10\xdd\x28\xa8\xfd\xb1\x8d\x0e\x66\x49\xcb\x9c\x6a\xe7\x0f\xe1\x93\x73\xcd\x69\xcf\xd7\x29\x62\x2b\xdb\xc7\x1b\xac\x87\xbb\xaf\x71\xd0\xcc\x63\x68\x60\xc4\x24\xf5\x63\xdd\x8a\x22\x7b\xcd\x5a\xbd\x55\x22\x20\xaf\xdb\x0d\xbc\xdd\x0c\x0d\x22\xec\xd2\x59\xa6\x69\xdc\xe5\x31\xc7\x78\x37\xa3\xc2\x9e\x5e\x5f\xd9\x50\x28\xa2\xcd\x53\x66\xc1\x63\xb7\x6c\xfa\xe3\x4e\x45\x71\xfb\xa8\x81\x2d\x76\x90\x85\x62\x34\x10\xe4\x00\xd0\x12\xb2\xd1\x2b\x67\xcf\x14\xbd\xa9\x6c\x69\xb4\x0e\x11\x94\xa7\x6f\xbe\x2e\x38\xa3\x39\x13\x64\x42\x8d\xc9\x98\xe4\x09\x2b\xea\x53\x22\xc8\xb6\x67\x98\x64\xee\xca\x13\x9b\x50\xa7\x8d\xf9\xed\x72\xcb\xc2\x77\x87\xcd\x58\x70\x00\x78\x41\x7f\xe0\x62\x76\xd5\x97\xdd\xb8\x44\xdd\x70\xda\x24\xc6\x87\x69\x8a\xa5\x88\x96\xbc\x8b\xe3\xf2\xdd\x0c\x45\x4b\x72\xba\x2f\xeb\xe4\x1a\x9f\x78\xe0\xf5\x85\xac\x38\x86\x68\x29\xe6\xa5\x72\x81\x71\x80\x75\xad\xc2\xeb\x73\xf7\xa0\x9f\xc2\xd3\x73\xb5\x11\x8d\xfd\xfe\x51\x68\xd2\x6f\x35\x6e\x4c\x53\x6c\x85\x28\xae\xe5\xd4\xc8\xda\xe0\x3c\x48\x9b\xe3\x04\x5e\xa3\x66\xc8\x66\x2a\x1a\xd8\x16\xb5\xd7\x3c\x53\x24\xe2\xf9\x80\x42\x59\x60\x4a\x4c\x4a\x00\x6c\xf4\x6d\x26\xc8\x93\x37\xda\xd8\x67\x18\x32\xc8\xe9\x04\x28\xdc\x7c\x8d\x83\x3b\xa3\x4c\xf2\x98\x99\x22\x53\x06\xba\x6e\x06\xde\xd8\x9a\x77\xe7\xd8\xb7\xcf\x77\x62\xc4\x8e\xd2\x1b\xfb\x9e\xd2\xb5\x45\x6d\xc8\xc3\x18\x34\x6d\x1c\x64\xbe\xfc\xa5\xa4\xd7\x9e\x65\xc1\xb7\x16\x91\x27\x12\xe3\x1b\xf5\x8e\xc2\xd3\xac\x5b\x5a\xb8\xfc\x89\x92\xe6\xe5\x49\xe1\x41\x0a\x8b\xcf\xe4\xcf\xd9\x2a\x86\x1c\x5f\x74\x48\xa4\x77\x23\xfa\xc5\xdd\x68\x85\xd1\xfb\xda\x53\x99\x1c\x86\x79\x67\xd6\x8c\xe6\x74\xf9\xe0\xe2\xfa\xe2\x8e\x4b\x98\x14\x79\xe4\xc7\x77\x53\x30\xc6\x4e\xa6\x29\xd6\x4c\x34\x91\xd8\x1e\x7c\x78\x0d\x22\x6e\x30\xc5\x9e\x5c\x03\xc6\xa5\xae\xa7\x17\x3e\x45\x23\xa3\xf2\xbd\xad\xd7\x7e\xa4\xf2\x49\xbc\x76\x7d\x42\xd9\x3b\x3f\xfc\x49\xda\x30\xbc\xe8\x91\x1c\x00\x0e\x6c\x6d\xf6\xcc\x3e\x6c\xae\x9a\xe4\x0b\xb9\x4b\xc8\x66\xf4\xdc\x08\x52\x69\xf3\x94\x75\xf3\xd8\xf5\x88\x4a\xd0\xcd\x76\xbc\xba\x8a\x90\x44\x09\x9c\xa4\x29\x6f\xb0\xdb\xd1\x95\xfa\x34\x2d\x69\x3f\x60\xa7\x75\x67\xd6\x2c\x70\x92\x96\x59\xaa\xa6\xea\x58\x6b\xe2\x7a\x48\x0e\x01\x4e\xb8\xac\xc3\x9b\x63\xea\xc6\x2b\x2f\xac\xa1\x51\x2e\x0d\xb4\x6c\x89\x56\xcc\x29\xb7\x76\x22\x47\x69\x38\x00\x69\x11\xe7\xe1\xa3\x7c\xf7\x18\xab\xa6\x1c\x2c\x97\x65\x2a\x46\x56\x05\xd4\x70\xf1\x05\x7f\x8e\x8f\xf9\x0d\x14\x5f\x9e\x87\x21\xb7\x6c\xcf\x97\x03\x40\xef\x9d\xed\xea\xd5\x09\x45\x56\x0f\xde\xbd\xf1\xcf\x66\xdc\xdb\xfe\x03\x9a\xf5\xa6\xd5\x53\xe6\xcd\x6f\xef\x68\x5c\x8f\x1b\x38\xc4\xa8\xe0\xd3\xec\xf2\xd7\xe3\xe6\x25\xf3\x9e\x7d\xf6\x49\x31\x29\x8f\x66\x85\xa8\x7b\xf0\xf7\xad\x22\x78\x97\x62\x4e\x17\x02\x91\xdd\xb7\xcf\x7b\x1f\x4c\x3b\x05\xb4\x71\xa0\xe4\xbc\x46\x4c\x2b\x98\x94\xfc\xdb\xa3\xca\xf5\x15\x91\xcb\xf6\x4b\xba\xf7\x2a\xf8\xc4\x24\x7d\x2f\x02\xe1\xfa\xaf\xf8\xa8\xb8\xc6\x0d\x73\x15\x99\x78\xbe\x21\x80\x73\x4d\x0a\x15\x76\x72\x2f\x8f\xd3\x9b\x4c\x72\x0f\xe5\xe7\x4f\xcf\xc1\x88\x47\x30\x48\xd1\x59\xaf\x02\xc6\x26\x84\x2d\x56\x70\x0f\x69\x7b\x85\x27\x6f\x53\x97\x71\x92\xb1\x9f\x20\x5e\xc3\x54\x17\x27\xa1\x3d\x8f\x38\xb3\xb0\x6c\x07\xdc\x61\x75\x4d\x46\x3a\xf7\x80\x8e\xec\xd9\x64\x5b\x39\x04\x70\xee\xae\x22\x8b\x55\x3f\xe4\x52\xd6\xba\x86\xd9\x2e\x7d\x72\xdc\x95\x94\x04\x5c\x62\x88\xd2\x72\xec\x54\xb0\xa2\x22\xe5\x1d\xfa\x2f\x45\x29\xa4\xc5\x06\xce\x8f\xe4\x94\x40\x0a\x56\x2a\x87\xff\x34\x52\x9c\x77\x89\x6e\x18\x38\x19\x25\x96\x6b\x9c\x2e\xe8\xf2\x93\xa5\x31\xe7\x40\x35\x60\x54\xc3\x6e\xfc\x3c\xde\xac\xf0\x66\x70\xd9\x8e\x62\x8c\xc9\xd2\x41\x47\xff\x35\xdb\x67\x63\x66\x6d\xe5\x59\x55\x69\xa3\x50\xf2\x1c\x6e\x9a\x45\x84\xbd\x08\x64\xd6\x44\xd5\xee\x96\xa0\x5a\xf5\x9b\x2a\x32\xb1\x8c\xc4\x81\x9d\x76\x70\x16\x1c\x68\xb2\x0b\x04\x96\xd6\xa3\xfb\x8e\x4e\x95\x29\xdd\x7f\x28\x7a\x2e\x86\xdf\x78\x72\x01\xe8\x3a\x22\x33\xd6\x00\xbc\x63\x83\x12\xe7\x03\x99\x35\x99\x74\x14\x45\x8b\x14\x07\xb0\x6d\xb1\x81\x06\xf2\x3a\x8f\x51\xaf\xe5\x7f\xf5\x4d\x2c\x11\x9e\xde\xe1\xc7\xc8\x94\x81\xa1\x5c\xf7\xe2\xf4\x9a\x9d\x6f\x52\xbf\x97\x3e\x04\xec\x10\xce\x3f\x20\xcc\x52\x92\x3a\xc9\x18\x3d\x69\xb2\xa2\x55\xa2\xce\xf0\x7d\x8d\xfc\x2b\x18\xf6\x24\x2d\x73\xff\xdd\xed\xf6\x71\xb1\x69\x47\xa8\x4a\xc4\x5c\x06\x06\x08\x65\x88\xae\xe9\x6d\xb1\x3b\x28\x4d\x11\x4d\x7b\x94\xbc\x69\xe7\x23\x73\x36\x4f\x3b\x2c\x3b\x36\x0e\xf3\xeb\xea\x3e\x10\xca\xbd\xbf\xd8\xaf\xca\x8b\xa9\x9f\xfe\xa3\xa6\x0c\x18\x80\xe9\xc7\xf9\x33\x6a\x2d\xcd\xde\xb3\x4c\xd3\xd2\x5f\x94\x83\xe2\xbd\x31\x3b\x84\x82\x38\x50\x42\x39\x4b\xaf\x8f\xa9\xe6\xa3\xf6\x18\x44\x3d\x92\x07\x1f\x22\xf5\x7c\xf3\x1a\xb5\x59\xe2\x42\x3e\x45\x13\xc5\xf8\x24\x61\x28\x58\x00\x77\xb1\x52\xfb\x1d\x66\x9d\x24\x7c\xdf\x2d\x62\x75\x0d\x67\xf7\xf8\x29\x5f\xc0\x87\x9c\x9b\x04\x92\x62\xfc\xe3\x5f\x76\xfb\x62\x24\xf7\xd1\xac\xf0\x99\xe0\x43\x23\x07\xb1\x16\xfa\x4d\xbd\xbf\x4b\xd1\x4c\x9a\xfe\x87\xc7\x28\xc0\x0d\x2e\x2b\xbf\x9b\x4f\xe0\x1b\x02\xa3\x0f\xd7\x7b\x31\x7d\x3e\x2d\x99\xbe\x22\x0f\x8c\x64\x44\xa1\x50\xe3\x83\xc3\xc3\xf7\x50\xb1\x21\xd9\x04\xfc\x98\x19\xe1\x27\x28\xe1\x67\x38\x13\x92\x35\xa4\x3a\x63\x8b\xb5\x40\x61\x0f\x4c\x03\x11\x77\xb0\xad\xfa\x4d\x5a\x33\x8c\xc4\x59\x12\x4f\x53\x54\x71\x7f\xf2\xb3\x90\xc6\xcd\x5a\x31\x96\x33\x54\x94\xe5\x70\x93\xe4\xc6\x4f\x0a\x33\x25\x0d\x0f\x07\x82\xa2\x78\x94\xb5\x0c\x3c\xf3\x70\x88\x29\x11\xa3\x42\x2e\x15\x19\x26\xb7\xa2\x0e\xc7\x5e\xb6\xdf\x94\x69\x4d\x81\xb6\x3b\x47\xef\x16\x06\x4e\x70\x60\x2d\x75\xad\x8a\x14\xd4\xa9\x09\xec\x78\xd4\xe8\xf6\x63\x6e\x7e\xa7\x7f\x09\xf0\xe1\xf9\x63\xf4\x90\xde\xfc\xb5\x56\xe0\x5c\x0f\xb8\x0f\x98\x81\x51\x6d\xeb\x3e\x30\x50\x19\x71\x7a\xbf\xb7\xe4\xe9\xcb\xf5\x04\x10\x51\x1b\xc7\x06\x0e\x34\x7d\x83\xd6\x71\xc6\xda\xa7\x5a\x44\x26\xd9\xfc\xe4\xcb\xcd\x26\xdc\x26\xb6\xeb\x1b\xd5\xaa\x1f\x60\xd6\xc3\x1f\x76\x60\x22\x1f\xc2\x69\x27\xbd\x56\xd2\x9f\xe0\xa1\x21\x30\xfa\x5b\x60\xfb\x0b\xf5\x02\xed\x2a\xbf\xc1\x41\xee\x12\x85\xd2\xbd\x9b\x00\xfa\x93\xc2\xb0\x2d\xf6\x91\x0c\x9b\xdc\x97\xfa\x38\x77\x1e\xeb\x13\xc4\x68\x25\x29\x12\x15\xe9\xbd\x68\x5d\x41\xc7\x42\x5b\xe5\x9a\x7a\x3a\x9d\xfc\x48\x7d\x75\x7e\xf5\x29\xdd\xae\x55\x7e\xf3\x01\xe6\x63\xf8\xbc\x6a\x16\xb8\x92\xd0\x39\xfb\xe1\x40\x93\x99\xdd\xd3\x12\x1a\x8a\xb8\x13\x17\x81\x0d\x7b\xa6\x68\x58\x36\x01\xb4\xe7\x2b\x03\x8f\xee\x9c\x29\xa6\x25\x5b\x9b\x85\xa8\x8d\x73\xf3\xe2\x3e\xdb\xfc\x2d\x29\xa7\x31\x23\x5e\xf9\xb0\x1b\xfc\xa4\x91\x33\x28\x0f\x81\xe0\xcc\x5a\xe3\xdc\xad\x09\x86\xa2\x98\x44\x7e\x9a\xd6\x8a\x0d\x46\x14\x06\xc0\x39\x7a\x83\x1e\x02\xc1\x98\xa8\xed\xf3\x98\xf9\xf3\x89\x88\x57\xb9\x20\x49\x96\xc7\xcf\xfe\xb3\x79\x7c\xc2\x4b\xa5\x6d\x95\xab\x6e\x55\x2f\xfb\x7a\x27\xfb\x2d\xcf\xdc\x21\xbd\x64\xbc\xcf\xdf\xb2\xbc\xab\xbd\xd6\x12\xc8\xdc\x33\x12\x80\x7c\x9f\xcb\x6e\x3f\x6e\x18\x5c\x06\xf7\xf2\xc5\x20\x0d\xa0\x69\x4a\xce\x98\x2f\x81\x7a\x60\x08\x8c\xde\xd5\x7e\x59\x5e\xf5\x94\xb2\xae\x60\xf7\xf5\xd6\xc7\x80\x82\x04\x4c\xe1\x22\xf4\xa4\x1a\x70\xd0\xa4\xdd\x28\xc4\x2c\xf5\xf9\x78\xe4\x29\xe0\xac\xf4\x6d\x90\xd2\x6d\x1f\xee\x8f\xab\xec\x87\x5b\x3d\xf8\xb9\xde\xee\x2f\x8e\x86\xea\xff\x04\xeb\xbf\xf6\xec\x39\xfa\xf4\xe3\xf1\xe7\x62\xf1\xd3\x17\x61\xaf\x66\x24\x45\x46\x70\x51\x39\xc9\x03\xc3\xcb\x26\xcf\x2a\x82\xf8\xf3\xd3\x17\x42\xe1\x74\x48\x69\xab\xcb\xe7\xaa\xe6\xa8\x03\x03\x3b\x2b\x36\xad\xae\xb8\xa5\x6e\x44\xb3\x02\xc3\x6e\xe6\x69\x93\x5b\x3c\x4d\xd3\xff\x78\x46\x0e\x3a\xf5\xb7\xd8\xfc\xa4\xf3\xa6\xc5\xd3\x94\xdb\xc6\xc7\x73\xb9\x3d\x6d\x67\xfa\x3d\x49\x26\xf2\x7e\xff\x6f\xaa\x70\xab\x78\x4d\x83\xbe\x99\xa4\xb0\x62\x25\x8d\xf2\xd7\x3a\xdb\xde\xa8\xb5\xda\x45\x11\x0d\x35\xa8\x74\x2e\xfd\x71\x9e\xfe\xeb\xeb\x7b\x5a\xfe\x16\x50\x2f\x5f\xae\x5b\xe7\x9a\x81\x93\x0e\x81\xc2\x59\xf1\x02\x29\xc6\xf2\xc8\xea\x68\x07\xc9\x82\xf1\xb6\xc7\x7e\xf8\xab\x97\x76\x76\x99\xf3\xb1\xbf\xea\xf9\x4d\xc3\xd5\x63\x2d\x69\xcd\x1e\xdf\xae\xd9\x3b\x69\xc7\x20\xbd\x0c\xea\x8b\xb5\xab\x5d\x6e\x77\xdb\x18\xf2\xde\x93\x7c\xdf\x17\x1b\x48\x76\xcc\xd2\xfe\x43\x51\xb7\x4e\xed\x0f\xd4\xa5\xbc\xd2\x0d\xab\xb1\xaf\xb0\x75\x1a\x1e\x05\xb5\xdf\x6d\x25\x89\x13\xd5\xe4\x2f\xf5\x34\xfb\x60\xaa\x39\x01\xee\xb7\x57\xd7\x5e\xfd\x51\x78\x1d\xe0\xfa\xb1\x4a\x9e\x43\x27\xf7\x1e\x3d\xcd\x78\x30\x60\xb4\x9a\x0f\x29\x0b\x96\x66\x38\xef\x59\xef\xfd\xd7\xd1\xac\xf3\xe9\x2b\xe5\x38\x2b\x78\x58\xd5\x16\xfb\x52\xd2\x2c\xe1\x7e\x0d\x32\x3d\x24\xa9\x64\xa1\x2f\xe2\xe9\xc7\xe3\x87\xe0\x36\x01\xe1\x49\x56\x2f\x39\x87\x22\x14\x8e\x04\xf7\x90\x6b\xb6\x57\xb5\x1d\x18\x09\xfb\x8a\x61\xe3\x73\xcd\x69\x07\x7b\xaf\x64\xb5\x8c\x6b\x02\x88\xb5\x9f\x2f\x3e\xf6\xf8\xa1\x2e\x97\xdd\x9e\x10\x83\x4e\x64\xb1\xfd\xc2\x9c\xd2\xff\xc0\x60\xa2\xef\x4b\xd7\x07\x0f\x6a\x00\x0a\xfe\x3a\xc4\x6f\x47\x30\x63\xb1\xd0\x7c\x82\x9e\xc5\x1a\x13\xc1\x47\xd9\x74\x8b\x1d\xdc\xe6\xf7\x12\x49\x72\xaa\x9e\x4a\x62\x94\x1c\x02\x78\x74\x9a\xf4\x24\xc4\xc5\xc7\x96\xb4\xe6\xcd\x73\xcc\x6d\xd7\xf1\xa4\xe5\x55\x4f\x8b\x08\xe6\x8f\x81\x62\x9e\x5f\x1c\x70\x68\x82\x38\x03\xde\x61\x38\xc9\xbe\xa3\x62\x37\x83\xce\xf5\x26\xa9\x05\x15\x83\x70\x98\xf0\xa3\xdc\x8f\x20\xf2\x69\xa8\x51\x00\xd9\xec\xee\x82\x8e\xdf\x65\xc2\xf6\x38\x90\x8b\x67\x17\x29\x3d\xc3\x7a\xac\x4b\x9e\x6f\xa6\x4e\x12\xd9\x40\x42\x2b\xd2\x1a\x30\xc2\x8a\x44\x6e\x76\xf2\x25\xc0\x39\x2a\xb0\x1a\xcb\xc3\x7e\x22\x6c\x9e\xd1\x2f\xd0\x3a\xa7\xf0\x4e\x57\x12\xb6\x10\x64\x7a\x61\xd9\xe7\xc1\xa5\xf6\x28\x2e\x0d\x4a\xde\x1e\x86\x4b\x0b\xea\x1d\x3c\xd7\x03\x59\xc8\x82\xc7\xa9\x21\x2a\xb3\xc9\x20\x58\x94\x2f\x77\x57\x43\xe4\xbe\xc6\x26\x01\x85\x6a\x70\xc7\x11\xbf\x91\x41\x2c\x80\xf3\xa9\x06\x30\x02\xa9\x26\xb7\x9e\x83\x75\xde\x08\xb7\x83\x05\xb8\x72\x7f\x94\xcf\xc0\x00\xa6\x20\x9b\xdc\xcb\x47\x92\xd7\x38\x87\x4d\xed\x94\x97\xd5\xc3\x1d\x87\x91\x41\x19\x70\x00\x70\x1b\x20\x69\x1c\x26\xe3\xde\x72\x58\x23\xaa\x8a\xbe\x16\x64\x23\xc9\xec\x01\xad\x65\xbc\x01\xd0\x69\xd2\x73\x90\x40\xcd\x26\x2a\x5f\xc8\x45\xca\xcc\xa3\xb4\x0a\x38\x77\xd6\xa3\x5f\x8e\x4a\x41\x35\xe0\x60\x68\x3a\x2a\x90\xdb\xb3\xff\x61\x91\xb6\x03\x2f\x9b\xe1\x28\x2b\x83\xb4\xa1\x99\x9e\xe6\x2f\x92\xef\xdf\x5d\x62\x26\x52\x59\xfc\xe6\x6a\x17\x4c\x23\xdd\xfa\x9b\x4d\xe2\x51\xa7\x04\x1b\x05\xe5\x3c\xc1\xa7\x15\x86\x2a\x47\x70\x25\x42\x59\x20\x28\x94\x0d\x3f\xe1\x77\x09\xf8\x0c\x6d\x51\x1b\xd9\x43\x96\xc9\x61\x9c\xed\xf9\xf6\x6e\x4a\x29\x6a\xbb\xbf\xb5\x3c\x77\x7c\x3c\x04\x93\xb8\x3b\x51\xbf\xaf\x6b\x44\xd5\xdc\x12\x38\x25\x10\x92\x6d\xec\x33\xa2\x32\x32\x75\x58\x57\x41\x0f\x8b\x54\x82\x56\x8a\x82\xbf\x86\x1e\x87\x2d\x7a\x43\xb5\xfb\xdd\x6c\xec\x91\x98\x9b\x63\xfc\x89\x92\xad\xb6\xef\xd8\x93\x99\x7b\xeb\x28\x50\xfd\x51\x12\x41\x6e\x32\xbb\x1b\x33\x38\x4e\x68\x47\x78\x85\xf5\xb4\xdf\xb7\xea\x24\x0e\x02\x74\xb5\x68\xa7\xcf\x93\xe2\xe8\x97\xa8\xc3\x8b\x46\xe7\x7a\xc0\xca\x69\xc8\xbb\x2e\xde\xf1\xe9\x31\x90\x6a\x06\x05\x00\xe3\x6b\x44\x55\xaf\xd0\xbd\x4b\xbf\x47\x5e\xc8\x3e\x4c\xd8\x89\x43\xb3\x4e\xe8\x88\xac\xdb\x09\x8e\x2c\xb2\x87\x4e\x0b\x3c\xcd\x21\x6b\x6e\xe8\x03\x10\xdc\x03\xf2\xde\x58\xb7\xb4\xb4\x4d\x84\x38\xa2\x3b\x5b\xd1\x4c\xc3\x33\x14\xdf\x06\x45\x95\x76\xbf\x72\xd3\xf5\xce\xcd\x9f\x78\x7d\x64\x8f\xa0\x1e\xc1\x64\xec\xc6\x66\xa0\xae\x84\xb7\x44\x66\x83\xdd\xa2\x2d\x62\x1b\x2f\x6b\x60\x60\x11\xa4\x61\x09\xee\xf3\x18\xad\x29\x2f\x81\x9b\x4e\x0b\x52\x13\x23\xa6\xf4\x1c\xa3\xb1\xb0\x7d\x4d\xa5\x9c\x47\x00\x70\xac\x7b\x7f\x32\x3b\xb2\x36\x0e\x38\x40\x15\xcd\x75\x44\x66\x3f\x8a\xca\xc8\xac\x32\x00\x66\xae\x20\x06\xc1\xa4\x52\x9f\x48\x7d\x72\x1d\xa4\xab\x4e\xb4\x74\x31\x98\x99\x1c\x0f\x1c\xf8\x6b\x22\xea\x4c\xcf\x38\x61\x3c\x2f\xd3\x82\x8a\x45\x6f\x68\xfd\xf5\x03\xfb\xfa\x8d\x43\x0b\xaa\x40\x41\x1f\x50\x10\x79\x7c\x0f\xed\x4c\x8d\x87\x4c\x94\x82\x61\x25\xd7\xc6\x5d\x3b\x7c\x22\x0a\xd8\xe6\x16\x1a\xdd\x99\xaf\xbb\x36\x61\x4a\xd8\xf6\xaa\x3a\x8f\xe1\xce\x1b\xa4\x51\x5b\xc7\x19\x41\x29\x27\x1a\x64\x61\xbf\x49\x0e\xc7\xde\x23\x73\xf4\x22\x62\x13\x65\x6e\x18\xb4\x6c\xb0\x28\x13\xcd\x52\x05\x8c\x5c\x72\x10\xaf\xa7\x55\xda\xeb\x0d\xee\xed\x03\x4e\x99\x92\xf5\x55\x26\xe2\x75\x9c\xa3\x89\xd9\x0c\x99\x87\x07\xdd\x47\xbf\x29\x2e\x03\x9b\xa1\x4f\x2e\x83\x74\xd5\xb1\xb0\x3b\x4b\x86\x20\x75\xb5\x24\xbd\x59\x4c\x57\x1d\x05\x1e\x1b\x98\x27\x5f\x1e\xe6\x33\x87\xc7\x6e\x08\xfb\x59\x00\x30\xf4\x8b\x1f\x30\xa7\x8e\x3e\xbb\xf1\x92\x3d\x81\x51\xab\x9e\x75\xf1\x95\xbf\x35\x76\xc6\xc3\xd9\x43\x82\xb0\x85\x8a\x8f\xcc\xd8\x3a\x5d\x88\x0f\x40\xc9\xe2\x96\x1f\x8d\xac\x7d\xe2\xae\xf6\x72\x46\xe8\x36\x32\x64\x8b\x29\x3d\x9b\x94\xcb\x24\x8a\xe1\x21\x88\x83\xbd\xd2\x82\xb8\x3c\xec\x54\xdd\x21\xf9\xd2\x38\xbd\x86\x62\xc0\xeb\x76\x02\x80\x8d\x9c\x1b\x77\x77\xa6\xd4\x09\xe9\x54\xcc\x7d\x2a\xcb\x8d\x41\x7d\xf1\x69\x9a\x32\x5a\x27\x8a\x6b\x31\xae\xf1\xb8\x3d\xff\xcc\x35\xcc\x37\xe3\x69\x4a\xe0\x1a\x27\xb1\x45\xe6\x7a\x8c\x3d\x09\x8b\x9f\x48\x6f\x2a\x0f\x52\xef\x99\x14\xb2\x61\x88\x5a\x14\x68\xd5\x86\x14\xdc\xaf\x9d\x4d\x95\xb4\xc2\x43\x02\xf3\xe5\xe2\xbd\x4b\x96\x7b\x98\xf5\x05\x00\x70\x4d\x2b\x87\xf1\x4d\xdb\x46\x58\xe3\x90\xbb\x7c\x50\x03\x17\x3d\x07\x0e\x6a\x0a\xca\xdb\xa3\xd4\x8e\xf2\xf8\x36\xa4\x6f\x11\x6b\x19\xb6\xe6\x95\xd7\xdc\x34\x71\x85\x3f\xc6\xc4\xa0\x6b\x5f\x07\xec\xbc\x07\x13\xe8\x5c\xb5\xb6\x93\x2d\x83\xf8\x17\xd7\x32\x18\x75\x22\x09\x66\x24\x90\x9b\x43\x2e\xe7\x23\xe1\xf9\xb2\xae\xde\x47\x82\x0d\x40\x13\xa4\x51\x65\xa6\x93\x7b\x79\x6e\xe5\x5f\xb2\xdb\xd3\xe8\x9d\x49\x49\x40\xef\x36\x72\xec\x26\x8a\xa7\x86\x8e\xaa\x3d\xeb\x9d\xa7\xc2\x70\x92\xa1\xb3\x86\xc4\x6c\x21\xde\xec\xd1\x88\x75\xad\xbe\x44\xab\x9b\x78\xfd\x7c\xb2\xac\x7d\xfc\x6e\x17\xd7\xdf\x1a\x6b\xd6\x30\xc1\x99\x01\x69\x99\xd6\x4c\x6b\x00\x02\x04\xbb\xf4\x5d\x44\xc4\x1a\x1f\x35\x47\x77\x35\x5b\xb4\x40\x10\x17\x80\x63\xf7\x18\x16\x3f\x54\xb9\xbd\x8f\x9e\xd3\xea\x34\xe9\x29\x42\x59\xf4\x48\x1e\xef\xbc\x78\x61\x34\xfb\xd7\x65\xad\x1c\xfc\xf9\x37\x76\xf2\x25\xce\xbd\x2f\x96\x0e\x4d\x72\xc6\x40\x62\xd2\x21\x00\x58\xe3\xae\x89\x0b\x8a\x88\x82\x9a\xcf\x95\x0e\x78\x43\x85\x94\x17\xc2\x69\x98\xad\x3b\x8f\xbd\xfd\xb4\x0d\xab\x7f\xd6\xc8\x6b\x3e\xb8\xb5\x18\xc9\x78\xa2\x96\x2c\x1e\x26\x88\x29\x5d\xf7\x52\xb9\x6f\xb9\x22\xec\x1e\x83\x96\x54\x6e\xc2\x79\x91\xe7\xbc\xe4\x4c\x36\xb8\xdd\x88\xcc\x01\x01\x20\xac\xf0\xe9\x2e\xd5\x85\xb9\xf9\xc8\xb9\x50\xd8\x7b\x9b\x94\x7e\xa7\x1f\xec\x80\x67\xed\x51\xfb\x07\x21\x5e\x0c\x1b\xab\xc7\x6a\x57\xab\xda\x0e\x90\x86\x87\x6f\xc1\xc9\xf7\xdf\x13\x90\xbb\x35\xaf\x86\xfc\xeb\xe8\x7c\x2a\x69\xa7\x58\xe8\x86\xa1\xcf\x8a\x16\x92\xc2\x4a\xde\x6a\x18\x7d\xc5\x34\xe3\x07\x7d\xc9\x8d\x55\x3d\x49\xc0\x5d\xbe\x3a\xd9\x51\x68\x95\x4c\xde\x49\xee\xcc\x1b\x84\xa1\xfb\x6e\xa3\xb3\x3e\x44\x85\x61\xdd\xe6\x00\x4b\x3b\xb9\x22\xd9\xe0\xf1\x86\xc0\x68\xef\xbb\x84\x86\x63\xa3\x41\x11\x51\x2d\x7e\x83\x83\xa8\x9b\x4f\xd0\x68\x67\x4a\xaa\xe1\x0b\x17\x0c\x6c\xd3\x94\xc4\x06\xd5\x36\x89\xf7\xc8\xc8\xfb\xc1\xe2\x8d\xf2\x4f\xff\xa6\x23\x1f\x77\xf5\xe0\x0b\x79\x09\x0c\x6a\xa3\x7a\x84\x2d\x10\x85\x42\xa5\xb3\x81\x04\x0e\xb0\x92\x77\x72\x15\x39\x36\x50\xc9\x18\xe5\x50\xb8\x67\x00\x82\x4b\x21\x72\x58\xc3\x3f\xf0\x6a\xda\x91\x03\xea\x8f\xdb\xbe\xc2\xe7\xa5\x0e\xd2\x37\x38\xed\x26\x85\xbb\x20\x6d\xff\x01\xc0\x48\x85\x21\xf2\x89\x52\x72\x58\x49\xd3\x06\x3c\x65\x40\xcf\xad\x53\xe9\xc3\x51\x06\x3b\x2f\xaf\x68\xeb\x89\xb1\x7d\x6b\x57\x67\xd7\xd9\xdd\x05\x16\xb8\x24\xf3\x84\x52\x76\x53\xdb\xdf\x98\x2f\xac\xc6\x97\xb1\x4b\x75\xb5\x2e\xc3\x8b\x8c\x64\x99\xa6\x71\x67\x66\x77\x8c\x04\xa5\xfc\xe6\x17\xe6\xc4\x9d\x99\x3d\xc7\xb5\x88\xe2\xed\xe7\x2d\x95\x57\x3d\x3d\x63\xaf\x9e\xb6\x0a\x27\x8d\xfd\x7b\x99\x7c\x74\x2c\xa4\x57\xd5\xfb\x26\xb3\x8f\xfe\xcb\xb7\x04\xc8\x4f\xab\xc1\x41\x1a\xec\x13\x08\x9c\xbd\x11\x65\xf5\xe0\x7d\x8f\xb4\xf1\x83\x12\x1d\x75\xc3\x3d\x6b\x55\x4e\x3f\x0b\xef\xed\x55\xf8\x6b\x53\x32\xab\xba\x52\xab\xb3\x1a\x3a\x87\x1e\xe3\x9d\xa6\x1e\xc0\xa1\xcd\x99\xab\xfc\xbd\xaa\xa3\xbf\x23\x11\x06\x1d\x57\x25\xfe\xff\xc6\x13\x72\xe6\xff\x96\xd6\x6c\xb3\x77\x86\x2f\x5f\x7c\xfa\xf1\x78\x0a\x18\xeb\x1d\xa2\x80\x31\x3f\xf4\x2d\x90\x69\x8a\x7d\x20\x82\x00\x19\x76\x03\x49\x1b\x9d\x9e\xbe\x68\x0e\x95\x4b\x85\xd3\x21\xdc\x37\x24\x02\x1b\xbd\x9a\x48\x3e\x6c\xb4\x91\x08\x4c\xa9\xc8\xf7\x4e\xfe\xd4\x3b\xd7\x5f\x5d\x7b\xb2\x1a\xb8\xb2\xf2\x97\xb2\xcf\x98\xaa\x7a\xc9\x1a\x97\xc6\x04\x5c\x6e\x8f\x4b\xa5\xf3\xb2\x14\xb4\x5e\x8d\x5d\x59\xda\xa4\x63\xdc\xec\x3f\x4c\x07\xc7\x4b\xb2\xdf\x2e\x8d\x09\xdc\xe0\x3f\x36\x57\x71\xf4\xd8\xab\xc5\xb7\x1d\x96\xfc\x9a\xa5\x31\x41\xdb\x98\xe9\x75\x4f\x79\x60\x0e\x9c\x59\x67\xf5\x68\x75\xff\xd8\xf1\xad\x75\x23\xcc\xcd\x63\xba\xae\x7b\x84\x4a\x67\x6e\x16\x60\x1e\xfd\x93\xed\xf2\x45\x6e\x2f\x04\x39\x63\xc7\x2d\xd5\x9f\x85\xa9\x2f\x45\xff\xf6\xcf\xf7\x0d\xbf\xbd\x29\x13\xb6\x09\xe6\x76\x17\x48\x1f\x5a\x3c\xb1\xf9\xe1\x6f\x0b\x83\x70\x6e\xcf\x45\x52\x51\xd6\x70\x50\xca\x89\xdd\xb7\xba\x18\xb4\xfd\x98\x65\x6a\xc0\x57\x31\x8a\x4f\x35\xe9\xd9\xe1\xdf\x47\x5d\xbc\x47\x6e\x8b\x49\x5e\xbb\xdd\x10\x0b\x00\x3b\x5d\x20\x77\x9f\x2c\x9d\x63\xd3\xf3\xc6\x4c\x55\xbd\x48\xc5\xea\xc5\x18\x6e\x78\x06\x9b\xfc\x65\x62\x21\xd7\xe8\xf8\x85\x39\xdd\x5a\x83\xd0\xcc\x43\xc2\x6b\xec\xd5\x1c\x8a\x0c\x14\x65\xe8\x3a\xe4\x0f\xe4\xb3\xf4\x54\x6d\x38\xdd\x20\xc2\xce\x5f\xdb\x51\x94\x77\xec\x4a\x47\xd1\x0a\xf6\x43\xa1\x0a\xc2\x2b\x91\x24\x73\x63\xb1\xc4\x78\xa0\x37\x0c\xb3\x19\x68\xe3\xcf\xfe\xaa\x75\x6c\x66\x45\xfb\x0a\xec\x9d\x9d\x25\x58\x44\x97\x92\xf1\x5e\xc0\x8a\x93\xdb\x48\x4d\x5c\x24\xd4\xfe\x80\x6e\xc0\xa1\x58\xd9\x17\x31\x6d\xd1\x16\xe8\x76\xb5\x95\x01\xc0\x81\x7d\xb9\x47\xf1\xa1\x4b\x21\xc5\xc4\xce\x62\x2c\x76\xad\x6a\xe3\x0a\xa2\x9e\x65\x12\xdc\x8b\xb9\x20\x73\x4f\x3e\x41\xcf\xca\x00\x58\x52\x58\x60\x8a\x96\x6b\xa9\xae\x36\x8a\x32\x26\xcd\xc2\x8f\xfd\x55\x09\x71\xf1\xaf\xef\x0f\xd7\xd7\x92\x7e\xb7\xa6\xe1\xef\x1d\xf1\x24\x61\xe3\xe2\x5f\x0b\x1b\xf9\xd9\x7f\xbe\xaf\xaa\x70\xfc\xe5\x1e\xb9\xf3\x67\xc5\x42\x40\x0e\x46\x0b\x9c\x34\x71\xc7\x37\x58\x18\xd4\x49\xb3\x1d\x1e\x1a\x00\x4b\x76\xe7\x16\x87\x64\xca\xc0\xa3\x4a\xd5\x85\x99\xd9\x73\xbf\xdc\x3d\xab\x8f\x2e\xfb\xf3\x47\x06\x1c\x6e\x13\xa0\x8d\x10\xd1\x1f\xad\x0b\xde\x29\xaf\xd3\xc7\xdd\xe1\x11\x7b\x20\x26\x58\x1b\x51\x8c\x9d\x7c\xe2\x96\x6a\x08\xf0\x7a\xe6\x96\x96\xc2\x08\x4d\xde\x0a\x3c\xe3\x58\x1f\x5e\x18\x51\x58\xb9\xa3\xb4\xa3\xaa\x48\x31\x6b\x5b\x90\x15\x3a\xd7\x45\x2d\xc8\x0a\xfc\xcd\xe0\x3e\xc1\xd9\x65\x68\x8d\xd2\xfd\x0f\x64\x0f\xb5\x82\x42\x90\xbd\x1e\x68\x65\x60\x65\x71\x23\x41\xb5\x1c\xbe\xdc\x7e\xe4\xbb\x53\x8c\xb3\xe7\xf7\x19\x25\xb6\x2e\x53\x65\x58\x34\x72\xd7\x0a\xed\xfd\xea\xad\x52\x04\xc8\xc4\x13\x35\x07\x73\x8f\x8e\x1b\x62\xc5\x31\x0a\x62\x44\xd9\x22\xc8\x18\x91\xb9\x8c\x5b\x02\x6f\xa1\x87\xe8\x62\xa5\xbc\x41\x6f\x48\xc7\x2b\x21\x1d\xcc\x8d\x05\x5c\x5b\xb1\x71\xf1\xbd\x62\x0d\x40\x24\x41\xca\x8a\xd4\x4c\xd9\xeb\xaf\x1a\x88\x41\x3c\xcc\x32\x70\xc4\x26\x8b\x55\x44\xe0\x97\x39\xf4\x3b\xbe\xc6\x8a\x6d\xa6\xd0\x74\x81\xbe\x51\x62\x64\xfe\x8a\x9f\xea\xf1\x85\x61\x01\xfc\x2f\x0e\x49\xfe\xb8\x12\xf8\x20\x48\x3b\xd6\x6a\xed\x20\x8b\x12\xd1\x6a\x95\x11\xb2\xd3\xbb\xcf\xd6\x35\x0a\xbb\x92\x80\x6d\x64\x79\x17\x8b\x1c\x54\xd6\x3f\x01\xb4\xda\x33\xe8\x21\xba\x70\x12\x56\x87\xa1\x67\xe8\x67\x4f\x95\x7c\x80\x22\xb1\x31\x29\x7a\x8a\x5f\xca\xf3\x19\xc5\xb5\xd6\x13\x8d\x52\x65\xe0\xe0\xd3\x30\x93\xb9\xee\xdb\xc5\xb9\xbb\x27\xde\x66\x4e\xec\xd6\x7c\xcc\x06\x57\x96\x05\x22\x16\x2d\x8f\x56\x1c\x45\x0c\x27\xd2\x2d\x88\x72\x13\x79\x0d\xa6\x7e\xc6\x97\xd8\x77\xbe\x1e\xca\xe4\x2a\xb8\x38\x45\x74\xfe\x55\xa3\x8d\x7d\x06\x5f\x74\x48\x94\x52\x4f\x81\xe7\x1e\x1d\x4f\xb1\xcf\x8c\xca\xc8\xc4\xe7\xa7\x62\x22\x1d\xdf\x06\xb9\x1e\x94\x43\x80\x73\x47\xd7\x2d\xb6\x08\x38\x1b\xab\xb2\x7d\xab\x46\x7c\x73\x83\xa2\x7f\xcc\xfc\x51\xff\x77\x12\xff\xc5\x13\x98\x59\xe0\x04\x2d\xaf\x9c\xc4\xb7\xbc\x8c\x14\x49\x28\x7d\x3f\xb9\xb4\x20\x19\xee\x1f\xa9\xa5\x91\xb9\x54\x96\x20\x5e\x4a\xdb\xb0\x6f\x11\x68\x26\x19\x23\x68\x92\xc2\x0b\x5a\x4f\x08\x2c\xf4\x84\x5c\x28\x0b\x9c\x1b\x2d\x6f\x7f\x9e\x3b\x4f\x18\xa2\x62\x01\x40\xf7\xf6\x1f\x25\xd3\xf4\x36\xdf\xeb\x5e\x50\xe5\x3b\x27\x8f\x47\x4c\xe9\x9f\x6e\x23\x12\x50\x7e\x22\x38\x12\xa3\x9b\x22\xd3\xea\x96\x04\x0f\x83\xdb\x43\xa8\x52\x21\xbb\x1e\x51\xa3\x63\x98\xb3\xc6\xa6\xba\x0a\x9a\xc7\x93\xd4\xc9\x96\x10\x8e\x9a\xeb\x16\x47\x9d\xe1\xfd\xe8\xf9\x5d\x83\x1f\x6b\xa8\x4b\xf6\x3c\x76\x8b\xde\x58\x53\xc1\x5f\x7c\x43\x00\x77\x2f\xe4\xbd\x45\xdf\xf9\x8f\xfb\x5f\xc7\xe5\x82\x01\x65\xfb\xb7\xef\xbf\x89\x66\x1d\x7d\xe0\x5e\x9c\xbe\xf9\xb3\xe4\x03\x74\x3f\xc9\x71\x58\xcd\x38\x65\x58\xd3\x37\x6f\xb4\x5a\xe4\x93\xf9\x11\x45\xda\x59\x64\x80\x45\xeb\x38\x8f\x14\x3e\x9e\x17\x9d\x0c\x9c\xf4\x94\x1a\x8a\xb9\x4b\xb9\x47\x0f\xf5\xb2\x46\x5b\xf9\x2f\x74\x55\x86\x9d\x30\xe7\xd5\xd2\x62\xed\xee\x26\xc9\x94\x01\xaf\x5d\xbe\xc0\x92\xf7\x06\xff\xb7\xe5\x56\xf5\x7f\xfd\x69\x3f\xe2\xa5\x5e\x60\x31\xc0\x7b\x54\xdf\x11\x45\x93\x08\xf2\xac\x8b\x2e\xac\x49\xc8\x06\xc5\x97\x6f\x1c\x52\x0e\xe0\x71\xf1\xf5\x08\x9e\x46\x9c\x2f\x75\x7f\x5c\x47\x1d\x49\xe6\x93\x7b\xa8\x02\x9d\xa1\xd9\x98\x39\xa2\x67\x68\x0a\x93\x07\x4e\x64\xee\xed\x96\x6d\x78\xab\xe8\xc8\x42\x35\x44\x5c\xee\x6e\x64\xe9\xc0\x71\xa9\x4c\x0b\x06\x58\x25\x07\x66\xc4\xf1\xd9\x9c\x0d\x97\x0d\xaf\x2d\x44\xc0\x3f\xb1\xea\x22\x31\xf5\x9e\x69\xf9\xf5\xbd\xe3\xd0\x54\x75\x74\xd8\xf6\x37\x45\x41\x4f\xbb\x27\x96\xa2\xf0\x68\xfa\x9c\xfd\x08\x58\x30\x87\xa9\x54\xbe\x62\xc1\xd7\x9c\xab\xc8\xdc\xa1\x58\x60\x14\xdc\x99\x07\x5d\xc3\xde\x4c\x17\x84\xfa\xbe\x7a\x9d\x09\x7b\x3d\x56\x12\x66\x51\x94\xdd\x1f\x87\x19\xae\xd5\x9b\xf1\x46\xd0\x35\xc5\x89\x25\x23\x2f\x3e\xc4\x6b\xfb\x20\xb3\x33\x32\x46\x32\x1d\x3b\x22\xc2\x2a\x0c\x79\x42\x78\x2f\xa9\x4b\xb9\xa0\x4e\xee\xa3\x79\x6d\xfe\x47\x79\x59\x47\x55\xdb\x6b\x1a\x24\x0b\x63\x10\xc8\x32\x1c\x48\x24\x7e\x94\x41\x80\x80\xee\x2a\x72\x5d\x30\xbd\x1e\xc2\xd6\x46\x48\x4e\x24\x6d\x7c\xcb\x19\xfa\x23\x1e\x9c\x4b\xaf\xa2\x75\x22\x97\xce\xf0\x8d\xe3\x81\x45\x9e\xf5\xb0\xcb\x47\x64\x36\xf5\xed\xed\x8c\xd7\x06\x40\x9b\x3f\x23\x7f\x9e\x63\x3e\x51\xd3\x7e\xe6\x46\xec\xec\x44\x45\xea\xa1\xa8\xb6\x5d\xd8\xf8\x44\x70\xe9\xd7\x41\x39\xff\x71\xa5\x95\x7e\xec\xf4\x15\x2f\x1d\xd1\xa0\x8c\xec\x78\x10\x5e\x47\x61\xa0\xf2\x6d\x5f\x63\x01\x00\x1f\x0e\xe9\x3d\x72\x69\xf8\x64\x53\x59\xcb\xe6\x33\x90\xbb\xa0\x62\x78\xe6\xac\x8d\xbb\x87\x84\x72\x3f\x1a\x62\x3e\xa1\x22\x5f\x5c\x28\x78\xa2\xd6\xec\xae\x86\x48\x7a\xe9\x6f\xf9\x52\xf7\x70\x10\x3a\xec\x27\x86\x71\x2d\x71\x9c\xc8\xb9\x34\x05\xd3\x77\xfc\x64\x78\x9c\x26\x92\x50\x7a\x72\x4a\xc0\x3a\x69\x0f\xeb\x22\x8d\x45\xce\x5f\xbb\x45\x6c\x0f\x01\x0e\xee\xc9\x3d\x8a\x1f\x79\xec\x8c\xb5\xad\x23\xa9\x1f\x13\x1c\x0e\xa5\x3f\xb4\xa7\x64\xad\x2b\x30\x28\x98\x7a\x90\x58\x7f\xa8\x2c\x02\x23\x11\xaf\x91\x7c\x42\xb3\xfa\xbd\xdb\x69\x8b\x46\x3b\x96\x20\xf7\x92\x80\x10\xf8\x25\x1f\x4d\x8c\x77\xfb\xd4\x8d\x2c\xc1\xcc\xec\xb3\x68\x60\x1b\xbc\xa7\x59\x04\xcd\xbc\xa7\x0b\x2c\x35\x0e\x95\x7b\xe0\x45\x31\x4c\x63\x6c\x60\x3d\xed\xac\x04\xd9\xa7\xb1\x9c\x67\x08\x8c\xde\xd7\x07\xa6\x3d\x72\x03\xd7\xf9\x2d\x69\xb8\x88\xd9\xf1\x56\xbf\x18\x5c\x9c\x52\x2e\x38\x16\xf6\x36\x1d\xb4\xe9\x10\xb7\xe3\xde\x4f\x66\xaf\xe7\x69\x04\x8a\xaf\x2f\x26\x21\x9e\x32\x2e\x9c\xdc\x37\x03\x83\x8b\x2f\xa7\x65\x05\x1a\x46\x35\x4e\xb3\xfa\x27\x44\xd0\x4c\xbc\x78\xf6\xae\xf1\x6c\xe6\xdd\x0a\x3e\xab\x78\x11\x8c\x9b\xcb\x4f\x21\xb7\x2f\xc3\xd3\xe2\xb5\x80\xd1\xdf\xd6\xe3\x42\x82\xcf\xc0\x22\x78\x67\x96\x7d\x89\xdf\x74\x43\x1f\xd5\x54\x11\x92\x36\x5e\xfa\x4d\xb9\xa0\xae\x1e\x92\xcb\xa4\x9e\xef\x47\x56\x0e\x78\x64\x84\xbc\xad\x25\xfd\xce\x32\x4d\x73\x4b\x35\x94\xee\x67\x99\xa6\xa5\x3b\xdc\x91\x6d\xde\x5b\xb8\xf9\x72\x22\x29\x69\xcf\x56\xfa\x2c\x35\xee\xb2\xac\x46\x04\x4f\x2b\x6c\x07\x6d\x76\xda\x60\x03\xeb\x4b\xb0\xc5\xe5\xcb\x70\xbc\xc2\xc5\x35\x83\x47\xce\x69\x1d\x23\xb5\xaf\x2e\xbe\x33\x0f\x54\x99\x63\xa7\x2c\xfe\x3a\x78\xf6\x67\xc7\xac\xba\x2d\x05\xf8\xf3\xe1\x77\x90\xe4\x48\x13\xfc\x49\x6c\xfd\xe2\x11\x46\x6d\x97\x61\xc2\x33\xb5\xce\xa4\x7f\x3d\x32\x00\xe8\x45\x7b\xd0\xac\x9e\x45\x7e\xa3\x2d\xcc\xd5\xa2\x73\x7a\x0c\xc4\xb7\xdc\x8e\x71\x20\x5c\x2c\x91\x24\xa7\x0e\x98\x1e\xf7\x13\xc5\xf8\x46\xcb\x8a\x51\x0e\xf5\xb6\xf2\x98\x3a\xc9\x37\xc0\xa5\xa6\x8d\x87\x1b\x0f\x7d\x0e\x3e\xe4\x41\xda\xf8\xb3\x8e\x9d\x34\x4a\x3a\xa0\x23\xad\x2f\x6d\xe1\xc0\x6a\x9e\x3d\x7c\x40\x4c\x36\xf7\xca\x06\x7d\x95\x0b\x1e\x53\xc5\x69\x2f\x0f\xed\xe8\xaf\xaa\x49\x02\x42\xf0\x4d\x79\xf3\x9c\xed\x8c\xa3\xc1\xcf\x4e\x2e\x75\x37\xf6\xd6\x26\xee\x31\x68\xa1\xc1\x60\x17\x0d\xe5\x34\x18\x8c\x1b\x7c\x28\xe8\xa8\xd2\x27\xca\x64\x17\x52\xed\xe3\x59\x99\xde\xbd\x7c\x6c\x9f\x7e\x5b\x05\x55\xae\x37\xe8\x00\x20\xde\x15\xc6\x98\xb4\xe3\x17\x8f\x8e\xb2\xf3\xf2\x84\xf1\x28\x6b\xd2\xf0\x70\x63\x4f\xe9\x8b\x01\x26\xab\x28\x61\xa6\x65\x96\x9d\x3d\xe2\xf7\x0a\xa5\x1c\x1b\x96\x30\x0c\xd6\xf5\xe4\xf6\x3c\x27\x1f\xdc\x94\xa9\x63\xb3\xd8\x54\x12\xd9\x03\x17\xc4\xa3\x50\x5d\xfa\x4d\x5a\xf3\x1a\x8b\x8b\x89\x66\x22\x9a\x9d\xcc\x0a\x3b\x2c\xb7\xfc\x29\x90\x45\xbd\x95\x06\xc6\xa1\x1c\xea\x3f\x10\x4d\xaf\x46\x87\xab\x41\x80\xeb\x95\x55\x31\xde\xda\x73\xc1\x3f\xeb\x54\x13\x90\x47\xf1\x56\x52\x3b\xd8\xb9\xee\x4c\x9b\xde\x07\xf0\x64\x6b\x04\x6a\xcc\xba\x93\x90\x34\x44\xe2\x5b\x3d\x86\x21\xd8\x93\x86\x49\x6a\x2f\x35\x44\x6d\xc8\x24\x59\x5d\x7d\x41\xe0\x04\x95\x3b\x6f\x0a\x34\x5d\x39\x66\x6a\x67\x09\xbc\x3c\xb2\xe7\x0d\x9d\xd0\x83\x52\xbd\x11\x04\xce\x1e\x2d\x9e\x03\x9e\x67\x23\xa1\xca\x1d\xa7\xfb\x91\xec\x9d\x58\x86\x4d\xff\x11\x0c\x2f\xb9\x15\x19\x17\x56\xd9\x0e\xd6\x0e\x4b\x55\x80\x83\x8f\x39\x4a\xd3\xa8\xa9\x8f\xfb\x53\x88\xa8\xf8\xb1\xf2\xb9\xb9\x10\xe3\xd7\x8c\x6c\x46\x36\x1d\xfe\x00\xa2\x37\x36\x4c\xd0\x3e\x29\x27\x9d\x97\x3d\x26\x6b\x14\xac\x5b\x21\xac\x64\x05\x77\xff\x45\xe9\x9a\x56\x7a\x86\xb7\x69\x18\x18\xc9\x50\x1b\xe7\x76\x2f\x5f\x48\x4e\xe6\xa2\xa5\x30\xf1\x91\xd7\x36\x9d\x20\x5d\xa3\xc9\x44\x14\x33\x0b\xac\x40\x2d\x99\xb6\xb2\x83\xb9\x1f\x57\x27\x2c\xc2\xd8\xfb\xaa\xc4\x98\xaf\x96\xe6\x3c\x7c\xcd\xaf\x3c\xdb\x15\xca\x83\x6d\xd7\xfe\xdb\x8e\x67\xec\x5e\x7f\x4b\x49\x09\xd6\x89\xaa\x64\x65\xf6\xd0\xf1\x6f\xec\xa5\x5d\x55\xcd\x39\x17\xbb\x27\x08\xc3\x2a\xf0\x3d\x12\xf3\x37\xbd\xb6\x12\x1a\x7d\x6f\x8e\x84\x89\x3a\xb7\xea\x47\xbd\x3b\x35\x7f\xe5\xd4\x10\x73\x22\xfa\x58\x82\xd6\x30\xd9\x27\x46\xfb\xc4\x0b\xa2\xea\xdf\x54\x61\xcf\xf9\x48\xef\xd6\xd8\xcf\x47\xd1\x95\x42\xc7\xd0\x4f\x2a\xab\xde\x39\x8a\x95\x7f\x99\xab\x2e\xcb\x2a\x5a\x57\x12\x5e\xdb\xa1\xf4\x37\x69\x32\xf7\x68\xb6\x6a\x78\x8f\x52\x42\x32\xd7\x38\xfd\xef\x3a\xac\xc5\x19\x6b\x1a\x9e\xfb\x3f\x8a\xed\xcf\xaa\xe1\x56\x0f\x2c\x30\x41\x98\x1a\x17\xae\xde\xba\x55\xcd\x6c\x09\xcd\x3e\x7f\x34\x42\x73\x49\x82\xfe\xf1\xbf\xcb\xee\x2b\xcf\x8d\x88\x03\x03\x37\x33\xab\xf3\x9b\x3f\x9e\xdb\x75\x1c\x2d\x7f\x4c\xe8\x71\x5c\x4d\xc9\x21\x07\x06\x4e\x99\x3d\x36\xc7\xfd\xfb\x2c\xc0\xce\x04\x6f\x95\x08\x63\xbd\x5b\xd5\x63\xe3\x25\xd9\x1f\xc6\xee\xef\x5a\xa9\x28\x4d\x6e\x42\x26\x28\x7a\x64\xf1\x39\x21\x3c\x93\xe0\xa1\x78\x59\x44\x84\x0f\x24\x6d\x24\x1c\xc2\x9e\x0c\xf8\x9b\x16\xeb\xac\x63\x5d\x6f\x97\x28\x8b\xfe\x45\xc5\x30\xc2\x2e\x3d\x93\xe0\xb1\x11\xd9\xd3\x5c\xc9\x59\x9f\xbb\x7a\x01\xf0\x7e\xa3\xfd\x03\xae\xdb\x0f\x87\xcc\x92\x78\x28\x51\x4d\xbe\xf1\x2c\xcc\xd3\x7f\xf5\x80\x70\xe1\x56\x5d\xf7\xa4\xf2\xe8\x4f\xc2\x56\xd6\x86\x16\xab\xbb\xd2\xf5\x05\xbf\x5f\x95\x58\xb6\x40\x7f\x72\xff\xe2\xb7\xab\x3d\x1f\xbd\x99\x63\x8e\xa9\x03\x8e\xff\xd0\xd0\x4b\x8b\xde\xf5\x77\xed\x77\x2c\x2c\x4c\xca\xe4\x94\xea\x90\x06\xae\x3e\x18\x5f\xbf\x7a\x3f\xe0\xd7\x4a\x95\xc3\xd4\x31\x17\xc8\xdd\xad\x25\x78\x57\xe7\xdb\x3d\xd0\xfc\x37\x48\x0e\xcc\x67\xcb\xdf\x8a\xa3\xe4\x1f\xb1\x78\xa5\x83\xba\x11\xcd\x83\xe9\x9a\xe9\x67\x4c\xe5\x39\xee\x58\xbb\x9a\xcd\xab\x47\x6b\x8b\xf7\xfe\xe4\x7d\xea\xf7\x77\xc6\x8b\x19\x3c\x4b\x69\x72\xed\x0f\x7f\xdf\xbc\xdf\x9f\xec\xad\x9d\xbb\xb1\xa9\xbc\xea\xe9\x11\xc8\xbf\x5b\xdb\x4e\x55\x40\x54\xf8\xbe\x46\x3e\xd8\xc0\x24\x8e\xd9\xad\xec\x42\x24\xa3\x30\xd1\x6f\x3f\x79\x37\x57\x44\xe6\xba\x17\x9f\xa4\xc8\x14\xeb\x60\xa8\x35\x79\x7d\x4a\x24\xd4\xfe\x2f\x7e\xf6\x9f\xb0\xd4\x82\x0a\x7e\xbb\x1c\xaf\x1b\xbe\xe1\x97\xe9\x16\x43\x00\xb7\xcd\x4e\x39\x01\x13\xfd\x76\x6a\x47\x40\x9e\xfe\xb0\x59\xb4\x62\xd4\x4d\x8a\x2b\x2b\x81\xe5\xbc\xb3\xfa\x11\x3c\xe2\x0c\xb0\x98\x77\x56\x9f\x69\x8a\x2d\x15\x85\x65\x9f\x3f\x34\xcc\xf0\x67\xba\xda\x51\x2d\x06\xc9\x5f\x95\xdc\x69\x59\x90\x55\xaa\x11\x67\x0e\x0e\x34\x95\x1e\x83\x34\x34\x0a\xb5\x88\x94\x8c\x8d\x47\x56\x90\xfb\x93\xa7\x40\x30\xaf\xdd\x52\x5e\xf5\x34\x5c\x3d\x38\x1b\x2c\xb7\x05\x82\x78\x7e\x11\x4c\xc1\x6d\x78\x0d\x1f\xb9\x66\x5b\x65\x91\x2d\x3b\xb0\x1a\xcb\x93\xb7\x52\x37\x5c\x26\x9c\xf8\x4a\xc7\x60\x2c\xe4\xee\x1f\x26\xd8\x7f\x0b\xb1\xcf\xf0\x77\xef\xee\x93\xd0\xb6\x61\x03\xd5\x0a\x16\x41\x1b\x8a\xac\xc6\x41\xb6\x8f\x8a\x45\xab\x39\x87\x55\xa5\x66\x5b\x0c\xc0\xe9\xd6\x49\x5b\x66\x30\xaf\xbe\x6a\xb8\xd1\xdf\xc2\x94\x41\x36\x9e\x31\x46\x44\x62\xd2\xab\xda\x0e\x28\x88\x5a\xc7\x0f\x60\xf3\x92\xa7\x80\x63\x13\x34\x16\xa2\x4f\x1f\xe0\xe1\x73\xe1\x2c\x3e\x52\xf3\x68\xac\x1a\xdc\xf2\x20\xfd\xb5\xb4\x3d\x11\xd0\x56\x52\xb4\x60\x6f\x60\xab\x8f\x7e\x13\x92\x0c\x6e\x24\x4b\x64\x69\xc2\x61\x01\x5c\xfb\x24\xd0\x46\xa0\x10\xd8\xfa\xb8\xea\x56\x64\xbf\x08\x9a\xfa\xc6\x04\x75\x85\xc9\xa2\x75\x46\xa9\x39\xd4\x36\xac\x71\xde\x35\x27\x54\x06\xba\x7e\xc3\x18\x13\xd3\x68\xf0\x13\x4c\x53\xac\x8b\x68\x09\x76\xc7\x32\x31\xa3\x68\x42\xf3\xf3\x7c\xa0\x51\xe2\x08\x2f\xe3\x92\xb8\x36\xea\x0e\xd6\x9e\x00\xdd\x70\xf5\x46\x83\x67\xd9\xdd\x04\x10\x02\x3c\x2b\x82\xb9\x76\x9f\x3c\xe1\xab\xe2\x13\xb5\x2b\x77\x17\x2f\x9b\xfc\x1a\x8c\xc8\x29\x8b\xbb\x4d\x9e\xc3\xb1\x1f\x7f\x9a\x08\xac\x1b\xcf\x1f\x18\x98\x24\x50\x59\xe9\x11\xe7\xe8\xb9\x3b\xb9\x0a\xbc\xca\xd1\xe6\x66\x72\x18\xcd\x99\x1c\xc6\x8b\xdd\x57\xfd\xc2\x9c\xe8\x16\x7c\x67\x63\x32\x03\xbc\xe3\x50\x89\xbf\x8b\x0c\xe5\x47\x41\x49\x24\x4c\xe9\x05\x3a\x2d\x7c\xdf\xad\xa8\x8c\x4c\x6b\x0a\x54\x4e\xc0\xec\x9a\x4a\xf3\xcc\x33\x79\xb0\x18\xbc\x30\x2e\x41\x71\x3b\xb9\x5c\xef\xe5\x38\xde\x20\xc4\x8b\x71\x72\x70\x87\x68\x05\xda\xb4\x17\xa8\x78\xc2\x13\x61\x8a\xa8\x94\x77\xbd\x31\xfe\x56\xf2\xbc\xaa\x17\xef\x62\x3e\x2f\x6d\x21\xce\xb0\xc1\xc6\x3e\x1e\x8f\xd4\x04\xad\x6c\x64\x8e\xc3\x6a\x75\x3f\x26\xc7\xa0\x6b\x0f\xfc\x4a\x84\x71\xc4\x03\x48\x6b\x72\x90\xbd\x65\xef\xd9\x60\x71\x22\x26\x45\x6e\x81\x21\x81\xaf\x3f\x59\xb5\x21\xff\x18\x2d\x59\xe1\x61\x57\x5f\x55\xaf\x9b\xc1\x7d\x26\xfb\x4b\xa2\x32\x32\xab\x2c\x70\x4c\x4f\x4d\xc0\x8d\x1a\xc5\x49\xba\x77\x1f\xa9\xe9\xea\xdd\x5e\x3d\xa2\x67\xe8\xa7\x01\x0c\x4c\xd6\x10\xaf\x6c\x1e\x03\x9c\xa7\xd6\x07\xb2\x38\x30\x7f\x1f\x03\x0a\x16\x00\xee\x94\xcd\xcb\x3e\xb9\x43\x33\x9d\x23\x6a\x37\x22\x38\x22\x47\x67\x86\x94\x9b\x85\xa4\x0e\xb1\x35\x46\xeb\x44\x69\xb6\x5b\x2c\x94\x8d\x24\x0e\x05\xcb\x8f\x18\x07\xb0\x1e\xca\x46\x8f\xd5\x1c\x02\xf5\xe4\x24\xfe\x73\x6f\xcb\x2c\x33\xd1\xca\x46\x32\x4c\xbd\x6e\x3e\xe7\xe2\xc7\x1f\xb1\x49\xc0\x8e\xfd\xf5\x11\x3c\xd6\x6b\xcd\x19\xdb\xab\xf1\xe7\x8f\xe5\x82\x8e\xb3\xc2\x76\xbe\xeb\x06\xdc\xe2\xab\x7e\xfd\x81\x38\x1e\xeb\x20\xb0\xee\xf3\x7c\x5e\x96\x7b\x06\x96\x71\x72\x66\xea\xca\xcb\x86\x1b\x4e\x19\xbf\xe8\xb4\x60\x9f\xb1\xe0\x00\x80\x9a\xca\xf0\xba\x50\x4d\x64\x42\x70\xf3\x20\xdb\x1d\x75\xc3\x95\x62\x78\x38\xc9\xb0\xf5\x4e\x8e\xb7\x1a\x42\xf0\xf1\x5b\xbd\xa4\x16\xe4\xbe\xf6\xb4\xb7\xc5\x41\x7f\x1a\xbb\x8d\xf5\x77\x12\x66\x54\x34\x23\xe0\xc7\xa6\x15\x39\x72\xa6\x30\xe7\xf0\x8c\xf5\xfe\x4f\x07\xe4\x59\x8a\x95\x47\xce\x27\x48\x16\xc6\xaf\xb0\xb8\x19\xca\xda\xee\x65\x55\x12\xab\x74\x88\xa9\xf9\x79\xde\x3e\x6b\x37\x9b\x49\x3d\x0b\x7f\x3e\xb3\xb6\x22\x19\x4c\x1b\x81\x3c\x72\x2f\x4e\x87\x78\xcd\x88\xa6\x3d\x16\x6c\x45\x31\x64\xf5\x97\xe7\x65\x24\x82\x7c\x67\x55\xdb\x22\x05\x56\x4b\x7f\xb7\x60\x22\x4a\xc3\xc8\x94\x81\x97\xc1\x6a\x88\xa8\x8c\x4c\x1d\x14\x62\x91\xe6\xf7\x42\x93\xfa\x6a\xb4\xa8\x92\x3d\xb1\xa7\x88\xa5\xf9\x79\x70\x0b\xe2\x13\x3a\x6b\x46\x65\xda\xa3\x42\x7a\x6a\xc6\x71\x7b\xda\x05\x5f\xa7\x3d\x96\x92\x61\xa6\x50\xb3\x51\x79\x47\x2d\xdb\xbe\xfe\x6c\x36\x28\xde\x1b\x6d\xa3\xf3\xdc\x82\xa7\x79\xef\xd1\xd3\x65\xf3\x17\x4b\xa2\x53\x3c\x91\x26\xd0\x74\x75\xbe\xe3\xfd\x26\x1d\xb6\xd0\xa7\xdd\xc8\x9b\xf3\xdd\xa2\x88\xe7\x13\xcf\xc1\x6c\x0b\x67\xc9\xc7\x25\xa8\x2d\x13\xd4\x57\x3d\x25\x9c\xe5\xbf\x36\xe9\xa0\x80\x25\xf6\x99\x90\x82\x1f\x51\xee\x85\xca\xe6\x48\xea\x9c\xe3\xb7\x7e\x71\x2a\xe5\x39\x90\x17\xb6\x32\x9b\x58\xc0\x2f\xef\x69\x2e\x13\xdb\xaa\x27\x28\x5a\x04\x97\xe7\x4b\x1a\xb7\x9c\x10\x8b\x34\x01\xc4\xda\xd3\x89\x5a\x05\x6a\x88\xe5\xeb\x1f\x97\x19\xa5\x13\x50\x74\xd8\x79\x37\xb2\xec\xc8\xcd\x3a\x03\x95\xb6\xfe\x6d\xe4\x86\xd6\x43\x78\x07\xdc\x4b\x54\x43\xd9\xf2\x9f\xd3\xb2\x91\x33\xa2\xbb\x98\x6f\x1b\x63\x9f\x31\x2d\x5c\x2d\xe8\xe5\xb6\x57\x93\x46\x69\x93\x20\xb4\x88\x5f\x13\x29\x23\x11\x50\x7e\x87\x98\x04\xf7\x62\x37\xc3\xc8\x87\x75\xc9\xac\x25\x50\x0d\x38\x78\x1a\xc9\x39\x0d\xbb\xe2\x0b\xfd\xed\x87\xe8\x1a\xa3\x9a\x0c\xb2\xf3\x86\xab\x85\xa9\x05\xf0\x4e\x92\x8b\x4c\x4f\x0d\x61\xbc\x9b\x2a\x2e\xce\x79\xfb\x49\x23\x3b\xf6\x61\x08\xae\x90\x71\xc6\xa6\x64\xd6\x57\xff\xdd\x31\xb5\x4b\x7d\x5c\xaa\xe8\x0d\xb4\xdf\x56\x24\xc1\x50\x02\x79\x59\x48\x64\xcd\xb2\x28\x19\x2e\x87\x00\x1a\x53\x10\x9c\xf9\xcd\xd2\xa2\xe0\xf8\x6f\xae\xa1\x37\x38\x33\x12\xfb\x4f\xe3\x93\xe8\x45\xbf\x24\xb5\xf9\x05\xca\x02\x56\x4c\x82\x03\x14\x8f\x0b\x84\xc2\x68\x64\x9e\xfe\x59\xbc\x5d\xdf\xb7\xcf\x73\x81\x67\xb6\x32\xb1\x40\xec\xfe\xba\x36\x8e\x8f\xff\xc3\x4d\x56\xc6\x9a\x5f\xd9\x77\x29\xe0\x08\x3f\xe9\xdc\x60\x73\x7c\x23\x88\xd5\x35\x55\x86\xc0\xf5\xac\x11\xcd\xf8\x36\x5a\x19\x28\xce\xf8\x85\x91\xd8\xbf\xbd\x96\x39\x5c\x30\x0b\xb4\x92\xd0\x95\x43\x66\xbb\x4e\x2f\x98\xca\xed\x37\x65\x8e\xbf\x4b\x18\x12\x82\xf0\x4d\x99\x55\xed\x01\x69\x20\x53\xf0\xc8\x10\x18\xbd\x16\x3b\x1a\x97\x86\xb4\xad\x8b\x42\xa1\x2e\x5a\x9b\xe1\x6a\x51\xa0\xa3\xb0\xff\xdb\x8a\xa4\xcb\x29\x81\xb2\x47\x6a\x40\xce\xfc\x68\xeb\x77\x3a\x8d\x86\x18\x0c\x37\x2e\xb9\xbe\xbe\x7e\x13\x78\xef\x12\xd8\xfc\x2e\x41\x0f\xc9\x99\x1d\xb2\xe9\xbf\xe3\xcf\x82\xbe\x52\x76\xc6\xf0\x92\x29\x9a\xc0\xa5\xc3\xb6\xaf\xdc\x61\xd2\xa4\xe4\xc6\xaa\xaa\xfb\xe6\xb3\x30\x27\x9d\xd0\xec\x09\xd4\x5a\xff\x37\x86\xb1\x32\xef\xe5\x2b\xf3\x00\x7d\x33\xe3\x98\xec\x4e\x65\x9a\xd7\x30\xe4\x39\x4c\x86\x86\xb3\x2c\x6e\x13\xc0\x7c\x45\xfe\x74\xd9\x70\x35\x3c\x4d\xb0\x44\xf1\x48\x79\xd3\xa8\x8f\x8c\x88\x82\xfe\xd0\xda\xbd\x2e\xd8\xb7\x84\xe1\x86\x19\x86\xb8\x76\x2e\x93\x46\xe8\xc6\x8a\xd4\x27\xdb\xaa\xa0\x29\x97\x17\x9c\xe5\x13\x80\xe6\xfb\x71\x58\xbb\x7d\xc3\x84\x60\x08\xa2\xa0\x07\x8e\x35\x1c\x68\x7a\x9c\xca\x3d\x48\x1a\x18\xf1\xd0\x00\x98\xc9\x75\xc2\x7b\xd5\x2a\x57\x41\x24\x12\x70\x5f\x49\xd4\x23\x3c\x65\xe0\x51\xb7\x32\x20\xbd\xea\xf7\x40\xda\x93\xaa\xfc\xe0\x87\x59\x89\x0d\xea\x5f\xe0\x1c\x1f\xdf\xfb\x3f\x16\xcc\x4e\x8e\x15\xa4\x13\x3a\x78\x74\x9d\x96\x9c\x83\x12\xa7\xd5\xf4\x14\x28\x7f\x11\x26\x0a\x87\xec\xbe\xbc\xbc\x5a\xe4\x34\x33\x8b\x8d\xf7\x5f\x6a\xf4\x5e\x2d\x94\x6e\x23\x5c\x89\x89\x8b\x7f\xfd\x69\x31\xac\xa1\xc3\xa4\xa7\x99\x16\x05\xb5\xff\xab\xbc\xea\x69\x73\x1a\x36\x67\xc1\x66\xcf\x6a\xa8\x68\x0b\x83\xb8\xdc\x86\xc1\x6d\x02\x76\x5e\xaa\x06\x5c\xbf\xed\xfd\x5f\x54\x52\x56\xa6\x58\x1f\x98\xaf\x2b\xe8\xd0\x9a\xd1\x3c\xda\x67\xf8\x68\xe0\x1f\xa2\xec\xf6\xfd\xb8\x15\x49\x36\x2c\x4c\xd9\xc7\x9f\xb1\xd9\xca\x61\x55\x95\xef\x5b\x5c\x2d\x2d\xd2\x28\xd2\xb1\x59\xcd\x04\x0d\xd4\x85\x55\x1b\xb5\xff\xd5\x07\xa7\x66\xa9\x1b\xd1\x4c\x22\x28\x8b\x27\xa4\x7a\x0b\xf9\x86\x0b\xbf\xb3\x0d\x01\xbd\xa4\xd7\x4b\xbb\x33\x7e\xf6\xff\xb8\x11\x22\x3a\x35\xdd\xfc\x78\x31\xc5\x3d\x01\xae\xd6\xc0\xd2\xbc\xc2\xc6\x81\x18\x7e\x8c\x54\x19\xe7\xf8\xf4\xe3\xf1\x94\xd7\x4b\xbb\x67\xb6\x1a\x21\x93\xc1\xd8\xef\x0c\xe1\x79\xda\x81\x2a\x3b\x30\x8f\x94\x47\xf8\x69\x4d\x71\x08\x0c\x59\x54\x2b\x83\x34\xdd\x3e\xf6\xa3\x5c\x38\xbd\xcd\x3e\x51\x16\x3d\xcd\xe0\xa1\xfd\xf5\xc4\x18\x59\x20\x37\x00\x6c\x20\x28\x8f\xf0\x2f\xe6\x13\x53\xb5\x5a\x39\x7b\xe1\x34\x38\x70\xd0\xf8\x56\x63\x84\x90\x70\x08\x5b\x7b\x6e\x31\x6e\x9c\x48\x26\xaa\xe3\x40\x3a\x2a\xdf\x3d\xc1\x1c\x33\x42\x85\x70\x44\xe6\x44\xda\x15\x23\x32\x11\x0c\x90\x03\xa3\x77\x23\x1b\xe2\x3e\x66\x2b\x19\xe5\x46\x08\xcd\x30\x13\xda\x70\x2a\x0b\xb1\x96\x29\xc0\xe8\x67\x11\xc0\x7c\x22\x16\xb8\xe4\xa2\x63\x27\xea\xb1\x02\xe3\xb3\xb7\x06\x63\xa1\x2d\x4a\x08\xee\xb8\xde\x42\x3e\x5c\xa5\x42\x99\x27\xe9\xa4\x2e\x69\x02\x19\x85\xfd\xf1\x34\x4b\xd0\x77\xff\xd5\x5a\x6b\x59\x7e\x3a\x41\x10\xd3\x94\x8c\xe9\xe4\xc7\x69\x29\x89\xec\x26\x59\x62\x35\x20\xcd\xdb\x4d\x3f\x36\x35\x88\x26\x2c\x59\x87\x88\xbc\x05\x6f\xce\x8c\x69\x4a\x96\x69\xbd\xd5\x68\xe5\x58\xaf\xd4\xf5\xac\x3a\x2e\xb2\xd5\xaf\x53\xd6\xc6\xa1\xbf\x19\xaf\xd5\x06\x6e\x32\xfc\xf2\xa9\x57\xb4\x5a\x39\x52\x5b\x23\xb8\xc8\x0e\x29\x07\x46\x33\xf2\x96\xaa\x36\x90\x2d\x70\xbe\x8c\x1e\x55\x4f\x9d\x2b\xa4\x2a\xcb\x89\x46\x61\xa2\x22\x88\x3a\x01\x6a\x4c\xc1\x7d\x82\x22\xcc\xba\xb7\xaa\xc7\xa6\x65\x23\x79\x4f\x7c\xfb\x16\x4a\x48\xa1\x5b\xa4\xf4\x90\x87\xee\x7f\x7a\xfe\xb3\xbe\x1a\x9d\x26\x3d\x47\xc6\x89\x5b\x2e\x05\xf6\x86\xbf\xab\xaa\x42\x8b\x05\x1e\x02\x41\xe5\x05\xd0\xec\x9f\xd1\x7e\xfc\xe5\x30\xe5\xc6\x5b\x6f\x23\xba\xe2\x1c\xa1\x6e\x3f\x96\x61\x96\x41\xe6\x9e\xa0\x3c\xfd\xb3\x7d\x42\x1f\xf0\xe0\x3f\xba\xb0\xaa\xed\xc0\x48\x50\xca\xb3\xdd\x40\xf7\xe8\x20\x79\x50\xe9\x72\x5c\xbc\x36\x91\x92\x31\x36\xd7\x9c\xf6\x5c\x17\x7b\xd3\x90\x85\x13\x80\xc6\x97\xf4\xb3\x18\x51\x98\x0a\x2c\x70\xc9\x79\x1d\x41\x1b\x18\x14\x0e\xd2\x49\xbd\xbf\x33\x9e\xbe\x08\xe3\x82\xcc\x4b\xdc\x4d\x36\x96\x32\x6d\x38\x05\xc2\x11\x39\x8e\xda\x1a\x91\x19\x5f\xfa\x47\x1b\xfe\xa0\xb6\xe7\xc8\xcb\x0b\x9b\xaf\x59\x68\xf8\x85\x39\xa5\xbf\x87\xd7\xdc\x20\x8c\x09\xee\xb1\x62\x8c\x54\x78\xc9\x64\x8d\x56\x4f\x0c\x95\x06\x07\xde\x6e\xbf\xd8\x54\xc4\xc5\x2b\x79\xbd\xe9\x70\x90\x0f\xf5\xd1\x7f\x39\x7e\x91\x64\xfe\x7f\xc4\xb2\x3f\x7c\x5f\xe0\x4e\x4c\xa5\xcb\x38\x11\x7f\x70\x6a\x0e\x64\xee\x91\xfc\x9f\xd6\xf6\xe6\x1e\x7d\x3a\xe2\x21\x10\xec\x54\x47\xf8\xfe\x09\x3d\xe2\x19\x85\x66\x9d\x52\x6b\xe6\xf8\xab\x3d\x9b\xb3\x41\xc8\xf6\xf1\x56\x05\xea\x0a\x3d\x44\x97\xc5\x4f\x04\xbf\x6c\x67\x07\xa6\xc4\xa4\x34\x6c\x52\xa1\x9f\x6c\xea\x35\x81\x5b\xe7\x1e\x1d\xcf\x1d\x1f\x6f\x1e\xef\x60\xf1\x67\xd7\x1d\xd6\x51\x6e\x22\xed\x0f\x77\xa5\xa4\x95\x69\x78\xf5\x1d\x3f\xbc\xac\x35\x3f\x29\x9f\x28\x91\xf7\xfb\x62\x3e\x37\x7e\xef\x8c\x21\xac\x98\x83\x9c\x9f\x7d\x43\xc5\x13\xc6\x58\xed\x9e\xe9\xf5\x07\xdd\x75\x65\xf4\x90\x3a\xa1\x9d\x79\x89\x43\xd6\xac\xfa\x66\xc0\xaa\x2d\x52\xe0\xc0\xd8\x6c\x55\x44\x4d\xcb\xe4\x30\xde\xd8\xab\x29\xe6\x40\x97\x72\x62\xa6\xc8\x31\x58\xeb\xe8\xd7\x1a\x41\x36\xbf\xfd\xf4\x2e\x33\xbc\x6e\xed\xb1\x08\x43\x06\xb9\x9e\x9f\x2c\xe6\x46\x9b\xad\x2f\x45\xbf\xda\x59\x3f\xa2\x66\xb3\x61\xb9\xec\x98\xbe\x27\x54\xe4\xe8\xcc\x49\xb5\x12\xb9\xd1\xd5\xf2\x61\x57\x98\x82\x5c\xc5\x20\x5a\x67\x7a\x84\x12\x1f\xef\x93\xbb\xfb\x62\x95\x7f\x36\xe3\x1e\x6c\x27\x9a\xf5\xc2\xa7\x8f\x1b\x95\x0b\x17\x5c\x69\x2a\x93\xbe\x9c\xd1\x6b\xfb\x7c\x82\xf8\x84\x13\x6a\x35\xfc\xd3\x7c\x0b\xb2\x70\x60\x4d\x54\x6a\x30\x4f\xd2\xa1\x18\x58\xd7\x7b\xaa\x52\xd8\xb1\x09\x6e\x33\xda\x51\xdd\xdc\x9a\x23\x7b\x6a\x8a\xb0\x03\x75\x12\x07\x86\x65\xfb\xe7\x04\xda\xc9\x12\xe5\x10\x98\x83\x0d\x4b\xf3\xf1\x30\xf3\x37\x0a\x94\x26\xc1\x72\x75\xc8\x3f\x62\xdf\x1f\x62\xb1\xc4\x6a\xb8\x3f\x5c\xc2\xfc\x6e\x1e\x1f\xbc\xea\x57\xd3\x36\xde\x36\xae\xd9\x68\x34\x85\xfe\xd8\x6c\xb4\x23\xad\xc3\x2c\x77\xfd\xcd\x18\xaa\x45\xff\x34\x38\x8d\x5e\x10\xf1\x7c\xaa\x95\x83\x5f\xb5\x21\x4e\x54\xc8\x87\x60\xef\x98\x82\x07\x2b\x55\xb6\xca\xdd\x4d\xe6\xe7\x0e\xd5\x31\x16\x33\xb2\xd6\x17\x7b\x67\xda\xf5\x5e\x0d\x16\x34\x9b\x28\x3b\xa0\x4d\xb7\xb5\x5c\xc1\xcd\xaa\x27\x1b\x1c\x93\x36\x96\x29\x67\xfd\x1a\xff\x98\x9a\x66\x22\xf2\x91\x3c\xbd\x56\x1f\x9c\x5b\xad\xec\x48\x9a\xf4\x33\xfe\x32\xca\xbc\xf6\xd8\xb5\x9f\x65\x4c\x19\x59\xae\x2d\x4b\x6a\x74\xbb\xb0\x90\x9d\xf4\xc8\x58\x47\xa5\x1e\xea\x8d\xfa\xf3\xf8\x06\xa0\x8c\x64\xd5\xdb\xe1\xcb\xfc\x44\x87\x3c\xef\x24\x97\xc5\xdc\xfd\x35\xfe\xa3\x09\x39\x76\x31\x5c\x16\x00\xc3\x6e\x8d\x73\x7a\x3d\x6d\x74\x02\xe9\x84\x95\x12\x26\x92\x75\x70\xa0\xbd\x62\x3a\x20\xde\x2d\xae\x27\xcc\x3f\xb7\xaa\x55\xf6\xf2\xd5\x9a\xa0\x64\x62\x9e\xf7\xca\xf7\x1e\x58\x4e\xfc\x00\x38\x43\x3f\x97\x6f\x01\x8e\x0d\x5b\xea\x46\x4f\xda\x26\x2d\x9c\xc2\x23\x39\x55\xbd\xc1\x07\x5b\x66\x8d\x5f\xb7\x43\xf5\x8d\xa4\x68\xbb\x6f\xba\x50\x39\x71\xc7\x26\x88\x83\x6a\xbe\x73\x8e\x19\xfa\xef\x2c\x78\x6e\xb9\x2f\xe5\x63\x70\xea\xce\xe4\xb5\x7a\x58\x0e\x0d\x0e\x68\x47\x58\x3d\x38\x4e\x0a\x75\x5c\x87\xd3\x57\x29\x5c\xf7\x48\x7f\xcf\xa7\x16\x91\x50\x36\x3c\x26\xdf\x7c\xc1\xa1\x0b\x9a\x74\x6f\xbd\xbb\x7a\x01\x25\xbf\xee\xe2\x81\xde\x8e\xb8\xc5\x7a\x5b\xcb\x39\xf0\xd3\xc9\xae\x80\xaa\xb4\x2e\x7b\xec\x79\xfd\x82\x6a\x51\x1c\xec\xb6\xae\x0a\xb3\xda\xb0\xae\x95\x20\x01\x7e\x1b\xe7\x08\xc4\x6a\xb8\x27\x2f\x92\xdc\x7a\xea\x20\x88\x40\xe3\x80\xa5\xb7\x68\x96\x47\x69\x52\x45\xc4\x1a\xa0\x14\xe2\x95\xd1\x0c\xbf\xa6\xa5\xf1\x7e\x5c\x98\x14\x16\xf6\x4a\x73\x26\xa3\x7e\x68\xa9\x7c\x46\x45\xb1\x7e\x53\x1b\xbf\x9c\x52\x5f\x3f\xb8\x83\x3c\x64\x6e\x7e\x7a\xd2\xff\x75\x1b\x91\x7a\xa5\xcc\x01\x11\x29\x39\xdd\x03\x8a\x2f\xd6\x9e\xd5\xbc\x32\xce\x91\x2a\x4c\x77\x9a\x20\xe1\x9f\xe6\x97\xc7\x1c\x1b\x1a\x85\x2f\x17\x1d\xe2\x89\xd5\x35\xd9\xa9\xb8\xba\xc3\x59\xe2\xe1\xde\x71\x41\x1e\xec\x08\x9c\x56\x5e\xf5\xf4\x53\xb5\x72\x81\x7a\xa3\x94\xfe\x38\xb4\xe2\x47\x65\x23\xba\x5a\x65\xdf\x06\xdc\x2c\xe9\xc3\xab\xf1\x1f\x99\x42\xeb\x36\x64\x1f\xe4\x83\x1d\xb6\x67\x9c\x58\x35\xe0\x80\xa8\xd0\x7f\x57\xcd\x22\xe7\xab\x74\xf9\x47\xd6\xaa\xb6\x30\x04\x4b\x9a\xc0\x91\x6c\x0f\x79\xe7\xd2\xc4\x99\xac\xe8\x3a\x72\xcd\xa6\xbf\x0a\xd7\x21\x86\x4d\xe0\x50\xe5\x82\x1e\x69\x63\xf3\xf8\x48\x00\x52\x03\x03\xc4\x62\xa2\xdf\x0a\x7f\xe2\xfb\xea\xe3\xea\x3c\x9a\x58\xed\x20\xfc\x7b\x27\x96\x5c\xd4\x1c\xfb\x6a\x5a\xea\x25\x06\x9e\x9d\xc7\x4c\x03\xf4\x0c\x02\x1e\x5c\xa6\x10\x47\x0c\x6d\xe2\x31\x8e\xe7\xb0\xb2\xc1\x06\x47\xd2\xe0\xb0\xca\x7f\x7c\x90\xd7\x7b\x2f\x06\xea\x9e\x07\x27\x3c\xfd\xd7\x2e\x9a\x30\x68\xe4\x5f\x39\xb2\xa1\xa0\x94\xdf\x58\xa6\x69\xa9\xe6\x6b\xf7\x05\xf7\x28\x1b\xd9\xad\x7d\xad\xfa\x32\xb2\x0a\xf5\x7b\xf4\xee\x6b\x77\xe4\x4b\x14\x0f\xde\x7d\xeb\xb6\xfc\x18\xa7\x4b\x79\xe0\xf2\x9b\xe0\xda\x78\xd9\xe1\x13\x72\x21\xd5\xa4\x27\x61\x8f\x41\x18\x7a\xd6\xf1\xd3\x21\x2c\x83\x8a\xf5\xc9\x65\xd6\xf8\x33\x4e\xf6\x7f\x5e\x09\x18\xbd\xfe\x40\xe5\x74\xbd\x0d\x5b\x03\xa7\xf1\x7e\x1c\x96\xb9\x0b\x85\x17\x53\x02\x8f\x30\x54\xbb\x55\x5f\xba\xc4\xe7\xc1\x7c\xf5\xd2\x0e\x09\xcb\xbd\x2d\xd5\x2f\xc4\xb0\x1d\x88\x23\x15\x94\x8c\xca\x0e\xf3\x01\x26\xb6\xbe\x7e\x8b\xe3\xda\x74\x73\x16\x85\x70\x2e\x17\x39\x2f\xcb\xd9\x03\xac\x7d\x8c\x96\xd1\x60\xb0\x74\xab\x02\x0e\x6b\xe4\x7a\x1c\x2f\xd9\x4e\xe6\x3b\x87\x61\x6c\x06\x80\x1f\x16\x03\x0b\x14\x48\x62\xd4\x1c\x7f\xa1\x6c\x8d\xc3\x72\x18\x06\xb3\x37\x30\x56\x89\x99\xf1\xa1\x8b\x23\x3b\x97\xb4\xd1\x6f\x5d\x52\xae\x03\x2e\x04\x0f\x73\xa9\x9c\xb8\x83\xac\x4a\x6d\xf2\xcd\x0d\xfc\xf9\xfe\xc5\xc8\x8f\x56\x64\x03\x15\x81\x74\xa8\xfe\xa5\x07\x66\x7a\xfd\xb2\x74\xa8\xbe\x89\x6b\x4a\x66\x81\x80\x57\x43\x6f\xc7\xbd\xf9\x05\xf6\x15\x9c\xc5\x1a\x5e\x54\xfd\xb1\x82\x19\x0f\x67\x86\xcd\x60\x16\x24\x8b\xd9\x23\x9a\x3b\xce\x03\x9e\xed\xc4\xfa\x72\xf1\x0e\x59\x23\xd1\xed\xe6\xc7\x27\x6a\x50\x4e\x6e\x6c\xe0\x45\x36\xf9\x35\x44\xab\x85\x00\x06\xf1\x95\x71\xb0\xee\x85\xc1\x7a\xfd\xca\x06\x87\xa8\xd2\x7a\xc7\xed\xda\x90\x46\xf0\x9d\xc6\xb5\x58\x0c\x6c\x53\xd6\x6c\xbc\x56\xd6\x38\xa2\x69\x32\x1b\x4c\xaa\xca\x43\xc2\x00\x5d\x71\x65\x8b\xed\x72\x00\x8d\x95\x32\x43\x09\x3e\xaf\x5f\x10\xc7\xc3\x5b\x01\x63\xc2\x6c\xc6\x45\x0c\x70\xc9\x49\x57\x64\xb2\xa1\x3e\xd0\x34\xd0\xf5\xdb\x67\xba\x43\x53\xe1\xa5\x96\x63\x49\x22\xe4\xbc\x32\x04\xd6\x74\x8f\xf2\xc2\x00\x2c\xb2\x25\xdb\x30\x44\x3d\xde\x6e\x62\x0f\x81\x60\x7e\x3d\xc6\x27\x5b\x05\x0d\x17\x58\x3c\xcf\x26\x5f\xbb\x88\xbc\x04\xae\x1c\x31\x78\x9b\x7d\x4a\x32\x14\x02\x1c\xeb\x5e\x7f\xa9\x0f\x70\xd6\x79\x9b\xca\xad\xa1\xde\x3c\xf1\x06\x84\xb6\x5c\x41\x5c\x58\xf6\x59\x13\x5d\xbe\x06\xa1\x28\xf4\x09\xe5\x72\xb7\xe8\xf7\xee\x6f\x5c\x27\xa0\xa5\xca\xaf\x3d\x64\xdf\xa9\x21\xf4\xb0\xbc\xe4\x0e\x4d\xc0\x62\xda\xc1\x6b\xb8\x7e\xcb\x34\xed\xc3\xdd\x45\x0b\x44\x1c\x0a\xbe\x48\x3d\x36\x0c\x99\xe1\xd7\xa2\xde\x91\xcc\xdf\xe6\x43\x5e\xb0\x81\xbb\x59\x81\xad\x30\x7a\x1b\xeb\xc4\x70\x00\xb2\x62\x16\x58\xd9\xc6\xe6\x54\x64\x31\x50\x8a\x46\xd8\x92\xe3\x97\xe1\x96\x55\x50\x94\xb2\x37\xea\x1b\x71\xc2\x7c\x60\x69\xbd\xe4\x31\xb6\x78\x11\x92\x95\x27\xbd\x6b\xde\x07\xd9\xb1\xbd\xde\x39\x0e\xb7\xb8\x6f\xd3\x0a\xda\x41\x2d\xe1\xc0\xdb\xad\xfa\xc8\xc4\x0d\xe9\xf9\x52\xa2\x2e\x40\x47\xc1\xb2\x19\xd4\x38\xad\xd7\x33\xf3\x69\xcc\xca\x76\x66\x21\x90\xe3\xa5\xb2\xc4\xd3\xb4\x93\x9c\x57\x43\x6c\x0f\xa5\x95\x8d\x98\xe4\xaf\x20\xa0\x1b\x55\x13\x88\x9c\x82\x64\x75\x60\x5c\xc6\x91\xd6\x40\x37\xdc\xef\x03\xf0\x6c\x66\x3e\xcd\x00\xa0\x9b\xd3\xac\x0f\xbd\x2c\x0b\x85\x9f\x45\xde\x7d\x34\xec\xda\x98\xf3\xe5\x90\x9e\x1d\x53\x0d\xd0\x59\x1c\xdc\xe4\xd6\x52\x33\x9f\x7a\x94\x3d\xaf\xcd\x3c\xb5\xf6\xf8\xb0\x34\x2b\x40\x3c\xef\xe7\xa2\x8c\xb8\xfd\x50\x7a\x37\xa0\x28\x0c\x79\x7d\xe5\xe3\xc6\x49\x35\xdc\xd8\x54\x8d\x2c\x00\x05\xdc\x65\xab\x61\x6f\xfa\xa2\xe0\xb3\x80\xf3\xba\x82\xf0\xed\x9d\x2a\xc7\x1b\x73\xf3\xd2\x66\xe3\xbe\x9c\x48\xbd\x88\x01\x76\xdc\xc1\x6c\xe8\x28\xfb\x39\x10\x63\xf5\xc6\xa3\x2e\x93\x35\x72\xaf\xae\xde\xb0\x94\x70\xfb\x8a\xf7\x37\xa8\xa6\x87\x0b\x8f\xec\x54\xbe\x60\x6d\xae\x21\x70\xd3\xd7\x92\x4f\x9e\xa6\x4e\x86\xf8\x56\xf4\x0e\x57\x7e\x37\x8f\xb3\xfc\x6c\x93\xbc\xf6\x0b\x91\x2b\x10\x7e\x2f\x5a\xd0\x4e\xf2\x0f\x98\x56\xed\x8a\x59\x5e\x75\xe2\x35\xa6\xb4\xfe\xa7\xa0\x75\x05\xac\x59\xe3\x2f\xf2\x2f\x03\xfc\xff\xc5\xdd\x3d\xe1\xff\xfb\x04\x69\x50\x34\x86\x58\xab\x2a\x42\xb3\x74\x66\xd5\x80\x4b\xe7\x0e\x0c\xdc\xcc\x24\x78\xe4\xe8\x26\x9e\x17\x46\x8c\xc3\x75\x23\x7e\xf0\x5b\xdf\xea\x89\xc9\x14\x35\x4e\x6e\x64\x0a\xf2\x90\x2f\x0d\x81\xa6\xd2\x8f\xe7\x76\x29\x90\xf6\xe3\x27\xb7\x71\xb9\x70\x3a\xe4\x97\x4d\x8b\x34\xb7\x5d\x00\xd3\x94\xdc\x02\x06\xc5\xa8\xf3\x24\x14\xe8\x27\x4d\x60\xf4\xb7\xc8\x5e\xc3\x2f\x77\x7f\xde\xb7\x78\x9a\xa6\x9f\x84\x8a\x1e\x82\xfe\x51\xdb\x3b\xae\xde\x26\x80\x06\xfc\xe4\x4e\xf3\x56\x0e\x8c\x1c\x0c\x07\x70\x8e\xf1\x37\xd8\x6d\x7c\x7c\xba\xbb\x7c\x70\xa3\x0a\x3d\x1a\xaa\xf2\x4f\x4b\x77\x83\x18\xe1\xea\x38\xf3\x35\xf1\xf1\x1d\x1b\xaf\xea\xa9\x03\xa2\x36\xce\x5e\x32\x6d\xe8\x2a\x48\xe2\xab\x2f\x2b\x03\x07\x8f\xf5\x09\x4b\x42\xff\x9c\x7d\x7e\x3f\x52\x38\xc1\xa9\xed\xfc\x5f\x0e\x7c\xc4\xcb\xe4\xc6\x3e\xa4\xaf\x96\x37\x12\x4f\x27\x3a\xf9\x53\x2b\x2f\x80\x6d\xff\x68\x94\x99\x9d\x72\xce\x85\xae\xb8\xa7\x44\xac\x89\xe5\x96\x9c\x5f\xbf\x55\xd0\xd7\xa4\xe0\xa1\xbf\x62\x74\xbf\xc3\x00\x40\x09\x33\xa7\xb1\x23\xc1\xe5\xc7\x48\x72\x05\xc3\xd8\x69\xdd\xbb\x6c\x16\x14\x1f\xfa\x81\xc9\x12\x53\x7a\xd7\xfc\xb3\x3e\xdb\x6f\x35\xc8\xf8\xcb\x63\x7f\x9e\xa9\x42\xe2\xb1\xec\x93\xd0\xc0\x43\xcc\x30\x09\xa5\x4f\xfb\x9f\xdf\x15\x6d\x49\xa0\xc7\x42\xb2\x7e\x66\xc8\xfc\x43\xc9\xde\xfb\xcf\xa2\xc3\x2e\xa4\x82\x4c\xc1\x7d\xc6\xc5\x48\x07\x0c\x43\xa4\x2a\x81\x00\x7a\xd9\x37\xc0\x99\xd9\x67\x97\x21\x59\xef\xed\x2d\x7d\xfa\x51\xf9\xd5\xff\x57\x6f\x50\x4c\x7a\x60\x1b\xb0\xc3\x56\xba\x11\xcd\xfc\xec\x3f\x9b\x8b\xc3\xfe\x14\x53\x7a\x36\xfe\xd3\xdd\x71\x5f\x20\xb2\x02\x3a\xde\xb9\x34\x91\x47\x44\xe6\xe9\x2b\x3e\x4d\x48\xe6\x1a\xe7\x13\xf4\x42\xe1\xca\x3f\x63\x78\xc9\x1d\x1c\xcb\x1a\x23\x32\x07\xbc\x2a\x05\xfe\xe7\x28\xe9\x6d\xf8\x30\x23\xfd\xcb\x35\xa1\x4b\xdc\xff\x9c\x27\xcd\xfa\x47\x88\x7f\x8d\xdf\x18\x6e\xf5\xe0\x3d\x3d\x44\x17\x0b\x4e\xd8\xca\x84\xed\x4b\xde\x90\x2e\xb8\x69\x3b\x10\x1d\xf5\xbf\x43\xed\x0f\xc8\x84\x3d\x84\xf1\xf0\x7d\xb7\x56\xb6\xfb\xc5\x13\x35\x45\x0f\xf6\x9a\x29\xb1\x4c\xd3\xb8\xb1\x58\x28\xc5\xa4\x67\x76\x0b\x96\x97\xcd\xf8\x75\xf5\xc0\xfc\xb0\x11\xc7\x21\xc9\x8d\x31\x02\xa9\x66\xdb\x7b\x24\x54\x73\x47\x11\xd7\xf4\x9f\x5d\xe4\xcd\x2e\x28\xb7\x4a\xfc\xf6\xd9\xee\xef\xa7\x24\xb5\xa8\x2b\xff\x0c\x65\xae\x7b\x71\x3a\xaa\xe6\x64\x9f\xb0\x7d\xd6\xcf\xe5\x48\x70\x36\xb8\x7d\x56\x59\x81\x82\x71\x9e\x18\xaa\xe8\x3a\x8d\x6d\x08\x0c\x65\xdf\x00\x63\xb1\x50\x9b\x2d\xa1\x5b\xe4\x5f\x45\xc6\x66\x51\x4a\xd0\x4f\x90\x13\xd6\x58\x33\x49\x41\x84\x8c\x8a\x27\xb4\x22\x11\x98\x0a\xc9\x12\x31\x99\x2a\x72\xb3\x91\xfd\xc1\x5e\xd2\x04\xe6\xa7\xe9\xbb\x4f\x8e\x3f\x1a\x28\xe4\xd2\x5c\x77\x00\xb9\x4c\x79\x8a\xc8\x4c\x82\xee\xb2\x22\x8f\xa8\xd5\xb2\x08\xee\xc5\x97\xed\x09\xd0\x7d\x09\x1f\xc8\xf3\x89\xc8\x3f\x80\x26\xca\x58\x8d\xdd\x7c\x2d\x4b\xf3\x9d\x80\xab\xb3\xb2\x60\x8b\xb0\x7a\xf0\xde\xba\xa5\x25\xbd\x33\x7e\xfd\x62\xe8\x16\xf9\x77\x37\x1f\x6b\x37\xc5\xf1\x59\x24\xcd\x7e\x1b\x59\xd1\x23\xe5\xe8\x59\x38\x12\x33\x70\x10\x1b\x29\x09\xce\xe3\x07\x45\x63\x49\xe0\x5d\xdf\xe3\xe5\xe9\xe3\xf9\x31\x32\xad\x14\x43\xec\x67\x91\x58\x0d\x10\xcc\x76\x67\xf4\x16\x6f\x91\x75\x87\x36\xf5\x77\x46\x09\x20\x22\x7e\x7b\x14\xcc\x32\x97\x49\x7d\xf1\x7d\x61\x15\x31\x66\x36\xa6\xed\xc1\xd6\x54\x0c\x51\xe4\xb8\x80\x06\xaf\xb3\x14\x2d\xad\x3a\x12\x9c\xe7\x1e\x4a\x11\x53\x2a\x33\x2c\x78\xac\x21\xe3\xa9\x9d\xd8\xc8\xd4\xe0\xcd\xc2\xb8\xdb\xc3\xf1\x05\x37\x48\x86\xde\xfb\x07\x22\x62\x34\xec\x7e\xfd\x01\x26\xe4\xe6\xc0\x55\x18\x2d\xc8\x04\x92\x0c\x02\x3c\x0e\x54\x7b\x1b\x79\x7c\x37\xed\x67\x72\x84\x13\x22\x48\xf8\x50\x02\x20\x9e\xf7\x7c\x5b\x36\x73\x90\xf9\x5a\xb3\x6e\x0a\x68\xbb\xa8\xb6\x4d\x90\x62\x6f\x98\xa2\xe6\x4c\x9e\x3c\xed\x4b\x2a\x7b\x77\xd8\xa3\xe5\x64\x4f\xcb\xb9\xe1\x59\x9b\x95\x16\xd3\x1a\x82\xe4\x00\x0e\xdb\x5d\xad\xd5\x7a\xea\xbc\x04\x56\x6b\x25\x66\x4f\xd6\xe8\xff\x16\xc0\xb9\xfa\xa2\xe7\x5b\x67\x7d\xf9\x10\x45\xb9\xad\xf1\xc2\x0b\xec\xb0\x91\x97\x3c\x63\xfe\x84\xe6\x92\xe5\x56\x5e\x80\x0f\x2b\xaa\xef\xd5\x6b\x38\xfe\xa2\x1a\x71\xa7\x5b\x2e\x05\x3b\xcf\x11\x4f\x88\x84\xfe\x06\x44\x2c\x80\xf3\xa6\x41\xfa\x2f\x3e\x8a\x30\x6d\x8a\xd7\x88\x8e\x58\xa0\x75\x12\x66\x8c\x26\xaa\x35\x0b\x13\x6a\x02\x59\x15\x61\x87\x96\x04\xd1\xba\x6b\x3f\xf0\xf1\x9e\x09\x70\xb8\x4d\x03\xff\x78\x8d\x2f\x0b\x87\x69\x79\xa6\x18\xf9\x71\xf1\xaf\x85\x79\xc6\x24\x13\x57\x54\x2f\x33\x55\xaf\x7c\x3e\x64\x80\x52\x60\x67\x1d\xbd\x19\xe8\x8d\x0b\x87\x93\xb0\x35\xd1\x5a\x48\xcb\x77\xc6\xfe\x0c\xd1\xc0\x42\x02\xe8\xc7\x8d\x95\x2a\x03\xdf\x79\x37\x07\xf5\xe4\xad\x69\x7c\x7f\x12\x85\x89\x89\x58\x58\x9a\xcd\x33\x8f\x8e\x37\x2c\xe4\xb1\x29\x0e\x1e\xfb\x9f\x56\x67\xf7\x6c\x23\xcf\x1f\x2c\xc6\x20\x39\xe9\x7a\xcb\x7f\x86\xf3\xe6\xbe\x1f\x2d\x1a\x7f\xca\x98\xaf\x9e\xd7\xcd\xca\x28\x94\x36\x68\x4d\xab\x6c\x38\xaf\x75\x0e\x76\x41\x5c\x5b\x5c\x71\x5a\x4a\x37\xad\xfb\x35\x2c\xac\x51\x42\xf1\x6d\x09\xcd\x19\xea\x7e\x4c\x63\xbd\x9c\x7f\x79\x3c\x0e\x9c\x60\x4d\x50\xda\xba\xf8\x17\x0d\x32\xb1\xdf\x07\x55\x60\x01\xc4\xf5\x63\xef\xf0\x37\x82\xa0\xa8\x1e\xb9\x47\xa7\x8c\xd5\x3b\x5a\x12\x9a\x36\x77\x31\x37\x3c\x94\xae\xe9\x9b\x57\x18\x60\xfb\xb3\x77\xc3\xdc\xef\xac\x32\x70\x59\x58\x12\x0a\x8f\xb1\xd5\x59\xc4\x64\xed\xae\x9c\x96\xde\xae\x5b\x13\xeb\xc4\x9d\x14\x47\x97\x2a\x1f\x28\xd4\x78\x12\xcb\xf3\xce\x65\xf6\xa6\xfa\xd9\xc4\x97\x66\xe4\x19\x08\x35\xb7\x23\x5d\x03\x43\x6d\xfc\x26\x44\xec\x00\x5f\x7d\xac\x88\x14\x24\xb6\x65\x82\x0f\x5b\xc6\x19\x77\xd3\xd8\x86\x80\x97\x03\xf4\x5f\x09\x31\x29\x01\xb5\xcc\x76\x2b\x59\xfc\x49\x17\x8f\xfd\x41\xbe\xca\xc0\x49\xca\xf1\x1a\xcd\x32\x5b\x59\x6d\xec\x3a\xa6\xc8\xcd\xd4\x99\x9a\x60\xd5\xc6\x08\x59\xde\x5f\x82\x3e\x2d\x48\xd3\xef\x28\x5a\x93\x9a\x24\x72\xbb\x60\xb8\x98\xe7\xd6\xa3\x1f\x6c\xd3\xbf\xdc\x40\xcb\x6b\xac\xd3\xb8\x64\x81\x42\x3c\x0c\xe9\x87\x97\xab\x2d\xf9\xd6\xc6\x39\x25\x4c\x89\x2c\x33\x5b\xc8\x66\x9a\x34\x38\x50\x70\x55\x1f\xe8\x6b\x9c\x77\x64\x48\xb3\xb6\x96\xe1\xbd\x99\x5d\x42\xa2\x2e\x30\x95\x41\x1e\x56\x8b\xd3\x97\xeb\x55\xa6\xbd\x7c\x84\x5c\xf7\x56\x5b\xea\x2b\xf2\xd1\xdf\x06\x93\x3c\x68\x4f\xd4\xfa\x83\xd7\x6d\x04\x93\xf8\xd7\x80\x3e\xfb\x06\x3c\xb2\xe6\x02\x34\xaf\x1f\xf2\x1c\x84\x54\xa3\x1c\xbc\x59\x6f\x49\x3e\xc1\x30\x1c\x9a\x55\x56\xb5\xb3\x4a\x4a\xaf\x83\x64\xe5\x01\x1f\x8c\xc9\x93\x5c\xa1\xf5\xe7\x09\xb1\x1a\xb0\x6d\x0a\xe2\x75\x61\xb2\x7d\x44\x9a\xb5\xb9\x39\x40\x0d\x12\xa7\x8c\x2b\x03\x4b\x8b\x8c\x4b\xcf\x6a\xa2\xc3\x2e\xfe\x11\x7f\x23\x04\x7e\xa0\x2d\x8a\x73\x95\x1e\x83\x58\xfe\x95\xb1\x79\xf0\x25\x6a\x3f\x3b\x14\x1b\xc1\x32\x5d\x92\xa0\x59\xa5\x67\x38\x49\x03\xf5\x46\xa5\x1e\x97\x2e\x24\x16\x76\xc2\x43\xe2\x1e\xcc\x51\x5f\xcc\x08\x59\xf7\x91\xfc\x04\x30\xf7\x13\x53\xec\x19\x81\x66\x41\x80\x03\xdb\xf2\xe8\x5f\xf4\xbc\x8a\x88\x21\x9f\xaa\x20\x6b\x1a\xfe\x4d\x5e\xfa\xe3\xd2\x2d\xc0\x81\x36\x82\xa4\x52\x0d\xc6\x36\xa3\x0f\xea\xc9\x53\xb9\x6f\xdf\xd2\xa9\x56\x22\x64\x44\x54\x4b\x2a\xf7\x60\xfd\x73\x5f\xfd\x37\x8a\x62\xc3\xc3\x8d\x31\xbf\x9f\x6d\xb7\xc1\x66\x53\xa6\xc3\xf7\x05\x32\x3d\xcd\x35\xdb\x6d\x56\x1a\xd0\xb7\x2c\x86\x5e\x36\x04\x70\x30\xef\x85\x20\xce\xec\x5f\x35\xf5\xf5\x6f\xfc\x2f\x68\x65\x8d\x03\x3b\x2c\x81\x13\xf7\xe0\x96\x6b\x3f\xbc\x1a\x47\x5a\x3e\x3b\x1f\x0d\x32\xe6\xe7\xdf\xd3\x60\xb0\xb6\x8c\x5f\x18\xb5\x56\xaf\x3c\x64\x24\x42\x8c\x5f\xa1\xf2\x50\xec\x2e\x1b\xb2\x3d\xc1\x6e\x52\x90\x00\x3a\x9e\xc3\x4a\xf7\x03\x4a\xb8\xc3\x53\x5b\x77\x6c\x00\xcb\xe7\xe6\x60\x47\x4e\x5b\x3d\x08\x85\x09\xbf\x2d\xcd\x48\x0e\xc4\x34\x1a\xba\x06\x2e\x07\xf3\xdd\x4c\x59\x7d\xcb\xf1\x29\xf5\xf5\x5b\xb0\x98\xbd\xb7\xe0\xe4\xfb\x1b\x87\x21\x17\xa2\x65\xf8\xfb\xf0\x3e\x48\xc5\x07\x0f\x0c\x0f\x9f\x03\xbf\xb6\x4c\x83\x2b\x1b\x01\x3b\x7e\xea\xd1\xb8\x74\xe1\x01\x82\x41\x6d\x54\x5f\x0f\xb4\x22\xef\xc9\x97\x28\x14\x6f\xcc\xb4\x51\x4e\xa5\xe6\x40\x28\xb6\xbe\xde\xff\xe8\xb2\x56\x2b\xc7\x0e\xbb\x76\x56\x19\xb8\xd4\x6e\x01\xe9\xaa\x0a\xa8\x56\x0e\x38\xa5\xb6\xe7\xda\xb2\xc8\xed\x83\x81\x92\x88\xcd\x23\x0f\x8c\x04\x31\xa1\x97\xb5\x3e\x59\x25\x9f\x6f\x21\x80\x24\x7e\x5a\x93\x3d\x00\xd0\x42\xaa\x19\x1a\xd1\xde\xaa\x05\x7f\x41\xb4\x44\xd2\x49\xcd\xcf\xf3\xde\x46\x79\x0c\x8a\x12\xde\x0a\x28\xb3\x5d\xf6\x15\xb9\xb5\x19\x28\x89\x1a\x59\x3a\x11\x15\x72\x6f\x01\x04\x78\x7b\xf7\xa1\x6a\xf6\xd6\x67\xea\x4d\x54\x68\xf1\x91\x38\xe0\x48\x2e\xc8\x33\x01\x56\x44\x5b\xb2\x2d\xf6\x82\xd6\x89\x6e\x11\xf2\x5e\x20\xc9\x09\xc3\xc3\x3f\x82\xab\x30\x68\x70\xe0\x6d\x68\x98\x52\x04\x24\xab\xc8\xab\xa8\x13\xa7\xde\x76\xc1\x5a\x52\xfd\x52\x6d\xfc\x72\x4e\x94\xec\xe5\x3a\x51\x8f\x68\x22\xb9\xf4\xe4\x82\xf7\xf2\x95\x80\xf1\xd2\x59\x1e\x9a\x97\x4d\xee\x05\x8d\x85\x24\x19\xa4\xe9\x8d\xaf\x6a\xc1\x4c\x72\x51\x56\xcd\x5b\x92\x2d\xec\x54\xb8\xf7\xe8\x0c\xc9\x6f\x1d\xcf\x13\xcf\x9b\xfe\x3d\x3e\x7a\x34\xf8\x90\x45\xa4\xa1\xb3\x09\x7d\xd1\xbf\x21\x9b\x00\x16\xb1\x04\x18\xa9\x32\x0e\xf6\x9f\x73\xaf\xe7\xb8\x2e\x53\xd5\xca\xe1\xea\x3f\x65\x10\xae\x64\x1f\xc6\xf0\x88\x1f\x0c\xff\xe0\x6d\x43\xb8\x48\x70\x5f\x11\x6f\xf4\xce\x5c\xef\x07\x96\x64\x4a\xa9\x40\xfd\x9a\xf6\xbf\xca\xab\x9e\x6e\xcd\x71\xb8\x4d\x00\xcb\x79\x6c\x82\x79\x84\x61\xd6\x57\xa4\x1c\xaa\x34\x0c\x2f\x53\xc7\x75\x44\x4e\x4f\x78\xc6\xa9\x6e\x75\x62\x9a\x62\x7d\x31\xc3\xb5\xa5\x83\x6a\x36\x54\xa5\x7f\x73\xe7\x50\xf7\x7e\xb0\x74\x0e\x64\xee\x39\x69\x14\x62\xb2\x5b\x70\x83\x00\x32\xa3\x2a\xf3\xe6\x39\x3f\xd4\x1a\x1e\x9f\xc8\x21\x18\x2b\xf2\x27\x54\xba\x32\x37\x26\x20\xf1\xa1\x1d\x8e\x4f\x3d\x31\x0c\xd1\x91\x3e\x4c\x16\xfa\x17\xf1\xfa\x3d\xa2\x36\x4f\x0c\x59\x04\x69\x2a\xf2\xad\x4a\x2d\xfa\x91\xcc\x01\x9f\xb4\x1d\x4d\x6c\xfb\xf7\x75\xb5\xff\x86\xfa\xfa\x6e\xcb\xad\xea\x33\x0c\xea\x63\x4f\xa6\x29\x96\x41\x85\x20\xe0\x6f\x65\x90\x82\x3d\xa5\x37\x86\x31\x11\x5f\x38\xf4\xe6\x6e\x80\x69\x2a\x2f\x23\xde\x7b\x44\x36\xe3\xe8\x23\x78\xf8\x15\x05\x45\x2f\xf9\x8b\x40\x9b\xde\x29\x93\x70\x7b\xda\xc6\x2e\xa2\xe1\x34\x09\x02\xc3\x4b\xee\xe4\x34\x2a\x3b\x63\x18\x8a\x34\x27\x55\xc6\x5d\xac\xbe\x5d\x83\xc5\xf2\xc0\xb3\x29\xaf\x97\x76\x9f\xdc\xe4\xba\x63\x1d\x53\xb1\xf0\x1b\x81\xe1\x98\x82\x3c\x86\x64\x49\xb1\xe6\x79\x62\x7a\xab\x51\x1b\x10\x09\xfa\xd3\x19\x2d\x2d\x9e\xa6\x6d\x5b\x3f\x7e\xb9\xd9\xc1\xb1\xc1\xae\x8d\x05\xda\xbe\x2a\x9e\xdb\x36\x60\xcb\xb8\xf8\x1b\xc8\xea\x16\x4f\xd3\xcb\xec\x66\x0e\x1e\xf3\xf3\x4d\xa7\xaf\x27\x40\x28\x86\x4a\xfa\x88\x7f\x4b\x95\x45\xeb\x18\xfd\xe9\x8c\x73\xd1\xbd\x3d\xff\x3e\x0b\x60\xba\x05\x7b\x5e\xb8\xc4\x38\xbb\x0c\xa5\x15\x7d\xbb\xe2\xdf\xb8\x0b\xb2\xed\xab\x54\x98\x65\x91\xf2\xf4\x63\x7f\xf7\x6e\x42\xe4\x54\xd1\x54\xdf\x0f\x10\xe9\x41\x34\xeb\xc2\x4d\x90\x29\x78\x04\x57\xb1\xc5\x7d\x95\xb8\x1e\x75\x5f\x87\xbe\x19\x72\xd0\x15\x94\x6d\x7d\x96\x5e\x94\xbf\x61\x16\xe6\xb7\x72\x85\x5e\x1a\x0f\xb4\xfd\x47\x49\x7c\x5b\xae\x8b\x15\x91\xcc\xaf\x2e\x5f\xac\xfb\x8d\x79\x0c\x68\xf5\xc4\x70\x44\x76\xa8\xff\x7c\x10\xb2\x05\xdb\xc8\x74\xd0\xe5\x0d\xa6\x6b\xa6\x3f\x70\x90\xa2\x03\x17\x66\x09\xb5\xda\x00\x2f\x9b\x11\x23\xd3\x9a\x02\xee\x7c\x15\x39\x5d\xd7\xe1\x0e\x0c\x64\x56\xe7\x0f\x9f\x07\x8b\x80\x56\x5a\xec\xbb\xae\x8b\x2d\x31\x81\x32\x45\x68\xa9\x9c\x37\x2b\xdb\x26\x8a\x09\xb0\xbd\x7e\xd9\x5f\x66\x5e\x85\xe9\x16\xb6\x2f\x9f\x63\xd3\x9f\x6c\x6a\xe5\x14\xae\xfb\xc9\x42\x15\xf7\x8f\x9a\x6b\xc5\x3e\x8d\x4c\x27\x44\x32\x7d\xb0\xd0\x15\x62\x1c\xe1\x25\x73\x80\x3b\x0c\x14\xa6\x73\x5c\x41\x4d\x9d\x26\x3d\x45\x4f\x4c\xae\x57\x74\x16\x63\xe5\x5f\xb8\x2f\xfc\x26\xf0\xcf\xd0\x5b\xe6\x1e\xd5\xd9\x9f\xe2\x17\xe6\x94\x3e\x16\x1f\x83\xde\x1c\x55\x01\xdd\xb5\x05\x2d\x92\xf5\xd1\x3f\x8e\x09\x28\x5f\xee\x50\x3d\x5f\xa7\x28\x65\x47\x66\xad\x9c\xb7\x57\xe0\x50\x4d\x38\xe4\xad\x2d\xec\xe6\x57\xa0\xcc\x9f\xe7\x34\x97\x57\x3d\x85\xdd\x92\x2b\x4a\x49\x58\xa6\x69\xe9\x4a\x46\xf0\x5c\x9f\x95\xab\x8e\x9c\x9a\xff\x34\xcb\xdc\x0c\xa8\xd1\x31\xdc\x78\x4b\x94\x49\x0e\x68\xa1\x87\xe8\x86\x65\x9f\x5f\xb9\x04\xb5\xd5\x6b\x09\x6d\x86\xa9\xfd\x01\x50\x2c\xe8\x30\x30\x9c\xa2\x17\xd9\x86\x40\x40\xf6\x56\x23\xd5\x51\x1a\x94\xdc\x4c\x0f\xd1\x95\x2b\x80\x96\x88\xc4\xd4\xfb\x00\x58\x29\xcf\x1f\x1c\xf7\xc4\x66\x54\xb5\x1d\x58\x61\x5b\xa5\xac\x5f\xc7\x3d\xff\xd7\xe8\x4c\xf6\xee\x2a\xfc\x84\xfe\x7a\xe3\xe9\xd9\x6e\x80\x87\x36\xbb\xc9\x93\xac\xdc\xda\x91\x4e\xe2\x59\x15\x61\x0d\x8d\x13\x82\x21\xc8\xb6\xaf\x2a\xf0\x9d\x03\x43\x95\xd3\x0f\x1a\x8a\x07\x45\x6d\xa7\x5f\x67\xf6\xa0\x2a\xac\x56\x6e\x84\xba\x27\x76\x10\x33\x1b\x77\x4f\x73\xef\x22\x13\x0c\x80\x34\x04\x86\xf8\x1f\x29\xfc\x7f\x14\xde\xe1\xbc\x93\x2f\x4d\x72\x9f\xab\x11\xdc\x8b\xd3\x5b\x1e\x50\x59\x74\x6d\x95\x46\x4d\xab\x4e\x82\xdb\xe4\xce\x5c\x26\x47\x52\x4b\x74\x34\x94\x50\xf1\x04\x2b\x98\x8c\x8a\x0c\x58\xce\x0b\xf3\x31\x50\x6b\xd2\x15\xa1\x27\x56\x36\x03\x0a\xb9\xb4\xd8\x6f\x4f\xf8\xae\x5d\x54\x3f\xfd\xf5\x00\xeb\xf4\xab\xe8\x4d\x2a\x45\xcb\xef\xea\x44\x31\x6d\x01\x4e\xd4\x6b\xd5\x9d\x04\xff\xc8\xe4\x15\x4a\x9d\x02\xa9\xe6\xd8\x0f\xb3\xa2\x74\x37\xaa\x7e\x53\x1c\xac\x69\xbb\x9e\x44\x2b\x45\x1f\xbb\x32\xb6\xe6\x3f\x7d\x82\x64\x69\x43\x02\xd7\x96\x59\x89\x6c\x44\x76\xee\xf3\xcf\x16\xf3\xaa\x3c\xfa\xec\xcf\xe5\xc2\x4b\x3a\x7c\x43\x90\xcf\xb3\xe1\x35\x43\x49\x93\x7e\x04\x01\x3b\x5f\x5e\x3b\xbc\xf4\x7c\xec\x3c\x10\xd0\x1c\x83\x81\xb6\xac\xcc\x82\x87\xee\xc5\xdc\x4e\x2e\xb7\xbb\xa0\x79\x23\x64\xba\xb7\x3f\xa2\xfb\x74\x7f\x2e\xa6\xc1\xba\xa5\x25\xd5\x7c\x5d\xf9\xb2\x43\x2e\x58\x1b\x52\xf1\x94\x33\x46\xcf\x40\x04\xca\xf4\x62\xd8\xbf\x12\x6c\x47\xd8\x8f\xe4\x36\x13\x9e\xb7\x3d\x1e\xb3\x34\x0a\xec\x48\xf9\xbc\x64\x5b\x99\x62\xd6\x1d\x2b\x03\x0a\xad\x12\xdd\x3d\xfb\xaa\x67\x04\x69\x01\xda\x0f\x67\x53\x4d\x44\x73\x98\x4d\xd1\x93\x3b\x93\x6c\x5a\x3b\xb1\xe2\xcc\x5b\x02\x87\x8a\xda\xb8\x30\x4f\xcd\xe5\x0a\x4a\xc6\x18\x59\x94\x4b\xce\xc0\x2e\xe9\x90\x2f\xde\xb3\xab\x01\xfb\xcb\x34\x4e\xf7\x1d\x77\xc5\x18\xe7\x9d\x92\x3e\x6c\xf5\xd5\x0f\xa6\x47\x53\x38\x73\xc2\x18\xa9\x32\xce\xc7\x7b\x21\x96\x1b\x69\xfb\xec\xa4\xe5\x89\x97\x99\xb0\xde\x27\x5e\x6f\x34\x07\x26\xab\xaf\xc7\xb6\x3e\x28\xff\xa4\xd1\x55\x27\x31\x2e\x19\xb2\xe5\x87\xf3\x96\x22\x70\x51\xb2\x4c\xb9\x39\x46\x94\x46\xce\x8c\x92\x2f\x47\x6d\xcc\x2b\xf0\xe6\xa7\x97\x51\xa2\x06\xbf\xc9\x1a\xca\x71\x38\x15\xf7\xfd\x56\xf7\x65\x87\x0c\x1a\x7a\x2d\x26\x13\x3b\xbc\x24\x17\x2d\x22\xeb\x15\x9d\xba\xe1\x81\xb4\x5b\x5f\x2e\x4a\x21\x2d\x03\x08\x1d\x84\xe4\x84\x63\x90\xee\xe9\xb0\x4b\x13\x89\x35\x9d\x2f\xc2\x0e\xa7\xd9\x4f\x95\x3f\x11\x5c\xd7\xfb\xd3\xb7\x79\x24\x7f\x97\xa3\x1d\x25\x2e\xc4\x44\xb2\x3c\xe6\xd8\x50\x4b\xfa\xbd\x46\xc7\x70\x0c\x8f\x15\x4a\x84\x64\x79\xa6\xdc\x37\xfa\x5f\x25\xb1\xbc\xb2\xd0\x76\x09\xa5\x2a\xe3\x18\xa5\x77\xbd\xbc\x6c\x1c\xf9\x87\xfd\xb9\x01\x59\xd1\x1a\x48\xed\xa4\x20\x05\x54\xf8\xfa\x76\x90\x8b\xa7\x90\x0d\xb4\x5f\xec\x17\xba\xd8\x65\x04\xb9\x76\xa3\x22\x77\x59\x02\xa7\xfa\xb8\x51\xfb\x80\x0f\x11\x46\x05\x6a\x7f\x45\x65\x64\xea\x28\x17\x94\xf1\x11\x6b\x12\xaa\xbf\xcf\xf2\x09\x35\xd6\x37\x4a\x64\x33\xe4\x2c\x86\x4c\x73\x17\x5e\x5a\x48\xb9\x3d\x94\x51\x5b\x4c\x45\x36\xc2\x65\x9d\x0c\x30\x0e\xd4\x91\x87\x1f\xa7\x7f\xd3\x91\xf8\x4d\xa1\x6f\x1f\xfd\xc5\x05\x4d\x6f\x5a\xab\xd7\x60\xad\xef\x21\xc3\x95\xc1\x11\x62\xf5\xc0\x22\xe8\x6d\x24\x2d\x91\x5d\x8f\x28\xb5\xfe\xf9\x65\x2e\x46\xcf\x0c\x57\xda\xb2\xf9\xcc\xe5\xac\xad\x91\xb4\xc5\x9a\xb6\x48\x35\xa5\xda\x78\x25\x6f\xb6\xb4\x3c\xf4\xad\x4f\x1e\x2e\x00\x86\x35\x4e\x49\xa6\x11\xe5\x1c\x38\x28\x11\xa6\x31\xa4\x67\x1b\x6c\x61\x37\xe5\xc2\x12\xb2\x7f\xc3\x60\x5f\xf8\xbe\x5b\xd6\xf2\x69\xf8\x48\x62\xc4\xb1\x6f\xe8\x8e\x27\xec\x65\x77\x44\x93\xe2\x7d\xb2\x71\x82\xcc\x42\x46\x80\x4b\xad\xb9\x9a\x64\x49\x3b\xcc\xed\x94\x0f\xca\x35\x66\x5e\x65\x40\x43\x5a\xf6\xcd\x6d\xac\x48\x82\x0d\xea\x05\x9e\xcd\x08\xe5\x44\xf9\x84\xe1\x4d\xb8\x6c\x44\xb1\x36\xfb\xd1\x12\xb8\x43\x1c\x2c\xba\xe4\xcb\xd1\x2a\x21\x57\xe0\xdd\xa7\x5b\x3e\x9c\x06\x0a\xd3\x49\x29\xf9\x4e\x3d\xb3\x62\xca\xbf\x1a\x54\xe3\x33\xf2\x00\xba\xa6\xd8\x3c\x6a\x22\x75\x83\x4f\x15\x61\xbb\x85\x3c\x2b\xa5\x9b\x7b\x7b\x62\x4f\xdd\xf7\xc7\xfa\x44\x66\x66\x64\x0a\x98\x29\x97\x71\xc6\xb0\x42\x82\x8c\xfd\x0c\xd6\xda\x2d\x72\x6f\xfc\xe5\x67\x8a\xc4\xc8\x52\xb4\x37\xf7\x68\x36\x0a\xe1\x9d\x4a\x78\xa4\x06\x18\x5f\x02\x1b\x15\xf3\xfc\xea\x7a\x9c\x37\xc1\xff\x47\x55\x8f\xea\xba\x89\x4b\x49\x6d\x77\x1b\xf9\xc6\x47\x7c\x34\x37\x8a\x5d\xfc\xdd\x6d\xa5\xa5\x67\xfc\xf0\xc3\x23\xe6\x6d\xdc\x88\x02\x4b\x3b\xe0\x0e\xfa\x31\xfe\xc6\xd4\x95\xdb\x73\x6b\xa7\xd0\x1f\x51\x19\xee\x2e\x6a\x5d\xf9\x9a\x56\x35\x8f\x04\x75\xfc\xec\x64\xcc\x03\x55\x64\x2c\x46\xbe\x88\xba\x6c\xf5\xe0\x3d\x1c\x9c\x87\x8e\x93\x85\x61\x55\x42\x28\x56\x4e\x1d\x27\xc8\xfa\x18\x26\xc8\x2d\xde\x87\xd5\xbc\x18\x7d\x5d\xa9\x57\xe4\x12\xac\x88\x33\x8e\x94\x36\x73\x36\xb6\x9c\x5a\x03\x2f\x8a\xbb\xda\x68\x28\xd7\x4a\x51\x54\xe7\x70\xdf\x40\xa8\x28\x68\x46\x95\x94\x63\x2e\x5b\xf6\xf0\xee\x1b\xd7\xfc\x57\xec\x42\x51\xab\x8b\x5a\x93\x45\x9a\x28\x45\x74\xfe\xfc\x37\xd7\x48\xfe\xd1\x31\xe8\x5a\xa1\x28\x20\x0c\xb7\x14\xec\xa4\x93\xd2\xa8\xf7\x3e\x7e\xcd\x62\xf4\xfd\x80\x98\x92\x4f\x27\x17\x9a\x4b\x86\xe4\x3e\x1e\x8d\xd3\xf5\x67\xb6\x33\xf1\x31\x08\x5b\x32\x56\xec\x87\xad\xaf\x74\x3c\xe1\xad\xd6\x35\xa2\x5a\x5b\x4b\xfa\x1d\x29\xfb\xcc\x19\x17\xb5\x9d\x06\xcb\xc9\xc2\xc0\x09\x36\xdc\x55\x17\x48\xb0\x97\xad\xa0\x56\x41\x42\x7c\x6d\xf6\x6e\xa9\x62\xea\xf7\x2d\x2f\x77\x17\x6c\x7f\xa3\xdd\x61\x81\x75\x93\x46\xce\x70\x25\x94\x08\xfa\x49\x4f\xe9\x67\x8c\x2f\x0a\x1b\x7e\xe5\x35\xea\xa8\x98\xf2\xda\x82\xae\x23\xa7\xc9\x41\x86\x79\x68\x12\xdb\x16\xee\xbd\x78\xd6\x25\x80\x42\xb7\x1c\xfe\x86\x64\x0b\x2b\x0b\x58\xf7\xac\x0a\x9f\x23\x57\xf4\xfc\xc0\x38\x91\x73\x27\xa7\x17\xf2\x5a\xb9\xa0\x0c\x66\x94\x24\xf2\xfb\x97\x32\x40\x6c\x81\x5f\x5b\xaa\x90\xdf\xe1\x29\x23\x3e\x86\xe0\xee\x3c\xa4\x63\xdf\x34\xea\x2b\x60\xba\xa6\xbe\x9e\x1b\x7c\xa8\x22\x1c\x5c\x32\x81\x43\x95\x8d\x60\x88\x4d\x33\xc0\x8e\x6b\x13\xf5\x08\xbf\x30\x27\xb7\xd4\x77\x65\xee\xa1\xaa\x73\xa4\x2d\x17\xde\x17\x87\x66\x9f\x07\xe7\x09\xd5\x65\x0f\xbc\xa4\xd3\x9c\xa4\x85\xec\xe4\xf8\xce\x7c\xc1\xbe\xf1\x72\xfc\xf5\x01\x9d\xeb\xf8\xfb\x0c\x03\xec\x83\xde\xae\xbc\xc3\x76\xdf\x8f\x08\xf8\xf3\x7f\x84\xef\xbb\x25\xe7\x90\x25\xb4\x37\x28\x84\x37\x0a\xee\xda\x66\x78\x95\x33\x6e\xf8\x47\x12\x4d\xfe\x2e\x21\xe0\x28\x06\xd8\x91\x33\xbf\xc8\x7e\x82\xd9\x63\x00\x5d\xb3\x9f\x88\x8a\xdf\x88\xc5\x7e\x21\xf1\xc0\x81\x45\xc1\x22\x75\xe0\xe4\xb1\xc0\x3d\x12\x4a\x60\xb3\xc6\xa5\x20\xce\xec\xee\xb3\x95\xb5\x73\x79\x4f\x8d\x35\x17\xfa\x2f\xef\x31\x80\x6e\x08\xf5\xeb\xbc\x46\x1a\xa1\x9b\x95\x29\x1b\xd1\xae\xe8\xf1\x4d\xbe\x07\x8a\x26\x3c\xf5\xb1\xf4\x45\xa3\xb7\x7f\x8d\x13\x07\x5f\xd6\xc1\x8c\x8a\x26\x05\x98\x95\xe1\xe6\xb5\x7b\xf0\x0a\x51\x17\xa0\x3b\x78\x5d\xa8\x82\xe3\x75\x01\x97\x77\xb3\x30\xc1\x4e\xb5\x71\xae\x77\x4e\x19\xda\x08\x75\x65\xb1\xa9\xa0\x50\x69\x87\xe4\xdd\xc6\xa4\x7a\xec\x22\x66\xa7\x39\x79\x1e\x68\x1b\x76\x9f\xde\x54\x6c\x02\x71\xed\x20\x12\x59\x65\xf5\xa4\xed\x06\x72\xad\x6e\xa2\xaa\xcb\x30\xc4\x6c\x2f\x59\xf0\x75\x03\xa5\x28\x07\xa3\xff\x7b\x8b\xdb\x2d\x09\x3b\x2f\x4f\x78\x21\xb9\xbe\xb2\xa7\x9c\x5c\x12\xd6\xee\x9d\x77\x7d\xe5\xdc\xad\x30\xc9\xd0\xf9\x0a\xad\xd6\x27\x35\x95\x44\xc0\xfa\x85\xc0\x5b\xf7\xde\xeb\x08\xb2\x05\xdc\x61\x88\x24\xc3\xbb\xf7\x91\x51\xf9\xbc\xb4\x97\x0d\xeb\x9f\xcf\x68\x38\x97\x8a\x1a\x0d\xbf\x6c\x21\x41\xdf\xdc\x35\xeb\x7b\xeb\x36\x4e\xb4\x96\x9e\x32\x96\xc2\x4a\x61\x6a\x68\x56\xf8\x07\x0d\xdc\xb6\x4c\x6d\xeb\xe1\xbd\x5d\x0f\xdc\xf4\x01\xfa\xbb\x0a\xbc\x06\xce\x9e\x6c\x17\x8f\x9b\x5d\x9a\x33\xc7\xae\x65\x54\x2c\x95\xc1\x8c\xb6\xb3\xbe\xb6\x76\xf4\x66\xde\x52\xcd\x75\xe8\x12\xbf\xd4\xc1\x8b\xd2\x6e\x1c\xfe\xd9\x6d\x03\xce\xb5\x3d\xa0\x99\xa2\xc4\xd6\x40\xcc\x1c\x32\x86\xaf\x9c\x80\xd9\x0a\x17\xd9\xb1\xd4\x00\x6b\x6f\xe5\x02\x5f\x7d\x89\x2f\xea\x68\xf4\x36\xd4\xdb\xb2\x1c\x54\xd1\x3e\xbf\x0d\xdf\xc5\xe4\xd4\xa9\x17\x72\x64\xf4\x93\x5d\xdf\xf1\x07\xdd\xe7\x17\x57\x0e\x26\x60\xdb\x44\x90\xa6\x0d\x83\x9f\x5f\xd4\x4b\x9e\x62\x5b\x2c\xee\xb5\xa2\x81\x6d\x51\x5a\xa7\xd3\x09\x29\x70\xdf\x4d\x45\x07\x97\x45\x0d\xf5\xc7\xf1\x7b\x2d\x4f\x58\x44\xfc\x3f\x5a\xde\x3b\xaa\xe9\x6c\xeb\x1f\x3e\x21\x91\x80\xd2\x06\x0b\xa2\xd4\x19\x01\x1b\xa0\x28\x20\x20\x24\xca\x38\x82\x48\xb9\xa0\xa2\x52\x82\x83\x88\xd2\xa5\xd7\x24\x80\x0e\x3a\x16\x50\x9a\x8a\x10\x1c\x29\x02\x42\x40\x9a\x10\x20\xb1\x32\x80\x12\xa4\x05\x88\x10\x46\x82\x40\x28\x21\x40\x48\x4f\xde\x15\x74\x9e\x7b\x9f\x7b\xef\xfb\xdf\xf3\xcb\x5a\xac\xc5\x82\xfd\xfd\x9c\xbd\xf7\xd9\xdf\x73\xf6\xe7\xec\x9d\xa3\xfd\x67\x9c\x0f\x6d\xee\xc7\x6f\x47\xc3\xc6\x56\x08\xf0\xf2\x49\x28\xb3\xb1\xa9\x12\xcf\xcc\x99\xa6\xfc\x7e\xf8\x6d\xc4\xc2\xa3\x96\xfd\xd7\x36\x59\x0f\xcf\x11\x86\x86\x71\x5d\x33\x77\xb4\x1e\xf5\x86\x5e\x7a\x82\xd0\xde\x75\x8d\x00\xa5\xa5\xb2\x5e\x3e\x68\x94\xc9\xa5\xc4\xfe\xc9\xaa\xc7\x29\x6f\x96\x59\x6b\xba\xc8\x7d\xa8\x0d\x3e\x97\x35\xd7\x5e\x45\x11\xcd\x7f\xee\x9d\x69\x0c\xc5\x04\xc2\x0f\x95\x41\x5c\x76\xa5\x16\xea\x6b\x62\x55\x72\xd2\x13\x06\x90\xfb\xcd\xa3\x7b\xfc\x69\x32\x0f\x85\xf4\x5c\x9c\x1e\x82\xe7\xd0\xa5\x0c\x16\x0e\xb6\x2e\xdf\xe3\x5b\xb7\x9e\xd4\x99\xb2\xfa\x91\x1f\xfc\x6a\xfe\xd2\x2d\x9c\xa6\xce\xa9\xcd\x1d\x9f\xeb\x66\xc0\x9f\x36\x3b\x67\x9c\x1e\x88\xe6\x72\xf5\x53\x7d\xbe\xa9\xaa\x8b\x00\x2f\xfb\x56\xba\x8f\x33\x38\x73\x48\x1d\x53\x9f\x3f\x8f\x9c\x66\x55\x6c\x03\xc3\x1f\x5e\x4c\x7a\xc2\xf2\xa2\xc1\x0a\x89\xa2\x74\x3f\xbc\x60\x5d\x65\x7c\x97\x6f\x6b\x07\xf9\x9b\x57\xec\x79\x10\x52\xb6\x59\x8c\x8d\x2b\xd1\xa3\x13\x89\xf4\x6f\xfa\xd6\x0c\xcf\xfa\xca\x37\x19\xf3\x44\x8d\x75\xfc\x23\x57\xba\x3f\x9d\x69\xaa\xd7\xd7\x04\xbb\xc4\xa7\xdb\x0f\x37\x4e\x8c\x6d\xf9\x9f\xc6\xe8\x77\x97\x23\xa6\x7e\x62\x13\xf4\x14\x61\x8c\x4b\x22\x57\x44\x42\x54\x74\xdd\xc1\xb3\x9d\xec\x05\xf7\xed\xf7\xad\x4c\x05\x71\xe8\xf0\xb3\x42\x85\x9d\xff\x4b\xfa\x29\x83\x33\x39\x65\xad\x08\x3b\x7a\xd9\xdc\x67\xb7\x7d\xa6\xdf\x8f\x7a\x3f\xfd\x7d\x95\x45\xe1\xd6\x3c\x33\xfa\x26\x99\xff\x0b\xce\xf2\xf7\x07\x49\xf9\xe5\x69\x25\xf7\xf2\xec\x39\x8d\x3b\x0d\xbf\x0e\x70\xb4\xf9\x16\xd6\x3b\xa4\xe9\x34\xfa\xaf\x24\x44\x06\xcd\x1f\x8d\x6f\x82\x90\x8a\x3f\x5d\x0e\x2c\x7b\x95\xfb\xa3\xcf\x86\x57\x97\xeb\x36\x6b\x23\xf2\x4f\x6d\x49\xf3\x5c\xeb\x20\xda\xc0\x14\x24\x0b\x6d\x96\x13\x3e\x2a\x82\x85\x99\x73\xc6\xc3\x5a\x88\xfc\xb7\xed\xce\x06\x0e\x28\x4c\x1d\x7b\xaf\x4d\x9c\xf8\xc5\x4b\x19\x69\xd2\xdd\x6d\xdc\xc2\x84\x2f\x09\x3e\x30\x4d\xcd\xc1\xcb\x92\xed\x31\xdf\x7b\x82\xb5\xfe\xd9\x13\xfc\xc7\xb7\xee\x1b\xeb\x29\xb5\x31\x0e\x94\x97\xf4\x95\xf3\x68\x3b\xf8\xfc\x42\x91\xf8\x21\xb6\x78\x5b\xe2\x95\x95\x49\xe6\x52\xa8\xb5\xed\xf7\x63\x63\x32\xef\x3a\x47\x84\x44\xe3\x78\xad\x5f\x65\x01\xa7\x88\xd5\xa8\x48\x2c\x98\x7c\x71\xa7\xcd\x10\x94\x45\xf5\x36\xfd\x3b\x8a\xa7\x43\x65\xc4\xa0\x22\xfa\xf4\x9b\xd0\x5b\x47\xab\x8e\xad\xa5\xf6\xa8\x58\x9a\x32\x9d\xf3\x90\x16\x18\x02\x90\x72\x47\xb6\x05\x53\xb9\xb3\x32\x2e\x03\xe3\xa5\x6d\x39\x1e\x90\xff\x78\xbc\xf6\x0e\x31\x9f\x7d\x9f\x48\x65\x96\xae\xff\xe5\xee\x01\x9f\x35\xea\xf3\x5a\x80\xd6\x21\x92\x85\xde\x11\x50\xf0\xba\x91\x7c\xb0\xa7\xf6\xac\x2b\x28\xba\x47\x71\x58\x57\x74\x8f\x62\xac\xf5\x77\xcb\xf0\xff\x12\xc4\x06\xf6\x62\x67\x7f\xf1\x24\x47\xdb\x3f\x45\x27\xb0\x2e\x7c\x1a\xea\x22\xfa\xf5\xa1\xc8\xc1\xb2\xb7\xff\x5d\x23\xae\x19\xb4\xc4\xbf\xfa\xe2\x96\xbd\x03\x43\xb3\x98\x2e\xca\x0a\x73\xf2\x0c\xf8\x0f\xab\x5d\x0f\x78\xb8\x6e\x7a\xb4\x05\xbb\xd6\x42\x3c\xbd\xd6\x42\xfc\xbf\x87\x4b\x88\x5f\x65\x08\xe9\x61\x35\xc5\xdb\x04\xcd\xc1\x66\x0f\x2f\x59\x08\x8e\xfd\xfb\x44\x94\xfa\x93\xbe\x33\x8f\x58\x74\xf8\x56\x7c\xf7\xdd\x85\x83\x4b\xff\xd3\x30\xfc\xad\x4f\xf8\xdf\x30\xcb\x64\xc2\x12\x58\xba\xde\xf9\x9a\x86\xbf\x93\x06\x86\xff\x71\xf8\xdb\xad\x0d\xac\x48\x0c\xd3\xe9\xea\x4b\x4b\xab\xce\x06\x29\x3b\xfa\x5f\x51\x21\x87\xba\x85\xfd\xcc\x6f\x54\x24\x08\x79\x13\xc6\x14\x56\x3b\xaa\x6a\x62\xed\xaa\x89\xba\x67\xc3\xc6\xff\x16\x66\x40\xf7\xda\xf0\xc5\x6d\xce\x1c\xce\x96\x63\x48\x32\x76\xd4\x3b\xf1\xc6\xdf\xa7\xea\x7f\x7f\xb7\xee\xea\xba\xff\x98\x3e\xee\x19\x18\xdd\x0c\x53\x2e\x97\xf8\x9d\x80\xec\x7c\xf1\x1f\x2a\x2c\x74\xcc\x8b\xca\xd5\x92\x4b\x1a\xee\x0f\x22\x32\xff\xed\x7f\x55\xf6\x13\xf8\x5c\x99\xe7\xbb\x65\xa6\x0c\xd2\x8e\x1d\x14\x5b\x5a\xf1\x3a\x98\x86\xc4\xaf\x52\x9d\x50\x6b\x4c\x32\xc0\xec\xe1\x7b\x5e\xa2\x16\xa2\x0d\xa3\x86\x68\xc3\x34\xbe\x90\xf3\xcc\xd7\x7c\xd7\x27\x6a\x3d\xf6\x6a\x5a\xc0\x0b\x7d\x7d\x89\x53\x20\x59\x9e\x34\x58\xb2\xea\xc4\xc7\x85\xc0\x8f\x72\x1f\xd1\x02\xad\x54\x52\xc8\x13\x52\x12\xed\x64\x0f\xe9\x89\xfc\xe1\xd9\xc8\xca\xed\x73\x34\xf5\x41\xbd\x61\x04\x0a\xfd\x23\xb1\xd3\x49\x7c\x89\x37\xb5\x1c\xf7\x98\x3c\x75\x8e\x09\x75\x94\x05\x63\x55\xd0\xfd\x79\x27\xcd\x9b\x95\xc2\x69\xf0\xb1\xbb\x6b\x54\xf1\xd2\xad\x02\x43\x99\xd3\xd4\xbc\x89\x89\x77\x39\x81\x10\x3b\xbf\xd0\x3c\xc4\x94\xcc\xd9\x98\x39\x07\x84\x38\xbe\x01\x93\x29\xc4\x19\x23\xfc\x92\x94\x2e\xd7\x76\x44\x7e\x52\x0f\x22\x68\x9f\x18\x82\x97\x41\x32\x4a\x97\x49\x7d\x2c\x29\xd1\x69\x67\x5c\x22\xad\x94\xe4\x5e\x2f\x6a\xf0\xdc\x8e\xf1\x5a\xac\x78\x91\x49\x6c\x11\x36\x2f\xd7\xda\xa3\xa9\xe7\x18\x56\x94\x12\x7a\xe2\xe5\x04\xa5\xac\x17\x52\xde\x34\x7b\x11\xbb\x18\xbe\x96\x26\x5b\x3c\xec\x28\x0f\xe0\xe6\x85\x34\x99\x89\xa3\xd6\x11\x57\x84\xf1\x8b\xb3\xbb\x88\xf3\xc2\xc8\xfa\xc9\x43\x2a\x75\x17\x69\x41\xe1\x5a\xf4\x16\xe9\x13\x02\x9d\x3f\xdf\xac\x8d\xb2\x03\x0e\x4e\x1f\xf0\x2c\x8e\xc4\x1e\x1b\x00\x48\x6f\x15\x0f\x06\xd0\xb9\xc6\x7f\x45\xb6\xd4\x4c\x7d\xbc\xe4\x00\xb7\xcb\xa9\xfc\xd3\x52\xec\x08\x4f\xd5\x8b\xc4\x96\x77\x6f\x98\xe9\xc7\x8f\xc0\x9b\x88\xfa\x7f\x2c\x34\x5f\x6e\x56\x5e\x69\x1a\x88\x29\x68\x38\xac\x21\x4d\x98\x49\xf9\x90\x9e\x76\x0e\x33\x67\xd0\x2c\xf7\xf3\x62\xe9\x02\xfa\xe3\x54\x84\x1a\xaf\xc2\xf2\x40\xb8\xd0\xc1\x50\xb8\xb4\x4d\x99\xfa\x8f\xec\xca\x99\x71\x63\xf6\x23\xec\xe3\x55\xdb\xfc\x7e\x74\x86\xa8\xbf\x08\xba\x37\x7f\xd2\x93\x73\x3d\xf2\xf7\x79\x9b\xb3\xa6\x72\xcf\x46\xfc\x93\xa6\xae\x54\xd0\xd7\x5c\x2e\xa7\xfb\x79\x5e\xae\xeb\xd6\xb9\x60\xdd\xb3\x6c\x7e\xa1\xc6\x76\xf1\xa9\xd5\xf2\x6e\x67\x7b\x1e\x9b\xe4\x8c\x4f\xa6\x1c\xf8\x23\x98\xd2\xae\x5c\xff\xc6\x77\x58\x2d\x8e\xbc\x56\x15\xda\x44\x76\x56\xca\x1d\x1b\x2e\x5b\x18\x22\xeb\xd3\xc6\x7e\x74\x1f\xd3\xe7\x30\xe6\x76\x52\x95\xf0\xd9\x23\x70\xfe\xd6\xae\x1c\x86\xb0\x93\xdc\x31\xf5\x94\x1e\xee\x7d\x79\xf5\xfa\x82\x23\x5c\xc6\x24\xce\x07\xb5\xd1\xb7\xb1\x6d\xb9\xd2\x75\x69\xcd\x0f\xd7\x54\x72\xe0\x90\xe6\x8d\x8f\xcf\xcb\xba\xb3\x9d\x2c\x9a\xcc\x84\xd1\xef\x9d\xc9\x72\x23\xc2\xd3\xc3\x6c\x9b\x2e\x3f\xed\x69\xdf\x82\x47\xeb\xb2\xef\xa2\x32\x7d\x43\x97\x95\x93\x10\xd3\x4e\xf3\x41\x26\x95\x42\x9f\x37\xcd\x11\x28\x4b\xe4\x8b\x7c\x9c\xc6\x16\xf6\xcd\xc5\xb2\xe1\xb0\x99\x9d\x0c\xf2\xcf\x65\x01\x56\x2b\xfe\xc5\xd3\x77\xfd\x68\x4d\x8f\xee\x3b\x55\x9f\xbc\x31\x7d\xc4\x65\x00\x89\xec\xde\x90\x34\xff\x67\x5b\x86\x28\xa7\xab\x6d\x27\x4f\x4a\xd0\xc0\x51\xb9\xae\x54\xe0\xf5\xf6\xa2\xfa\x83\x4d\x32\x02\xa6\x86\xbf\xc4\xd0\x8a\xea\x6f\x65\x6e\x19\x73\x7a\xf5\x54\xda\xe5\x69\xc1\x1f\xe5\x11\x4f\xad\xf6\x58\x46\x64\x0a\xe3\x7f\x89\x9c\xc6\xdd\xad\x4a\xcf\x8c\x4c\x0c\xa9\x32\xce\xb5\x8c\x8e\x9a\x6a\xfb\x10\xd6\x55\x52\xab\x6c\x11\xe3\x16\xee\x35\xed\x67\xdd\xf0\xf4\x19\x59\xd7\xfa\xc6\xe0\x81\x2f\xd1\x5d\x7e\xb4\x69\x48\x86\x42\xca\x8e\xc0\x01\x24\x92\xb6\x2e\x27\xa2\x22\x00\xa1\x90\x84\xca\x42\x4b\x43\x04\xc4\x5c\x7a\xeb\x1a\x03\x71\x0d\xbd\xa1\x53\x94\x9a\x11\x38\x81\x87\x1f\x29\x4b\x46\x7a\x45\xb7\x06\x19\x35\x42\xb0\xdd\x2d\x01\x5b\xea\xae\x88\xa5\x2f\x86\xbf\xbf\x5d\x6d\xdb\x69\xd7\x61\xb6\xc9\x83\xfe\x42\x63\xd3\x9f\xbc\x47\x4a\x5f\x53\xad\x74\xa2\x34\x7d\xac\xe4\x0b\xf1\xd0\x04\x27\xfa\x8b\xd0\x39\x60\x37\xe5\x30\x9f\xd6\xef\x7f\x61\xb2\xc5\xb8\x65\x2d\x12\xc2\x4e\x92\x57\xed\xa7\xdc\xf1\xb4\xaa\xf3\xeb\xf5\xaf\xeb\x70\x20\x2e\x72\xb4\x4b\xb0\x59\x59\x99\xb2\xb9\x78\xf0\x80\x0a\x48\x5a\x9c\xfe\xbd\xd3\xe5\xbe\xf8\xe5\xae\xdb\x2f\xe7\x52\x9f\x4c\x29\xff\xe5\x61\x30\x10\x8d\xbe\x48\xeb\x37\x84\xd6\xd7\x92\x6c\x3d\x18\xb5\xf2\x54\x48\xff\x01\xc1\xe9\xd4\x8b\x49\x9c\x37\xd1\xd8\x08\xaa\x71\x99\x52\xd8\x68\x7e\x46\x79\x63\x6b\x77\x14\x2a\xd6\x62\x8d\x34\x9f\x3d\x3d\x85\xba\x34\x57\xbe\x90\x32\xa4\xc6\xcb\x39\x08\x4e\x28\xc2\x5c\x87\xa3\xc4\x9e\x70\xd0\xec\xe6\x6b\x25\x73\x3a\x06\xeb\xca\x8b\x5a\xd0\x8d\x89\xdf\x9b\x40\x71\x0b\x3d\x9d\x5f\xf8\x18\x35\x3e\xf6\xf3\x6e\x62\xfe\x68\x63\x3e\x2a\x81\xf3\x53\x2e\xe1\xc9\xae\xd3\xed\xc4\x10\x1d\x97\xec\xfd\xed\x49\x7f\xcd\x70\x43\xe3\x45\xda\xb7\xdb\x59\x3e\x87\x8d\x18\x7c\x38\x30\x2f\xf2\x99\xb9\x4b\x2c\x50\xac\xa0\x7a\x7f\x3b\x14\xcf\x53\x0a\xcd\x6e\x9e\x54\xa9\x58\x9a\xb2\x01\x76\x1f\x53\x18\x7f\x8c\xd1\xb9\x54\x25\x57\x23\x9e\x9b\xd2\xfb\x89\x77\x57\x83\x1f\x11\x99\x53\x9f\x8b\xcb\x85\xbd\xc3\xb5\x53\xef\xa9\xa3\xa3\x56\x02\x9d\xa9\x23\x7f\x95\x4f\x84\xc2\x65\x42\x63\x62\x02\x23\xbe\x36\x18\x1f\xd6\xc6\x74\x2c\xf0\xa4\xe0\x17\x41\x16\x43\x48\x1c\x1d\xad\x1c\x95\xa6\xcb\xeb\x7f\xa5\x59\x98\xfd\xc3\x54\xe5\x6c\xbd\x72\xa4\xd4\x80\xb2\xbb\xdd\xb3\xf9\xf9\xd9\xed\x63\x5f\x1b\x3d\x68\x4d\x83\xf5\x6b\x87\xe6\xb9\x23\xf4\xdc\xca\xa2\xa4\xea\xdd\xc4\x79\x61\x42\x17\x6a\x89\x95\x0b\xc9\x58\x3b\xf4\xb1\x57\x4c\x09\x9a\x92\xb0\xbb\xbb\x7f\x8d\x3e\xa9\x76\xc3\x75\x3d\xb2\x7c\x23\x3e\x02\xdf\x89\xfa\x02\xc6\xa7\xd4\xfa\xb8\xcb\xb7\xf0\x82\x23\x97\xac\x50\xcc\xb9\x4d\x71\xc2\x63\xa7\xe1\xd5\x2b\xcb\xa8\xfe\x28\xac\x9f\x76\xd6\x08\x44\x29\x59\x58\xb0\x4c\x51\xc4\xb6\x48\xfd\xe9\xc4\x58\x6d\xe3\x28\xed\xe3\x25\x4d\xe6\x2a\x65\x5c\xcc\x14\xf6\xf2\x76\x59\x63\xe4\x50\x9c\xe4\x05\x6e\x1c\x15\x4e\xe7\xe4\xd1\x22\xa2\x41\x58\x65\x39\x74\xa7\x62\x6b\xbe\x68\xf7\x55\x79\xac\x51\x0a\x9d\x93\x8d\x30\xe5\x0a\x78\xef\x1a\xeb\xc5\xc5\x53\xca\xba\x49\x42\xeb\x79\xe8\x92\xe0\x23\xd3\xc2\x0a\xbc\x2c\x81\x23\x4f\xaf\x43\x92\x33\x5a\x47\xc6\x8c\xca\x59\x28\x03\x8c\xfd\xba\x0c\x61\x0c\x1c\x19\xbf\x4a\xf9\x6a\xbc\x8b\x90\xe1\xe4\xb3\x9b\x98\x1b\x81\x15\xda\x2c\x97\xca\x22\xc7\xa4\x91\x63\x6f\x89\x6d\x5e\xde\x53\xeb\x19\x1d\x1c\x7b\xb3\x16\xb5\xa4\x0f\xa4\x9b\x43\xb4\x78\x65\x9c\x9c\x80\xe6\xa1\x3b\x04\xd2\x4d\x23\x51\x04\xc5\x7a\x44\xcb\x7a\x92\x17\x87\x65\x5c\x7a\x3f\xe0\x32\xcc\x53\x33\x5a\x5e\x0c\x37\x26\x0f\x78\xd0\xc8\x4d\x0e\x05\xcb\x0e\xbf\x58\x09\x2a\xac\x30\x05\xcb\x69\x61\x31\xda\x59\xfd\xb2\x7f\x77\xa1\x56\x56\xdd\xe3\xb8\x80\x4b\x99\x78\x6d\xa5\xdd\x79\x68\xab\xd9\x66\x66\xf6\xeb\x08\x74\x47\x69\xee\xab\x69\xa5\x82\x8f\xc6\xda\x5b\x3e\x73\x96\x17\x4e\x64\x0a\x97\xe2\xdc\x5f\x64\x47\x8a\x32\xbf\x3f\xb6\xe7\xf4\xf8\x8a\x87\xe5\xec\xdf\xfb\x65\xa5\x70\xc7\xca\xe3\x0c\x5a\x28\x3a\xcf\xda\x94\xb4\xd6\x85\x2c\x56\x5d\x86\x62\x03\x5f\x08\xed\xb7\xc5\x89\xae\x4c\xbd\x98\x91\xd1\x39\x56\x98\x35\xbc\x6f\x49\xf0\x11\x95\xeb\x25\x51\xf8\x96\x12\xe7\x68\x03\xcf\x8a\x80\x71\xbf\xb2\xcc\x02\xbd\x3e\xed\x07\xe5\x88\x43\xf5\xd2\x3c\x89\x48\x16\x46\xaf\x9a\x67\x7b\xa1\x9d\x2c\xed\xd7\xba\x2f\x50\x47\xd1\x20\xcc\x79\x1b\x77\x39\xf3\xcd\x45\x68\x28\x53\xb6\xa8\xa1\xed\x40\x50\x8a\xd0\x66\x19\xdf\x59\x09\xc7\x16\x2c\x77\x91\xef\xe3\x84\x5a\xcb\xb9\xf1\x22\x28\x78\x1d\xbe\xdf\x6e\x94\x61\xdc\x7a\xcf\x80\x48\x14\x9a\x40\x9f\xe7\x92\x62\xff\x34\xfc\xfb\x30\x9c\x6b\x30\xe6\xff\xf2\x4f\xa6\x31\x91\xf3\xd0\x6b\xed\x94\x70\x19\xfa\x7f\x96\x69\xee\xfb\xf9\xe9\xa7\x33\x73\x02\x8b\x95\x9b\xc2\xb6\xe5\x84\x29\x11\x37\x93\x16\x83\x66\x1e\x12\x83\xcf\x7f\xf7\x29\x9b\x5d\x5b\xaa\xef\xdd\x6e\xb7\x24\xe8\x46\xc5\xb7\x9d\x6e\xd1\xc6\xfc\xf3\x37\x70\xf7\xef\x3b\x5a\xb7\x1f\xe5\x8d\x4c\x94\x66\x72\xb9\x33\x45\xd3\xbf\x65\x48\xa1\x98\x20\x16\x21\xa6\x73\xf2\x71\xb3\x34\x0e\x0b\x3e\xee\x52\xfe\x24\x41\x18\xa9\x8a\x3b\x8c\x69\x5a\x09\xe5\xb5\x05\xeb\x08\xd0\xe2\xbc\x1f\x89\x4c\xe1\xeb\x40\x38\x49\xc0\x32\x20\x32\x85\x29\xdf\x24\xaf\x1d\x8c\x6d\x60\x25\x2c\x09\x27\xff\xf8\xab\x4f\xb1\x50\xdc\x16\x02\x9b\x24\xb7\x2d\xd7\x1d\x43\xd3\x78\xa6\xe9\x9a\x80\xb9\x56\xc1\x09\xf4\x94\xb4\xa5\x23\x40\x5a\x24\xb4\x64\x3b\xe6\x0a\xcc\xaf\xf6\x0e\xea\xe6\x31\xac\xb0\x6d\xa9\x0f\xb2\x98\x24\xb4\xd5\x21\x4e\x09\xbf\x49\x4c\x45\x4e\x18\x63\x46\xde\x93\x43\x7a\x55\x46\x68\x5d\x35\x3f\xec\x40\xf0\xac\x63\xc0\x21\x31\x9d\x53\x80\x9b\xa5\x31\xa5\x9a\x05\xdc\x89\xf0\x9a\x70\x37\x3d\x90\x13\xb8\x76\x80\x7a\x9d\xa2\x84\xe5\x4c\x38\xa3\x69\xbc\x75\x14\x22\x73\x42\x99\xf4\xa4\xdf\x10\x33\xfa\x6c\xc0\x14\x5b\xf6\xcb\xbe\x46\xd9\xff\x66\xdc\xe3\x60\x58\x94\x6f\x43\xc0\x96\x93\x68\x67\xb5\xfb\x9f\xb7\x1d\x59\x12\x7c\x74\x86\x93\x38\x2c\x65\xe9\x3b\x19\x21\x12\xd8\x88\x81\x46\x6d\x2d\xaa\x81\xd5\x77\xbd\x90\x91\xd0\xfc\x17\x45\xf1\x02\x6d\xf8\x91\x0e\x91\x29\xd4\xe5\x2e\x7c\x87\x42\xc0\xaa\x30\xcc\x76\x6d\xac\xdb\xd3\x4f\x67\x0e\x8f\xd2\x08\x7d\xb1\xee\xa6\xe8\x32\xfc\xf0\x6f\xa1\x66\x0f\x2f\xf5\x71\xa5\x89\xbd\x15\xd0\xc0\x2c\x25\x90\xc9\x6c\x26\x87\x0b\x0d\x0b\x32\x7b\x68\xb4\x0d\x39\x7a\x63\xe6\xfd\xa8\x99\x30\x7a\xd0\x41\x32\x36\x23\xf6\x3e\xa3\xa8\xc3\x4b\x9a\xe2\x8c\x41\x16\xd1\xc2\x0e\xa6\x15\xe2\x9b\x05\x35\xdf\x7b\x97\x15\x1f\x06\xf7\x47\xfa\x1a\x38\xc0\xfe\xa5\x77\x19\xdc\xff\x6f\xc8\xef\xa9\xb7\x94\xb3\xef\x14\x1e\x8c\x5f\x65\x36\xdc\x6b\xb1\xb4\xfa\xdd\xdd\xff\x38\x4b\x4a\xa8\x14\x75\x78\x1d\xcc\x26\x28\x89\x65\x40\xe4\x08\x3d\x25\xe8\x74\x04\x68\x2f\x02\x76\x3f\x5d\xde\x8e\xb4\x9a\xcd\x7e\xc4\x93\x46\x4d\x01\x4e\xc3\x48\xeb\xa7\x52\xd9\x0c\x21\x9d\xf3\x19\x32\xce\xcd\xa4\x25\xa0\xab\x30\xc4\x76\x6d\x6c\x84\x2b\xec\xa2\xac\x83\x5a\x6a\xf9\x24\x68\x4e\x6e\xb1\xb4\x3a\x7f\x10\x6b\x61\x86\xa6\x73\xf2\x70\x4a\x58\xe6\x84\xb6\x0c\xcf\x7a\x6a\x8a\xcf\x49\x12\x42\x7c\x6a\xb6\x9c\xdf\x86\xbc\x02\xab\x08\xe1\xcc\xe2\x08\x96\x56\x9d\x21\xf3\xb5\xc7\xd0\x44\xde\x0c\xe0\xda\x88\x75\x33\x68\x11\xe8\x2a\x0c\xad\x5d\x1b\xbc\x0e\x32\xf1\xda\x2d\xf3\xc2\x1e\xfa\x2c\x94\x3d\x3b\x2f\xa4\x57\xdf\x78\x9f\x2e\x44\x2f\xff\x7b\x14\xa4\x5d\xca\xbc\xd2\x4f\x9d\x11\x7b\xfb\xfd\x74\x76\x80\x6b\x3f\x81\x6f\x6c\x8b\x30\x9d\xb4\x26\x2e\x16\x20\x60\x34\x4d\x80\x6f\xa7\x09\xd8\xb4\x28\x71\xdb\x72\xd0\xeb\x09\x36\x99\x05\x1f\xef\xfd\x76\x4d\xea\xda\xd7\xae\x12\x25\x46\x6d\x16\x36\xde\x07\x53\xa2\xcd\xf6\xd6\x77\x90\x3f\xea\xf7\x71\xbf\x72\x63\x59\x87\x96\x79\x87\x6f\xbd\xef\x49\x10\xab\xb4\x6d\x26\xf1\x12\xdb\x62\xc7\x66\xe9\xb9\x73\x4d\x93\x6a\x63\x56\xa4\x70\xcd\x58\x4b\xf1\x18\x1e\x93\x87\xc9\x9c\xc0\x53\xd3\x35\x5e\x6c\x20\x43\xb1\x46\xe9\x44\x1b\x66\x04\x55\x19\x3c\xbe\xf7\xde\x59\x90\xc8\xdb\x85\x6e\x13\xd6\x5d\x7e\x7b\xc6\x14\xbb\x14\xb1\x94\x30\xd2\x63\x05\x19\x5b\x4e\x0b\x6b\x04\xf1\x5d\xda\x29\x4c\x48\xe1\xd4\x04\x53\xc4\x27\xa6\x0b\x9b\x70\x92\x02\x59\xac\x06\x06\x84\xd8\xbf\xf1\xdb\x8e\x18\x7d\x30\x3c\xbc\x9f\x30\xe3\x94\x39\x0f\xb3\xb3\x1d\x89\xe9\xde\x4d\xc7\x1b\x61\xb5\x96\xd2\x48\x80\xb4\xcc\x9a\xe2\x33\x6d\x30\xbb\xa6\x88\x69\x10\x2c\x67\x42\x99\x54\x36\x4c\x9f\xbd\xaf\x48\x9d\x2e\x36\xb3\xb6\x2a\x69\xd4\x27\xee\x71\x38\xc1\xef\x0e\x8c\x23\x6b\xbf\x66\xc8\x4c\xeb\x22\xa0\x00\x27\x35\x1c\x83\xe3\x39\x58\x48\x1c\xb4\x40\x98\x10\xf2\x52\x4f\xd1\xa7\xef\x68\x5b\x77\x09\xa5\x9f\x93\x4f\xf9\x11\xb3\x2c\xf3\xd2\x7e\xf5\xc9\x57\xe5\x64\x08\x76\x6a\x82\xcc\x46\x78\x69\xe0\x04\x9f\xe1\xb6\x64\xda\xca\xa1\x1c\x33\xb0\x88\x16\x42\x0e\xe9\xd7\xba\x37\x3f\xed\xf5\x7b\x5a\x8a\x52\x39\xfc\x56\x36\x43\xc8\xe9\x83\xd4\x09\x22\x9f\xad\xcb\x80\x20\x39\xed\xa8\x18\xa5\x88\x43\x62\x4f\x49\x7b\x4c\xc1\x6c\x92\x27\xd4\x96\xcc\xbc\x0a\x5c\xa2\x84\x84\x10\xe5\xdf\x1e\x69\x63\xdd\x56\xa3\x94\x5f\x5c\x8a\xeb\xfb\x55\x47\xd1\x9b\x51\x93\xd6\x2f\x17\x4f\xd6\x7e\x2d\x8a\x04\x51\xe2\x27\xc4\x9f\xb6\x40\x91\x44\xa9\x7a\xa1\xcb\x54\xdf\xc1\x63\xa5\x38\xc8\x78\x18\x1c\x48\xdd\x30\x33\x1c\x4a\xe8\xb6\x18\x90\x2b\xd9\xf6\xae\x9f\x6c\xe7\x1b\xaa\xed\x7f\xf9\xd8\xb8\xee\xb2\x72\x8d\x1c\x43\xe6\x32\x27\x39\x4d\xa8\x9b\xb8\x1d\x0c\xa5\x8c\x4e\x02\xa4\x56\xc4\x8d\x61\x37\x66\xe2\xe4\x24\xd7\xdd\x1a\x11\x3a\x4f\x4b\xfa\x4a\x09\xee\xea\x91\xc5\xea\x26\x12\xc4\x93\x96\xf3\x01\xc0\xc7\x60\xd3\x6f\xf1\x22\xc4\x5b\x96\x36\x03\x06\x40\x7b\x50\xf2\xfd\xf7\xf6\x96\xbf\x34\xfc\xe0\x39\x00\x18\x77\x71\x6b\x7d\xca\x30\x3a\xca\x5b\x5c\xbc\xc1\x5d\x8d\x57\xd1\xd0\x16\xb1\xa1\xa3\x0c\x47\x5c\x00\xcf\x77\xaf\x3a\x5a\x02\xdb\x8f\x5a\xaf\x47\xe5\x41\xba\x54\x4d\x54\x63\xd4\x55\xa1\xdb\xbc\x03\xad\xa9\xbe\x64\x38\xcf\x5b\xd2\xa0\x39\x40\xd3\x1e\x01\x85\x0b\x43\x31\x51\x22\xe5\x38\x19\x80\xf5\xad\xed\x88\x64\x1d\x75\xf4\x78\x5c\xcc\x3a\x5f\x7f\x10\x49\xd6\x2a\xce\xe1\xdb\xfd\xa0\x62\x1b\x00\xb4\x4d\x88\x42\x61\xcf\x92\xfb\xc7\x9e\xe8\x7b\x18\x33\xde\xea\x15\x46\xa3\x9a\xf6\x96\x50\x35\x6a\x28\x23\x34\x08\xee\xa8\x8c\x75\x0d\xbd\x39\x5a\x07\xd5\x49\xbf\x80\x40\x5c\xb4\x1b\xb6\x1d\xe7\x92\xf5\xfb\xac\xda\xbd\x31\x64\x5b\x41\x69\xfa\x47\x5e\xc7\x85\xa9\x76\x44\x54\x5a\x13\xad\xbf\xeb\xa2\xf6\x34\x79\x79\xf8\x22\x78\x86\xff\x89\xba\xaa\x1c\x0c\x48\x2c\xf8\xf8\x99\x3e\x75\x64\xeb\x69\x53\x6c\x19\x75\xda\xe2\x03\x48\x20\x13\x03\xc0\x4b\x7b\xb4\x3a\xf8\xec\x9d\xb8\x35\x08\x7e\x28\x0a\xfe\x33\x26\x74\x54\x09\xc9\x70\xa3\xa7\x65\x59\xc3\xee\x22\x28\x92\x95\x6e\x96\xbd\x22\x18\xec\xc0\x4b\xd2\x9f\x28\x01\xdb\x97\x56\xc0\x12\x61\xe1\x39\x97\x6a\x24\x0b\x6c\xdb\xa0\xaf\xa5\x98\xe5\x90\xac\xf7\xcc\x81\xd5\xd5\xde\xbd\x67\x32\x65\xf7\xb1\x09\xb6\x4c\x10\x47\x46\xd5\x47\xdd\x43\xf9\x13\x5b\xb9\xd5\x07\xdf\x1c\x82\xc5\x83\x42\x66\x77\x71\xb8\xf9\x3c\x98\x16\x15\x2e\x3b\xb4\xff\xc1\xfc\xb0\xad\x1d\x37\x2b\x11\xd2\xc3\x66\xb6\x76\x44\xcc\xed\x96\x64\xc0\xb1\xba\x89\xa3\xf0\x52\x41\x42\x47\x84\x4f\xdf\x2c\x4a\x4b\xb2\x3c\x59\x7a\x44\x09\x48\xf7\x9f\xfb\x32\x49\x11\x49\x71\xa5\x4f\x57\x03\x12\xac\xda\x46\x47\xef\x84\xc6\xc4\xb8\x77\x5f\xee\xd4\x47\x18\x2b\x16\x1a\xed\x35\xa7\xe4\xa6\xce\x81\x0c\x62\x33\x94\x1b\xef\xef\xff\x54\xd8\xf0\x52\x29\x58\xa5\x27\x1a\xf8\xdc\x22\xce\xc3\x86\x68\xd6\xa3\x34\x8f\x20\xdb\x4e\xc3\x33\x9a\x12\x23\xb2\xe4\x89\x16\x86\x49\x21\x5a\xff\x62\x62\xe7\x65\x2e\x99\xcd\xcf\x0f\x92\xc5\xfe\x18\x55\x19\x7d\x55\xa4\x9c\x04\x5c\x62\xee\x44\x5f\x15\x4f\x85\x0b\x21\x87\xb2\x18\x45\x27\x7e\xd2\xcb\x47\xf1\x96\xe7\x17\x42\x84\xbc\x77\x07\x9b\x3a\x38\x6c\xe6\xd0\xfb\xd0\x67\x07\x48\x63\xcb\xee\x51\x00\xc5\x9c\xdb\xdb\x10\xb5\xdc\x65\x52\xad\x7b\x49\xf9\xaf\x40\x71\x7f\x4d\x23\x2f\x2f\x1a\x04\x89\x75\xa3\xe3\xeb\x4e\xb7\x63\xfa\x96\x51\x96\x59\xb6\x36\xe2\x02\xbc\x44\x25\x87\x93\xec\x2d\xae\x0f\x41\x27\x7d\x54\x48\x02\xcf\xea\x9b\x72\x66\xab\x30\xd4\x4b\x43\x11\x3e\x97\x79\x6c\x16\x05\x4a\xaa\xaa\x92\x78\xde\x45\x00\x7f\xd7\x03\xc8\x5e\x3b\xea\x2f\x95\x8e\xd0\x9d\xb5\xbf\xac\x5e\x4d\x3b\x04\x4d\xd4\xe6\xa1\x98\x73\x6f\x53\x59\x87\x6e\x09\xa3\x34\x49\x51\x70\x64\x68\x4c\xcc\xc4\xab\xd8\xc3\xdc\x23\x58\x2d\xf0\xa7\x8e\x8e\x29\xc8\xf2\x0c\x5e\xe6\xe4\x87\x66\x37\x4f\xd0\xde\xb1\x71\x6f\x58\xf8\x66\xb1\xf9\x0c\xf8\xda\x2b\xbe\xd9\x3c\x2c\x74\x94\x45\x5a\x28\x00\x69\x2a\x3b\xc8\x0b\x4e\x78\x42\x36\xbc\x82\xfa\xcd\x12\x54\xb7\xa3\xf3\x85\x65\xcb\x08\xca\x84\x32\x49\x7e\x54\xbe\xd7\x78\x70\xf0\x4e\x5e\x9b\xa6\xf7\x00\xb7\x83\xfc\x27\xa5\x18\x92\xf5\x4b\xd8\xb3\x3b\xb8\x8f\xc6\xf9\x9b\x3a\xea\x9d\xd0\xea\x60\x46\x2d\x59\x79\x3f\xa6\x4f\xa9\xd0\x5b\xa9\x71\x37\x66\x17\x14\x78\x7d\xc8\xfb\x4a\xbe\x0a\x4e\x99\x43\x0a\xf1\x12\xd5\x74\x8c\xdc\x00\x45\xea\xcb\xfa\x11\xc4\x28\x44\x83\xcf\x46\x1d\x8b\xc1\xe6\xd1\x1b\x83\xaf\x29\x80\x70\x75\x70\x3e\x1a\xf4\x1c\x24\x8a\xf3\x1f\xc3\xc1\xac\x16\x66\xf4\x12\x3d\x51\x08\x39\x74\xbf\x39\x1b\xbf\xdd\xc2\x6b\x3c\xd2\xc0\x59\x6c\x48\xab\x25\x1e\x58\x51\xf7\xf9\x87\x29\xb4\x39\x04\xad\x0e\x26\x33\x88\x55\xd0\xcb\x56\x90\x8a\xa5\x59\x99\x07\xb6\xf0\x97\x1d\xa0\x3a\x58\xfc\x19\x0e\xf8\x4a\x2e\xd4\x65\x44\xe3\x84\x71\x79\xce\x81\xca\x04\xd1\x54\x38\xfc\xf9\xef\x91\x58\x37\xe8\x63\xfd\x29\x62\x1b\xd4\xf5\x35\x08\x1b\x15\x36\x29\x81\x41\x6b\xf1\xaa\x90\x7c\x41\x66\x13\xd8\xa2\xf4\x7e\xc2\x2a\x55\xfd\xe1\x3a\xcb\xad\xe9\x99\x79\xad\x82\xa7\x70\x48\xd2\xd4\xb9\xe3\x79\x49\x19\x8f\x34\xbb\x0c\x13\x02\xe4\xaf\xcd\xf7\x10\x47\xc6\xaa\x3e\x84\x32\x95\xe8\xfd\x90\x10\x13\xd0\x9f\x8f\xed\xe7\x85\xe6\x76\x4c\x66\x21\xae\x0d\x40\xb1\xcd\xc2\x26\x6d\xc9\xa6\x04\xd1\x6c\x60\xe1\x4a\x83\xf1\xb5\x49\xa5\xb0\xcc\x89\x50\x26\xba\x58\x9f\x18\xce\x10\x96\xc8\x82\xf0\x93\xb3\xdd\x92\x5e\x59\x6c\xd9\x44\x68\xfa\x15\x06\x9f\x2c\xe2\x42\xc3\x76\x9f\x16\xba\x6f\x8e\x1c\xbd\x60\xf4\x64\xa3\xce\xf5\xca\x0e\x9b\xea\xe1\xbc\x39\xfc\x93\x5a\x28\xe1\x34\xcf\x41\x03\x94\x5c\x8a\xca\xd3\x90\x68\x2c\x7b\x8c\xdd\x25\x0e\x7c\x7d\xe4\xa4\x89\x51\xdf\xb9\xc2\xfa\x4c\x70\x31\x05\x9e\xd9\x34\xa5\x4d\x82\xd8\x05\xaf\xcb\x6e\xd0\x60\x71\x79\xf2\x51\x27\x28\x58\xcb\x02\xca\xba\xc9\xe5\xb2\xc1\xf9\x34\xf5\x17\x51\x56\xa4\x26\x43\x4c\xb9\x6b\x54\x29\xd9\x16\xee\x72\x29\x84\x4a\x37\x0e\x06\x3e\xf0\xe4\x78\xd9\xcf\x62\xb7\x43\x2f\x6d\xff\xee\x05\x08\xba\xd2\x8e\x2a\xca\x39\x52\x3f\x03\xa6\x1e\x13\xe7\x61\x19\x49\x22\x07\x79\x1e\x45\x13\xd8\x59\xdd\xeb\x0a\x6f\xcc\x8a\xd2\x07\xec\xf0\x97\xe5\x0d\xaa\x40\xf6\x63\x74\xe2\xa3\xe8\xe9\xe2\x37\x3e\xdb\x5f\xa7\xc5\x76\x73\x9e\x04\xc3\xab\xb3\x3e\xeb\xee\xc5\x18\xbd\xe7\x75\xfc\xd5\x4b\x9d\x18\xc1\xd5\x6b\x8e\xab\x5a\x4a\xf8\x07\x8e\xec\xc0\x0c\xa8\xe6\xf4\x83\xc2\x6b\xc2\x59\x25\x6c\x04\x42\xfc\x7a\x99\xad\xfd\x7a\x49\xc7\xe7\x34\xfc\x2c\x13\xda\x7a\xaa\x21\x7d\x6a\x74\xed\x9e\x3b\x80\x0c\xb5\x95\xcc\xe1\x4b\x46\xb4\x24\xfd\x36\x7f\x5a\x20\x80\x3f\xc3\x12\x51\x81\x6e\x2c\xd7\xfd\x50\xf3\xc3\xf3\x11\xe5\xb2\xbd\x26\x1e\xde\x47\x17\x54\x72\xe0\x60\xe9\xc7\x33\xa2\x91\xad\x82\x65\x47\xab\xce\xa6\xea\x54\x44\x07\x2d\x12\x64\x09\x80\x8e\x29\xd7\xcb\x14\xec\x9d\xe1\xa6\xf5\x54\x69\xee\x2d\x1b\xed\x9b\x23\x95\x30\x5a\xaa\x46\xdc\x9b\x98\xa9\x25\x50\x10\xa7\xf8\x24\xc4\xe0\xc4\x56\x70\x30\x1f\x64\x08\xe3\xf7\xe8\x22\xc0\xf1\x72\x4b\xb4\x23\x82\x80\x24\xce\x3a\x74\x5f\x2f\x9c\x47\xef\xd4\x6b\xcc\x10\xae\xce\x3f\xa9\xb0\x24\x35\x40\x33\x22\x56\x55\x72\x96\xa9\x13\x8c\x0b\x20\x63\x1b\xa8\xb4\x94\x38\x30\x84\xb1\x44\xb1\xed\xd9\x31\x78\x45\x77\xa0\x48\xff\xc7\xe6\xca\x3f\x2d\x30\x72\xf3\x70\x50\x16\xa1\x43\x11\x06\xeb\x83\x15\x1e\xea\xc4\x76\x40\x52\xb7\x5a\x0e\x45\xa8\x15\x77\x30\xa9\xb4\xae\x1a\xdd\x20\x82\xf6\x89\x0e\xc3\xc8\x23\xa1\x96\x60\x77\x19\x74\xa7\xf1\xd9\x06\xed\x8c\x11\x33\xcc\xdd\x61\xdb\xb3\x5a\x3d\x07\xd5\x41\x4e\xac\xb0\x15\x25\x09\x86\x63\xcb\xc8\xbd\x9d\x33\x5e\xe4\xe7\x0d\x50\xd0\x11\x8a\x58\x3c\xd8\x2e\x9c\xd5\xc2\x50\x65\xd7\xa2\xfe\xa9\x95\x8d\xa3\x25\xfa\x34\x11\xbf\xe1\xc8\x5d\xc5\x0b\x54\x91\xcb\x89\x90\x7b\x0c\x30\x18\xc5\x70\x98\x05\xbf\x85\x71\x96\x93\x19\x39\x20\x27\x07\x33\x0a\xf1\xb1\xe7\x35\x89\xa9\x8a\x80\xad\x39\xa1\x7a\x57\x62\xc9\x63\x93\xbf\x3e\xb2\xbe\xc6\x5e\xca\x3d\x08\x60\xe3\x19\x05\x1d\x33\x01\x20\x6b\xe2\xa4\xcf\x1a\x82\xe3\xef\xb9\xa3\xe5\xe8\x86\x22\xa5\xc2\xcb\x99\x88\xa8\xc6\xe7\xd7\x9c\x5c\xfa\x20\x61\xf6\xd2\x8d\x88\xd8\xfd\xf3\xd9\xbc\xd5\x5f\xa7\xe7\xb0\x55\x1d\x27\x6e\xb8\xbe\x48\xab\x1e\x83\x21\x03\xc0\xe3\x65\x1b\x30\xee\x92\x77\xd7\x79\x80\x99\xd3\xa3\xd2\x30\x0f\x72\xee\x27\x68\x16\x47\x01\xea\xee\x60\xa0\x63\xa6\x0e\xa6\xd0\x42\x6b\x94\x24\xcf\xe9\xda\x64\x48\x5f\xb6\x4a\x93\xc7\x14\x77\x6d\xdc\x21\xfd\x3b\xe7\xec\x15\x2f\xe4\xed\xd5\x9b\x0c\xa9\xa8\x53\xf2\xf1\x28\x53\xb2\x5d\x80\x62\xcd\x4e\x58\x4b\x57\x39\x47\xfd\xd7\xe1\x53\xa2\x78\xa5\x57\x9c\xb5\xfb\xfd\x7b\x2d\xb1\xc1\xd3\x10\x52\x79\xa3\x82\x71\xf6\xd4\x04\x6a\x37\xb9\xfd\x94\x32\x38\x11\xeb\x9b\x19\x15\x6b\x23\x06\xa0\x10\x62\xb9\x01\x79\xee\x65\x09\xe4\xff\x82\xb8\x64\xdc\x5c\xbb\x2e\x43\xf4\x49\x42\x1e\xa3\xd6\xbe\x7f\x18\x0c\x69\xf6\x18\xaa\x4b\x91\xf1\xd5\x63\x1c\xbd\xd9\x75\x8e\x7d\x13\x0e\x83\x1a\x5e\xeb\x75\xe2\x0b\xb1\x1b\xd6\x0b\x37\x1a\x5d\x3e\x7a\xa1\x47\x43\x5f\x73\x9f\x82\x56\x06\xd4\xeb\xe5\x30\x29\x6c\x5f\x49\xc4\x81\x4b\xf7\xb7\xdf\x30\x3b\x19\xf6\xf0\xc3\xfa\x6b\x0f\x92\x9d\x42\xcc\x5f\xcf\x6d\xe7\x3e\x5f\x2a\x2f\x6e\xa5\xe1\x77\x0b\x92\x38\xde\x64\xa8\x71\xf0\x80\x3b\xa5\x16\x41\x19\x49\x70\x1f\x58\xe8\x7b\x40\xd0\x66\x90\x12\x44\x13\x4c\x2a\xcd\x6a\x6c\x56\x1b\x43\x13\x83\xf1\xac\xfc\xfc\x51\x2e\xb7\x23\x31\x38\x23\x33\x99\xac\x84\xb6\xb2\x22\x9c\x56\xfa\xad\xc0\x00\x30\xd9\xe9\xc4\x50\x89\xca\xb4\xa4\xe0\xbb\xe0\x03\xa9\xe0\x9b\x74\xb2\x7b\x6a\xbe\x02\x3a\x1d\xf7\xc1\x1d\xfa\xb4\xad\xb5\x01\xd2\x23\x80\x21\x45\x13\xcc\x51\x9c\x98\x49\x10\xb3\x38\xb3\xca\xa0\xbb\x27\x75\x64\xc2\x60\x59\x2a\x3b\x31\x61\xb0\x3c\x50\x64\xdc\xd8\x41\xe3\x97\x1b\xca\x2d\x1e\x82\xc4\xe2\x31\xc2\x24\x41\xe0\xb4\x44\xcc\xf8\x86\xba\xc9\xea\x95\x64\x71\x62\x79\xa0\x58\xd2\x00\xfd\xc3\xd3\x54\xe1\xda\x7f\x1b\x7a\x6b\x52\xcb\x1b\x25\x6c\xf4\xbe\xba\x57\xc9\x9a\x72\x0e\x1a\xa0\xd5\x19\xf4\x23\xc4\xdc\x3e\x49\x2b\x05\x21\xb6\x11\x41\x48\xbb\x9a\x5e\x19\x6f\x56\x18\x2a\x44\x2a\x27\x2e\x31\x55\x53\x01\x79\x23\x96\xc3\x6f\xa7\x35\x62\xe4\x56\x30\x64\x29\x1a\x06\x84\xdd\xf6\x16\xd5\xed\xc9\x6f\x82\xec\x8f\x22\x9c\x14\xa7\x47\xe3\xb6\x98\x72\xe3\x70\xe0\x19\x46\xc8\x2a\x95\x24\x48\xd5\xe2\x43\xb1\xbe\x91\x20\x63\x5b\xcf\xdc\xef\xfe\x01\xa0\x9f\x93\x6b\x26\x17\xff\x1f\x02\x17\xdf\xb9\xea\x27\x26\xe5\x78\xd1\xaa\x10\x3a\x7b\xa1\x7f\x29\x23\x6c\x50\x1b\x36\xd1\xaf\xfa\x5a\xb1\x5f\xfd\x87\x23\xee\xde\x3b\xe2\x24\xe1\x2c\xb7\xc7\x54\x74\x8d\x19\x61\x66\xed\x51\xca\x05\x4b\x43\x35\xad\xcd\x5f\x92\x64\x0a\xc5\x2c\xce\x82\xb3\x84\xe3\x25\xe1\x0a\xd8\x70\xd0\x3e\x0d\x71\x32\xb2\x06\x9d\x85\xfe\x92\x9c\x0e\xc4\xe6\x9d\xb7\xe7\xfb\xe1\xcc\x8d\x80\x9d\x8e\x10\xaf\x60\x18\xda\x98\x74\x31\x18\xd7\xb0\x7a\x15\xa3\x0e\xfc\xaa\x1d\xd6\xad\xf7\x15\xac\x24\xcb\x93\x62\x44\x69\x58\xa2\x3f\x86\x4f\x64\xf2\x95\x21\x18\xe6\xf7\x29\x7a\xf9\xd8\x58\x4b\x21\xd1\x91\xd2\xdd\x1d\xd2\xd2\x76\xc8\xcb\xcb\x72\xeb\x56\x6a\xa9\xf1\xd8\x77\xaf\xae\x49\xb7\xd3\x1a\x11\xe0\x90\x81\x39\x18\xa3\x8d\xbe\x15\x10\xf2\xe0\x8d\x34\xef\xfc\x77\xb3\xb7\xfa\xb8\xbc\x09\x42\x6c\xd2\xd5\x13\xc0\x85\x0b\x1b\x6f\x12\xdb\x92\x68\xb5\x08\x11\x6d\x6d\x9c\x18\x0c\x08\xfb\x10\xde\x76\xa3\xd1\xdd\x5f\x59\xb6\xa9\xeb\xe9\x9b\xd8\xb8\xc8\xad\x78\x63\x27\x77\x0e\xcd\x3b\xbf\xd2\xba\xe1\xb7\xff\x16\x08\x35\x47\x48\xe1\x6d\x37\xba\x78\x3f\x8a\xf9\x02\x2f\x21\x9b\x43\xa8\x87\xb8\x20\x9c\xce\x1c\x71\xd0\x12\x3e\x00\x89\x14\x8c\x1c\x37\x61\xb5\x54\x22\xa8\x92\xa8\x2c\x72\x16\x94\xc1\xdd\x1a\xe8\x38\x4d\xc2\x22\xbf\x7c\x6c\xfc\x45\x1b\x23\xde\x2c\xe1\x2e\xe3\xeb\x49\x48\xd9\x57\xb3\xb7\xfa\xa4\xc3\xe5\x2e\x1f\x63\xa5\xe2\x38\xf2\x58\x7e\xbb\x36\x86\x8f\x60\xa7\x13\x8f\x4b\xe7\x55\x13\x60\xf8\xbc\x5c\x6e\x1f\x99\xb8\x03\x8e\x68\xb5\x3c\xdf\x35\x3e\xb5\xe6\xe0\x76\x9c\xd8\x59\x34\xc1\xfc\xa4\x0d\x34\x32\x2d\x65\xef\x13\xe8\x0a\x2d\xcf\xef\xdf\x15\x8d\x35\x26\xaf\x41\xd0\x08\x6b\xb6\x4d\x30\x29\xda\xe0\x71\xed\x63\xe3\x33\xda\x0b\xc1\xdb\x85\x17\x97\xf0\x7e\x2a\x17\x65\x16\xbd\x24\xba\x41\x5f\x51\xb6\xea\xb1\xab\xa5\x92\x50\x6f\x49\x71\xee\x3a\x31\x5a\x80\x00\x87\x8e\xcb\xbe\xe8\x7a\xfa\xe6\xe2\x3e\x1f\x38\x91\x13\x4a\x7b\x2b\xfd\xc9\xcc\xcc\xdc\x2d\x8b\x64\xca\x23\xe5\x50\x9d\xa4\x40\x51\xda\xbe\x0f\x92\x01\x5e\x9c\xa9\xdf\xbe\xb7\xc4\x1c\x33\x24\x18\xc2\x8b\x51\xf9\xb8\x76\xf7\xa9\xa9\x81\x7a\x88\x90\x20\xa0\xd0\x95\xc0\xdd\x4f\x99\x4d\x1a\x2c\x3b\xaf\x2e\xde\x8f\xe8\x66\x9e\x8a\x69\xbd\x02\xb6\x60\x23\xd6\x86\x2d\x11\xcf\xe7\x31\x18\x44\x3c\x26\xd8\x0f\x2b\xa9\x5e\xa7\x63\x2d\xdb\x3f\x4e\x2b\x15\x07\x3e\x82\x2f\x32\xa7\x50\x99\x56\xe0\xd0\x2f\xf8\xcb\xad\x96\x08\xe7\x10\x66\x17\x7b\xe6\xeb\x9b\xd4\x57\x4c\x11\xd5\xfc\x9d\x32\x7a\x07\xd8\xc0\x61\xd3\xda\x89\x0d\x26\x24\x1c\x78\x19\x2a\xa2\xf4\xcb\x2e\x72\x46\x25\x10\xd2\xae\xe8\x63\x07\xa2\x86\x93\x51\xca\x58\x5c\x88\xcd\x26\x6b\x5e\x1a\x52\x66\x5f\x91\x62\xff\x19\x49\x81\x00\x88\x61\x24\x5b\x06\x31\xc7\x0c\x4b\x64\x8a\x95\x81\x93\xbd\xe3\x5c\x92\xb1\xbc\xc6\xfb\x68\xf5\xf5\xf2\xa4\x4b\xc1\x85\xbf\xf1\x39\x9f\xe1\x8b\x06\x60\xac\x4e\xec\x10\x02\xe5\x1a\x6f\xa3\xc6\x7e\x5c\x00\xe3\x0f\x6c\x52\x31\x6e\x48\x97\xa5\xf1\xe3\x32\x3d\x44\xc5\xd8\x2a\xc9\x29\xf5\xac\x36\x68\xb5\x22\x46\x15\x6b\xd2\x9e\xac\x2b\x2e\x6b\x2a\xec\xb7\xa9\xbe\x89\x51\xf4\x45\xd2\x60\xcf\xf4\x63\x40\xd8\x49\xda\x2b\x67\x0c\xf4\x6e\x3b\x78\x00\x1b\x77\xd8\xfe\xec\xca\xd2\xec\xac\xf1\xf1\x92\x80\x5d\xa9\xba\x90\xf1\x8e\x8e\x8e\x54\xf4\xb8\x1e\xa4\x73\x5e\x29\xfb\x11\x4c\xc9\x11\x4c\x7a\xa8\x38\x68\xc3\xd3\x16\xb0\xfd\x26\xca\x4a\x2c\xfc\x3b\x4d\xa0\xd1\x77\x90\x3b\x33\xa1\x19\x7d\xbf\x11\xe2\xd3\x91\x8a\xa2\xc9\x93\x9c\xf8\xa6\xdc\x98\x4a\xcc\xb9\xc9\xc1\xc9\xd3\x8c\xce\xc6\x9e\x4d\x60\xc4\x24\xe3\x67\x83\x81\x4b\x27\x0c\x53\x1b\xc0\xa1\x01\xa5\x1d\x3d\xc6\xad\x9a\x74\x1b\x5a\x9f\x29\xb7\xf1\xa6\x4f\x99\x5f\x0f\xfb\x01\xca\x63\xfb\x4e\x53\xc8\xe7\xb7\xc4\x95\xfd\xd8\xad\x00\x78\xbe\x78\x6c\xac\x05\x5b\xd9\x66\x3d\xdd\xa1\x47\xfe\xc4\xc9\x3d\xcc\x9d\xd4\xc7\x96\xbc\x42\x64\x6f\xba\x3d\xbf\x7f\x13\xe1\xe9\xbd\x72\xcc\x55\x67\x3d\xa4\x9e\xac\xf5\xa3\xb6\x24\x9d\xcd\xdc\x6c\x4f\xa5\x5d\x92\x2a\xbf\x42\xaa\xe3\x4d\x82\xcf\x97\x31\x73\x30\x88\xc2\x78\x39\xa8\x47\x96\x61\x46\x65\x5d\xc5\x7a\x77\xaf\x37\x99\xf5\x7c\x45\xb9\xc9\x5c\x14\x11\xde\x82\xe2\xc6\x04\x10\xe6\x14\x60\xea\x21\x6b\x21\x48\x0d\xe5\xe7\xdd\x8f\x94\x39\xc5\x1f\xf7\x87\x62\x1b\x48\xe4\xaa\xc4\xec\x6d\xdc\xf5\xd1\x32\x41\xe5\x92\x7e\x16\xfe\xfe\xa8\xed\xf4\x18\x9c\x4e\xb3\xe4\xe2\x2f\xb0\x11\x8d\x4f\x07\x06\x95\xe8\x3c\x7e\x9c\x1e\xcf\x81\x90\x1b\x68\x27\xf3\x0c\x55\xfa\x96\xe5\x63\x27\x9a\x35\xf3\x19\x75\x98\x83\xea\x3e\xc7\xfc\xf0\x8b\x36\x66\xde\x7b\xe9\xf0\x90\xa9\x6c\x8f\xbc\xcb\x8c\xaf\x36\x38\x74\xc9\x42\xb2\xb4\x61\x5a\xf5\x83\x69\x65\xf4\xb0\xbd\xb3\xb6\xe6\xae\xa4\xc5\x5a\x08\x32\x13\x7f\x32\xd6\xd5\xa9\x98\xb0\xa1\xc9\x2c\xe3\xd1\x62\x20\x77\xbc\xb6\xd8\x41\xbb\x5a\xde\x65\xc6\x4f\x37\xf8\xbc\xe4\x75\x42\x40\xfb\x1b\x59\x84\x19\x97\x22\x7f\x55\x5e\x5c\x66\x63\xbd\x03\xd2\x5f\xc5\xe7\xe9\xdd\x91\x6f\xd6\x68\x1e\x24\x8e\x89\xee\x51\x7a\x7c\xfd\x77\x2d\x3c\x6a\x13\x97\x69\xf6\xdc\x67\x8c\xf6\xbe\x43\x98\x72\x72\x1f\xac\x40\xc1\x73\x3d\x64\x3c\xb2\x0f\xea\x13\xd0\x4b\x68\x3b\x74\x87\xa2\x56\xca\x5a\x6e\x8f\x09\x84\xbc\x1d\xb2\xc9\xcb\x58\x8f\x9d\xc7\xe2\xb5\xdd\xa8\x24\x9c\x95\x6c\xe6\x23\x6e\xa4\x47\x59\x07\xcd\x89\xe1\xa5\x06\x99\x33\x6d\x70\x50\xdb\xc1\xfa\x84\x58\x7a\xb8\x0d\xda\x0c\x23\xea\x65\xbf\xfa\xb6\x98\xb0\xf8\x5f\x0e\x8e\x79\xe7\xbf\xa3\x56\xd4\x8e\xc9\x23\xcb\x3f\xe6\x9e\x92\x4d\x09\x81\x7a\x4d\x01\x0f\xc9\x92\x65\x71\x93\xc7\x6f\x75\x18\xd1\x63\x4f\xc2\xce\xeb\x66\x98\xf9\x84\xb8\xc8\x97\x0c\xf3\x62\x03\x34\x18\xdf\x94\x0f\x5a\x87\xa8\x0e\x55\x73\x43\x90\xc5\x55\xc6\x5e\xb4\x98\x1b\x32\xbf\x3b\xaa\xb7\x6f\x08\x46\xd2\x4f\xb0\x3c\x7b\x3f\xbc\xec\xca\x38\x59\x0f\x94\x15\xb9\x33\x5a\xfa\x07\xc6\x36\x35\x2b\x1f\xd4\x43\x36\xe0\x8b\xf8\xaf\x87\x8c\xbc\x32\x2c\x07\x20\x61\x9d\x44\x87\xc5\x8a\x76\x98\xba\xf3\xfb\xc8\xc0\xa3\x63\xcc\xf9\x81\xe1\xf3\x3a\xe6\x07\x21\xfd\xf8\x0a\x41\x7b\x7f\x97\xee\x35\xb6\x59\x4f\xa9\x18\xb5\xc0\xc4\xeb\x91\x4c\x6c\x72\x06\xe1\xb0\x32\xb2\xcd\x3c\xaa\x31\xc1\xbe\xc0\x61\x79\xf0\x20\xaf\xf1\xa3\x48\x6f\x4d\x91\x73\x1f\x2d\x0a\x3e\x7e\xb9\xd5\xda\xca\xe5\x8f\xeb\x68\x91\x2f\xdd\xa9\xa0\xe6\x1e\x4f\xab\x78\xc5\x14\x2f\x94\xdc\xb8\xd9\xb6\xc1\x12\xbc\xa8\xe2\xc4\x98\xb3\xc4\x0b\x97\x82\x7b\x8c\x93\x5e\xd7\x16\xe9\x23\xf3\x85\x43\xe1\x3d\x56\x69\xbe\x44\x4e\x70\xa1\x00\xe9\x26\xc0\xd4\x34\x36\xee\x36\xd8\xae\x90\xb5\x49\x38\x0c\x7b\x96\x2e\x61\x05\x35\xac\x47\x47\x1c\xf9\x34\x84\xb6\xa0\x5b\x3b\x1c\x25\x5e\x91\x79\x86\xaa\x2d\x0a\x97\xbb\xd0\xaa\x18\x59\x29\xc9\x15\x08\x2a\xcc\x5c\xca\x1b\x27\x63\xcd\x66\xe7\x70\xe1\x83\xf6\x2b\x43\x46\x79\x61\x87\xf3\x4c\xf9\x81\x4c\x01\x21\x2f\xa0\x05\x42\xda\xd5\xc5\xfb\x51\x8b\x7c\x89\x35\x29\x46\x27\x26\x85\xf5\xc4\x0e\xc3\x9e\x65\x65\x77\x1b\xfd\x09\x7b\x06\x4f\x6c\xfd\xc3\x23\x70\xdc\xf8\x4f\x3a\x87\x5a\xbb\x5a\xb4\xb6\x3b\x15\x5e\x9d\xe3\xb4\x1a\x16\xad\x59\xbb\xce\x76\xb5\x57\x3e\x43\x51\xee\x04\x63\x43\x19\xcc\xae\xa5\x58\x63\xe5\x81\x0e\xa6\x6b\x82\x6e\x7a\x62\x0f\x94\x35\x28\x9f\x71\x3b\xb9\x6c\x7f\xe1\x2e\x48\x3f\xfe\xdc\x79\x8b\x6b\x19\xce\x29\x98\x84\x86\x58\x17\x49\xaf\x6c\x51\x52\x91\x6a\xa1\x6b\x8b\xe1\x97\x4a\x91\xf4\x4f\x3d\x1c\xbf\xa9\x0a\xd9\xa9\x4d\x23\x88\x49\xaf\xd9\xcf\xd2\xad\x70\x9c\xe2\x14\x1e\x2d\x53\x57\x31\x56\xaf\x80\xb5\xe4\x0e\x54\x45\x17\x3b\x1b\x20\x4c\x63\x37\x98\x8d\xe7\xca\xf7\x50\xdf\x1a\x1c\xa9\xae\x83\xca\x5f\x8b\x8c\x9b\x1e\xc7\xd3\xc3\xef\x71\x70\x27\xb0\x75\x44\x4d\xb5\x20\x99\x53\xe7\xd5\x87\x60\x76\x44\xf7\x3c\x60\xb6\x4e\xb2\x6a\xea\xb0\x27\x4d\xa5\x37\x58\x67\xb2\x60\xd9\x78\x80\xfa\xeb\x46\x1d\xf5\x0d\x6e\x22\xe2\x96\xa9\x4d\x4d\xfc\xdc\x63\x10\x0b\x93\xf2\x98\xd6\xf7\x68\x32\x00\xdb\x2f\x6c\xd4\x21\xac\x37\xca\x44\x06\x44\x45\xce\x71\xda\x14\x77\x4c\x67\x27\xa3\x9c\x23\x4d\xc6\x67\xc9\x27\xec\x79\xb7\x45\x6d\x8d\xd7\x47\x21\x75\xc9\x68\x46\xad\x62\x7d\x7f\x6b\x46\x00\xb3\x89\x6e\x70\x0d\xff\x0a\x17\xac\xed\x9b\xb0\xf2\x6a\x75\xc2\x53\x7d\x9a\x85\x6c\x14\xb8\x76\xe9\x98\xa3\xcf\x49\x4e\x2d\xd2\xb2\x40\xf6\x19\x25\xdd\xe7\xb9\xc7\xdc\x44\x54\xba\x7b\x81\x47\x79\xe3\x2f\x06\x92\x26\x93\xcb\x79\x6a\xef\xa3\x87\x36\xe5\x0b\x87\xdf\x55\x7f\xae\x9a\x1e\x62\xaa\x03\x1f\xdf\x47\x32\x3e\xd6\x3f\x4c\x6f\x7e\x72\x5e\x15\xdb\x5f\x9e\xcb\x2d\xed\x26\xce\xbe\x78\x56\xa6\x10\xce\xc6\xed\x4e\x7b\xc4\x40\x5c\x63\x3f\xd5\x5e\x0d\xf0\xe0\xe1\x77\xe9\x64\x44\xfb\x40\x11\x9a\x1a\x03\xe7\x65\x83\x5f\x61\xdc\x64\x36\x1d\xd5\x9c\xcc\x60\xc0\x4d\xb4\xe8\x23\x48\xc5\x31\xdd\xe7\x06\xa0\x0c\xad\x13\xfc\xe4\xfd\xcf\x48\x72\x72\xd3\x3b\xb2\xa7\xaa\x02\x70\x39\xbc\x7a\x40\xb9\xec\xc0\x27\x13\xdd\xc1\x4d\xa0\x54\x55\x67\xde\x1f\xa1\x33\xab\x07\xe9\x9d\xbc\x3f\xa2\xb8\x55\x60\x1d\x9a\x79\x8a\xe4\x6b\x20\x1c\x79\x6c\x18\x9c\xd4\xba\x8b\x8b\x4f\xf6\x5c\x2a\x85\x7e\x29\xb9\xf8\x52\xd6\x35\x98\xa4\x8f\x30\x25\x98\xeb\x81\x26\xd8\xe5\x39\x4e\xab\x62\x1d\x41\xfc\x18\x15\x70\x78\x71\xdf\x16\x19\xec\x81\xf0\x23\x61\x46\x87\x9e\xfb\xa9\xd4\xc9\xbb\x74\x3a\x76\xea\xc6\x1c\xbc\xfc\x9c\xd3\x66\x18\x39\x4a\xd5\xd1\x51\x53\x19\x34\xe1\xa5\x2d\xee\x5b\xcc\xb4\x09\x3b\x9c\x77\x3a\x81\x4e\xee\x35\xe5\x56\xee\x07\xdd\x86\x61\xd3\x74\x67\xf8\x0d\xd3\x9c\x23\x72\xca\x99\x24\x4f\xf5\x7e\x46\x08\x35\xd6\x08\xd2\x4b\xcc\x3b\xb8\x2a\x18\x93\x35\x83\xf4\x6e\x40\x44\x2f\xe0\xeb\xe7\xa1\x58\xdf\x39\xf8\x5f\xf3\x27\x32\x44\x61\x89\x8a\xa9\x85\x5a\x74\xaa\x4c\x5e\x7f\xda\x44\xe0\xb9\x1f\xba\x1c\xb1\x4d\xd8\x97\x0d\x40\xe7\x5a\xda\xcd\x45\x56\x50\xc3\x6a\xc2\xfe\x7a\xde\xf9\x91\x14\x94\xb2\xbc\x4b\x79\x65\xa9\x6a\xe1\xf9\xf7\x88\x5b\xc1\xd0\x32\x93\x1e\x11\x66\x8e\x43\x70\xac\xf3\x5f\xd8\xfa\x58\x6c\x82\x7d\xd4\x89\x24\xa7\x8e\x10\xe7\x77\x7e\x1e\x62\x6e\x07\x3e\x7b\xa6\x9f\xda\xac\x0e\x39\xf7\x25\x15\x3f\x49\x37\xf6\xd4\xd2\x7c\x3f\x7b\xab\xaf\xfb\x78\x62\xd0\xbe\x1d\xc9\xe1\x1d\x99\x17\x3c\x5a\x67\x8b\xce\x1a\xac\xab\x4f\xe4\xba\x3f\x15\xb1\xcd\xad\x07\xf8\xf3\x98\x6d\xa2\xd3\x3d\x2f\xf8\x95\xa9\x85\xe7\xf9\x98\xf5\x84\x11\xfc\x68\x84\x9f\x4b\xa0\x80\xb2\xc1\x2b\xda\x00\xd9\xc2\xa6\xa4\xa5\x8b\x0a\x1a\xed\xcb\xbb\xa3\x54\x4f\x05\xca\x6c\x7a\x6d\xcb\xe9\x67\xa6\x0e\xc4\xc2\xb4\x80\xc6\x4f\x47\xf2\xc5\xa6\xa1\xf2\xe1\x7e\xd8\xdc\xf6\x3f\xe7\xe3\x4f\x27\xce\x71\x68\x70\xd1\xc0\x20\xbf\x5d\x45\x4f\x9e\x61\xf2\x8c\xea\x63\xe7\x5d\xfa\x76\x49\x4e\x57\x42\xd8\x19\x4e\x54\xe4\xbb\xce\x3f\x35\x73\x45\x45\x55\xa4\xb7\xdd\x16\x89\x1b\xae\x3b\x31\x82\x24\xb9\xbe\x77\xf9\xe2\xf3\xa9\xb4\xcf\x3f\x62\xb5\x94\x57\x52\x6e\xb6\x87\x57\x07\x17\xbe\x87\xf5\xdc\xdf\x0d\x17\xd5\xff\x65\xca\xf7\x38\x2e\xda\xcc\xab\x37\xc2\x02\xac\x6d\x90\xeb\x53\xcc\xf0\x79\x49\x67\x6d\x81\xf0\xc4\x18\xc4\x2e\xe9\xfa\x4c\x86\xcf\x2f\xb9\x69\x4e\x25\x27\x76\x2b\x13\x36\x0c\x6e\x1a\x9a\x36\x73\xa1\x86\xa2\xce\x06\x6d\xff\x54\x55\xaf\x79\xdd\xa3\x9b\x82\xa1\x54\xcc\x98\xe3\x03\x14\xc5\xc1\x2f\xf2\xce\x7f\x9e\xe9\x73\x3f\xf1\x2e\x27\x35\x97\x4f\x7e\x92\xef\xb7\xf7\x59\x14\xe7\x78\x35\xfb\x79\xbb\x95\xd7\x16\x53\x63\x34\x04\xbb\x31\x1c\x92\x21\xfa\x9c\xaa\x28\xe7\xa0\x05\xab\x4f\x1f\x5d\x17\xb0\x7c\x65\x77\xfa\xfd\x14\xdd\x3c\x6e\xb4\x3d\x76\x2e\xfd\xf5\xe0\x56\xd8\xb4\xce\xa2\x78\x41\x7f\x8c\x36\xfa\xdc\x33\xd0\x93\x57\x6f\x5f\xa9\x09\x8d\x24\xb9\xfb\x2e\xe2\x18\x5d\xab\xc7\xb5\xa2\xd4\xcf\x4a\xce\x77\xea\xb8\x2b\x59\xb2\xf0\x1f\xad\x8e\xbb\xc5\x0d\x1d\x7b\x55\x43\x9b\x35\xbb\x72\x22\xbc\x58\x94\x8b\x96\x81\x01\x9f\xeb\x5a\x1f\xdc\xdc\x8d\x0e\xed\x4e\x52\xfd\x50\x19\x60\xc6\xab\xcb\x3e\x6e\xef\x77\xc1\x2b\xf2\xc7\xac\xf3\x22\xa3\xd1\xc6\x3d\x65\xa7\xc3\xb6\xc3\xfa\xcd\x58\xe6\xf5\xb3\x25\xb0\x67\x2b\xe1\x97\x47\x44\xaa\x31\x71\x8f\x1d\xb1\x81\xfc\x4b\x24\xa3\xc9\x8c\x72\xce\xb6\xcf\x6e\x91\xc1\x6a\xf5\xf7\x2a\xa6\x1a\x34\xbf\xd4\xd0\xcc\x01\x69\xf0\x13\x01\x16\x5d\xfa\x34\xe7\x15\x59\x3f\x31\x38\xfd\x63\xf6\xf1\x2b\x7e\x9f\x72\xb8\xd1\x71\x73\x67\x99\x22\x8f\xde\x33\x46\xf5\xcd\xa5\x5b\x0e\xcf\x05\xc4\x04\x4f\x66\x8c\x0c\x7c\x98\x07\x03\x5f\xab\xae\xec\x86\x27\x28\x54\x99\x71\x36\x69\x7d\x6d\xdd\xd4\x14\xbd\x50\xb3\x17\x80\x6d\xd0\xd7\x35\x34\xea\x56\x97\x2d\x2e\x07\xc6\x46\x4c\x27\xa8\x6a\x3b\xd3\xa2\x76\xa6\xe3\x5d\xb6\xfc\x5f\xf0\xbb\xff\xbf\xcf\xb1\xea\xda\xda\xed\xed\x68\x65\xdf\x14\x62\x28\x86\xf9\x8d\x0e\x25\xa4\xf1\xe1\x58\x86\x9d\x62\xd0\x6a\xc3\x37\x32\xd6\xd2\x09\x51\xc1\xd0\xc4\x5e\x65\xa6\x60\xd1\x5b\xc2\x15\xac\x32\xd7\x4b\x53\x55\x28\xb2\xf8\xf0\x48\xd2\xb6\x98\xe8\x68\xf7\x5c\x91\x80\x95\xc9\x63\x34\xd4\xd0\x66\x1b\x01\x86\x28\x86\x81\xb6\x59\x04\x4c\x68\x2d\xe8\x93\x24\x51\x10\xe0\x50\xbb\x52\xf8\x2a\x0d\x21\xe4\x1e\xb6\x19\x49\x7a\xa4\xb1\x35\x70\xeb\x26\x16\x67\x9e\x69\xfd\x1d\x4e\x9a\x73\x63\x40\xd8\xef\x5a\x2b\x7e\xd5\x99\x10\x17\xf1\x58\xd2\x6a\x23\x97\xdb\x71\xd8\xc2\xee\xae\x48\x6c\xbe\x0e\x43\x13\xeb\x72\x95\x40\x0b\x05\x21\x6e\x13\xd9\x16\x4a\xc9\x0f\x08\xbb\xa1\x90\x58\xf6\xca\x59\xd6\xa6\x49\x0b\xf1\xb0\x7d\xd4\x1f\xe3\x91\x70\x5b\xa1\xc0\x37\x41\xe1\xbf\x4b\xdb\x05\x8c\xd3\x92\x56\x1b\xe9\xe3\x06\x50\x9c\xb8\xf1\x39\x3a\x3b\xfe\x20\xf8\xef\xb0\x5a\xdc\x98\xe8\x68\xca\x99\xa6\x15\xa4\x41\x2a\xba\x4f\xe7\x19\xca\x3f\x08\x5f\x35\xce\xa4\x22\x60\x34\xc8\x3f\x49\x1c\x93\xad\x0c\x9c\x3e\x41\x31\x01\x04\x94\x6c\xe3\xe7\x1d\x85\x06\x1b\x5a\xb7\x99\x35\xb8\xbb\x2f\xb6\xd3\x22\x00\x52\x34\x91\x8e\x10\xd1\x02\x45\x50\xac\x2f\x5d\x21\x22\x64\x31\x53\x30\xbf\xc3\x27\xb4\x2f\xf5\xb2\x3d\x54\x47\xcc\x4d\x50\x92\x92\xb8\x56\x41\x9f\x44\x34\x88\x00\x87\xde\x29\xa1\xe3\xbb\x50\xb2\x2f\xc8\xda\xb4\xca\x33\xef\x57\x44\xf1\xa4\x46\x89\xa1\x1f\x78\x2b\x1d\xa8\x0d\xfa\x4f\xf2\x39\x36\xab\x0d\x1e\xff\x08\x2d\x54\x38\x9f\x1e\x8d\xb3\xd9\x2a\xbc\x08\xb2\xa8\x2b\xd8\x32\xb2\x53\x6e\xb3\x28\x1d\x21\xf6\x86\x02\x86\x36\x46\x38\x23\xf1\x96\xca\xfd\x4a\xb6\xe9\xa2\xbd\x60\xe8\xa5\xe2\x3c\xd3\xa3\x71\x55\xb2\xb6\x71\x4e\x01\xd8\xbd\xff\x3f\xa8\x3a\xd3\x47\x3e\x2a\x89\xe3\x33\x1c\x44\x84\xdf\x20\x2a\x18\x8c\x18\x06\x50\xac\xb3\x92\x6d\x42\x11\xaf\x4f\x42\xfc\x52\x23\x86\x80\xd7\xe1\x6d\x67\xb7\xf7\xfb\x15\x32\x23\x66\xa6\x50\x5a\x9a\xef\x27\x13\xff\xf1\x41\xe7\x86\x14\x22\x11\x0e\xbe\x51\x77\xdd\x1e\x29\xfd\x05\x87\xfc\x2c\x50\xcf\xcf\xbc\x0c\xc1\x77\x9f\x49\x15\x88\x46\x1d\x5b\x88\x84\x0e\xa5\xf8\x70\xc9\xfc\xc0\x30\x23\xee\x7b\x76\x76\x4c\x11\xbb\x4b\x42\xad\xa8\xed\x16\xe3\x10\x6d\x15\xdd\x34\x0f\xd1\x9a\x4f\xf8\x44\x0e\xbf\x54\x22\xa8\xfc\x46\xa2\x42\xf1\xdd\x5f\xd8\xef\xae\xb4\x1c\xb6\xbc\x9d\x7b\x3c\x8d\xb5\xca\x98\x7b\x35\x1e\x93\x10\xd5\xd0\x2c\xe1\x7f\x89\x34\x0c\xdb\x19\x0c\xfa\xc5\x5f\x4c\xfa\x89\x6f\xe5\xb1\x7c\x8e\x26\x70\x91\xac\x60\x18\x38\xd8\xd0\x9a\xd7\x2f\x02\xa1\x90\x35\x1a\xb0\x4f\xc0\xe6\x10\xa4\xec\x2d\xbc\xed\x06\x51\x8c\x6e\x34\x93\xfb\xba\x90\xfb\x8a\x58\x07\x51\xc1\x08\xad\xe1\x6b\x9c\x3d\x13\x24\x48\xc7\xbb\xab\x90\x62\x02\xc4\xac\x29\xd4\x55\x0b\xd4\x5b\xa2\x64\x02\xc7\x4a\x47\x48\xe2\xf7\x41\x84\xac\x29\x14\x8b\x29\xe1\xfa\x7b\x76\xab\x49\xff\x74\x7e\x3b\x70\xd0\x10\x2e\x72\x66\x9d\xc1\x38\xe1\x9f\x84\x14\x0a\x60\xea\x3d\x7e\xd5\x92\x99\x29\xd4\x17\x67\x84\xe4\xbe\x26\x98\x44\x3f\xdc\x44\xe7\xad\xc5\xe3\x7f\xbe\x0d\xc7\x64\x8d\x9a\x56\x4e\x9c\xa1\xcc\xf2\xbf\x1c\x1c\xa1\xa8\x53\x2b\xf6\x8c\x89\x4c\x0b\x44\xf2\x20\x71\x90\xc8\x11\x13\x1d\x25\x35\x5e\x66\xaf\x02\x25\xa5\x62\x08\x49\xaf\x8b\xf7\x63\xc1\xe3\xc7\x6f\xff\x26\x77\x93\x89\xf7\xac\x39\x8f\x09\xf4\xc3\x2b\xe1\x6d\x67\x5b\xbb\x3b\x3a\xec\x7f\x80\xfe\x11\x23\x51\xd1\x72\xc2\x8e\x09\x4d\x61\xa4\x36\x06\x2d\x41\x42\x6b\xc0\x28\xce\xd3\xdc\x64\x90\x22\x28\xd6\xe1\xe2\x62\x5f\x62\x33\xaf\x7a\x1b\x8c\x2a\x7b\x54\x74\xa4\x67\x32\xf1\x07\xc4\x68\xe2\xd9\x84\xca\x32\x38\x64\x4c\x64\x1b\x7b\x08\xd2\x66\x89\x88\x99\x0c\x65\x69\x81\x84\x72\x0c\x53\x84\xa1\x8a\xf1\xdd\xe4\x5b\xa1\x92\xbc\x55\x49\x4d\x12\x5f\x0a\xe1\xb1\xc3\xa7\x16\x5a\xa8\x90\x12\xaf\xf3\xc1\x6b\xe9\x50\x5c\xc1\x2f\xfa\x59\x35\xd6\x11\xe3\xb8\x02\xd0\xca\xdd\x10\x3d\xd9\x9b\x00\xe6\x8a\xc5\x33\x12\xda\x20\xb1\x7f\x15\x51\x27\xc9\x6d\x80\x7e\x69\x15\x43\x48\xbb\x5e\xfc\xfa\x14\x6e\xa8\xfe\x96\x7e\x5f\xbe\x65\x26\x5e\xb2\xfa\x31\x75\x6a\x86\x92\xb9\x79\xb2\x26\xc9\x70\x4c\x64\x7b\xb9\x00\x98\xb3\x28\x94\x7e\x83\x57\xfd\x4a\x37\xfa\x1f\x4e\x81\x97\xab\x7c\xce\x98\xa4\x78\xd4\x7c\xc0\x4b\x0d\x33\xba\x1a\x18\x20\x49\x12\x10\x6f\x6f\x2f\x9e\xc3\x06\x55\x88\x83\x05\xc6\x65\x52\x48\x4b\x70\x79\x3b\x2c\xaf\xaa\x61\xca\xd9\x02\x90\x88\x16\x40\x83\x81\x87\x26\x97\xf1\xd3\xaa\xb5\x60\x19\x60\x05\x2f\x29\x31\x43\xb0\xf9\xa5\x12\x63\xad\xfe\xbe\x06\xa1\xb5\x1e\xb6\x09\xe6\xd3\x99\x84\xb8\xb6\xc0\x46\x5c\x54\xd8\xf9\x44\x0c\x21\xed\x2f\x83\x54\xcf\x16\x8d\x99\xb9\xe4\x6c\x02\x71\x1c\x6d\xc6\x08\x1d\x13\x1e\xfe\xe2\xfc\x0f\xf9\xe5\x18\xb9\x79\x2b\x1d\x5b\x28\x92\x81\xe1\xb3\x9d\x25\xa8\xe7\x03\xf7\xc6\xd6\x8d\x5e\xca\x7b\xd0\x2c\x69\xd8\x48\x72\x8d\x46\xb6\x48\x67\x4e\x2f\x6a\xee\x78\x4a\x8e\x23\x14\x08\xce\xab\xaa\x38\x5e\x51\x59\x59\xd0\x3e\x6a\x03\x3e\x1f\x04\x46\x1d\xc4\x2b\x1c\xff\x4c\x93\x9d\x16\x10\xee\x16\xb6\x71\xc5\xa4\xaf\xd5\x86\x31\x81\xa4\x71\x89\xe2\xe7\xf2\xab\xcc\x4b\x45\x8c\x55\xc1\xc9\xca\x05\x5b\x2e\xff\xe1\xf1\xb5\xbe\xb9\x4f\xa9\xb8\x82\x22\xf3\x73\xeb\x3a\x5b\xef\x2a\xa5\xbc\x5f\xdd\xb2\x18\xaa\x84\x6d\x98\x47\xbc\xb3\x5f\xf4\x98\xc7\x4e\xbf\xc8\x5a\xda\x6b\x08\x59\xec\x11\xb7\x72\x30\x5e\x14\xea\x8a\xb1\x1e\x24\xcb\x6c\xd1\x50\x55\x27\xc9\x31\x6a\x4e\x70\x66\x9e\x78\x8d\x0f\x07\xed\x7b\xa7\x6e\x0d\xac\xcf\x56\xea\x59\x79\xcb\x9d\xf9\x6a\x5b\x7a\xfa\xaa\xc8\x92\xff\x66\x62\x35\xaa\xe4\x20\xf8\x82\xc3\x81\xc6\x79\xc4\x3b\xb0\xef\x5a\xa4\xca\x4b\x7b\x70\xd1\x20\x21\x1f\x38\x1a\x02\xae\x16\x3b\x54\xa2\xed\xb6\xcc\x1c\x09\xb5\x5e\x91\x04\xf3\x73\xef\x83\xce\x84\x7e\x42\x5d\x9e\x16\xb4\xcf\xf7\xcf\x7e\x35\x4c\xd0\x68\x6c\x39\x06\x84\x9d\xdc\x0d\xc9\xa0\xba\x1d\x71\x09\xd0\xe9\x6f\x9c\x7d\xe5\x4c\x1c\xcc\x82\x02\xa6\x38\x7a\xc0\x49\x9f\x14\xcc\x9d\xaa\xaa\x69\x35\x2d\xd3\x71\xd1\x5f\xa8\xca\xc4\x78\xc8\xec\x3b\x2d\x29\x81\x91\x6c\x45\x7d\x92\xe5\xa8\xba\x4a\x7e\x23\xe1\x66\x31\x97\xe3\x08\xe6\xb6\xfa\xc4\x20\x4a\xb6\x0a\x31\x64\x3e\xee\x57\x01\x1c\xb4\xdb\x01\x95\x89\x37\xca\x01\x8c\x81\xd9\x86\xcd\x57\x5b\x53\x2e\xb9\x37\xef\x00\x2a\x6b\xba\x2a\x81\xc9\x36\x47\x51\xee\xf2\xb1\x96\x56\x4b\x0f\x42\x09\x5d\xfb\x28\x7a\xf3\x61\x53\x5e\x8c\x22\xb8\xb8\x44\x3c\x6c\x79\x9b\xa2\x56\x9a\xc9\x96\x78\xb3\x8d\x89\xd9\x26\xa7\x31\x64\x11\x82\x82\x58\x33\x6e\x88\x8f\x42\x3d\xae\x6a\xeb\x6d\x0e\x95\xc9\xd8\x06\x3d\x61\x87\x7d\xeb\xc5\x7f\x56\x2a\x75\xcd\xc1\xca\x9e\x11\xd2\x3e\xd3\xf1\x59\x79\x5d\xd3\x9e\xdc\x6a\x99\xb9\x51\xa2\x21\xd0\x60\xe0\xd6\x57\x95\x6c\x01\x69\x8b\x51\x6a\x27\xf1\x9f\x19\xe0\xf2\x65\xa0\x23\xdf\x93\x25\x22\x1e\x13\x05\x4a\xfa\x95\x7f\x71\xfa\x48\x4b\x90\x90\xd9\x9f\x9e\x88\x8b\x0d\xb0\x66\x90\x6d\xbd\x12\xf6\xd6\x3f\x70\xe6\x7a\x1c\x95\x41\xb5\x9d\x2b\x7e\x31\xa1\x01\xdf\xd7\x26\x36\x9d\xf3\x6b\x68\x68\x70\xaf\x53\x65\xca\x0c\x31\x6a\xbc\x02\x97\x17\x2f\xaa\x69\xbd\x5e\x25\x6e\x3a\x4d\xda\x26\x8c\x80\x8c\xb0\x82\x06\xbb\x50\x08\x94\x10\x81\x49\x54\x33\x4e\x57\x72\x17\x4b\x4d\x58\x52\xbe\x90\xa4\x46\xef\xfb\x98\x56\x3f\xb1\xbd\x8c\x2c\xb3\x62\x0f\xe6\x16\xc8\xfd\x42\xc2\xa0\xa4\x47\xbc\x16\xb6\x98\x2b\x4f\x97\xc4\x45\x55\x66\x6c\x44\xc1\xc7\xdf\xed\x41\x44\x52\xe4\x65\x19\x9f\x76\x65\x51\xcb\xae\xa6\x34\xe4\xda\xba\x96\xd2\x46\x24\xc4\x55\xcb\xac\xfc\x1a\x6a\xdc\x66\x73\xe8\x06\x5e\x59\xe9\x0f\xc5\xdf\xc2\x73\x0f\x7b\xc3\x91\xe1\xa3\xb4\xd1\x93\x26\x60\xfa\x0b\xed\x5d\xeb\x45\x89\x27\x18\x6a\x97\xc4\x9a\x79\x58\x8b\x27\xc5\x68\xcf\x6e\xa2\x38\xbe\xb9\xc0\xa7\x94\xae\xfd\x9a\x6f\x74\xc3\x09\x6b\xa6\x08\xea\x88\x5e\x5e\x5a\xd4\x73\xd3\xe7\x25\xb6\x02\x49\xff\x2c\x4e\x4c\x8c\x75\x41\xb8\x1e\x37\xe6\x70\xcc\x57\x8d\x75\x21\x75\x22\x37\xa1\xc0\x08\x4c\xaa\x8e\xef\x82\x4b\x1c\xd9\xc4\x3b\xab\x08\xf6\xb7\x98\x9b\xd9\xac\xb3\xfd\x43\x27\x11\xa5\xad\xf1\x96\x56\x60\x38\x68\x94\x84\xcb\x3f\xe8\x70\x16\xd2\x5d\x89\xbd\xd9\xa5\x82\xb1\x07\x27\x16\x43\x37\x00\x01\x97\x0a\xb3\xc3\x19\xe3\x1e\x11\x32\xf2\x3e\xa0\xe6\xe6\x2b\x3f\xa7\xc9\x02\xb7\x2a\x81\x4a\x5b\xb0\x48\x9b\x7c\x29\x13\x8f\x61\x8a\x10\xd7\xd8\x26\x3d\xc7\xc7\x9f\xc7\x68\x4b\x5c\x55\x49\x2a\xbd\xc1\x3e\x99\xb0\xf1\x49\xb1\xb8\x13\x35\xd2\xb6\x82\x2f\xfb\x66\xb2\x5b\xf8\x1e\xa4\x19\xa4\x53\xf1\xb7\xe8\xc5\x5a\x79\x17\xf9\x3d\xa4\xe0\x3d\x85\xb6\x42\x87\x61\xc8\xcc\x36\x10\xcd\xa6\x60\x9c\x93\xd8\x6e\xd5\x15\x59\xcd\x05\x6f\x5b\x3f\xd2\xc6\x24\xbf\x86\x1a\x37\x05\x9a\x34\x54\x4c\x7a\x0c\x10\x77\x20\xf5\xb8\x09\x0b\x92\xa3\x6e\x26\xb8\x00\x9a\x97\xc8\xc1\x0e\xd8\xda\x09\x66\x61\xcf\x1c\xd4\xa7\x6b\xbe\xc4\x9a\x79\x2c\x17\xf0\x17\x8e\x77\xd2\x56\xa7\x1e\x49\x77\xcc\xfb\xe7\x21\x96\x05\x1f\x07\xcf\xc4\x5e\x3c\xbd\xc7\x54\x65\x44\x40\x8f\xd3\x9b\x07\x75\x95\x58\x36\x3b\x17\xe6\xc3\x10\x7b\xc9\x90\xaa\xc4\xab\xd1\xf6\x32\xef\xa3\x83\x7e\xaa\x77\x0d\xa4\x22\xf3\x88\xad\x5e\x29\x85\x35\xa3\x23\xd3\x6e\x92\xa6\x78\xa7\x51\xef\xdf\x31\x72\x3c\x31\x5e\x10\x8e\x13\xe3\xa1\xa4\x32\x8e\x64\x53\x7b\xed\xb9\x06\x04\x87\x6d\xac\x07\xa9\xd3\x20\x5f\xea\xb0\x19\x7d\x87\x62\xa2\x4b\xde\x67\xd5\x8c\x36\x67\x2c\x91\x07\x88\x9f\xbd\xdd\x44\x50\xec\x4f\xae\x15\x88\xb2\xe0\x10\xf9\x00\x76\xb1\x81\x83\x48\x43\x1d\x56\xda\x22\xb3\xb7\xae\x12\x7b\x4e\xf2\xf9\xc4\x13\x23\xbc\xea\x19\x92\xed\x34\x1a\x76\x54\x3f\x9e\x2a\xeb\xda\x81\xba\x22\xef\x42\x35\xb2\xa3\xac\xa2\xdc\x64\x7c\x66\x4f\xe1\x43\x4a\x19\x28\x4a\x92\xbd\x58\xf7\xf0\x9c\xc4\xb5\x34\xa9\x1d\xb1\x1d\xe4\xf4\x48\x0c\xcb\xf6\x7b\x71\x30\xb3\x05\xeb\x6f\x3b\x38\x01\x5b\x3b\x03\xe0\x35\x4b\xfc\x6d\x54\x79\xd6\x78\x39\xae\x13\x65\x80\x68\xae\xcc\xf2\x94\x80\xf1\x4d\xea\xfd\xe1\x99\x18\x06\xab\x6c\x47\x61\x9d\x8e\xdd\xd3\xfc\x48\x8b\xa2\x4e\xa4\xb6\xda\xde\x81\xd6\x19\x39\x3b\x0f\x9f\xbc\x25\xe3\x5d\x72\x0b\x84\x0d\x25\xf9\x91\x85\x2e\x6e\x32\x3e\xad\xe1\xc1\x96\x14\xe7\x13\xcb\x8d\xf4\xf7\xa4\x2a\x71\xf1\x0e\xc9\x2e\xd7\x28\x1a\x3d\x14\xea\xc7\x32\x36\x85\x28\xe8\x32\xfd\xa8\xf5\x5e\xa0\xdc\x8f\xf3\x13\x45\x36\x7c\x19\x37\xbf\x47\xcf\x18\x00\xac\x6f\x38\xf4\x7c\xdf\xb5\x31\x53\x9f\xdd\x37\xab\x26\x5d\x9e\x26\xc8\x29\x8b\xd8\x4a\x48\xc6\x55\x3d\xf8\xab\x68\x35\x3b\x66\xca\x74\x85\x21\x64\xf7\x27\xeb\x63\xbb\xab\x99\x6e\x1c\x3d\x03\xa0\xcb\x5d\x10\x24\x8d\xd4\x8d\x41\x9e\xbd\x43\x5c\x5b\xf0\x2b\xdc\xa8\x93\x34\x4c\xde\x9c\xd3\x20\xf8\xe4\x7f\xe1\xa7\x01\xf7\x13\x4c\x09\x18\xcf\xfa\xcc\xa3\x35\xc0\x9e\xd1\xc9\x90\x22\x95\x52\xa3\x3d\x3e\xf5\x4d\x69\xd5\x5a\x9f\xe9\xaa\x20\xce\x53\xb1\x62\xbc\x4c\x73\xdf\xac\x71\xbb\x0d\xdd\xa2\xfe\x65\xa9\xdd\x1d\xa8\xd7\x6c\xdb\x2f\x9c\xaa\x60\xe2\x4a\x33\x93\x20\xc8\x9f\x35\xf0\x6d\x95\x04\xf7\xd4\x2b\xcc\xed\xdf\x67\xed\x94\xd3\x26\xd0\xb5\x12\x24\x39\x21\xfb\x4d\x38\x10\xac\x9b\x2b\x95\xef\x25\x7b\xd0\x5a\xe5\x6b\xca\xa4\xeb\x9f\x9a\xc1\x7f\xf2\xfa\xe9\x46\x43\xb5\x63\xfc\x13\xd6\x0d\x25\xa7\xc7\xf5\x39\x46\xf2\x2e\x1d\x0b\xaf\x7b\x9a\xf1\xc5\xf3\x31\x9a\xd0\xe0\x17\xa7\x6c\x25\xcc\x11\x9c\xe0\xf6\x0f\xc5\x9f\xf4\x20\xd3\x96\x4e\x59\x37\xbc\xc0\x1c\x55\xf6\x7d\xac\x94\xef\xef\x8f\x44\x56\x5c\xd1\x99\xb3\x2a\x1b\xa0\x6b\x1d\xe5\xab\xf5\xe6\xa1\xff\xac\xfd\x05\x23\x18\x18\xe2\xbb\x7f\x61\xfb\x06\x3a\x88\x8f\x4e\xbb\x4b\x4c\x65\xb1\xd4\x69\x81\x96\x70\xb2\xd6\xa8\x21\x3f\x2b\x9a\xbe\xe7\x58\x2e\xba\x52\x60\xbf\x0b\x15\x37\x7a\xbd\x5f\x06\xb9\xbb\x0c\xdf\x24\x86\x90\xd4\x93\xa0\x28\x51\xcb\x79\xd9\xa3\x57\x3f\xe1\xe4\xef\xd9\x1b\x9e\x56\x32\x6d\xda\x90\xa4\x0a\xe2\x5a\x42\xcc\xf9\xb7\x60\xef\x63\x25\x79\x3e\x08\xe5\xfe\x2d\x43\xfd\x5b\x01\xa7\x0c\x23\x0a\x76\x5e\x7a\xd0\x4b\x45\x53\xf6\xbb\x70\x92\xbc\xce\x50\xd4\x4a\x8f\x35\x62\x66\x88\xc1\xbe\xe7\x3e\xca\x23\x73\x6d\xf2\x19\x06\xc5\xe8\x85\xe3\x7d\xed\xc4\xf7\x7c\x38\x48\x5b\x51\x4c\x64\x2f\x07\xa8\xcb\x45\x18\x35\xd9\x57\xea\x73\x54\xf8\x06\xa0\x5e\x0f\xbb\xb4\xb9\x21\x49\x18\x78\x12\x34\x73\x29\x8f\xc0\x8a\xbd\xd8\xd5\xef\x74\xbc\x80\x99\x09\x06\x1f\x00\x3b\xf5\xa1\xf0\xe9\x09\x63\x54\x31\x22\xe7\x8d\x0b\x7f\x2f\x18\x3c\x2f\x01\xe3\xb7\xdb\x92\xf1\x49\x21\x86\xd0\x0b\x99\x0e\x34\xfb\xea\x83\x1c\x95\xdf\xf4\x40\x93\x4e\xf5\x5b\x9d\xb3\x94\x29\x69\x0e\xd8\x76\xe8\xce\xb7\x33\xa7\x92\x65\x25\x64\xd9\x82\xee\x4a\x85\x64\x44\x15\xab\xdb\x81\xc1\xd5\xfc\xca\xa0\x8f\x44\xf4\x7d\x71\xae\x94\x47\x52\x6c\x5a\x1f\x1b\x9f\x99\x48\xbd\xbd\xb9\x78\x10\x23\x27\xda\x02\x02\x9f\x4b\x53\x77\x1a\x89\x62\xd3\x98\x93\x1c\x36\xad\x84\x54\x5c\xd0\x5d\x71\x00\x74\x16\x7f\xbf\xa5\xdc\xce\xfd\x72\x4a\xba\x22\x82\x9d\xe3\x42\xfd\x0e\xa0\xbb\xe2\x0c\x02\x1d\x40\x0b\x27\xe9\x0a\xb9\x61\x21\xef\xee\xab\x38\x47\xb0\x12\xd1\x7c\x5b\x4d\x6f\xdf\x45\x48\x75\xc9\x77\x4b\xdd\xc8\xf8\x0b\x3a\x41\xbb\xe1\xce\x47\x90\x14\x79\x2f\xed\x87\xd5\xee\x1d\xc9\x48\xb5\x47\xf7\x89\xae\xb3\x36\xd7\xd0\xf2\x3e\xc1\xf2\xa4\x86\xfb\x12\xd5\x59\x14\xc3\x62\x20\x37\x2f\xfa\x60\xa0\x23\x68\xbe\x2b\x31\xdd\x7f\x51\xb7\x4e\x0a\x51\x1a\x64\x99\x31\x60\xa2\xf2\xf5\xf0\x48\xf4\xab\x80\x30\xed\x94\x1d\x47\xf8\x4b\xe3\xb8\x0d\x5b\x1c\x24\x1a\x2e\xee\x01\x0e\xe0\xe8\x34\x2d\x3d\xed\xf6\x66\xb7\x5f\xc6\x12\xca\x11\xe9\xa2\xb1\x36\xf8\xca\x15\x9a\xbc\x0e\x00\x48\xe3\x00\x79\x20\x70\xf5\x00\x9f\xd5\x98\x62\xd3\x2f\xad\x46\xad\x8d\x57\x98\xe2\xff\x97\xb4\x6e\xdd\x8b\xda\xda\xed\xda\xf3\x36\x77\xac\xac\x08\xfb\x63\x24\x1c\xb4\xf3\xa2\xe8\x1b\xd7\xe2\xdc\xe5\x7c\x2f\xb8\xf8\xfa\xfb\xc7\x04\x93\x32\x8f\xf4\x28\x5d\xb3\xb2\x22\xb0\x58\x99\x71\xd1\x61\xcf\x21\xe9\xdf\x4b\x55\xc4\xdf\xc4\x4c\xbc\x98\xc5\x99\x57\x06\x77\x3f\x65\xb6\x79\xa6\xe3\x3e\x4c\x4c\x18\x2c\xd7\x53\xa5\xa8\x08\x21\xb7\xa5\xf9\xbf\x54\x58\x9c\x3e\xa5\xe6\xb5\xa2\xb9\x2c\x5e\x80\x4a\x62\x9d\xe0\xa0\x0d\xda\x04\x35\x5a\x02\xef\xaa\xd1\x34\x7b\xb7\x0c\x1b\x6f\x95\xc2\x69\xcb\x88\x68\x11\xa2\x09\x26\x55\x1b\x68\xfc\x0a\xb7\x79\xb8\xe8\x06\x2d\x50\x88\x5f\x0a\xe5\x79\xc0\xe5\x7c\x05\x0a\xef\x66\xbf\xcb\x19\xf7\x48\x92\x06\xa5\xcc\x0c\x42\xda\x6f\xc2\x1d\x4e\x76\x76\x5e\x8a\xee\xa9\x85\xfa\x30\x1e\xd8\xed\x8a\xc5\xfd\xcd\xa0\x92\x28\x08\x31\x5a\x04\x21\xed\x2a\xf3\xd5\x8a\x27\x75\x29\x26\x46\xbb\xec\x8d\x53\x59\x39\xfc\xbd\xb0\x97\x86\x94\x70\x3c\xa5\x56\xc3\xc1\xd4\x9f\x85\x7e\x70\x84\x35\xf8\x2a\xdb\xd2\x1f\xac\xa7\x88\x3d\xf9\xaf\x39\x39\x46\x8e\x9b\xc0\x81\x83\xd2\xa1\x57\x64\x27\xfe\x12\xb3\xbf\x29\xc6\x2a\x29\xb0\xac\xf4\xef\x5e\x00\x1f\x55\x90\x65\xfe\xdf\x20\xd7\x3f\x2b\x78\xeb\x07\xb2\x8e\x38\xe1\xb3\x3a\x75\x4a\xc9\xdd\x54\x6a\x7b\x34\x63\xfd\x46\xec\x5a\x05\x8c\x2c\x5e\xc1\xd0\xd8\xda\x32\xe2\x31\xa9\x82\x26\xd8\x99\x23\x27\x9d\x57\x4d\x9e\x25\x89\xb9\x21\xa6\x43\x1d\xb4\xf0\x19\xaa\x3c\xe8\x7c\xf4\x2f\xfc\xb3\x4a\x8a\x0f\xc5\x46\xb8\x6e\x24\xc0\x20\x65\xaf\x9c\x24\x86\x8d\x33\x53\xd9\x07\x81\x09\x84\xbb\x56\x92\x9a\x5b\x2b\xd0\xe9\x8e\x33\x47\xb5\x81\x46\xe6\xa3\x21\x3f\x97\x39\x4b\x30\xe6\x9d\x5f\x29\x4b\xaa\x49\xe2\xff\xb7\x2a\x5e\x87\x80\xff\x25\x32\xaa\x58\x96\x50\x12\x68\x81\xda\x64\xce\x4b\x23\xfd\x47\x4d\xf0\x13\x84\xc4\x7e\x77\x45\x28\x64\x79\x49\xdf\xd2\x6f\xe5\x34\x01\x21\x2f\x16\x13\x93\xa9\x09\xda\xa3\xd5\x53\xfe\xa3\x38\xa5\x91\xb9\x0d\x48\xf3\x9a\x50\x29\xc5\x1b\x9f\x1f\x38\x27\x7d\x50\x4a\xd1\x96\xa6\x17\x5f\x8d\xc7\x26\x44\x9d\x99\x03\xd3\xff\x56\xf1\x7a\xfc\x53\x2a\x4e\x0b\xf8\xf9\x64\x4a\xfe\x2e\xbd\x7d\xa3\x65\xcf\x7e\x5d\x52\x4e\x96\xd7\x81\xad\xf9\xa9\x40\x34\x23\x59\x9b\x94\x56\xa9\x17\x72\x96\x8f\xb5\x1c\xb6\xf4\x54\x4c\xb1\x04\x5c\x21\xcb\x4b\x38\x41\x26\xae\x55\xe1\x72\x97\x8f\x09\x05\x08\xf1\xb9\x01\xf0\x27\xec\x5f\x39\xd8\xf7\xa2\xe0\x5d\x85\x94\x17\x9d\x0f\xb7\xc1\xfe\xae\xc1\x9d\x32\xff\xef\xfe\xfb\xa9\x22\xaf\xe9\xc0\x62\x59\xc5\xca\x84\xf6\xb6\xb5\xd2\x26\x31\xe6\x7b\x31\x12\xbf\xc6\xd0\x10\xad\xaa\x23\x66\x72\xde\xa8\xc7\x67\x4c\xb9\x71\x05\xe0\x30\x85\x18\xdd\x4e\xc3\x11\xc7\x6b\x24\xd4\x66\xce\x19\xc9\x98\x74\xc6\xa0\x58\xdf\x9c\xe5\x63\x87\x2d\x2c\x6e\x32\x69\x6d\xd2\x9f\x2b\x9a\x30\x29\x6d\x9d\xfc\xf4\x57\x00\x49\x43\x20\x0a\x85\x92\x37\x92\xf4\xd9\x88\xd5\x04\xda\xa6\xab\x98\x28\xf4\xc2\x08\xea\x73\x2b\x2f\x6d\xdc\x1c\xd4\x45\x49\x18\xc2\xc3\x52\xe6\xe5\x26\x85\xb2\xcb\x4d\x36\x90\x66\x96\x0a\xd8\x47\xce\xe6\xda\x67\x52\x7d\x16\x7a\x21\x6f\x86\x94\xf2\x8e\xca\x54\x7b\x4b\x9a\x15\x02\xaa\x24\x8f\xad\xc4\x68\xa1\xb9\x23\x70\x60\x93\xef\x08\xbc\x19\x34\x02\x46\xee\xa3\xdf\xf8\xab\x6f\xa5\xc2\x2f\x82\xc6\x50\x2d\x85\x94\xfb\xb0\x49\xa3\x73\x86\x99\x9b\x9f\xd6\x58\xff\xf6\xc5\x02\x22\x77\x61\x99\x6f\x3c\x4c\xec\xd0\x94\x34\x8b\x5a\xe1\xa4\xe0\x28\xe6\x13\xb1\xb5\x20\x6d\x9c\x20\x81\x62\x23\x76\xc8\x71\x23\x97\x75\xad\xe4\xa7\x0b\x75\x62\xb2\x0f\xcb\xc5\x3b\x83\x11\x06\x71\xb0\x99\x33\xb6\xca\xe2\x6c\x07\x31\x95\x82\xf3\xb3\xd2\x31\x56\xa4\x1e\x3d\x49\x6f\x7a\x45\x9c\x3d\xcd\xd0\x99\x96\x82\x5a\xb1\x51\xe5\x88\x60\x1a\x9e\xc8\x01\xb1\x1e\x51\xa8\x70\x51\xc2\xaa\xf2\x05\x2b\x3f\x97\x00\x01\x1c\xc8\x75\xf1\xfe\xb8\xfa\xda\x5f\xf5\x19\xc5\xfa\xda\x57\x3e\x7e\x14\x15\x0d\xcc\xae\x1a\x0f\xa0\x54\x01\x59\x5c\x00\xf5\xa1\xae\xa6\xdd\xe6\x99\xf2\x94\x83\x05\xc5\xfc\xb4\xea\x7c\x13\x1d\x88\x0c\xf6\xd7\x1a\x48\xb5\x58\x5f\x43\x39\xb5\x70\x0a\xa6\x73\x6d\x65\xc7\x90\xf9\xbe\xbd\x03\x88\xa9\x82\x80\x8d\xf5\xbc\x59\x4d\x95\xd1\x85\xf9\x60\x53\x7e\xe9\x7d\x04\xa1\xc2\xad\x16\x23\xa7\xdc\x6e\xcd\xdb\xf2\xb6\x2d\x0a\x75\x8b\xf8\x21\x21\x69\x34\xf0\x91\xe0\xb7\xac\x23\x1d\x6b\xd5\x68\xb9\x36\x4b\x84\x73\x95\x42\x63\xfe\x0f\x46\x51\x2a\x27\xd7\x11\x92\x52\x48\xf7\x47\x6d\x63\x5f\xaa\x1a\xd9\x44\xff\x18\x54\x2e\x71\x15\xb9\x41\xb0\x89\x6d\xb6\x8d\x92\x86\x9f\x5c\xf5\xf8\x53\x8c\xd1\x06\x91\x19\x47\x55\xe4\xb6\x60\x60\x60\x90\x9a\x09\xae\x1c\xf0\x4d\x88\x7a\x37\x18\x51\xb5\x40\xe8\xc7\x94\x4d\xe0\xe6\x05\x63\x42\x5b\x9f\x05\x38\x98\x9a\x3e\xb2\xef\xfd\x56\x67\x27\xa7\x33\x90\x42\x2f\xc5\x8f\x49\x67\xcf\x16\x1c\x68\xe8\x52\x71\x7d\x85\xc6\xd9\x17\xae\xc8\xeb\xa8\x29\x74\x84\x7e\x29\xea\x44\xe6\xda\x2a\x6a\xcb\x38\xaf\x4b\xa9\x6f\x4c\xca\xa3\xdb\x5b\xaf\x5e\x35\x1e\x40\x4c\xd9\xec\x80\x64\xd1\xcb\x8a\x4c\xaa\x7d\x0b\x56\x9d\xe7\xb1\x03\x67\x24\xba\xf4\x8d\x85\x36\x62\xbd\xc1\x56\x7d\x8a\x72\x73\xb7\xa8\x58\x1a\xeb\x2b\x3a\xcf\x36\xea\x58\xc8\x1a\x40\x9f\x88\xa8\xb2\x77\x8a\x95\x52\xca\x0a\x8f\xe3\xaf\xd5\x3b\xca\x98\x9e\x04\x65\xd9\xc8\x7c\xd8\x24\x83\x48\x97\xdf\x57\xbf\xa1\x30\x13\xcc\x7b\xf8\x52\x29\x51\x55\x99\x5c\x23\x76\xc1\x92\x71\xb1\x42\x10\x86\x32\x1f\x73\x59\x66\xa7\xbb\xbd\x5f\x21\xb5\xad\x25\xc6\x83\x63\x3a\x48\xf4\x49\xc5\x58\x33\xa3\x58\xc6\xbc\x0d\xfb\xae\x7d\x36\xaa\xb6\x56\x1a\x31\x13\xdf\x99\x87\x80\x7d\x72\xd6\x72\x8c\x8e\xbd\xa6\xea\x45\x67\xde\xed\xb8\xbc\x97\xa7\xf6\x29\x4a\xdd\x2e\xe3\x69\x6a\xca\xa9\xb8\x2c\x2d\x10\xe8\xaa\x7d\xc3\x69\x1d\xac\xa9\x59\x5b\x20\x52\x7e\xd2\x31\xac\x8f\x0c\x0e\xc6\x04\xe5\xea\x4e\xc3\xec\x12\x86\x76\xe8\xb8\x73\xf8\x71\x7a\x22\x9d\x67\x0b\xb3\x66\x58\x07\xf6\xb2\x91\x3c\x32\xe0\xf9\xd6\xbe\x1a\xc5\xd1\xd5\xe0\xa5\xbc\xf5\x58\x2a\x83\x08\xf3\x77\x08\x51\xdb\x3b\xb0\x4a\x15\xb6\x47\xab\x9f\x08\x60\x91\x1b\x26\x1e\x89\x20\x24\x8b\x78\x19\xc9\xb7\x05\xc6\x4b\xef\x40\xd9\x7c\x18\x41\x75\x77\xfa\x1e\x6b\x48\xef\xc6\x64\xa5\x90\xf9\xd3\x0e\xe0\x79\x8d\x78\x57\xe8\x76\x61\x76\x9b\x20\x3b\x7c\xee\x91\x90\x1a\xbe\x8d\x5a\x6c\x6c\xe1\x9f\x84\xda\x2d\xf7\x81\x9d\x24\x98\x28\xf4\x15\x98\xde\x5b\x1e\xe4\x70\x1c\xc1\x37\x92\x78\xeb\x9f\x95\x3a\xc7\x66\x8d\x47\x9d\x3a\xee\x12\x47\x5f\xcc\xae\x28\xfc\x27\xf6\xe7\x4d\xdc\x98\x2b\x12\x5f\x42\x50\x8a\x17\x68\x6d\xb5\x4c\x58\xfc\x89\x68\x2a\x90\x52\x27\x15\x81\x90\x35\x3a\xa2\x97\x19\x1b\xb0\xd9\x4e\x19\x6d\xbc\xba\xfa\xbb\x33\xf6\xe8\x59\x04\xff\xa9\x01\x54\x3e\x20\xd2\xf5\xac\xad\x8c\xcf\xbd\xf8\xc1\x60\xdd\x29\xaf\x37\xb0\x07\x01\xcb\x0d\x8e\xe6\x7a\x48\xfe\x55\x5f\xc2\xca\x31\x7e\xc5\xfc\x2c\x5f\xec\xa9\xf2\x78\x29\x17\xc4\x32\x7c\xb1\x6c\xa7\x56\x9a\x2e\xa4\x5a\x49\xc3\xef\xc3\x83\x78\x8b\xe9\x66\xca\x64\xf5\x63\xe3\x2f\x5d\x22\xd1\x18\x1b\xc1\x6e\x76\xd6\xf5\x6d\xcb\x4a\x2b\x58\xe6\x73\x73\xbf\x56\xde\xfb\xb9\xda\x41\xc1\xa5\x8b\x0b\x07\xd5\x47\x65\x52\x05\x84\xbc\x81\x71\x7f\xf7\xe4\xb9\xa8\xc3\x79\xef\x28\x70\x38\xeb\xdd\x98\xf7\xe1\x82\x8f\xbf\x7b\x40\x4e\x5e\x30\x78\x4b\xd6\xa6\xbd\x13\x10\xf2\x4e\x37\x4d\x9b\xec\xb2\x86\x54\xdf\xb8\x05\xbb\x31\x62\x95\x0d\xcb\xb6\x81\x94\xe8\x27\xda\xa7\x78\xcf\xcd\x57\xae\x33\x2f\x73\x68\x14\xd5\x78\xf1\x7b\x37\xcd\x5d\x53\x79\x2d\x65\x99\xc4\x22\xd8\xb3\x0e\x0f\x44\xc8\x65\x99\xb3\x9d\x4a\x2e\x55\x1a\x45\x0b\x7a\xf2\x8c\xf3\x12\x37\xbc\x60\x93\x65\x5c\xbd\xdf\xd5\xc3\x79\x51\xab\xc6\x57\x15\x7a\xa6\xc3\x7b\xf6\x63\x1d\xe5\x2a\x31\x33\x63\x00\x28\x9f\xf9\x25\xaa\x5a\xc2\x1f\x2f\x64\xc5\x37\x11\x89\x8f\xf6\xbe\x5f\x1d\x92\x2d\xfb\x99\x54\xb5\x75\x36\x3f\xe5\x91\x3e\x44\xfe\xeb\xf3\x98\xdd\xea\xe2\xf9\x73\xc3\x99\x3e\xbb\x67\x72\xe5\x51\xaa\x85\xa7\x12\x72\x2d\x31\x4d\x44\x54\x90\xc8\xbc\x29\x6d\x51\x0f\xa2\xda\x9e\x2b\x10\x04\x26\x79\xb5\x44\x2d\xba\xbb\xca\xf4\xd3\x0d\x23\xed\x41\x3d\x71\x6c\xdd\x27\x42\x89\x6f\x5c\xc3\xa7\x53\x4a\x5f\x8c\xec\x33\x34\x67\x51\x0b\xcc\x76\x5a\x81\xe1\xef\x0e\xe8\x88\x83\xd9\xd7\xd9\x98\xa4\x30\x15\x4c\x42\xc3\xd9\x65\xe3\x28\x85\xea\x83\xef\x40\x83\x46\x9d\x64\xad\x62\xe2\xeb\x0a\x2d\x74\xc4\x46\x2e\x3e\x85\xbf\x7b\x24\x7b\x54\x93\x3e\xb4\x94\x71\xf3\x53\xce\xf1\x60\x71\xf0\xc6\x27\x3b\x10\xc5\xcc\x14\xfa\x61\xf6\xee\x97\x4a\xf1\x6f\x3d\xee\x8b\x55\x5b\x6d\x2f\x47\x2b\xff\x15\x28\x73\x51\xd0\xb4\xea\xac\x87\x74\xa3\xad\x0b\x59\xde\x32\x72\x1f\xe4\x83\x11\x8a\xd1\x2e\x48\x40\xb9\xe4\x31\xb1\x52\xe2\xca\xb0\x39\x4e\x61\x39\x71\x30\x5e\x92\xe2\xbb\x98\x5d\x2b\x21\x0f\xc4\x7b\x33\xbc\x14\xca\xaf\x8e\x41\xc1\x54\xd1\x19\x8b\x79\x12\xee\xbc\x7a\xd5\x15\x9d\xfe\x0a\x41\x7c\x78\xff\xc6\x94\x97\x0e\x16\xfd\x74\xdc\x09\xf1\x8e\x42\x87\x75\xef\xf4\x04\x53\x0c\xf3\x6b\xf8\x23\x3e\xbb\xe5\x5e\x88\x2e\x04\xa5\xeb\x1e\x6c\x4a\x5b\x1c\x40\xf1\x6d\x33\x09\x5a\x07\xde\x1f\x60\xfc\x92\x17\x23\x37\x2b\x8f\x34\x92\x3f\x39\x90\xe4\x38\xe9\x93\x39\xee\x29\xca\xa5\x3f\x7e\x1a\xfc\x98\xdc\x44\x09\x87\x39\x65\x52\xe7\xeb\x6e\x79\x97\x1d\x03\x00\xfb\xc7\xbd\xe4\xd1\x10\x9e\xc3\x1f\x6e\x6e\x20\xe8\x1e\xd9\xf4\x66\x04\x43\x23\xb1\x93\x58\x72\x53\x27\x46\x78\xdc\x99\x6f\x3a\x40\x64\xf7\x73\x86\xb3\xc3\xf2\x60\xd9\xe8\x4d\x45\x15\x84\x79\xb5\x5e\xf3\x80\x15\xa5\xbf\x2e\xc8\xf4\xe7\xc0\x6e\xff\x55\xad\x18\x3e\xe9\x33\x6b\x93\x2d\x97\xb5\x10\x62\xbf\x4e\x5c\x66\x63\x3c\xdf\xf6\x15\xa6\x93\x2b\x2c\xd9\x72\x24\xd0\x10\x0a\xc2\x6e\x38\x61\x5d\x37\x16\x8c\x2a\x61\x6a\x1a\xdd\x3f\x8e\xfb\x43\x5b\xfb\xe1\x5e\xc1\xea\xfd\x87\xe4\x8b\xce\x88\xea\xfd\x1d\xe5\x5d\xb6\xbb\x72\x9a\x06\x16\xcf\x8b\x82\x33\x28\x07\xf5\x6f\x8b\xbc\x1b\x6f\x3a\xc6\x47\x91\x3c\xdc\x54\x87\xae\x39\x02\xb7\x89\x23\x77\xa2\x68\x39\xa0\x58\x15\x3b\xd2\xa9\x73\x0d\xef\xeb\x5d\x45\x0c\x94\x9c\xef\x02\x40\xe3\xfe\x06\x34\x9b\xe4\xee\xbb\x98\x67\xc5\xc8\xb4\xfc\x52\xd8\xf5\xa4\x01\x66\xa7\x1d\xd5\xe5\x88\xe5\xcb\x5d\x74\x0c\xd6\xb9\x6e\xa3\xba\xf3\xc8\x11\xc6\x9b\x1e\x5f\x22\x39\xf8\xfe\x08\x84\xa5\x0a\x9b\xfd\x99\x52\x15\x4e\xb5\xf9\xc7\x1b\x23\x97\xdf\xfb\xd7\x13\xa3\xf0\x35\x34\x07\x14\xe5\xf8\xb8\xeb\xf2\x91\xf9\xe3\xa4\xb7\xfb\xd5\xa0\x43\xe2\x7f\xf8\xaa\x03\xac\xed\xdc\x3d\x38\x61\xc3\x1f\x1b\x0b\xcf\xeb\x63\xfb\x7f\x77\xf7\x08\x0b\x35\x48\xd9\xd6\x9d\x32\x0b\x0a\x77\x8d\xb3\x4d\x20\x8c\xa5\x0c\x5a\xcc\xbd\x68\x57\x8f\x2f\x15\x1d\x7a\x48\xad\x14\x1f\x42\x73\x30\x71\xf1\xc9\xea\x8e\x9e\x55\xc9\xe3\x84\x3b\x51\xc6\x0b\xfc\x37\x92\xe0\x76\x5a\xc0\x9e\xd4\x86\xa7\xa1\xd1\x69\x75\xef\x4d\x00\x28\x9d\xfe\x09\xc1\x0f\x20\xe0\x4f\xad\x5c\x0b\x25\x32\x1a\x3b\x3e\x3a\x5d\xa3\xa8\x95\x2a\xb7\x19\xf1\x13\xe2\x83\xa0\xc3\x33\xd5\xaf\xda\x1c\xa3\x03\x83\xe0\x39\x9f\x1b\x21\x27\x3c\xca\x3e\x59\x5c\x8b\x1c\x65\x8c\x1f\x67\xfe\xae\x45\x66\xf0\xf8\x02\x95\xb6\x06\xc9\xe3\x84\x90\x27\x45\x39\xd1\x3e\xc4\x6e\x8f\xfb\x5a\x5e\x5b\xe2\x2f\x3c\xdf\x12\xfa\x64\x17\xe4\x45\x87\xcf\x47\x11\x6d\xb0\x56\xf4\x9e\x38\x22\x75\xcc\xaf\xee\x04\xb6\xf2\x93\x0e\x51\x38\x41\xb4\x99\xa5\x0a\xd5\xb5\xfe\xcb\x81\x84\x4f\x2d\x68\x98\xea\x9a\x60\x53\x68\x8c\x17\xbb\x2a\x4f\x06\x89\x46\x7c\x5c\x10\x55\x45\x34\x6b\xf5\x14\x9b\xf5\x7d\xab\xf5\x1d\xa6\xf7\x2a\x3c\x9a\xee\xfa\xd7\x06\x49\x8c\x9b\x3c\x5d\xc7\x9a\x42\x7f\xa9\x30\xe5\x35\xa2\x26\x2b\x89\xa2\x9a\x4b\xa1\x47\x0c\x90\x65\x48\xa2\x19\x6d\x53\x53\xfc\xe0\xe4\x8f\x7e\x07\x56\x13\xd6\x81\xa1\x6d\xd1\x70\x9d\xcd\x60\x06\x9c\x4b\xd1\xc9\xdf\x7b\x67\xbe\x07\x3e\xbf\x07\x82\xc1\xf9\xd8\x6c\x3e\x68\x9a\xd4\xba\xd0\xdf\x91\x24\xaa\x67\xdb\xad\x3b\x11\xcf\x09\x7c\xce\x21\x1a\xce\xf9\x43\x22\x1f\x66\x9d\x6f\xf4\xba\x7c\x42\xc6\x95\x70\x61\x75\x77\xd3\xc9\xe6\x86\x2b\xad\x76\xa7\x3c\x5c\x3f\x37\x8a\x03\x59\x83\x43\x5e\x3a\xf9\xd3\x94\xe9\xc0\x4f\x11\x2d\x95\x98\x51\xb3\xc3\x59\xeb\xc0\xa1\x1f\x73\xc7\x87\x8e\xb8\xd0\x50\xe1\xe0\xe2\xc6\xc2\xac\xd0\xdc\xa9\xd9\x51\xdc\x7d\xe8\xc5\x32\x5a\x7f\x3a\x71\xa4\x7d\xd8\xa7\x86\xfe\xf3\xd0\xaf\xee\x29\xc5\x27\x17\x98\x21\x67\x88\x5b\x51\x01\x9a\xe6\xf7\x1c\x64\x22\x91\x0f\x66\x05\xc5\x4c\x99\x92\xcf\xf5\xc4\xd1\x75\x8d\x49\x45\x39\xab\x3d\x59\x72\x25\xe8\xad\xcd\x25\xd7\xd3\x55\x06\xd3\xdb\xcc\x06\x22\x0c\xdb\x1e\xf5\xcb\xab\x8c\x8a\xa9\xd1\x76\x10\xf0\xfb\x31\x67\xb4\xe3\x11\xa7\x3e\xd3\x06\x5b\xd4\xa3\x33\xf5\xd4\x14\xcb\xed\x7b\xfb\xf7\x59\x7c\xed\xfc\xa9\x7e\x7d\xd5\x46\xdc\x79\x99\xbf\x54\xb4\xf4\x91\x23\x94\x37\x8c\x18\x37\x99\x53\xbe\x4b\x3f\x4d\x7b\x29\xe5\x81\x59\xd8\xce\x46\xe8\x99\x2f\x3f\x66\xe8\xd5\x8f\x18\xb3\x3d\x6a\x1b\xdf\xe5\x85\xca\x7d\x8c\x78\x72\x88\x82\x5e\x51\x07\x1a\x4f\x53\xf9\xfd\xff\x68\xdc\x06\x6f\xf9\xec\xe4\xa2\x46\xeb\xdd\x48\xda\xe4\x75\x9f\x3a\xa2\x7a\xc1\x21\x0f\x65\x58\x90\x63\x46\x3b\xf5\xc2\xc3\xc3\xe2\xe0\x40\x54\x9f\xd1\x59\xc7\x09\xdf\x4e\x84\x9a\x06\x85\x6e\x18\x5b\x00\xcf\x7b\x6c\x7d\x3b\x19\x8c\x6f\x75\x86\xe0\xc6\x3f\xaa\xf9\xc8\xad\x28\xe3\x26\x7c\xe5\xc4\x2d\xad\xbc\xdf\xc6\xfb\xd4\xff\x5f\x72\xb2\x7f\xfd\xf8\x44\x46\x47\x47\x4f\x0c\x31\x21\x3e\x27\xa7\xa1\x59\xc9\x31\x18\x00\x80\xfb\xf7\x62\xda\x53\x45\x40\x6f\x18\x81\xa6\x8e\x88\x1e\x2d\xce\x55\xb1\xc6\xe0\x47\x0b\x15\x5a\x04\x50\x00\x5e\xfe\xea\xef\x6f\x6e\x33\x92\xb4\x2d\x0a\xe8\x34\x5a\xa3\x4d\xd2\xd3\x71\x1f\x2a\x94\xc0\x61\xb8\x4d\xc1\xa8\xe9\x98\x00\x29\xf7\x1d\x48\xad\x48\x9f\xdb\xee\xfc\x95\x95\xa6\x8d\xc3\x8b\x0c\x39\x54\x92\xcf\x1c\x87\x68\xb8\x26\x66\x5b\xa8\x7c\x0d\xa9\x1e\xcb\x81\x03\xf0\x4c\xeb\xe1\xf4\x7c\x91\xe4\x4d\x3a\xd9\x7d\x63\x5b\x01\x97\x2d\x8a\x5f\xca\x95\xdc\x9d\xaf\x95\x2f\x80\x6a\x33\x17\xc6\x04\x58\x8e\xc9\xe2\x82\x32\x00\xe3\x4a\xd6\x57\x67\xc1\x59\x7d\x4c\xd3\x5c\x11\xca\x56\x67\xce\x62\x91\x35\x17\xc2\xfa\x0c\x87\x31\xfd\xc6\x47\xb5\x01\x20\x6d\xb6\x04\x39\x92\x11\x7b\x9a\xb7\x2a\x18\x9a\xca\x3e\xc4\x4b\x50\x4a\x3c\x4c\x08\x6c\xe1\x24\xab\xec\x84\xae\xb1\x5c\x23\xbb\xa4\xee\xa7\x57\x7a\xc9\xf3\x4a\x59\x36\xac\xb5\xff\xa6\x21\xb5\xe5\x92\xbf\xc3\xff\xde\x5f\x63\x60\xfd\xd0\xdc\x51\x58\xd6\x41\xac\xbb\x49\x8b\x18\x9f\x18\xf6\x9a\x68\xfd\x1f\x35\xc3\xd2\xf2\x85\xec\x1d\x63\x0d\x1b\x33\xf8\xc8\x44\xfb\x4c\xe2\x14\xa9\xbd\x96\xf0\x2e\x42\x5b\xa5\x25\xf7\x9b\xb5\xe6\x43\x9a\xc0\x6a\x66\xd6\xe7\x50\x0c\x4e\x09\x1d\x05\xf6\x35\x78\xb8\xaf\x99\xba\x8e\x0f\xfe\x56\x50\x4a\x6f\x97\xa6\x17\x8f\x80\xbc\xbc\x15\xb7\xc6\x61\x79\x8c\x05\x6a\xd3\x81\x99\xff\xd0\xb3\xea\x6c\xb7\x5a\xc5\x4d\x94\xf3\x98\x25\xa9\xfe\x15\xde\x8b\x47\x21\x13\x0e\x5b\xee\x0d\xf8\xc2\xd1\xe0\xc6\x46\x53\x62\x99\x50\x5d\x17\xd9\x31\x11\x04\x00\xcf\x9a\xc7\xc6\x5f\xe6\x07\x86\x47\xd2\xc6\xd9\x17\xab\x0c\xe2\x04\x1f\x51\xab\x35\x14\xb5\x52\xd6\x2a\xe3\xf9\xb3\xff\x62\xc2\xbb\xf0\xb6\x1b\x38\x44\x5b\x97\x93\xd8\x64\x98\x8a\xa1\x8e\x8f\xaf\x32\xf6\x8e\x79\xe7\xbf\x23\x6b\xd3\x36\x9b\xb2\xfe\xa9\x47\x1b\x4a\x7d\xef\xd4\xad\x9d\x94\xad\x05\x16\x97\xa1\x00\x80\xbb\x19\x5e\xe0\xa1\x70\xfe\x6d\xa8\xbb\xd8\xad\x42\x92\x1e\x8d\x7b\xff\xbd\x29\xf2\x4b\x34\xe4\x9f\xb3\x4e\x2b\x55\x88\x4c\xc8\x3b\xaf\xfe\x49\x16\x00\xf0\x58\x37\xf9\xe6\xf3\x2f\xb3\xd8\x43\x31\x3b\x4e\xc0\x65\x1b\xdd\xfd\x2b\x6e\x12\xeb\xec\xd7\x54\x1a\xfd\xd2\xa4\x2c\x47\x7b\xa1\x10\xe9\x91\x19\x18\x30\x7f\xdd\x0c\x00\x30\xae\x20\xef\x72\xf1\x4b\x6e\x07\x22\x86\x6e\x8f\x08\xf9\x7d\x4f\x73\xd2\xa2\xd4\xd6\xc6\xa0\x0a\xe5\x2c\x4f\x25\x5a\x80\x46\xc6\x44\x8e\x25\xe4\xd1\xaf\x79\xac\xc3\x4a\x32\x00\xbc\xbc\x68\x81\x7a\xbe\xee\x75\x78\xc7\x5b\x7c\xba\xd5\xcc\x2c\xff\x4b\x1d\xf7\x3b\xf4\x8b\x2b\xda\x3b\xad\x21\xeb\xff\xa2\xde\x86\xde\xbf\xec\x6c\x0d\x59\xff\x8a\x73\x48\x0e\x80\x71\x19\xcd\x3a\x7b\x9d\xc7\x79\xc2\x88\xcc\x36\x6f\x9e\x91\x05\x58\xd9\xc6\xb5\xcb\x0f\xde\xc6\x4d\x9f\xaf\x91\xa7\x32\xa0\x06\x06\x06\x2c\x3a\xbd\xe8\xe5\x12\xf7\xcc\x04\xb6\x6d\xc7\x4c\x13\x91\x70\x6e\xde\xd2\xa9\xf8\x71\xdb\x75\x0c\x4e\x42\xe3\x2c\xc1\x00\x08\x4b\x87\x05\x7d\xa7\x57\x37\xf1\xdd\x64\xf7\x4c\xe2\xe8\x0f\x76\x5e\x4b\x2f\x27\x13\x7f\x40\xe5\xe3\xf0\xde\xa5\x74\x10\x66\x37\xee\x66\xbb\xaf\x56\x91\x53\xa3\xf9\xdb\xaf\x82\xe4\x46\x9b\xea\x8f\x57\xc7\xe9\xf4\x8b\x95\x1a\x74\x76\x91\xe7\xe4\xf2\x25\x37\x07\x74\x83\xb5\xd2\x09\xd1\xd4\x5d\xe8\x09\x54\xe6\xd2\x83\x13\xe7\x00\x00\xa7\xee\x9c\xe4\x4b\xe9\xd6\x97\xd2\x3c\xe5\x8a\x9b\x84\xe0\x2f\xb9\xed\x1d\xcb\x07\x8b\x65\xb1\xb6\x50\x9c\x2a\x14\xf5\xaa\x2a\x51\x59\x9e\x7f\x62\x45\x49\x97\xa6\xdc\xb2\x92\x1c\x6a\xad\x34\xfd\xb3\x1d\xf1\xeb\xa9\xce\x49\x0f\x3e\xa6\x99\x57\x9d\x23\x37\x63\x13\x9d\x60\x2a\x22\xdb\x42\x00\x38\x95\x76\x72\x28\xba\x37\xd7\xe1\x7e\x72\x89\x43\xca\xb6\xa4\x61\x9d\xf0\x20\xb2\x59\x10\x38\x78\x70\x71\x97\xe1\xe2\xe6\x95\xf2\xfa\xe7\x89\x9c\xab\x6a\xf4\x26\x5f\xc1\x4a\x71\x99\x76\xec\x34\x94\xe6\xab\x51\x6d\xb5\xc7\x6d\x77\x66\xe8\x5f\xa1\x99\x65\xee\x53\x53\x15\x0e\x23\x3f\xef\xc2\xa5\xc9\x00\xf0\x4c\x56\x3e\x7e\xfe\x22\xae\x79\x65\x7d\x95\xd7\xc7\x60\xc2\x09\xb9\xdf\xf3\x64\x0a\x9f\x24\x3b\xcb\x27\x87\xca\xcd\xd0\xf1\xa1\x3d\xb9\xe7\xe7\xb5\xa8\x15\x7b\xbc\x04\xaf\xf4\x93\x7c\x3a\x27\x59\xad\xef\x93\xcb\x16\x6e\xa3\x8d\x25\x9e\x84\x07\x8c\xa9\x27\x00\x80\xf2\x9f\xf1\x7c\xe5\x7c\x12\x01\xa6\xe0\xe6\x8c\x6d\x86\x21\x6d\xa1\xb8\x32\x42\xda\xe2\x3b\x89\x88\x6a\xde\x91\xcd\xd4\x5d\xd0\x3b\x14\xd8\x16\x85\xc8\xf8\x39\x3c\x88\xac\x41\xf3\xd5\x78\xf0\xa5\x2a\x7d\xd1\x5a\x48\x55\x2d\x2c\x4b\xd2\x5a\x0f\x40\xe1\xf9\x15\xff\x33\x2b\x9f\x6e\x07\xaf\x3b\xcc\xb7\xed\x71\x2b\x18\x22\x9e\x06\xa7\x8e\x2e\xa9\xbd\xa6\x8c\xe2\x83\xe1\x04\xdf\x84\xa8\x49\x0f\x36\x54\xf4\x44\xb2\x2b\xb7\x9d\xb3\x15\xde\xc2\x2f\xdd\xa2\xb4\xe2\x3f\x39\x67\x1a\xfd\xcd\xb1\x1a\x09\xbd\x1b\x6b\xc5\x5f\x4b\x1c\x53\xc5\xfd\x81\xce\x51\x29\xb4\x68\x70\xca\x75\x49\xed\x75\xf4\xc6\xc2\x32\x4a\x7d\x71\x99\x76\xd0\x08\xfc\x84\x3d\xba\x8d\x7d\x68\x7c\x00\x95\x7b\x64\xf7\x5f\xea\x54\x4d\x00\x48\x9a\xfc\xa1\x5c\xd1\xf3\xe3\x01\x4b\xce\xeb\xa0\x65\xed\xd3\x4f\x8d\xf8\x51\x25\xcd\xeb\x1f\x6f\xc0\x36\x3c\x04\x4e\x9f\x3c\x9e\x6e\x2c\x74\x14\x39\x08\x44\xdb\xa9\xca\x45\xf9\x27\x44\x8a\xf3\x50\x3d\x98\x44\x97\x2e\x72\x6b\x3f\x4a\xe0\x96\x7a\xfb\x07\xb5\xeb\xb7\x15\x13\x1d\xe3\xdf\x47\xaf\x93\x86\x8d\x18\x10\x94\x7a\xf5\xb8\xb5\xf6\x2e\x54\x3a\xee\x3c\xeb\xa3\x08\x51\xf2\xb6\x01\xea\xb3\x1d\x99\xad\x0a\xa3\x72\x68\xa6\x43\x8d\x98\xdc\xf1\x8a\x2b\x0c\x78\xde\x4a\x72\x99\xbe\x70\xcb\x2c\x26\x3c\xfc\x85\x99\xd2\x0a\xdb\xd8\x6f\xea\xf8\xf7\xb5\x69\x52\x38\xeb\xae\x46\xa5\xff\x9c\x82\x48\xc8\xda\x63\xca\x9b\xdd\x1c\xba\x7d\x65\x46\x99\xd2\xbe\xd5\x40\x5d\xa5\x48\xa6\xd0\xf1\x3e\x32\x0e\x2d\x8f\x4b\x52\x89\x94\x29\xa2\x61\x72\xaf\x19\x4c\x7a\xa7\xd4\x66\xcc\x4a\x11\xef\xa7\xd0\x4a\x8e\xad\xf7\x92\xe5\x52\x66\xbe\xad\x72\xf0\x30\xb7\xf6\xf1\x95\xec\x3c\x61\x94\x4a\xcf\x6a\xb3\x6f\x82\x87\x2b\xa4\xda\x09\xdb\x2c\x8b\xe4\xbf\xf4\xb0\x27\x20\x74\x9f\x1b\x94\x97\xed\x30\xa2\xc8\x06\x2d\xba\xff\xfe\xff\xf1\xf6\xe6\xf1\x50\xae\xe1\xff\xf8\x60\xec\xeb\xa1\x93\x4a\x0c\x1d\x4b\x2a\xa6\x9c\x22\xc4\x58\xea\x14\xb2\x1c\x2a\x95\x98\x36\xa7\x85\xa1\x64\x29\xdb\x63\xa9\x54\x2a\xb2\x4d\x27\x09\x65\x39\xb2\x0c\x15\x93\x65\x66\xa8\x34\xa1\x90\x68\x30\xc6\xc8\x12\x66\x8c\xb1\xcd\x62\x96\xe7\xf9\xbd\x50\xa7\x73\xce\xe7\xf3\xe7\xf7\xf3\x7b\xfe\x98\xd7\xcb\xcb\x3d\xf7\x7d\x6d\xf7\x75\xbd\xaf\xfb\xba\xee\x67\x70\xbf\xa5\x91\x30\xbc\xf8\x91\xbe\xc0\xb9\xb1\xce\xee\xbd\x63\x74\x47\x51\xa1\xf6\x7e\x82\x52\xc1\x5d\x2f\x90\xfc\xfc\x08\x67\xc9\x5b\x4d\x1f\x6e\xd7\x0c\x20\x39\x54\x00\xdd\x73\xcd\x83\x7e\xfb\xa5\xed\x5c\xd3\x01\x46\x6d\x09\x05\x41\xa5\x76\xad\x82\xf1\x94\xe3\xf4\x27\x3e\xc6\xf7\xf4\xc6\xfa\x76\xca\x7b\xf8\xa8\x77\x66\x89\x32\x57\x2f\xdc\x2c\xc6\x14\x3b\x4a\x1d\x9f\x94\x32\xc8\x78\x1d\x42\xbc\x41\xd1\x2c\x6e\xb1\x8d\xdc\x95\x5d\x2e\x08\x41\x40\x69\xad\xba\xde\x3c\x3d\xfe\xcc\xb2\xcf\xd5\xdf\x38\x27\x15\x9d\x8b\x22\x26\x63\xf7\x26\x95\xb6\x08\x39\x4d\xf6\xd1\x31\x17\x3a\xeb\x9e\xfc\x82\xdd\xe5\x97\x70\xbd\xed\xc9\xeb\x1e\xe6\x20\x9d\xb6\xdf\x4a\xc2\x59\xda\xbe\x6d\x71\x03\x71\x80\xce\x9e\x42\xda\x3f\x87\xdb\x7a\x85\x7e\xd0\xb3\xf6\x6b\x5b\x3c\xd9\xa3\x53\x60\xb2\x50\xeb\xac\x24\x78\x20\xb0\xcf\xe5\xe2\x84\xf6\xc6\x63\x9d\xa3\xa6\x98\x2b\xfb\xd6\x36\x0c\xd0\x91\x8f\xbf\x45\xb4\xd7\x15\x20\x63\x08\x5a\x69\x0b\xac\x14\xb0\x99\x89\x89\x7c\xea\xf3\x3d\x73\x69\x42\xce\xa5\xa9\xe9\x8e\x0c\xe0\x4b\x83\x09\x6c\xda\x47\x06\xc9\xe3\x25\x2b\x45\xf7\xb7\xe6\xb7\xf8\xb6\xfe\xf5\x26\x0f\x57\x82\xe8\xad\xf1\xf5\xd1\x3a\x1b\x82\x7a\xf4\xe1\x90\x69\x0c\x19\xb6\xc8\xeb\x6e\x6b\xac\x47\xc1\x60\x71\xd6\x53\xa6\x77\x8e\x65\xc3\x63\x23\x29\xef\x88\x15\xf0\x4f\xa7\xa2\x7c\xfa\x25\x87\xf4\xfc\x3d\x4e\x0e\x7d\x3a\xa4\xe2\xab\x9e\xa7\x4e\x23\x1d\x44\x6d\xcc\x5f\xff\x60\xc0\xc2\x15\xe6\xfc\x3d\x42\x7d\xb4\x67\xb3\x7a\xfa\x36\x0d\xf5\x68\xd4\xdb\xaa\x60\xb3\xf9\x63\xdb\x42\xea\xa7\x0c\xdf\x99\x76\x1e\x88\x00\x1c\xce\xaa\x24\x5c\xcf\x88\x87\xdb\x16\x4a\xa3\x7c\xd5\xe3\x33\x84\xc9\x04\x02\x3f\x04\x00\x38\x11\x25\xd3\x25\xb1\xba\xed\x8e\xd4\xc6\x5e\x3f\xdf\xca\x69\xc1\xce\x27\x83\x7d\x4c\x6b\x99\x0c\xcf\x6f\x51\x22\xcd\x8a\x54\x61\x74\xd9\xb2\x23\xc8\xdb\x71\x2c\x58\x1b\xc6\x1c\xef\xa5\x68\x53\x9f\xdf\xac\xd9\x5d\xe9\xbe\x36\x23\x72\xd5\x96\xab\x49\x63\x79\x28\x8d\xcf\xa3\x41\x1a\xd7\x3c\x69\xac\xf1\x3f\x43\xed\xa8\x78\x44\x46\x28\x7c\x13\xef\x88\xf9\xec\x5a\x33\x19\x11\xb7\xec\x61\xc7\xd5\x98\xcd\x50\x5a\x3f\x0c\x06\x8b\xf3\x19\xed\xdd\x7b\x3e\x13\x7d\x88\xcb\xf2\x97\x6a\xf6\x34\x8a\xd5\x82\x5f\x99\xd7\xcc\x1d\xd0\xd4\x0a\xbd\x88\xb4\x94\x50\xef\x6f\x38\x1f\x24\xf5\x6a\x36\x90\xdb\x58\xec\xb2\xb6\x3b\x0d\xb6\x12\x7a\xae\xb9\xc6\xd5\x45\xdf\xf7\x7e\x74\xca\xbb\xcd\xe5\x21\x3f\x49\x50\x9c\x50\xd8\x25\xb2\x28\x11\x76\xd1\x76\x38\x3e\xf4\xec\x30\xae\x55\x2d\x50\xb7\x42\xfa\x6f\x7d\x83\x4e\xcb\x5b\x27\x92\x80\xc1\x06\xf2\x8d\x80\x98\x1a\x82\xc9\xcc\xa4\xf0\x61\xc9\xb3\x9b\x24\x57\x1d\xe7\xcd\x52\x39\xef\xb8\x57\x20\x73\x89\x2d\x1f\x7d\x7f\x7d\xa1\xdc\xfd\x42\x6e\x6b\x01\x8a\xf2\x8d\xcb\x81\xfc\xc4\x45\x5b\xfa\x1f\x06\xf6\x95\xb6\x1a\xe8\xe1\x37\xa4\x9b\xc0\xa4\x53\x1e\xf8\x79\xb3\x6f\x12\x26\x97\xfe\xb4\xc9\xf7\x94\x46\x53\x85\x7d\xd9\x42\x7c\x17\x49\x3a\x50\x03\x5a\xd7\xff\x0d\xeb\xbc\xc3\xc7\x15\xb6\xe3\xf1\x36\x16\x9c\x87\x25\xb1\xac\xb0\xbb\x0f\x01\x4d\x59\x6d\x51\xc6\x03\x78\x6b\x12\x29\xa9\x3b\x5f\x05\xe4\xb0\x87\x32\x0e\x41\x9e\x32\xfd\x85\x1d\x6e\xf7\x41\x93\xb2\xae\xd6\xe3\x5a\xa0\x01\x2f\x1e\xc3\xa7\x3c\x53\x83\x2f\x85\x16\x79\x10\x99\xa2\x32\xc2\x69\x9e\x64\x64\x77\x8e\x52\x3b\xeb\x76\xa1\x51\xe3\x82\xe1\x50\x4e\xa4\x01\x3c\x2e\x5b\x90\xe4\x11\xae\x7e\x7f\x9e\x9d\x0e\x2b\x1c\x70\xe1\xb0\xeb\x61\x6a\x0e\xbe\x1c\x54\x37\x9a\xfd\x88\xd8\x4b\x65\x36\x24\xef\x34\xa7\xce\xe1\xad\xff\x2a\xe4\x2f\x59\xe1\x6e\x59\xd8\x1c\xd5\x46\x10\xb1\xad\x6e\x17\xdd\x16\xd7\x0d\xbb\x7c\x83\xd4\xf0\x5b\x89\x93\x2e\x98\xdc\x23\xec\x21\xa1\x0d\x48\x89\xdd\x9c\x1d\x0d\x42\xec\x03\x78\xd0\x6b\xd4\x98\xdf\xad\x25\x3b\x73\xd1\x87\xbd\xfc\x51\xd6\xa0\xa8\xde\x67\xd0\x53\xee\x8d\xb7\x31\x33\xb7\x2e\x06\x33\x90\xb8\xdf\xcf\xab\xdf\x80\xbc\x21\x6a\xe9\xf3\x6a\xb3\x46\x04\x54\x81\xfb\xfd\xe9\xb7\x6f\x55\xa6\x43\x86\xf2\xa9\x65\x09\xd8\xa5\x81\x38\xf4\x93\x37\xfa\x6a\x10\x0e\xcc\x86\x37\xf2\x47\xd0\x8f\x51\xcb\x7a\x5e\x93\x51\x76\xb2\xf5\x5e\x6a\x85\x7c\xea\xc3\x5c\x4a\x69\xae\x81\xab\x28\x9b\xdf\x36\xef\xe2\x2e\x39\x0b\xf5\x5f\x47\x01\xd1\x49\x28\x30\x68\x59\x57\x1b\xe8\x57\x0b\x70\xec\xd9\x81\x92\xca\x12\x40\xd9\x49\x17\xe4\x8f\xb0\x3f\x21\x60\x30\x58\x9e\xc5\x0e\xfd\xf8\xec\x38\x14\xb8\x7c\x0e\xfc\x7f\xf8\xc4\xb1\x5b\xdb\xdb\x83\xde\xd3\xc0\xb3\xbc\x73\xef\x69\xaa\xfe\x23\xb5\x83\x17\xdd\xe9\x7e\xf5\x51\x72\xcb\x82\x3d\xb3\x04\x58\x63\xcd\xd0\xd9\x0b\x06\x6a\x95\x4d\x8d\xed\xed\xa6\x4d\xf6\x06\x97\x2b\x22\x06\x62\xea\x92\xe2\x50\x30\x18\xec\x2a\x32\x5d\xa4\x8a\xb2\x45\xbb\x82\xea\x4a\xbb\x62\xcd\xd0\xd2\x0a\x02\xee\x03\x49\xc9\x8e\xcd\x4d\x83\x4c\xed\x08\x60\x5a\x6f\x68\xc9\x79\xae\xb6\x69\x41\xc5\x9a\xa5\x2c\xf7\x8f\xc5\x9a\xa1\xcb\x13\x5a\x31\x73\x78\xe2\xf9\x23\x3f\x73\x5e\xaa\x4f\xd5\x0e\x5e\xe4\x4d\xea\x48\x2e\xbb\xc4\xaa\xcd\x8f\x50\x22\x7e\x74\xd8\x24\x09\x13\xa7\xeb\x6d\x12\x1f\x8f\xcf\x3c\xde\xc1\xb9\x5b\xef\xce\x53\x5b\xf2\x6b\x71\x95\xc4\xb6\x13\x52\x92\x5a\xeb\x7b\x7b\x3c\xb5\xd6\x64\xac\x56\xbb\xec\x27\xcf\xf5\x63\xbf\x14\x5e\x52\x95\x58\xb2\x4a\xde\x68\x42\x7c\x37\xe3\x2f\x5f\x83\x9e\xf8\x38\x9a\xc1\x5a\x6a\xa9\xe2\x23\xef\x84\x92\x88\x01\x42\xed\x37\x6a\x39\xfa\x8d\x32\xa2\x5a\x98\x5e\x58\xbd\xbe\x64\x4a\x78\xee\x6a\x0d\xa5\xcb\x7e\xf2\x45\x83\x17\x79\x5f\x57\x08\x50\xfb\x9c\x1e\xd7\x0d\x0f\x96\x82\x0e\xd8\xe5\xb1\x91\x06\x1b\x67\x88\xea\x53\xd5\x83\x8e\x8d\xb4\xd2\x15\x81\xd8\xf1\x05\x6b\xd7\xc8\x7f\xe5\xdc\x33\x8d\xa9\x07\x1f\xde\x86\xcb\x2c\x51\x6b\x12\x9f\x4a\xbe\xc3\xea\x96\x66\x6f\x6e\xf2\x63\xda\xc0\x07\x08\xdf\x65\xc3\xa1\xe3\xef\x41\xb1\x20\x3f\x28\xac\x8f\x3a\x16\x9c\xb3\x75\xe2\xf8\xe3\x8c\x91\xe3\x83\xde\x09\x84\xcf\x51\x72\x2f\xa3\xc2\x56\x88\x96\x63\x4a\xc4\x1f\xb3\xd2\x4d\xd5\x6d\x04\x4d\x4a\xf3\x4b\x32\x3f\x55\xe5\xd4\x0d\xc5\x18\xf4\x06\x10\x92\xe2\xea\xbd\xbf\x31\x0e\x9c\xf0\xde\x55\x0f\x87\x9b\x2d\x16\x1f\x72\x23\x73\x27\x25\x37\x37\xd9\x32\x7d\x1b\x69\xc5\xdf\xc9\x4a\x53\xda\x32\x9e\x2c\x1b\x6f\xf7\xa9\xfa\xf9\x73\x2d\x1c\xd2\xcd\x1b\xeb\xa7\xad\x4d\x2d\x56\x2c\x83\x0b\xcb\x22\x24\x22\x72\x57\x14\x01\x83\x36\x68\xaa\x0d\xfc\xef\x97\x74\x8e\x8e\xde\xda\xf8\xdf\x59\xd5\xd5\x06\xfc\x72\x6c\xee\x2f\x2c\xed\xd3\xb1\x8f\x27\x1a\x88\x3b\x7d\x69\x40\x54\x58\x0d\xb7\xd7\x53\x4a\xf2\x50\x42\xcc\xe7\xfa\xb8\xbf\x55\x03\x9c\x48\x8f\x1f\x8b\xfe\x09\x3b\xbf\x47\xc4\xe1\xd5\xf3\x99\xec\x88\x00\x89\xf8\xd8\x87\xfa\x52\x06\x32\x52\x2b\x54\xf0\xea\x68\xcd\xe7\x2c\xd1\xbb\x2e\xe3\x74\x96\x8c\x3f\x4f\x5a\x4b\x4d\x24\x46\x40\xb7\xdb\x16\x37\x80\xb3\xe3\xe8\xe5\xf6\x2c\x17\x49\xfd\x8d\x2f\x57\xca\x11\x2d\xb0\x27\xf0\xc3\xf2\xdc\x23\x6c\x87\x3b\xd3\x56\x13\xc1\x91\x29\x3b\xea\x02\xb2\xe6\x9b\x9f\xaa\xa2\xd1\x0f\x6d\x2f\x77\x54\x2f\xc5\x1f\x3b\xd9\x40\xbb\x99\x4f\x1d\xa4\x37\xb9\xb1\xa0\xc1\x5a\xa5\x09\xfd\xfc\x85\xe3\x8d\x42\xe7\x4a\x4a\xa4\x6a\xbe\x2d\xef\x40\x67\x6e\x14\xae\xba\x36\x20\xd4\x72\x02\x2c\xa5\x47\x7d\x58\xd2\x70\xe7\xbd\xee\xa0\x7d\xd3\x69\x4f\x8e\x63\x4a\xdf\x1b\x7c\x13\xb3\x07\x36\x6a\xd3\x04\x24\x9a\xf5\xad\xc9\xf9\x3c\x1a\x74\xa4\x5d\xb3\x54\xdf\xc3\xba\x1f\xfe\xd7\xa1\x25\xf5\x4c\xc4\xc3\x55\x7c\x13\x24\xe4\xcb\x9c\x55\x15\x0e\xcb\x0f\x96\x0d\xba\x20\x93\x8e\x0e\x5c\xb2\x27\xa9\x0c\x78\x91\x1b\xcf\x5f\xc0\x8f\xa6\xd9\x0b\x89\x49\xfc\xdc\x87\x0f\xf7\x0f\x2e\xed\xdd\x48\x5d\x0d\xe1\xd8\xc7\x13\x21\x61\xdd\x32\x52\xdf\x70\xef\x11\x69\xe9\x53\x24\x48\xaf\x52\x7d\x57\xc3\xa0\x0b\x4e\xa8\xc6\xb8\x88\xb7\x27\xbd\xdc\x32\x9e\xcc\x5f\x29\x22\xa0\x15\x07\x39\x07\xeb\xea\x9b\x75\xa4\x33\xf4\xf7\xb6\x3e\x0e\x5f\x59\x57\x59\x21\x84\xb2\x94\x78\x04\xd9\xee\x76\x6d\x91\xb0\x2f\xdf\xfc\xc5\x77\x9f\x74\x22\x86\xe3\xe7\x42\xa3\x8c\x3e\x52\x10\x8c\x5d\x42\xce\x11\x51\xb4\xe8\xc3\xd2\xec\x90\x9e\xa1\x47\x0e\x51\x2d\x8f\xaf\xb9\x1d\x0f\x74\x38\x9c\xbd\x64\x7d\xa1\x76\xb8\x55\xc5\x87\x9c\x38\x99\x0a\x32\x83\xa4\x18\xaf\xc0\xad\x9d\x11\x06\x87\x25\x5b\xba\xbc\x13\xc6\xf6\x75\x14\x67\xab\x12\x18\x84\xeb\x75\xb8\x8f\x36\x1c\x22\x3a\x27\x97\xcc\x0b\xa6\x97\x11\x80\x8b\xb6\x96\x96\x25\x6f\x6d\x92\x76\x9e\xf5\x26\xfc\x72\x68\x29\x1c\xc3\xb6\x1f\xf7\xde\xe7\x85\x55\x7e\x1c\x6a\x37\x33\xf9\xd5\xb1\xaa\xc5\xce\xa4\x1e\x16\x73\x0f\x76\x84\xad\xb2\x50\x12\xe5\x03\x19\x64\xc6\xcb\x46\xd0\x2a\x0c\x7a\x35\x11\xf2\xa2\x80\x30\xfc\xc4\x55\x0f\x23\x94\xdf\x92\x7a\x75\xe3\x7d\x27\xd7\x87\xb4\x38\x33\x7a\x4d\x63\xd6\x3c\x9b\x3f\xd8\xe6\x5c\xa9\x4f\xc8\xfe\x5c\x7f\xac\x30\x23\xde\x35\x76\xd7\x4b\xea\xe9\x89\xd1\xd1\xd3\x01\x61\xa8\xb0\x88\x3b\xcb\x21\xc5\x63\xc1\x29\xee\xc1\xa1\x7d\x2e\x8a\x32\xd7\xa7\xa3\x33\x89\x0a\x5b\xe2\x87\x52\x75\xb7\x7a\x9b\x1a\x4c\x5d\xc5\x0c\xfb\xd6\xd5\x6f\x7d\xa1\x74\xfe\xc2\xca\x96\xe1\x6b\xc6\x44\x48\x9d\x26\xbf\xb1\x2d\x7e\x61\x77\x5c\xcb\x1a\x5d\x18\xe9\x22\x56\x76\x92\xf1\x0c\x43\x71\xec\xb6\xfe\xcc\x0f\x7a\x4d\x78\x73\x2a\xd5\x31\x02\x3a\x7f\x91\x37\xb5\x6c\xf6\x8f\x8d\x75\x3b\xad\xb5\xad\x2e\x74\x8f\x4f\xb8\xb8\xc1\x77\x55\x48\xf2\x9c\xe2\x3c\x39\xc8\x9b\x57\x2b\xa0\x12\xed\xf8\xfd\xda\xa7\x5e\xd0\xe1\xe6\xdd\xbe\xa4\xac\x01\xd4\x0e\xc8\xb0\xff\xae\x84\x39\x67\xb1\x8b\xe6\xd8\xb8\xa4\xcf\x57\x02\xfc\xc9\x3e\x5d\x3b\x59\x49\xab\xb8\x8c\xf1\x09\xa1\x8b\xa2\xe4\xf5\x32\x38\xf6\xa5\xf0\xc4\xc7\xc1\x1a\x95\xfa\x6e\x12\x9f\x31\xee\x36\xf9\xdc\x63\xee\xda\xea\x12\xdc\xb5\xac\xd1\xbd\x69\x8f\xf3\xa7\xe7\x8e\x7a\x2d\x04\xff\x82\x85\x6d\xbf\x42\xc5\xdd\x35\xed\xb1\x81\x2f\x4b\xa4\x20\xe5\xda\xc4\x4d\x34\x7b\xf5\x04\x52\xe9\xfe\x79\xd8\xc0\x35\xd3\xbd\x27\x9c\x69\xe2\xb3\x8e\x0d\x5e\xf5\xbf\xf8\x32\xd0\xb2\x09\x5e\x01\x52\x6d\x8b\x27\x4d\x66\xab\xb0\x0d\xc1\xbe\x2a\x35\xca\x0b\x17\x29\x1d\x9f\x70\x36\x61\x9e\x18\x52\x79\x07\x65\x78\xc5\x47\x55\xdc\x8b\xfb\xfd\xd0\x9e\x4b\x64\x54\xe8\xd6\x54\xc1\xf5\x17\xea\xe9\x71\xdd\xa6\x87\x26\xeb\x11\xbe\x6a\x11\x8b\xe5\x4f\xba\x55\x07\xcc\xa5\xaf\x5b\xa9\xed\xf7\x3d\x55\xef\xf4\xec\x17\xf4\x89\x0a\xe8\x33\xbb\x63\x1a\xbe\x70\x11\xdf\x81\x9d\x5b\x4f\x25\x6d\xee\xba\x5e\xa8\x8d\xbf\x42\x19\xfd\x36\xdb\x47\xf9\x54\x70\xff\x6d\x15\x85\xa9\x8f\x16\xda\xa7\x5b\xdf\xa0\x5b\xb7\x6d\xbd\x02\x09\x78\x31\x82\xa9\xd8\xfd\x61\xe3\x4f\x54\xeb\xc0\x20\x5c\xfb\x21\xf2\xeb\x50\xb5\xfb\xa5\x80\xaf\x4c\x9d\xf2\xbb\x1d\xe1\x96\xbd\x82\x1e\x79\x0f\x06\xa1\xda\xa0\xa9\xc6\xa6\x17\xde\x6a\x98\xee\xb5\x31\xb1\x62\xbb\x76\xcc\x87\x9e\xfa\xd8\xa0\x96\xef\x5e\x7f\xf9\x4e\x4d\x54\xaa\xdc\xa4\x9d\xdd\x74\x3d\xc1\xca\x27\x7b\xc1\x7f\x38\x57\x30\x1a\x9c\xb2\xd7\x49\x52\x7f\x73\xad\xef\xa1\x04\x2f\x6b\x9d\x67\x0a\xbb\x6a\xd0\xde\x9e\xe4\x37\x81\x39\xe3\xe1\x30\xec\xfc\x9e\x5d\x8f\x3e\xac\xa3\x36\xad\x12\x95\x9d\x9a\x8e\xb9\xe9\xd2\x4e\xab\x81\x46\xfa\x02\x4d\xe4\x1e\x9d\x5f\x1b\x6a\x3f\x70\x09\x2c\x89\xc4\x8e\x67\x4d\xeb\x38\x44\xd1\x28\xcb\x10\x7f\xf5\x11\x13\xd4\x8f\x0b\x33\x8c\xc6\x8d\x61\xbe\x3a\xda\x15\x86\x22\x61\x7d\xf6\x5b\xd8\xa5\x4d\xef\x84\x59\xda\xaa\x04\xa9\xd3\x11\xb0\xfe\x43\xf1\xac\xf6\xbd\xf2\x2d\xb9\x86\x61\xfb\xcb\x4a\x88\x1c\xce\xc9\xe0\xe0\x1e\xdb\x40\xeb\xd4\x9c\x82\x2a\xb1\xc3\x65\xbe\xc9\x85\x5a\xb2\x76\xc7\x1f\xe5\x2c\xdf\x0a\xac\x50\xb8\x19\x58\x04\xf6\xd7\x2a\xf5\xa7\xda\xd2\x9b\x21\x4e\x93\xfd\xc1\x69\xbd\x68\x0e\xdb\x93\xb7\x43\xb0\x14\x17\x7f\x3b\x64\x81\x9e\x66\x93\x29\xb2\xb2\x77\xb0\x39\x7c\x14\x10\xed\x7d\x4c\x52\x9f\x0d\x71\x19\x5b\xb8\xbe\xd2\xb8\x13\x63\xde\xad\x0e\xea\xba\x25\xa4\x9a\x3a\x20\xe6\x82\x1a\x7a\x9a\x6d\xa4\x91\xe7\xd9\x1f\x5f\x18\x50\x8f\x07\xf5\x76\x29\x25\xb8\x6c\x96\xea\xf8\x26\xa4\x47\x23\x7d\x81\x98\xc7\x40\x15\x5e\x13\x3d\xc5\xb2\x91\x53\x9b\xfa\x93\xe7\x69\x18\x23\x7f\x78\x34\x6d\xf7\x5f\x1d\x9b\x5e\x96\xad\xa6\x54\xce\x65\x87\x04\x3c\xe5\x1d\x90\x3c\x70\xd2\xba\x32\x14\xc3\xab\xd5\x7d\x39\x6a\x36\x33\xf5\x3d\x62\x36\xc5\xed\xe7\x86\x6c\x99\xc6\x9f\x49\x5e\x46\xde\xef\xde\xf5\xb2\x09\x8a\x91\x14\x47\x00\x2c\xee\xd8\x34\xd3\x26\x16\x9f\x0f\xb7\x85\x5b\x4a\x1a\x86\x55\x30\x7d\x5b\xf7\x30\xfc\x5a\xed\x65\xe3\x0b\xab\xa5\x5c\xbc\xea\x81\x5a\x12\xd4\xe8\x2b\x4c\xf2\x08\x5f\x7b\x39\xfc\x5b\x00\xed\xdd\x6d\x07\x0c\xea\xfd\x0c\x67\xce\xcf\x14\xa6\x2a\x1c\x16\x94\x49\xba\x48\x1e\x70\x99\xd3\x78\x45\xe9\xb0\x9f\x80\xef\x63\x98\x7b\xf3\x0a\x7b\xa2\x34\x5c\x59\x60\xf3\xe0\x60\x2b\xe1\x37\xe0\x1b\x1f\x30\x3d\x78\x1f\xab\xca\xc9\x6d\xd3\x9a\x8d\xdb\x24\x9c\x3f\x46\xfc\xfc\xb2\x5b\xbb\x72\x7d\x24\xb6\x43\x26\xde\x5c\x22\x2d\xe4\xaf\xfc\xc1\x1d\xae\x2c\xdb\x1e\x99\xf3\xb3\xf8\x30\x1c\xed\x12\x58\xbd\x20\x5c\x09\x1b\xa9\x7e\x3f\xf5\xec\x2d\x08\xd5\x2d\xeb\x78\x8d\xdd\x4f\x3f\x38\x74\xb4\x61\x47\x8d\x52\x83\x81\xdd\xca\xe8\xb9\x8e\xda\xb6\x18\x3e\x85\xb5\x2c\xa9\xee\xa0\x38\x15\xb8\xc1\x9a\x0a\xe3\x9f\xce\x1e\x95\x76\x2b\x87\x31\xcd\xd6\x0a\x09\xc1\xc9\x45\x91\xee\xac\xb8\x6e\x4f\x9e\x43\x3b\x7a\xba\xad\x3a\xbe\x8a\xce\x33\x3f\x1b\x82\x15\x06\x0c\x4a\xcf\x2e\x1b\x88\x8e\x7c\x64\xe0\x19\x44\xc8\xf7\x5e\x00\x56\x4f\x38\x7a\x72\x74\x60\x94\xfa\xf1\x74\x0f\xfe\x37\x9e\x5a\x3f\x93\x66\x78\xa3\xba\x3c\x61\x24\x37\x48\x18\x82\x00\xc3\x96\xd3\x9a\xdd\xb6\x6d\x21\x31\x17\xeb\x04\x77\xb4\x16\x9b\x3c\xe4\xe1\x0b\xc1\x43\x13\x08\x0d\x93\xc5\x5f\xb7\xfa\x36\x18\xe8\x76\xa1\x1e\x1f\x4d\x8c\x92\xa3\x89\x1c\xcf\xba\xa9\x91\xa3\xa1\xec\x04\xe8\x0f\xb0\xd0\x48\x62\x05\x4e\x9f\x4c\x5f\xb7\x18\xfe\xab\xb6\xdc\x84\x9d\x7d\xc2\x35\x6a\xe9\xf3\xc7\x24\x89\xf2\x64\x7c\x6c\xa0\xeb\xb4\x9e\xd2\x3c\x25\x85\x37\xc1\x26\x80\xb3\x38\x32\x02\x06\x6b\xdc\xc1\x0d\xc8\x09\xd3\xd5\xad\x5f\x3f\x47\xb5\xc0\xc4\x3b\x38\x6d\xbf\xc2\x1c\x2a\x6a\x21\x8c\xfa\xea\x8a\x66\x97\xcb\xd8\xb0\xb8\x80\x29\x6f\x2b\x2a\x53\x30\xbc\x7d\xed\xc6\x77\xb7\xce\x96\x48\xd8\x65\xe3\x77\xbd\x05\x27\x4a\x34\x81\x1c\xfe\x30\xbb\x03\xad\x93\x08\xe4\x2c\xd9\x41\xaa\x3d\x42\xa3\x6a\x73\x81\x8e\x21\xf4\x90\x94\x61\xcf\xda\xdc\xc8\x1f\x49\x21\xa1\x97\x54\x8a\x7f\x51\x9e\xf6\xd9\x0d\x9b\x39\xfc\xa0\x09\x01\x88\xc4\x82\xff\x77\xef\xca\xfa\x5f\x1e\xbb\x9f\xa6\xa6\xa6\xde\x56\xd1\x5f\xdf\xbf\xcc\x93\x55\x6b\xe0\x49\x2f\x67\x67\xcd\xe9\x0f\xde\xb3\x30\xdf\x7a\x54\x32\xd3\x89\x11\xc0\xc4\xde\x0f\x4d\x38\x1e\xf1\xdb\xf1\x5e\x4a\x78\xee\xdb\x9c\x1c\x5a\x8f\x3f\x14\x2b\x3a\x4d\xac\xc3\x4c\xf1\x04\x26\x33\xd3\xf4\xeb\xb2\xc1\x09\x74\xe4\x65\xb6\xe2\x8a\x60\x8f\x1b\x85\x0b\xd9\x88\xd8\x68\x1d\x04\xcb\xd6\x55\x46\x6a\x07\x5c\xd2\x4f\x2c\x2f\xa0\xe8\xf1\x39\x54\x4d\xf8\x4a\x16\xd8\xd9\xf4\x68\xff\x8c\xd9\x64\x1b\xbd\xbe\x03\x5c\x8d\x40\xfd\x69\x24\x95\x58\x45\x87\x8a\x2e\xf3\x8c\x26\xa0\x5b\xbc\x21\x4a\x14\x7a\xe5\x58\x40\xf2\xcf\x29\x2f\x0d\xe2\x7e\x6e\x88\x4d\xac\x59\x4a\x7d\x07\x58\xc3\x5d\x23\xbf\xe6\x2d\x77\xcd\xad\x08\x48\x4d\x4e\x20\xcd\xfe\x41\x9b\x74\x49\x5c\x30\xaf\x8f\x9e\xb6\x34\x5a\x40\x57\x87\x61\xeb\xac\x87\x68\x28\x78\x42\x6c\x53\xd4\x0c\x93\x80\x5c\xc9\xd1\xe2\x55\xf8\xe1\xe1\xe1\x14\x49\x5f\x9b\x5a\x97\x4a\xca\xf6\x59\xe6\xb7\x96\x70\x47\xdd\x09\xcd\x06\x59\xd2\xa0\x30\x61\xe5\xa0\x73\x22\x0e\x59\x3d\x8c\xd4\x88\x34\xe5\x7f\xb2\x3f\x79\x33\xf7\xa7\x26\x7a\x44\x27\x52\x4d\xd4\xa5\xb9\x92\x4b\xdb\xdf\xdd\x36\x66\x18\x5d\x4b\x97\x01\xb8\xe6\xda\x3b\x33\xb6\x4f\x46\x71\x8d\x26\x20\x85\x26\x1c\x9b\xa8\xb6\xbc\xd9\x4d\x2b\x35\x88\x7e\x1c\x6c\x8b\x70\x9e\x1c\x51\x3a\x74\x98\x8e\x93\xb2\x11\xd2\x3d\x0d\x63\x44\xf2\x4b\x34\x23\x63\x9a\xf0\x4b\x26\xa3\x35\x65\x11\x63\xd3\x1f\x23\x38\xfe\x0a\xeb\x84\x0e\xfa\x64\x9f\x60\x6b\x7b\x70\x58\x05\x06\x12\x13\x63\xe3\x87\xb0\xdf\xf9\xe2\xf2\xd3\x45\x26\xf1\xb8\xfd\xfc\x10\x9b\xfe\x98\x3a\x05\xd8\xa8\x65\x49\x5e\x5e\x86\x13\x02\x58\x66\xcd\x05\x3d\xb3\xbc\xe7\xd4\x6d\xee\x51\xf3\xdc\xdd\xa7\x4a\x00\xca\xd6\xc9\xa8\x05\x9e\xce\x82\x22\x9c\xc4\xbc\x3c\xa5\xb8\x6e\x45\xe0\x87\xdb\x35\x03\x9a\x1e\xc2\x2f\xc7\x98\x8a\x45\x6d\x4f\x5e\xbf\x7c\x88\xbc\xf5\x27\xdf\x46\xa0\xb1\x50\x3c\xab\x23\x8a\xfc\x3e\x2c\xe8\x70\xbb\x66\xa9\x2e\x8f\xcb\x08\xfc\xb9\x9b\xb6\x82\x3e\xa7\x76\x23\x97\x2f\x7a\x3f\x8a\x88\xb9\xb8\x6e\xc9\x7f\x76\x17\xb0\x69\xf4\xa8\x7f\x8a\xa3\xc9\x4d\xf0\xad\x4a\xec\xa7\xa3\xfd\xb6\xed\xc9\xeb\xcb\x51\x61\xdc\xe3\xaf\x48\x04\x2b\x1f\x1a\x10\x73\xb1\xee\xc1\xc2\x58\x95\x81\xab\xe0\x91\x58\x5e\x40\x72\x98\x61\xd6\x23\xaf\xc6\x2d\xb3\x7f\xba\x0b\x12\xcd\xd2\xce\x4b\x42\xff\xb9\x3b\x30\x3b\x3e\x8d\xcd\xc3\xbd\x70\xa2\x3f\x47\xd9\x43\xde\x72\xb1\x31\xbc\x6b\xcb\x2e\xe8\xc2\xb5\xfd\x22\xb3\x49\xe8\xbf\x77\x07\xd4\xf8\xe2\xff\xde\x1d\xc8\x5e\x70\x79\x38\x43\x10\x68\x2c\x00\xd7\x86\x78\x8a\x7e\xc2\x84\x6f\xf6\xab\xfe\xce\x29\x95\xf7\x1d\x85\x5a\x4f\xb6\x89\xd5\x95\x5a\xe7\xc9\xdc\x35\xb7\xf6\x02\x09\x60\x98\x5c\x2c\x69\xa8\x0a\x79\x76\x99\xa9\x03\x29\xfb\x3f\x87\x4c\x1e\xaf\x61\x86\xc5\x5c\x5c\xc7\x62\xde\x66\xf5\x24\xb9\x8a\x5d\x22\x56\xcc\x33\x82\x7a\xaa\xa9\xd7\x36\x66\xd9\x6b\x79\xd8\xfc\x2f\xf7\x06\x04\x19\xf5\xa3\xfb\xba\xbf\xdf\x1b\xd8\x96\x4e\x32\x4d\xcc\x07\xd5\x17\x32\xbe\x9a\x5e\x56\x15\xec\x78\x94\x48\xc7\x2c\x48\xdb\xac\xce\xf8\xac\xf9\x7d\x2d\xee\x72\x37\x8a\x06\x40\x1d\xc5\xa1\x14\x9f\x3d\x44\x0e\x17\x67\xab\x06\xe0\x0e\xbe\x1a\xcd\xdd\x94\x98\x0f\x16\xd6\x06\xd4\x54\x09\x77\xd4\xbc\x36\x4f\xe5\x0e\x6d\xe3\x73\x06\xbf\x09\xde\x4e\x72\x47\x36\xcc\x49\xbd\xc0\x08\x1a\x30\x48\x49\x1f\x3f\x77\xfa\xe7\xb0\xc0\x0e\xc3\x10\xff\xad\x6f\x48\xdb\x23\x4e\x9c\xed\xc4\x49\x81\x9e\xc7\xb2\x2b\xe3\x4b\xf1\x4b\x3b\x8a\x9f\x05\xe2\xda\x3b\x4a\x27\x8d\x96\x36\xfa\xd2\x1a\xa5\xf3\xf3\xd5\x2d\x47\xd3\xd6\xd4\xea\x5f\x38\x57\x37\x48\x8a\x99\x1f\xba\x22\xe0\x9c\x1e\x46\x50\x2d\xf6\xf8\xac\x55\x9a\x45\x36\xfb\x3e\x91\x22\x55\xd8\x93\x94\xf9\x2e\x0a\x0b\x97\x7a\x47\x9b\x7d\x66\x80\x90\x90\xe1\x1a\x64\xf4\x66\x40\xb8\xae\xcb\xdd\xd9\xd6\x50\x1e\x06\xf3\xd8\x62\xc5\x0f\xae\x1b\xfd\xd5\xa6\xb6\x94\xb5\xe8\xa5\x12\x5d\x97\x61\x8f\x00\x84\xbc\x0c\x9a\x74\xd4\x54\x71\x40\x27\x32\xc5\xd8\xa4\xb3\xe3\xde\xa6\x24\x8c\x34\x64\x90\xd1\x56\x23\x4c\xe0\x55\xe5\xb1\xc2\xfc\x72\x72\xd3\x95\x24\x60\xb0\xe8\xe0\xd3\xaf\xb0\x2d\x3e\x50\x3d\x73\xf7\x23\x45\xb5\x29\xa6\x5b\xd8\xc9\x8e\xcc\x26\x8f\x88\x23\xf6\xa6\x7a\x43\x1a\x53\x55\xb9\x15\xf6\xa4\x0c\x2f\xa7\x52\x91\xeb\x0b\xe9\xc6\x6c\x38\xc9\x20\xe3\x26\x4b\x91\xba\x46\x31\x04\xef\x5e\xb5\x8b\x78\x0d\x2a\x9d\x9f\xef\xc9\x8c\x2c\x1f\x8b\x9e\x1d\xc2\xe3\x8b\x0e\x9b\xc3\x60\xb0\x83\xba\xa5\x34\xab\x19\x94\xa5\x65\xdf\x46\x89\xca\xcd\xd9\x56\xf7\xef\x33\x66\x37\xca\x8f\x72\x84\x53\xcf\x36\x67\xd5\xbd\xf9\x98\xd5\xbc\x8a\xb0\xa3\xf6\xd4\x6d\x8c\x3d\xc0\x98\x35\xe0\x7f\xdd\x27\xdd\xe8\x28\x8c\xc7\x38\xfe\x3d\xf5\xa9\x5b\x6e\x15\x64\xae\x8a\x9e\x2f\xcf\xcc\x36\x88\x81\xd3\x54\x0e\xbd\xb2\x65\x3c\x79\xea\x63\x57\x49\x86\x22\x0c\x66\x77\xb0\xf7\xf8\x5e\xc3\x80\x9c\x55\xca\x7f\xce\x78\xe1\x7e\xa1\xac\x32\xe2\x1c\x90\x3c\x1d\x71\x51\x20\x63\x5d\x42\x7d\xcb\x7d\x9f\x8f\xe2\x55\xde\x09\x60\x10\x5d\x27\x6a\x2a\x9d\x66\x82\xdb\x42\x9f\x62\xd0\xa7\x34\x77\x87\x4a\x56\xb6\x1c\x3e\x2e\x05\xf8\xfe\x26\x50\xdc\x5e\x34\x14\x9c\x8e\x8a\xa1\x1a\x82\x5c\xe8\x09\x6e\xc0\xc2\xd4\x2d\x7f\x3f\x0c\x06\x7b\xea\x68\x5b\x7f\xc2\xfb\x14\xc7\x79\xa2\x38\x3b\x09\x31\xec\xea\x2b\x08\x5b\xb0\xd0\xee\xa3\xfc\x39\x5c\xf0\x68\x53\x52\xfe\x34\x57\xee\xa0\x7c\xbd\x1e\xd7\x86\x27\xcf\xf5\xdc\x3c\x5a\x68\x68\x67\x2e\xb1\x66\x9d\x88\xd9\x58\x5b\x60\xe6\xc4\x92\x0b\xb6\x5a\x7d\x36\x38\x47\xae\x2f\x47\x75\x91\x56\x60\x5c\xdb\x26\x7c\x41\x4e\xa8\xcf\xb2\xc7\x36\xab\x8a\x2d\xeb\x8d\x33\x65\x61\x30\xbb\xea\x02\x49\xa0\x96\xa6\xe3\xe3\x14\xb3\x71\x60\x30\x48\x4a\xf6\x4a\xb9\xba\x46\x1e\x71\x3a\xb2\x07\x6d\xeb\xe2\xf5\x6a\xda\x5d\x6e\xb2\xc3\x8e\x23\xbf\xe0\xb2\x8b\x91\xf9\x2a\xeb\x75\xe7\x10\x1a\x2f\x45\xc5\x17\xed\x7f\xaa\x1d\x68\xb5\xba\xa0\xc1\x9f\xe2\x08\xd4\x0f\xf5\x5a\xdb\x5b\x46\xb0\xe8\x78\x25\xc1\x96\xd8\x89\xab\x1e\xd0\x8d\x69\x3c\x57\x06\x06\xbb\x90\x04\x07\xd5\xcb\x98\xf2\xde\x92\x09\x45\xaa\x6c\x86\xb6\x94\xf8\xb0\xd0\x2a\x4d\x6d\xbf\xa5\xc4\x33\x2c\xf7\x9c\xc2\xe5\xb0\xca\xe8\x95\xd7\x46\x24\x0b\xcd\x60\x31\xa7\x71\x2c\x17\x58\xa8\x5d\xae\x95\x95\xb7\x73\x65\xae\x83\x6c\x53\xda\x4b\xae\x32\xc8\x1a\xb7\x71\x0e\x90\xed\x3f\x58\x1f\x78\x6a\x4b\x25\x84\x14\x72\x18\xa7\xa6\x23\x47\x07\x38\x31\x8e\xad\x79\xee\x92\x05\xb8\xe0\x00\x45\x18\x6c\xe8\xfe\x81\xa1\xe0\x88\xa0\xa9\x9f\x74\x93\x5d\xe1\x53\x6e\x9e\xd3\x9c\xe2\xab\xca\x6f\x47\x63\xc2\xc3\x28\x1d\x24\x52\xfd\x4d\x5e\x84\x45\xf3\x14\x78\x35\xd5\x3d\xee\xe4\x6d\xd5\x84\x23\xf5\x9b\xfc\x5c\xe6\x34\x1c\x88\x04\xae\x7c\xb4\x7f\x84\x23\xbe\x30\xad\xdf\x7e\x7a\x9d\xd9\xea\xed\x57\xa8\xbf\x5c\x38\x65\x68\x87\x19\xc9\xa0\x69\x33\x8e\xca\x14\x76\x5b\xc3\x60\x71\x9b\x03\x87\x96\xb2\xe6\x07\xa2\x25\x88\x77\xb8\xa5\x26\xbd\xc1\x66\x2e\x2d\x32\x88\xc1\x21\x73\x6b\xde\x09\x1b\x48\xf5\x47\xa4\xcb\xc9\xcf\xfb\x12\x3b\x24\x0b\x07\x30\xba\x46\xb8\x6d\x07\x29\xab\xcc\x67\x5c\x62\x0e\xfb\x22\x7c\xba\xe4\xbd\xce\x7b\x9f\x0d\xcc\xcd\x9f\xe0\x3e\x05\x46\xfe\x0a\x18\xca\xee\xef\xd9\x58\xae\x3d\xc1\x43\xca\xdf\x9c\x56\xc4\x88\x9b\xa6\x6f\xd5\x18\xd8\xd5\x61\xee\xd4\x0a\x9f\x68\x6e\x0d\x25\x68\x77\xfc\xa1\x2a\xaa\xcf\x8a\xdf\x05\x28\x2d\xed\xc8\x77\xc7\xa5\x00\xc2\x79\xf1\x8f\xeb\x06\x87\x24\xec\xa8\x06\x29\x58\xf8\x3b\x43\x19\x2f\x65\x19\xaf\x52\xee\x30\xbd\xd9\xc7\x96\xe4\xc1\xa0\xf4\x32\x60\x5b\xc7\x8a\x69\xa1\x69\x67\x51\xcc\xdf\x1d\x25\x4f\x0b\xed\x73\x87\x00\xe7\xfa\x75\x8e\xfb\x08\x10\x31\xc6\x1e\x8d\xe4\xf1\xb4\x34\xe2\x06\xee\xb6\xf1\x0c\xc7\x4c\xc4\xbc\xcb\xe6\xc9\x48\x2e\x77\xb8\x4d\x2c\x2e\x5f\xf2\x1a\x8d\x72\xbd\x8d\x68\x49\xda\x48\x5f\x60\xe6\xfb\x86\x01\x3a\x5a\x2c\xe4\x34\xd9\x8b\x58\x7d\x27\x59\x5d\xbc\x49\xb2\xb3\x47\x7e\xe2\x78\x89\x4c\xa2\xfa\x28\x53\x5f\x77\xec\x34\xad\x99\x6e\x28\xef\xe5\xba\x10\xb2\x4f\xf2\xb4\x37\xc1\x80\x8f\x2f\x1d\xf1\xfc\x4d\xa0\x88\x5c\xb8\xf4\x96\xbb\xd6\x79\x93\x04\x43\x4b\x84\x15\x45\x99\xd6\xc2\xdf\xdd\x95\xf0\x7d\x2b\x49\xb8\x6c\x56\xe3\xad\x85\x91\xf7\x68\x27\xb9\xac\xcd\x58\x86\xcd\x0a\x5a\x2f\xd1\x2b\x51\x41\x56\xde\xc3\x0b\x96\x1a\xf5\xb0\xa1\x26\x46\x5c\x22\x93\xc8\xbd\xe1\x6d\x2a\xb1\xdf\xd7\x2a\xbe\x93\x7c\xfd\x6d\x38\xe3\x56\x18\xa5\x1e\x70\x25\xd7\x8d\x46\x56\xe1\xf1\x75\xce\x73\x35\x67\xbd\x4b\xc8\xb6\x4d\x24\xda\xe2\xc3\x90\x28\xf7\x13\xcc\xa3\xad\x79\xe5\xe2\xe2\xb7\x09\x69\xea\x71\x45\xe6\x15\xe4\x57\x7a\xfe\x1e\x09\xcb\xa7\xd0\x0b\xa6\xa9\xf0\x59\xf2\xf3\xbe\xa3\xc7\x79\x21\x00\x10\xa6\xa4\xbf\xe3\x23\x53\x38\x7a\xc5\xca\xf8\xfe\xdc\x74\xca\x6f\xb2\x0b\xe6\x95\x1f\xa4\x5f\x0d\xe3\x34\x12\xba\xc2\x1d\xf4\x8f\x54\x4b\xe0\x76\x32\x61\x1f\x0d\x51\x73\x6b\x8c\x93\xba\x06\x4c\x86\xad\xb6\xf3\x5d\xb5\x33\xd7\x51\x4b\x54\x87\x91\x18\x7b\xa3\xd7\x8e\x6f\xe3\x3d\xd3\x4e\xb2\xca\x99\x68\xa1\xaa\x71\xa2\xe7\xf2\xe1\xdf\x3d\xab\xfa\x47\x56\x9f\xf3\xa5\x8e\xd5\x86\xc6\xe5\xe5\x7a\x9d\xd7\xdd\xb8\xd7\xcf\xb3\x54\x18\x23\x72\x71\x81\xeb\xcb\xa7\xc1\xdf\x45\x52\xe1\xee\x92\x36\x5a\x72\x9f\x67\x6a\x93\x0e\xcc\xf8\x5c\x9a\x09\x76\x32\x78\xf9\x79\x47\x8f\x6a\x19\xe9\xb6\x54\x61\x46\xbc\x76\xa9\x27\x99\x7e\x9e\xbb\x14\xc3\x92\x5d\x61\x81\x73\xe9\x91\xd1\x9b\xe4\x37\x86\x0d\xf3\xa6\x90\xa6\xbe\xea\xa4\xa2\x3c\xdc\x8b\x51\xa4\x74\x13\x1b\x6b\x56\xa9\x28\x61\x59\xfc\x40\x10\xbf\x12\xb0\x94\x4b\xe0\x79\x18\x75\x4a\xd3\xc9\x49\x0d\xa8\x46\xe4\x72\x4c\xcc\x7b\x28\x3a\xd2\x20\x4b\x2a\x39\xfd\xb2\xc4\xe4\xdd\xa5\xf3\xeb\x64\x77\x2d\x07\x82\x0d\xd5\x73\xb4\xd5\xef\xc7\xdb\x5b\xb1\x3b\x67\x55\x39\xf8\x5c\xcd\x12\x03\x89\x75\x69\xa2\x96\x24\x92\xcb\xbc\xa6\x5c\x2c\x89\xdf\x6b\xc5\xea\x5a\x3d\xb5\xd3\xe3\x24\x4a\x6e\x39\x7d\xf0\xee\xfd\xc5\x46\xfd\x7d\xf8\x15\x3f\xc6\x5f\x9d\xbc\xcb\x1d\xd4\xd3\x1a\x80\xf8\xa1\x7a\x22\x5d\x4f\xe2\x58\x10\xef\x49\xb7\x40\x55\x2f\x07\x76\xa5\x5f\x5a\xf9\x04\x01\x15\x31\x29\x9b\x36\xc3\xb0\xf5\x88\xd4\x5a\x33\xec\x2e\x09\x87\xc1\x3c\x74\x4b\x3a\x22\x43\x5d\x61\xd7\x77\x05\x9f\x0f\xfc\x44\xba\x1a\x4c\x7c\x3e\x2a\xaa\x37\xb4\xdf\x51\x13\x6f\x7a\xf3\x76\x86\xfd\x1d\xd0\xb7\xd5\x8e\xb8\xfb\x75\x29\x94\x1a\xbb\x84\x61\x35\xec\x20\x9d\xdb\xc4\xfe\xd8\x8e\xdd\x50\xea\x5f\x44\x67\x17\xd8\x75\x01\x75\x9c\x41\x57\x37\x9e\xdd\xfb\x7b\x98\xaf\xb3\x76\x8d\xe5\xbe\xca\xe2\x5c\x0a\xa7\xd6\xcb\x01\x30\x78\x09\x1e\xe5\x9b\xca\xa7\x96\x43\x9e\xc0\x2a\x8a\x00\x8d\x7e\x58\x23\x28\xee\x47\x81\x63\x8b\x4b\x6c\xfe\xc2\x4b\x8c\xc3\xdc\xdc\x6f\x92\x0e\x79\x40\x03\x97\x58\xaa\xce\xb1\xc8\x94\xfc\x21\x12\x48\x3d\xc8\x1f\x61\xb7\x20\x96\xeb\x5a\xb2\xbf\xb3\x7a\xb2\xde\x75\x6f\x5d\x0c\x1e\x46\x76\x74\x64\x36\x8d\xa7\xb0\x0d\xd1\x32\x7f\x83\x6c\xec\x92\x27\x1f\x25\x38\x49\x1e\x68\x1d\x25\xdd\x24\xc5\xde\xa1\x96\x3e\xbf\x0c\x44\x68\xe0\x90\x6e\x23\x62\x9a\xeb\x36\xeb\x13\xfc\x60\x32\x04\x4e\xcb\x00\xa2\xe4\xf9\x25\x7d\xdd\x74\x3b\xb9\x00\x8f\x05\x22\x46\x4e\xce\xd1\xbb\xd1\x24\x37\x86\x20\x8b\x1d\xa3\x35\x94\xcb\x65\x53\x63\x67\xc9\xa4\xdd\xcb\xc8\x3d\xd0\xea\x0a\xd6\x76\x11\x0b\x82\x16\xd2\x80\x68\xb9\xdb\xf7\xff\xfe\xd9\xea\x1f\x1e\x1e\x3e\xf2\x84\x56\x7c\xf1\xcc\x19\x8b\xaf\xd3\xd0\x20\x5b\x9e\x88\x7a\x21\xd5\xaa\x0b\x6f\x5d\xae\xcf\xd8\x55\x4f\x4d\x4d\x55\xb8\xce\x98\x4d\x52\x6f\x02\x2b\xa7\xc3\x1d\x32\x52\x1e\xe6\xff\x18\x12\xa7\xb8\xb0\xa9\xf8\x7f\xf4\x9b\x0f\x34\x5f\x65\x5f\x1c\xc3\x86\xdb\xad\xfd\xd1\xc0\x60\xf3\x27\x95\x99\x84\xc8\xc5\x19\x8a\xf7\xd6\xbb\x2f\xbf\xdb\x09\x63\xb5\x73\x0d\xf5\x84\xcf\x65\xbf\xc5\x42\x6d\x0f\x99\xef\xf5\xfa\xa7\x6f\xdd\x16\x9e\xbd\xfa\xf3\xc1\x90\x7f\x1a\x16\x68\xa3\x47\xee\x09\x0d\xcc\xc5\x0c\xfd\x7b\xb6\x0b\xf1\xfb\xb9\xe1\x8f\x29\xa5\x0f\xc2\xd3\xf0\x1a\xb1\xe7\x23\x0a\x0e\x34\x54\x88\xba\x54\x36\x26\x7e\xef\x0e\xe8\x49\xef\xa7\x75\x6a\x44\x07\x3d\xc6\xdb\xdb\x29\xa7\x13\xc7\x33\xd1\xfd\x12\xfe\x6a\x92\xdf\x7a\x0c\x94\xcd\x9c\xa8\x2d\x7e\xee\xfc\x5a\x79\xdb\x30\x9f\x12\x0d\x22\xef\x5f\xff\xce\x8b\x9c\x3a\x1d\xec\x6d\x39\x46\x2f\x19\xf1\x33\xb7\xdb\x68\xc9\xe7\x11\xe7\x5c\xac\xf3\x94\xfe\xee\xec\xb0\x97\x04\xb4\x1b\xdb\xae\x22\xd3\xeb\xdc\xd4\x16\xb0\xb0\x89\x9b\x68\xba\x6d\xcd\x27\xb5\x06\xdc\xbf\x49\x38\x85\x9a\x3f\x89\x62\x6e\x48\xe7\x8f\xa7\xb0\x0f\xa5\xd7\x8b\x4c\xb0\x44\xc2\x9b\x46\x14\xfc\x50\xec\x39\xd9\x0c\xfb\xef\xfd\x1f\x16\x05\x87\xcc\xfc\x7b\x7e\xdd\x51\xcb\x24\x8d\x99\x8b\x1b\x3c\x8d\xa2\xd9\x9b\x49\xff\x12\xb0\xe7\xe6\x3f\xd5\xe1\xa1\x39\x33\xc1\xb8\xf6\x43\x1a\x60\xaf\xad\xe3\xf1\x31\x6c\xb8\x9a\xe4\x0f\x76\xa4\x23\xab\xe7\x96\x5b\xc7\x0d\x79\xcb\xad\xe3\x9a\x0b\x01\xff\xa1\xc5\xb4\x53\x42\xf8\x9f\xc6\x71\x43\xce\xb7\xc6\xf1\x9c\x19\x72\x78\x1f\xfc\x7f\x2c\xaa\x01\x8e\xa7\xb0\x87\x59\x3d\x7d\xe7\xbb\x48\x04\xab\x64\x8a\x66\xf1\xec\xdc\xc4\x56\x3f\x1d\x6d\x5b\x39\x99\x20\x5c\xfb\xad\xdc\x19\xc2\xbf\xd7\x08\x4a\x5d\x12\xa9\xd9\xbd\x36\x00\x10\x8b\x4d\x41\x81\xd0\xf7\x58\xbb\xe6\x45\x4b\xf4\x01\x7c\x7f\x4b\x2b\x92\xa5\x0b\x5f\x9a\x7d\xc8\x87\xdf\x36\xe2\x8c\xd4\x82\xc1\xe2\x9e\x1e\x6e\xd7\x9c\x9d\x9b\xb8\xb0\x63\x92\xf9\x73\x47\x07\x82\xde\x8c\x02\x45\x9b\xff\x79\xab\xf7\xa0\xf4\x2e\xbd\xca\xb9\xcd\x97\x83\x65\xf5\x3c\x64\xf4\xa2\xeb\xcd\x3a\x6f\x36\x66\xb4\x9d\xcf\x06\xdb\x16\x4f\x66\x7a\xf8\xea\x68\xbb\xf5\x6b\x2d\xed\x57\xb3\x49\x97\x0b\xb9\x0f\x16\xfe\xee\x21\x5f\xbb\x70\x05\xbd\xb8\xba\x01\x9f\xa8\xb6\x31\x51\xad\x06\x2d\xd3\x75\xc6\xd9\x49\xa6\xe6\x0b\xe9\x21\x32\x4d\x71\xa3\xd7\x32\xd2\xb8\xa6\xe2\xe1\xb9\x97\xe4\xe9\xad\x5c\xaf\xb3\xee\x10\x74\x6e\x79\x81\x40\xbc\x52\x01\x7a\x92\xec\x6a\xb3\xb6\xf7\x3a\xc9\x4f\xff\xa7\x71\x66\xf2\xa7\x16\xab\x25\x7d\x3b\x20\x5c\xee\xc1\xf3\x30\x5d\xb8\xb0\x0d\xbc\x3a\x41\x70\x8a\xd1\x95\x40\xd9\x8c\xa6\xf0\x36\x3b\xd2\x5d\x9b\xa3\x56\x3d\xa7\xed\x06\xd9\x2d\x2d\x2d\xbf\x81\xe1\xd8\x97\x57\x0b\x54\x97\xed\xab\x8f\x04\x08\x0d\x89\x80\xb0\x28\x6c\x49\x7a\x3e\xae\xc3\x3b\xdc\x46\x75\xbc\x21\x8c\xd6\x4c\xaf\xca\xc6\x44\x56\x46\x3c\xd1\xcd\xcd\x6d\x09\x3d\xf3\x19\xa2\xe8\x4c\xa5\x77\x09\xaf\x56\xa5\xc7\x63\x04\x01\x67\xc4\x1f\xd2\xbc\x2e\x2d\x83\xa1\xfd\xfc\x65\x40\x9f\x1e\x3b\xbd\xe9\x4b\xe2\xfb\x98\xd9\x3a\x41\x6e\x80\x54\x0c\x55\xc2\xdf\x6e\xed\xc3\x87\x0f\xcb\x2a\x78\xc1\xf4\xb2\x47\x48\x5c\x7e\x44\x6c\x51\x96\x52\x60\x1b\xd4\xb3\xb8\x98\x08\x77\xae\x77\x6b\xd6\x84\xc1\x1a\x4d\xda\x16\x37\x10\x01\xa1\xa1\xf5\xe4\xb8\xe9\x91\x9e\xcc\x83\xed\x55\x36\xe6\xcd\x15\x22\x46\x5e\x31\xb7\x07\x2a\x32\xef\xac\xd6\x8e\xae\x5b\xac\xb4\x32\xdb\x5e\xd3\xa1\xb6\x4c\x8f\x3e\x4c\x70\x25\x37\xc8\x76\x29\xfd\x28\x7b\x7b\xab\xc4\xf0\x36\x75\x81\x82\x7d\x71\xd3\xb8\x56\x12\x06\x7b\xb9\x27\x01\x74\xb7\x40\xa4\x69\x10\x55\xfc\x1e\x54\x74\x19\x71\x31\xe5\x60\x0a\x6b\xdb\xd5\xb1\xe8\x8f\x47\x21\x0c\xc6\x4e\xc7\xeb\xbc\xd9\xfe\xb5\x81\x38\xa5\x50\xb3\x8d\x4e\x29\x6e\xb0\xa2\xa3\xe6\xd4\x05\x3c\x19\x2c\x62\x28\x2d\xa5\x95\x47\x6a\xdf\xbb\x72\x7d\x71\x5d\x46\x7c\x4c\x99\x28\x4b\x87\x1f\x34\xb2\x69\xc7\xda\xc1\x3f\xd6\x66\x3c\x80\x63\x4a\x95\x06\x49\x31\xcf\xad\x24\x2d\x38\x05\x7b\xe7\xcb\x45\x64\xae\x24\x0c\x06\x73\x3c\xdf\xe5\x5e\x7e\x3e\x6a\x5f\x9c\xb9\xaf\xd8\x64\x1b\x9f\x62\x1d\x67\xdc\x91\xdf\x84\x76\x1a\xab\x64\x99\x6d\xac\x5a\x5f\x73\x44\xa6\x70\xa5\xc6\x13\xb7\x39\x50\x52\x7f\xef\x21\xc1\x94\x42\xe6\x1a\xbe\x4f\x4d\xb5\xc0\xe7\xa8\x65\x81\x24\xea\x9c\x94\x63\x42\xac\xd8\x32\xa5\x8a\x56\xf7\x38\x05\x15\xf4\x44\xc9\x59\xe9\x2a\xde\x57\xc6\x60\x67\x00\xf1\x1a\x70\xce\x1f\x06\x83\x0d\xc9\x68\xf1\xdb\x16\xc3\xea\x19\x7d\xdc\xc5\xbc\x34\x23\x21\xa6\x02\xcc\x3a\xa4\xc2\x95\x2b\x88\x8e\xca\x34\x49\xa9\xc9\xa9\xf2\xd4\xd0\x65\x21\x4e\x1d\xa3\xb6\x68\x1d\x95\x29\x09\x86\x65\x33\x92\x40\xc7\xb3\xc8\x44\xdb\x53\xf1\x2f\xf2\x4b\x2c\xcd\xbf\x2c\xef\x3b\x6d\x2b\x89\x5b\xdb\x2a\x0e\x95\x79\x91\x87\x42\x72\x53\x8c\xfd\x33\xad\xc9\x35\xe1\xf6\xce\xfb\xe1\x85\x15\x18\x31\x35\xf8\x75\xc0\x53\x40\x3c\xd0\xd5\xda\x24\x60\x5e\xf5\xdf\xb7\x76\xa2\xe3\x5a\x4b\x80\xeb\x62\x40\xae\xe3\x59\xa4\x54\x4e\x67\x98\x71\x52\x97\x3a\x6c\x79\xe7\x4c\xbf\x93\x6e\x0c\x51\x72\xc3\x31\x8a\x25\xe3\xd7\xdd\x8d\x0a\x0c\xd0\x2c\x78\xf1\xec\x5d\x4f\xcc\xa6\x99\x80\xa7\x40\x7d\xdb\xef\xce\x92\xfa\x6c\x8b\xcc\xf7\x3c\x63\x29\x1f\x15\x41\x75\xd8\xf0\x29\x9c\x71\xc6\xef\x14\xb3\x09\x2f\x15\xaf\x19\xc6\xad\x65\x2f\x82\x9d\x18\x42\x71\x58\x7f\xd4\x22\x77\xab\x9d\xae\xbe\xb4\x49\x82\xa6\x56\x53\xa5\x78\x52\xe3\x46\x55\x4e\x5d\xe7\xc2\x87\xf0\x92\x46\x24\x56\xc9\x74\x1c\x4d\x34\x3c\x16\xab\x55\x92\x61\xb6\x94\xa3\xf3\x02\xbc\xa7\x85\x59\xf6\xe7\xc7\xd0\xad\x7b\xd8\xa2\x09\x52\xb1\xc7\x6f\x31\xad\x79\xe5\xeb\x9d\x45\x5f\x7f\x5d\x71\x1a\xf7\x9c\xfc\x24\x25\xb4\x1f\x16\xde\x7d\xd5\x97\xe7\x8e\x0b\xc5\x5a\xcd\x5a\xb0\xae\x2e\xd0\xa4\xab\x48\xca\xdb\x6b\x7c\x34\x3c\xc7\x43\xfa\xea\xdc\x0d\x1a\x6b\xc0\xb1\x5e\x0a\xab\xa7\xaf\xff\x77\x5c\xd7\x80\x57\x6e\x47\x95\x7f\x2a\x55\xba\x1b\x63\xc8\x81\xaa\xe4\x3b\x0f\xf4\x93\x53\xcd\xce\x6e\x4a\xea\x4a\x00\x56\xbc\xc4\x3d\x79\xb4\xac\x64\x2e\x8a\x98\xbc\xe4\x84\xd2\x74\x6d\xfa\xda\x62\x90\x5c\xee\xd3\x7d\x71\x9e\xd6\xc7\x4b\x9e\xc4\xd5\x6a\xc3\x8e\x58\x7e\xde\x2c\xf2\x42\xa6\x17\x45\xa2\x1e\x7d\x78\x96\x2b\xfd\xdc\x9b\xf1\x17\x25\x83\xe0\x78\x36\x1c\x4b\xee\x35\x7b\xb7\xe8\xb2\x76\x7d\xc7\x1f\x4e\x67\x7c\x6c\xbd\xf6\xc5\x8e\xc6\x70\x4c\x12\x8f\x59\xde\xf0\xaa\x50\x2a\x7a\x67\x2e\xa6\xf6\x2f\x85\xb5\xfd\x4a\xf2\x9d\xd3\xec\xa0\x43\xf1\x71\x7e\x85\x6e\xbe\xe4\xe7\x47\xa2\x63\x2e\xa8\xa1\xa7\x58\xcd\x23\x7d\x81\x21\x88\xa9\xe9\x44\x57\xc9\xb0\xbc\xfe\x30\xcd\xdd\x87\x00\xff\x6b\xe8\xf0\xdd\x45\xc7\x4c\x9f\x5d\x4a\x7f\xca\x5b\xc2\xb3\x03\xe1\xb5\x45\x97\x1b\x4a\x6f\x1a\xf2\xd4\x88\x70\xe2\x37\xd0\xeb\x06\x92\x9f\x1f\x39\x35\x13\x80\x80\xc4\xfb\xe7\x43\x4d\x12\x29\xb2\xb2\x39\x22\xff\x2d\x6b\xa8\xa5\x9b\xa9\x0b\xd8\xe6\xbc\xb4\x25\x88\x77\xec\x17\xf9\x54\x3f\xf9\x4c\xbb\x21\x4e\x93\xfd\x08\x27\x04\x00\xaa\x7d\xb6\xd6\x90\x3d\xea\xa6\xe3\xc2\x8e\x88\x89\x04\x2b\x9f\x4c\xb4\xbc\xbc\x47\xc5\x60\xca\x99\xe7\xfc\x10\x80\x54\x0d\x1a\xec\xcc\xf8\xc5\xcf\x4b\x94\xf5\x7c\x95\xeb\xb4\x5e\xb4\x7c\x6c\xbd\x80\x19\xbb\xb5\xc6\x1b\xf1\xbd\x57\x8e\x57\x90\x20\x91\x0d\x23\x0c\xd0\x53\x90\x5c\xee\xa1\xcd\x23\x21\x51\x93\xe9\xb1\x9f\x9c\x2f\x60\x7d\xd5\x08\x82\x72\x0d\x84\xf8\x4a\x4a\x95\xf6\xa5\x51\x06\xc1\x98\xff\x9c\xa5\x7b\xf0\xb7\x53\x51\x61\x7a\xe3\x3a\x0e\x97\x66\x7c\xbc\x50\x33\x7e\xdf\x0a\xfe\xe9\x56\x5d\xb3\xd4\xe7\x7b\x96\xc1\xf9\x4b\x6a\x9b\x58\xfc\xd4\x50\x5c\x94\x39\x54\xb1\xb9\x31\xd2\xe8\x7d\xec\x3c\xa5\x5b\x23\xe1\xc0\xdc\x86\xbd\xeb\xd1\x88\xf5\x65\xd5\x12\xf2\xa2\x50\x6b\x35\x9e\x3a\xd5\xde\xf4\xe2\x27\xb0\x4e\xc9\x13\x2c\xe4\x49\x7d\xef\x1c\xb4\x11\x0c\xd4\x2b\xc7\x72\xc6\x37\x9c\xb7\xe6\xde\xf3\x91\x77\x33\xb0\xc3\x94\x92\x0c\xa6\xaf\x1f\x0e\x91\x4f\xd5\xb7\x1a\x36\xf5\xc6\xe4\x02\xfb\x16\x21\xee\x14\x73\x7c\xd7\x79\x96\xec\xba\xef\xdf\x53\xb6\x92\x68\x75\x15\x58\xad\xbd\x5c\x85\xf7\xfe\x70\x35\xb7\x5f\x62\xbe\x4e\xb0\xb9\x29\x37\x48\xaa\x04\xbe\x0f\x9f\xb8\x4e\x7c\x29\x0c\x7d\x09\x25\xa7\x67\xa3\x72\x16\x3a\xb6\xb6\xbb\x4b\x66\x25\xc6\x3a\x48\x46\x69\xf3\x19\xbf\xb8\xf9\x1d\xda\x55\x5d\x4a\xee\xa1\x9b\xca\x7b\x94\x4f\xeb\x15\x88\xc3\x66\x7c\x2e\xd1\x92\x3a\xa7\x90\x3c\xca\xb1\x6f\x9d\x1b\x27\xa4\x00\xc2\xb3\x73\x46\xe2\xa3\xde\xbb\xca\x03\x28\xda\x71\x47\x5b\x5f\x7d\xbe\xe4\xb3\xe1\x58\x7a\x94\xdc\xe4\xa8\xb7\xec\x4b\x1d\x91\x57\x3d\xa2\xbf\xea\xeb\xf7\x0e\x49\xf9\x0b\xac\x9e\x70\xb4\xeb\x76\x03\x94\xc0\x02\x7d\xde\x44\x56\xf8\x25\x58\x6b\xe8\x0b\x9b\x8a\xa2\xc8\xbe\x8d\xa5\x53\x5f\x2d\x07\xc0\xcd\xa3\x5a\xef\x47\xf7\xee\xe2\x04\x7f\x79\x27\x0e\xa9\x17\x1d\x6a\xcf\x88\xed\x8b\xd5\x1a\x4d\xf0\xd1\x82\xf5\x1c\x55\xf1\x55\xdf\x25\x62\x72\x3a\x6a\x47\xd8\xaf\x97\x1d\xc1\x9c\xeb\x59\xb3\xda\x36\x6f\x4b\x26\x52\xa6\x53\x83\xb4\x1f\xb4\x3a\xb2\x8e\x7a\xc2\x2b\xc4\xbf\x73\x15\xac\xe7\x80\xca\x67\xb4\x6c\x84\x60\x9b\x9f\x28\x0c\xd1\x99\xd2\x84\x80\xd6\x2d\x2b\xe6\x5e\x76\xef\x18\x3e\x70\x41\xe5\x1e\x58\x77\x56\x28\x95\x50\x78\x32\xa2\xd1\xd3\x5f\x37\x25\x5d\xb7\xa4\x28\xa4\xf1\xfb\xe1\xed\xcb\xdd\x86\xe1\xc2\xa8\x9d\x21\x7d\xb4\xbc\xee\x1d\x35\xaf\x0d\x5f\x2c\x52\x75\xff\xaa\x09\x99\x60\xd0\xc7\xd6\x51\xfd\xe5\xf8\x9f\x40\x9b\x65\x69\xed\x91\x95\x28\xf9\x45\x67\x87\xfb\xf4\x33\xc9\xb2\x94\xc6\xa1\x14\x14\xc8\x8f\x5a\x3e\xee\xba\x33\x9e\xe9\xca\xde\x5c\xff\x37\x76\xfd\xff\xe9\xe1\xdf\x5d\x39\x1a\x96\xba\x9d\xc4\x13\x90\x11\x50\x15\xfd\xf5\xfd\xa1\x14\xa8\x97\x7d\x62\xff\x0c\x19\x98\xe2\x6d\x35\x1c\x14\xbf\xfe\x86\x3b\xfb\x13\x52\xa9\xe7\x91\x79\xfd\xe2\xfe\x19\x3f\x88\x3f\xb2\x44\xfb\x08\x2e\x98\x8c\x00\x44\x4c\x9e\xaa\xb5\x75\xfd\xec\xc7\xe9\x4f\x7f\x29\x3a\x04\x45\x89\x4e\xeb\x20\x50\x7f\x7a\xfb\xaa\x0d\x6a\xc5\x2d\xcd\x0a\x88\x66\x57\x3e\xe8\x37\x01\xe7\x85\xd9\xf4\x2b\xa2\x2f\xe4\xf1\x00\xa0\x4d\x5c\x13\xf7\x36\x16\xa2\xbe\x0a\x90\xfa\x31\xe1\xd2\x87\xf5\x8c\xe6\x89\xcd\xcb\x2d\xb4\xc3\x75\xb0\x05\x71\x9d\xda\x28\xe9\x94\x30\x30\x81\x2c\x33\x44\x00\x67\x7f\x4c\xc7\x1b\x43\x38\x1c\x46\xc2\xb5\x45\x2e\x7a\xef\xfc\xc7\x02\xf6\x49\x9e\x5d\xb9\x7c\xf8\x63\x08\x61\x11\xc7\x8a\x7e\x07\x94\x37\x10\x0a\x74\xa7\xe6\x9d\xb7\xc0\xd9\xca\x71\xff\xa2\xe7\x1a\x49\x79\x10\xc1\xb2\xc5\x64\x74\xb0\x6e\xaf\xf2\x81\x41\xff\x83\x14\xe1\x1c\x9a\x15\xdd\x4b\x53\xb9\x77\x7e\x53\xdc\x01\xbd\x8c\x43\xb0\xff\xc1\x12\x16\x90\xfb\x72\x42\xef\xec\x5a\x1f\x18\x37\x6d\x7c\x72\xf7\xe3\x02\x87\xbc\x95\x8b\x71\x3f\x06\x45\x8c\x05\x47\xa0\xca\x1a\xdc\xe0\x21\xbc\xc9\x46\xb4\xe6\x9b\xde\x20\xdf\xd9\x81\xe5\x1b\x8a\x3f\x56\x22\x8a\x5e\xb7\xb7\x07\x35\xec\xb2\x8a\x56\x6b\x18\x1f\xf5\xc2\x1f\x99\x1d\x8b\xfe\xfd\x7a\x74\x9e\xc4\xbe\x18\xcc\x73\x10\x99\xa2\x92\x7c\x4e\xea\x05\xf0\x83\x37\x34\x78\xc2\x12\x5d\xa6\x60\xe7\x32\x31\x34\x28\x03\x0a\x6a\xd2\x12\xe9\x6a\x67\x61\x7a\xd1\xe7\xa4\xa8\x4f\x21\x66\xf2\xa7\xc7\xfd\x71\x3c\xee\xdf\x6c\x8c\xb0\x3f\xa0\xb6\x8c\x27\x5f\x8e\x0a\xab\x51\xaf\xf2\x3c\xca\x9d\x4d\xe7\x04\xdb\x3c\x4f\x21\xac\x40\xcc\x3d\x3f\xc7\x09\x65\xd4\x3e\x6b\xe4\xb9\x32\x20\x2e\xa3\xec\xa5\xb9\x9d\xf0\x5f\x52\xce\x9a\xdf\xb3\x04\x48\x6b\xd4\x76\xf7\x83\xd4\xd5\x5d\xac\x9e\x23\x0d\x04\xab\xe4\x5c\x14\x71\xf3\x53\xd8\x80\x45\xdc\x4c\xb5\x72\xe0\x13\xd0\x25\xe0\x3f\xf4\x95\xc2\xed\x14\x9a\x56\x37\x3e\xa1\x71\x7c\x53\xba\xdb\xc9\x4f\x68\xc5\xb3\x82\xe1\x50\xce\x3a\x83\x95\xd5\xa8\x8d\x9d\x02\x2c\x2d\xb7\xab\x1f\xc6\x42\x00\x22\x3c\x1b\xed\xbc\xd6\x63\x45\xf2\xb6\x62\x47\x39\x74\x3a\xac\xaf\xa9\xb3\xa5\xb1\xdd\x4d\xb0\xf3\xbe\xa9\xae\xb6\x28\xcb\xd0\x5d\x8a\x9f\x80\x91\x8a\x61\x92\x16\xcc\x87\xaa\xc5\x49\x71\x50\x8d\xd8\xc5\x19\xe6\xc0\x0f\x07\x0b\x33\x9a\xf0\x33\x08\x6a\x89\x2a\xff\x57\xf0\x4b\x0a\xc9\x1b\x52\x7b\x45\xe9\x78\x35\xf1\x64\xbf\xb5\x35\x13\xa5\xf2\x54\x71\x0f\x6a\x9a\xcb\x28\x7b\xd7\x41\x94\xdb\x1e\x87\xec\x35\xef\x2c\x06\x03\xce\x4a\xf9\x51\x01\x39\x7e\x70\x1b\x60\x89\xfe\xfe\x7a\xcf\xc7\xad\xa7\xb2\x41\x4f\x19\x5c\x7b\x47\xb2\x71\x22\x46\x88\x1d\x36\x09\x6c\x23\x75\x5f\x8c\x9b\x55\x5d\xda\xe4\x49\x6a\xc4\x55\x09\x6e\x92\xa3\x69\x92\x9d\xa5\x62\x41\x1d\x71\xa7\x89\xdf\x23\x99\x99\x6b\x07\xb4\xce\x96\x42\x0f\xfa\xe3\x28\x5c\x84\x24\x98\x2d\x70\x19\x82\x26\xbf\x3a\x56\x39\x75\x9a\x8b\xc2\xd6\x66\x64\xc1\x31\x8c\xa5\xbf\x45\xa1\xf3\xf9\x6b\xce\x7c\x28\x02\xf1\xde\x67\x4a\xaf\xed\x4e\x01\x4f\x91\x20\xd7\x26\x04\x10\x01\x86\xf7\x30\xe6\x26\xb6\xfa\xc8\x59\x2e\x76\x79\x93\xe0\x58\xe5\xc6\xd4\x00\x29\x4c\x8b\xbb\xb2\xfc\x50\x11\x0b\x98\xe2\x91\x8c\x1d\xc5\x2e\xd3\xf3\x0f\x5c\xc5\x06\x33\x29\xdb\xde\xba\x5b\x20\x6e\x29\x80\x8e\xbd\x03\xa4\x05\xb3\xde\xb7\x22\x23\x79\x8f\x9b\x4e\x9d\x45\x60\x1a\x2c\x33\x52\x3d\x61\x16\x01\x88\xb4\x17\x91\xe3\xc9\x97\x43\x42\x9e\x1d\xad\x4e\x6f\x61\xcc\x4d\xcc\x34\x05\xed\x63\xa4\x91\x4d\x96\x7b\x1a\xa2\x39\x56\x85\xe5\xd1\xd7\x67\x76\xfc\x14\xda\x03\x53\x32\xff\x69\x9a\x2a\xb3\xb4\xfd\xf2\x4a\xeb\x77\x15\x19\xf2\xd4\x04\x42\x4a\x9a\x48\xce\x51\x1c\x36\x84\x38\xb5\x25\x88\xe7\xb8\x86\x81\x76\x59\xab\xc4\x82\xcc\x64\x19\xa3\x6c\x31\xd5\x62\x4f\x6d\xd2\xd6\x01\xb4\x0e\x5a\xe0\xb0\x71\x64\x79\x93\x62\x47\xf7\x3e\xf1\xae\x10\x1c\x9b\xdb\xe5\xea\xe4\x94\x9a\xd1\x6c\x28\x3f\xd4\xab\x92\x7d\x92\x9a\x58\x41\xaf\x31\xfb\xab\x09\x5d\x89\xb1\x1e\xf7\x9d\xd3\xa7\xbf\x51\x83\xba\x12\x75\x3e\xa8\x01\xf5\x4c\x3d\x6b\x84\xc1\x9d\xf8\x57\x6a\xc0\x11\xd1\xd3\x7c\xa5\xeb\x35\xc0\x9f\xa8\x40\xf5\x05\x04\xc4\x22\x5d\xfc\x82\x9c\xb7\x6b\xb1\x3e\xae\xb7\x15\x1c\x49\x21\x29\x02\x6b\xcb\x02\xe7\x7e\xc1\x4e\x7d\x7d\xe1\xcb\xbd\x22\xe0\x38\x1b\xaf\xf7\x59\xed\x28\xd5\x58\x65\x63\x6e\x2f\x1b\xc2\x65\x3c\x90\x4b\x61\x55\x2a\x17\xac\x2f\xd8\xf2\x20\x0d\x54\xf7\xbe\x4c\x9d\x60\x20\xa7\x23\xf3\xf3\xae\xd3\x3a\x2b\xc0\x48\x32\x95\x8b\x55\x97\x02\x4e\xdc\x20\x99\x24\x76\xb9\x4b\x86\x62\xa0\xe1\x8d\x8f\xea\x8e\x39\xd3\xa4\xfb\xbb\xe9\x35\xd7\xd2\x06\x1c\x27\xd8\x68\xea\xae\x77\xa2\x24\x80\x03\x9a\x79\x14\x27\xd0\x2a\x6e\x7a\x60\xc7\xb3\x2e\x88\xf2\x8d\x67\x82\x03\x60\x35\x0f\x9d\x75\x60\xd4\xd6\xfc\xf2\x3b\x19\x1e\x14\xdf\x89\xa3\x2a\xdc\x5f\x55\x0c\x28\x84\x22\x77\xeb\x4e\x0c\x38\x4f\x8e\x98\x05\xa7\xff\xa8\xde\xb9\x84\x19\xcc\x27\x65\x3d\x0d\x0d\x64\xc0\x57\xe6\x22\x17\xd3\x44\x22\x0b\x1d\x1e\xf3\xc6\xfb\x6e\x06\x93\x9c\xf1\x42\xf1\x45\x09\x60\x22\x7f\xfc\xd3\x4b\x9c\xe6\xed\xe6\xfa\x1a\xe9\xbc\x0a\x31\x6d\x5e\xe4\xed\x7c\x9b\x2a\xab\xc9\xc1\xc9\x3e\xcd\xd7\xf0\x35\xb1\x9f\x2d\xd2\x20\xea\xac\x72\xb1\x16\x14\xaf\x3d\xaa\x12\xe9\xb0\x31\x9f\x48\x9d\x48\x87\xf5\x75\x58\x66\xd8\x2e\x5e\xeb\x44\x49\x74\x37\x55\xe8\xdb\xef\x51\xbe\x7e\xdd\x55\x53\xd2\x99\x05\xbd\x2a\x02\x0b\xb1\xf6\x68\x20\x1b\x5e\xb0\x5a\x1e\xca\x9d\x87\x9e\xdc\x9f\xeb\x7d\x83\x56\x6f\x4c\x4b\x91\x08\x9f\xa5\x5c\x7a\xa4\x0d\xed\xda\x02\x3b\x02\x04\xcf\xa3\x2b\x40\x72\x2c\x9b\xda\xb8\x47\xcc\xc4\x98\xc6\x04\x5d\xd1\xc2\x36\x3c\x1a\xdc\xa0\x43\xc5\xcb\xd7\x8f\x59\x2c\x74\x49\xcc\x76\xe7\x78\x05\xa6\xad\xc2\x4e\x57\x4c\x7e\xd2\x99\xda\x74\x46\x39\xf7\xa6\xf3\x22\x5e\x3b\xac\x27\x3d\x6e\x17\xa9\xdb\x6c\x82\x91\xbb\x8e\x77\xfe\xbe\x5c\x92\x80\xb9\x58\x30\x6a\xb6\x66\x38\xd7\xda\x40\xcf\xfb\xa6\xbc\x07\x1a\xea\x36\x3d\x7c\xb3\xde\xce\x51\x6c\x00\xdb\xc2\x21\x1f\xbf\xf6\x90\x64\x22\x65\x0d\x46\x3d\x82\x9c\x11\xf3\xdb\x1d\xc7\xa1\x93\x0c\xb4\xaa\x47\x64\x73\xd0\x27\x6d\x3d\x1b\xb9\x7e\xca\xa3\xf3\xf1\xbd\xcf\x7a\xf5\x7f\xda\xbf\xe3\x46\x95\x58\x90\xe7\xcd\x0e\xb9\x43\x62\x9d\xb5\x2b\x99\x5e\x97\x23\x57\x74\xe8\xd2\x25\xac\xad\xc2\xef\x4f\x80\x20\xb5\x6e\x8c\xa3\xad\xaa\x47\xeb\xf0\xde\x5b\xb6\x60\xb5\x01\x4a\x4f\x69\x1e\x2f\x31\xd3\xab\x92\xbd\xb5\x1b\x15\x46\xb0\x42\x21\x37\x2d\xca\x9f\xf8\x15\x38\x27\x15\xa9\xb9\x6f\x1a\xe9\xaf\x79\xf6\x06\xe9\x11\x6f\xf4\x72\x43\xf1\x6c\x07\x53\x74\x66\x9c\x98\x46\xb8\xc6\x60\xa2\xe1\x9c\x37\x06\xda\x16\x99\xf0\xc2\x37\x5e\x29\x4e\x84\xf6\x6e\x6f\xb8\x97\xff\x89\xf4\xbc\x1a\xb8\x6e\x04\xf5\x40\x4e\xf6\x3e\x03\x32\x66\xb3\x7d\xf5\x4b\x45\xf3\x9f\x32\xc2\xf5\x06\x6b\xcd\xd4\xd8\x5d\x80\xc6\xd3\x0f\x24\x56\x5a\x4b\x5e\xb7\xfe\x5f\x38\xa8\x9b\xfc\x92\xa8\xc4\xc1\x19\xc3\x26\x98\x38\x44\x31\x4e\x3d\x42\xb2\x66\x2c\x18\x81\x76\xde\xf0\xb2\x7c\x16\xd7\x5d\x5b\xd9\x42\x32\x5e\xc3\xdd\x0a\x85\xcd\x22\x84\xe2\x60\x67\x0e\x07\xd7\xc1\x9f\x74\x66\x3e\x93\x4a\x75\x51\x98\x82\xdf\x17\x02\xfb\x95\x85\xb6\x2c\xd8\x60\x16\xec\xdd\xa5\xf3\x93\x4a\xbe\x1a\x79\x45\xa7\xf3\x0e\x44\x7c\xb9\x6c\xee\x63\x30\xdb\xa5\x12\x18\xf5\xce\xf5\x86\x60\x4d\x6f\xaf\x8e\xe3\xb9\x79\xf7\xea\xc4\xee\x83\x5d\xdb\x0e\xbb\x6a\x02\x5a\x53\x19\xa3\x94\xb7\x1e\xd0\xd1\xd6\x3c\x1c\xb0\x89\x8f\xac\xdd\x55\xf3\x25\x37\x32\xda\x58\xde\x03\x3b\x4b\x6a\x73\xc8\xf3\x3b\x6c\xd2\xe4\xd3\xfb\x86\x74\xbd\xea\xb8\x16\x78\xca\x3a\xd0\x81\xc3\x21\x3d\x44\x3e\xcb\xed\xeb\x1c\xae\xb5\x77\x57\x8d\x0e\xef\xa4\xe0\x9e\xe4\x5a\xf4\x48\xde\x63\x9d\x5f\x5b\xe9\xd9\x04\x98\x4a\x74\x4e\x3f\x1b\xf6\x8a\x54\xd7\xbd\x43\x4a\x26\x1d\xab\x7e\xa9\xb8\x04\xad\x6b\x49\xb9\x5b\x64\x63\xde\xfc\x62\xa1\x96\x41\xd4\xea\xfc\x4a\xaf\xd9\x97\xaa\x65\xe4\x6c\x9c\x6e\x08\x1d\xa0\x22\x9b\x4b\x37\xf3\x23\x78\xf8\x91\x57\xa3\x46\x90\x4a\xe0\x30\x0e\x50\x74\x4a\x51\x2d\xd4\x47\xe9\x85\x6a\x41\x9e\xf6\x27\x7c\xcc\x0e\x24\x93\x78\x8b\x1d\x02\x6a\x6d\xc5\x69\x9e\xda\xfa\x6e\x92\x52\x57\x6d\x29\x33\x1c\x6b\x72\xbf\x86\xa2\x4d\xb5\xbe\x46\x93\x60\xa4\xc3\x26\x75\x1b\x0d\x25\xd2\x83\xe1\x6b\x03\x47\x82\x9f\x46\x50\xd7\x3a\x47\x68\x16\x28\xf9\x21\xd6\x97\xf5\x07\x6d\xea\xac\xa2\xbe\xa9\x56\x4a\xc0\x80\x56\x93\xc1\x5a\x4a\x1c\x56\x61\x86\x93\x37\xd4\xfd\xca\x5d\x79\x88\xde\x41\xca\x7a\x93\x69\xeb\xf9\xf2\x7b\x2f\xc0\xde\xde\x37\xa4\x17\x8b\xa8\x3d\xf4\x59\x1c\xd3\xc1\xc3\xd8\xbf\x51\x44\xa1\x93\xba\x9b\x89\xab\x7a\x28\x50\x08\x38\x96\xe8\x9c\x8b\x22\xfa\x08\xfb\xdf\x8e\x45\xff\x84\x9e\x62\xd9\xa4\x06\x29\x5e\xf5\xea\x70\x25\x80\xbd\x83\xc6\x81\x92\x05\xb2\x53\xa6\x37\x73\xf5\xed\x22\x8d\xce\x31\xea\xfd\x5c\x0b\xd6\x01\x3e\x92\xa7\xdb\x5a\x75\x92\xb6\xdc\x19\xe9\xdb\xf2\xed\xb8\x7d\x38\xb8\x63\xf5\x2c\xfe\xcc\xa2\x93\xcd\x0e\x09\xb7\x58\xd8\xd9\xfc\x14\xc0\xc7\xb2\xd7\xd6\xac\xc6\x47\xf3\x3a\x3f\x45\xfc\x08\x2f\x0f\xf2\x47\x3a\xf8\x64\x11\xe5\x03\xea\x20\xfd\x91\x28\xb9\x14\x70\xf2\x58\x4a\x54\x9c\x6e\x45\x87\xd1\x92\x09\x84\xcc\x68\xec\xc1\x9c\xb1\xe8\xaa\xc8\x06\x7d\xbb\xb9\x83\xa9\x06\xa2\xad\xc3\x21\x60\x18\x39\xc0\x12\xfd\xa6\x06\xae\x9b\x09\x9f\x24\x67\x82\x3d\x37\xfa\x49\xcc\xa1\xe0\xb6\x92\x85\x83\xa9\x07\xd6\x8a\xb8\x53\x01\xd6\x40\x2d\x09\x81\x9e\x66\xe3\xfa\xa3\x18\x52\x89\x85\x75\x49\x9d\xd3\x48\xff\x99\x93\xc1\xc1\x98\x8f\xbf\xec\xd8\x98\x75\x5f\x29\xa2\x1c\xa8\xbd\x7b\xe6\xf9\xc9\x81\xba\x38\x14\xc8\xc7\xa7\x00\xe4\xe7\x7d\x0c\xe7\x3b\x40\x78\x52\x60\x20\xae\x62\x2b\xc4\x99\xc7\x4f\x17\xf6\xe0\x0b\x05\x02\x74\x3b\x29\xda\x2b\x51\xdf\x38\x12\xfb\xdb\x9b\x31\x52\x8d\x5a\x88\xf4\x06\x28\x73\xd4\x99\xc4\xcd\x20\xfd\xec\x70\x66\x36\x0d\x36\xa9\x5f\xe9\x22\xb9\x34\xf7\x0e\xb9\xac\x58\x25\x37\x11\x7a\x9a\x1d\xf1\x34\x82\xf5\xc8\x4a\xdd\xb2\xa6\x43\x2d\x74\xed\x04\x17\x67\x64\x67\xa3\xd6\x7b\x13\x77\x5d\xa2\x32\x85\xa4\x1c\xe7\x8c\xd6\x1b\xec\x26\x85\x2e\xc1\x96\xb7\x24\xdb\xf9\x5c\x37\x41\xc3\x07\x60\xc7\x07\xb1\xde\xce\xbf\x80\x7a\x97\x5f\xb0\x83\x82\x75\x0f\x60\xda\x1d\x7f\xa8\xfa\x45\x30\x50\xb7\xf5\x8f\x34\xb8\xc5\x79\xae\xbd\x40\x3d\x9f\xea\x2a\xa9\xff\xf1\xe1\xb3\xa8\x5b\x03\x0a\x76\x4f\x35\x1a\x6c\x77\x1e\xae\xa5\x2c\xf4\xc1\xa8\x2a\x9e\xd8\x1c\x98\x4b\xce\x8c\xa7\xd2\x2c\x4e\x7e\x05\x17\xd4\x2f\x62\x1f\xce\x14\xf6\xbe\x01\xa6\x78\x44\xe5\xa7\x38\x80\xa0\xa8\x4f\x1a\x7c\xaa\x91\x47\x91\x95\x55\x0d\x77\xf0\x8c\xaf\xdc\xf5\x15\x7f\x26\xf9\xe0\x89\x63\x3a\xda\x15\xe1\xf1\xce\x4e\xb0\x82\x61\x7d\x7e\xb0\x73\x42\x9d\xf9\x55\x6a\xe9\xf3\x93\xa2\x1d\xbe\xeb\x48\x1c\xbc\x7c\xe7\xa8\xb7\x84\x55\x5e\x9b\x3d\xba\x64\x34\x62\x8a\x27\x30\x69\xfc\x1b\xab\xe0\xda\xe9\x7f\x60\xd2\x60\x4e\x79\x38\x0d\x09\x13\x53\x80\xfa\xc4\xb3\xf9\x8f\x44\x05\xa7\xb8\x37\xc8\x1e\x58\xc8\xd8\xc5\x5d\xd9\xcd\xd4\xd2\xe7\xd5\xa5\xdd\xf0\x8d\xe3\xf4\x2c\x78\xe6\x51\xb6\xb1\xe7\x58\x9e\x26\xfc\x16\x02\x76\xf4\x1f\x93\x0c\xa2\xaf\xb2\x82\x92\xa2\xdb\x1d\xd1\x25\xb4\xfc\x75\x0a\x8e\x08\xe8\xd9\xcd\x54\x6e\x87\xff\x2b\x8a\x66\xb1\x6a\x45\x57\x9a\x04\xd3\x08\x14\x74\xe5\xe4\xd5\xdd\x9d\x41\x06\x66\xe3\xad\x13\xaa\x23\x15\x7f\x00\xb9\x1e\xa1\xcb\xc9\x4f\x7b\x3a\x57\xef\x33\xb9\x76\xcf\x25\xe8\x85\xcf\xd3\x6d\xef\xc4\xd8\xbd\x49\x01\x2d\x1d\xdd\x28\x28\xc3\x61\x5d\xf4\xa6\xa6\xe7\x4e\x21\xe5\xf2\xa9\xd1\x6e\x6e\xe1\x73\xc7\x94\x60\x0a\x3f\x40\x93\x26\x28\x78\x8f\xf6\x39\x9e\xed\xbc\xea\xfc\xc6\x1b\xc7\x24\xf5\xad\xed\xe6\xee\x0f\x4c\x7b\x4f\xd2\x61\x1a\xaf\x28\x6f\x83\xbd\x61\x0f\xd4\x75\x7d\x6d\x77\x1c\x27\x19\x7f\x4c\xc6\xc7\xfd\x00\x77\x6f\xd1\x46\xf6\xe1\xe3\xaf\x6d\xdd\x50\x45\x59\x09\x6a\x50\xf7\x74\x52\xec\xfe\x20\xd9\xb3\xef\x79\x44\xe5\xc0\xaf\xc8\xdc\x53\x75\xbb\xac\x8e\x19\xec\x29\xb9\xeb\x91\x58\xff\x1b\x90\x23\x14\xd3\xee\x68\x05\x4b\xfc\x03\x05\x03\x41\x63\xa8\xea\x64\x3d\xf4\x83\x3c\x9c\x7a\x4a\xd4\x91\x90\x7a\x9d\x41\x75\x5d\xb1\xd0\x43\xb0\x2f\x77\x5a\xae\x5a\x07\x50\xcc\xa7\xc2\x3c\x9e\xfc\x63\x45\x34\x81\x04\x27\xce\xad\x5d\x4d\x90\x4a\x75\x89\x0b\xa9\x87\x17\x1a\xda\x97\xd0\x54\x17\x6f\x5d\x60\xf5\x18\x38\x6d\xfa\x99\xc0\xb9\x02\x44\x68\xb0\xd9\x41\x3a\xfa\x76\xd5\x75\x3e\xa1\x47\x7a\x9f\xdc\xdb\xc1\x8a\xfc\xfa\x0f\x21\xf7\xa3\x8d\xec\xd2\x16\x5b\x54\xec\xbc\x24\x0b\x10\xde\x2e\x92\x19\x54\xb1\x1a\x32\x5b\x34\x09\xaf\x3c\x10\xd1\xf4\x07\xc8\x8b\xb0\x50\x25\x76\x51\x0d\xdf\x55\xbf\x2c\xee\x44\xff\xc4\x36\x98\xfd\x34\xf4\x37\x9a\xf5\x66\x22\xe3\x59\x9c\xe6\xc9\x4d\x33\x18\x81\xde\xa7\xa2\x9c\x04\x4f\xa9\x2f\x35\xb4\x94\x03\x92\x07\xbc\x24\x37\x4e\x84\x54\xfa\xf9\x0e\xb8\xf0\xdc\x4f\x10\x02\xdc\x45\x5b\xfe\xa1\x98\x45\x66\xa6\x38\x5f\xde\xa3\x04\x25\x32\x0e\xed\x13\x57\xa6\x7c\xf2\x6e\x41\xc7\x60\xee\xed\xfe\x0d\x1d\x12\xd5\xea\xcb\xce\xea\x19\x0a\x76\xba\x42\xb5\xcf\x33\x3f\xa3\xfc\x37\x30\x07\x32\x41\xc1\xaf\x5b\xd5\x3b\xc7\x13\x8e\x5c\x29\xa3\x19\x6f\x24\xa8\x3d\x08\x47\x79\xa6\xdc\xdb\x6d\x8c\xf7\x39\xa0\x65\xcc\x2b\x1a\x49\xa8\x3e\x4e\xf0\x6a\xdf\xf1\x02\x5a\xff\x8f\xa5\x04\xe3\x87\x40\x8b\x98\x40\xa7\x17\x57\x0a\xc3\xdb\xce\xf7\x4a\x30\x1d\x82\x8a\x3d\x22\xae\xaf\x13\x5f\x92\xb2\x63\xdd\xcc\xfd\x87\xea\x3e\x20\x56\x45\xf2\xda\x62\x7d\x8e\xb1\x94\xf3\x3e\x10\x0e\x41\x19\xf8\xb2\xc8\xee\x69\x1d\xc9\xbf\x29\x20\xa1\x80\xad\x05\xe1\x37\x1b\xb6\xc3\x70\xd3\x96\xc1\xaa\xd3\x7a\x3f\xe4\x20\x9c\xff\x3f\xe8\x42\x8f\xf3\xec\xeb\xeb\xbb\x53\xbb\x5c\x20\xa8\x15\x06\x48\x00\xa2\x4b\xf8\xe5\xd5\x00\x36\x6f\xc1\xa6\x09\x01\x0d\xb0\xf8\x23\xe8\x6a\xa8\xbd\x3d\x28\x5a\x74\x9a\x68\x68\x3c\x7c\x28\xf6\xcc\x19\x7c\xdd\xab\xef\xca\x8d\xd1\x5a\x21\x2f\x4c\x98\xf4\xfd\xb7\x24\x9e\x6d\x80\xf8\x2d\xd1\x07\xb7\x0a\xb8\xfd\x0a\xb0\x7f\x24\x09\xa2\x59\xdc\x00\xda\xc5\xe6\x1f\x4d\xe8\xfe\x31\x21\xd9\xa2\x72\xdc\xba\x67\x76\xff\x1c\x45\xa6\xdf\x24\x7d\x98\x89\xe5\xcf\x2e\x32\xba\x00\xaa\xe4\xbd\xd2\x85\x84\x1f\xa6\xb4\xf4\x21\xe6\xe3\x72\xd8\xcf\xa5\x8f\x2b\xbe\xfe\x23\xa9\x46\xd7\x79\x0b\xec\x3f\xdf\x06\xdc\x6c\x33\x95\xfb\xcb\x3c\x92\xdb\x48\x2e\x6d\x92\xff\xfc\x1f\x02\x40\x81\x01\x54\xf4\xd1\xca\x12\x3b\x4f\xbc\x0b\x97\x77\x96\x77\xce\x72\x4e\xe2\x5f\x34\xf2\x46\x49\x59\x12\x45\x57\x5f\xbc\x88\xdd\xbf\x49\x6b\x4b\xd5\x3f\x33\xbb\xe5\xaf\x97\x06\x03\xa9\xb7\xdd\xf5\xa7\x58\x73\x78\xd3\x1b\x88\xd8\x68\x62\x96\x71\xeb\xc8\xdb\x70\x86\xd4\x3f\xd2\x3b\xfe\x08\x9b\x0c\x64\x4a\x30\xfe\xd1\x78\xce\x99\x7c\x95\x4e\xbe\xcb\xea\xf9\xf9\xdf\xb4\xa6\x40\x47\x25\xde\x15\x2a\xda\x15\xb0\xe8\x69\xe2\x42\xb3\xe6\xaa\x1c\x41\xdc\x3f\x13\x45\xbe\x70\x56\x55\xef\xaa\xee\x06\xbc\xf7\x99\x1c\x45\xbb\xd3\x5e\x7f\x0e\xf7\xda\xc6\x34\xfd\x47\x1a\x49\xdf\x7e\x22\xe2\x86\x85\xef\x52\x62\x2e\x18\x0e\x0d\x9b\x0c\xbc\x10\x98\x4b\xfc\x61\x3c\x4b\x1f\xb1\x22\x47\x39\xbd\x51\x85\xa1\x95\x77\xff\xee\x7a\x29\xe6\x32\xb6\xf8\xa1\x1f\xbe\xed\x40\xd0\x9b\x99\xc9\x9f\x9e\xfd\xda\xb8\xbc\x74\xee\x0c\xb4\x80\x1a\x16\x17\x43\xb3\x43\x5c\x48\x8c\x86\x1c\x45\xb9\xd0\x22\xbd\x19\x62\x93\xc4\xe8\x30\x21\x54\x0a\x62\xe7\x9b\x19\x02\xd1\xac\xaf\x08\x0d\x8d\xd1\xc9\x10\x0f\x25\xce\x9d\xed\x80\x40\xa0\x7e\x06\x8f\x41\x63\x93\xca\x1e\x46\xce\x46\xf4\x40\xb3\x64\x04\xc4\x10\x27\x2a\x8d\x1e\x9a\x5b\x29\x50\xbc\x65\x26\x7f\xea\x11\xe3\xbd\xcf\x04\xa4\x94\xe7\xc3\x96\xc4\x4a\x07\x87\x9f\x24\xfa\xd4\x8a\x01\x70\x1c\xd0\x84\x78\x80\x58\xb5\x74\x74\x2f\x68\xc2\x73\xed\xa1\xd7\x6d\xb7\x31\xf5\x86\x42\x72\x07\x82\xd1\x5e\x15\xc6\x82\x88\xc2\x00\x21\xc5\xc9\xdd\xe7\xca\x8b\xcc\xc5\x8c\x3c\x68\x89\x1b\x3f\xb1\xa3\x9c\xea\x73\xbb\xb5\x8d\xdf\xca\x1a\xb4\xa3\x12\x13\xe4\x16\xf3\xc3\x1f\x97\xf5\xc9\x63\x20\xa7\xad\x5e\x66\x1e\xac\xa8\x81\x79\x9b\x5a\x3a\x6f\xad\x49\x4e\x55\xec\xce\xd6\xc9\x7d\x0a\xd8\xfc\xc4\x10\xda\xd2\xa2\x6f\xbc\x2a\xce\x56\x4d\x57\x16\xd4\x13\x71\xa6\x2c\x52\xf9\xae\xd0\x3f\x27\x42\x16\xfd\x2a\xb2\x87\x6a\xa1\xa4\x25\x31\x44\x71\x01\x0f\x18\x00\x91\x51\x23\x21\xc4\x1b\x80\x68\xd1\x5b\x34\xd2\x41\xfa\x6c\xe6\x68\x7c\x75\x89\x8d\x4d\x5f\x7a\xd9\x80\xd7\x0c\x19\x01\xd5\x89\x84\x70\x52\xed\xd0\x21\x49\xb4\xfc\x05\x4c\x9e\x70\xf2\xab\x63\x34\xc4\xfd\x50\x90\x00\x30\x37\x70\x0c\xc2\x32\x23\x73\x6b\x05\x78\x8d\x47\xca\x7c\x16\x87\x21\x8a\x0e\x19\xeb\x34\x90\x9f\xea\x02\x85\x59\x7b\x9d\x9c\x3a\x3b\x41\x54\xcf\x1b\x3c\x72\xc7\x5d\x20\xa6\x11\x01\x74\x80\xaa\x0a\x43\xc5\xb9\xc0\x4d\x94\x58\xe4\xe2\xe9\xe7\x5e\x71\xf0\x9d\xac\x68\x96\x4c\x32\x84\x8e\xcd\x64\x2b\x82\x97\x9a\x30\x3e\x8d\x38\x29\x5a\x7a\x7a\xba\x53\x06\x39\x84\x78\x58\xdb\x27\xb5\x2e\x6d\xf7\xb4\x98\x6a\x51\xca\x2b\xa1\x07\x3c\x05\xc7\xc2\x16\x58\x82\xb0\x41\x52\x4c\xfa\x96\x24\x63\x7d\xfb\x98\xf4\x46\x53\x16\xa9\x64\x97\x5f\x4e\xae\x51\xdb\xe9\x29\xf8\xd9\x09\x95\xc3\x3e\x10\x25\xa6\xa8\xed\x62\x23\x7b\xcc\x3a\xa3\xff\x2d\x89\x38\x94\x42\x3a\x03\x8d\x5a\x36\x0e\xf8\xa7\x24\xdd\x16\x0f\xe2\x25\x40\x3e\x65\x82\xbe\x43\xad\xa4\x05\xa5\x29\x32\x37\x70\x28\x19\x32\xff\x79\xa6\x58\xf2\x98\x3c\xe8\x6f\x74\x76\x4b\x30\x73\x03\xd6\x2d\xce\x53\xde\xc7\x4b\xf2\xaf\xc4\x63\x57\x08\x63\xd1\x3f\xb9\xaf\x54\x4b\x0e\x0e\xa1\xaa\x43\x26\xb2\xe1\xe1\x18\xc8\x75\xec\xde\xa6\xf4\x6d\x6d\x8f\xdd\x13\xba\xf0\x10\xd5\xf6\x0f\x4d\x85\xa2\x90\x55\x9d\x23\xfc\xe2\x26\x88\x2a\x00\xdc\xb1\x7a\x97\x71\x90\xdf\x68\x42\x5c\x46\x83\x9f\x53\x69\xa1\x9a\xf9\x2c\x2e\x5f\x69\x06\xd7\x46\x72\x81\x9d\x46\x90\x6e\x42\x07\x5a\x1f\x1b\xf3\x33\xf3\xba\x65\x20\x2b\xb9\xee\x26\xcc\x26\x89\x56\x03\x47\x2f\x39\x51\x33\xda\xb6\x61\x93\x46\x66\x37\x96\x56\x5e\xe5\x7f\xef\x29\x54\xd3\x78\xa4\xf5\x8c\xf3\xd8\xd6\xed\xf2\x81\x01\x10\x66\x4c\x4f\x3e\xf5\xd8\x29\x23\x94\xaf\x2d\xae\x00\xf5\xba\xa7\x1a\x2a\x96\x34\x14\xf7\x7b\xed\x54\x98\x08\x13\x69\x10\x8b\xa1\xc3\x77\x5d\xa3\x55\xa1\xaa\x81\xba\x21\x02\x18\xf5\x8b\x59\x78\xcf\x76\x23\xa4\x7d\xe3\x81\xbb\xb1\x81\xad\x2b\x38\x9c\x04\xb7\xe6\xbb\x77\xd0\x65\xec\x22\xd5\xde\x4b\x03\xd9\x7c\x66\xc0\xd4\x2f\x1e\x98\x26\x9c\x32\x2c\x5b\xfd\x71\x77\x58\x48\x48\xda\xfe\x84\x22\x35\xbe\xa2\xaf\xfa\xcf\xd9\x0d\x4e\x04\x5f\x1d\xed\xb7\x10\x07\x0d\xc6\x14\xb7\xb8\xa3\x80\x4d\x1c\x24\x18\x93\x66\x77\xa5\x63\xee\x25\xb1\x89\x7d\x40\x68\x17\xf4\x93\x6e\x18\x87\x05\x99\x1f\x4e\x83\x5f\x50\xd8\x2b\x41\x22\xf3\x2d\x7a\xea\x20\x3f\xd0\x2b\x47\xe8\xc0\x8f\xe5\xa0\x6a\xce\xa8\xb0\x39\x28\x39\x1f\xb9\x5a\x17\x99\xdf\x09\x09\x07\x1c\xf5\x94\x38\xb8\x7c\x25\xcf\x9c\xbc\x0f\xa4\x22\x73\x8f\x6c\x20\x17\xf6\xce\x6d\xc0\x57\x04\x41\xdc\xf6\xe2\x1d\x77\x03\x3f\x7c\xda\xdb\x9b\xb1\x5a\xfe\x6d\xff\xbb\x23\xfd\x1b\x09\x8c\x17\xf9\x94\xc7\x9a\x85\xab\xfb\x3f\x17\x99\xbe\x97\x9d\x79\x85\x38\x61\xf7\xe1\x9a\xc4\x89\xb7\x31\xb5\x88\xc6\x81\xa6\x0f\x07\x4d\xb6\x6f\xad\xd7\x31\xc5\xbe\xba\x8c\x0e\xdd\xe6\xe3\x75\xdd\x4f\x89\xf0\x7c\xf5\xab\x85\x6b\xfd\xb7\x15\x4f\x9d\x5c\x5d\x61\xb1\xf0\x35\x9b\x7d\x13\xf8\xf3\xd0\x1b\xcb\xf1\x2b\xba\x1b\x8f\xb4\xbe\x6f\x1d\x7f\x43\xe2\x69\x8e\xbf\xb9\x59\x23\x19\x35\x95\x8f\xaa\x1a\xa6\x6c\x7e\xff\xc6\xf7\xfa\xb6\x66\x11\x61\xe6\x09\xb6\xa4\x4c\xb8\xc6\xaa\x91\xb0\x13\x15\x41\xcd\x6f\xa1\x57\x40\x25\xd7\x11\xf9\xc6\x0d\xe6\xb5\xbc\x3e\x88\x90\x0c\xf3\x3a\x2b\xd5\x07\x65\x9b\x4a\xf6\xce\x54\x18\xcd\x4f\xd4\x41\x4c\x1d\xaf\x73\xe8\x3e\x62\xa8\x5a\x1d\x4b\xfc\x64\x74\x84\xee\x01\x19\x22\x3b\x2e\x3d\x1d\x27\xaa\x05\x05\x8b\x53\x58\x6b\x4f\xfd\x05\x50\x67\x51\x99\x1c\x7a\xf6\x58\x74\xd5\xe7\x30\x84\x4f\xc3\x45\xe2\x29\xf6\x4c\xf6\x63\xc5\x44\x3d\xd0\x18\x1f\x1f\xc6\x66\xe4\xbe\x36\x3f\x9e\xfc\xca\x55\x5c\xdc\x25\xe3\xab\x90\x77\x58\xed\xec\x3c\xaf\xae\x87\x60\xb7\x33\x5c\x6e\x6e\x75\x54\xc7\xad\x71\x9d\x79\xfc\x9e\xa0\xa7\x36\x8d\xe1\xd9\x14\x37\xdf\xcf\x24\xef\x9d\x29\x36\xa3\xa5\x9b\x7d\x07\x2c\x66\x73\x9d\xb5\xf6\xfd\xa4\x51\x2f\xa7\xe6\x53\x27\x60\x26\x4b\x57\x89\x03\xdf\x9b\xd7\x96\x8f\xe4\x8a\xdf\x1b\x6b\x43\xe6\xb3\x78\xb2\x85\xd6\x1f\xc5\xd1\xd3\x8a\x5f\xda\x2a\x80\x13\x9b\x84\x75\x64\xec\x9c\xbb\xbf\x98\x57\xc4\x6a\x5c\xa3\x65\x75\xcf\x45\x61\x3d\x23\x98\xaa\xbb\x07\xf0\x5d\x93\x35\x1a\x9c\xd8\x61\x2e\x2a\x0e\xd1\x9d\xf0\x82\xed\xf0\xfd\x50\x63\xb3\x1e\xc3\xfb\xb9\xb7\x63\x5d\xbd\xf6\x16\x57\xe9\x0b\x14\x0e\x62\xf3\x7d\x72\x38\x33\x59\x13\xac\x17\x90\x6f\x7d\xad\xca\xa9\xeb\xa2\x10\x92\xa1\xee\x76\xc0\x75\xcf\xb1\xa9\x57\x8d\x6a\x40\x30\x50\xb9\xa7\x7b\xcd\xb4\x01\x02\x22\x5e\x05\x36\x8d\x13\xa9\x0b\xb9\x8c\x8b\xb8\x05\x0e\x3d\xbb\xe8\x74\x6f\xd8\x9f\x8c\xb7\x9d\xd7\x30\xfc\xe2\xd5\x30\x87\x97\xf2\x28\xea\x05\x77\x3d\x38\x33\x3d\x24\x70\x63\x67\x51\xdb\x01\x15\xb8\xaf\x02\xc2\xe6\x74\x61\x5b\x4d\x39\x2e\xd6\xfc\x67\x98\xd7\x4c\xf0\xab\x80\x44\x22\xf3\xf2\xad\x3d\x6c\xb5\x02\xe5\xeb\x81\x23\x25\xf8\xf8\x41\x19\x73\x8e\x3b\x41\xf9\x3a\xbf\x2d\x76\xda\xc4\x6b\x76\x13\x87\x8f\xc7\x40\x19\xed\x31\xe8\x56\xba\xa2\xa4\xd7\x05\xce\xc6\x18\x31\xef\x71\x87\x44\xa5\xf1\xcf\x86\x46\xa0\x96\xa3\x1b\x6c\xd0\xe9\xd7\xc2\x93\x76\xe1\x71\x87\xeb\x10\x21\x5b\xef\x1f\xd5\x7a\x53\x11\x1e\x74\xea\x0c\x85\x18\xb9\xef\xc6\x8b\xc9\x03\xfd\x79\x37\x6d\xa5\x87\x42\x62\x7f\xad\x38\x4c\x5f\x73\x0e\xb7\xc9\xb5\x10\xc6\x68\xed\x94\xdc\xc9\x19\x46\xaf\x19\xc6\xa5\xc4\xf3\x8b\x59\x88\x57\x95\x8a\x71\x96\x7c\x6c\xac\x48\x2b\x52\x42\x37\xe9\x12\x5a\x4e\x2c\x26\x50\x0a\x87\x19\xbf\x0b\x04\xb8\x7b\x39\x2f\x4b\x5f\xf2\x94\x6e\x64\x58\x5c\xcf\x07\xc3\x5f\x3b\x15\x6a\xbe\x57\x44\xc5\x24\x7a\x4c\xc5\xde\x2a\x09\x94\x6d\x5b\xfc\x70\xdb\x50\xf0\x28\xb3\x48\x43\x90\xba\xa1\x51\x66\xcb\xe2\xc3\xa7\x4f\x0d\x3f\xaa\xf8\x4e\x78\xc2\x6e\xe6\xbe\x38\xb7\xe9\x53\x7c\x44\x3e\x1b\x44\x4a\x6c\x3c\x88\x76\x41\x03\x7d\x90\x17\x32\x4e\x5a\x34\x8b\x14\xf3\xf1\x93\xb5\xee\x14\x0d\xe3\x1c\xa1\xc3\xc4\x74\x30\x93\xa0\x9f\x1c\x93\xa4\xc7\x44\xb3\x35\x4a\x70\xd0\x5b\xa9\x3c\x9d\xf1\x62\xef\x06\x4a\x58\x56\xc6\x8b\x93\x7f\x91\x28\x4f\xb6\x36\x9b\xcf\x44\x3a\x4c\xad\x99\x2e\xd2\xc8\xb3\xf8\xec\x55\x1c\x2b\xb6\xb0\xb4\xbc\xdb\xa7\xd2\xb6\xf8\xe1\xd2\xa6\x86\x12\x5d\xd6\x87\x47\x31\x22\x4e\x93\x87\xdb\x0d\xc1\x9f\xdb\xe6\x04\x25\x41\x8a\x3a\x18\xe9\xd4\x21\xcc\xde\x53\x00\x0f\xd3\xd9\x83\x66\x43\xa7\x82\x47\xa8\x70\x40\x34\x3b\xce\xa7\x84\x89\xa9\x97\x72\x5f\xec\xb9\x35\x4e\x54\x3b\x24\xe6\xd4\xf5\x80\x7e\x84\x6c\x2f\x18\xc3\x07\xea\xe5\xe0\xd0\xd9\xfd\x82\x88\x24\x89\xb3\x0b\x0a\x14\x5f\x42\x1d\xdf\xd5\x4d\x60\x11\x9a\x50\xbd\xb9\xaf\x26\x7e\x3c\x38\xea\xf7\xa2\xcf\x32\xea\x32\xfa\xb0\x5e\xd9\x5d\xad\x37\xcb\x92\x49\x36\x8b\xcd\x15\xb0\xdb\x04\x93\x77\x17\xae\xf5\x1e\x48\x1d\x54\xfa\x2d\x46\xe4\x6f\x43\xd6\x59\x6f\x79\x4d\xad\x37\x49\x0f\x34\x5e\xac\xde\xf6\x06\x85\x2d\xa5\x2f\xa3\x3c\xc7\xbb\x50\xa1\x60\x3c\x74\x5a\xf1\x04\x47\xb2\x2a\x46\xae\xe6\xc5\x9d\x6e\x72\x9d\x89\xe7\xfc\xed\x8f\x67\xc4\x2e\x98\x71\x1b\xd9\x2d\x7d\xe1\x1f\x09\x92\x7e\xf9\x23\xae\x6b\x19\xbe\x62\x77\xa7\xa3\x11\xe7\xa8\x6b\xcd\x4e\x62\x74\x59\xc7\xa3\x3c\xa7\x32\xef\x55\xd1\xe0\xf2\xa8\x1a\xcd\xdd\x28\xbc\x3d\x31\x58\x13\xa8\x07\x09\x83\x29\xc6\x81\x8a\x82\xfa\x2b\x5e\xf6\x91\xf4\xf2\x52\x92\x29\xe8\x3f\x0e\xf1\xc1\xa7\xe0\x11\xf4\x4f\x5a\xaf\x63\x36\x3a\x8a\xc8\x60\xfb\x32\xd3\x64\x04\x14\x0e\xf5\xd6\x22\xc7\x1e\x6d\x2b\x59\xfb\x66\x72\x44\x58\x9a\xf9\x60\xa6\x79\x71\xf1\xa8\xda\xfd\xa3\x04\xbc\x3c\xf5\x28\xd4\xc2\xd2\x4a\xfb\x3a\xda\x16\x75\xb3\x43\x05\xdb\x65\x03\x33\x2e\xb2\xcd\x59\xe0\x1c\xf6\x9b\x1c\x0e\x3c\x9f\x78\xf8\x0b\xaa\x39\xc7\x7e\x17\x06\x79\xc3\xbb\x20\x82\xc3\x0e\x91\x3e\xab\x80\x39\xe1\xe8\x41\x8d\xaf\x2d\x25\xe9\x08\x2b\x8a\x1d\xab\x8d\xe2\xa9\xa1\x34\x99\xff\xac\x37\xd0\x1e\xa3\x37\xd0\xed\x5c\x57\x49\xe1\x94\x63\x92\x33\x18\x34\xd3\x85\x72\xe8\xd9\x11\xe8\xd9\xb0\xfb\x1f\xcf\xab\xab\xa2\xeb\x22\xc8\xd3\xb0\xba\xca\x87\xce\x1f\xa9\xd2\x47\xae\x58\xad\x3a\xb6\x1e\xd1\x03\x46\x36\x53\xcd\xcf\x6e\x12\x15\x4f\x4c\x4b\xdb\x68\xc7\x2d\x04\xd4\xf3\xf1\xbe\x12\xf7\x8f\xfa\x4c\x6c\xf6\xc4\xd0\x8d\xbf\xb2\xb5\x61\x53\x5e\x23\xcd\xbe\x09\x0b\x98\x45\x4c\xba\x1e\x78\x0a\x18\xc7\x24\x2c\xa1\x9a\xe0\x80\xbc\x2e\x51\x7d\xd9\xf2\xa2\x65\x83\x16\xeb\xb3\x87\x77\x8d\xeb\x34\xda\x32\xe9\x8a\xf6\x2d\x15\x80\x76\xdc\xa3\x69\xd6\xc1\x9a\xb3\x0b\xab\x83\x1d\xff\xf4\xfc\x42\xbd\xaa\x62\xf7\x4c\x12\x87\xec\xb0\x12\x5a\x28\x47\xad\xa3\x7e\x78\x7d\xbd\xa7\xf7\x7a\xff\x19\x71\xee\xfb\x3f\xa6\x7f\x86\x4d\xfe\xa4\xf5\xfa\x92\x97\x80\x6f\x61\x72\x2a\x4a\xc9\xff\x06\xd4\x4b\xbf\x92\xbd\x0c\xb5\x98\xba\x07\x1e\x03\xde\x11\xb8\x9c\xb7\xe1\xbd\x70\x1f\x2a\xe3\xf7\xdf\x23\x3f\xd3\xbb\x73\x85\x3f\x9f\xd2\xe2\x74\xf4\xaa\x24\xa6\x3e\x3e\xbc\x6e\x68\xac\xc9\x9e\x23\xb8\xf0\x3b\x12\xa9\xaa\xc2\x18\xeb\x03\x63\x7d\x77\x33\x75\xb7\x8e\xc1\x8e\xdf\x63\xe3\xd8\xc9\xe7\xe6\x28\x98\xe3\xb4\x30\xd8\x7a\x6a\xe9\x4d\x53\xad\xf3\x9a\x00\x4d\xa5\xc6\x24\x8d\x20\x39\xa3\xe5\x5b\x03\x1c\x19\xdd\x6d\xc9\x8d\x18\x34\xfc\x9e\x96\x3d\x03\xb0\x0e\xa8\x33\xd0\x06\x0a\x49\x5f\x70\x46\x28\xac\xa8\x34\x89\xc5\xc8\xed\xdb\x06\xeb\x13\x02\x75\xfc\xf1\xc3\x7c\x45\x5f\x0a\x49\xe5\xd5\x91\x63\x12\xfc\x3b\x44\xf0\x88\x36\xec\x47\x9a\x01\x5c\x01\xbf\x9c\x36\xf7\xf9\x29\xba\x0e\xef\x6d\x43\xa3\xfa\x04\x64\x8c\x45\xdf\x0b\xe4\xff\xd4\xf0\x8a\xd0\x82\xc6\x3b\x06\x5d\x23\x1d\x17\xfb\xff\x82\xf7\x96\x0e\xa1\x49\xec\x02\x82\xbf\x17\x08\xa0\x2a\xd2\xbc\x79\x13\x02\x4a\x13\x5b\x6b\x36\xfa\x59\x7c\xe9\xa5\xc7\x68\xa9\xc1\x66\x52\x16\x51\x54\x3a\x9a\xa9\xde\x5e\xae\xb5\xe6\x6f\x64\x4a\xda\x0e\x55\x9b\x6e\x75\x8a\xeb\xda\x5a\x6b\x61\x87\x86\x1e\x0e\x38\x36\x92\x5a\xa0\xc9\xc1\xc1\xfe\x97\xbd\x03\x0e\xba\x3f\x48\x39\x07\x6e\xb6\xb0\xef\x4b\x1d\xd9\x61\x77\x57\x42\x0e\x10\x9d\x02\xb9\x9b\xf6\x05\xc9\xfe\xc0\xf4\x50\x97\xc8\x51\x2e\x56\x61\xd7\x9f\x1f\x18\xf2\x92\xa1\x3f\x3d\x3c\x25\x35\x94\x02\xbc\xa7\x2b\xc6\xf3\x47\x50\xff\x94\xc6\x63\xe8\xa8\xc2\x0b\x65\x5d\xc7\xfc\x10\xd7\x38\xfe\x08\x7b\xb1\x8d\x1e\x42\x52\x48\xf8\x91\xc4\x3e\x00\x52\x4f\x52\x4c\xe7\x2c\xa8\x7b\xb2\x32\xa3\x1b\x11\x50\x2c\x58\x5b\x2d\xf1\x83\x8c\x6d\xa0\x59\x36\x35\x7b\xdc\x9d\x61\xf4\xc5\x0f\xfd\xe8\x20\x05\x7b\x66\xf3\xa7\xdd\x51\x2e\x2a\xcf\x1b\xbf\xa4\x00\xd9\x80\xdc\xac\xf9\x3e\xb1\xee\x3f\x72\xe2\x0c\x28\x84\xf8\x97\xff\x9e\x41\xf3\xb8\x20\xdd\x73\x05\xcc\xb6\xe7\xfa\xb9\x12\xa7\x9b\x10\x90\x39\x20\xee\x1f\xe8\x87\xfd\x53\x0e\xc7\x11\x81\x4f\xb5\x86\x86\xf9\x7f\x99\xc6\x22\xef\xa6\x1c\xd5\xda\xb8\x67\x86\x8c\xfa\x8a\x8b\x98\x2e\x32\x4f\x0d\x5f\x2e\x18\xfe\x8d\xd1\x0b\x17\x29\x34\x74\xd5\xd8\x87\x79\xa3\x20\x29\x27\xf5\xfd\x87\x44\x16\x33\x64\x52\x5b\xc8\xc5\xe8\x0c\x7f\xeb\x1f\x68\x1e\xfb\x95\xfe\x2e\x24\xf6\x93\xcd\x1f\xe9\x27\x6a\xba\x14\x44\x6d\x5c\xcd\x93\x2c\x5d\xcc\xbd\x85\x9f\x53\x55\x7e\x0c\xd2\x1c\xa3\x67\x28\x90\xc1\x20\xbc\x04\xe8\x2f\x54\xc4\x78\xef\x7b\x0b\xc6\xa2\xd7\xfd\x53\xac\xff\x4f\x7e\xf4\xf0\x7f\x7d\xd4\x8f\x9f\x39\x83\x5f\x27\xb4\xbe\x2d\x0f\xf2\x53\xc4\xda\x6f\xe1\x80\x88\x0c\xaa\x9c\x4a\x40\x81\xa7\x80\xa4\x6d\x4d\x4b\x86\xf4\x5a\xb3\x49\xe3\x39\x89\xda\xd7\x57\x3e\x3d\x98\x7d\xa6\x0f\xc6\x1f\xa1\x73\xad\x97\x09\xa3\x0a\x0f\xe1\x65\x41\x3e\x5e\xac\x02\x88\x2e\x71\x54\xf5\xae\x5e\x38\xc3\x8b\xad\x7e\xfe\xdc\x07\xc9\xa5\x47\xb0\x3f\x30\xe9\x77\xc4\xbe\x24\xf8\x3f\xb3\xad\x14\xc0\x12\x6c\x72\xee\xcf\x25\x45\xce\x54\xd6\x3d\x8f\xa2\x63\xee\xaf\x5f\x27\xfd\xaf\xac\x0e\xf9\x06\x5d\x6c\x7b\x2f\x53\x26\x15\x60\xeb\xd8\x56\x4c\x0f\x66\xd7\xdf\xd9\xce\xe5\xd1\x57\xfd\x2b\x1b\x23\xa9\x01\x3f\xf1\x46\xf7\x1c\xcb\xaa\xe7\x7d\xed\x99\xfe\x32\x92\x49\xd9\x37\x72\x87\xb5\xed\x7f\x0c\x42\x2e\xb2\x74\x6c\xc3\xc7\xf6\x1c\x83\xa2\x79\x83\x0d\xb1\xc0\xad\x3b\xff\xce\xd9\x34\x87\x71\xe9\xf4\xf6\xf6\x69\x67\x0b\xec\xea\xcc\x6e\x4a\xb7\x9c\xe0\xd2\x5b\x2e\x43\xe1\x5f\x09\x22\xfa\x2e\x40\x83\x45\x1e\xcb\xcd\xd2\xac\x3d\xac\xd0\x7d\xee\xf7\x88\xa4\x3b\xff\x4d\x0e\x49\xeb\xa1\xc8\xcf\x49\xf7\x1b\x44\xb4\x22\x3b\xa1\x35\xed\x86\xf1\x0e\xd8\xbf\xa7\xb8\x41\xca\x24\x3d\x8f\xfa\xf5\xab\xfb\x6e\x5b\x42\xcc\xc1\x88\x3b\x93\x24\xe6\x9b\x33\x50\xb6\xb3\xd4\xbf\xf3\xbe\x31\x3e\xee\xc3\x62\xcc\x19\x1e\xf8\xa0\x61\x7b\x9c\xc8\xcd\xa2\xb7\xbd\xfd\xc3\x07\xaf\x67\xfa\xbf\x20\xfe\x95\xdb\x42\x27\x45\x1c\x4d\xca\x86\x2e\x96\xc1\xdc\xb3\x81\x3e\x02\xda\xe2\x7a\x03\x39\x20\xef\xc0\xba\x7f\xa7\xf0\x48\x32\x20\x6d\xe2\xff\x29\x37\x6b\x21\xb6\x3d\x5f\xe2\xdf\x13\x38\x88\xb0\xf3\xcd\xce\x4f\xd3\x0b\x28\x67\x3e\xb2\x49\x3b\x6d\x9f\x66\xcd\xef\x31\xfb\x8f\x6c\xb0\x23\x88\xac\xf9\x3d\x9c\x49\xd6\xb8\x69\x05\xb3\xed\xb9\x15\x2d\x26\x1a\x38\x18\x13\x0d\xfc\x9c\x99\x45\x42\xa3\x1f\xf5\xb0\xa3\xe6\x45\x4e\x9c\x49\x56\x69\xc1\xb7\x85\xa1\x39\x11\x76\x7e\x0f\x67\x44\x95\xee\xdd\xb6\xf8\xf8\x68\xbb\xe6\x1e\x21\xf6\x25\xe8\xb8\x31\x4a\xa8\x2a\x01\x88\xda\xb8\xe8\x80\x38\x66\xdb\x73\xc6\x87\x79\xa3\x9e\xe6\xd9\xdf\xc3\x2e\x46\x1f\xf0\x45\x3f\x2a\x6f\x59\x9a\x0b\x00\xe6\x45\x4e\x34\xd8\x5c\x7f\xc6\xca\x5c\xa4\xd3\x80\x2f\x0c\x3b\x8c\x6c\x86\xea\x4b\x73\x9f\x22\x00\x3e\xd1\xca\xc6\xa6\xdc\xd1\xe3\x1c\x58\x5c\x5c\xdc\x5c\x0e\xc4\x8b\x11\x80\xa8\x8d\x83\xd3\x1a\xfa\x44\xf5\xae\x7e\x1f\x81\x22\xe1\x70\xb7\x62\x78\xf3\xc2\xcc\xdf\x6e\x88\x7d\xbb\xd0\xe7\x95\xe3\x56\xfc\x2e\x89\x25\x6d\xdc\x04\x58\xa2\x0f\xb0\x2b\x62\x9f\x3e\x7d\x7a\x54\xd1\xde\x40\xc0\x84\x1d\x4e\x20\x35\x82\x4b\xf2\x16\x24\xa9\x05\xad\xb3\x5f\x37\x84\x55\x25\x1d\x6a\x5b\x7c\x2c\xa0\x21\xc0\xa3\xe2\xb9\x2f\x94\x6a\x38\xbf\x2d\x09\x5d\x4a\x17\x7f\xc1\xf5\x84\x10\xff\x8a\x5d\x9c\x61\x3a\x4b\xe9\x1b\x21\x66\xc8\xa4\x63\x80\x65\x6a\x26\x03\xf1\xca\x55\x2b\xe3\x2b\x82\x29\x6d\xdc\x84\xae\x67\xaa\x2d\x0c\x8b\x1a\x6c\x6b\xb1\x5f\x91\xd3\x06\x65\x40\xfc\x08\xba\x6f\x9c\xa4\x36\x83\xa4\xa1\xae\x5e\xb8\xa4\x9b\xfa\x82\x37\x91\x1d\x5c\xba\x97\x1e\xad\x85\x81\x2d\xd6\x17\x38\x5c\x81\x7a\x75\x1c\x9b\x10\x90\xba\x98\xa0\x03\x13\xb5\xcd\x04\x33\xa4\x5b\x68\x4b\x34\x22\xdb\x3b\x4a\x23\xbc\x51\x3d\xc9\x3b\xdf\x79\xa6\x91\xc6\x1f\x3d\x27\x1d\x27\xb8\xf4\x43\x3b\xf8\x23\xe8\x02\x92\x0d\x6c\xa2\xa2\xac\xa2\x2d\x7b\xdc\xfd\xb3\x4a\xde\xa9\x28\xce\x09\x1f\xf0\x54\x54\xa0\x54\xed\xba\xce\x33\x4e\x17\x73\xc8\x6b\x18\x28\x2e\x4f\x27\x81\xa8\x20\x1a\x16\x35\x98\xc6\xba\x2c\x50\x9a\x81\x9b\xa0\x1f\x72\x9f\xfc\x92\xc8\xc2\x60\x9d\x6e\x66\xd9\xbf\x4f\x83\xea\x60\x52\xdd\xf8\x10\x9a\x01\xb2\xe3\x51\x60\x33\xbf\x4d\x7e\x88\x8c\x20\xe2\x54\xaf\x56\x69\xe5\x9e\x4c\x1e\x50\x33\x90\xd5\x88\xd1\x5d\x4b\xc5\x29\xd6\x29\x5f\x17\x14\xaf\x13\xed\x2a\x50\xae\x13\x30\xc3\xd0\xcf\xa0\x5e\x7a\x94\x5c\xdb\xe2\x63\xf5\xd0\x2f\x3e\x69\x40\x99\x6c\xc1\x2a\xa8\xc6\x2f\xf5\xa1\xd8\xf1\xa5\x25\x18\x55\xe1\x9b\x60\xd7\x0a\x66\xd7\x8d\x0f\xe1\x52\x80\x42\x16\xa4\x63\xa0\x0d\xd9\xcc\x20\xdf\xa0\x55\x62\xd7\x59\x4a\x98\x7f\x80\x9d\x48\x4c\xd9\x1e\xb7\x4a\xdd\x41\x41\xef\x5d\x40\x22\x11\xf4\x14\x15\x0f\x0f\x5c\x5f\x65\x8b\x01\x23\x69\x54\xad\x73\xe4\xf0\x35\x09\x26\x22\x01\x3f\x45\x4c\x4b\xda\x20\x2c\x0f\x63\x0f\xe3\xf0\x50\x95\xcd\xf5\xae\xcf\x52\x69\xf5\x80\xdc\xeb\x28\xfb\x90\x59\xd5\x2f\x97\xb4\x8e\xa1\x1f\x95\xbb\x0a\x37\xd9\x08\x2d\x85\xaa\x17\x3b\x9a\x49\x0b\x23\xb9\x45\xa1\x40\xfe\x01\x68\xf8\x33\xc9\x74\x20\x0c\xd6\x25\x0b\x37\x9e\x3b\x99\xdc\xe0\x36\x58\xec\x94\xbf\x57\xf7\xb3\x4c\x8c\xc8\xc4\xf8\x32\x39\xf5\xe4\x3e\x1e\xfc\x45\xb9\xb0\x9b\xc6\x71\x83\x86\x45\xd1\xe5\x46\x05\x1f\x50\x49\x9d\x9a\xf5\x7f\x7d\xf4\x17\x22\xa8\x27\x34\xea\x16\xe2\x46\xa7\x90\xa1\x93\xf2\xef\x68\x28\xf3\x85\xda\x73\x5a\xa9\x98\xd3\x53\x6c\x92\xbc\x23\xed\xd2\x61\xa8\x10\x01\x39\xbc\x3c\x27\x65\xc9\x8e\xb0\x81\xc6\x86\x71\xf7\x22\x2b\xdd\xc5\x16\xdc\x88\xc1\x8c\x7c\x8e\x7b\x17\x28\x78\x13\xfc\x3a\x65\x4b\xa4\xe3\x0d\x93\x10\xce\x01\xa4\x60\xbe\x40\x8f\xcc\xe5\x9c\x0d\x48\x34\x05\xb7\xb1\x4b\xac\xf0\xf9\x94\x73\xd9\x80\xca\x74\xc8\x1c\x76\x8f\x88\x93\xfa\xae\xf7\x71\x8e\x97\xb2\x3d\xc6\x1b\xa0\x66\x1d\x20\xec\x18\xfe\xd8\x2d\xd5\x55\x73\x9b\x55\xa9\x7c\x3d\x50\xd1\xb2\x0c\x52\x1b\x7e\x6d\xdb\xff\x19\x68\x15\x12\xb7\x76\xdb\x24\xb1\x96\xd8\xb3\x85\x5a\x6a\xdd\xdb\x81\x48\xf3\x37\xc7\xc4\x3b\x04\x03\xc8\xea\x13\xd3\xa0\x2b\xc7\xfd\x33\x58\xc7\x0f\x3e\x7a\x3a\xe9\x86\x09\x86\xed\x6e\x00\x53\x9e\x0d\x8e\xa4\x1f\xc8\xc9\x4e\xbd\xd3\x5f\x37\xc6\x30\x35\x02\x99\x6d\xcf\x05\xad\xb9\xb6\x72\x2f\x6a\x8b\x07\xe7\x7f\x76\x10\xf6\xa0\x6b\x37\x9c\x16\x5f\x92\x03\xd6\xc5\x6c\x4d\xf9\x39\xc1\x52\x98\xd4\x49\x34\x99\x10\x6f\x88\x00\x6c\x1a\x1c\xd9\x52\x21\xb6\x2e\x93\x0e\x68\xcd\xba\x97\xe3\x2f\xc5\xd8\x68\xd1\x7c\x3b\x10\xb2\x3e\x03\x63\x13\x0e\xb6\x35\xa1\x9f\xa4\x60\xcc\xd6\x7a\x4c\x83\xd9\xdd\xa8\x16\x61\x94\x2c\xb7\x22\xbf\xc8\x64\xcb\x65\xa3\xdb\x55\x31\x36\x27\x31\x9d\x94\x23\x15\x3a\x4c\x83\xc2\x3b\x0e\x46\x02\x5b\x4c\x6a\x5d\xbd\x2d\xec\xdd\xcf\x1e\x51\xb0\xb3\x3e\x9e\xac\x45\xf5\xfe\x0a\xb0\x3f\x31\x8f\xeb\xf6\x65\xc3\x5e\x44\x7f\x85\x0c\x76\x88\x5e\x68\xa4\xeb\x0d\xa9\x7d\x26\x37\x31\x59\xe8\xd8\x71\x65\x71\x7b\xbe\xf2\x2e\xde\x00\x0f\x4a\x4b\x01\x7c\x3b\x80\x5a\x41\xc0\xc2\xc5\x0f\x9f\x77\xd4\x0a\x34\xeb\xc1\xb0\x56\xec\x2b\xb4\xd1\xa0\xab\x64\x2a\xf6\x51\xf1\x51\x35\x66\x69\x5d\x1d\x15\x97\x32\x9f\x3c\x3f\xdf\xdf\x07\xc6\xde\x6a\xcf\x3a\xac\x79\xd6\x78\x3a\x72\x57\x29\x51\xe1\x8f\x88\x39\x53\x17\x85\x76\x9d\xaa\x52\x52\xd5\x71\x26\x8b\x57\x52\x17\x50\xb7\x10\xf7\x46\xe1\xcd\x7a\x91\xe3\x8d\x60\x45\xd7\x66\xc0\x0d\xd4\x2b\xeb\x50\xda\x28\xac\x59\x6f\x34\x15\x7e\xaf\x6b\x1b\x4e\xb1\x6a\x24\x37\xa2\x6a\x73\x12\x87\xfe\xe2\xc3\xf8\x14\x9d\x27\xc2\x66\x93\xde\xde\x95\x39\x29\x3e\xd3\x00\x62\xbe\x20\x9b\x49\x2a\x7b\x1c\x5f\xa5\xf0\x2c\x05\x8c\xbe\xde\xc1\xd5\x48\x58\xf3\xa1\x90\x74\xbc\xce\xaf\x0f\x3c\xed\x07\xba\xa5\x19\xb5\x8c\xc1\xbb\xdd\x34\xc7\x97\xb3\xd8\x99\x62\xf7\x68\x64\x7b\x47\x94\x6c\x5e\x89\x8c\xd8\xb4\x77\x78\x70\x1e\xa9\x07\xbb\xe2\x9d\x48\xbd\x45\x3f\x26\x92\x46\x4e\x5d\xc1\xa4\x3f\x27\xd1\x40\xcc\xce\x2c\x3f\x87\x73\x89\x03\xe2\x4b\x74\x88\xc0\xb2\x89\x80\x88\xe3\xa8\x59\x3c\x26\xf5\x29\xe9\xb7\xf3\xf6\xb3\xf3\xa6\xf0\xaf\x5f\x51\xa1\x62\x23\x92\x98\x99\xe3\xa3\xea\xa5\x71\xd1\xa6\x1d\x57\x3e\xc1\x14\x58\x7a\x05\xea\x9e\x93\x8d\xe9\x64\x32\x82\x5e\xe7\x5c\x25\x66\x98\xdf\x2a\x32\xf5\x60\xe2\x3e\x82\x25\x75\x8a\xdc\x02\x23\x92\x46\x4a\x4d\xe3\x13\x28\xa7\xed\xe0\xf1\x0e\x3a\x17\x36\x3a\xa1\xed\x20\x3a\x7f\xc1\xb8\x39\x58\x8e\xc9\x44\x7d\xc5\x45\xbd\x7d\x0b\xb6\x53\xf5\x6b\xc4\x01\xd0\x43\x6a\x5e\x1b\x88\x4b\x91\xb0\x64\x41\x7a\x19\x63\x74\x8e\xa8\x58\xcc\xb2\xd4\xf5\x07\xec\x65\x11\xc1\x0f\xce\x7c\x06\x7e\x03\xcd\x61\xe7\x2e\x5a\xaf\x6a\xf7\xe3\xe0\xa5\xab\x54\x50\x02\x85\x97\xca\x1a\x5e\x81\xba\x47\xee\x45\x26\xe2\xe9\xd6\x5f\x4d\x31\xa3\xd2\xb6\x39\x59\xe4\xf0\x40\x07\x44\x67\xa0\xe6\x5f\x2c\xf9\xee\xd7\x06\xfe\x4e\x7d\x04\x79\xf6\xa6\x24\xda\x6a\x4f\xd5\x58\xd7\xc3\x00\x21\xa7\xb7\x14\xb2\x2c\x0b\x4e\x8e\xd8\xf1\x32\x63\xd8\x02\x0e\x88\xb1\x53\x38\x5e\x7c\xef\xcc\xbb\x25\x28\x3a\xf9\x0c\x62\x9e\xb2\xbb\x2b\x44\x81\xfe\x8b\x6d\x17\xb7\x84\x43\x67\xa6\xc1\x07\x53\x14\x12\x5c\x97\x26\xcc\x87\x8a\x92\x07\x8a\x4a\x87\xfc\xec\xcb\x50\x7b\xb3\x8c\x65\x75\xd9\x45\x67\xce\x25\xd6\xe8\xe8\x5e\x01\xca\x4a\x43\x03\x49\xe6\xa7\x5f\xdf\x0d\x8b\x7f\xeb\x70\x5c\x65\xda\xf5\x46\x8a\xf6\xf4\x19\xdc\xf5\xd1\xd5\x22\x38\x93\xf4\x10\xdb\x27\xf5\x58\x9c\x7d\x0b\x2d\x9a\xe7\x06\x2b\xd8\x3b\xa1\x14\x7f\x91\x14\x2e\x21\x33\x9f\xbd\x51\xb7\xdb\x68\xe8\x74\xb1\x80\xf2\x65\x77\x47\x04\x12\x48\xfe\x20\x38\x9e\x64\x3f\xf9\x48\x82\x9a\x5e\xa0\x85\x79\x6a\xe4\x54\x7f\x72\x6c\xb4\x28\x2a\xfe\x64\x32\xfe\x75\xc1\x4b\xfb\xde\xcd\x34\x41\x44\xa4\x0d\x93\xf3\x28\x39\x4a\x49\x6b\x10\xe3\x1d\x5c\xd1\xe4\xae\x16\x41\x8b\x62\x72\x60\xfb\xe4\xde\x37\xfb\x54\x82\x98\x66\x76\x4b\xe0\x75\xe0\xb7\xcb\x20\xbb\x22\xf6\xa8\x25\xf6\x0a\xf9\xff\xa3\xe5\xca\xe3\xa1\x5a\xff\xff\xc1\x60\x24\x4b\x52\xba\x09\xa3\x94\x94\xa8\x6e\x91\x75\x2c\x75\x93\xbd\x68\xbf\x8c\xad\xb4\x58\xca\x6e\x26\x06\x59\x8a\x5b\x84\x9a\x4a\x19\xba\x22\x3b\xa9\x51\xcc\x18\x92\x90\x8a\xb2\x8c\x31\x66\xc6\x56\x98\xc1\x58\x66\xcc\x8c\x59\xce\xef\x35\xee\xfd\xfd\x6e\xdf\xfb\xfd\xfb\x77\xfe\x9b\xf3\x79\xce\xf3\x3e\x9f\xe7\x33\xcf\xf3\xbc\xdf\xe7\x7d\x5e\xe7\xf3\xef\x53\x0d\xa0\x1b\x7f\xb8\x49\x81\x87\x99\xd4\x69\xec\xd8\xd6\xfe\x66\x58\x74\x90\x5c\x8d\x36\x18\x9b\xe9\x31\x36\x7b\xd4\xd9\x5d\x5b\xe8\xb3\x42\x47\x6e\x1a\xec\x25\x10\x56\x02\x59\x4b\xed\xcb\xb8\xc1\x3b\xde\x99\xa1\xb3\x6a\x09\xaf\xfc\xbf\x69\x26\x4b\x78\xfd\x59\x0c\x2d\xbb\x1c\x05\xc5\x8a\xb0\xb3\x2c\x92\xc0\x2e\xa4\xb0\x5e\x69\x81\xc4\x6c\x2c\xd2\x06\x98\xa1\x28\x31\x7b\x2b\xa5\x53\x22\x59\x62\xc4\xb5\xe3\x36\x06\x62\x9c\xfc\x30\x6d\xc9\x5c\xc2\xa4\x67\x40\x1e\x77\xa1\xfb\x02\x48\x9a\x8c\x46\x81\x2a\x4c\xf8\x9f\x1c\x63\xd9\x0a\x53\x36\x73\x9a\xe6\xcd\x59\x1c\x29\x40\xc6\x5e\xeb\x39\x03\x30\x8f\x78\x1b\x1f\xa9\x13\x7f\xca\x64\x55\xef\xd0\x4c\xb0\x3b\x43\x9f\x8a\xdc\x34\xf3\x32\x46\xf3\xfd\xa0\x6b\xde\x56\xa9\xa9\xbf\xd4\x4d\xed\xcb\xa9\xe0\x6d\x47\xb9\xaa\xa7\x44\xb3\xf1\x59\xe1\xf3\xeb\x2b\x40\xa6\x3d\x08\x7b\x78\x55\xc5\xa6\x77\x05\x43\xb7\xa2\xd0\xab\x35\x84\x5d\x0b\xc6\xdb\x81\x97\xe0\x38\xe2\x19\xf1\x34\xe5\xc1\x84\x8e\x9d\x14\x13\x1e\xb5\x9d\x92\x3f\x32\x31\x59\x6c\x37\xd8\x34\xa0\x28\xb7\xff\x53\x48\x10\x6b\x13\xed\x98\x8b\x45\x1b\xfe\x39\xec\xc1\xb3\x43\x98\x85\x91\x30\x59\x9b\xc6\xa1\xed\xa7\xa3\x6d\xeb\x13\x2b\x04\x83\xf7\xb3\x9e\xe0\x53\x1e\xa2\x15\x64\x7d\xa0\x4d\x44\x1a\x18\xae\x0c\xe8\x8e\xe8\x2c\x71\x87\x0a\xd4\xc1\x6f\x5c\xc9\x96\x0f\x97\x41\x57\x67\x65\x78\x8d\x5e\xdd\x95\x44\x20\xc5\x4a\xed\xbc\x3f\x36\xb8\x51\xec\x35\xd4\x1c\xa2\xea\x6f\x11\x74\x33\x87\x1c\xf4\x5c\x49\xa2\xfc\xdc\xb8\xcb\x0c\xec\x73\x97\xb0\x08\x0d\x3f\xd9\x2c\x6a\xf4\x09\x32\x4e\xf0\xed\x35\x10\xdf\x50\x8f\xa1\x49\xd5\xc8\xfc\x1f\xcb\x4c\x15\xd7\x16\x22\xce\xf5\x6d\xc4\x9b\xf0\xa6\x88\xd3\xd2\xc7\xb9\x6b\x9d\x09\xdc\xa3\xfe\xa7\x1b\x34\x92\x82\xba\xb3\x84\x4f\x26\x7e\x53\x6d\x91\x83\x1d\xe3\x47\x9d\x79\x22\xb4\xd2\x8f\xb6\xbd\x71\xc1\x22\xb4\x41\x6d\xff\x72\xb4\x48\x2d\x46\x4c\xcb\x9e\x91\xaa\x91\xfd\x5f\xb6\x04\xf7\x40\x57\x5b\x74\x39\xa1\xb6\x96\x6a\x58\xfc\xe6\xbe\x11\xb5\xe4\xe9\x28\xfb\x0c\x83\x7c\xde\x1c\x1a\xf6\x65\x1f\x40\xee\xd1\xa7\x24\x28\xd9\xbc\x7d\x7b\xb5\x48\x2b\x7f\x6e\xf6\x48\x9a\xed\x0f\x86\x76\x12\x2b\x54\x25\x41\x22\x7a\xb8\xc2\x13\x7f\x31\x3c\x44\x02\xb1\xe3\xc3\xbb\x4c\x2e\xd2\x58\xb5\x68\x78\xdb\x08\x27\xec\x12\x76\xcb\x53\xab\x8a\x12\x9a\x32\x7e\x6f\x16\xfb\x64\x82\x5c\x00\xf6\xd0\xa3\xcf\xe9\xca\x36\xff\x10\xb0\xb3\x2b\x28\xa9\x17\x95\x35\xa1\x8c\x7d\x6f\x3f\xb3\x9a\x5c\x82\x58\x69\x5e\x9d\xf9\xe1\x77\xa5\x9a\x99\xb2\xd9\xf9\x7b\x29\x1e\x0f\x57\xcc\x33\x0b\x55\x00\x5a\x5b\x62\x85\x32\xa0\xfc\xd3\x75\x02\x54\x0a\xfa\xbc\x2f\x8b\xa3\x5e\xe4\xbd\x96\x52\x18\xff\x72\x90\xc8\x34\xf9\x78\x10\x98\x8e\x64\x2a\xc9\x1a\x8e\x5a\xc3\x66\x67\xbc\x64\x3b\xbf\x9e\xff\xc7\xa9\xe9\x1e\x42\xe8\x45\x42\x19\x5b\x4b\x5a\x6d\xbe\xd5\xd9\x25\xe7\xdd\xd6\x0d\x50\x93\x3f\x3b\xe3\x8c\x08\xd6\x35\x90\x7f\xbc\x25\x9c\x8b\x41\x91\x02\xce\xc7\x40\xae\xbb\xdd\x04\x00\xad\x99\x63\x87\x6d\x3d\x97\x84\xb7\x51\x1b\xf4\x48\x23\x69\xff\x70\xdc\x64\xb0\xe7\x99\x49\x89\xdf\x99\x8b\x35\xbd\x1e\x31\x5d\x72\x05\x32\x59\x4a\x8e\xa1\xf9\xf0\x63\x57\x70\x8d\x3b\x66\x3e\x84\x06\x2a\xac\x1d\xbd\xf8\xd4\x34\xe5\xbd\xe7\xd7\xba\x4d\x0c\x8e\x26\xe5\x8b\x07\x75\xc0\xff\x27\x11\x34\x4a\x7f\x3d\xd9\x8a\xa2\xb7\x2d\xdc\xa3\xf8\x94\x6e\x68\xa5\xb5\xfa\x46\x42\xd3\x65\x61\xa2\xcd\x82\x86\xbe\x1a\x4d\xe2\x64\xb1\x4c\xb6\x52\xa2\x41\xa3\xe2\xca\x2f\xa7\xa2\x1a\x97\x71\xdc\xdf\x93\x7e\xf2\xeb\x10\xc9\x68\x52\xbe\x0a\x2b\xce\x04\x1a\x93\xa8\x2b\x3b\xd3\x7a\x9e\x22\x9d\x15\xf9\x60\xfb\x77\x98\xea\x55\x19\x42\x21\xf3\x29\xac\x64\x5e\x7f\xd0\x60\x78\x36\xfb\xea\xfc\xfa\x7f\xa8\x70\x1d\x57\xa3\xd4\x28\x85\xc8\xa5\xfd\x9e\x94\x10\xc5\xe7\x89\xcb\x90\x12\x4a\xbb\x20\x3a\xc9\x59\x10\xf5\x3f\x3e\x9a\xc3\x2d\xa9\xaf\xce\x5e\x1c\x88\x20\xf3\xfc\x99\xe6\xaf\x39\x54\x4c\xf1\x08\xa6\xed\x64\xd6\xc6\x9f\x7a\x58\x40\x7c\x69\xe4\xde\x88\x61\x7d\x36\x80\xbe\x5f\x03\x0e\x5e\xad\x36\xee\x3e\xf5\xee\x44\x19\x01\xe1\xa5\x8a\x68\x94\xc9\x55\x8f\x77\x54\x41\xff\x54\x1b\x1e\x77\x9a\x7f\x8b\x80\xf0\x46\xd8\xa9\xf6\xb0\x15\x9c\xcd\x7a\xfa\x2c\x0e\x2c\x47\x0b\xb2\xdf\xbf\xc3\x42\x9a\x8b\xaa\x13\x22\xfe\xe1\xf0\x70\x0b\xd0\x25\x63\x48\x2d\xc3\x6f\x67\x06\x6e\x34\xd1\x1f\x4d\x34\x56\xfa\x59\x8a\xff\xbf\x29\xc2\xbf\x8f\xbd\x4a\x51\x51\x51\xe5\x16\x8d\xdc\xf2\xa7\x4f\xa9\xbb\x96\xb9\x14\xb1\xeb\xea\xeb\x17\x92\x1b\x68\x17\xc7\x53\xe8\xd3\x26\xab\xee\x96\xf1\x47\x74\x60\x60\xf4\x91\x33\x9b\x5b\x4c\xde\x7f\xf9\x12\x12\xc9\xa5\x59\x0e\x1d\x2a\x5d\x55\xf3\xd5\xe0\x9d\xbf\xf3\x5e\xe1\xf2\x26\x27\x89\xd9\x2b\x01\x6f\x51\xa1\xde\x54\x82\x29\x82\x2f\x7a\x4a\x15\xf4\x9f\x56\xd1\xbe\x48\x02\xfe\x53\x1f\xea\x8a\xcf\x7d\x31\x42\x58\xc5\x9c\x31\x7d\x27\x69\x42\x45\x2d\xad\x44\x37\xd4\x7e\x88\x1a\x84\xfc\xa7\xe4\x02\xd0\xbb\x8d\x6e\x77\xaf\xdf\x78\x99\x7f\x56\x5c\xb9\xfe\xbf\xcd\xb6\xae\x85\xea\x46\x42\xc5\x1b\xd7\xd8\x53\x43\x26\x09\x07\x3c\xd3\x95\xfe\xad\xfc\x8c\xa7\xbb\xd3\xaf\xf2\x1f\xbe\x72\x49\x31\x30\x91\xfe\xb7\xe2\x83\xea\x42\xf8\xdf\x4e\x79\x9b\xda\x38\x0f\x0a\xbc\xae\xfc\xd7\xb5\xa1\xdf\x83\x19\x39\xd8\x59\x3a\x41\xce\x69\x9f\xd4\xd8\xbf\x34\x5c\x9a\x6a\xc8\x0f\xf6\x80\x81\xeb\x66\x1b\xbd\xc8\xd3\x8f\x1c\x3e\x6e\xad\xfe\x4a\x5c\x7d\x0b\xf2\x5f\x79\x6e\x2d\xd8\x1e\x31\xb4\xbe\xd4\x2d\x14\xd1\xff\x72\x31\xf4\x2c\x9b\xe5\xe1\x94\xf0\x6f\xad\xac\x9b\x9c\x07\x79\xb1\xfe\x49\x91\x8d\xdb\x29\xf0\x7c\x7c\x09\x1d\x73\xee\xbf\x25\xa3\xa5\xe8\xa4\xd3\x31\xd2\x69\x8c\xdc\x9b\x26\xcb\x72\x4d\x9f\xff\x72\x13\x25\x4d\xa0\xd3\x9f\x97\xf4\x39\x63\x9d\x26\x7b\xba\xf8\x5b\x09\x6c\x8d\xff\x94\x83\xd9\xc2\xd3\x6a\x23\x79\x93\x6e\x65\x6e\xa1\x88\x93\xa1\xf9\xf0\xd2\x2a\xe3\xee\x01\x3d\x78\x13\xb1\xcc\xba\x89\x98\x6e\xd2\x3c\x68\x64\xbf\xba\x5a\x68\x80\x20\x37\x14\xac\x5b\xc9\x44\xf3\x4b\x18\xa1\x68\xfe\x78\x03\xd8\x88\xae\xb6\x6e\x12\x70\x2b\x44\x70\x21\x16\x3c\x29\xa2\x83\x0b\x88\x72\x50\x48\x42\x57\x11\x02\x3a\xe3\x44\x08\x44\x7e\x25\x6f\x28\x0e\x16\x8d\x5e\x5e\x2d\x9a\x1e\xba\x5e\x4a\xa2\x80\xbd\x10\xf9\xfd\x77\xae\xc5\xc5\x9e\x22\xc4\x8a\x8b\x1a\x0e\x59\x97\x19\xdd\xcd\x1c\xd8\x7c\xd4\x75\x8b\x7f\xe3\xda\x55\x93\x17\x1d\x18\x58\xbf\x0a\x33\x34\x1d\x8a\xe6\xfb\x6b\x25\x89\x97\x31\xf0\x01\x74\xaf\xec\x62\x58\x93\x83\x18\x02\x13\x0f\x38\x09\x3a\x71\x35\x4f\x8c\xe5\x2a\xd1\x82\x47\xf5\xd3\xa4\x65\xaf\xa1\x1b\xdb\xa1\xf7\x6b\x44\x98\xa6\x55\xd3\xf1\x02\x3f\x4d\xd5\xda\x34\x29\x22\xee\xec\x3e\x3e\x4b\xa2\x0f\x9b\x04\x7c\xd1\xd0\x6d\xf8\xf7\x1c\xa2\xa4\x98\x98\x69\x63\x2f\x6e\x70\x4a\xad\x61\x58\xa4\xb3\x46\x67\x29\x2e\x71\x19\x19\xcd\xf1\xd8\x8e\x6f\x5c\xb9\x7c\x41\x8b\xb9\x1e\x41\xe7\xe8\x28\x6e\xac\x9f\x2e\x25\x66\x2c\xab\x93\x4c\xe8\x2e\xf5\x60\x69\x32\x71\xd3\x76\x16\xb8\xfa\x00\x78\xbb\x20\x4d\xd5\x5a\xa7\xc8\xf8\x6e\x26\xe3\xb7\x1e\x85\xf9\x5e\xca\xe9\x7e\x63\x9d\xf8\xca\x78\xfe\xfc\xd5\xd7\x4f\x8c\xcb\x24\xb2\x91\xbc\xfa\x08\x00\x91\x4f\xdc\xd2\x83\x16\x8e\x0a\x5e\xab\x16\x68\x58\xe8\x7d\x54\x94\xf5\x12\xc3\x3d\x2e\x97\x7f\xbf\x71\x9c\x70\x08\x8e\x58\x62\x4b\x27\x12\xbe\x91\x2e\x88\x32\x98\x6d\x0b\xc7\x45\xde\x94\x8b\xf5\xb3\xbb\x99\xf5\xd5\xac\x9e\x59\xb4\xe3\x68\xb5\x82\xe6\xbc\xd3\x10\x98\x72\x22\x13\x2d\x2d\xe6\x61\x66\x74\xec\xde\x5c\x86\x98\x1d\x8b\xbd\x33\xff\xb7\x9e\xcc\xbb\xb0\xfa\x67\xf8\xce\x33\x9e\xcc\x60\xb0\xd9\xaf\x6a\xf7\x86\xec\xca\x8a\xbc\x37\xac\x2e\x5d\x7c\x0a\xc2\x9c\xf7\x27\x48\x90\x19\xed\x3a\x4d\x08\xc5\x1b\x58\x5a\xbc\xb6\x66\xd3\x13\xe3\xcd\x24\x22\x2f\x3f\x3f\xbf\xea\xc6\x5d\x5a\xf1\x44\x78\x08\x85\x5c\xe5\x71\x3d\xee\x7a\x3c\x6d\x8a\x12\x2d\xc0\x9e\xe3\xf5\xd2\x3b\xcf\xcf\xe0\x0c\x82\x6b\x2b\x45\xe8\x2b\xa3\xf0\xdf\x2e\xb7\xc3\x15\x25\xd8\x08\x9d\x17\x7e\xa6\xb6\x07\x37\x00\xfe\x68\x6e\xb0\x64\x00\x43\x49\xf4\x8d\xe7\xeb\xa7\x7b\x53\xd9\xc2\xf7\xef\x32\xd5\x3b\x6a\x6d\x0a\x32\x02\x04\x6f\x1b\xde\x3c\x71\x5c\x37\x3c\xb1\xc7\x76\xa4\x8d\x1f\x1b\x89\x44\x9e\x0b\x95\x47\x76\x20\x3c\x8c\x6f\x2b\x5b\x9b\x9f\x99\x06\x8a\x02\x7f\xd9\xbc\x0d\x38\x66\x8c\x8d\x9c\x1d\xa7\xbc\x12\xb9\x59\x09\x0f\x2a\x89\x96\x52\x45\x1c\x32\x28\x80\x54\x50\x22\x58\xf6\x97\xdb\xe1\x4e\xd3\x62\xdd\x1b\xe2\xa6\xe7\x2b\x1a\x04\x31\x07\x93\x9b\x73\xf2\xfc\xb6\x3f\xae\xef\x05\xd5\x06\xef\x27\xc3\xc5\x6f\x05\xa6\x1b\x0c\xf3\x78\x25\x9e\xc0\xf4\xb3\x41\x45\x2b\x6f\x60\x31\x3d\xa0\xd1\x41\x2a\x48\xa6\xf9\xe1\x91\x6b\x39\xd1\xe7\xa5\xae\xb6\x3e\xf1\x02\x07\xc8\x1b\x07\x35\xda\x8f\xee\x96\xb2\x17\x5b\xa5\xd6\x43\x74\xce\xae\xf0\x4c\xf8\x6e\x07\x85\xd3\xf3\xbd\xcf\x03\x3d\x70\xd3\xd6\x02\xa2\xd2\x19\xaf\xb9\xf2\x86\x3d\x60\x71\x94\x81\x88\x57\x62\x40\x45\xec\xec\x27\x4e\x71\xaa\xdd\x7c\xc2\x5e\x86\x5e\x81\x98\xbd\x70\xb3\xee\x8f\x6c\x6e\xc0\xcc\x55\x67\x6c\x14\x2e\xb1\x31\x76\x3d\xbb\xd9\x69\xbc\xf6\x74\x9b\xb8\xf9\xbc\x73\x52\xea\xef\x90\xaa\x3d\xb3\x30\x82\xb4\xd7\x46\x72\x3c\x5e\x90\x56\xec\x0e\x41\xd1\xa2\x44\x94\xbd\x7d\xaf\xc4\xe0\x12\x02\x7c\xeb\x0d\x2e\x9a\xd5\x6a\xbf\x3a\x93\xe7\xd2\x49\xa8\x26\xaa\xb3\x17\xcf\x51\xe5\x3c\x14\xd1\x6a\xae\x8f\x53\xc5\xb1\x47\x5c\xb0\x22\xe2\xe5\xc1\xa9\xbe\x77\xc4\x57\xb7\xeb\x95\x22\xf6\x48\x87\x9b\x89\x15\xf2\x06\xd0\xa5\x82\xab\x67\xc0\x94\x4a\xb4\xe0\x39\xa7\x7f\x37\xff\x1b\x6d\x7f\x4a\x0e\xb9\x38\x66\xee\xb9\x80\x92\x13\xad\x01\x7a\x52\x0a\x0e\xa3\xbd\xd8\xa6\x1b\x5e\x78\x89\x22\x75\xef\x39\x4a\x15\xdd\x5b\x9e\xdf\xa8\x60\xbb\x0f\xfd\x8b\xf5\x06\x45\xa9\x95\x80\xfd\x17\xd7\x6d\x59\x9a\x53\x4b\x7a\x3c\x40\x9c\xe3\x7c\xcd\xd0\xfe\xcd\x14\x57\x72\xf4\x3c\x94\x51\x07\xb6\x0f\x15\x18\x1c\xa6\xe3\xca\x69\xf4\xed\xbc\xc1\x42\xb4\x77\xe6\x45\x0d\x34\x25\x2a\xca\xe2\xb1\x1f\x6f\x92\x17\x7d\x33\x5a\x39\xe8\xaa\x46\x63\xd1\x4c\xa8\xaf\xa8\xba\x0a\xc4\x8d\xa3\x19\xe2\xdd\xe3\x2d\x84\xad\x7b\x71\x83\xbe\x10\x7f\xd4\xda\x96\x70\x16\xd3\x58\xff\x5e\xad\x57\x6a\xcf\xab\x39\x41\x05\xa8\x4e\xb1\xd1\x79\x53\xff\x1d\xce\x31\xe9\xd1\x47\x33\x77\xcb\x5b\x51\xbc\xa8\x3f\x74\x1a\x57\xe0\xfd\xd2\x1d\xcf\x32\xce\x78\xc1\x90\xa7\x53\xfc\x99\xf0\x53\x80\xa9\x52\xed\x66\x8a\x45\x72\xbf\xae\xaf\xb7\x2e\x25\x52\x50\x9f\xc2\xc9\xdd\xe2\xff\x7e\x4b\x2a\xcf\x8d\xa0\x84\x67\x51\x4a\x9a\x83\x29\x60\x5e\xea\x1d\x57\x03\xa1\xa9\x16\x38\x71\xe6\xe4\xb7\x85\xea\xe9\x2d\x97\xec\xeb\xac\xac\x7f\x8c\x84\xde\xe3\xec\xaa\x11\x8f\x1f\x74\x57\x16\xdf\x39\xdd\x3c\xdb\x89\x9f\xb5\x31\xc5\x75\xa9\x3e\x08\x47\xcf\xec\x17\x8b\x84\x1e\x8a\x2d\xc8\x76\xfa\x03\xf4\x1a\x5b\x77\x0d\x80\xd6\xb2\xcb\xc4\x9b\xd8\x49\x28\x7d\x5a\x7c\x0a\x68\xbb\xb5\xe1\x55\xdc\x00\x98\xab\x38\xb2\xe3\x71\x3a\xd9\x48\x5c\xea\x05\xe9\xe9\xe0\x87\xae\x07\x3d\x87\x0a\x0c\xf0\x07\x95\xd2\x66\xc3\x85\xac\x86\x3f\xc8\x72\x5b\xc0\x53\x94\x67\x5d\x66\x7b\x8f\xa2\x33\x66\x34\x9e\xf3\xea\xc4\xf6\x82\x3a\x58\x83\x51\xce\x3a\xc6\x6d\x48\x82\x9a\x28\x92\x47\xfd\x90\xed\x08\x7d\x69\x21\x36\xd1\x38\x0f\x71\xa9\xb5\xf2\x3b\x92\x60\x04\xcc\x9c\xec\xa9\xa2\x79\xb1\xf2\x7e\x69\x54\xb2\x8c\xd8\x37\x1c\x4d\x99\x1f\x6e\x5f\x9e\xbe\x19\xa9\x33\x86\x7d\x5c\x07\x63\x5e\xd5\x14\x97\xbe\x4a\xac\x77\x1b\xf2\xee\x69\x9a\x24\xe6\x0e\x3b\xc1\xc5\xc1\x82\x2d\x0f\x1f\x13\xd3\xea\xf3\x1b\x71\x6e\x57\xc4\x15\x20\xfd\x56\x25\xbb\xe9\xce\xaf\x06\xa5\x77\xdf\x4b\xdb\x04\x39\x47\xbb\x8a\x5d\x46\x03\xa7\x5c\x17\xc6\x55\xe8\xfa\xc7\xa1\x9d\x5f\x8c\xe9\x27\xa3\x86\x83\x53\x6d\xcd\x76\x3a\x47\x4e\x62\x58\x7e\xd5\x03\x53\x9a\xda\x9c\x18\xaa\x09\xa9\x6f\x8d\x4d\xa6\x8b\x8c\xfb\xc7\x39\xdd\x0a\x65\xd9\x99\xc6\xca\x71\x04\x0e\x7d\x65\xee\xb9\x0e\x88\x8b\x53\x76\xfe\x4c\x6f\x3d\xdf\xed\x45\xd9\x76\x10\x3d\x00\x86\x0e\xde\xaf\x6a\x5c\x6a\xfc\xd8\xd5\xe2\x1f\x84\x69\x8a\x21\x20\x90\x87\x0e\x7f\x11\xd7\xde\x6c\xa8\x00\xad\x35\x89\x5a\xbb\xf6\x7d\xf7\xf3\x31\x43\x54\xfc\x71\xfd\xf5\x68\x40\x47\x27\x71\xda\x2a\xec\xe4\xf1\xaa\x1d\xae\x65\x02\xd3\x03\x6e\x60\x65\x28\xfb\x53\x25\x90\xae\xdb\x9e\x6c\x4d\xb1\x4d\x17\x10\xd3\x94\x13\xe2\xea\xd1\xc2\x05\x1d\x81\x40\xa5\xf0\xfd\x38\xd6\x4a\x7e\xa8\x7c\x79\x3b\xc4\x47\xa5\x9b\x70\x15\xe6\xd0\x89\xe5\x54\xd7\x58\xd4\x47\x5c\x20\xff\x76\x49\x53\xe7\xa1\x9f\x4c\xcc\x5c\x6d\xb9\x8f\x19\x9f\x39\x52\xd2\x8e\x66\x94\x4b\x79\xb5\xa7\x7e\x0c\x1c\xdc\x37\xe1\x31\xc7\x57\xd5\x27\x5f\xff\xee\x88\xcd\x27\x17\x31\x1b\xea\xc5\xcb\x3b\xfc\x2d\x64\x8b\xe2\xbf\x7c\x18\x0c\x1e\x1d\xad\xac\x37\x12\x7b\x70\xa6\x33\x34\x12\xe6\xdb\x75\xc0\x30\x61\x3f\x7f\x57\xd7\x38\x36\x5a\xf9\xf7\x2f\x1a\x5f\xc3\x7d\x42\xc4\xfb\xf0\x63\x08\x86\x2f\xe5\x94\xf9\xa6\x92\x1f\xa1\x24\x62\xcc\x86\xb7\xe2\x48\x68\xcf\x91\x1a\xd3\xb5\xae\x7f\x6a\xfa\x7c\x3c\x2d\xcc\xab\xd1\xc4\xbb\xb6\x0e\xc0\x7f\x54\x51\x0c\xef\x9b\xf4\x30\x87\x1b\xa5\x7b\x22\xd4\x82\x16\x31\xdc\x29\xf7\x7d\xaf\xe5\x7d\xa6\xe7\xf5\xa5\xda\x50\x72\xbf\x91\x82\xe9\x55\xe8\xb3\x13\xd1\x34\xf5\xac\x9c\xc7\xb2\x6d\x05\x24\x7f\x04\x58\x4b\x14\x98\xcc\x1b\x01\x7f\xad\xa5\x93\xf1\x42\x66\xb8\xf2\xa7\xaf\xf0\xd4\x10\x0d\x2d\xd5\x19\xc2\x9e\x65\xcb\xfc\x13\xb3\x1a\xef\x1a\x4a\xa8\x72\xe9\xe7\xc0\x73\x9e\x5d\x31\x1e\x28\x9c\xcb\x06\x73\x9c\x13\x22\xe8\xdb\x6b\x2b\x8d\xe5\xf4\xa6\xc9\xaa\xc0\x86\x1e\xaf\x1f\xfe\x8d\x07\x7d\x4d\x43\xaa\x35\x0e\x5b\x44\x2f\x60\xba\xfb\xbb\xef\x3f\x64\xc8\xd4\xb0\x37\x18\x93\xa7\x25\x5b\x29\x1a\xa7\xdf\x52\x25\xa6\x81\xad\x79\xd2\x61\x57\x5a\x47\x0c\x29\xf3\x6e\xbf\xac\xee\xbe\x4f\x44\x91\x4f\xd7\x5b\xc8\xff\x98\x61\xf9\x32\x6d\x4b\x6f\xbf\x16\x84\x35\xbd\xb0\x6e\x22\x96\x51\xae\x30\x26\x17\x37\x55\x80\xf4\xf9\x6f\x05\xb3\xb2\x35\x63\xe6\xeb\x3e\xba\x63\x0d\x10\xfd\x21\x76\xa1\x6c\x6f\xd5\x4b\x61\x18\xa3\x13\x0a\x36\x39\x4f\x26\x87\x5b\xcc\xeb\x39\x49\x11\x0b\x24\xec\x1e\x4a\x6b\xae\x4e\xc2\x85\xe8\x78\x41\x04\xb7\xf8\x97\xc2\xc7\x42\x7f\x10\xeb\xf9\xce\x0d\x3a\xfb\x6b\x12\x67\xc1\x6d\xdd\x2a\xda\xb0\x88\xf2\x25\xf1\xad\x00\x75\x29\x74\xb6\x82\xe9\xaf\xa5\x5e\xec\xd9\xcb\x4e\xe1\xe8\x0c\x64\xf8\x52\x5e\x6b\x68\xae\x29\x36\xbd\x95\x43\x36\xec\x52\x6a\x89\x92\x3d\xc7\x2d\x2b\xbb\x82\xa6\x76\xed\x6b\xcb\xa3\xee\xc9\x0f\x9f\x59\x63\xa3\x81\x16\x90\xcd\x01\x97\x83\x9b\x1c\xaf\xbd\xb6\x68\x9a\x59\xef\x0d\xcc\x8c\xb1\x44\xe8\x13\x8c\x5d\x74\x1c\xfa\xca\x2a\xeb\xa8\xe7\x77\x2d\x58\x5e\x00\x07\xcd\x6a\xd8\x1c\x9d\xdd\xe2\xe0\xcf\x07\xee\x1f\xdf\x63\x6f\x10\x2f\x42\x79\xf9\x22\xdb\x70\x7b\xdc\xb8\xcb\x2f\xa1\x36\x2e\xad\x85\x0d\xbc\x2e\xf6\x23\xb5\xa4\x62\xed\x04\x3b\xde\x4c\x65\x89\xa8\xcf\xa2\xa5\x33\x68\xe0\xaa\x08\x85\x0d\xd6\x49\x38\xd8\xb6\x3c\x35\x76\xe8\x3d\xfc\xc2\x5f\x3c\x25\xd4\xdb\xf5\x62\x9d\xa1\xd0\xca\x78\x00\xfc\xdc\xd7\x13\xe5\xb7\xcd\x0a\x8f\xf0\xb6\x58\x8e\xa6\x25\x8f\x31\x75\xce\x96\x36\xcc\x63\xc6\x38\x64\x71\xbc\x44\xfa\x7a\x7b\xeb\x18\x31\xbe\x7f\x6f\xb1\xa5\x02\x06\xea\x42\x17\xc3\xc9\x85\x2a\x9b\x6e\xea\x12\x89\xdb\x58\xf4\x4d\x5b\xcd\x13\xef\xad\x4a\xa0\x51\x84\xfe\xd8\x4a\x0c\x25\x4a\x33\xfd\xc9\x60\x05\xba\x77\x19\xfe\x9f\x56\xdd\x3e\xa9\x66\xf7\xe1\x15\x52\xa9\xc9\x29\x61\xfb\x83\x40\x81\x80\xb3\xe1\x66\xad\x95\x49\xa1\x9b\xea\x2d\x3e\x73\xd4\xbb\x14\x52\xa0\x2a\xdc\x0d\x98\xf0\x70\xfc\xcc\xd9\x1a\x17\xd7\x8b\xbf\xfe\x44\x3a\xc3\xb9\x5c\xbb\xac\x3d\x62\xec\x2c\xeb\xb4\x1b\x77\xb9\xac\x04\x85\xda\xad\x94\x7b\x44\x06\x02\x87\x5e\x62\x99\x80\x9e\x28\x4b\x43\xa4\xfc\xfc\x37\x71\x9d\x48\x64\x48\x22\xaa\x5a\x00\x53\xb3\xff\xf0\x7d\xf4\x0c\x0b\xef\x92\xce\xe1\x36\x70\x1d\x8d\x13\x16\x8c\xbb\xe8\x51\x60\x3a\x71\x46\xf8\x13\x23\x9c\xfc\xae\x13\x0c\xac\x7b\x4d\xd0\x21\x47\x24\x1a\x48\x80\x15\x39\xdc\x77\x74\x66\x6b\x5e\x6d\xd3\x7f\xb4\x22\xaa\x25\xf8\x29\x15\x34\xb6\xbd\x7c\xa3\xe0\x98\x08\x17\x2f\x03\x05\xd5\xf1\x3f\x51\x42\x2c\x06\x4d\x05\x1a\x78\xf7\x73\x03\xdb\xe5\x2e\x62\xc4\xd2\x62\x5e\xf7\xb3\x51\x95\x9f\xe8\xa0\x50\x48\x52\x2b\x70\x8d\xc5\x49\xbd\x74\x42\x4b\x81\xd9\x22\xff\xd3\xf0\xf7\xeb\x7e\x8a\xe3\x85\xf6\xd0\x72\x2e\xfa\xcc\x31\x83\xa4\xd9\xfd\xab\x63\x87\x61\x86\x52\xff\x0e\x23\xc4\x77\x25\x37\x31\xad\x33\x61\xd0\xbc\xaf\xf3\xfb\x8d\xe3\x5e\x7f\x79\x74\x9c\x9c\x6b\x74\x4b\x74\xb6\xf0\x55\xb7\xb4\xf8\xfb\x4a\x3b\x9e\xa3\x7c\xf7\x27\xa6\x6b\x2d\x61\xba\x81\x52\xb7\x8b\x2c\xfb\x3c\xdc\xee\x54\x6a\xda\x6c\xb6\x7d\xd0\xa7\x29\x05\x86\x89\xf2\x86\x39\x57\x7f\x62\xab\xdd\xad\xf0\x64\x55\x0d\xfc\x21\xeb\x32\xc5\x91\x8c\xf1\x3f\xef\x13\x29\xf2\x25\x77\x67\x6b\x14\x78\x98\xe9\x6a\x82\xdf\xdc\xa2\xb9\x99\xc3\xcf\xa9\x56\xa1\xef\x40\x9b\x62\xc5\xef\x37\xbc\x22\x48\xd1\xf6\xe3\x5a\x77\x8c\x20\x8a\xd1\x79\xf5\xca\x3f\x13\xed\x12\x16\x31\x29\x64\x6d\x75\xf9\x6e\xc5\x4e\xb9\x79\xe3\x6e\xb4\x19\x78\x43\xf6\x70\xb4\x14\x66\x64\xcf\xcf\x3e\x1e\xf1\xb7\x01\x85\x6a\x19\x1e\x66\x12\x2b\xba\x7f\xe7\x27\x05\xe8\xf4\xff\xf1\xb2\xe7\xdf\x47\x47\xee\xd3\xa7\xd4\x2b\x33\xac\xbf\x7e\xd5\xac\xf3\xae\xa9\xfd\x5f\x1f\x6e\x7d\x82\xb4\xad\xaa\xe4\x2c\x2c\x76\x6e\x86\x56\x1d\x15\x15\xc5\x6c\x13\x0b\xe6\x08\xb1\xa2\xc6\x5a\x22\x13\x93\x04\x83\x4a\x82\xee\x50\x93\x89\xc1\xff\x33\xdb\x94\x7e\x33\x4b\xd9\x9a\x04\x93\x04\x6c\x7e\x4c\xf9\x21\xde\xdd\x55\x5f\x59\x64\x51\x5b\xdb\xfb\xa9\xa8\x70\x53\xbd\x3b\x22\x51\xbd\xc2\xdf\x9d\xfa\xeb\xf1\x62\x46\x8f\x26\x65\x1a\x46\xb3\x3e\x97\x53\x5b\xdb\x77\x57\xdf\x03\xf6\xe2\xda\x4d\x60\x50\x69\x49\x3c\xe0\x8f\xd3\xf3\x2c\x6d\xeb\xa8\xd6\x4c\x88\x8e\xa8\x8e\x8d\x9c\xd8\xab\xf7\xc7\x5f\x88\x59\xfb\x1a\x46\xe8\x64\xb2\xd7\x34\xb5\x47\x96\xa8\x2e\x70\xd1\x75\x40\x7f\x19\xf4\xb6\x87\x41\x97\xff\x84\x1c\x5d\xcd\x69\xad\xd7\x3c\xaa\x15\x5f\x54\x93\xb9\x01\x34\xd7\x2b\xb2\xdc\x07\xd8\xce\xcb\x5d\x6c\x91\x01\x00\x20\x21\xe8\x9e\x9d\xc9\xc6\xf8\x09\x16\x8e\x57\x4f\xec\xd5\xdd\xd5\xf6\x0e\x0b\x7b\xb3\xa6\x6e\x44\x4a\x72\xc3\x51\x83\xf3\x7f\xa6\x21\x8f\x65\xf1\xd9\xcb\x27\xa9\xdb\x9e\x81\x55\x8a\x71\x02\xba\x7a\x86\x5f\xd2\xc8\xae\x4f\x49\xab\x25\x20\xfb\x2a\x52\x2c\x1a\xb9\xa4\x77\x99\x10\x18\xff\xe9\x53\xbe\xb3\x8a\x56\xd7\x76\x61\xee\x16\x88\xbd\xcf\x46\x7c\x55\x51\x43\xbc\xa4\x9f\xf4\xf7\xb4\xa5\xad\xe0\x03\x9a\xb2\x02\x7c\xd5\x3b\x4b\x03\x62\x33\x35\xb2\x4e\x18\xae\x51\x48\x32\xdd\xab\xa8\xcd\xb5\x91\x34\x0a\xc8\x54\x3e\x88\x9b\x22\xb5\x11\xb9\xe1\x0c\xa9\x5b\xb0\x18\x99\xba\x11\x6a\xb3\x95\xbb\x04\xe4\xd1\xcb\x27\xc6\xa7\xd6\x58\x1a\xcc\x0b\x0c\x57\x44\x1a\xed\x47\xfb\xc3\x9a\x1c\x5e\xee\xd4\x83\xee\x57\xcc\xff\xa9\x05\x23\xff\x0e\xb3\xab\xae\xe1\x05\xc8\x13\x97\xad\xf0\xc4\xbb\x36\x23\x27\x58\x92\x39\x20\xa0\x59\xa2\x4f\xc4\x21\x05\xbb\x3a\x01\x4f\xa4\x6a\xc0\x46\xbc\xe6\x1b\xf9\x35\xab\xe3\x1d\x04\x34\x34\x59\x96\x4b\xc2\x5e\x5b\x74\x4e\x4a\x3a\xe6\x7c\x27\x9f\x2b\x44\xc7\xc5\x9e\x02\x45\x9f\x97\xf4\x23\x81\x6c\x52\xb1\x27\x4f\xb1\x16\x36\x18\x78\xcc\x0c\xba\x5f\x91\x16\xf8\x46\xbe\xcc\xf9\xc1\xd2\x91\xe7\x98\xd2\x38\x6d\x00\x00\x82\xd6\x19\x08\xe1\x84\xb8\x93\x69\x8f\x58\xf1\xf1\x08\xec\x1b\xa2\x80\x2f\x72\x84\xa6\x8b\xbc\xd2\xc5\x7d\x6b\xd0\x2d\x8a\x49\xf6\xa8\x77\x27\x14\x93\xbc\x2e\xb6\x08\x78\xe2\x5d\x82\xb3\xf3\x6f\xe4\xcb\x74\xde\x1e\x32\x9a\xcc\xb8\x9f\x61\x96\xb7\x4c\xfb\x38\xd9\xb9\x4f\xf7\x35\xcd\x07\x00\x12\xb6\x66\x8d\x21\xd6\x24\x20\xac\x85\xe7\xf6\x4c\x66\x30\xa2\xd1\xbc\xab\x9c\xae\x34\x04\x29\x5d\x2c\x39\x25\x9a\x53\x41\x57\x3e\x58\x3a\x22\x39\x75\x5a\xda\xbd\x4c\x1f\x69\x0c\x55\x9e\x56\x70\xda\x07\xdd\x2f\x19\xbf\xcb\x8e\x8f\x65\xdd\xde\xa5\x37\xf5\x2c\xfc\xe0\xe7\xdc\x91\xc9\xb2\xf2\x56\x4d\x02\x00\x60\xc7\x2d\xf6\x54\xc7\x6d\xc1\x57\x53\xfa\xa9\xcc\x26\xbe\xc9\xe6\x84\x09\x96\x1a\x24\x6c\x13\xc3\xf7\xe6\xc8\x0e\x2b\xdf\xd2\x57\xb2\x75\x23\x71\xa9\xa8\x82\x53\x06\x17\x36\x5a\x9a\xfd\x20\xe7\xd3\x72\xc8\x15\xe6\x8f\x3e\x23\x1b\x3b\x05\x78\xda\x98\xe7\x5d\x05\x49\x81\xfd\xdb\xcb\x98\xda\x7f\x54\x65\xfc\xbe\xef\xb3\xef\x27\x54\xa7\x6d\x0d\x5b\x92\x05\x23\x55\xed\x62\x4b\x86\x16\xcb\xf5\x62\x1d\x83\x2c\x16\x8f\x00\xec\xc5\x91\x02\xf3\x47\x9f\x07\x90\xc9\xa6\xb3\x67\xa5\x01\x20\x61\x4f\xcd\x13\xe3\xb2\xde\xde\x5e\x89\x16\xaa\x8e\x17\x8e\x0a\x1c\x33\xbd\x58\xe1\xe3\x60\xdb\xc2\x71\xce\x14\xf3\x88\xc8\xac\xa4\xa4\xe4\x18\x76\xca\x69\x6d\xd2\xf6\xee\xa4\x76\x2b\xf7\xf2\xdc\xfd\x8a\xf9\xd4\x6e\xe3\xbb\x99\x65\x39\xe4\x0a\x64\xdc\x9b\x17\x92\x5d\x05\xd6\xcb\x59\xd2\x3b\x34\xcd\x65\x64\x18\x84\x25\x4e\x38\x99\x4b\x01\x80\x8d\x8c\x5a\xfc\x01\x56\x55\x7c\x99\x76\x1c\xe1\x12\x9e\xd5\xd6\x08\x5e\xf8\xcb\x6b\x3c\xc7\xaf\xf0\xb4\xcf\x82\x60\x0a\x6d\xe7\x17\x6c\x1f\xdb\xd6\x4c\x9c\x9d\x1f\x9a\x4b\xcc\x1e\x3d\x6e\x46\x97\xd9\x9e\x7b\x40\x31\x1f\x02\x7b\x54\x31\x12\x60\x52\x9e\x3f\x37\x7b\xb2\x5a\x45\xa3\x9f\x05\xb2\x27\x19\x5c\xf4\x4a\x38\x75\x7d\x9f\x7a\xf2\x04\x4b\x2d\x5e\x02\xc9\x3d\x06\x64\x6f\xbf\x1f\x27\x0d\x00\x30\xa7\x07\x4b\xdd\x29\x0d\x4a\x36\x12\xb4\x08\xe8\xa5\x73\x13\x91\x8b\xd6\x77\xd8\x3b\xef\xcc\x92\xe5\x15\x52\x4a\x4a\x4a\xfa\xc7\x6f\x8a\x25\x60\x0d\xb6\x7b\x4d\x14\x69\x59\x40\xee\x37\xc3\x98\x61\x99\x48\xfb\xcb\x75\x23\xd3\x64\xfa\x44\x4c\xf1\xcd\x4f\x12\x0c\xf3\x4f\x96\x54\x4a\xf9\xcd\x2c\xaf\xfc\xb9\xd9\xca\x64\x2c\x29\x2d\x63\x85\x43\x03\xfd\x83\x42\x25\x65\x3f\xfb\x45\xa3\x3f\x63\x69\xe9\xbe\x9f\x97\xdd\x1f\x86\x6a\x3e\xda\x71\xb3\xc6\x6a\x05\x33\x02\xf6\x24\xe1\x10\xdc\xed\x47\x32\x8b\x6f\x69\x7d\xa6\x02\x52\x38\xb8\xb5\xda\xc9\x0c\xca\x38\x3b\x6f\xa2\x60\x63\xf0\x25\x49\x3f\x37\x5e\xc5\xf3\x76\xdd\x08\x79\xb4\xac\x41\xc3\x81\xfb\xc3\x92\x42\xaf\xf6\xd6\xde\xe2\x69\xac\xa2\x7c\x2a\xb5\x83\x60\x79\xe8\x05\x58\x45\xff\x13\x75\xe7\xc4\x16\x35\x45\x00\xc8\xd2\x32\x07\x0e\xee\xd9\x9f\xbb\x1b\xf7\x8a\x00\xbf\x0f\xbc\x7a\x62\x3c\x9c\xbf\xf7\xf2\xcd\xa3\x08\x63\x46\xd6\xf8\x9e\xb7\x10\x5b\x0b\x45\x5a\x49\xbd\x08\x7b\x33\x77\x68\xde\xb4\x70\x02\x55\x60\xe7\xb3\xd1\xf2\x0e\x01\x73\x34\x2d\x7f\x70\xab\xd4\xe5\x0e\x82\x3d\x00\x00\xd7\x14\x1d\x80\x6c\xd8\x9f\xe8\x10\xc5\x83\xc1\xbe\x9d\xf1\x21\x6b\x8e\xf8\x78\x00\xbb\x0c\xa0\xa9\x35\x48\xc4\xfb\x9e\x49\x98\x88\x7a\xb3\x75\xa2\x2a\x06\x73\x43\xc5\x13\xfa\x29\xa9\xe4\x9e\x77\x41\xd5\x68\x3b\x73\xdd\x56\x40\x0a\x00\x9c\xa1\x16\x4b\x94\x8c\xa5\x25\x89\x62\x56\x36\xca\x83\xc0\x04\x67\x0d\x9c\x21\x3e\xfa\xd7\x54\x31\x6a\x37\x0b\x60\xa6\x21\x2a\xb1\xca\xdf\xe8\x56\x87\x9c\x2f\x52\xaf\x3a\x12\xe4\x77\x41\x2e\xb6\xd4\x0d\x02\x7a\x85\x3f\xbe\x92\x54\xa8\x47\x54\x32\x51\xb1\xd7\xdc\xe9\xe0\xaf\x38\xc9\x9a\x23\x4c\x1d\x66\x3e\xd3\x78\xbb\x80\xbe\x64\xec\x3e\x13\xce\x66\x0f\xf9\xa3\xda\x7b\x72\x0e\x5d\xc2\x7c\x4b\x2a\xf0\xc1\xca\xf7\x4f\x9a\x39\x7c\x13\xe4\x2c\xea\xa9\x6e\xa7\xc9\xb4\x19\xc6\x94\x4f\x9d\xa5\xb2\xe3\x32\x6b\xe3\xbc\x89\xc5\x5d\x15\xd7\x25\x89\x74\x75\x5c\x33\xf6\xaa\x70\xfa\x5a\x8e\x4a\xc4\x17\xfa\xd0\xe2\x8c\xbc\xac\x03\xcb\x52\x0a\x4c\xd5\xaf\xe5\x8c\x26\x18\xc8\xb7\xa8\x86\x20\xe5\x4d\x1f\xc9\x0d\x2b\xeb\x3b\xb7\x9c\x9f\x9f\x4b\x64\x8c\x63\xc7\xac\xdc\x83\xeb\x46\x8e\xf1\xee\x09\x9a\xc3\xf2\x65\xdd\xb2\xc8\x14\x76\xdd\x67\xbf\x76\x88\x20\xfa\x11\x2c\x15\x80\x00\xc0\x5e\xdd\x20\x20\xdb\xce\x25\x1d\xa1\xe9\x8d\x87\x05\xa4\x65\x1c\xcb\x4c\x13\x57\x78\x4a\x67\x69\xad\x99\x7a\x6d\x3b\x67\xbb\x37\xb9\x9f\x03\x8e\x09\x6f\xcc\xc6\xba\xbb\x64\xe0\xe7\x24\x69\x05\xeb\x3d\xd7\x4d\x58\xd1\x7e\x51\x98\x63\x53\x64\xce\x3c\xdd\x59\x37\x72\x79\x66\xef\xa8\x0e\x9a\xe7\xed\x82\x5c\xec\x31\xcc\xb8\x1f\x88\x7e\xde\x47\x51\x04\x00\xf7\xb5\x2b\x6b\x08\x04\x73\xe3\x23\x8d\x73\x0a\x97\x35\x19\xdb\x33\x44\x5b\x44\x7f\x14\x96\x6e\x94\x89\x3a\x54\xa0\x6e\xf4\x5c\xb6\x45\x75\x80\x44\x9e\x2c\xb4\x52\x39\x9d\xe4\x8e\x99\xb4\x8d\xa5\x38\xef\x92\x72\xc0\xa1\xdf\xca\x5f\xe9\xd0\x53\x6d\xd0\xf2\xd8\x99\x1c\x79\x46\xa0\x56\x37\xf2\x7c\x93\xdc\x6c\xca\xbd\xa3\x4b\xad\x48\x2d\x54\x97\x64\x1a\x5e\x8a\x3f\xa3\xf3\xeb\x09\x32\x4d\x0a\x00\xd2\x47\x97\x7a\xee\xa6\x45\x5e\x2f\xcf\x58\xaf\x09\x0d\x2a\x0c\xbd\xd9\xfc\x71\xbe\x4a\x3e\x6d\x77\x37\x9e\x67\xb9\x43\xbc\x04\x06\x96\xb5\x25\x18\x0d\x45\x76\xbb\xdc\xb6\x9d\x67\xb3\x23\xf6\xf4\xdc\xf6\xa7\x2c\x15\x84\x3d\x84\xd8\x55\xef\x9e\x96\x65\x58\x28\x24\xb3\xc5\x97\x8a\xb7\x24\x05\x74\x60\x21\xf5\xc6\xfb\x14\xf3\x67\x7f\xd1\xa4\xbc\x55\xa2\x0a\xb6\x31\x4f\xc9\xff\x1e\xfa\x55\xc5\xec\xbe\x7f\x7b\x2e\xc9\x02\x00\x6c\xae\x3b\x1c\x7f\x96\xb1\xd1\xec\x3a\x9c\x4a\x29\x57\xa4\x9c\x61\xa5\xed\xc9\xfe\xce\x71\xe3\x2e\x33\xba\x17\xac\xd1\x41\xa1\x19\xea\xbb\xc6\x7c\x51\x21\x6c\x1e\x58\x65\xdb\x93\xda\xd9\x97\xe4\x63\x08\x70\x08\xf2\xbb\x5e\x1f\x83\x05\x01\x37\x6e\xcc\xd7\x18\x21\x39\x7a\xaa\xb8\xf9\xfe\x1c\x1b\x87\x75\x42\xde\xc8\xe8\x47\x93\xfd\xdf\x51\x05\x11\x36\xfc\x13\x92\x14\x13\x02\x9e\x4e\x8f\x62\x07\x4e\x22\x3b\xfc\x6c\x2f\x7d\xa4\xfc\x0d\xe8\xc7\xba\x9a\x05\xe8\x79\xbc\x1d\x1a\x8b\x8b\xe3\x0b\xa3\xad\x38\xe5\xea\xc7\x57\xc4\xb7\x0c\xe4\x0b\xce\xdc\x43\xee\xcf\x3b\x89\x06\x33\xc1\x1e\x0b\xa8\x18\x03\x2e\xd3\x99\x06\xd7\x3c\x14\x92\x74\x0f\x74\x27\x97\x3c\x6d\xa4\xc9\xdc\x1f\xd2\x53\xf5\x06\x6e\xdc\xa8\x39\xf3\x0b\x6d\xe0\x55\x07\x53\x5b\xc7\xb2\xc2\x8b\x13\xe8\xf2\x5a\xde\x19\xd9\xa0\xf7\xe4\xc6\xed\xb3\xf3\x11\x9a\x2e\xb5\x4a\x07\x90\xd0\x80\x5e\x3d\x18\x12\x67\x41\xb9\x88\xdc\xaf\x6a\xa7\x0a\x00\xcd\x87\xb3\x9e\x1d\x76\x1d\x96\x6c\x2c\x25\xf5\xd5\x65\x39\xe4\xa0\xef\x8f\x34\x56\xde\x6e\xac\x95\x17\x93\x49\x8e\xeb\xb6\x63\x0d\x7e\xbd\xe2\x52\x0b\xcd\x7a\x76\x5a\x45\x76\xad\xaf\xe8\x17\xd8\x76\x88\xad\xe0\xf7\x9d\x06\xd2\xa6\x6f\xe5\x1d\xd3\x3b\x4b\xe9\x32\xdb\xc5\xde\x40\xae\x26\x95\x32\x97\x98\x9d\x37\x1e\xa9\x59\x7c\x4d\x25\x77\x8b\x62\x44\xad\x91\x60\xc6\xe4\x62\x4b\x0e\xcc\x30\xd1\x2f\x3d\x18\x36\xe5\x5b\xbd\x3c\x96\x12\x9d\x99\xf3\xd4\xac\x3b\x15\x16\x67\x3c\x9a\x4b\x90\x54\xd4\x26\x7d\x9d\x56\x82\xd1\xdd\xcc\x01\xe9\x2c\x25\x5b\x9a\x1f\x42\x1f\x1b\x0c\x47\xa7\xcb\x26\x40\x34\x29\xf6\x7f\xca\xb8\x63\x61\x2f\x30\x7d\x49\x05\x73\xcf\xef\x25\xb9\x74\x43\x49\x5c\xed\x9d\x28\x37\x72\x9f\x4c\x96\xe9\x86\x86\xb9\x0d\xd9\x59\xa8\x5f\xd7\x0f\x32\xc6\x52\x6c\x58\xda\x2f\x4a\x57\x28\x63\xe8\x5e\xa0\x28\x4d\x7d\xa8\xb0\xd0\xe3\x7d\xea\x06\x02\x9d\x51\xf0\xa7\xce\xe2\x2e\x38\x65\xba\x39\xd8\x58\x95\x2b\x23\x99\xe1\x10\xaa\xa2\x9e\xfe\x4c\x0e\x39\xe8\x79\x0d\x1a\x47\x44\x58\x51\x29\xe1\x37\xb3\x44\x79\x78\xb7\x4c\x3e\x36\xec\xab\x4e\x12\x5c\xdd\xdd\x2e\x2b\x6a\x4e\x0d\x12\xa9\x59\xb4\x09\xf2\xdc\xbd\x9f\xcb\x88\x20\xc8\x33\xda\xf8\xb1\xa2\x91\xa3\x02\xc0\xc1\xaa\xb6\x59\x5d\x26\x6b\x56\xf4\x52\xea\x5a\x8e\xf6\x5e\xcd\xa4\x62\x73\x88\x3b\x37\x61\x9a\xd3\x17\xb8\xe9\xc9\x2c\xdf\xe1\x02\xb4\x00\x46\x3f\x2b\x6f\xa3\x00\xc7\x91\x8e\xc2\x81\xe5\x72\x79\x15\x92\x74\xf6\xb0\xfd\xf6\x76\x6b\xb2\x5c\xf1\x8c\x8a\x64\x9a\x84\x9d\x3c\x25\xd1\x0e\x21\xac\xd4\xe1\xde\x67\x1a\x56\x87\x9d\x89\x93\x64\x71\xbc\x9a\x07\x7d\xa8\x1c\x7f\xe2\x7d\x67\x8f\xd6\xc2\xb7\x60\x55\xc5\x24\x9c\x92\x1e\xf0\x5c\x1d\x12\xb9\xce\x98\x9b\x14\xf9\x74\x6d\xeb\xf2\x16\x06\xaa\xe0\xc1\x52\x7f\x60\x89\x73\xa5\x52\x04\x0b\xc3\x4e\x18\x04\x7a\xeb\xe5\x9d\x89\xf4\xd4\x17\xa5\xfc\xb4\x9a\x21\xa7\x92\xa7\x7a\xd0\x88\x38\xe5\xec\xa0\x71\x03\x25\xa9\xb5\xbe\x91\xfb\xd5\xcf\x46\xbf\xa4\x23\xa5\xa6\xca\xe5\x55\x4e\x4b\x67\x09\x83\xd2\xda\xa6\x7d\xaf\x79\x28\x37\x03\x00\xd0\x16\xb6\x3f\xaf\x12\x02\xd3\x8c\xc7\x93\x50\xba\x53\x12\x7c\x37\x9b\x7a\xae\xed\xb4\x26\x19\x13\x8e\x7e\x78\xde\x43\xf5\x95\xae\x7b\xf7\x2d\xd3\xef\xb0\x4d\x49\xf0\x5f\x92\xb5\x06\x36\x11\xe5\xaf\xd4\xe2\xa8\x1d\x26\x59\xef\xf4\x54\x91\x8b\xf2\x16\x9e\xc1\x1d\x86\x09\xa5\xca\x52\xaf\xac\x7c\x86\x5a\x5d\xa5\x66\x95\x62\x73\x44\x1f\x52\x5b\x3c\x2f\x02\xb9\xf2\xbc\xf4\xba\x4f\x17\x27\x65\x35\xb5\x90\x41\xbc\xda\xea\xfb\xdd\x39\xc7\x4e\x14\x0f\xc9\x01\x00\x70\x64\x4c\xb6\x00\xb7\x77\x1b\xeb\xd8\x41\x60\xda\xcf\xb5\xca\xdb\x89\x95\xa6\x64\xe3\x62\xdb\x73\xf5\xe6\x20\xb3\xe4\x56\x13\xa9\x4d\xae\xa0\x18\xd5\xc2\xa6\xe3\xb5\x6b\xd4\x77\x24\xf6\xcc\x35\x4c\xda\xe3\x8b\x34\x2a\x2e\x6f\x7a\x62\xb8\x38\x44\x04\xdb\xd1\x67\xa6\xa5\xf2\x16\x0f\x4c\x35\x94\x7c\x94\xd3\xe1\x13\xe2\x7f\xe4\xe4\xf3\xbf\x58\xab\x30\xd0\xe0\xb4\x5b\x88\xca\xc3\x7c\xa8\x6f\x10\x22\xc3\x5a\xd9\xc1\xe6\xed\x21\xeb\x32\x7d\x93\xf9\x39\xd1\xd7\x56\x1a\x5e\x90\x88\x4f\x6b\xb1\x5e\x41\xd6\xee\x37\x0c\x91\xec\x66\x00\xb4\x3c\xe5\xc6\x79\x56\x66\x7c\xe6\x9c\x2c\x43\xed\x71\x71\xb2\x92\xed\x7e\x29\x3b\x8f\xcc\x54\xd1\x1f\x7d\x14\x58\x32\xc7\x5b\x95\xa5\xbd\x93\x45\x7f\x19\x93\x78\x5c\xba\xa7\x4f\x3f\x31\x6b\xd4\xad\x56\x7b\xef\xf5\xa0\x39\x59\x01\x1e\x6f\x2d\xdc\x92\x1f\x09\x38\x16\xca\x7f\x4a\x55\x37\x56\x8f\xf5\xed\x68\xfa\xa0\x2c\xd5\x87\xfd\xf5\x20\x4b\x35\x24\xb5\x65\xe8\x98\xa2\x9f\x84\x1c\xcf\x89\xbe\x12\x05\x8c\x96\xd6\xfb\xdc\xce\x22\xa8\x5a\x72\x50\x28\x79\x70\xf5\x03\xce\xdb\x52\xf0\x46\x11\x8d\xea\x0b\xb5\x02\x78\xc8\xb8\x45\xa8\x8c\xc5\xe1\xcf\x72\x9b\x15\x7e\x75\x39\xe2\xa4\x1c\x5c\x90\x16\x3b\xed\xbd\xd7\x62\x34\x45\x4b\x7a\x4a\x49\x26\xb7\x39\xeb\x9b\x9e\x6a\x83\x86\x83\xb0\x11\xd2\x5c\x3c\x9a\x59\xca\x4e\x98\xf6\xd6\xb1\x8a\xe8\xa6\x11\x9f\xdd\xcc\x22\xc0\x1d\x55\xc2\x73\xbe\xb7\xf1\xf9\x93\xde\xf7\xe5\xd3\xb0\x18\x85\xb7\x94\xf9\x6d\xf6\x34\x7c\x61\x90\xc9\xcc\xfb\x77\x99\xb3\x1b\xb2\xbb\x7b\xa5\x6e\xa9\xae\x2e\xf9\xf8\x77\xb8\xab\xc0\xe6\xc5\xa6\xd2\xad\xb2\x04\xc3\xee\x65\xee\x79\xc5\x07\x7d\x94\xe6\xbc\x17\x30\x93\x6d\x05\x9c\x45\xe9\x3f\x21\x05\xb9\x3b\x12\x6b\x5a\xfb\xf0\xc0\x25\x96\xd4\xd2\x1c\xf8\xb2\x3b\xd1\xb1\x50\xde\x59\xa5\xfb\x25\xfd\x2b\xad\x7d\x00\x37\xd8\xfd\x9a\x3b\xe8\xd2\x46\xa7\xc9\x5c\xc2\x2e\x8c\x2b\xa1\xae\x9e\x0b\xda\xfb\x4d\xd7\x41\x8c\x30\x0f\x72\xb9\x7e\x1e\x00\x80\x9d\x6b\x58\x90\xca\xb4\xe4\x03\x84\x6e\xef\x23\x2e\xfc\x89\xb9\x0d\x47\x82\x5b\x31\x78\x93\x87\xe7\x6a\x49\xc9\x37\xd0\xb3\x57\xf4\x93\xa6\xf6\xeb\xa6\x7a\x3d\x4e\x1f\x37\xf8\xda\x4f\x97\xb3\x59\x60\x5f\x74\x75\x2e\x95\xff\x24\xd7\x1f\x2c\x7b\xd0\x4a\xe8\x06\x46\xef\x12\xab\xb9\x57\x36\xce\xf1\xbf\xfa\xfe\x96\xa6\x25\x08\xa5\xac\x2f\x42\xe8\xeb\x3a\xdc\xad\x0e\x0b\x7a\x78\x42\x82\xa0\x7e\x9b\x70\xda\x76\xcd\x4d\x9c\x9d\x83\x7c\x89\x91\xaf\x2f\x63\xd0\xd7\xc9\x4b\x26\x8b\x24\xe7\x61\x18\x65\x85\xb7\x3b\x39\x97\xc6\xf8\x26\xa3\xae\xd8\x52\x2a\x60\x9a\xdc\xa2\x92\xbe\x73\xa4\xc9\xa8\x0f\x7a\xee\x6e\x9c\x67\x36\x79\x60\x4f\xf7\x2b\x8f\x2e\xb7\x4a\xad\x00\xaa\x83\x4d\x3f\x17\x8c\xe1\x8a\xa7\xae\x8d\xcb\xc2\x28\xeb\x8b\xd2\x88\x54\x32\x01\x31\x5d\xb0\xa7\x8e\xe1\x52\xa8\x25\x91\x00\x01\x0e\xd5\x69\xf1\xa1\x33\xb6\xb7\x0d\xf2\x47\x5e\x67\x5a\x92\x0e\xe7\x5f\x57\x0b\xbf\x9d\x52\xac\x6e\x57\xb0\xa7\x87\x82\xb4\xc1\xd3\xb0\xb9\x32\x3e\x79\x44\xf6\xfc\x2b\x17\x59\xfa\x81\xd8\x8e\x5c\x54\xf3\x90\xd0\x54\xc1\xe6\x65\x07\xae\xb0\xe4\x5b\xbe\xe3\xf9\x8e\xa6\xf2\xcc\x93\x26\xc0\xf4\xe5\xea\xc6\xb5\x37\xeb\x5a\xa7\x66\x40\xb7\xa1\xd8\x5d\xc1\x12\xc5\xa5\x67\x8f\xb4\x62\xa3\xf2\xf2\xd5\xb1\x63\xc7\x9a\x66\x69\x72\x2c\x4e\xe9\x4a\xd7\x4a\x6f\x6b\x18\x3b\x62\x04\xf9\xa0\x7e\xd0\xca\x65\x1f\xa8\x2e\x7d\x2d\x07\x0d\x2d\xb7\x17\xf8\x61\x7d\xed\xdd\x1d\x7f\x05\x70\xfc\x50\x26\xb8\xaf\xbf\x30\xab\x96\x15\x80\x0a\x9d\xa3\xe5\x55\x53\x29\xfe\xad\x99\xf8\x0f\xa9\x05\x55\xa0\x1b\x00\x00\x6f\x8e\xa4\xb2\x91\x83\x5c\xa6\x7e\x4b\xd7\xfa\xf1\x92\x88\xe7\x5c\xa7\xec\x06\x74\x85\xcd\xac\x79\xa1\x7d\x95\x38\xce\x21\x72\x31\x43\xb5\x58\xcb\xfd\xc3\xb3\xcb\x9b\x9e\x68\xdc\xc2\xa3\xe2\x1f\x4b\xd6\x7c\xc0\x39\xa1\x89\xa0\x4d\x89\x47\x33\x46\x10\x38\xf8\x44\x1a\x49\xb1\xa8\x35\x53\xd9\x06\xc7\x4d\xeb\xf9\xeb\xbb\xe6\x9d\x5b\x0b\x3f\x28\x9a\x23\x07\x0e\x25\xfd\xf5\xb1\xc4\x80\x9b\xca\x56\x34\x16\x6b\x86\xa6\x2f\x21\x4a\x37\xa4\xc4\x70\x76\xc0\x29\x57\xdc\xd6\x17\xc5\x92\xe8\xb1\x23\xae\x87\xab\xec\x7c\x92\xfe\x27\x00\x00\xff\xff\x69\x89\xc1\x45\x79\xfe\x00\x00")
 
 func spritesChar1PngBytes() ([]byte, error) {
@@ -203,10 +224,11 @@ func AssetNames() []string {
 
 // _bindata is a table, holding each asset generator, mapped to its name.
 var _bindata = map[string]func() (*asset, error){
-	"sprites/char1.png":  spritesChar1Png,
-	"sprites/grass.png":  spritesGrassPng,
-	"sprites/loot.png":   spritesLootPng,
-	"sprites/player.png": spritesPlayerPng,
+	"atlases/player.json": atlasesPlayerJson,
+	"sprites/char1.png":   spritesChar1Png,
+	"sprites/grass.png":   spritesGrassPng,
+	"sprites/loot.png":    spritesLootPng,
+	"sprites/player.png":  spritesPlayerPng,
 }
 
 // AssetDir returns the file names below a certain
@@ -250,6 +272,9 @@ type bintree struct {
 }
 
 var _bintree = &bintree{nil, map[string]*bintree{
+	"atlases": &bintree{nil, map[string]*bintree{
+		"player.json": &bintree{atlasesPlayerJson, map[string]*bintree{}},
+	}},
 	"sprites": &bintree{nil, map[string]*bintree{
 		"char1.png":  &bintree{spritesChar1Png, map[string]*bintree{}},
 		"grass.png":  &bintree{spritesGrassPng, map[string]*bintree{}},
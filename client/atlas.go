@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/faiface/pixel"
+	"github.com/ilackarms/pkg/errors"
+	"github.com/mmogo/mmo/client/assets"
+	"github.com/mmogo/mmo/shared"
+)
+
+// asset directory holding one atlas definition per sprite sheet
+const atlasDir = "atlases"
+
+// AtlasDef describes how a sprite sheet is cut into animation frames
+type AtlasDef struct {
+	// asset path of the sprite sheet
+	Image string `json:"image"`
+	// size of the sheet in pixels
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	// the sheet is a grid of equally sized frames,
+	// numbered row by row starting at the top left
+	Columns int `json:"columns"`
+	Rows    int `json:"rows"`
+	// seconds each frame is shown; 0 uses the default
+	Speed float64 `json:"speed,omitempty"`
+	// frames of each action by direction
+	// directions without frames of their own are shown facing down
+	Animations map[shared.Action]map[shared.Direction]FrameSpan `json:"animations"`
+}
+
+// FrameSpan selects the frames of one animation, either listed
+// one by one or as the range [From, To)
+type FrameSpan struct {
+	Frames []int `json:"frames,omitempty"`
+	From   int   `json:"from,omitempty"`
+	To     int   `json:"to,omitempty"`
+}
+
+func (s FrameSpan) indices() []int {
+	if len(s.Frames) > 0 {
+		return s.Frames
+	}
+	var indices []int
+	for i := s.From; i < s.To; i++ {
+		indices = append(indices, i)
+	}
+	return indices
+}
+
+// Atlas cuts the frames of every animation out of the sheet
+func (def *AtlasDef) Atlas() (Atlas, error) {
+	if def.Width <= 0 || def.Height <= 0 || def.Columns <= 0 || def.Rows <= 0 {
+		return nil, errors.New("atlas needs a size and a frame grid", nil)
+	}
+	frameWidth := def.Width / float64(def.Columns)
+	frameHeight := def.Height / float64(def.Rows)
+	count := def.Columns * def.Rows
+	atlas := make(Atlas)
+	for action, directions := range def.Animations {
+		for dir, span := range directions {
+			indices := span.indices()
+			if len(indices) == 0 {
+				return nil, errors.New(fmt.Sprintf("no frames for %v facing %v", action, dir), nil)
+			}
+			frames := make([]pixel.Rect, len(indices))
+			for i, index := range indices {
+				if index < 0 || index >= count {
+					return nil, errors.New(fmt.Sprintf("frame %v of %v facing %v is not on the sheet", index, action, dir), nil)
+				}
+				// pictures have their origin at the bottom left
+				x := float64(index%def.Columns) * frameWidth
+				y := def.Height - float64(index/def.Columns+1)*frameHeight
+				frames[i] = pixel.R(x, y, x+frameWidth, y+frameHeight)
+			}
+			if atlas[dir] == nil {
+				atlas[dir] = make(map[shared.Action][]pixel.Rect)
+			}
+			atlas[dir][action] = frames
+		}
+	}
+	return atlas, nil
+}
+
+// loadAtlasDef reads the atlas definition at asset path
+func loadAtlasDef(path string) (*AtlasDef, error) {
+	contents, err := assets.Asset(path)
+	if err != nil {
+		return nil, errors.New("loading asset from "+path, err)
+	}
+	var def AtlasDef
+	if err := json.Unmarshal(contents, &def); err != nil {
+		return nil, errors.New("decoding atlas "+path, err)
+	}
+	return &def, nil
+}
+
+// loadSpriteSheets loads every sprite sheet that has an atlas definition,
+// named after its definition file
+func loadSpriteSheets() (map[string]*Sprite, error) {
+	names, err := assets.AssetDir(atlasDir)
+	if err != nil {
+		return nil, errors.New("listing atlases", err)
+	}
+	sheets := make(map[string]*Sprite)
+	for _, name := range names {
+		if path.Ext(name) != ".json" {
+			continue
+		}
+		def, err := loadAtlasDef(path.Join(atlasDir, name))
+		if err != nil {
+			return nil, err
+		}
+		atlas, err := def.Atlas()
+		if err != nil {
+			return nil, errors.New("invalid atlas "+name, err)
+		}
+		sheet, err := loadSpriteSheet(def.Image, atlas)
+		if err != nil {
+			return nil, errors.New("loading sprite sheet of "+name, err)
+		}
+		if bounds := sheet.Picture.Bounds(); bounds.W() < def.Width || bounds.H() < def.Height {
+			return nil, errors.New(fmt.Sprintf("%s is smaller than atlas %s", def.Image, name), nil)
+		}
+		sheet.Speed = def.Speed
+		sheets[strings.TrimSuffix(name, ".json")] = sheet
+	}
+	return sheets, nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"net"
+	"sync"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -22,8 +23,6 @@ const (
 	maxBufferedUpdates  = 30
 	maxBufferedRequests = 30
 
-	tickTime = time.Second / 10 //10 updates per sec
-
 	speechDisplayDuration = time.Second * 5
 )
 
@@ -39,9 +38,12 @@ var (
 )
 
 type client struct {
-	conn            net.Conn
-	win             *pixelgl.Window
-	playerID        string
+	conn     net.Conn
+	win      *pixelgl.Window
+	playerID string
+	// world is replaced when the player goes through a portal,
+	// while the other goroutines use it; see currentWorld
+	worldLock       sync.RWMutex
 	world           *shared.World
 	pongs           chan *shared.Pong
 	updates         chan *shared.Update
@@ -51,12 +53,15 @@ type client struct {
 	reqProcessor    *requestProcessor
 	errc            chan error
 	bufferedUpdates UpdateBuffer
+	predictor       *predictor
+	interpolator    *interpolator
 }
 
-func newClient(id string, conn net.Conn, win *pixelgl.Window, world *shared.World) *client {
+func newClient(id string, conn net.Conn, win *pixelgl.Window, world *shared.World, cfg *config) *client {
 	requests := make(chan *shared.Request, maxBufferedRequests)
 	updates := make(chan *shared.Update, maxBufferedUpdates)
 	predictions := make(chan *shared.Update, maxBufferedUpdates)
+	predictor := newPredictor()
 
 	return &client{
 		conn:         conn,
@@ -66,10 +71,12 @@ func newClient(id string, conn net.Conn, win *pixelgl.Window, world *shared.Worl
 		requests:     requests,
 		updates:      updates,
 		predictions:  predictions,
-		inProcessor:  newInputProcessor(win, requests, screen2Map, &cam),
-		reqProcessor: newRequestManager(id, requests, predictions, conn),
+		inProcessor:  newInputProcessor(win, requests, screen2Map, &cam, cfg),
+		reqProcessor: newRequestManager(id, requests, predictions, predictor, conn),
 		errc:         make(chan error),
 		pongs:        make(chan *shared.Pong),
+		predictor:    predictor,
+		interpolator: newInterpolator(time.Duration(cfg.InterpolationDelay) * time.Millisecond),
 	}
 }
 
@@ -134,45 +141,120 @@ func (c *client) latency() time.Duration {
 
 func (c *client) processUpdates() {
 	for {
+		world := c.currentWorld()
 		select {
 		//authoritative, server-sent
 		case update := <-c.updates:
-			processed := update.Processed.Add(c.latency() / 2)
-			// TODO: evaluate whether we should do this rollback of state
-			// right now it makes things jittery and adds nothing useful
-			if false {
-				bef := c.world.Before(processed)
-				if bef != c.world {
-					log.Printf("stepping back to world at %v", processed)
-				}
-				c.world = bef
+			// the server sends a new world when the player enters another zone
+			if update.WorldState != nil && update.WorldState.World != nil {
+				c.worldLock.Lock()
+				c.world = update.WorldState.World
+				c.worldLock.Unlock()
+				c.bufferedUpdates = nil
+				c.predictor.reset()
+				c.interpolator.reset()
+				continue
+			}
+			c.buffer(update)
+			// the player's own moves were predicted when they were requested
+			if dest := update.PlayerDestination; dest != nil && dest.ID == c.playerID && dest.Seq > 0 {
+				c.predictor.ack(dest.Seq)
+				continue
 			}
+			if moved := update.PlayerPosition; moved != nil && moved.ID == c.playerID {
+				c.reconcile(world, moved, update.Tick)
+				continue
+			}
+			processed := update.Processed.Add(c.latency() / 2)
 			c.bufferedUpdates = c.bufferedUpdates.From(processed)
-			if err := c.world.ApplyUpdates(update); err != nil {
+			if err := world.ApplyUpdates(update); err != nil {
 				c.errc <- err
 			}
-			if err := c.world.ApplyUpdates(c.bufferedUpdates...); err != nil {
+			if err := world.ApplyUpdates(c.bufferedUpdates...); err != nil {
 				c.errc <- err
 			}
 		case prediction := <-c.predictions:
-			if false {
-				c.world.ApplyUpdates(prediction)
+			dest := prediction.PlayerDestination
+			if dest == nil {
+				// anything else is shown once the server confirms it
+				continue
+			}
+			if err := world.ApplyUpdates(prediction); err != nil {
+				c.errc <- err
+				continue
 			}
-		case processed := <-c.world.ProcessedUpdates():
+			c.predictor.predicted(shared.Move{Seq: dest.Seq, Tick: world.Tick, Destination: dest.Destination})
+		case processed := <-world.ProcessedUpdates():
 			c.bufferedUpdates.Insert(processed)
 		}
 	}
 }
 
+// buffer keeps the positions of remote entities for the interpolator
+// it must be called before the update is applied, which changes its tick
+func (c *client) buffer(update *shared.Update) {
+	if update.Tick > 0 {
+		c.interpolator.sync(update.Tick, time.Now())
+	}
+	switch {
+	case update.PlayerPosition != nil && update.PlayerPosition.ID != c.playerID:
+		moved := update.PlayerPosition
+		c.interpolator.record(moved.ID, update.Tick, moved.Position, moved.Walking)
+	case update.EntityPosition != nil:
+		moved := update.EntityPosition
+		c.interpolator.record(moved.ID, update.Tick, moved.Position, moved.Walking)
+	case update.RemovePlayer != nil:
+		c.interpolator.forget(update.RemovePlayer.ID)
+	case update.RemoveEntity != nil:
+		c.interpolator.forget(update.RemoveEntity.ID)
+	case update.EntityRespawned != nil:
+		// it reappears elsewhere instead of walking there
+		c.interpolator.forget(update.EntityRespawned.ID)
+	}
+}
+
+// reconcile corrects the predicted position of the player
+// with the one the server had at tick
+func (c *client) reconcile(world *shared.World, moved *shared.PlayerPosition, tick uint64) {
+	self, ok := world.GetPlayer(c.playerID)
+	if !ok {
+		return
+	}
+	position, ok := c.predictor.reconcile(world, moved, tick)
+	if !ok || shared.WithinRange(position, self.Position, predictionTolerance) {
+		return
+	}
+	c.predictor.correct(self.Position, position)
+	corrected := &shared.Update{PlayerPosition: &shared.PlayerPosition{
+		ID:       c.playerID,
+		Position: position,
+		Facing:   self.Facing,
+		Walking:  self.Action == shared.A_WALK,
+	}}
+	if err := world.ApplyUpdates(corrected); err != nil {
+		c.errc <- err
+	}
+}
+
+// currentWorld returns the world of the zone the player is in
+func (c *client) currentWorld() *shared.World {
+	c.worldLock.RLock()
+	defer c.worldLock.RUnlock()
+	return c.world
+}
+
 func (c *client) stepWorld() {
-	tick := time.NewTicker(tickTime)
+	tick := time.NewTicker(shared.TickDuration)
 	last := time.Now()
 	for {
 		select {
 		case now := <-tick.C:
-			c.world.Step(now.Sub(last))
+			world := c.currentWorld()
+			world.Advance(now.Sub(last))
+			// rendering interpolates from the state before the last step
+			world.Keep(2)
+			last = now
 		}
-		last = time.Now()
 	}
 }
 
@@ -189,7 +271,6 @@ func (c *client) render() {
 	// for drawing
 	win := c.win
 	batches := data.batches
-	drawables := data.drawables
 	txt := data.txt
 
 	// for calculating camera position
@@ -206,9 +287,10 @@ func (c *client) render() {
 	var prev *shared.World
 
 	for !win.Closed() {
+		world := c.currentWorld()
 		// a step happened
-		if prev != c.world.Prev() {
-			prev = c.world.Prev()
+		if prev != world.Prev() {
+			prev = world.Prev()
 			lerpTime = 0
 		}
 		// wait for a step
@@ -218,31 +300,61 @@ func (c *client) render() {
 		dt := time.Since(last)
 		last = time.Now()
 		win.Clear(colornames.Darkgray)
+		// the map changes when the player goes through a portal
+		if err := data.setTerrain(world.Map); err != nil {
+			c.errc <- err
+		}
+		for _, batch := range data.terrain {
+			batch.Draw(win)
+		}
 		if !data.debugMode {
 			batches["debug_grid"].Draw(win)
 			drawDebugCoords(win)
 		}
-		playerSprite := drawables["player"]
-
 		var self *shared.Player
 		var selfTransform pixel.Matrix
 		var mappedPos pixel.Vec
 
 		lerpTime += dt
-		//t := time.Since(prev.Updated).Seconds() / c.world.Updated.Sub(prev.Updated).Seconds()
-		t := shared.Clamp(lerpTime.Seconds()/c.world.Updated.Sub(prev.Updated).Seconds(), 0, 1)
+		//t := time.Since(prev.Updated).Seconds() / world.Updated.Sub(prev.Updated).Seconds()
+		t := shared.Clamp(lerpTime.Seconds()/world.Updated.Sub(prev.Updated).Seconds(), 0, 1)
 		//log.Printf("lerpin thru time: %v", t)
-		LerpWorld(prev, c.world, t).ForEach(func(player *shared.Player) {
+		// the player is drawn between the last two steps of its prediction,
+		// everyone else from the states the server sent
+		lerpedWorld := LerpWorld(prev, world, t)
+		now := time.Now()
+		lerpedWorld.ForEachEntity(func(entity *shared.Entity) {
+			if !entity.Active || entity.ID == c.playerID {
+				return
+			}
+			if position, ok := c.interpolator.position(entity.ID, now); ok {
+				entity.Position = position
+			}
+		})
+		lerpedWorld.ForEachEntity(func(entity *shared.Entity) {
+			if !entity.Active || entity.Kind == shared.E_PLAYER {
+				return
+			}
+			drawEntity(win, data, entity, dt.Seconds())
+		})
+		lerpedWorld.ForEachProjectile(func(projectile *shared.Projectile) {
+			drawProjectile(win, projectile)
+		})
+		offset := c.predictor.smooth(dt)
+		lerpedWorld.ForEach(func(player *shared.Player) {
 			if !player.Active {
 				return
 			}
-			mappedPos = map2Screen(player.Position)
+			position := player.Position
+			if player.ID == c.playerID {
+				position = position.Add(offset)
+			}
+			mappedPos = map2Screen(position)
 			transform := pixel.IM.Moved(mappedPos)
 			clr := stringToColor(player.ID)
-			playerAnimation := playerSprite.(*Sprite)
-			playerAnimation.Animate(dt.Seconds(), shared.UnitToDirection(mappedPos), shared.A_WALK)
-
-			playerSprite.DrawColorMask(win, transform, clr)
+			drawPlayer(win, data, player, transform, dt.Seconds())
+			drawHealthBar(win, &player.Entity)
+			drawLevel(win, txt, player)
 			for i, speechMsg := range player.SpeechBuffer {
 				line := speechMsg.Txt
 				if line == "" {
@@ -271,7 +383,19 @@ func (c *client) render() {
 		}
 
 		// handle inputs here
-		c.inProcessor.handleInputs(self, data)
+		c.inProcessor.handleInputs(self, world, data)
+
+		if !self.Alive() {
+			line := "you died. press " + c.inProcessor.keys.Name(C_RESPAWN) + " to respawn"
+			if tick := world.Tick; tick < self.RespawnTick {
+				line = fmt.Sprintf("you died. respawn in %v", time.Duration(self.RespawnTick-tick)*shared.TickDuration)
+			}
+			txt.Clear()
+			txt.Dot = txt.Orig
+			txt.Dot.X -= txt.BoundsOf(line).W() / 2
+			txt.WriteString(line)
+			txt.DrawColorMask(win, selfTransform.Moved(pixel.V(0, 64)), colornames.White)
+		}
 
 		if c.inProcessor.typing {
 			txt.Clear()
@@ -282,6 +406,9 @@ func (c *client) render() {
 		}
 
 		camPosition = pixel.Lerp(camPosition, windowCenter.Sub(mappedPos), 1-math.Pow(1.0/128, dt.Seconds()))
+		if area, ok := world.PlayArea(); ok {
+			camPosition = clampCamera(camPosition, win.Bounds(), area)
+		}
 		cam = pixel.IM.Moved(camPosition)
 		if !data.debugMode {
 			mousePos := cam.Unproject(win.MousePosition())
@@ -293,8 +420,19 @@ func (c *client) render() {
 
 		win.SetMatrix(cam)
 
-		drawables["loot"].Draw(win, selfTransform)
-		playerSprite.Draw(win, selfTransform)
+		// self is drawn on top of everything else
+		drawPlayer(win, data, self, selfTransform, 0)
+		data.animations.prune(world)
+		trade, trading := world.GetTrade(self.ID)
+		if trading {
+			drawTrade(win, txt, self, trade, c.inProcessor.keys)
+		}
+		if c.inProcessor.inventoryOpen || trading && trade.Accepted {
+			drawInventory(win, txt, self, c.inProcessor.keys)
+		}
+		if c.inProcessor.settings.open {
+			c.inProcessor.settings.draw(txt)
+		}
 
 		win.Update()
 
@@ -310,10 +448,32 @@ func (c *client) render() {
 }
 
 type renderData struct {
-	drawables map[string]drawable
-	batches   map[string]*pixel.Batch
-	txt       *text.Text
-	debugMode bool
+	drawables  map[string]drawable
+	animations *animator
+	batches    map[string]*pixel.Batch
+	terrain    []*pixel.Batch
+	// map the terrain was drawn from
+	terrainMap *shared.TileMap
+	txt        *text.Text
+	debugMode  bool
+}
+
+// setTerrain draws the terrain of m, unless it is already drawn
+func (data *renderData) setTerrain(m *shared.TileMap) error {
+	if m == data.terrainMap {
+		return nil
+	}
+	data.terrain = nil
+	data.terrainMap = m
+	if m == nil {
+		return nil
+	}
+	terrain, err := tileMapBatches(m, gameScale)
+	if err != nil {
+		return errors.New("failed to draw map "+m.Name, err)
+	}
+	data.terrain = terrain
+	return nil
 }
 
 func (c *client) loadDrawables() (*renderData, error) {
@@ -325,15 +485,27 @@ func (c *client) loadDrawables() (*renderData, error) {
 		return nil, errors.New("failed to load image", err)
 	}
 	drawables["loot"] = pixel.NewSprite(lootImage, lootImage.Bounds())
-	drawables["player"], err = loadSpriteSheet("sprites/char1.png", nil)
+	sheets, err := loadSpriteSheets()
 	if err != nil {
-		return nil, errors.New("failed to load player sprite", err)
+		return nil, errors.New("failed to load sprite sheets", err)
+	}
+	if _, ok := sheets["player"]; !ok {
+		return nil, errors.New("no atlas for the player sprite sheet", nil)
+	}
+	animations := newAnimator()
+	for name, sheet := range sheets {
+		animations.addSheet(name, sheet)
 	}
 	textAtlas := text.NewAtlas(basicfont.Face7x13, text.ASCII)
 	txt := text.New(pixel.ZV, textAtlas)
-	return &renderData{
-		drawables: drawables,
-		batches:   batches,
-		txt:       txt,
-	}, nil
+	data := &renderData{
+		drawables:  drawables,
+		animations: animations,
+		batches:    batches,
+		txt:        txt,
+	}
+	if err := data.setTerrain(c.currentWorld().Map); err != nil {
+		return nil, err
+	}
+	return data, nil
 }
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/faiface/pixel/pixelgl"
+	"github.com/ilackarms/pkg/errors"
+)
+
+// Control is something the player does with a button
+type Control string
+
+const (
+	C_MOVE           Control = "move"
+	C_ATTACK         Control = "attack"
+	C_SLASH          Control = "slash"
+	C_THRUST         Control = "thrust"
+	C_SHOOT          Control = "shoot"
+	C_SPELL          Control = "spell"
+	C_CHAT           Control = "chat"
+	C_INVENTORY      Control = "inventory"
+	C_PICKUP         Control = "pickup"
+	C_DROP_STACK     Control = "drop-stack"
+	C_SLOT_1         Control = "slot-1"
+	C_SLOT_2         Control = "slot-2"
+	C_SLOT_3         Control = "slot-3"
+	C_SLOT_4         Control = "slot-4"
+	C_SLOT_5         Control = "slot-5"
+	C_SLOT_6         Control = "slot-6"
+	C_SLOT_7         Control = "slot-7"
+	C_SLOT_8         Control = "slot-8"
+	C_SLOT_9         Control = "slot-9"
+	C_UNEQUIP_WEAPON Control = "unequip-weapon"
+	C_UNEQUIP_HEAD   Control = "unequip-head"
+	C_UNEQUIP_BODY   Control = "unequip-body"
+	C_UNEQUIP_FEET   Control = "unequip-feet"
+	C_TRADE          Control = "trade"
+	C_TRADE_CONFIRM  Control = "trade-confirm"
+	C_TRADE_CANCEL   Control = "trade-cancel"
+	C_RESPAWN        Control = "respawn"
+	C_DEBUG          Control = "debug"
+	C_SETTINGS       Control = "settings"
+)
+
+// Controls lists every control in the order the settings screen shows them
+var Controls = []Control{
+	C_MOVE, C_ATTACK, C_SLASH, C_THRUST, C_SHOOT, C_SPELL,
+	C_CHAT, C_INVENTORY, C_PICKUP, C_DROP_STACK,
+	C_SLOT_1, C_SLOT_2, C_SLOT_3, C_SLOT_4, C_SLOT_5, C_SLOT_6, C_SLOT_7, C_SLOT_8, C_SLOT_9,
+	C_UNEQUIP_WEAPON, C_UNEQUIP_HEAD, C_UNEQUIP_BODY, C_UNEQUIP_FEET,
+	C_TRADE, C_TRADE_CONFIRM, C_TRADE_CANCEL,
+	C_RESPAWN, C_DEBUG, C_SETTINGS,
+}
+
+// Bindings maps each control to the button that performs it
+// the same button may be bound to controls used at different times,
+// such as choosing an attack and using an inventory slot
+type Bindings map[Control]pixelgl.Button
+
+var defaultBindings = Bindings{
+	C_MOVE:           pixelgl.MouseButtonLeft,
+	C_ATTACK:         pixelgl.MouseButtonRight,
+	C_SLASH:          pixelgl.Key1,
+	C_THRUST:         pixelgl.Key2,
+	C_SHOOT:          pixelgl.Key3,
+	C_SPELL:          pixelgl.Key4,
+	C_CHAT:           pixelgl.KeyEnter,
+	C_INVENTORY:      pixelgl.KeyI,
+	C_PICKUP:         pixelgl.KeyE,
+	C_DROP_STACK:     pixelgl.KeyLeftShift,
+	C_SLOT_1:         pixelgl.Key1,
+	C_SLOT_2:         pixelgl.Key2,
+	C_SLOT_3:         pixelgl.Key3,
+	C_SLOT_4:         pixelgl.Key4,
+	C_SLOT_5:         pixelgl.Key5,
+	C_SLOT_6:         pixelgl.Key6,
+	C_SLOT_7:         pixelgl.Key7,
+	C_SLOT_8:         pixelgl.Key8,
+	C_SLOT_9:         pixelgl.Key9,
+	C_UNEQUIP_WEAPON: pixelgl.KeyZ,
+	C_UNEQUIP_HEAD:   pixelgl.KeyX,
+	C_UNEQUIP_BODY:   pixelgl.KeyC,
+	C_UNEQUIP_FEET:   pixelgl.KeyV,
+	C_TRADE:          pixelgl.KeyT,
+	C_TRADE_CONFIRM:  pixelgl.KeyY,
+	C_TRADE_CANCEL:   pixelgl.KeyN,
+	C_RESPAWN:        pixelgl.KeyR,
+	C_DEBUG:          pixelgl.KeyF2,
+	C_SETTINGS:       pixelgl.KeyF1,
+}
+
+// Name returns the lowercase name of the button bound to c, for help texts
+func (b Bindings) Name(c Control) string {
+	return strings.ToLower(b[c].String())
+}
+
+// MarshalJSON writes buttons by name, e.g. "A" or "MouseButtonLeft"
+func (b Bindings) MarshalJSON() ([]byte, error) {
+	names := make(map[Control]string)
+	for control, button := range b {
+		names[control] = button.String()
+	}
+	return json.Marshal(names)
+}
+
+// UnmarshalJSON only changes the controls listed,
+// so that files written before a control was added still work
+func (b Bindings) UnmarshalJSON(data []byte) error {
+	var names map[Control]string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return err
+	}
+	for control, name := range names {
+		button, ok := buttonNamed(name)
+		if !ok {
+			return errors.New("unknown button "+name+" for "+string(control), nil)
+		}
+		b[control] = button
+	}
+	return nil
+}
+
+func buttonNamed(name string) (pixelgl.Button, bool) {
+	for button := pixelgl.Button(0); button <= pixelgl.KeyLast; button++ {
+		if button.String() == name {
+			return button, true
+		}
+	}
+	return 0, false
+}
+
+// config holds the settings of the client, kept in a json file
+// settings missing from the file keep their defaults
+type config struct {
+	path   string
+	Width  float64
+	Height float64
+	VSync  bool
+	Keys   Bindings
+	// how many milliseconds behind the server other entities are drawn
+	// higher values hide more lag, but show everyone later
+	InterpolationDelay int
+}
+
+func defaultConfig(path string) *config {
+	keys := make(Bindings)
+	for control, button := range defaultBindings {
+		keys[control] = button
+	}
+	return &config{
+		path:   path,
+		Width:  800,
+		Height: 600,
+		VSync:  true,
+		Keys:   keys,
+
+		InterpolationDelay: 200,
+	}
+}
+
+// loadConfig reads the config at path, if there is one
+func loadConfig(path string) (*config, error) {
+	cfg := defaultConfig(path)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, errors.New("reading config from "+path, err)
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, errors.New("parsing config in "+path, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, errors.New("window size in "+path+" must be positive", nil)
+	}
+	if cfg.InterpolationDelay < 0 {
+		return nil, errors.New("interpolation delay in "+path+" can not be negative", nil)
+	}
+	return cfg, nil
+}
+
+func (cfg *config) save() error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return errors.New("encoding config", err)
+	}
+	if err := ioutil.WriteFile(cfg.path, data, 0644); err != nil {
+		return errors.New("writing config to "+cfg.path, err)
+	}
+	return nil
+}
@@ -23,29 +23,86 @@ type inputProcessor struct {
 	//related to speech, consider wrapping in a struct
 	typing bool
 	typed  string
+
+	// attack performed on right click
+	attack shared.Action
+
+	// while the inventory is open, slot keys use and drop items
+	inventoryOpen bool
+
+	// buttons bound to each control; changed by the settings screen
+	keys     Bindings
+	settings *settingsScreen
+}
+
+// controls selecting inventory slots
+var slotControls = []Control{
+	C_SLOT_1, C_SLOT_2, C_SLOT_3,
+	C_SLOT_4, C_SLOT_5, C_SLOT_6,
+	C_SLOT_7, C_SLOT_8, C_SLOT_9,
+}
+
+// while the inventory is open, these take off what is worn in a slot
+var unequipControls = map[Control]shared.EquipSlot{
+	C_UNEQUIP_WEAPON: shared.SLOT_WEAPON,
+	C_UNEQUIP_HEAD:   shared.SLOT_HEAD,
+	C_UNEQUIP_BODY:   shared.SLOT_BODY,
+	C_UNEQUIP_FEET:   shared.SLOT_FEET,
 }
 
-func newInputProcessor(win *pixelgl.Window, requests chan *shared.Request, screen2Map projectionFunc, cam *pixel.Matrix) *inputProcessor {
+// controls for choosing the attack performed by C_ATTACK
+var attackControls = map[Control]shared.Action{
+	C_SLASH:  shared.A_SLASH,
+	C_THRUST: shared.A_THRUST,
+	C_SHOOT:  shared.A_SHOOT,
+	C_SPELL:  shared.A_SPELL,
+}
+
+func newInputProcessor(win *pixelgl.Window, requests chan *shared.Request, screen2Map projectionFunc, cam *pixel.Matrix, cfg *config) *inputProcessor {
 	return &inputProcessor{
 		win:            win,
 		cam:            cam,
 		requestsToSend: requests,
 		screen2Map:     screen2Map,
+		attack:         shared.A_SLASH,
+		keys:           cfg.Keys,
+		settings:       newSettingsScreen(win, cfg),
 	}
 }
 
+func (ip *inputProcessor) justPressed(c Control) bool {
+	return ip.win.JustPressed(ip.keys[c])
+}
+
+func (ip *inputProcessor) pressed(c Control) bool {
+	return ip.win.Pressed(ip.keys[c])
+}
+
 // query for player inputs and generate requests based on them
 // call during window update loop
-func (ip *inputProcessor) handleInputs(player *shared.Player, data *renderData) {
-	ip.handleMovement(player)
+func (ip *inputProcessor) handleInputs(player *shared.Player, world *shared.World, data *renderData) {
+	if !ip.typing && ip.settings.handle() {
+		return
+	}
+	if !player.Alive() {
+		ip.handleRespawn()
+		ip.handleDebug(data)
+		return
+	}
+	ip.handleMovement(player, world)
+	if !ip.handleTrade(player, world) {
+		ip.handleInventory(player, world)
+	}
+	ip.handleCombat(player)
 	ip.handleSpeech()
 	ip.handleDebug(data)
 }
 
-func (ip *inputProcessor) handleMovement(player *shared.Player) {
-	if ip.win.Pressed(pixelgl.MouseButtonLeft) {
+func (ip *inputProcessor) handleMovement(player *shared.Player, world *shared.World) {
+	if ip.pressed(C_MOVE) {
 		mouseWorldCoordinates := shared.RoundVec(ip.cam.Unproject(ip.win.MousePosition()), 1)
-		destination := ip.screen2Map(mouseWorldCoordinates)
+		// the server would clamp it anyway
+		destination := world.ClampToPlayArea(ip.screen2Map(mouseWorldCoordinates))
 		// dont send request if player already in this direction
 		if destination != player.Destination && destination != ip.cache.destination {
 			log.Printf("newdest %v", destination)
@@ -57,9 +114,131 @@ func (ip *inputProcessor) handleMovement(player *shared.Player) {
 	}
 }
 
+func (ip *inputProcessor) handleCombat(player *shared.Player) {
+	if ip.typing || ip.inventoryOpen {
+		return
+	}
+	for control, attack := range attackControls {
+		if ip.justPressed(control) {
+			ip.attack = attack
+		}
+	}
+	// the server decides whether the attack is off cooldown
+	if ip.justPressed(C_ATTACK) {
+		target := ip.cam.Unproject(ip.win.MousePosition()).Scaled(1.0 / gameScale)
+		ip.pushRequest(&shared.Request{AttackRequest: &shared.AttackRequest{
+			Action: ip.attack,
+			Target: target,
+		}})
+	}
+}
+
+func (ip *inputProcessor) handleInventory(player *shared.Player, world *shared.World) {
+	if ip.typing {
+		return
+	}
+	if ip.justPressed(C_INVENTORY) {
+		ip.inventoryOpen = !ip.inventoryOpen
+	}
+	if ip.justPressed(C_PICKUP) {
+		for _, entity := range world.QueryRadius(player.Position, 1.5) {
+			if entity.Kind == shared.E_LOOT {
+				ip.pushRequest(&shared.Request{PickupRequest: &shared.PickupRequest{LootID: entity.ID}})
+				break
+			}
+		}
+	}
+	if !ip.inventoryOpen {
+		return
+	}
+	for i, control := range slotControls {
+		if !ip.justPressed(control) || i >= len(player.Inventory) {
+			continue
+		}
+		stack := player.Inventory[i]
+		// C_DROP_STACK held drops the whole stack
+		switch {
+		case ip.pressed(C_DROP_STACK):
+			ip.pushRequest(&shared.Request{DropRequest: &shared.DropRequest{Item: stack.Item, Count: stack.Count}})
+		case shared.Items[stack.Item].Slot != "":
+			ip.pushRequest(&shared.Request{EquipRequest: &shared.EquipRequest{Item: stack.Item}})
+		default:
+			ip.pushRequest(&shared.Request{UseRequest: &shared.UseRequest{Item: stack.Item}})
+		}
+	}
+	for control, slot := range unequipControls {
+		if ip.justPressed(control) {
+			ip.pushRequest(&shared.Request{UnequipRequest: &shared.UnequipRequest{Slot: slot}})
+		}
+	}
+}
+
+// C_TRADE asks the nearest player to trade, or accepts when asked by someone
+// while trading, slot keys offer or take back an inventory slot,
+// C_TRADE_CONFIRM confirms the trade and C_TRADE_CANCEL cancels it
+// returns whether the player is in an open trade
+func (ip *inputProcessor) handleTrade(player *shared.Player, world *shared.World) bool {
+	if ip.typing {
+		return false
+	}
+	trade, ok := world.GetTrade(player.ID)
+	if ip.justPressed(C_TRADE_CANCEL) && ok {
+		ip.pushRequest(&shared.Request{TradeCancelRequest: &shared.TradeCancelRequest{}})
+		return false
+	}
+	if ip.justPressed(C_TRADE) {
+		switch {
+		case ok && trade.To == player.ID && !trade.Accepted:
+			ip.pushRequest(&shared.Request{TradeAcceptRequest: &shared.TradeAcceptRequest{With: trade.From}})
+		case !ok:
+			for _, entity := range world.QueryRadius(player.Position, 4) {
+				if entity.Kind == shared.E_PLAYER && entity.ID != player.ID {
+					ip.pushRequest(&shared.Request{TradeRequest: &shared.TradeRequest{With: entity.ID}})
+					break
+				}
+			}
+		}
+	}
+	if !ok || !trade.Accepted {
+		return false
+	}
+	if ip.justPressed(C_TRADE_CONFIRM) {
+		ip.pushRequest(&shared.Request{TradeConfirmRequest: &shared.TradeConfirmRequest{}})
+	}
+	for i, control := range slotControls {
+		if !ip.justPressed(control) || i >= len(player.Inventory) {
+			continue
+		}
+		stack := player.Inventory[i]
+		var offer []shared.ItemStack
+		offered := false
+		for _, s := range trade.Side(player.ID).Offer {
+			if s.Item == stack.Item {
+				offered = true
+				continue
+			}
+			offer = append(offer, s)
+		}
+		if !offered {
+			offer = append(offer, stack)
+		}
+		ip.pushRequest(&shared.Request{TradeOfferRequest: &shared.TradeOfferRequest{Offer: offer}})
+	}
+	return true
+}
+
+// the server decides whether the respawn delay has passed
+func (ip *inputProcessor) handleRespawn() {
+	ip.typing = false
+	ip.typed = ""
+	if ip.justPressed(C_RESPAWN) {
+		ip.pushRequest(&shared.Request{RespawnRequest: &shared.RespawnRequest{}})
+	}
+}
+
 func (ip *inputProcessor) handleSpeech() {
 	if !ip.typing {
-		if ip.win.JustPressed(pixelgl.KeyEnter) {
+		if ip.justPressed(C_CHAT) {
 			ip.typing = true
 			return
 		}
@@ -89,7 +268,7 @@ func (ip *inputProcessor) handleSpeech() {
 
 // handle special cases / debug here
 func (ip *inputProcessor) handleDebug(data *renderData) {
-	if ip.win.JustPressed(pixelgl.KeyF2) {
+	if ip.justPressed(C_DEBUG) {
 		data.debugMode = !data.debugMode
 	}
 }
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/faiface/pixel"
+	"github.com/mmogo/mmo/shared"
+)
+
+const (
+	// how far past the newest state remote entities keep walking
+	// when updates are late, before they stand still
+	maxExtrapolation = time.Millisecond * 250
+	// states older than this behind the render time are dropped
+	interpolationHistory = time.Second
+)
+
+// sample is the position of an entity at a tick of the server
+type sample struct {
+	tick     uint64
+	position pixel.Vec
+	walking  bool
+}
+
+// interpolator buffers the positions the server sends for remote entities
+// and draws them a fixed delay behind server time, so that there are
+// usually two states to interpolate between
+type interpolator struct {
+	lock    sync.Mutex
+	delay   time.Duration
+	samples map[string][]sample
+	// local time at which the server was at tick 0, estimated from
+	// the ticks of the updates it sends. zero until the first update
+	epoch time.Time
+}
+
+func newInterpolator(delay time.Duration) *interpolator {
+	return &interpolator{
+		delay:   delay,
+		samples: make(map[string][]sample),
+	}
+}
+
+// sync moves the estimate of server time towards an update
+// of the given tick received at now
+func (ip *interpolator) sync(tick uint64, now time.Time) {
+	ip.lock.Lock()
+	defer ip.lock.Unlock()
+	epoch := now.Add(-time.Duration(tick) * shared.TickDuration)
+	drift := epoch.Sub(ip.epoch)
+	if ip.epoch.IsZero() || drift > time.Second || drift < -time.Second {
+		ip.epoch = epoch
+		return
+	}
+	// smoothed so that jitter in the arrival of updates does not show
+	ip.epoch = ip.epoch.Add(drift / 10)
+}
+
+// record adds the position of id at tick
+func (ip *interpolator) record(id string, tick uint64, position pixel.Vec, walking bool) {
+	ip.lock.Lock()
+	defer ip.lock.Unlock()
+	samples := ip.samples[id]
+	if n := len(samples); n > 0 {
+		if samples[n-1].tick > tick {
+			return
+		}
+		if samples[n-1].tick == tick {
+			samples = samples[:n-1]
+		}
+	}
+	ip.samples[id] = append(samples, sample{tick: tick, position: position, walking: walking})
+}
+
+// forget drops the buffered states of id
+func (ip *interpolator) forget(id string) {
+	ip.lock.Lock()
+	defer ip.lock.Unlock()
+	delete(ip.samples, id)
+}
+
+// reset drops everything, e.g. after entering another zone,
+// whose world counts ticks differently
+func (ip *interpolator) reset() {
+	ip.lock.Lock()
+	defer ip.lock.Unlock()
+	ip.samples = make(map[string][]sample)
+	ip.epoch = time.Time{}
+}
+
+// position returns where id is drawn at local time now
+// returns false if nothing is buffered for it
+func (ip *interpolator) position(id string, now time.Time) (pixel.Vec, bool) {
+	ip.lock.Lock()
+	defer ip.lock.Unlock()
+	samples := ip.samples[id]
+	if len(samples) == 0 || ip.epoch.IsZero() {
+		return pixel.ZV, false
+	}
+	// render time, in server ticks
+	at := float64(now.Sub(ip.epoch)-ip.delay) / float64(shared.TickDuration)
+	samples = ip.trim(id, at)
+	if at <= float64(samples[0].tick) {
+		return samples[0].position, true
+	}
+	for i := 1; i < len(samples); i++ {
+		from, to := samples[i-1], samples[i]
+		if at <= float64(to.tick) {
+			t := (at - float64(from.tick)) / float64(to.tick-from.tick)
+			return pixel.Lerp(from.position, to.position, t), true
+		}
+	}
+	last := samples[len(samples)-1]
+	if !last.walking || len(samples) < 2 {
+		return last.position, true
+	}
+	prev := samples[len(samples)-2]
+	ahead := shared.Clamp(at-float64(last.tick), 0, float64(maxExtrapolation)/float64(shared.TickDuration))
+	velocity := last.position.Sub(prev.position).Scaled(1 / float64(last.tick-prev.tick))
+	return last.position.Add(velocity.Scaled(ahead)), true
+}
+
+// trim drops the states of id that are too old to be drawn again,
+// keeping at least two
+// caller must hold lock
+func (ip *interpolator) trim(id string, at float64) []sample {
+	samples := ip.samples[id]
+	oldest := at - float64(interpolationHistory)/float64(shared.TickDuration)
+	for len(samples) > 2 && float64(samples[1].tick) < oldest {
+		samples = samples[1:]
+	}
+	ip.samples[id] = samples
+	return samples
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/faiface/pixel"
+	"github.com/mmogo/mmo/shared"
+)
+
+func TestInterpolatorPosition(t *testing.T) {
+	delay := shared.TickDuration * 2
+	epoch := time.Now()
+	walking := []sample{
+		{tick: 10, position: pixel.V(0, 0), walking: true},
+		{tick: 12, position: pixel.V(1, 0), walking: true},
+	}
+	for _, test := range []struct {
+		name    string
+		samples []sample
+		// render time, in server ticks
+		at     float64
+		expect pixel.Vec
+		ok     bool
+	}{
+		{
+			name: "nothing buffered",
+			at:   11,
+		},
+		{
+			name:    "before the first state",
+			samples: walking,
+			at:      5,
+			expect:  pixel.V(0, 0),
+			ok:      true,
+		},
+		{
+			name:    "between states",
+			samples: walking,
+			at:      11,
+			expect:  pixel.V(0.5, 0),
+			ok:      true,
+		},
+		{
+			name:    "on a state",
+			samples: walking,
+			at:      12,
+			expect:  pixel.V(1, 0),
+			ok:      true,
+		},
+		{
+			name:    "walking past the last state",
+			samples: walking,
+			at:      13,
+			expect:  pixel.V(1.5, 0),
+			ok:      true,
+		},
+		{
+			name:    "extrapolation is limited",
+			samples: walking,
+			at:      100,
+			expect:  pixel.V(1+0.5*float64(maxExtrapolation)/float64(shared.TickDuration), 0),
+			ok:      true,
+		},
+		{
+			name: "stopped",
+			samples: []sample{
+				{tick: 10, position: pixel.V(0, 0), walking: true},
+				{tick: 12, position: pixel.V(1, 0)},
+			},
+			at:     13,
+			expect: pixel.V(1, 0),
+			ok:     true,
+		},
+		{
+			name:    "single state",
+			samples: walking[:1],
+			at:      13,
+			expect:  pixel.V(0, 0),
+			ok:      true,
+		},
+	} {
+		ip := newInterpolator(delay)
+		ip.sync(0, epoch)
+		for _, s := range test.samples {
+			ip.record("npc", s.tick, s.position, s.walking)
+		}
+		now := epoch.Add(delay + time.Duration(test.at*float64(shared.TickDuration)))
+		position, ok := ip.position("npc", now)
+		if ok != test.ok {
+			t.Errorf("%s: expected ok %v, got %v", test.name, test.ok, ok)
+		} else if ok && !shared.WithinRange(position, test.expect, 1e-9) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expect, position)
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/pixelgl"
+	"github.com/faiface/pixel/text"
+	"github.com/ilackarms/pkg/errors"
+	"github.com/mmogo/mmo/shared"
+	"golang.org/x/image/colornames"
+	"golang.org/x/image/font/basicfont"
+)
+
+// screens shown before entering the game
+type screen int
+
+const (
+	screenLogin screen = iota
+	screenCharacters
+	screenCreate
+	screenConnecting
+)
+
+// tints offered for the body of new characters
+// the first one leaves the body tinted by character name
+var bodyTints = []string{"", "bisque", "burlywood", "peru", "sienna", "saddlebrown"}
+
+// character is a character created on this machine
+// players are identified by the name of their character
+type character struct {
+	Name       string
+	Appearance shared.Appearance
+}
+
+// characterStore remembers the characters of each account in a json file
+type characterStore struct {
+	path     string
+	Accounts map[string][]character
+}
+
+// loadCharacterStore reads the characters saved at path, if there are any
+func loadCharacterStore(path string) (*characterStore, error) {
+	store := &characterStore{path: path, Accounts: make(map[string][]character)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, errors.New("reading characters from "+path, err)
+	}
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, errors.New("parsing characters in "+path, err)
+	}
+	if store.Accounts == nil {
+		store.Accounts = make(map[string][]character)
+	}
+	return store, nil
+}
+
+func (s *characterStore) add(account string, char character) error {
+	s.Accounts[account] = append(s.Accounts[account], char)
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.New("encoding characters", err)
+	}
+	if err := ioutil.WriteFile(s.path, data, 0644); err != nil {
+		return errors.New("writing characters to "+s.path, err)
+	}
+	return nil
+}
+
+// connection is the outcome of joining the game
+type connection struct {
+	conn  net.Conn
+	world *shared.World
+	err   error
+}
+
+// lobby runs the login, character and connecting screens
+type lobby struct {
+	win      *pixelgl.Window
+	txt      *text.Text
+	data     *renderData
+	store    *characterStore
+	protocol string
+	screen   screen
+	// error shown on the current screen
+	err error
+
+	// login screen
+	account string
+	addr    string
+	// field typed into; 0 for account, 1 for server address
+	field int
+
+	// character screen; selecting one past the last character creates a new one
+	selected int
+
+	// creation screen
+	name string
+	// row being edited: name, body sheet, then body tint
+	row int
+	// index of the chosen option of each row but the name
+	options [2]int
+
+	// character drawn by preview
+	previewed string
+
+	// connecting screen
+	chosen     character
+	connecting chan connection
+}
+
+func newLobby(win *pixelgl.Window, protocol, addr string, store *characterStore) (*lobby, error) {
+	sheets, err := loadSpriteSheets()
+	if err != nil {
+		return nil, errors.New("failed to load sprite sheets", err)
+	}
+	animations := newAnimator()
+	for name, sheet := range sheets {
+		animations.addSheet(name, sheet)
+	}
+	return &lobby{
+		win:      win,
+		txt:      text.New(pixel.ZV, text.NewAtlas(basicfont.Face7x13, text.ASCII)),
+		data:     &renderData{animations: animations},
+		store:    store,
+		protocol: protocol,
+		addr:     addr,
+	}, nil
+}
+
+// run shows the screens until the player has joined the game
+// returns the ID the player joined as, the connection and the first world
+func (l *lobby) run() (string, net.Conn, *shared.World, error) {
+	for !l.win.Closed() {
+		l.win.Clear(colornames.Darkslategray)
+		var joined *connection
+		switch l.screen {
+		case screenLogin:
+			l.login()
+		case screenCharacters:
+			l.characters()
+		case screenCreate:
+			l.create()
+		case screenConnecting:
+			joined = l.waitForConnection()
+		}
+		if l.err != nil {
+			l.write(pixel.V(40, 40), colornames.Orangered, l.err.Error())
+		}
+		l.win.Update()
+		if joined != nil {
+			return l.chosen.Name, joined.conn, joined.world, nil
+		}
+	}
+	return "", nil, nil, errors.New("window closed before joining the game", nil)
+}
+
+// write draws lines starting at the top left of pos
+func (l *lobby) write(pos pixel.Vec, clr color.Color, lines ...string) {
+	l.txt.Clear()
+	l.txt.Dot = l.txt.Orig
+	for _, line := range lines {
+		l.txt.WriteString(line + "\n")
+	}
+	l.txt.DrawColorMask(l.win, pixel.IM.Scaled(pixel.ZV, 2).Moved(pos), clr)
+}
+
+// edit applies what was typed to s
+func (l *lobby) edit(s string) string {
+	s += l.win.Typed()
+	if l.win.JustPressed(pixelgl.KeyBackspace) && len(s) > 0 {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+func (l *lobby) top() pixel.Vec {
+	return pixel.V(40, l.win.Bounds().H()-60)
+}
+
+// cursor marks the selected line
+func cursor(selected bool) string {
+	if selected {
+		return "> "
+	}
+	return "  "
+}
+
+func (l *lobby) login() {
+	if l.win.JustPressed(pixelgl.KeyTab) || l.win.JustPressed(pixelgl.KeyUp) || l.win.JustPressed(pixelgl.KeyDown) {
+		l.field = 1 - l.field
+	}
+	if l.field == 0 {
+		l.account = strings.TrimSpace(l.edit(l.account))
+	} else {
+		l.addr = strings.TrimSpace(l.edit(l.addr))
+	}
+	if l.win.JustPressed(pixelgl.KeyEnter) {
+		switch {
+		case l.account == "":
+			l.err = errors.New("enter an account name", nil)
+		case l.addr == "":
+			l.err = errors.New("enter the address of a server", nil)
+		default:
+			l.err = nil
+			l.selected = 0
+			l.screen = screenCharacters
+		}
+	}
+	l.write(l.top(), colornames.White,
+		"LOGIN",
+		"",
+		cursor(l.field == 0)+"account: "+l.account,
+		cursor(l.field == 1)+"server:  "+l.addr,
+		"",
+		"tab to switch fields, enter to log in",
+	)
+}
+
+func (l *lobby) characters() {
+	chars := l.store.Accounts[l.account]
+	if l.win.JustPressed(pixelgl.KeyUp) && l.selected > 0 {
+		l.selected--
+	}
+	if l.win.JustPressed(pixelgl.KeyDown) && l.selected < len(chars) {
+		l.selected++
+	}
+	if l.win.JustPressed(pixelgl.KeyEscape) {
+		l.err = nil
+		l.screen = screenLogin
+		return
+	}
+	if l.win.JustPressed(pixelgl.KeyEnter) {
+		l.err = nil
+		if l.selected == len(chars) {
+			l.name = ""
+			l.row = 0
+			l.options = [2]int{}
+			l.screen = screenCreate
+			return
+		}
+		// characters that exist already keep the look saved by the server
+		l.join(chars[l.selected], nil)
+		return
+	}
+	lines := []string{"CHARACTERS OF " + strings.ToUpper(l.account), ""}
+	for i, char := range chars {
+		lines = append(lines, cursor(i == l.selected)+char.Name)
+	}
+	lines = append(lines, cursor(l.selected == len(chars))+"create a new character", "",
+		"enter to play, escape to log out")
+	l.write(l.top(), colornames.White, lines...)
+	if l.selected < len(chars) {
+		l.preview(chars[l.selected])
+	}
+}
+
+// layerOptions returns the choices of every row of the creation screen but the name
+func layerOptions() [2][]string {
+	return [2][]string{shared.BodySheets, bodyTints}
+}
+
+// created returns the character being created
+func (l *lobby) created() character {
+	options := layerOptions()
+	return character{
+		Name: l.name,
+		Appearance: shared.Appearance{Body: shared.Layer{
+			Sheet: options[0][l.options[0]],
+			Tint:  options[1][l.options[1]],
+		}},
+	}
+}
+
+func (l *lobby) create() {
+	options := layerOptions()
+	if l.win.JustPressed(pixelgl.KeyUp) {
+		l.row = (l.row + len(options)) % (len(options) + 1)
+	}
+	if l.win.JustPressed(pixelgl.KeyDown) || l.win.JustPressed(pixelgl.KeyTab) {
+		l.row = (l.row + 1) % (len(options) + 1)
+	}
+	if l.row == 0 {
+		l.name = strings.TrimSpace(l.edit(l.name))
+	} else {
+		n := len(options[l.row-1])
+		if l.win.JustPressed(pixelgl.KeyLeft) {
+			l.options[l.row-1] = (l.options[l.row-1] + n - 1) % n
+		}
+		if l.win.JustPressed(pixelgl.KeyRight) {
+			l.options[l.row-1] = (l.options[l.row-1] + 1) % n
+		}
+	}
+	if l.win.JustPressed(pixelgl.KeyEscape) {
+		l.err = nil
+		l.screen = screenCharacters
+		return
+	}
+	char := l.created()
+	if l.win.JustPressed(pixelgl.KeyEnter) {
+		l.err = l.validate(char)
+		if l.err == nil {
+			l.err = l.store.add(l.account, char)
+		}
+		if l.err == nil {
+			l.join(char, &char.Appearance)
+			return
+		}
+	}
+	names := [2]string{"body", "skin"}
+	lines := []string{"NEW CHARACTER", "", cursor(l.row == 0) + "name:  " + l.name}
+	for i, name := range names {
+		option := options[i][l.options[i]]
+		if option == "" {
+			option = "none"
+		}
+		lines = append(lines, fmt.Sprintf("%s%-6s < %s >", cursor(l.row == i+1), name+":", option))
+	}
+	lines = append(lines, "", "up and down to pick a row, left and right to change it",
+		"enter to create, escape to go back")
+	l.write(l.top(), colornames.White, lines...)
+	l.preview(char)
+}
+
+// validate checks a new character before it is saved
+func (l *lobby) validate(char character) error {
+	if char.Name == "" {
+		return errors.New("enter a name", nil)
+	}
+	for _, chars := range l.store.Accounts {
+		for _, existing := range chars {
+			if existing.Name == char.Name {
+				return errors.New("there already is a character called "+char.Name, nil)
+			}
+		}
+	}
+	return char.Appearance.Validate()
+}
+
+// preview draws char walking at the right of the window
+func (l *lobby) preview(char character) {
+	if char.Name != l.previewed {
+		l.data.animations.free(l.previewed)
+		l.previewed = char.Name
+	}
+	player := &shared.Player{
+		Entity:       shared.Entity{ID: char.Name, Facing: DOWN, Action: shared.A_WALK},
+		PlayerRecord: shared.PlayerRecord{Appearance: char.Appearance},
+	}
+	bounds := l.win.Bounds()
+	transform := pixel.IM.Scaled(pixel.ZV, 2).Moved(pixel.V(bounds.W()*3/4, bounds.H()/2))
+	drawPlayer(l.win, l.data, player, transform, 1.0/60)
+}
+
+// join starts connecting as char in the background
+// appearance is only sent for new characters
+func (l *lobby) join(char character, appearance *shared.Appearance) {
+	l.chosen = char
+	l.connecting = make(chan connection, 1)
+	go func(result chan connection) {
+		conn, world, err := connect(l.protocol, l.addr, char.Name, appearance)
+		result <- connection{conn: conn, world: world, err: err}
+	}(l.connecting)
+	l.screen = screenConnecting
+}
+
+// waitForConnection returns the connection once the game is joined
+func (l *lobby) waitForConnection() *connection {
+	if l.win.JustPressed(pixelgl.KeyEscape) {
+		// close the connection once it is made, since no one will use it
+		go func(result chan connection) {
+			if joined := <-result; joined.conn != nil {
+				joined.conn.Close()
+			}
+		}(l.connecting)
+		l.screen = screenCharacters
+		return nil
+	}
+	select {
+	case joined := <-l.connecting:
+		if joined.err == nil {
+			return &joined
+		}
+		l.err = joined.err
+		l.screen = screenCharacters
+		return nil
+	default:
+	}
+	l.write(l.top(), colornames.White,
+		fmt.Sprintf("connecting to %s as %s...", l.addr, l.chosen.Name),
+		"",
+		"escape to cancel",
+	)
+	return nil
+}
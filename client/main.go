@@ -12,6 +12,7 @@ import (
 	"os"
 	"os/signal"
 	"runtime/pprof"
+	"strings"
 
 	"github.com/faiface/pixel"
 	"github.com/faiface/pixel/pixelgl"
@@ -38,11 +39,17 @@ func init() {
 
 func main() {
 	addr := flag.String("addr", "localhost:8080", "address of server")
-	id := flag.String("id", "", "playerid to use")
+	id := flag.String("id", "", "playerid to use; skips the login screens")
 	protocol := flag.String("protocol", "udp", fmt.Sprintf("network protocol to use. available %s | %s", shared.ProtocolTCP, shared.ProtocolUDP))
+	configFile := flag.String("config", "client.json", "file the client settings and key bindings are kept in")
+	characters := flag.String("characters", "characters.json", "file the characters created on the character screen are kept in")
+	// the body is given as sheet or sheet:tint
+	// it is only used when joining with a new id
+	body := flag.String("body", "player", "sprite sheet of a new character's body")
 	flag.Parse()
-	if *id == "" {
-		log.Fatal("id must be provided")
+	appearance := shared.Appearance{Body: parseLayer(*body)}
+	if err := appearance.Validate(); err != nil {
+		log.Fatal(err)
 	}
 
 	f, err := os.Create("cpuprofile")
@@ -62,46 +69,90 @@ func main() {
 		}
 	}()
 	pixelgl.Run(func() {
-		if err := run(*protocol, *addr, *id); err != nil {
+		if err := run(*protocol, *addr, *id, appearance, *characters, *configFile); err != nil {
 			log.Fatal(err)
 		}
 	})
 }
 
-func run(protocol, addr, id string) error {
-	conn, err := dialServer(protocol, addr, id)
+// run joins the game as id, or lets the player log in and pick a character if id is empty
+func run(protocol, addr, id string, appearance shared.Appearance, characters, configFile string) error {
+	cfg, err := loadConfig(configFile)
 	if err != nil {
-		return errors.New("failed to dial server", err)
+		return err
 	}
 
 	// start window
-	cfg := pixelgl.WindowConfig{
+	win, err := pixelgl.NewWindow(pixelgl.WindowConfig{
 		Title:  "loading",
-		Bounds: pixel.R(0, 0, 800, 600),
-		VSync:  true,
-	}
-	win, err := pixelgl.NewWindow(cfg)
+		Bounds: pixel.R(0, 0, cfg.Width, cfg.Height),
+		VSync:  cfg.VSync,
+	})
 	if err != nil {
 		return fmt.Errorf("creating window: %v", err)
 	}
 
-	// sync with server
-	msg, err := shared.GetMessage(conn)
-	if err != nil {
-		return errors.New("failed reading message", err)
+	var conn net.Conn
+	var world *shared.World
+	if id != "" {
+		conn, world, err = connect(protocol, addr, id, &appearance)
+	} else {
+		var store *characterStore
+		store, err = loadCharacterStore(characters)
+		if err != nil {
+			return err
+		}
+		var l *lobby
+		l, err = newLobby(win, protocol, addr, store)
+		if err != nil {
+			return err
+		}
+		id, conn, world, err = l.run()
 	}
-
-	if msg.Update == nil || msg.Update.WorldState == nil || msg.Update.WorldState.World == nil {
-		return errors.New("expected Sync message on server handshake, got "+msg.String(), nil)
+	if err != nil {
+		return err
 	}
 
 	//start client
-	newClient(id, conn, win, msg.Update.WorldState.World).start()
+	newClient(id, conn, win, world, cfg).start()
 
 	return errors.New("client exited for unknown reason", nil)
 }
 
-func dialServer(protocol, addr, id string) (net.Conn, error) {
+// connect joins the game as player id and waits for the server to sync the world
+// appearance is only used if the player is new
+func connect(protocol, addr, id string, appearance *shared.Appearance) (net.Conn, *shared.World, error) {
+	conn, err := dialServer(protocol, addr, id, appearance)
+	if err != nil {
+		return nil, nil, errors.New("failed to dial server", err)
+	}
+
+	// sync with server
+	// the player joins the zone before the world is sent, so updates
+	// of the zone may come first. the world already contains them
+	for {
+		msg, err := shared.GetMessage(conn)
+		if err != nil {
+			conn.Close()
+			return nil, nil, errors.New("failed reading message", err)
+		}
+
+		if msg.Error != nil {
+			conn.Close()
+			return nil, nil, errors.New("server refused connection: "+msg.Error.Message, nil)
+		}
+
+		if msg.Update == nil {
+			conn.Close()
+			return nil, nil, errors.New("expected Sync message on server handshake, got "+msg.String(), nil)
+		}
+		if msg.Update.WorldState != nil && msg.Update.WorldState.World != nil {
+			return conn, msg.Update.WorldState.World, nil
+		}
+	}
+}
+
+func dialServer(protocol, addr, id string, appearance *shared.Appearance) (net.Conn, error) {
 	log.Printf("dialing %s", addr)
 	conn, err := shared.Dial(protocol, addr)
 	if err != nil {
@@ -120,7 +171,8 @@ func dialServer(protocol, addr, id string) (net.Conn, error) {
 	if err := shared.SendMessage(&shared.Message{
 		Request: &shared.Request{
 			ConnectRequest: &shared.ConnectRequest{
-				ID: id,
+				ID:         id,
+				Appearance: appearance,
 			},
 		}}, conn); err != nil {
 		return nil, err
@@ -128,6 +180,16 @@ func dialServer(protocol, addr, id string) (net.Conn, error) {
 	return conn, nil
 }
 
+// parseLayer reads a layer written as sheet or sheet:tint
+func parseLayer(s string) shared.Layer {
+	parts := strings.SplitN(s, ":", 2)
+	layer := shared.Layer{Sheet: parts[0]}
+	if len(parts) > 1 {
+		layer.Tint = parts[1]
+	}
+	return layer
+}
+
 func stringToColor(str string) color.Color {
 	colornum := 0
 	for _, s := range str {
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/faiface/pixel"
+	"github.com/mmogo/mmo/shared"
+)
+
+const (
+	// corrections smaller than this are left to the prediction
+	predictionTolerance = 0.05
+	// corrections larger than this are not smoothed; the player jumps
+	maxSmoothedCorrection = 2.0
+	// fraction of a correction still left to draw after a second
+	correctionDecay = 1.0 / 1024
+)
+
+// predictor keeps the moves of the player that the server has not
+// acknowledged yet, so they can be replayed on top of each position it sends
+type predictor struct {
+	lock    sync.Mutex
+	seq     uint64
+	pending []shared.Move
+	// last move acknowledged by the server
+	acked shared.Move
+	// how far from its position the player is drawn, left over from
+	// corrections. shrinks every frame so the player glides into place
+	offset pixel.Vec
+}
+
+func newPredictor() *predictor {
+	return &predictor{}
+}
+
+// nextSeq numbers a MoveRequest before it is sent
+func (p *predictor) nextSeq() uint64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.seq++
+	return p.seq
+}
+
+// predicted records a move once it has been applied to the client's world
+func (p *predictor) predicted(move shared.Move) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.pending = append(p.pending, move)
+}
+
+// ack drops the moves up to seq, which the server has applied
+func (p *predictor) ack(seq uint64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.ackLocked(seq)
+}
+
+func (p *predictor) ackLocked(seq uint64) {
+	for len(p.pending) > 0 && p.pending[0].Seq <= seq {
+		p.acked = p.pending[0]
+		p.pending = p.pending[1:]
+	}
+}
+
+// reset forgets all moves, e.g. after entering another zone,
+// whose world counts ticks differently
+func (p *predictor) reset() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.pending = nil
+	p.acked = shared.Move{}
+	p.offset = pixel.ZV
+}
+
+// reconcile returns where the player should be now, given that the server
+// had it at moved.Position on tick. the moves the server had not applied
+// yet are replayed from there. returns false if the position should be
+// ignored because it can not be matched up with the moves
+func (p *predictor) reconcile(world *shared.World, moved *shared.PlayerPosition, tick uint64) (pixel.Vec, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.ackLocked(moved.Ack)
+	if moved.Ack == 0 || moved.Ack != p.acked.Seq {
+		// the position does not follow a move the client knows of,
+		// so it is only trusted while none are pending
+		return moved.Position, len(p.pending) == 0
+	}
+	// the server walked tick-AckTick steps since applying the move,
+	// which is as many as the client walked since it predicted it
+	from := p.acked.Tick + tick - moved.AckTick
+	position, err := world.Replay(moved.ID, moved.Position, p.acked.Destination, from, p.pending)
+	if err != nil {
+		return pixel.ZV, false
+	}
+	return position, true
+}
+
+// correct moves where the player is drawn so that it stays put
+// while its position jumps from predicted to corrected
+func (p *predictor) correct(predicted, corrected pixel.Vec) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.offset = p.offset.Add(predicted.Sub(corrected))
+	if p.offset.Len() > maxSmoothedCorrection {
+		p.offset = pixel.ZV
+	}
+}
+
+// smooth shrinks the offset by the time passed since the last frame
+// and returns it
+func (p *predictor) smooth(dt time.Duration) pixel.Vec {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.offset = p.offset.Scaled(math.Pow(correctionDecay, dt.Seconds()))
+	return p.offset
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/faiface/pixel"
+	"github.com/mmogo/mmo/shared"
+)
+
+func TestPredictorReconcile(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	world := shared.NewEmptyWorld()
+	if err := world.ApplyUpdates(&shared.Update{AddPlayer: &shared.AddPlayer{ID: "player"}}); err != nil {
+		t.Fatal(err)
+	}
+	world.Tick = 10
+	self, _ := world.GetPlayer("player")
+	// how far the player walks in a tick
+	step := self.Speed * shared.TickDuration.Seconds()
+
+	for _, test := range []struct {
+		name string
+		// moves the client made, and the position the server sent at tick
+		predicted []shared.Move
+		moved     shared.PlayerPosition
+		tick      uint64
+		expect    pixel.Vec
+		ok        bool
+		// moves not acknowledged afterwards
+		pending int
+	}{
+		{
+			name:   "nothing pending",
+			moved:  shared.PlayerPosition{ID: "player", Position: pixel.V(1, 0)},
+			tick:   7,
+			expect: pixel.V(1, 0),
+			ok:     true,
+		},
+		{
+			name:      "position without ack while moves are pending",
+			predicted: []shared.Move{{Seq: 1, Tick: 2, Destination: pixel.V(10, 0)}},
+			moved:     shared.PlayerPosition{ID: "player", Position: pixel.V(1, 0)},
+			tick:      7,
+			pending:   1,
+		},
+		{
+			name:      "every move acknowledged",
+			predicted: []shared.Move{{Seq: 1, Tick: 2, Destination: pixel.V(10, 0)}},
+			moved:     shared.PlayerPosition{ID: "player", Position: pixel.V(1, 0), Ack: 1, AckTick: 5},
+			tick:      7,
+			// the server walked 2 ticks since the ack, the client 8; 6 are left
+			expect: pixel.V(1+6*step, 0),
+			ok:     true,
+		},
+		{
+			name: "pending moves are replayed",
+			predicted: []shared.Move{
+				{Seq: 1, Tick: 2, Destination: pixel.V(10, 0)},
+				{Seq: 2, Tick: 6, Destination: pixel.V(-10, 0)},
+			},
+			moved: shared.PlayerPosition{ID: "player", Position: pixel.V(1, 0), Ack: 1, AckTick: 5},
+			tick:  7,
+			// 2 more ticks to the right, then 4 back
+			expect:  pixel.V(1+2*step-4*step, 0),
+			ok:      true,
+			pending: 1,
+		},
+		{
+			name:      "ack of a move from before a reset",
+			predicted: []shared.Move{{Seq: 5, Tick: 2, Destination: pixel.V(10, 0)}},
+			moved:     shared.PlayerPosition{ID: "player", Position: pixel.V(1, 0), Ack: 3, AckTick: 5},
+			tick:      7,
+			pending:   1,
+		},
+	} {
+		p := newPredictor()
+		for _, move := range test.predicted {
+			p.predicted(move)
+		}
+		position, ok := p.reconcile(world, &test.moved, test.tick)
+		if ok != test.ok {
+			t.Errorf("%s: expected ok %v, got %v", test.name, test.ok, ok)
+		} else if ok && !shared.WithinRange(position, test.expect, 1e-9) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expect, position)
+		}
+		if len(p.pending) != test.pending {
+			t.Errorf("%s: expected %v moves pending, got %v", test.name, test.pending, len(p.pending))
+		}
+	}
+}
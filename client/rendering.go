@@ -1,10 +1,15 @@
 package main
 
 import (
+	"fmt"
 	"image/color"
 
 	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/imdraw"
+	"github.com/faiface/pixel/pixelgl"
+	"github.com/faiface/pixel/text"
 	"github.com/mmogo/mmo/shared"
+	"golang.org/x/image/colornames"
 )
 
 type drawable interface {
@@ -21,17 +26,24 @@ func LerpWorld(w1, w2 *shared.World, t float64) *shared.World {
 	lerpedWorld := w1.DeepCopy()
 	// it's ok to modify lerpedWorld here
 	// trust me
-	lerpedWorld.ForEach(func(p *shared.Player) {
-		if !p.Active {
+	lerpedWorld.ForEachEntity(func(e *shared.Entity) {
+		if !e.Active {
 			return
 		}
-		//lookup player in w2
-		p2, ok := w2.GetPlayer(p.ID)
+		//lookup entity in w2
+		e2, ok := w2.GetEntity(e.ID)
 		if !ok {
-			// player doesnt exist anymore in future; don't bother lerping it
+			// entity doesnt exist anymore in future; don't bother lerping it
 			return
 		}
-		*p = *LerpPlayer(p, p2, t)
+		*e = *LerpEntity(e, e2, t)
+	})
+	lerpedWorld.ForEachProjectile(func(p *shared.Projectile) {
+		p2, ok := w2.GetProjectile(p.ID)
+		if !ok {
+			return
+		}
+		p.Position = pixel.Lerp(p.Position, p2.Position, t)
 	})
 	return lerpedWorld
 }
@@ -40,9 +52,192 @@ func LerpWorld(w1, w2 *shared.World, t float64) *shared.World {
 // it ignores things that can't be interpolated (e.g. text)
 func LerpPlayer(p1, p2 *shared.Player, t float64) *shared.Player {
 	lerpedPlayer := p1 //.DeepCopy()
-	lerpedPlayer.Position = pixel.Lerp(p1.Position, p2.Position, t)
-	lerpedPlayer.Destination = pixel.Lerp(p1.Destination, p2.Destination, t)
-	lerpedPlayer.Size = pixel.Lerp(p1.Size, p2.Size, t)
-	lerpedPlayer.Speed = p1.Speed + (p2.Speed-p1.Speed)*t
+	lerpedPlayer.Entity = *LerpEntity(&p1.Entity, &p2.Entity, t)
 	return lerpedPlayer
 }
+
+// LerpEntity lineraly interpolates between two entities' math values
+func LerpEntity(e1, e2 *shared.Entity, t float64) *shared.Entity {
+	lerpedEntity := e1.DeepCopy()
+	lerpedEntity.Position = pixel.Lerp(e1.Position, e2.Position, t)
+	lerpedEntity.Destination = pixel.Lerp(e1.Destination, e2.Destination, t)
+	lerpedEntity.Size = pixel.Lerp(e1.Size, e2.Size, t)
+	lerpedEntity.Speed = e1.Speed + (e2.Speed-e1.Speed)*t
+	// what the entity does can not be interpolated; show the latest
+	lerpedEntity.Action = e2.Action
+	lerpedEntity.Facing = e2.Facing
+	return lerpedEntity
+}
+
+// drawEntity draws any entity that is not a player
+func drawEntity(win *pixelgl.Window, data *renderData, entity *shared.Entity, dt float64) {
+	mappedPos := map2Screen(entity.Position)
+	transform := pixel.IM.Moved(mappedPos)
+	switch entity.Kind {
+	case shared.E_NPC:
+		if sprite := data.animations.animate("player", entity, dt); sprite != nil {
+			sprite.DrawColorMask(win, transform, stringToColor(entity.ID))
+		}
+		drawHealthBar(win, entity)
+	case shared.E_LOOT:
+		data.drawables["loot"].Draw(win, transform)
+	case shared.E_OBJECT:
+		imd := imdraw.New(nil)
+		imd.Color = stringToColor(entity.ID)
+		hitbox := entity.Hitbox()
+		imd.Push(map2Screen(hitbox.Min), map2Screen(hitbox.Max))
+		imd.Rectangle(0)
+		imd.Draw(win)
+	}
+}
+
+// drawHealthBar draws the health of entity above its head
+// nothing is drawn for entities at full health or without health
+func drawHealthBar(win *pixelgl.Window, entity *shared.Entity) {
+	if entity.MaxHealth == 0 || entity.Health == entity.MaxHealth || !entity.Alive() {
+		return
+	}
+	const width, height = 40.0, 5.0
+	mappedPos := map2Screen(entity.Position)
+	bar := pixel.R(mappedPos.X-width/2, mappedPos.Y+36, mappedPos.X+width/2, mappedPos.Y+36+height)
+	imd := imdraw.New(nil)
+	imd.Color = colornames.Darkred
+	imd.Push(bar.Min, bar.Max)
+	imd.Rectangle(0)
+	imd.Color = colornames.Limegreen
+	imd.Push(bar.Min, pixel.V(bar.Min.X+width*float64(entity.Health)/float64(entity.MaxHealth), bar.Max.Y))
+	imd.Rectangle(0)
+	imd.Draw(win)
+}
+
+// drawPlayer draws player with the body of its appearance
+// a body without a tint is tinted by player ID
+func drawPlayer(win *pixelgl.Window, data *renderData, player *shared.Player, transform pixel.Matrix, dt float64) {
+	body := player.Appearance.Body
+	sprite := data.animations.animate(body.Sheet, &player.Entity, dt)
+	if sprite == nil {
+		return
+	}
+	tint := stringToColor(player.ID)
+	if clr, ok := colornames.Map[body.Tint]; ok {
+		tint = clr
+	}
+	sprite.DrawColorMask(win, transform, tint)
+}
+
+// clampCamera keeps the camera from showing anything outside area
+// along axes where area is smaller than the window, area is centered instead
+func clampCamera(camPosition pixel.Vec, window, area pixel.Rect) pixel.Vec {
+	min, max := map2Screen(area.Min), map2Screen(area.Max)
+	clamp := func(pos, size, min, max float64) float64 {
+		if max-min < size {
+			return size/2 - (min+max)/2
+		}
+		return shared.Clamp(pos, size-max, -min)
+	}
+	return pixel.V(
+		clamp(camPosition.X, window.W(), min.X, max.X),
+		clamp(camPosition.Y, window.H(), min.Y, max.Y),
+	)
+}
+
+// drawLevel shows the level of player above its health bar
+func drawLevel(win *pixelgl.Window, txt *text.Text, player *shared.Player) {
+	line := fmt.Sprintf("lvl %v", player.Level)
+	txt.Clear()
+	txt.Dot = txt.Orig
+	txt.Dot.X -= txt.BoundsOf(line).W() / 2
+	txt.WriteString(line)
+	txt.DrawColorMask(win, pixel.IM.Moved(map2Screen(player.Position).Add(pixel.V(0, 44))), colornames.White)
+}
+
+// drawProjectile draws arrows as lines and spells as glowing balls
+func drawProjectile(win *pixelgl.Window, projectile *shared.Projectile) {
+	imd := imdraw.New(nil)
+	mappedPos := map2Screen(projectile.Position)
+	switch projectile.Action {
+	case shared.A_SHOOT:
+		imd.Color = colornames.Saddlebrown
+		imd.Push(mappedPos.Sub(map2Screen(projectile.Direction.Scaled(0.5))), mappedPos)
+		imd.Line(3)
+	default:
+		imd.Color = colornames.Orangered
+		imd.Push(mappedPos)
+		imd.Circle(10, 0)
+		imd.Color = colornames.Yellow
+		imd.Push(mappedPos)
+		imd.Circle(5, 0)
+	}
+	imd.Draw(win)
+}
+
+// drawInventory lists the items the player carries and wears in the bottom left corner of the screen
+func drawInventory(win *pixelgl.Window, txt *text.Text, player *shared.Player, keys Bindings) {
+	txt.Clear()
+	txt.Dot = txt.Orig
+	txt.WriteString(fmt.Sprintf("level %v (%v xp)\n", player.Level, player.XP))
+	txt.WriteString(player.Stats().String() + "\n")
+	for _, slot := range shared.EquipSlots {
+		worn := "-"
+		if item, ok := player.Equipment[slot]; ok {
+			worn = shared.Items[item].Name
+		}
+		key := ""
+		for control, unequipped := range unequipControls {
+			if unequipped == slot {
+				key = keys.Name(control)
+			}
+		}
+		txt.WriteString(fmt.Sprintf("%s (%s): %s\n", slot, key, worn))
+	}
+	inventory := player.Inventory
+	txt.WriteString(fmt.Sprintf("inventory (slot key use or equip, %s+slot key drop, %s pick up)\n",
+		keys.Name(C_DROP_STACK), keys.Name(C_PICKUP)))
+	for i, stack := range inventory {
+		slot := fmt.Sprint(i + 1)
+		if i < len(slotControls) {
+			slot = keys.Name(slotControls[i])
+		}
+		txt.WriteString(fmt.Sprintf("%s: %s\n", slot, stack))
+	}
+	if len(inventory) == 0 {
+		txt.WriteString("empty\n")
+	}
+	// text is drawn in screen space, on top of the world
+	origin := cam.Unproject(pixel.V(10, 10+txt.Bounds().H()*1.5))
+	txt.DrawColorMask(win, pixel.IM.Scaled(pixel.ZV, 1.5).Moved(origin), colornames.White)
+}
+
+// drawTrade shows the trade the player is part of in the top left corner of the screen
+func drawTrade(win *pixelgl.Window, txt *text.Text, player *shared.Player, trade *shared.Trade, keys Bindings) {
+	partner := trade.Partner(player.ID)
+	txt.Clear()
+	txt.Dot = txt.Orig
+	switch {
+	case !trade.Accepted && trade.To == player.ID:
+		txt.WriteString(fmt.Sprintf("%s wants to trade (%s accept, %s decline)\n",
+			partner, keys.Name(C_TRADE), keys.Name(C_TRADE_CANCEL)))
+	case !trade.Accepted:
+		txt.WriteString(fmt.Sprintf("waiting for %s to trade (%s cancel)\n", partner, keys.Name(C_TRADE_CANCEL)))
+	default:
+		txt.WriteString(fmt.Sprintf("trading with %s (slot key offer, %s confirm, %s cancel)\n",
+			partner, keys.Name(C_TRADE_CONFIRM), keys.Name(C_TRADE_CANCEL)))
+		for _, id := range []string{player.ID, partner} {
+			side := trade.Side(id)
+			confirmed := ""
+			if side.Confirmed {
+				confirmed = " (confirmed)"
+			}
+			txt.WriteString(fmt.Sprintf("%s gives%s:\n", id, confirmed))
+			for _, stack := range side.Offer {
+				txt.WriteString(fmt.Sprintf("  %s\n", stack))
+			}
+			if len(side.Offer) == 0 {
+				txt.WriteString("  nothing\n")
+			}
+		}
+	}
+	// text is drawn in screen space, on top of the world
+	origin := cam.Unproject(pixel.V(10, win.Bounds().H()-30))
+	txt.DrawColorMask(win, pixel.IM.Scaled(pixel.ZV, 1.5).Moved(origin), colornames.White)
+}
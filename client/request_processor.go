@@ -14,14 +14,16 @@ type requestProcessor struct {
 	playerID          string
 	pendingRequests   <-chan *shared.Request
 	updatePredictions chan *shared.Update
+	predictor         *predictor
 	conn              net.Conn
 }
 
-func newRequestManager(playerID string, pendingRequests <-chan *shared.Request, updatePredictions chan *shared.Update, conn net.Conn) *requestProcessor {
+func newRequestManager(playerID string, pendingRequests <-chan *shared.Request, updatePredictions chan *shared.Update, predictor *predictor, conn net.Conn) *requestProcessor {
 	return &requestProcessor{
 		playerID:          playerID,
 		pendingRequests:   pendingRequests,
 		updatePredictions: updatePredictions,
+		predictor:         predictor,
 		conn:              conn,
 	}
 }
@@ -38,6 +40,9 @@ func (reqProcessor *requestProcessor) processPending(errc chan error) {
 }
 
 func (reqProcessor *requestProcessor) handleRequest(req *shared.Request) error {
+	if req.MoveRequest != nil {
+		req.MoveRequest.Seq = reqProcessor.predictor.nextSeq()
+	}
 	if err := shared.SendMessage(&shared.Message{Request: req}, reqProcessor.conn); err != nil {
 		return errors.New("failed to send request", err)
 	}
@@ -47,6 +52,12 @@ func (reqProcessor *requestProcessor) handleRequest(req *shared.Request) error {
 		log.Printf("update prediction: %v", req.MoveRequest.Destination)
 	case req.SpeakRequest != nil:
 		reqProcessor.updatePredictions <- shared.ToUpdate(reqProcessor.playerID, req.SpeakRequest)
+	case req.AttackRequest != nil, req.RespawnRequest != nil,
+		req.PickupRequest != nil, req.DropRequest != nil, req.UseRequest != nil,
+		req.EquipRequest != nil, req.UnequipRequest != nil,
+		req.TradeRequest != nil, req.TradeAcceptRequest != nil, req.TradeOfferRequest != nil,
+		req.TradeConfirmRequest != nil, req.TradeCancelRequest != nil:
+		// resolved by the server; nothing to predict
 	default:
 		return fmt.Errorf("unknown request type: %#v", req)
 	}
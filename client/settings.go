@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/pixelgl"
+	"github.com/faiface/pixel/text"
+	"golang.org/x/image/colornames"
+)
+
+// settingsScreen lets the player rebind controls in game
+// every change is written back to the config file right away
+type settingsScreen struct {
+	cfg  *config
+	win  *pixelgl.Window
+	open bool
+	// row of the control being changed; the last row toggles vsync
+	selected int
+	// waiting for the button to bind the selected control to
+	rebinding bool
+	// error of the last save, shown until the next one
+	err error
+}
+
+func newSettingsScreen(win *pixelgl.Window, cfg *config) *settingsScreen {
+	return &settingsScreen{cfg: cfg, win: win}
+}
+
+// handle processes the input of the settings screen
+// returns whether it is open, in which case the game gets no input
+func (s *settingsScreen) handle() bool {
+	keys := s.cfg.Keys
+	if !s.open {
+		if s.win.JustPressed(keys[C_SETTINGS]) {
+			s.open = true
+			s.selected = 0
+		}
+		return s.open
+	}
+	if s.rebinding {
+		if s.win.JustPressed(pixelgl.KeyEscape) {
+			s.rebinding = false
+			return true
+		}
+		if button, ok := s.justPressed(); ok {
+			keys[Controls[s.selected]] = button
+			s.rebinding = false
+			s.err = s.cfg.save()
+		}
+		return true
+	}
+	switch {
+	case s.win.JustPressed(pixelgl.KeyEscape) || s.win.JustPressed(keys[C_SETTINGS]):
+		s.open = false
+	case s.win.JustPressed(pixelgl.KeyUp):
+		s.selected = (s.selected + len(Controls)) % (len(Controls) + 1)
+	case s.win.JustPressed(pixelgl.KeyDown):
+		s.selected = (s.selected + 1) % (len(Controls) + 1)
+	case s.win.JustPressed(pixelgl.KeyEnter) && s.selected == len(Controls):
+		s.cfg.VSync = !s.cfg.VSync
+		s.win.SetVSync(s.cfg.VSync)
+		s.err = s.cfg.save()
+	case s.win.JustPressed(pixelgl.KeyEnter):
+		s.rebinding = true
+	}
+	return true
+}
+
+// justPressed returns any button that was just pressed
+func (s *settingsScreen) justPressed() (pixelgl.Button, bool) {
+	for button := pixelgl.Button(0); button <= pixelgl.KeyLast; button++ {
+		if s.win.JustPressed(button) {
+			return button, true
+		}
+	}
+	return 0, false
+}
+
+// draw shows the controls around the selected one
+func (s *settingsScreen) draw(txt *text.Text) {
+	const shown = 12
+	txt.Clear()
+	txt.Dot = txt.Orig
+	txt.WriteString("settings (up/down select, enter change, escape close)\n")
+	first := s.selected - shown/2
+	if first > len(Controls)+1-shown {
+		first = len(Controls) + 1 - shown
+	}
+	if first < 0 {
+		first = 0
+	}
+	for i := first; i < first+shown && i <= len(Controls); i++ {
+		line := ""
+		switch {
+		case i == len(Controls):
+			line = fmt.Sprintf("vsync: %v", s.cfg.VSync)
+		case i == s.selected && s.rebinding:
+			line = fmt.Sprintf("%s: press a button (escape cancels)", Controls[i])
+		default:
+			line = fmt.Sprintf("%s: %s", Controls[i], s.cfg.Keys.Name(Controls[i]))
+		}
+		txt.WriteString(cursor(i == s.selected) + line + "\n")
+	}
+	if s.err != nil {
+		txt.WriteString(s.err.Error() + "\n")
+	}
+	// text is drawn in screen space, on top of the world
+	origin := cam.Unproject(pixel.V(10, s.win.Bounds().H()-20))
+	txt.DrawColorMask(s.win, pixel.IM.Scaled(pixel.ZV, 1.5).Moved(origin), colornames.White)
+}
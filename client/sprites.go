@@ -11,18 +11,12 @@ import (
 	"github.com/mmogo/mmo/shared"
 )
 
-func init() {
-	AtlasL = atlasL()
-}
-
 // Atlas map
 type Atlas map[shared.Direction]map[shared.Action][]pixel.Rect
 
-// AtlasL for spritesheets generated with Gaurav0's character generator
-// https://github.com/Gaurav0/Universal-LPC-Spritesheet-Character-Generator
-var AtlasL Atlas
-
 // Sprite is an animated sprite
+// the state of the animation belongs to one sprite; entities drawn with
+// the same sprite sheet each get their own Instance
 type Sprite struct {
 	Picture pixel.Picture
 	Frames  map[shared.Direction]map[shared.Action][]pixel.Rect
@@ -30,20 +24,41 @@ type Sprite struct {
 	Frame   int     // current frame
 	Speed   float64 // frames per second
 	elapsed float64
+	// action being animated
+	action shared.Action
+}
+
+// Instance returns a new sprite with the same picture and frames as s,
+// starting its animation from the beginning
+func (s *Sprite) Instance() *Sprite {
+	return &Sprite{
+		Picture: s.Picture,
+		Frames:  s.Frames,
+		Sprite:  pixel.NewSprite(nil, pixel.Rect{}),
+		Speed:   s.Speed,
+	}
 }
 
 func (s *Sprite) Animate(dt float64, facing shared.Direction, action shared.Action) {
+	// a new action starts from its first frame
+	if action != s.action {
+		s.action = action
+		s.elapsed = 0
+	}
 	s.elapsed += dt
 	if s.Speed == 0 {
 		s.Speed = 0.1
 	}
 	s.Frame = 0 // default frame
-	if facing == shared.DIR_NONE {
+	// not every action has frames for every direction
+	if facing == shared.DIR_NONE || len(s.Frames[facing][action]) == 0 {
 		facing = DOWN
 	}
-	if len(s.Frames[facing][action]) > 0 {
-		s.Frame = int(s.elapsed/s.Speed) % len(s.Frames[facing][action])
+	// sheets without the action keep showing the last frame
+	if len(s.Frames[facing][action]) == 0 {
+		return
 	}
+	s.Frame = int(s.elapsed/s.Speed) % len(s.Frames[facing][action])
 	s.Sprite.Set(s.Picture, s.Frames[facing][action][s.Frame])
 
 }
@@ -58,118 +73,14 @@ func (s *Sprite) DrawColorMask(target pixel.Target, matrix pixel.Matrix, color c
 	s.Sprite.DrawColorMask(target, matrix, color)
 }
 
-func atlasL() Atlas {
-	m := map[shared.Direction]map[shared.Action][]pixel.Rect{}
-	for _, dir := range []shared.Direction{UP, DOWN, LEFT, RIGHT, UPLEFT, UPRIGHT, DOWNLEFT, DOWNRIGHT} {
-		m[dir] = make(map[shared.Action][]pixel.Rect)
-	}
-
-	bounds := pixel.R(0, 0, 832, 1344)
-	frameshigh := 21.00
-	frameswide := 13.00
-	frameHeight := bounds.Max.Y / frameshigh
-	frameWidth := bounds.Max.X / frameswide
-	singleframe := pixel.R(0, 0, frameWidth, frameHeight)
-	allframes := []pixel.Rect{}
-	for y := bounds.Max.Y - frameHeight; y >= 0.00; y = y - frameHeight {
-		for x := 0.00; x < bounds.Max.X; x = x + frameWidth {
-			frame := singleframe.Moved(pixel.V(x, y))
-			allframes = append(allframes, frame)
-		}
-	}
-	// idle
-	m[UP][shared.A_IDLE] = []pixel.Rect{allframes[0], allframes[0]}
-	m[DOWN][shared.A_IDLE] = []pixel.Rect{allframes[26], allframes[26]}
-	m[LEFT][shared.A_IDLE] = []pixel.Rect{allframes[13], allframes[13]}
-	m[UPLEFT][shared.A_IDLE] = []pixel.Rect{allframes[13], allframes[13]}
-	m[DOWNLEFT][shared.A_IDLE] = []pixel.Rect{allframes[13], allframes[13]}
-	m[RIGHT][shared.A_IDLE] = []pixel.Rect{allframes[39], allframes[39]}
-	m[UPRIGHT][shared.A_IDLE] = []pixel.Rect{allframes[39], allframes[39]}
-	m[DOWNRIGHT][shared.A_IDLE] = []pixel.Rect{allframes[39], allframes[39]}
-
-	// spell casting
-	m[UP][shared.A_SPELL] = allframes[0:8]
-	m[LEFT][shared.A_SPELL] = allframes[13:21]
-	m[UPLEFT][shared.A_SPELL] = allframes[13:21]
-	m[DOWNLEFT][shared.A_SPELL] = allframes[13:21]
-	m[DOWN][shared.A_SPELL] = allframes[26:33]
-	m[RIGHT][shared.A_SPELL] = allframes[39:45]
-	m[UPRIGHT][shared.A_SPELL] = allframes[39:45]
-	m[DOWNRIGHT][shared.A_SPELL] = allframes[39:45]
-
-	// thrust
-	m[UP][shared.A_THRUST] = allframes[52:60]
-	m[LEFT][shared.A_THRUST] = allframes[65:73]
-	m[UPLEFT][shared.A_THRUST] = allframes[65:73]
-	m[DOWNLEFT][shared.A_THRUST] = allframes[65:73]
-	m[DOWN][shared.A_THRUST] = allframes[78:86]
-	m[RIGHT][shared.A_THRUST] = allframes[91:99]
-	m[UPRIGHT][shared.A_THRUST] = allframes[91:99]
-	m[DOWNRIGHT][shared.A_THRUST] = allframes[91:99]
-
-	// walk
-	m[UP][shared.A_WALK] = allframes[104:113]
-	m[LEFT][shared.A_WALK] = allframes[117:126]
-	m[UPLEFT][shared.A_WALK] = allframes[117:126]
-	m[DOWNLEFT][shared.A_WALK] = allframes[117:126]
-	m[DOWN][shared.A_WALK] = allframes[130:139]
-	m[RIGHT][shared.A_WALK] = allframes[143:152]
-	m[UPRIGHT][shared.A_WALK] = allframes[143:152]
-	m[DOWNRIGHT][shared.A_WALK] = allframes[143:152]
-
-	//slash
-
-	m[UP][shared.A_SLASH] = allframes[156:162]
-	m[LEFT][shared.A_SLASH] = allframes[169:175]
-	m[UPLEFT][shared.A_SLASH] = allframes[169:175]
-	m[DOWNLEFT][shared.A_SLASH] = allframes[169:175]
-	m[DOWN][shared.A_SLASH] = allframes[182:188]
-	m[RIGHT][shared.A_SLASH] = allframes[195:201]
-	m[UPRIGHT][shared.A_SLASH] = allframes[195:201]
-	m[DOWNRIGHT][shared.A_SLASH] = allframes[195:201]
-
-	//shoot
-	m[UP][shared.A_SHOOT] = allframes[208:221]
-	m[LEFT][shared.A_SHOOT] = allframes[221:234]
-	m[UPLEFT][shared.A_SHOOT] = allframes[221:234]
-	m[DOWNLEFT][shared.A_SHOOT] = allframes[221:234]
-	m[DOWN][shared.A_SHOOT] = allframes[234:247]
-	m[RIGHT][shared.A_SHOOT] = allframes[247:260]
-	m[UPRIGHT][shared.A_SHOOT] = allframes[247:260]
-	m[DOWNRIGHT][shared.A_SHOOT] = allframes[247:260]
-
-	//hurt
-	m[UP][shared.A_HURT] = allframes[260:265]
-	m[LEFT][shared.A_HURT] = allframes[260:265]
-	m[UPLEFT][shared.A_HURT] = allframes[260:265]
-	m[DOWNLEFT][shared.A_HURT] = allframes[260:265]
-	m[DOWN][shared.A_HURT] = allframes[260:265]
-	m[RIGHT][shared.A_HURT] = allframes[260:265]
-
-	//dead
-	m[UP][shared.A_DEAD] = allframes[265:]
-	m[LEFT][shared.A_DEAD] = allframes[265:]
-	m[UPLEFT][shared.A_DEAD] = allframes[265:]
-	m[DOWNLEFT][shared.A_DEAD] = allframes[265:]
-	m[DOWN][shared.A_DEAD] = allframes[265:]
-	m[RIGHT][shared.A_DEAD] = allframes[265:]
-	m[UPRIGHT][shared.A_DEAD] = allframes[265:]
-	m[DOWNRIGHT][shared.A_DEAD] = allframes[265:]
-	return m
-}
-
-// loadSpriteSheet returns an animated sprite derived from image path and atlas function
+// loadSpriteSheet returns an animated sprite cut from image path by atlas
 func loadSpriteSheet(path string, atlas Atlas) (*Sprite, error) {
 	image, err := loadImage(path)
 	if err != nil {
 		return nil, errors.New("loading image", err)
 	}
-	frames := atlas
-	if frames == nil {
-		frames = AtlasL
-	}
 	s := &Sprite{
-		Frames:  frames,
+		Frames:  atlas,
 		Sprite:  pixel.NewSprite(nil, pixel.Rect{}),
 		Picture: image,
 	}
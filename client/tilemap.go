@@ -0,0 +1,51 @@
+package main
+
+import (
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/imdraw"
+	"github.com/ilackarms/pkg/errors"
+	"github.com/mmogo/mmo/shared"
+)
+
+// tileMapBatches draws the terrain of m into batches, one per tile sprite
+// plus one for tiles without a sprite, which are drawn in solid color
+func tileMapBatches(m *shared.TileMap, tileSize float64) ([]*pixel.Batch, error) {
+	spriteBatches := make(map[string]*pixel.Batch)
+	sprites := make(map[string]*pixel.Sprite)
+	for _, tileType := range m.Types {
+		if tileType.Sprite == "" {
+			continue
+		}
+		if _, ok := sprites[tileType.Sprite]; ok {
+			continue
+		}
+		pic, err := loadImage(tileType.Sprite)
+		if err != nil {
+			return nil, errors.New("failed to load tile sprite", err)
+		}
+		sprites[tileType.Sprite] = pixel.NewSprite(pic, pic.Bounds())
+		spriteBatches[tileType.Sprite] = pixel.NewBatch(&pixel.TrianglesData{}, pic)
+	}
+
+	colorBatch := pixel.NewBatch(&pixel.TrianglesData{}, nil)
+	imd := imdraw.New(nil)
+	m.ForEach(func(pos pixel.Vec, tileType *shared.TileType) {
+		if tileType.Sprite == "" {
+			imd.Color = stringToColor(tileType.Name)
+			imd.Push(pos.Scaled(tileSize), pos.Add(pixel.V(1, 1)).Scaled(tileSize))
+			imd.Rectangle(0)
+			return
+		}
+		sprite := sprites[tileType.Sprite]
+		scale := tileSize / sprite.Frame().W()
+		center := pos.Add(pixel.V(0.5, 0.5)).Scaled(tileSize)
+		sprite.Draw(spriteBatches[tileType.Sprite], pixel.IM.Scaled(pixel.ZV, scale).Moved(center))
+	})
+	imd.Draw(colorBatch)
+
+	batches := []*pixel.Batch{colorBatch}
+	for _, batch := range spriteBatches {
+		batches = append(batches, batch)
+	}
+	return batches, nil
+}
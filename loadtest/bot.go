@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/faiface/pixel"
+	"github.com/mmogo/mmo/sdk"
+	"github.com/mmogo/mmo/shared"
+)
+
+var phrases = []string{
+	"hello",
+	"anyone want to trade?",
+	"where are the slimes",
+	"lag?",
+	"brb",
+	"nice sword",
+}
+
+// behavior is what every bot does, and how often
+type behavior struct {
+	// walk to a random spot within walkRadius every walkInterval
+	walkInterval time.Duration
+	walkRadius   float64
+	// say something every chatInterval; never if it is 0
+	chatInterval time.Duration
+	pingInterval time.Duration
+}
+
+// bot is one simulated player
+type bot struct {
+	id       string
+	client   *sdk.Client
+	behavior behavior
+	stats    *stats
+	rng      *rand.Rand
+	// when each move that has not been acknowledged yet was sent
+	sentLock sync.Mutex
+	sent     map[uint64]time.Time
+}
+
+// runBot joins the game as id and plays until stop is closed
+// or the server drops it
+func runBot(protocol, addr, id string, b behavior, s *stats, stop <-chan struct{}) {
+	start := time.Now()
+	client, err := sdk.Dial(protocol, addr, id, nil)
+	s.connect(id, time.Since(start), err)
+	if err != nil {
+		botLog.Printf("%s failed to connect: %v", id, err)
+		return
+	}
+	joined := time.Now()
+	defer func() {
+		read, written := client.Traffic()
+		s.traffic(read, written, time.Since(joined))
+		client.Close()
+	}()
+	bt := &bot{
+		id:       id,
+		client:   client,
+		behavior: b,
+		stats:    s,
+		rng:      rand.New(rand.NewSource(start.UnixNano())),
+		sent:     make(map[uint64]time.Time),
+	}
+	client.OnAck(bt.acked)
+	bt.play(stop)
+}
+
+func (b *bot) play(stop <-chan struct{}) {
+	// bots start at random points of their intervals,
+	// so that they do not all act on the same tick
+	walk := time.After(b.jitter(b.behavior.walkInterval))
+	ping := time.After(b.jitter(b.behavior.pingInterval))
+	var chat <-chan time.Time
+	if b.behavior.chatInterval > 0 {
+		chat = time.After(b.jitter(b.behavior.chatInterval))
+	}
+	for {
+		var err error
+		select {
+		case <-stop:
+			return
+		case <-b.client.Done():
+			if err := b.client.Err(); err != nil {
+				botLog.Printf("%s was disconnected: %v", b.id, err)
+				b.stats.disconnect(b.id, err)
+			}
+			return
+		case <-walk:
+			walk = time.After(b.behavior.walkInterval)
+			err = b.walk()
+		case <-chat:
+			chat = time.After(b.behavior.chatInterval)
+			err = b.client.Speak(phrases[b.rng.Intn(len(phrases))])
+		case <-ping:
+			ping = time.After(b.behavior.pingInterval)
+			var rtt time.Duration
+			if rtt, err = b.client.Ping(); err == nil {
+				b.stats.pinged(rtt)
+			}
+		}
+		if err != nil {
+			botLog.Printf("%s: %v", b.id, err)
+		}
+	}
+}
+
+// jitter returns a random duration up to d
+func (b *bot) jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(b.rng.Int63n(int64(d)))
+}
+
+// walk moves to a random spot near the player, or respawns it if it is dead
+func (b *bot) walk() error {
+	self, ok := b.client.Self()
+	if !ok {
+		return fmt.Errorf("player %s is not in its world", b.id)
+	}
+	if !self.Alive() {
+		return b.client.Respawn()
+	}
+	angle := b.rng.Float64() * 2 * math.Pi
+	distance := b.rng.Float64() * b.behavior.walkRadius
+	destination := self.Position.Add(pixel.V(math.Cos(angle), math.Sin(angle)).Scaled(distance))
+	req := &shared.Request{MoveRequest: &shared.MoveRequest{Destination: destination}}
+	// the ack can only be matched up once the move is recorded
+	b.sentLock.Lock()
+	defer b.sentLock.Unlock()
+	sent := time.Now()
+	if err := b.client.Send(req); err != nil {
+		return err
+	}
+	b.sent[req.MoveRequest.Seq] = sent
+	return nil
+}
+
+// acked measures how long the server took to apply move seq
+func (b *bot) acked(seq uint64) {
+	b.sentLock.Lock()
+	defer b.sentLock.Unlock()
+	if sent, ok := b.sent[seq]; ok {
+		b.stats.moved(time.Since(sent))
+	}
+	// moves are applied in order; older ones were refused
+	for s := range b.sent {
+		if s <= seq {
+			delete(b.sent, s)
+		}
+	}
+}
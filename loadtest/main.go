@@ -0,0 +1,99 @@
+// loadtest connects many simulated players to a server
+// and reports how well it keeps up with them
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/mmogo/mmo/shared"
+)
+
+const stopTimeout = time.Second * 5
+
+// botLog is where bots report their errors. it is kept apart from
+// the standard logger, which is silenced unless -v is given
+var botLog = log.New(os.Stderr, "", log.Lmicroseconds)
+
+func init() {
+	log.SetFlags(log.Lmicroseconds | log.Lshortfile)
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "address of server")
+	protocol := flag.String("protocol", "udp", fmt.Sprintf("network protocol to use. available %s | %s", shared.ProtocolTCP, shared.ProtocolUDP))
+	players := flag.Int("players", 10, "number of simulated players")
+	prefix := flag.String("prefix", "bot", "players are named prefix-1, prefix-2, ...")
+	ramp := flag.Duration("ramp", time.Millisecond*100, "time between players joining")
+	duration := flag.Duration("duration", time.Minute, "how long players stay once all of them have joined")
+	walk := flag.Duration("walk", time.Second*2, "how often each player walks somewhere else")
+	radius := flag.Float64("radius", 5, "how far players walk at most")
+	chat := flag.Duration("chat", time.Second*10, "how often each player says something; 0 to never")
+	ping := flag.Duration("ping", time.Second*5, "how often each player measures its round trip time")
+	verbose := flag.Bool("v", false, "log every update the players apply")
+	flag.Parse()
+	if *walk <= 0 || *ping <= 0 {
+		log.Fatal("walk and ping intervals must be positive")
+	}
+	if !*verbose {
+		// the world logs everything it applies, which is far too much for many players
+		log.SetOutput(ioutil.Discard)
+	}
+
+	b := behavior{
+		walkInterval: *walk,
+		walkRadius:   *radius,
+		chatInterval: *chat,
+		pingInterval: *ping,
+	}
+	s := &stats{}
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	end := func() { stopOnce.Do(func() { close(stop) }) }
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		end()
+	}()
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	fmt.Printf("spawning %d players on %s://%s\n", *players, *protocol, *addr)
+spawn:
+	for i := 1; i <= *players; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			runBot(*protocol, *addr, id, b, s, stop)
+		}(fmt.Sprintf("%s-%d", *prefix, i))
+		select {
+		case <-time.After(*ramp):
+		case <-stop:
+			break spawn
+		}
+	}
+	select {
+	case <-time.After(*duration):
+	case <-stop:
+	}
+	end()
+	// players still trying to connect may never return
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(stopTimeout):
+		fmt.Println("some players did not stop in time")
+	}
+	s.report(os.Stdout, *players, time.Since(start))
+}
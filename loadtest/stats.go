@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stats collects what the bots measure during a run
+type stats struct {
+	lock sync.Mutex
+	// players that joined, and those that could not
+	connected int
+	failed    int
+	// players whose connection was lost before the run ended
+	disconnected int
+	// how often each error made a player fail to connect or lose its connection
+	reasons      map[string]int
+	connectTimes []time.Duration
+	// time between sending a move and the server acknowledging it
+	moveLatencies []time.Duration
+	pings         []time.Duration
+	// bytes read and written by bots that have finished,
+	// and how long they were connected in total
+	read    int64
+	written int64
+	online  time.Duration
+}
+
+func (s *stats) connect(id string, took time.Duration, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err != nil {
+		s.failed++
+		s.reason(id, err)
+		return
+	}
+	s.connected++
+	s.connectTimes = append(s.connectTimes, took)
+}
+
+func (s *stats) disconnect(id string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.disconnected++
+	s.reason(id, err)
+}
+
+// reason counts err, with the name of the player taken out
+// so that the same error of different players is counted together
+// caller must hold lock
+func (s *stats) reason(id string, err error) {
+	if s.reasons == nil {
+		s.reasons = make(map[string]int)
+	}
+	s.reasons[strings.Replace(err.Error(), id, "<player>", -1)]++
+}
+
+func (s *stats) moved(latency time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.moveLatencies = append(s.moveLatencies, latency)
+}
+
+func (s *stats) pinged(rtt time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.pings = append(s.pings, rtt)
+}
+
+func (s *stats) traffic(read, written int64, online time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.read += read
+	s.written += written
+	s.online += online
+}
+
+// report writes a summary of a run that took elapsed
+func (s *stats) report(w io.Writer, players int, elapsed time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	fmt.Fprintf(w, "players:      %d requested, %d connected, %d failed, %d disconnected\n",
+		players, s.connected, s.failed, s.disconnected)
+	reasons := make([]string, 0, len(s.reasons))
+	for reason := range s.reasons {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Fprintf(w, "              %dx %s\n", s.reasons[reason], reason)
+	}
+	fmt.Fprintf(w, "connect:      %s\n", percentiles(s.connectTimes))
+	fmt.Fprintf(w, "move ack:     %s\n", percentiles(s.moveLatencies))
+	fmt.Fprintf(w, "ping:         %s\n", percentiles(s.pings))
+	seconds := elapsed.Seconds()
+	fmt.Fprintf(w, "bandwidth:    %s/s down, %s/s up in total\n", bytes(float64(s.read)/seconds), bytes(float64(s.written)/seconds))
+	if s.online > 0 {
+		perPlayer := s.online.Seconds()
+		fmt.Fprintf(w, "              %s/s down, %s/s up per player\n", bytes(float64(s.read)/perPlayer), bytes(float64(s.written)/perPlayer))
+	}
+}
+
+// percentiles summarizes durations as p50, p90, p99 and max
+func percentiles(durations []time.Duration) string {
+	if len(durations) == 0 {
+		return "no samples"
+	}
+	sorted := make(byDuration, len(durations))
+	copy(sorted, durations)
+	sort.Sort(sorted)
+	at := func(p float64) time.Duration {
+		return sorted[int(p*float64(len(sorted)-1))] / time.Microsecond * time.Microsecond
+	}
+	return fmt.Sprintf("p50 %v  p90 %v  p99 %v  max %v  (%d samples)", at(0.5), at(0.9), at(0.99), at(1), len(sorted))
+}
+
+type byDuration []time.Duration
+
+func (d byDuration) Len() int           { return len(d) }
+func (d byDuration) Less(i, j int) bool { return d[i] < d[j] }
+func (d byDuration) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+func bytes(n float64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMiB", n/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKiB", n/(1<<10))
+	default:
+		return fmt.Sprintf("%.0fB", n)
+	}
+}
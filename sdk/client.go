@@ -0,0 +1,365 @@
+// Package sdk connects to an mmo server without rendering anything,
+// for bots, test harnesses and other tools
+//
+// a Client keeps a copy of the world of the zone its player is in,
+// applies the updates the server sends and steps the world in between.
+// it is headless only: the game client does its own networking,
+// as it predicts its player's moves and interpolates everyone else's
+package sdk
+
+import (
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/faiface/pixel"
+	"github.com/ilackarms/pkg/errors"
+	"github.com/mmogo/mmo/shared"
+	"github.com/xtaci/smux"
+)
+
+const (
+	// updates not read from Updates in time are dropped past this
+	maxBufferedUpdates = 100
+
+	pingTimeout = time.Second
+)
+
+// Client is a player connected to the server
+type Client struct {
+	ID string
+
+	conn      *countingConn
+	sendLock  sync.Mutex
+	worldLock sync.RWMutex
+	world     *shared.World
+	seq       uint64
+	updates   chan *shared.Update
+	pingLock  sync.Mutex
+	pingSeq   uint64
+	pongs     chan uint64
+	ackLock   sync.Mutex
+	onAck     func(seq uint64)
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+func dialServer(protocol, addr string) (net.Conn, error) {
+	conn, err := shared.Dial(protocol, addr)
+	if err != nil {
+		return nil, err
+	}
+	session, err := smux.Client(conn, smux.DefaultConfig())
+	if err != nil {
+		return nil, err
+	}
+	return session.OpenStream()
+}
+
+// join asks to join the game over conn and returns the world
+// the server syncs in return
+func join(conn net.Conn, id string, appearance *shared.Appearance) (*shared.World, error) {
+	if err := shared.SendMessage(&shared.Message{
+		Request: &shared.Request{
+			ConnectRequest: &shared.ConnectRequest{
+				ID:         id,
+				Appearance: appearance,
+			},
+		}}, conn); err != nil {
+		return nil, errors.New("failed to send connect request", err)
+	}
+
+	// sync with server
+	// the player joins the zone before the world is sent, so updates
+	// of the zone may come first. the world already contains them
+	for {
+		msg, err := shared.GetMessage(conn)
+		if err != nil {
+			return nil, errors.New("failed reading message", err)
+		}
+
+		if msg.Error != nil {
+			return nil, errors.New("server refused connection: "+msg.Error.Message, nil)
+		}
+
+		if msg.Update == nil {
+			return nil, errors.New("expected Sync message on server handshake, got "+msg.String(), nil)
+		}
+		if msg.Update.WorldState != nil && msg.Update.WorldState.World != nil {
+			return msg.Update.WorldState.World, nil
+		}
+	}
+}
+
+// Dial joins the game as player id and keeps the world in sync
+// until the connection is lost or Close is called
+// appearance is only used if the player is new; nil gives it the default one
+func Dial(protocol, addr, id string, appearance *shared.Appearance) (*Client, error) {
+	stream, err := dialServer(protocol, addr)
+	if err != nil {
+		return nil, errors.New("failed to dial server", err)
+	}
+	// counted from the start, as the world synced on joining
+	// is the largest message there is
+	conn := &countingConn{Conn: stream}
+	world, err := join(conn, id, appearance)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c := &Client{
+		ID:      id,
+		conn:    conn,
+		world:   world,
+		updates: make(chan *shared.Update, maxBufferedUpdates),
+		pongs:   make(chan uint64, 1),
+		done:    make(chan struct{}),
+	}
+	go c.readUpdates()
+	go c.stepWorld()
+	return c, nil
+}
+
+// World returns the world of the zone the player is in
+// it is replaced when the player goes through a portal,
+// so it should be fetched again instead of kept
+func (c *Client) World() *shared.World {
+	c.worldLock.RLock()
+	defer c.worldLock.RUnlock()
+	return c.world
+}
+
+// Self returns the player, which must be treated as read-only
+func (c *Client) Self() (*shared.Player, bool) {
+	return c.World().GetPlayer(c.ID)
+}
+
+// Updates receives every update from the server after it has been applied
+// reading it is optional; updates are dropped while the buffer is full
+func (c *Client) Updates() <-chan *shared.Update {
+	return c.updates
+}
+
+// OnAck calls f with the number of every move request the server
+// has applied, in order. unlike Updates, no ack is ever dropped,
+// so f is called on the goroutine reading from the server and must not block
+func (c *Client) OnAck(f func(seq uint64)) {
+	c.ackLock.Lock()
+	defer c.ackLock.Unlock()
+	c.onAck = f
+}
+
+// Done is closed once the client has stopped
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the client stopped, or nil while it is running
+// or if it was closed
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// Traffic returns how many bytes were read from and written to
+// the server, including joining the game
+func (c *Client) Traffic() (read, written int64) {
+	return atomic.LoadInt64(&c.conn.read), atomic.LoadInt64(&c.conn.written)
+}
+
+// Close disconnects from the server
+func (c *Client) Close() error {
+	c.stop(nil)
+	return c.conn.Close()
+}
+
+func (c *Client) stop(err error) {
+	c.closeOnce.Do(func() {
+		c.err = err
+		close(c.done)
+	})
+}
+
+// Send sends a request to the server
+// MoveRequests are numbered, like the game client does
+func (c *Client) Send(req *shared.Request) error {
+	c.sendLock.Lock()
+	defer c.sendLock.Unlock()
+	if req.MoveRequest != nil {
+		c.seq++
+		req.MoveRequest.Seq = c.seq
+	}
+	return c.send(&shared.Message{Request: req})
+}
+
+// caller must hold sendLock
+func (c *Client) send(msg *shared.Message) error {
+	if err := shared.SendMessage(msg, c.conn); err != nil {
+		return errors.New("failed to send message", err)
+	}
+	return nil
+}
+
+// Move walks the player towards destination
+func (c *Client) Move(destination pixel.Vec) error {
+	return c.Send(&shared.Request{MoveRequest: &shared.MoveRequest{Destination: destination}})
+}
+
+// Attack attacks towards target with one of shared.Attacks
+func (c *Client) Attack(action shared.Action, target pixel.Vec) error {
+	return c.Send(&shared.Request{AttackRequest: &shared.AttackRequest{Action: action, Target: target}})
+}
+
+// Speak says text to nearby players
+func (c *Client) Speak(text string) error {
+	return c.Send(&shared.Request{SpeakRequest: &shared.SpeakRequest{Text: text}})
+}
+
+// Respawn brings the player back after it died
+func (c *Client) Respawn() error {
+	return c.Send(&shared.Request{RespawnRequest: &shared.RespawnRequest{}})
+}
+
+// Ping returns the time the server takes to answer
+// concurrent calls wait for each other
+func (c *Client) Ping() (time.Duration, error) {
+	c.pingLock.Lock()
+	defer c.pingLock.Unlock()
+	c.pingSeq++
+	seq := c.pingSeq
+	start := time.Now()
+	c.sendLock.Lock()
+	err := c.send(&shared.Message{Ping: &shared.Ping{Seq: seq}})
+	c.sendLock.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	timeout := time.After(pingTimeout)
+	for {
+		select {
+		case got := <-c.pongs:
+			// pongs of earlier pings that timed out are skipped
+			if got == seq {
+				return time.Since(start), nil
+			}
+		case <-c.done:
+			return 0, errors.New("client stopped waiting for pong", c.Err())
+		case <-timeout:
+			return 0, errors.New("timed out waiting for pong", nil)
+		}
+	}
+}
+
+func (c *Client) readUpdates() {
+	for {
+		msg, err := shared.GetMessage(c.conn)
+		if err != nil {
+			c.stop(errors.New("failed reading message", err))
+			return
+		}
+		if msg.Error != nil {
+			c.stop(errors.New("server returned an error: "+msg.Error.Message, nil))
+			return
+		}
+		if msg.Pong != nil {
+			c.pong(msg.Pong.Seq)
+		}
+		if msg.Update != nil {
+			if err := c.apply(msg.Update); err != nil {
+				log.Printf("failed applying update from server: %v", err)
+				continue
+			}
+			c.ack(msg.Update)
+			select {
+			case c.updates <- msg.Update:
+			default:
+			}
+		}
+	}
+}
+
+// ack passes the sequence number of a move of this player to onAck
+func (c *Client) ack(update *shared.Update) {
+	dest := update.PlayerDestination
+	if dest == nil || dest.ID != c.ID || dest.Seq == 0 {
+		return
+	}
+	c.ackLock.Lock()
+	onAck := c.onAck
+	c.ackLock.Unlock()
+	if onAck != nil {
+		onAck(dest.Seq)
+	}
+}
+
+// pong hands seq to Ping, replacing a stale pong nobody waits for
+func (c *Client) pong(seq uint64) {
+	for {
+		select {
+		case c.pongs <- seq:
+			return
+		default:
+		}
+		select {
+		case <-c.pongs:
+		default:
+		}
+	}
+}
+
+func (c *Client) apply(update *shared.Update) error {
+	// the server sends a new world when the player enters another zone
+	if update.WorldState != nil && update.WorldState.World != nil {
+		c.worldLock.Lock()
+		c.world = update.WorldState.World
+		c.worldLock.Unlock()
+		return nil
+	}
+	// the server only sends what it has applied itself,
+	// so an error means the world is out of sync
+	return c.World().ApplyUpdates(update)
+}
+
+func (c *Client) stepWorld() {
+	tick := time.NewTicker(shared.TickDuration)
+	defer tick.Stop()
+	last := time.Now()
+	for {
+		select {
+		case now := <-tick.C:
+			world := c.World()
+			world.Advance(now.Sub(last))
+			// nothing looks back at earlier states
+			world.Keep(1)
+			last = now
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// countingConn counts the bytes going through it
+type countingConn struct {
+	net.Conn
+	read    int64
+	written int64
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(&c.read, int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(&c.written, int64(n))
+	return n, err
+}
@@ -4,7 +4,9 @@ import (
 	"flag"
 	"fmt"
 	"log"
-
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/mmogo/mmo/shared"
@@ -15,26 +17,56 @@ func init() {
 }
 
 const (
-	ticksPerSecond = 10
-	tickTime       = time.Second / ticksPerSecond
-
 	bufferedMessageLimit = 60
+
+	// how often the records of connected players are saved
+	// besides when they disconnect and when the server is stopped
+	saveInterval = time.Minute
 )
 
 func main() {
 	port := flag.Int("port", 8080, "port to serve on")
 	protocol := flag.String("protocol", "udp", fmt.Sprintf("network protocol to use. available %s | %s", shared.ProtocolTCP, shared.ProtocolUDP))
+	mapDir := flag.String("maps", "maps", "directory with a map file for every zone")
+	startZone := flag.String("zone", "overworld", "zone new players enter the game in")
+	dataDir := flag.String("data", "players", "directory where player records are saved")
+	progressionFile := flag.String("progression", "progression.json", "file to load experience levels and rewards from")
 	flag.Parse()
+	progression, err := shared.LoadProgression(*progressionFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	zones, err := loadZones(*mapDir, progression)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for name, z := range zones {
+		log.Printf("loaded zone %s with map %s (%vx%v)", name, z.world.Map.Name, z.world.Map.Width, z.world.Map.Height)
+	}
+	store, err := newPlayerStore(*dataDir)
+	if err != nil {
+		log.Fatal(err)
+	}
 	errc := make(chan error)
-	server := newMMOServer()
-	go func() { log.Fatal(server.start(*protocol, *port, errc)) }()
+	server, err := newMMOServer(zones, *startZone, store)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go func() { errc <- shared.FatalErr(server.start(*protocol, *port, errc)) }()
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 	for {
 		select {
 		case err := <-errc:
 			if shared.IsFatal(err) {
+				server.mgr.saveAll()
 				log.Fatal(err)
 			}
 			log.Println("error:", err)
+		case sig := <-stop:
+			log.Printf("detected sig: %s, saving players and shutting down", sig)
+			server.mgr.saveAll()
+			return
 		}
 	}
 }
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/ilackarms/pkg/errors"
+	"github.com/mmogo/mmo/shared"
+)
+
+// playerStore keeps the records of players between sessions,
+// one json file per player
+type playerStore struct {
+	dir string
+}
+
+func newPlayerStore(dir string) (*playerStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.New("creating player data dir "+dir, err)
+	}
+	return &playerStore{dir: dir}, nil
+}
+
+func (s *playerStore) path(id string) string {
+	return filepath.Join(s.dir, url.PathEscape(id)+".json")
+}
+
+// load returns nil if the player has never been saved
+func (s *playerStore) load(id string) (*shared.PlayerRecord, error) {
+	data, err := ioutil.ReadFile(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New("reading record of player "+id, err)
+	}
+	var record shared.PlayerRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, errors.New("parsing record of player "+id, err)
+	}
+	return &record, nil
+}
+
+func (s *playerStore) save(id string, record *shared.PlayerRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return errors.New("encoding record of player "+id, err)
+	}
+	// write to a temporary file first so a crash never leaves half a record
+	tmp := s.path(id) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return errors.New("writing record of player "+id, err)
+	}
+	if err := os.Rename(tmp, s.path(id)); err != nil {
+		return errors.New("writing record of player "+id, err)
+	}
+	return nil
+}
@@ -21,10 +21,14 @@ type mmoServer struct {
 	mgr *updateManager
 }
 
-func newMMOServer() *mmoServer {
-	return &mmoServer{
-		mgr: newUpdateManager(),
+func newMMOServer(zones map[string]*zone, startZone string, store *playerStore) (*mmoServer, error) {
+	mgr, err := newUpdateManager(zones, startZone, store)
+	if err != nil {
+		return nil, err
 	}
+	return &mmoServer{
+		mgr: mgr,
+	}, nil
 }
 
 func (s *mmoServer) start(protocol string, port int, errc chan error) error {
@@ -95,8 +99,14 @@ func (s *mmoServer) start(protocol string, port int, errc chan error) error {
 		}()
 	}
 
-	// start game loop
-	go s.gameLoop(errc)
+	// every zone runs its own game loop
+	for _, z := range s.mgr.zones {
+		if err := z.spawnNPCs(); err != nil {
+			return err
+		}
+		go s.gameLoop(z, errc)
+	}
+	go s.saveLoop()
 
 	log.Printf("listening for connections on %v", port)
 	for {
@@ -146,7 +156,7 @@ func (s *mmoServer) handleConnection(conn net.Conn) error {
 	id := msg.Request.ConnectRequest.ID
 
 	// set up player connection
-	if err := s.mgr.playerConnected(id, conn); err != nil {
+	if err := s.mgr.playerConnected(id, msg.Request.ConnectRequest.Appearance, conn); err != nil {
 		log.Printf("WARN: failed to accept connection from player %s at %s\n", id, conn.RemoteAddr())
 		return s.mgr.sendError(conn, shared.FatalErr(err))
 	}
@@ -173,7 +183,7 @@ func (mgr *updateManager) startClientLoop(id string) error {
 		case msg.Request != nil:
 			cli.requests <- msg.Request
 		case msg.Ping != nil:
-			shared.SendMessage(&shared.Message{Pong: &shared.Pong{}}, cli.conn)
+			shared.SendMessage(&shared.Message{Pong: &shared.Pong{Seq: msg.Ping.Seq}}, cli.conn)
 		default:
 			log.Printf("invalid message from client: %s", msg)
 		}
@@ -181,36 +191,41 @@ func (mgr *updateManager) startClientLoop(id string) error {
 	return nil
 }
 
-func (s *mmoServer) gameLoop(errc chan error) {
-	tick := time.NewTicker(tickTime)
+func (s *mmoServer) gameLoop(z *zone, errc chan error) {
+	tick := time.NewTicker(shared.TickDuration)
 	last := time.Now()
 	for {
 		select {
 		case now := <-tick.C:
-			if err := s.update(now.Sub(last)); err != nil {
-				log.Printf("ERROR IN TICK: %v", err)
+			if err := s.update(z, now.Sub(last)); err != nil {
+				log.Printf("ERROR IN TICK OF ZONE %s: %v", z.name, err)
 				errc <- err
 			}
+			last = now
 		}
-		last = time.Now()
 	}
 }
 
-func (s *mmoServer) update(dt time.Duration) error {
-	//copy clients to an array so we dont have to RLock the whole function
-	clients := []*client{}
-	s.mgr.connectedPlayersLock.RLock()
-	for _, cli := range s.mgr.connectedPlayers {
-		clients = append(clients, cli)
+// saveLoop saves the records of all connected players every saveInterval
+func (s *mmoServer) saveLoop() {
+	tick := time.NewTicker(saveInterval)
+	for range tick.C {
+		s.mgr.saveAll()
 	}
-	s.mgr.connectedPlayersLock.RUnlock()
+}
+
+// update handles the requests of the players in z, steps its world
+// and sends the resulting updates to its players
+func (s *mmoServer) update(z *zone, dt time.Duration) error {
+	//copy clients to an array so we dont have to RLock the whole function
+	clients := s.mgr.clientsIn(z)
 
 	for _, cli := range clients {
 	requestLoop:
 		for {
 			select {
 			case req := <-cli.requests:
-				if err := s.handleRequest(cli.player, req); err != nil {
+				if err := s.handleRequest(z, cli.player, req); err != nil {
 					log.Printf("Error handling player request %#v: %v", req, err)
 				}
 			default:
@@ -219,36 +234,67 @@ func (s *mmoServer) update(dt time.Duration) error {
 		}
 	}
 	// update world
-	if err := s.mgr.world.Step(dt); err != nil {
+	if _, err := z.world.Advance(dt); err != nil {
 		return fmt.Errorf("in step: %v", err)
 	}
 
 	// only keep the last 3 snapshots
-	s.mgr.world.Keep(3)
+	z.world.Keep(3)
 
 	// broadcast all updates to clients
 	for {
 		select {
 		default:
 			return nil
-		case update := <-s.mgr.world.ProcessedUpdates():
+		case update := <-z.world.ProcessedUpdates():
+			if update.PlayerPortaled != nil {
+				if err := s.mgr.playerPortaled(z, update.PlayerPortaled); err != nil {
+					log.Printf("failed to move player through portal: %v", err)
+				}
+				continue
+			}
+			if id := update.Recipient(); id != "" {
+				// the player may have disconnected in the meantime
+				if s.mgr.getClient(id) != nil {
+					s.mgr.send(id, &shared.Message{Update: update})
+				}
+				continue
+			}
+			if center, radius, ok := update.Nearby(); ok {
+				s.mgr.broadcastNear(z, &shared.Message{Update: update}, center, radius)
+				continue
+			}
 			log.Printf("gonna broadcast: %s", update)
-			if err := s.mgr.broadcast(&shared.Message{Update: update}); err != nil {
+			if err := s.mgr.broadcast(z, &shared.Message{Update: update}); err != nil {
 				return errors.New("failed to broadcast update", err)
 			}
 		}
 	}
 }
 
-func (s *mmoServer) handleRequest(player *shared.Player, req *shared.Request) error {
+func (s *mmoServer) handleRequest(z *zone, player *shared.Player, req *shared.Request) error {
 	switch {
 	case req.MoveRequest != nil:
-		return s.mgr.playerMoved(player, req.MoveRequest)
+		return s.mgr.playerMoved(z, player, req.MoveRequest)
 	case req.SpeakRequest != nil:
-		return s.mgr.apply(&shared.PlayerSpoke{
-			ID:   player.ID,
-			Text: req.SpeakRequest.Text,
-		})
+		return s.mgr.playerSpoke(z, player, req.SpeakRequest)
+	case req.AttackRequest != nil:
+		return s.mgr.playerAttacked(z, player, req.AttackRequest)
+	case req.PickupRequest != nil:
+		return s.mgr.playerPickedUp(z, player, req.PickupRequest)
+	case req.DropRequest != nil:
+		return s.mgr.playerDropped(z, player, req.DropRequest)
+	case req.UseRequest != nil:
+		return s.mgr.playerUsed(z, player, req.UseRequest)
+	case req.EquipRequest != nil:
+		return s.mgr.playerEquipped(z, player, req.EquipRequest)
+	case req.UnequipRequest != nil:
+		return s.mgr.playerUnequipped(z, player, req.UnequipRequest)
+	case req.TradeRequest != nil, req.TradeAcceptRequest != nil, req.TradeOfferRequest != nil,
+		req.TradeConfirmRequest != nil, req.TradeCancelRequest != nil:
+		return s.mgr.playerTraded(z, player, req)
+	case req.RespawnRequest != nil:
+		return s.mgr.playerRespawned(z, player)
 	}
 	return fmt.Errorf("unknown request type: %#v", req)
 }
@@ -6,6 +6,7 @@ import (
 	"net"
 	"sync"
 
+	"github.com/faiface/pixel"
 	"github.com/ilackarms/pkg/errors"
 	"github.com/mmogo/mmo/shared"
 )
@@ -15,7 +16,13 @@ import (
 // for the server's internal state, and broadcast to clients
 // who are expected to apply updates to their internal state
 type updateManager struct {
-	world                *shared.World
+	zones map[string]*zone
+	// zone new players enter the game in
+	startZone *zone
+	store     *playerStore
+	// zone of every player that has been in the game, by ID
+	// guarded by connectedPlayersLock
+	playerZones          map[string]*zone
 	connectedPlayers     map[string]*client
 	connectedPlayersLock sync.RWMutex
 }
@@ -27,11 +34,18 @@ type updateManager struct {
 // decide what updates to qwueue back to the player
 //
 
-func newUpdateManager() *updateManager {
+func newUpdateManager(zones map[string]*zone, startZone string, store *playerStore) (*updateManager, error) {
+	start, ok := zones[startZone]
+	if !ok {
+		return nil, fmt.Errorf("start zone %s not found", startZone)
+	}
 	return &updateManager{
-		world:            shared.NewEmptyWorld(),
+		zones:            zones,
+		startZone:        start,
+		store:            store,
+		playerZones:      make(map[string]*zone),
 		connectedPlayers: make(map[string]*client),
-	}
+	}, nil
 }
 
 /*
@@ -43,6 +57,30 @@ func (mgr *updateManager) getClient(id string) *client {
 	return mgr.connectedPlayers[id]
 }
 
+// zoneOf returns the zone the player with id is in
+// players who have not been in the game yet start in the start zone
+func (mgr *updateManager) zoneOf(id string) *zone {
+	mgr.connectedPlayersLock.RLock()
+	defer mgr.connectedPlayersLock.RUnlock()
+	if z, ok := mgr.playerZones[id]; ok {
+		return z
+	}
+	return mgr.startZone
+}
+
+// clientsIn returns the connected players in z
+func (mgr *updateManager) clientsIn(z *zone) []*client {
+	mgr.connectedPlayersLock.RLock()
+	defer mgr.connectedPlayersLock.RUnlock()
+	var clients []*client
+	for id, cli := range mgr.connectedPlayers {
+		if mgr.playerZones[id] == z {
+			clients = append(clients, cli)
+		}
+	}
+	return clients
+}
+
 /*
 	Messaging Stuff
 */
@@ -57,6 +95,9 @@ func (mgr *updateManager) sendError(conn net.Conn, err error) error {
 func (mgr *updateManager) send(id string, msg *shared.Message) error {
 	log.Printf("sending to %s: %s", id, msg)
 	cli := mgr.getClient(id)
+	if cli == nil {
+		return fmt.Errorf("player %s is not connected", id)
+	}
 	err := shared.SendMessage(msg, cli.conn)
 	if err != nil {
 		//disconnect player
@@ -66,8 +107,9 @@ func (mgr *updateManager) send(id string, msg *shared.Message) error {
 	return err
 }
 
-func (mgr *updateManager) broadcast(msg *shared.Message) error {
-	log.Printf("broadcasting: %s", msg)
+// broadcast sends msg to every connected player in z
+func (mgr *updateManager) broadcast(z *zone, msg *shared.Message) error {
+	log.Printf("broadcasting in %s: %s", z.name, msg)
 	data, err := shared.Encode(msg)
 	if err != nil {
 		return err
@@ -75,6 +117,9 @@ func (mgr *updateManager) broadcast(msg *shared.Message) error {
 	mgr.connectedPlayersLock.RLock()
 	defer mgr.connectedPlayersLock.RUnlock()
 	for id, player := range mgr.connectedPlayers {
+		if mgr.playerZones[id] != z {
+			continue
+		}
 		if err := shared.SendRaw(data, player.conn); err != nil {
 			defer func(id string) {
 				//disconnect player
@@ -86,54 +131,82 @@ func (mgr *updateManager) broadcast(msg *shared.Message) error {
 	return nil
 }
 
-func (mgr *updateManager) apply(updateContents interface{}) error {
-	update := &shared.Update{}
-	switch contents := updateContents.(type) {
-	case *shared.AddPlayer:
-		update.AddPlayer = contents
-	case *shared.RemovePlayer:
-		update.RemovePlayer = contents
-	case *shared.PlayerDestination:
-		update.PlayerDestination = contents
-	case *shared.PlayerPosition:
-		update.PlayerPosition = contents
-	case *shared.PlayerSpoke:
-		update.PlayerSpoke = contents
-	default:
-		return fmt.Errorf("unknown update type: %#v", updateContents)
-	}
-	if err := mgr.world.ApplyUpdates(update); err != nil {
-		return fmt.Errorf("failed to apply update %v: %v", update, err)
+// broadcastNear sends msg to the connected players in z within radius of center
+func (mgr *updateManager) broadcastNear(z *zone, msg *shared.Message, center pixel.Vec, radius float64) error {
+	for _, cli := range mgr.clientsIn(z) {
+		player, ok := z.world.GetPlayer(cli.player.ID)
+		if ok && shared.WithinRange(player.Position, center, radius) {
+			mgr.send(player.ID, msg)
+		}
 	}
-
 	return nil
 }
 
 func (mgr *updateManager) syncPlayerState(id string) error {
 	// sync client state
-	if err := mgr.send(id, &shared.Message{Update: &shared.Update{WorldState: &shared.WorldState{World: mgr.world}}}); err != nil {
+	// other players are sent after the world, one at a time,
+	// so that the world fits into a message however crowded the zone is
+	world := mgr.zoneOf(id).world.VisibleTo(id)
+	var others []*shared.Player
+	for playerID, player := range world.Players {
+		if playerID != id {
+			others = append(others, player)
+			delete(world.Players, playerID)
+		}
+	}
+	if err := mgr.send(id, &shared.Message{Update: &shared.Update{WorldState: &shared.WorldState{World: world}}}); err != nil {
 		return errors.New("syncing state with client", err)
 	}
+	for _, player := range others {
+		if err := mgr.send(id, &shared.Message{Update: &shared.Update{PlayerSynced: &shared.PlayerSynced{Player: player}}}); err != nil {
+			return errors.New("syncing player "+player.ID+" with client", err)
+		}
+	}
 	return nil
 }
 
 /*
 	Event handlers
 */
-func (mgr *updateManager) playerConnected(id string, conn net.Conn) error {
+// chosen is the appearance picked by the player, which only
+// counts for characters that are new
+func (mgr *updateManager) playerConnected(id string, chosen *shared.Appearance, conn net.Conn) error {
 	if cli := mgr.getClient(id); cli != nil {
 		return fmt.Errorf("Player %s already connected", id)
 	}
 
-	if err := mgr.apply(&shared.AddPlayer{
-		ID: id,
-		// todo: dont pick random starting positions. rework how collisions work
-		Position: shared.RandVec(-20, 20),
-	}); err != nil {
+	z := mgr.zoneOf(id)
+	_, returning := z.world.GetPlayer(id)
+
+	record, err := mgr.store.load(id)
+	if err != nil {
+		return errors.New("failed to load player "+id, err)
+	}
+	appearance, err := appearanceOf(id, record, chosen)
+	if err != nil {
+		return err
+	}
+
+	added := &shared.AddPlayer{
+		ID:         id,
+		Position:   z.world.SpawnPoint(),
+		Appearance: appearance,
+	}
+	if record != nil {
+		added.Level = record.Level
+	}
+	if err := z.apply(added); err != nil {
 		return errors.New("failed to apply and broadcast adding of player", err)
 	}
 
-	player, ok := mgr.world.GetPlayer(id)
+	// players that are still in the world since their last session keep their state
+	if !returning && record != nil {
+		if err := z.loadRecord(id, record); err != nil {
+			return err
+		}
+	}
+
+	player, ok := z.world.GetPlayer(id)
 	if !ok {
 		return fmt.Errorf("player %s should have been added to state but was not", id)
 	}
@@ -141,6 +214,7 @@ func (mgr *updateManager) playerConnected(id string, conn net.Conn) error {
 	sPlayer := newServerPlayer(player, conn)
 	mgr.connectedPlayersLock.Lock()
 	mgr.connectedPlayers[id] = sPlayer
+	mgr.playerZones[id] = z
 	mgr.connectedPlayersLock.Unlock()
 
 	// sync client state
@@ -151,21 +225,176 @@ func (mgr *updateManager) playerConnected(id string, conn net.Conn) error {
 	return nil
 }
 
+// appearanceOf returns the appearance saved in record,
+// or chosen if the player has none yet
+func appearanceOf(id string, record *shared.PlayerRecord, chosen *shared.Appearance) (shared.Appearance, error) {
+	if record != nil && record.Appearance.Body.Sheet != "" {
+		return record.Appearance, nil
+	}
+	if chosen == nil {
+		return shared.DefaultAppearance, nil
+	}
+	if err := chosen.Validate(); err != nil {
+		return shared.Appearance{}, errors.New("invalid appearance for player "+id, err)
+	}
+	return *chosen, nil
+}
+
+func (mgr *updateManager) savePlayer(id string) error {
+	record, ok := mgr.zoneOf(id).world.GetRecord(id)
+	if !ok {
+		return fmt.Errorf("player %s not found", id)
+	}
+	return mgr.store.save(id, record)
+}
+
+// saveAll saves every connected player, so that a crash
+// loses no more than what happened since
+func (mgr *updateManager) saveAll() {
+	mgr.connectedPlayersLock.RLock()
+	ids := make([]string, 0, len(mgr.connectedPlayers))
+	for id := range mgr.connectedPlayers {
+		ids = append(ids, id)
+	}
+	mgr.connectedPlayersLock.RUnlock()
+	for _, id := range ids {
+		if err := mgr.savePlayer(id); err != nil {
+			log.Printf("failed to save player %s: %v", id, err)
+		}
+	}
+}
+
 func (mgr *updateManager) playerDisconnected(id string) error {
 	mgr.connectedPlayersLock.Lock()
 	delete(mgr.connectedPlayers, id)
 	mgr.connectedPlayersLock.Unlock()
 
-	return mgr.apply(&shared.RemovePlayer{
+	if err := mgr.savePlayer(id); err != nil {
+		log.Printf("failed to save player %s: %v", id, err)
+	}
+
+	return mgr.zoneOf(id).apply(&shared.RemovePlayer{
 		ID: id,
 	})
 }
 
-func (mgr *updateManager) playerMoved(player *shared.Player, move *shared.MoveRequest) error {
-	if shared.UnitVec(player.Destination) == shared.UnitVec(move.Destination) {
-		//no-op, ignore this request
+// playerPortaled moves a player who walked into a portal in from to the zone
+// the portal leads to, and sends the client the world of that zone
+func (mgr *updateManager) playerPortaled(from *zone, portaled *shared.PlayerPortaled) error {
+	to, ok := mgr.zones[portaled.Zone]
+	if !ok {
+		return fmt.Errorf("zone %s not found", portaled.Zone)
+	}
+	player, err := from.world.DeletePlayer(portaled.ID)
+	if err != nil {
+		return err
+	}
+	if err := to.apply(&shared.AddPlayer{
+		ID:         portaled.ID,
+		Position:   portaled.Position,
+		Health:     player.Health,
+		Appearance: player.Appearance,
+		Level:      player.Level,
+	}); err != nil {
+		return err
+	}
+	if err := to.loadRecord(portaled.ID, &player.PlayerRecord); err != nil {
+		return err
+	}
+	entered, ok := to.world.GetPlayer(portaled.ID)
+	if !ok {
+		return fmt.Errorf("player %s should have been added to zone %s but was not", portaled.ID, to.name)
+	}
+	mgr.connectedPlayersLock.Lock()
+	mgr.playerZones[portaled.ID] = to
+	cli := mgr.connectedPlayers[portaled.ID]
+	if cli != nil {
+		cli.player = entered
+	}
+	mgr.connectedPlayersLock.Unlock()
+	log.Printf("player %s went from zone %s to %s", portaled.ID, from.name, to.name)
+	if cli == nil {
 		return nil
 	}
+	return mgr.syncPlayerState(portaled.ID)
+}
+
+func (mgr *updateManager) playerMoved(z *zone, player *shared.Player, move *shared.MoveRequest) error {
+	if !player.Alive() {
+		return fmt.Errorf("player %s can not move while dead", player.ID)
+	}
+	if !shared.Finite(move.Destination) {
+		return fmt.Errorf("player %s requested invalid destination %v", player.ID, move.Destination)
+	}
+	// players may click outside the play area; they walk as far as they can
+	move.Destination = z.world.ClampToPlayArea(move.Destination)
+	// every move is applied, even if it changes nothing, so that
+	// the client sees it acknowledged
 	moveUpdate := shared.ToUpdate(player.ID, move).PlayerDestination
-	return mgr.apply(moveUpdate)
+	return z.apply(moveUpdate)
+}
+
+func (mgr *updateManager) playerAttacked(z *zone, player *shared.Player, attack *shared.AttackRequest) error {
+	if _, ok := shared.Attacks[attack.Action]; !ok {
+		return fmt.Errorf("%v is not an attack", attack.Action)
+	}
+	if !shared.Finite(attack.Target) {
+		return fmt.Errorf("player %s attacked invalid target %v", player.ID, attack.Target)
+	}
+	return z.apply(shared.ToUpdate(player.ID, attack).EntityAttacked)
+}
+
+func (mgr *updateManager) playerSpoke(z *zone, player *shared.Player, speak *shared.SpeakRequest) error {
+	if !player.Alive() {
+		return fmt.Errorf("player %s can not speak while dead", player.ID)
+	}
+	return z.apply(shared.ToUpdate(player.ID, speak).PlayerSpoke)
+}
+
+func (mgr *updateManager) playerRespawned(z *zone, player *shared.Player) error {
+	if player.Alive() {
+		return fmt.Errorf("player %s is not dead", player.ID)
+	}
+	return z.apply(&shared.PlayerRespawned{
+		ID:       player.ID,
+		Position: z.world.RespawnPoint(player.Position),
+	})
+}
+
+// item requests are checked by the world, which knows what the player carries
+func (mgr *updateManager) playerPickedUp(z *zone, player *shared.Player, pickup *shared.PickupRequest) error {
+	return z.apply(shared.ToUpdate(player.ID, pickup).ItemPickedUp)
+}
+
+func (mgr *updateManager) playerDropped(z *zone, player *shared.Player, drop *shared.DropRequest) error {
+	return z.apply(shared.ToUpdate(player.ID, drop).ItemDropped)
+}
+
+func (mgr *updateManager) playerUsed(z *zone, player *shared.Player, use *shared.UseRequest) error {
+	return z.apply(shared.ToUpdate(player.ID, use).ItemUsed)
+}
+
+func (mgr *updateManager) playerEquipped(z *zone, player *shared.Player, equip *shared.EquipRequest) error {
+	return z.apply(shared.ToUpdate(player.ID, equip).ItemEquipped)
+}
+
+func (mgr *updateManager) playerUnequipped(z *zone, player *shared.Player, unequip *shared.UnequipRequest) error {
+	return z.apply(shared.ToUpdate(player.ID, unequip).ItemUnequipped)
+}
+
+// trade requests are checked by the world, which knows who is trading with whom
+func (mgr *updateManager) playerTraded(z *zone, player *shared.Player, req *shared.Request) error {
+	switch {
+	case req.TradeRequest != nil:
+		return z.apply(shared.ToUpdate(player.ID, req.TradeRequest).TradeRequested)
+	case req.TradeAcceptRequest != nil:
+		return z.apply(shared.ToUpdate(player.ID, req.TradeAcceptRequest).TradeAccepted)
+	case req.TradeOfferRequest != nil:
+		return z.apply(shared.ToUpdate(player.ID, req.TradeOfferRequest).TradeOffered)
+	case req.TradeConfirmRequest != nil:
+		return z.apply(shared.ToUpdate(player.ID, req.TradeConfirmRequest).TradeConfirmed)
+	case req.TradeCancelRequest != nil:
+		return z.apply(shared.ToUpdate(player.ID, req.TradeCancelRequest).TradeCancelled)
+	}
+	return fmt.Errorf("not a trade request: %#v", req)
 }
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/ilackarms/pkg/errors"
+	"github.com/mmogo/mmo/shared"
+)
+
+// zone is one named area of the game with its own map and world
+// every zone is stepped by its own loop, and its updates
+// only go to the players in it
+type zone struct {
+	name  string
+	world *shared.World
+}
+
+func newZone(name string, tileMap *shared.TileMap, progression *shared.Progression) *zone {
+	world := shared.NewWorld(tileMap)
+	world.SetAuthoritative()
+	world.SetProgression(progression)
+	return &zone{
+		name:  name,
+		world: world,
+	}
+}
+
+// loadZones creates a zone for every map file in dir,
+// named after the file without its extension
+func loadZones(dir string, progression *shared.Progression) (map[string]*zone, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.New("reading zone directory "+dir, err)
+	}
+	zones := make(map[string]*zone)
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		tileMap, err := shared.LoadTileMap(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(file.Name(), ".json")
+		zones[name] = newZone(name, tileMap, progression)
+	}
+	for name, z := range zones {
+		for _, portal := range z.world.Map.Portals {
+			to, ok := zones[portal.Zone]
+			if !ok {
+				return nil, fmt.Errorf("portal in zone %s leads to unknown zone %s", name, portal.Zone)
+			}
+			if !to.world.Map.Walkable(portal.Destination) {
+				return nil, fmt.Errorf("portal in zone %s leads to %s, which is not walkable in zone %s", name, portal.Destination, portal.Zone)
+			}
+		}
+	}
+	return zones, nil
+}
+
+// apply applies an update to the zone's world
+func (z *zone) apply(updateContents interface{}) error {
+	update := &shared.Update{}
+	switch contents := updateContents.(type) {
+	case *shared.AddPlayer:
+		update.AddPlayer = contents
+	case *shared.RemovePlayer:
+		update.RemovePlayer = contents
+	case *shared.PlayerDestination:
+		update.PlayerDestination = contents
+	case *shared.PlayerPosition:
+		update.PlayerPosition = contents
+	case *shared.PlayerSpoke:
+		update.PlayerSpoke = contents
+	case *shared.AddEntity:
+		update.AddEntity = contents
+	case *shared.EntityDestination:
+		update.EntityDestination = contents
+	case *shared.EntityPosition:
+		update.EntityPosition = contents
+	case *shared.RemoveEntity:
+		update.RemoveEntity = contents
+	case *shared.EntityAttacked:
+		update.EntityAttacked = contents
+	case *shared.PlayerRespawned:
+		update.PlayerRespawned = contents
+	case *shared.ItemPickedUp:
+		update.ItemPickedUp = contents
+	case *shared.ItemDropped:
+		update.ItemDropped = contents
+	case *shared.ItemUsed:
+		update.ItemUsed = contents
+	case *shared.InventoryChanged:
+		update.InventoryChanged = contents
+	case *shared.ItemEquipped:
+		update.ItemEquipped = contents
+	case *shared.ItemUnequipped:
+		update.ItemUnequipped = contents
+	case *shared.ExperienceGained:
+		update.ExperienceGained = contents
+	case *shared.ExperienceChanged:
+		update.ExperienceChanged = contents
+	case *shared.TradeRequested:
+		update.TradeRequested = contents
+	case *shared.TradeAccepted:
+		update.TradeAccepted = contents
+	case *shared.TradeOffered:
+		update.TradeOffered = contents
+	case *shared.TradeConfirmed:
+		update.TradeConfirmed = contents
+	case *shared.TradeCancelled:
+		update.TradeCancelled = contents
+	default:
+		return fmt.Errorf("unknown update type: %#v", updateContents)
+	}
+	if err := z.world.ApplyUpdates(update); err != nil {
+		return fmt.Errorf("failed to apply update %v in zone %s: %v", update, z.name, err)
+	}
+
+	return nil
+}
+
+// spawnNPCs adds the npcs placed on the map to the world
+func (z *zone) spawnNPCs() error {
+	if z.world.Map == nil {
+		return nil
+	}
+	for _, npc := range z.world.Map.NPCs {
+		if err := z.apply(&shared.AddEntity{Entity: npc}); err != nil {
+			return errors.New("failed to spawn npc "+npc.ID, err)
+		}
+	}
+	return nil
+}
+
+// loadRecord gives the player with id the inventory and progress of record
+func (z *zone) loadRecord(id string, record *shared.PlayerRecord) error {
+	if err := z.apply(&shared.InventoryChanged{
+		ID:        id,
+		Inventory: record.Inventory,
+		Equipment: record.Equipment,
+	}); err != nil {
+		return err
+	}
+	return z.apply(&shared.ExperienceChanged{
+		ID:       id,
+		Progress: record.Progress,
+	})
+}
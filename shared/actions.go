@@ -1,5 +1,7 @@
 package shared
 
+import "fmt"
+
 // Action describes the activity of an entity
 type Action int
 
@@ -14,3 +16,43 @@ const (
 	A_HURT
 	A_DEAD
 )
+
+// MarshalText lets actions be written by name in data files
+func (a Action) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *Action) UnmarshalText(text []byte) error {
+	for action := A_IDLE; action <= A_DEAD; action++ {
+		if action.String() == string(text) {
+			*a = action
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown action %q", text)
+}
+
+func (a Action) String() string {
+	switch a {
+	case A_IDLE:
+		return "idle"
+	case A_WALK:
+		return "walk"
+	case A_CHAT_:
+		return "chat"
+	case A_SLASH:
+		return "slash"
+	case A_SHOOT:
+		return "shoot"
+	case A_SPELL:
+		return "spell"
+	case A_THRUST:
+		return "thrust"
+	case A_HURT:
+		return "hurt"
+	case A_DEAD:
+		return "dead"
+	default:
+		return fmt.Sprintf("invalid action: %v", int(a))
+	}
+}
@@ -0,0 +1,52 @@
+package shared
+
+import (
+	"fmt"
+
+	"github.com/ilackarms/pkg/errors"
+	"golang.org/x/image/colornames"
+)
+
+// BodySheets lists the sprite sheets players can pick for their body
+// clients need an atlas of the same name for every sheet
+var BodySheets = []string{"player"}
+
+// Layer is a sprite sheet a player is drawn with
+type Layer struct {
+	Sheet string
+	// name of the color the sheet is tinted with, see colornames
+	// empty to draw the sheet in its own colors
+	Tint string `,omitempty`
+}
+
+// Appearance is chosen when a character is created
+type Appearance struct {
+	Body Layer
+}
+
+// DefaultAppearance is given to players who did not choose one
+var DefaultAppearance = Appearance{Body: Layer{Sheet: "player"}}
+
+// Validate returns an error unless the body uses a sheet listed
+// in BodySheets and a known tint
+func (a Appearance) Validate() error {
+	if a.Body.Sheet == "" {
+		return errors.New("appearance needs a body", nil)
+	}
+	if !contains(BodySheets, a.Body.Sheet) {
+		return errors.New(fmt.Sprintf("%s is not available as body", a.Body.Sheet), nil)
+	}
+	if _, ok := colornames.Map[a.Body.Tint]; a.Body.Tint != "" && !ok {
+		return errors.New(fmt.Sprintf("unknown tint %s of body", a.Body.Tint), nil)
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,217 @@
+package shared
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+
+	"github.com/faiface/pixel"
+)
+
+// BehaviorKind selects the BehaviorFunc that controls an npc
+type BehaviorKind byte
+
+const (
+	B_IDLE BehaviorKind = iota
+	B_WANDER
+	B_PATROL
+	B_FOLLOW
+	B_FLEE
+)
+
+var behaviorNames = map[BehaviorKind]string{
+	B_IDLE:   "idle",
+	B_WANDER: "wander",
+	B_PATROL: "patrol",
+	B_FOLLOW: "follow",
+	B_FLEE:   "flee",
+}
+
+func (k BehaviorKind) String() string {
+	if name, ok := behaviorNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("invalid behavior kind: %v", int(k))
+}
+
+// MarshalText lets behaviors be written by name in map files
+func (k BehaviorKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *BehaviorKind) UnmarshalText(text []byte) error {
+	for kind, name := range behaviorNames {
+		if name == string(text) {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown behavior %q", text)
+}
+
+// Behavior holds the parameters and state of an npc's ai
+type Behavior struct {
+	Kind BehaviorKind
+	// wandering npcs stay within region
+	Region pixel.Rect `,omitempty`
+	// patrolling npcs walk between these points in order
+	Route []pixel.Vec `,omitempty`
+	// player that following and fleeing npcs react to
+	// if empty, the nearest player within Range is used
+	Target string `,omitempty`
+	// how far away following and fleeing npcs notice players
+	Range float64 `,omitempty`
+	// index into Route of the point currently walked to
+	Waypoint int `,omitempty`
+	// tick at which a wandering npc picks a new destination
+	NextThink uint64 `,omitempty`
+}
+
+func (b *Behavior) DeepCopy() *Behavior {
+	cpy := *b
+	cpy.Route = make([]pixel.Vec, len(b.Route))
+	copy(cpy.Route, b.Route)
+	return &cpy
+}
+
+// BehaviorFunc decides where npc walks next by setting its Destination
+// it may keep state in npc.Behavior. all randomness must come from rng
+// so that the outcome only depends on the state of the world
+// caller holds playersLock
+type BehaviorFunc func(w *World, npc *Entity, rng *rand.Rand)
+
+var behaviorFuncs = map[BehaviorKind]BehaviorFunc{
+	B_IDLE:   idle,
+	B_WANDER: wander,
+	B_PATROL: patrol,
+	B_FOLLOW: follow,
+	B_FLEE:   flee,
+}
+
+// RegisterBehavior adds or replaces the behavior of kind
+// it must be called before any world is stepped
+func RegisterBehavior(kind BehaviorKind, name string, f BehaviorFunc) {
+	behaviorNames[kind] = name
+	behaviorFuncs[kind] = f
+}
+
+// think runs the behavior of entity, if it has one
+// returns whether its destination changed
+// caller must hold playersLock
+func (w *World) think(entity *Entity) bool {
+	if entity.Behavior == nil {
+		return false
+	}
+	f, ok := behaviorFuncs[entity.Behavior.Kind]
+	if !ok {
+		return false
+	}
+	before := entity.Destination
+	f(w, entity, behaviorRand(entity.ID, w.Tick))
+	entity.Destination = w.ClampToPlayArea(entity.Destination)
+	return entity.Destination != before
+}
+
+// behaviorRand returns a random source seeded from the npc and tick
+func behaviorRand(id string, tick uint64) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	return rand.New(rand.NewSource(int64(h.Sum64() ^ tick)))
+}
+
+func arrived(entity *Entity) bool {
+	return WithinRange(entity.Destination, entity.Position, 0.5)
+}
+
+func idle(w *World, npc *Entity, rng *rand.Rand) {
+	npc.Destination = npc.Position
+}
+
+// wander walks to a random walkable spot in the region every few seconds
+func wander(w *World, npc *Entity, rng *rand.Rand) {
+	b := npc.Behavior
+	if w.Tick < b.NextThink {
+		return
+	}
+	b.NextThink = w.Tick + uint64(TicksPerSecond*(2+rng.Intn(5)))
+	region := b.Region
+	if region.Area() == 0 {
+		region = RectFromCenter(npc.Position, 8, 8)
+	}
+	// give up after a few tries; the npc will try again next time
+	for i := 0; i < 8; i++ {
+		dest := pixel.V(
+			region.Min.X+rng.Float64()*region.W(),
+			region.Min.Y+rng.Float64()*region.H(),
+		)
+		if w.Map == nil || w.Map.Walkable(dest) {
+			npc.Destination = dest
+			return
+		}
+	}
+}
+
+// patrol walks the route, starting over once the last point is reached
+func patrol(w *World, npc *Entity, rng *rand.Rand) {
+	b := npc.Behavior
+	if len(b.Route) == 0 {
+		idle(w, npc, rng)
+		return
+	}
+	if b.Waypoint >= len(b.Route) {
+		b.Waypoint = 0
+	}
+	if npc.Destination == b.Route[b.Waypoint] && arrived(npc) {
+		b.Waypoint = (b.Waypoint + 1) % len(b.Route)
+	}
+	npc.Destination = b.Route[b.Waypoint]
+}
+
+// follow walks towards the target, and stands still once it has lost it
+func follow(w *World, npc *Entity, rng *rand.Rand) {
+	target := w.behaviorTarget(npc)
+	if target == nil {
+		idle(w, npc, rng)
+		return
+	}
+	npc.Destination = target.Position
+}
+
+// flee runs away from the target until it is out of range
+func flee(w *World, npc *Entity, rng *rand.Rand) {
+	target := w.behaviorTarget(npc)
+	if target == nil {
+		idle(w, npc, rng)
+		return
+	}
+	away := npc.Position.Sub(target.Position)
+	if away == pixel.ZV {
+		away = pixel.V(1, 0)
+	}
+	npc.Destination = npc.Position.Add(UnitVec(away).Scaled(npc.Behavior.Range))
+}
+
+// behaviorTarget returns the active player that npc reacts to,
+// or nil if there is none within range
+// caller must hold playersLock
+func (w *World) behaviorTarget(npc *Entity) *Entity {
+	b := npc.Behavior
+	if b.Target != "" {
+		player, ok := w.Players[b.Target]
+		if !ok || !player.Active || !player.Alive() || !WithinRange(npc.Position, player.Position, b.Range) {
+			return nil
+		}
+		return &player.Entity
+	}
+	var nearest *Entity
+	for _, id := range w.spatialIndex().QueryRadius(npc.Position, b.Range) {
+		player, ok := w.Players[id]
+		if !ok || !player.Alive() {
+			continue
+		}
+		if nearest == nil || npc.Position.Sub(player.Position).Len() < npc.Position.Sub(nearest.Position).Len() {
+			nearest = &player.Entity
+		}
+	}
+	return nearest
+}
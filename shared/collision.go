@@ -0,0 +1,130 @@
+package shared
+
+import (
+	"math"
+	"time"
+
+	"github.com/faiface/pixel"
+)
+
+// solid entities collide with each other as circles, so they slide smoothly
+// around each other. terrain is made of square tiles, which entities
+// slide along on whichever axis is still free
+// all functions in this file expect the caller to hold playersLock
+
+// slide returns where entity ends up when trying to move by delta
+func (w *World) slide(entity *Entity, delta pixel.Vec) pixel.Vec {
+	if blocker := w.blockingEntity(entity, delta); blocker != nil {
+		delta = steer(entity, blocker, delta)
+		if w.blockingEntity(entity, delta) != nil {
+			// squeezed between several entities
+			return entity.Position
+		}
+	}
+	if !w.terrainBlocked(entity, delta) {
+		return entity.Position.Add(delta)
+	}
+	for _, move := range []pixel.Vec{pixel.V(delta.X, 0), pixel.V(0, delta.Y)} {
+		if move == pixel.ZV || move == delta {
+			continue
+		}
+		if !w.terrainBlocked(entity, move) && w.blockingEntity(entity, move) == nil {
+			return entity.Position.Add(move)
+		}
+	}
+	return entity.Position
+}
+
+// blockingEntity returns the other solid entity that entity would bump into
+// when moving by delta, or nil if the way is free
+// moving away from an entity is always allowed, so that overlapping entities are never stuck
+func (w *World) blockingEntity(entity *Entity, delta pixel.Vec) *Entity {
+	if !entity.Solid || !entity.Alive() {
+		return nil
+	}
+	to := entity.Position.Add(delta)
+	for _, otherID := range w.spatialIndex().QueryRect(entity.Hitbox().Moved(delta)) {
+		// entity cant collide with self
+		if otherID == entity.ID {
+			continue
+		}
+		other := w.entity(otherID)
+		if !other.Solid || !other.Alive() {
+			continue
+		}
+		before := entity.Position.Sub(other.Position).Len()
+		after := to.Sub(other.Position).Len()
+		if after < entity.Radius()+other.Radius() && after < before {
+			return other
+		}
+	}
+	return nil
+}
+
+func (w *World) terrainBlocked(entity *Entity, delta pixel.Vec) bool {
+	return w.Map != nil && w.Map.Blocked(entity.Hitbox().Moved(delta))
+}
+
+// steer turns delta so that entity walks around blocker instead of into it
+// entities walking straight into each other both keep to their left
+func steer(entity, blocker *Entity, delta pixel.Vec) pixel.Vec {
+	normal := UnitVec(blocker.Position.Sub(entity.Position))
+	tangent := delta.Sub(normal.Scaled(delta.Dot(normal)))
+	// what is left of the tangent after walking straight at blocker is rounding error
+	if tangent.Len() < delta.Len()*1e-9 {
+		tangent = pixel.V(-normal.Y, normal.X)
+	}
+	return UnitVec(tangent).Scaled(delta.Len())
+}
+
+// separate pushes entity and any solid entities overlapping it apart,
+// by at most the distance entity could walk in dt
+// returns the IDs of the other entities that were pushed
+func (w *World) separate(entity *Entity, dt time.Duration) []string {
+	if !entity.Solid || entity.Speed == 0 || !entity.Alive() {
+		return nil
+	}
+	var pushed []string
+	maxPush := entity.Speed * dt.Seconds()
+	for _, otherID := range w.spatialIndex().QueryRect(entity.Hitbox()) {
+		if otherID == entity.ID {
+			continue
+		}
+		other := w.entity(otherID)
+		if !other.Solid || !other.Alive() {
+			continue
+		}
+		away := entity.Position.Sub(other.Position)
+		overlap := entity.Radius() + other.Radius() - away.Len()
+		if overlap <= 0 {
+			continue
+		}
+		if away == pixel.ZV {
+			// entities on the exact same spot are split up by ID
+			away = pixel.V(1, 0)
+			if entity.ID < other.ID {
+				away = pixel.V(-1, 0)
+			}
+		}
+		push := UnitVec(away).Scaled(math.Min(overlap/2, maxPush))
+		w.nudge(entity, push)
+		if other.Speed != 0 {
+			w.nudge(other, push.Scaled(-1))
+		}
+		pushed = append(pushed, otherID)
+	}
+	return pushed
+}
+
+// nudge moves entity by delta unless terrain is in the way
+func (w *World) nudge(entity *Entity, delta pixel.Vec) {
+	if w.terrainBlocked(entity, delta) {
+		return
+	}
+	w.setPosition(entity, entity.Position.Add(delta))
+}
+
+func (w *World) setPosition(entity *Entity, pos pixel.Vec) {
+	entity.Position = pos
+	w.spatialIndex().Insert(entity.ID, entity.Hitbox())
+}
@@ -0,0 +1,266 @@
+package shared
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/faiface/pixel"
+	"github.com/ilackarms/pkg/errors"
+)
+
+const (
+	basePlayerHealth = 100
+	baseNPCHealth    = 30
+
+	hurtDuration = TickDuration * 3
+)
+
+// Attack describes one of the actions an entity can attack with
+type Attack struct {
+	// how far from the attacker's center a target can be hit
+	Range float64
+	// targets of melee attacks must be within this angle (in radians)
+	// to either side of the direction of the attack
+	Arc    float64
+	Damage int
+	// time before the attacker can attack again
+	Cooldown time.Duration
+	// how long the attack animation plays
+	Duration time.Duration
+	// ranged attacks fire a projectile flying at this speed
+	// instead of hitting instantly
+	ProjectileSpeed float64
+}
+
+// Attacks lists the actions that are attacks
+var Attacks = map[Action]Attack{
+	A_SLASH: {
+		Range:    1.5,
+		Arc:      math.Pi / 3,
+		Damage:   10,
+		Cooldown: time.Millisecond * 600,
+		Duration: time.Millisecond * 600,
+	},
+	A_THRUST: {
+		Range:    2,
+		Arc:      math.Pi / 8,
+		Damage:   14,
+		Cooldown: time.Millisecond * 800,
+		Duration: time.Millisecond * 800,
+	},
+	A_SHOOT: {
+		Range:           8,
+		Damage:          8,
+		Cooldown:        time.Second,
+		Duration:        time.Millisecond * 1300,
+		ProjectileSpeed: 12,
+	},
+	A_SPELL: {
+		Range:           6,
+		Damage:          20,
+		Cooldown:        time.Second * 2,
+		Duration:        time.Millisecond * 700,
+		ProjectileSpeed: 8,
+	},
+}
+
+// Alive returns false for entities that have been killed
+// entities without health can not be killed
+func (e *Entity) Alive() bool {
+	return e.MaxHealth == 0 || e.Health > 0
+}
+
+// ticks converts d to a number of world steps, rounding down
+func ticks(d time.Duration) uint64 {
+	return uint64(d / TickDuration)
+}
+
+// caller must hold playersLock
+func (w *World) setAction(entity *Entity, action Action, duration time.Duration) {
+	entity.Action = action
+	entity.ActionEnds = 0
+	if duration > 0 {
+		entity.ActionEnds = w.Tick + ticks(duration)
+	}
+}
+
+// finishActions returns entities whose action is over to idle
+// caller must hold playersLock
+func (w *World) finishActions(ids []string) {
+	for _, id := range ids {
+		entity := w.entity(id)
+		if entity.ActionEnds != 0 && w.Tick >= entity.ActionEnds {
+			entity.Action = A_IDLE
+			entity.ActionEnds = 0
+		}
+	}
+}
+
+// the attack is resolved only by the authoritative world,
+// which then sends out the resulting EntityDamaged and EntityDied updates
+func (w *World) applyAttack(attack *EntityAttacked) error {
+	stats, ok := Attacks[attack.Action]
+	if !ok {
+		return fmt.Errorf("%v is not an attack", attack.Action)
+	}
+	// a NaN target would pass the arc check and fire a projectile nowhere
+	if !Finite(attack.Target) {
+		return fmt.Errorf("invalid attack target %v", attack.Target)
+	}
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	attacker, err := w.getActiveEntity(attack.ID)
+	if err != nil {
+		return err
+	}
+	if !attacker.Alive() {
+		return errors.New("entity "+attack.ID+" can not attack while dead", nil)
+	}
+	if w.authoritative && w.Tick < attacker.NextAttack {
+		return errors.New("entity "+attack.ID+" can not attack again yet", nil)
+	}
+	attacker.NextAttack = w.Tick + ticks(stats.Cooldown)
+	w.face(attacker, attack.Target.Sub(attacker.Position))
+	w.setAction(attacker, attack.Action, stats.Duration)
+	if !w.authoritative {
+		return nil
+	}
+	if stats.ProjectileSpeed > 0 {
+		w.fire(attacker, attack.Action, attack.Target, stats)
+		return nil
+	}
+	if target := w.attackTarget(attacker, attack.Target, stats); target != nil {
+		w.damage(target, attacker.ID, stats.Damage+attacker.Attack)
+	}
+	return nil
+}
+
+// attackTarget returns the nearest living entity the attack hits, if any
+// caller must hold playersLock
+func (w *World) attackTarget(attacker *Entity, aim pixel.Vec, stats Attack) *Entity {
+	direction := UnitVec(aim.Sub(attacker.Position))
+	var nearest *Entity
+	var nearestDistance float64
+	for _, id := range w.spatialIndex().QueryRadius(attacker.Position, stats.Range+attacker.Radius()) {
+		target := w.entity(id)
+		if target == attacker || target.MaxHealth == 0 || !target.Alive() {
+			continue
+		}
+		toTarget := target.Position.Sub(attacker.Position)
+		distance := toTarget.Len() - target.Radius()
+		if distance > stats.Range {
+			continue
+		}
+		// targets right on top of the attacker are always hit
+		if toTarget.Len() > target.Radius() && direction != pixel.ZV {
+			if math.Abs(toTarget.Angle()-direction.Angle()) > stats.Arc &&
+				2*math.Pi-math.Abs(toTarget.Angle()-direction.Angle()) > stats.Arc {
+				continue
+			}
+		}
+		if nearest == nil || distance < nearestDistance {
+			nearest = target
+			nearestDistance = distance
+		}
+	}
+	return nearest
+}
+
+// damage hurts target, killing it once it runs out of health
+// every hit does at least 1 damage, however good the target's defense
+// caller must hold playersLock
+func (w *World) damage(target *Entity, sourceID string, amount int) {
+	amount -= target.Defense
+	if amount < 1 {
+		amount = 1
+	}
+	target.Health -= amount
+	if target.Health < 0 {
+		target.Health = 0
+	}
+	w.finishUpdate(&Update{EntityDamaged: &EntityDamaged{
+		ID:       target.ID,
+		SourceID: sourceID,
+		Damage:   amount,
+		Health:   target.Health,
+	}})
+	if target.Alive() {
+		w.setAction(target, A_HURT, hurtDuration)
+		return
+	}
+	w.kill(target)
+	if killer, ok := w.Players[sourceID]; ok && target.Kind != E_PLAYER {
+		w.grantXP(killer, XP_KILL, target.XPReward)
+	}
+	if target.Kind == E_PLAYER {
+		w.died(target)
+	} else {
+		w.dropLoot(target, target.Items)
+		target.Items = nil
+		target.RespawnTick = w.Tick + ticks(npcRespawnDelay)
+	}
+	w.finishUpdate(&Update{EntityDied: &EntityDied{
+		ID:          target.ID,
+		SourceID:    sourceID,
+		RespawnTick: target.RespawnTick,
+	}})
+}
+
+// heal restores up to amount of entity's health
+// caller must hold playersLock
+func (w *World) heal(entity *Entity, amount int) {
+	entity.Health += amount
+	if entity.Health > entity.MaxHealth {
+		entity.Health = entity.MaxHealth
+	}
+	w.finishUpdate(&Update{EntityHealed: &EntityHealed{
+		ID:     entity.ID,
+		Amount: amount,
+		Health: entity.Health,
+	}})
+}
+
+// caller must hold playersLock
+func (w *World) kill(entity *Entity) {
+	entity.Health = 0
+	entity.Destination = entity.Position
+	w.setAction(entity, A_DEAD, 0)
+}
+
+func (w *World) applyDamaged(damaged *EntityDamaged) error {
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	entity, err := w.getActiveEntity(damaged.ID)
+	if err != nil {
+		return err
+	}
+	entity.Health = damaged.Health
+	if entity.Alive() {
+		w.setAction(entity, A_HURT, hurtDuration)
+	}
+	return nil
+}
+
+func (w *World) applyHealed(healed *EntityHealed) error {
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	entity, err := w.getActiveEntity(healed.ID)
+	if err != nil {
+		return err
+	}
+	entity.Health = healed.Health
+	return nil
+}
+
+func (w *World) applyDied(died *EntityDied) error {
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	entity, err := w.getActiveEntity(died.ID)
+	if err != nil {
+		return err
+	}
+	w.kill(entity)
+	entity.RespawnTick = died.RespawnTick
+	return nil
+}
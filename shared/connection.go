@@ -72,12 +72,13 @@ func Encode(e interface{}) ([]byte, error) {
 }
 
 func read(r io.Reader) ([]byte, error) {
+	// a single Read may return only part of a large message
 	sizeInBytes := make([]byte, 2)
-	if _, err := r.Read(sizeInBytes); err != nil {
+	if _, err := io.ReadFull(r, sizeInBytes); err != nil {
 		return nil, err
 	}
 	size := binary.BigEndian.Uint16(sizeInBytes)
 	data := make([]byte, size)
-	_, err := r.Read(data)
+	_, err := io.ReadFull(r, data)
 	return data, err
 }
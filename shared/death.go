@@ -0,0 +1,172 @@
+package shared
+
+import (
+	"math"
+	"time"
+
+	"github.com/faiface/pixel"
+	"github.com/ilackarms/pkg/errors"
+)
+
+// DeathRules configure what happens to players who die
+type DeathRules struct {
+	// time a dead player has to wait before respawning
+	RespawnDelay time.Duration
+	// fraction of max health players respawn with
+	RespawnHealth float64
+	// leave a bag of loot where the player died
+	DropLoot bool
+}
+
+// how long a killed npc stays dead before it comes back
+// where the map placed it
+const npcRespawnDelay = time.Second * 30
+
+var defaultDeathRules = DeathRules{
+	RespawnDelay:  time.Second * 5,
+	RespawnHealth: 1,
+}
+
+// deathRulesFile is the on-disk format of DeathRules
+// fields left out keep their default value
+type deathRulesFile struct {
+	// in seconds
+	RespawnDelay  *float64 `json:"respawnDelay"`
+	RespawnHealth *float64 `json:"respawnHealth"`
+	DropLoot      bool     `json:"dropLoot"`
+}
+
+func (f *deathRulesFile) rules() (DeathRules, error) {
+	rules := defaultDeathRules
+	if f == nil {
+		return rules, nil
+	}
+	if f.RespawnDelay != nil {
+		rules.RespawnDelay = time.Duration(*f.RespawnDelay * float64(time.Second))
+	}
+	if f.RespawnHealth != nil {
+		if *f.RespawnHealth <= 0 || *f.RespawnHealth > 1 {
+			return rules, errors.New("respawn health must be between 0 and 1", nil)
+		}
+		rules.RespawnHealth = *f.RespawnHealth
+	}
+	rules.DropLoot = f.DropLoot
+	return rules, nil
+}
+
+func (w *World) deathRules() DeathRules {
+	if w.Map == nil {
+		return defaultDeathRules
+	}
+	return w.Map.Death
+}
+
+// SpawnPoint picks where a player enters the world
+func (w *World) SpawnPoint() pixel.Vec {
+	if w.Map == nil {
+		return pixel.ZV
+	}
+	if spawn, ok := w.Map.RandomSpawnPoint(); ok {
+		return spawn
+	}
+	return w.Map.Bounds().Center()
+}
+
+// RespawnPoint picks the respawn point closest to where a player died
+func (w *World) RespawnPoint(died pixel.Vec) pixel.Vec {
+	if w.Map == nil || len(w.Map.RespawnPoints) == 0 {
+		return w.SpawnPoint()
+	}
+	nearest := w.Map.RespawnPoints[0]
+	for _, point := range w.Map.RespawnPoints[1:] {
+		if point.Sub(died).Len() < nearest.Sub(died).Len() {
+			nearest = point
+		}
+	}
+	return nearest
+}
+
+// died applies the death penalties to a player
+// that was just killed in the authoritative world
+// caller must hold playersLock
+func (w *World) died(player *Entity) {
+	rules := w.deathRules()
+	player.RespawnTick = w.Tick + ticks(rules.RespawnDelay)
+	if !rules.DropLoot {
+		return
+	}
+	carrier := w.Players[player.ID]
+	if len(carrier.Inventory) == 0 {
+		return
+	}
+	w.dropLoot(player, carrier.Inventory)
+	carrier.Inventory = nil
+	w.inventoryChanged(carrier)
+}
+
+func (w *World) applyRespawn(respawned *PlayerRespawned) error {
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	entity, err := w.getActiveEntity(respawned.ID)
+	if err != nil {
+		return err
+	}
+	if entity.Alive() {
+		return errors.New("entity "+respawned.ID+" is not dead", nil)
+	}
+	if w.authoritative && w.Tick < entity.RespawnTick {
+		return errors.New("entity "+respawned.ID+" can not respawn yet", nil)
+	}
+	w.respawn(entity, respawned.Position, int(math.Max(1, math.Floor(float64(entity.MaxHealth)*w.deathRules().RespawnHealth))))
+	return nil
+}
+
+func (w *World) applyEntityRespawned(respawned *EntityRespawned) error {
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	entity, err := w.getActiveEntity(respawned.ID)
+	if err != nil {
+		return err
+	}
+	if entity.Kind == E_PLAYER {
+		return errors.New("players must respawn with PlayerRespawned", nil)
+	}
+	if entity.Alive() {
+		return errors.New("entity "+respawned.ID+" is not dead", nil)
+	}
+	w.respawn(entity, respawned.Position, entity.MaxHealth)
+	return nil
+}
+
+// caller must hold playersLock
+func (w *World) respawn(entity *Entity, position pixel.Vec, health int) {
+	entity.Health = health
+	entity.Destination = position
+	entity.RespawnTick = 0
+	w.setAction(entity, A_IDLE, 0)
+	w.setPosition(entity, position)
+}
+
+// respawnNPCs brings back the npcs of the map whose time has come,
+// with the loot and behavior they started with
+// caller must hold playersLock
+func (w *World) respawnNPCs() {
+	if w.Map == nil {
+		return
+	}
+	for _, npc := range w.Map.NPCs {
+		entity, ok := w.Entities[npc.ID]
+		if !ok || !entity.Active || entity.Alive() || w.Tick < entity.RespawnTick {
+			continue
+		}
+		entity.Items = copyStacks(npc.Items)
+		if npc.Behavior != nil {
+			entity.Behavior = npc.Behavior.DeepCopy()
+		}
+		w.respawn(entity, npc.Position, entity.MaxHealth)
+		w.finishUpdate(&Update{EntityRespawned: &EntityRespawned{
+			ID:       entity.ID,
+			Position: npc.Position,
+		}})
+	}
+}
@@ -0,0 +1,79 @@
+package shared
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/faiface/pixel"
+)
+
+func TestKilledNPCRespawns(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	tileMap, err := LoadTileMap("../server/maps/overworld.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	npc := tileMap.NPCs[0]
+	w := NewWorld(tileMap)
+	w.SetAuthoritative()
+	respawned := make(chan *EntityRespawned, 1)
+	go func() {
+		for update := range w.ProcessedUpdates() {
+			if update.EntityRespawned != nil {
+				respawned <- update.EntityRespawned
+			}
+		}
+	}()
+	if err := w.ApplyUpdates(
+		&Update{AddEntity: &AddEntity{Entity: npc}},
+		&Update{AddPlayer: &AddPlayer{ID: "player", Position: npc.Position.Add(pixel.V(1, 0))}},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	w.playersLock.Lock()
+	entity := w.entity(npc.ID)
+	player := w.entity("player")
+	if w.blockingEntity(player, pixel.V(-0.1, 0)) != entity {
+		t.Fatal("expected the living npc to block the player")
+	}
+	w.damage(entity, "player", entity.MaxHealth+entity.Defense)
+	if entity.Alive() || len(entity.Items) != 0 {
+		t.Fatalf("expected the npc to be dead and looted, got health %v and items %v", entity.Health, entity.Items)
+	}
+	if blocker := w.blockingEntity(player, pixel.V(-0.1, 0)); blocker != nil {
+		t.Fatalf("expected the dead npc not to block the player, got %v", blocker.ID)
+	}
+	w.playersLock.Unlock()
+
+	due := w.Tick + ticks(npcRespawnDelay)
+	for !entity.Alive() && w.Tick < due {
+		if err := w.Step(); err != nil {
+			t.Fatal(err)
+		}
+		if entity.Alive() && w.Tick < due {
+			t.Fatalf("npc respawned early at tick %v, expected %v", w.Tick, due)
+		}
+	}
+	if !entity.Alive() {
+		t.Fatalf("npc did not respawn at tick %v", due)
+	}
+	// it may have taken its first step already
+	if entity.Health != entity.MaxHealth || !WithinRange(entity.Position, npc.Position, entity.Speed*TickDuration.Seconds()) ||
+		len(entity.Items) != len(npc.Items) {
+		t.Fatalf("expected npc to come back as placed, got health %v at %v with %v", entity.Health, entity.Position, entity.Items)
+	}
+	select {
+	case update := <-respawned:
+		if update.ID != npc.ID || update.Position != npc.Position {
+			t.Fatalf("unexpected %#v", update)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the respawn to be sent out")
+	}
+}
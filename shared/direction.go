@@ -51,6 +51,24 @@ func (d Direction) String() string {
 	}
 }
 
+// Directions lists every direction an entity can face
+var Directions = []Direction{LEFT, RIGHT, UP, DOWN, UPLEFT, UPRIGHT, DOWNLEFT, DOWNRIGHT}
+
+// MarshalText lets directions be written by name in data files
+func (d Direction) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Direction) UnmarshalText(text []byte) error {
+	for _, dir := range Directions {
+		if dir.String() == string(text) {
+			*d = dir
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown direction %q", text)
+}
+
 func (d Direction) ToVec() pixel.Vec {
 	switch d {
 	case LEFT:
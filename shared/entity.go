@@ -0,0 +1,249 @@
+package shared
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/faiface/pixel"
+	"github.com/ilackarms/pkg/errors"
+)
+
+// EntityKind describes what an entity is
+type EntityKind byte
+
+const (
+	E_PLAYER EntityKind = iota
+	E_NPC
+	E_LOOT
+	E_OBJECT
+)
+
+func (k EntityKind) String() string {
+	switch k {
+	case E_PLAYER:
+		return "player"
+	case E_NPC:
+		return "npc"
+	case E_LOOT:
+		return "loot"
+	case E_OBJECT:
+		return "object"
+	default:
+		return fmt.Sprintf("invalid entity kind: %v", int(k))
+	}
+}
+
+// Entity is anything that exists in the world
+// Players embed an Entity; every other kind of entity
+// is stored in World.Entities
+type Entity struct {
+	// global unique ID, shared by all kinds of entities
+	ID   string
+	Kind EntityKind
+	// cartesian coordinates
+	Position    pixel.Vec
+	Destination pixel.Vec
+	// speed is the magnitude of entity's velocity
+	// in any direction of movement
+	Speed float64
+	// size in 2 dimensions (x=w, y=h)
+	Size pixel.Vec
+	// solid entities can not walk through each other
+	Solid bool
+	// if set to false, entity is treated as though it has been deleted
+	// this allows us to activate/deactivate entities without deleting from state
+	Active bool
+	// health is only tracked for entities with MaxHealth > 0
+	Health    int
+	MaxHealth int
+	// see Stats
+	Attack  int
+	Defense int
+	// experience for killing the entity
+	// 0 gives the kill reward of the progression table
+	XPReward int `,omitempty`
+	// what the entity is currently doing, e.g. walking, attacking or dying
+	Action Action
+	// direction the entity last walked or attacked in
+	Facing Direction
+	// tick at which Action is over; 0 if it lasts until changed
+	ActionEnds uint64
+	// tick before which the entity can not attack again
+	NextAttack uint64
+	// tick from which a dead player may respawn, or at which a dead npc comes back
+	RespawnTick uint64
+	// contents of loot bags, and what npcs drop when killed
+	Items []ItemStack `,omitempty`
+	// ai of npcs; nil for entities that are not controlled by the server
+	Behavior *Behavior `,omitempty`
+}
+
+func (e *Entity) DeepCopy() *Entity {
+	cpy := *e
+	cpy.Items = copyStacks(e.Items)
+	if e.Behavior != nil {
+		cpy.Behavior = e.Behavior.DeepCopy()
+	}
+	return &cpy
+}
+
+// Hitbox returns the area occupied by the entity
+func (e *Entity) Hitbox() pixel.Rect {
+	return RectFromCenter(e.Position, e.Size.X, e.Size.Y)
+}
+
+// Radius is used for collisions between entities,
+// which collide as circles that fit in their hitbox
+func (e *Entity) Radius() float64 {
+	return math.Min(e.Size.X, e.Size.Y) / 2
+}
+
+// GetEntity returns a reference to any entity, including players
+// Objects returned by GetEntity should be read-only
+func (w *World) GetEntity(id string) (*Entity, bool) {
+	w.playersLock.RLock()
+	defer w.playersLock.RUnlock()
+	entity := w.entity(id)
+	return entity, entity != nil
+}
+
+// ForEachEntity calls f on each entity in the world, including players
+// This is intended for reading only
+func (w *World) ForEachEntity(f func(entity *Entity)) {
+	w.playersLock.RLock()
+	defer w.playersLock.RUnlock()
+	for _, player := range w.Players {
+		f(&player.Entity)
+	}
+	for _, entity := range w.Entities {
+		f(entity)
+	}
+}
+
+// entity looks up players and other entities by id
+// returns nil if there is no such entity
+// caller must hold playersLock
+func (w *World) entity(id string) *Entity {
+	if player, ok := w.Players[id]; ok {
+		return &player.Entity
+	}
+	return w.Entities[id]
+}
+
+// returns the IDs of active entities in sorted order
+// caller must hold playersLock
+func (w *World) activeEntityIDs() []string {
+	ids := make([]string, 0, len(w.Players)+len(w.Entities))
+	for id, player := range w.Players {
+		if player.Active {
+			ids = append(ids, id)
+		}
+	}
+	for id, entity := range w.Entities {
+		if entity.Active {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (w *World) addEntity(added *AddEntity) error {
+	if added.Entity == nil {
+		return errors.New("no entity given to add", nil)
+	}
+	if added.Entity.Kind == E_PLAYER {
+		return errors.New("players must be added with AddPlayer", nil)
+	}
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	id := added.Entity.ID
+	if w.entity(id) != nil {
+		return errors.New("entity "+id+" already exists!", nil)
+	}
+	if w.Entities == nil {
+		w.Entities = make(map[string]*Entity)
+	}
+	entity := added.Entity.DeepCopy()
+	entity.Active = true
+	w.Entities[id] = entity
+	w.spatialIndex().Insert(id, entity.Hitbox())
+	return nil
+}
+
+func (w *World) updateEntityDestination(dest *EntityDestination) error {
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	entity, err := w.getActiveEntity(dest.ID)
+	if err != nil {
+		return err
+	}
+	entity.Destination = dest.Destination
+	return nil
+}
+
+func (w *World) updateEntityPosition(moved *EntityPosition) error {
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	entity, err := w.getActiveEntity(moved.ID)
+	if err != nil {
+		return err
+	}
+	w.setPosition(entity, moved.Position)
+	w.setMotion(entity, moved.Facing, moved.Walking)
+	return nil
+}
+
+// face turns entity towards v, if v points anywhere
+// caller must hold playersLock
+func (w *World) face(entity *Entity, v pixel.Vec) {
+	if facing := UnitToDirection(UnitVec(v)); facing != DIR_NONE {
+		entity.Facing = facing
+	}
+}
+
+// setMotion sets the facing of entity and switches it between walking and
+// standing still. other actions, such as attacking, are left alone
+// returns whether anything changed
+// caller must hold playersLock
+func (w *World) setMotion(entity *Entity, facing Direction, walking bool) bool {
+	changed := false
+	if facing != DIR_NONE && facing != entity.Facing {
+		entity.Facing = facing
+		changed = true
+	}
+	action := A_IDLE
+	if walking {
+		action = A_WALK
+	}
+	if (entity.Action == A_IDLE || entity.Action == A_WALK) && entity.Action != action {
+		w.setAction(entity, action, 0)
+		changed = true
+	}
+	return changed
+}
+
+// entities other than players are deleted for good
+func (w *World) applyRemoveEntity(removed *RemoveEntity) error {
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	if _, ok := w.Entities[removed.ID]; !ok {
+		return errors.New("entity "+removed.ID+" requested but not found", nil)
+	}
+	delete(w.Entities, removed.ID)
+	w.spatialIndex().Remove(removed.ID)
+	return nil
+}
+
+// caller must hold playersLock
+func (w *World) getActiveEntity(id string) (*Entity, error) {
+	entity := w.entity(id)
+	if entity == nil {
+		return nil, errors.New("entity "+id+" requested but not found", nil)
+	}
+	if !entity.Active {
+		return nil, errors.New("entity "+id+" requested but inactive", nil)
+	}
+	return entity, nil
+}
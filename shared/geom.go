@@ -31,6 +31,16 @@ func UnitVec(v pixel.Vec) pixel.Vec {
 	return v.Unit()
 }
 
+// ClampVec returns the point of rect closest to v
+func ClampVec(v pixel.Vec, rect pixel.Rect) pixel.Vec {
+	return pixel.V(Clamp(v.X, rect.Min.X, rect.Max.X), Clamp(v.Y, rect.Min.Y, rect.Max.Y))
+}
+
+// Finite returns false if either coordinate of v is NaN or infinite
+func Finite(v pixel.Vec) bool {
+	return !math.IsNaN(v.X) && !math.IsNaN(v.Y) && !math.IsInf(v.X, 0) && !math.IsInf(v.Y, 0)
+}
+
 // RoundVec rounds the X and Y components of v
 // within precision decimal places (e.g. 0 for integer rounding)
 func RoundVec(v pixel.Vec, precision int) pixel.Vec {
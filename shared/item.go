@@ -0,0 +1,299 @@
+package shared
+
+import (
+	"fmt"
+
+	"github.com/ilackarms/pkg/errors"
+)
+
+const (
+	// number of stacks a player can carry
+	inventorySize = 20
+	// how close a player has to be to pick up loot
+	pickupRange = 1.5
+)
+
+// ItemDef describes one kind of item
+type ItemDef struct {
+	Name string
+	// how many of the item fit in one inventory slot
+	MaxStack int
+	// health restored when the item is used; items without
+	// an effect can not be used
+	Heal int
+	// where the item is worn; empty for items that can not be equipped
+	Slot EquipSlot
+	// bonus to the stats of the player wearing the item
+	Stats Stats
+}
+
+// Items lists every kind of item by ID
+var Items = map[string]ItemDef{
+	"gold":          {Name: "gold coin", MaxStack: 1000},
+	"bread":         {Name: "bread", MaxStack: 20, Heal: 10},
+	"health-potion": {Name: "health potion", MaxStack: 10, Heal: 40},
+	"short-sword": {Name: "short sword", MaxStack: 1, Slot: SLOT_WEAPON,
+		Stats: Stats{Attack: 5}},
+	"leather-cap": {Name: "leather cap", MaxStack: 1, Slot: SLOT_HEAD,
+		Stats: Stats{MaxHealth: 10, Defense: 1}},
+	"chainmail": {Name: "chainmail", MaxStack: 1, Slot: SLOT_BODY,
+		Stats: Stats{Defense: 5, Speed: -0.3}},
+	"leather-boots": {Name: "leather boots", MaxStack: 1, Slot: SLOT_FEET,
+		Stats: Stats{Speed: 0.5}},
+}
+
+// ItemStack is a number of items of the same kind
+type ItemStack struct {
+	Item  string
+	Count int
+}
+
+func (s ItemStack) String() string {
+	if def, ok := Items[s.Item]; ok {
+		return fmt.Sprintf("%v %s", s.Count, def.Name)
+	}
+	return fmt.Sprintf("%v %s", s.Count, s.Item)
+}
+
+func copyStacks(stacks []ItemStack) []ItemStack {
+	if stacks == nil {
+		return nil
+	}
+	cpy := make([]ItemStack, len(stacks))
+	copy(cpy, stacks)
+	return cpy
+}
+
+// Inventory holds the items carried by a player, one stack per slot
+type Inventory []ItemStack
+
+func (inv Inventory) DeepCopy() Inventory {
+	return Inventory(copyStacks(inv))
+}
+
+// Count returns how many of item are in the inventory
+func (inv Inventory) Count(item string) int {
+	count := 0
+	for _, stack := range inv {
+		if stack.Item == item {
+			count += stack.Count
+		}
+	}
+	return count
+}
+
+// Add puts all of stacks in the inventory
+// if they do not all fit, the inventory is left unchanged
+func (inv *Inventory) Add(stacks ...ItemStack) error {
+	added := inv.DeepCopy()
+	for _, stack := range stacks {
+		def, ok := Items[stack.Item]
+		if !ok {
+			return errors.New("unknown item "+stack.Item, nil)
+		}
+		if stack.Count <= 0 {
+			return errors.New("can not add "+stack.String(), nil)
+		}
+		left := stack.Count
+		for i := range added {
+			if added[i].Item != stack.Item || added[i].Count >= def.MaxStack {
+				continue
+			}
+			n := minInt(left, def.MaxStack-added[i].Count)
+			added[i].Count += n
+			left -= n
+		}
+		for left > 0 {
+			if len(added) >= inventorySize {
+				return errors.New("inventory is full", nil)
+			}
+			n := minInt(left, def.MaxStack)
+			added = append(added, ItemStack{Item: stack.Item, Count: n})
+			left -= n
+		}
+	}
+	*inv = added
+	return nil
+}
+
+// Remove takes count of item out of the inventory
+// if there are not enough, the inventory is left unchanged
+func (inv *Inventory) Remove(item string, count int) error {
+	if count <= 0 || inv.Count(item) < count {
+		return errors.New(fmt.Sprintf("not carrying %v %s", count, item), nil)
+	}
+	var left Inventory
+	// take from the last stacks first
+	for i := len(*inv) - 1; i >= 0; i-- {
+		stack := (*inv)[i]
+		if stack.Item == item && count > 0 {
+			n := minInt(count, stack.Count)
+			stack.Count -= n
+			count -= n
+		}
+		if stack.Count > 0 {
+			left = append(Inventory{stack}, left...)
+		}
+	}
+	*inv = left
+	return nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// PlayerRecord is the part of a player that is kept between sessions
+type PlayerRecord struct {
+	Inventory Inventory
+	Equipment Equipment
+	Progress  `,inline`
+	// with the level, the only part of the record that other players can see
+	Appearance Appearance
+}
+
+func (r *PlayerRecord) DeepCopy() *PlayerRecord {
+	return &PlayerRecord{
+		Inventory:  r.Inventory.DeepCopy(),
+		Equipment:  r.Equipment.DeepCopy(),
+		Progress:   r.Progress.DeepCopy(),
+		Appearance: r.Appearance,
+	}
+}
+
+// dropLoot leaves items in a bag at the position of dropper
+// caller must hold playersLock
+func (w *World) dropLoot(dropper *Entity, items []ItemStack) {
+	if len(items) == 0 {
+		return
+	}
+	id := fmt.Sprintf("loot-%s-%v", dropper.ID, w.Tick)
+	for n := 1; w.entity(id) != nil; n++ {
+		id = fmt.Sprintf("loot-%s-%v-%v", dropper.ID, w.Tick, n)
+	}
+	loot := &Entity{
+		ID:          id,
+		Kind:        E_LOOT,
+		Position:    dropper.Position,
+		Destination: dropper.Position,
+		Size:        defaultSize.Scaled(0.5),
+		Active:      true,
+		Items:       copyStacks(items),
+	}
+	w.Entities[loot.ID] = loot
+	w.spatialIndex().Insert(loot.ID, loot.Hitbox())
+	w.finishUpdate(&Update{AddEntity: &AddEntity{Entity: loot.DeepCopy()}})
+}
+
+// inventoryChanged tells the owner of inventory what it holds now
+// caller must hold playersLock
+func (w *World) inventoryChanged(player *Player) {
+	w.finishUpdate(&Update{InventoryChanged: &InventoryChanged{
+		ID:        player.ID,
+		Inventory: player.Inventory.DeepCopy(),
+		Equipment: player.Equipment.DeepCopy(),
+	}})
+}
+
+// the item updates below are only resolved by the authoritative world,
+// which sends out their effects as separate updates
+
+func (w *World) applyItemPickedUp(pickup *ItemPickedUp) error {
+	if !w.authoritative {
+		return nil
+	}
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	player, err := w.getLivingPlayer(pickup.ID)
+	if err != nil {
+		return err
+	}
+	loot, ok := w.Entities[pickup.LootID]
+	if !ok || loot.Kind != E_LOOT {
+		return errors.New("no loot "+pickup.LootID+" to pick up", nil)
+	}
+	if !WithinRange(player.Position, loot.Position, pickupRange) {
+		return errors.New("loot "+pickup.LootID+" is too far away", nil)
+	}
+	if err := player.Inventory.Add(loot.Items...); err != nil {
+		return errors.New("can not pick up "+pickup.LootID, err)
+	}
+	delete(w.Entities, loot.ID)
+	w.spatialIndex().Remove(loot.ID)
+	w.finishUpdate(&Update{RemoveEntity: &RemoveEntity{ID: loot.ID}})
+	w.inventoryChanged(player)
+	return nil
+}
+
+func (w *World) applyItemDropped(drop *ItemDropped) error {
+	if !w.authoritative {
+		return nil
+	}
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	player, err := w.getLivingPlayer(drop.ID)
+	if err != nil {
+		return err
+	}
+	if err := player.Inventory.Remove(drop.Item, drop.Count); err != nil {
+		return err
+	}
+	w.dropLoot(&player.Entity, []ItemStack{{Item: drop.Item, Count: drop.Count}})
+	w.inventoryChanged(player)
+	return nil
+}
+
+func (w *World) applyItemUsed(use *ItemUsed) error {
+	if !w.authoritative {
+		return nil
+	}
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	player, err := w.getLivingPlayer(use.ID)
+	if err != nil {
+		return err
+	}
+	def, ok := Items[use.Item]
+	if !ok || def.Heal == 0 {
+		return errors.New("item "+use.Item+" can not be used", nil)
+	}
+	if err := player.Inventory.Remove(use.Item, 1); err != nil {
+		return err
+	}
+	w.heal(&player.Entity, def.Heal)
+	w.inventoryChanged(player)
+	return nil
+}
+
+func (w *World) applyInventoryChanged(changed *InventoryChanged) error {
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	player, ok := w.Players[changed.ID]
+	if !ok {
+		return errors.New("player "+changed.ID+" requested but not found", nil)
+	}
+	player.Inventory = changed.Inventory.DeepCopy()
+	player.Equipment = changed.Equipment.DeepCopy()
+	if w.authoritative {
+		w.updateStats(player)
+	}
+	return nil
+}
+
+// caller must hold playersLock
+func (w *World) getLivingPlayer(id string) (*Player, error) {
+	player, ok := w.Players[id]
+	if !ok {
+		return nil, errors.New("player "+id+" requested but not found", nil)
+	}
+	if !player.Active {
+		return nil, errors.New("player "+id+" requested but inactive", nil)
+	}
+	if !player.Alive() {
+		return nil, errors.New("player "+id+" is dead", nil)
+	}
+	return player, nil
+}
@@ -0,0 +1,154 @@
+package shared
+
+import (
+	"fmt"
+	"testing"
+)
+
+// fullInventory returns an inventory with every slot taken by a full stack of gold
+func fullInventory() Inventory {
+	var inv Inventory
+	for i := 0; i < inventorySize; i++ {
+		inv = append(inv, ItemStack{Item: "gold", Count: Items["gold"].MaxStack})
+	}
+	return inv
+}
+
+func TestInventoryAdd(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		inv    Inventory
+		add    []ItemStack
+		expect Inventory
+		fails  bool
+	}{
+		{
+			name:   "empty",
+			add:    []ItemStack{{"bread", 3}},
+			expect: Inventory{{"bread", 3}},
+		},
+		{
+			name:   "fills existing stack first",
+			inv:    Inventory{{"bread", 18}, {"gold", 1}},
+			add:    []ItemStack{{"bread", 5}},
+			expect: Inventory{{"bread", 20}, {"gold", 1}, {"bread", 3}},
+		},
+		{
+			name:   "splits over max stack",
+			add:    []ItemStack{{"health-potion", 25}},
+			expect: Inventory{{"health-potion", 10}, {"health-potion", 10}, {"health-potion", 5}},
+		},
+		{
+			name:   "several stacks",
+			inv:    Inventory{{"gold", 10}},
+			add:    []ItemStack{{"gold", 5}, {"short-sword", 1}, {"short-sword", 1}},
+			expect: Inventory{{"gold", 15}, {"short-sword", 1}, {"short-sword", 1}},
+		},
+		{
+			name:  "unknown item",
+			inv:   Inventory{{"gold", 10}},
+			add:   []ItemStack{{"bread", 1}, {"dragon", 1}},
+			fails: true,
+		},
+		{
+			name:  "no items",
+			inv:   Inventory{{"gold", 10}},
+			add:   []ItemStack{{"gold", 0}},
+			fails: true,
+		},
+		{
+			name:  "full",
+			inv:   fullInventory(),
+			add:   []ItemStack{{"gold", 1}},
+			fails: true,
+		},
+		{
+			name:  "last stack does not fit",
+			inv:   fullInventory()[1:],
+			add:   []ItemStack{{"bread", 1}, {"leather-cap", 1}},
+			fails: true,
+		},
+	} {
+		before := fmt.Sprint(test.inv)
+		inv := test.inv.DeepCopy()
+		err := inv.Add(test.add...)
+		switch {
+		case test.fails && err == nil:
+			t.Errorf("%s: expected adding %v to fail, got %v", test.name, test.add, inv)
+		case test.fails && fmt.Sprint(inv) != before:
+			t.Errorf("%s: expected failed add to leave %v unchanged, got %v", test.name, before, inv)
+		case !test.fails && err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case !test.fails && fmt.Sprint(inv) != fmt.Sprint(test.expect):
+			t.Errorf("%s: expected %v, got %v", test.name, test.expect, inv)
+		}
+	}
+}
+
+func TestInventoryRemove(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		inv    Inventory
+		item   string
+		count  int
+		expect Inventory
+		fails  bool
+	}{
+		{
+			name:   "part of a stack",
+			inv:    Inventory{{"bread", 5}},
+			item:   "bread",
+			count:  2,
+			expect: Inventory{{"bread", 3}},
+		},
+		{
+			name:   "whole stack",
+			inv:    Inventory{{"bread", 5}, {"gold", 3}},
+			item:   "bread",
+			count:  5,
+			expect: Inventory{{"gold", 3}},
+		},
+		{
+			name:   "last stacks first",
+			inv:    Inventory{{"health-potion", 10}, {"gold", 3}, {"health-potion", 4}},
+			item:   "health-potion",
+			count:  6,
+			expect: Inventory{{"health-potion", 8}, {"gold", 3}},
+		},
+		{
+			name:  "not enough",
+			inv:   Inventory{{"bread", 5}, {"bread", 2}},
+			item:  "bread",
+			count: 8,
+			fails: true,
+		},
+		{
+			name:  "not carried",
+			inv:   Inventory{{"bread", 5}},
+			item:  "gold",
+			count: 1,
+			fails: true,
+		},
+		{
+			name:  "nothing",
+			inv:   Inventory{{"bread", 5}},
+			item:  "bread",
+			count: 0,
+			fails: true,
+		},
+	} {
+		before := fmt.Sprint(test.inv)
+		inv := test.inv.DeepCopy()
+		err := inv.Remove(test.item, test.count)
+		switch {
+		case test.fails && err == nil:
+			t.Errorf("%s: expected removing %v %s to fail, got %v", test.name, test.count, test.item, inv)
+		case test.fails && fmt.Sprint(inv) != before:
+			t.Errorf("%s: expected failed remove to leave %v unchanged, got %v", test.name, before, inv)
+		case !test.fails && err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case !test.fails && fmt.Sprint(inv) != fmt.Sprint(test.expect):
+			t.Errorf("%s: expected %v, got %v", test.name, test.expect, inv)
+		}
+	}
+}
@@ -21,14 +21,59 @@ type Update struct {
 	PlayerPosition    *PlayerPosition    `,omitempty`
 	PlayerSpoke       *PlayerSpoke       `,omitempty`
 	WorldState        *WorldState        `,omitempty`
+	PlayerSynced      *PlayerSynced      `,omitempty`
 	RemovePlayer      *RemovePlayer      `,omitempty`
+	PlayerPortaled    *PlayerPortaled    `,omitempty`
+	AddEntity         *AddEntity         `,omitempty`
+	EntityDestination *EntityDestination `,omitempty`
+	EntityPosition    *EntityPosition    `,omitempty`
+	RemoveEntity      *RemoveEntity      `,omitempty`
+	EntityAttacked    *EntityAttacked    `,omitempty`
+	EntityDamaged     *EntityDamaged     `,omitempty`
+	EntityDied        *EntityDied        `,omitempty`
+	ProjectileSpawned *ProjectileSpawned `,omitempty`
+	ProjectileImpact  *ProjectileImpact  `,omitempty`
+	PlayerRespawned   *PlayerRespawned   `,omitempty`
+	EntityRespawned   *EntityRespawned   `,omitempty`
+	EntityHealed      *EntityHealed      `,omitempty`
+	ItemPickedUp      *ItemPickedUp      `,omitempty`
+	ItemDropped       *ItemDropped       `,omitempty`
+	ItemUsed          *ItemUsed          `,omitempty`
+	InventoryChanged  *InventoryChanged  `,omitempty`
+	ItemEquipped      *ItemEquipped      `,omitempty`
+	ItemUnequipped    *ItemUnequipped    `,omitempty`
+	StatsChanged      *StatsChanged      `,omitempty`
+	ExperienceGained  *ExperienceGained  `,omitempty`
+	ExperienceChanged *ExperienceChanged `,omitempty`
+	LevelUp           *LevelUp           `,omitempty`
+	TradeRequested    *TradeRequested    `,omitempty`
+	TradeAccepted     *TradeAccepted     `,omitempty`
+	TradeOffered      *TradeOffered      `,omitempty`
+	TradeConfirmed    *TradeConfirmed    `,omitempty`
+	TradeCancelled    *TradeCancelled    `,omitempty`
+	TradeChanged      *TradeChanged      `,omitempty`
+	TradeClosed       *TradeClosed       `,omitempty`
 	Processed         time.Time
+	// world tick at which the update was processed
+	Tick uint64
 }
 
 type Request struct {
-	ConnectRequest *ConnectRequest `,omitempty`
-	MoveRequest    *MoveRequest    `,omitempty`
-	SpeakRequest   *SpeakRequest   `,omitempty`
+	ConnectRequest      *ConnectRequest      `,omitempty`
+	MoveRequest         *MoveRequest         `,omitempty`
+	SpeakRequest        *SpeakRequest        `,omitempty`
+	AttackRequest       *AttackRequest       `,omitempty`
+	RespawnRequest      *RespawnRequest      `,omitempty`
+	PickupRequest       *PickupRequest       `,omitempty`
+	DropRequest         *DropRequest         `,omitempty`
+	UseRequest          *UseRequest          `,omitempty`
+	EquipRequest        *EquipRequest        `,omitempty`
+	UnequipRequest      *UnequipRequest      `,omitempty`
+	TradeRequest        *TradeRequest        `,omitempty`
+	TradeAcceptRequest  *TradeAcceptRequest  `,omitempty`
+	TradeOfferRequest   *TradeOfferRequest   `,omitempty`
+	TradeConfirmRequest *TradeConfirmRequest `,omitempty`
+	TradeCancelRequest  *TradeCancelRequest  `,omitempty`
 }
 
 type Error struct {
@@ -37,33 +82,124 @@ type Error struct {
 
 type ConnectRequest struct {
 	ID string
+	// look of the character, if it is new
+	Appearance *Appearance `,omitempty`
 }
 
-type Ping struct{}
+type Ping struct {
+	// echoed in the Pong, so that a late answer to an earlier ping
+	// is not mistaken for this one
+	Seq uint64 `,omitempty`
+}
 
-type Pong struct{}
+type Pong struct {
+	Seq uint64 `,omitempty`
+}
 
 type MoveRequest struct {
 	Destination pixel.Vec
+	// numbered by the client, starting at 1, so that it can tell
+	// which of its moves the server has applied
+	Seq uint64 `,omitempty`
 }
 
 type SpeakRequest struct {
 	Text string
 }
 
+// AttackRequest attacks towards Target using one of the Attacks
+type AttackRequest struct {
+	Action Action
+	Target pixel.Vec
+}
+
+// RespawnRequest brings a dead player back to life
+// once their respawn delay has passed
+type RespawnRequest struct{}
+
+// PickupRequest picks up all items in a loot bag
+type PickupRequest struct {
+	LootID string
+}
+
+type DropRequest struct {
+	Item  string
+	Count int
+}
+
+type UseRequest struct {
+	Item string
+}
+
+// EquipRequest wears an item from the inventory,
+// putting whatever was worn in its slot back in the inventory
+type EquipRequest struct {
+	Item string
+}
+
+type UnequipRequest struct {
+	Slot EquipSlot
+}
+
+// TradeRequest asks a nearby player to trade
+type TradeRequest struct {
+	With string
+}
+
+// TradeAcceptRequest accepts the trade asked for by another player
+type TradeAcceptRequest struct {
+	With string
+}
+
+// TradeOfferRequest replaces what the player gives in the open trade
+type TradeOfferRequest struct {
+	Offer []ItemStack
+}
+
+// TradeConfirmRequest agrees to the trade as it is now
+type TradeConfirmRequest struct{}
+
+// TradeCancelRequest ends or declines every trade of the player
+type TradeCancelRequest struct{}
+
 type AddPlayer struct {
 	ID       string
 	Position pixel.Vec
+	// health carried over from another zone
+	// players entering the game start with full health
+	Health int `,omitempty`
+	// DefaultAppearance is used if no body is given
+	Appearance Appearance
+	// level of returning players, so that everyone sees it
+	// new players start at level 1
+	Level int `,omitempty`
+}
+
+// PlayerPortaled is produced by the authoritative world when a player
+// walks into a portal. it is handled by the server, which moves the
+// player to the other zone; clients never receive it
+type PlayerPortaled struct {
+	ID string
+	// zone the player goes to and where it comes out there
+	Zone     string
+	Position pixel.Vec
 }
 
 type PlayerDestination struct {
 	ID          string
 	Destination pixel.Vec
+	// Seq of the MoveRequest, if the update came from one
+	Seq uint64 `,omitempty`
 }
 
 type PlayerPosition struct {
 	ID       string
 	Position pixel.Vec
+	Facing   Direction
+	Walking  bool
+	// see Player.Ack
+	Ack     uint64 `,omitempty`
+	AckTick uint64 `,omitempty`
 }
 
 type PlayerSpoke struct {
@@ -75,10 +211,242 @@ type WorldState struct {
 	World *World
 }
 
+// PlayerSynced adds another player to the world of a player being synced
+// the world of its WorldState has no other players; they follow one at a time
+// so that the message does not outgrow the frame limit in a crowded zone
+type PlayerSynced struct {
+	Player *Player
+}
+
 type RemovePlayer struct {
 	ID string
 }
 
+// AddEntity spawns an entity that is not a player
+type AddEntity struct {
+	Entity *Entity
+}
+
+type EntityDestination struct {
+	ID          string
+	Destination pixel.Vec
+}
+
+type EntityPosition struct {
+	ID       string
+	Position pixel.Vec
+	Facing   Direction
+	Walking  bool
+}
+
+type RemoveEntity struct {
+	ID string
+}
+
+type EntityAttacked struct {
+	ID     string
+	Action Action
+	Target pixel.Vec
+}
+
+type EntityDamaged struct {
+	ID       string
+	SourceID string
+	Damage   int
+	// health left after the damage
+	Health int
+}
+
+type EntityDied struct {
+	ID       string
+	SourceID string
+	// tick from which a dead player may respawn,
+	// or at which a dead npc is brought back
+	RespawnTick uint64
+}
+
+type PlayerRespawned struct {
+	ID       string
+	Position pixel.Vec
+}
+
+// EntityRespawned brings back a killed npc with full health
+type EntityRespawned struct {
+	ID       string
+	Position pixel.Vec
+}
+
+type EntityHealed struct {
+	ID     string
+	Amount int
+	// health after healing
+	Health int
+}
+
+type ItemPickedUp struct {
+	ID     string
+	LootID string
+}
+
+type ItemDropped struct {
+	ID    string
+	Item  string
+	Count int
+}
+
+type ItemUsed struct {
+	ID   string
+	Item string
+}
+
+// InventoryChanged is only sent to the player who owns the inventory
+type InventoryChanged struct {
+	ID        string
+	Inventory Inventory
+	Equipment Equipment
+}
+
+type ItemEquipped struct {
+	ID   string
+	Item string
+}
+
+type ItemUnequipped struct {
+	ID   string
+	Slot EquipSlot
+}
+
+// StatsChanged is sent to the whole zone, so that everyone
+// knows the stats and level of every player
+type StatsChanged struct {
+	ID    string
+	Stats Stats
+	// health after the change of max health
+	Health int
+	Level  int
+}
+
+// ExperienceGained is applied by the server to reward a player,
+// e.g. for finishing a quest. Amount 0 gives the reward of the
+// progression table for Source
+type ExperienceGained struct {
+	ID     string
+	Source XPSource
+	Amount int
+}
+
+// ExperienceChanged is only sent to the player who gained experience
+type ExperienceChanged struct {
+	ID       string
+	Progress Progress
+}
+
+// LevelUp shows the players near the one who leveled up an effect
+// everyone else learns the new level from the StatsChanged sent with it
+type LevelUp struct {
+	ID       string
+	Level    int
+	Position pixel.Vec
+}
+
+type TradeRequested struct {
+	ID   string
+	With string
+}
+
+type TradeAccepted struct {
+	ID   string
+	With string
+}
+
+type TradeOffered struct {
+	ID    string
+	Offer []ItemStack
+}
+
+type TradeConfirmed struct {
+	ID string
+}
+
+type TradeCancelled struct {
+	ID string
+}
+
+// TradeChanged tells one of the players in a trade what it looks like now
+type TradeChanged struct {
+	ID    string
+	Trade *Trade
+}
+
+// TradeClosed tells one of the players in a trade that it is over
+type TradeClosed struct {
+	ID string
+	// see Trade
+	TradeID string
+	// whether the items were exchanged
+	Completed bool
+	Reason    string
+}
+
+type ProjectileSpawned struct {
+	Projectile *Projectile
+}
+
+// ProjectileImpact is sent when a projectile hits something or expires
+type ProjectileImpact struct {
+	ID string
+	// entity that was hit, if any
+	HitID    string
+	Position pixel.Vec
+}
+
+// Recipient returns the ID of the only player that should receive u,
+// or "" if u is meant for everyone
+func (u Update) Recipient() string {
+	switch {
+	case u.InventoryChanged != nil:
+		return u.InventoryChanged.ID
+	case u.ItemPickedUp != nil:
+		return u.ItemPickedUp.ID
+	case u.ItemDropped != nil:
+		return u.ItemDropped.ID
+	case u.ItemUsed != nil:
+		return u.ItemUsed.ID
+	case u.ItemEquipped != nil:
+		return u.ItemEquipped.ID
+	case u.ItemUnequipped != nil:
+		return u.ItemUnequipped.ID
+	case u.ExperienceGained != nil:
+		return u.ExperienceGained.ID
+	case u.ExperienceChanged != nil:
+		return u.ExperienceChanged.ID
+	case u.TradeRequested != nil:
+		return u.TradeRequested.ID
+	case u.TradeAccepted != nil:
+		return u.TradeAccepted.ID
+	case u.TradeOffered != nil:
+		return u.TradeOffered.ID
+	case u.TradeConfirmed != nil:
+		return u.TradeConfirmed.ID
+	case u.TradeCancelled != nil:
+		return u.TradeCancelled.ID
+	case u.TradeChanged != nil:
+		return u.TradeChanged.ID
+	case u.TradeClosed != nil:
+		return u.TradeClosed.ID
+	}
+	return ""
+}
+
+// Nearby returns the area of the players that should receive u,
+// for updates that only matter to players close by
+func (u Update) Nearby() (center pixel.Vec, radius float64, ok bool) {
+	if u.LevelUp != nil {
+		return u.LevelUp.Position, levelUpRange, true
+	}
+	return pixel.ZV, 0, false
+}
+
 func (m Message) String() string {
 	if m.Error != nil {
 		return fmt.Sprintf("Error: %s", m.Error.Message)
@@ -117,6 +485,100 @@ func (u Update) String() string {
 	if u.RemovePlayer != nil {
 		return fmt.Sprintf("PlayerDisconnected: %s", u.RemovePlayer)
 	}
+	if u.AddEntity != nil {
+		return fmt.Sprintf("AddEntity: %s %s", u.AddEntity.Entity.Kind, u.AddEntity.Entity.ID)
+	}
+	if u.EntityDestination != nil {
+		return fmt.Sprintf("EntityDestination: %s: %s", u.EntityDestination.ID, u.EntityDestination.Destination)
+	}
+	if u.EntityPosition != nil {
+		return fmt.Sprintf("EntityPosition: %s: %s", u.EntityPosition.ID, u.EntityPosition.Position)
+	}
+	if u.RemoveEntity != nil {
+		return fmt.Sprintf("RemoveEntity: %s", u.RemoveEntity.ID)
+	}
+	if u.EntityAttacked != nil {
+		return fmt.Sprintf("EntityAttacked: %s: %v at %s", u.EntityAttacked.ID, u.EntityAttacked.Action, u.EntityAttacked.Target)
+	}
+	if u.EntityDamaged != nil {
+		return fmt.Sprintf("EntityDamaged: %s by %s: %v (%v left)", u.EntityDamaged.ID, u.EntityDamaged.SourceID, u.EntityDamaged.Damage, u.EntityDamaged.Health)
+	}
+	if u.EntityDied != nil {
+		return fmt.Sprintf("EntityDied: %s killed by %s", u.EntityDied.ID, u.EntityDied.SourceID)
+	}
+	if u.PlayerRespawned != nil {
+		return fmt.Sprintf("PlayerRespawned: %s at %s", u.PlayerRespawned.ID, u.PlayerRespawned.Position)
+	}
+	if u.EntityRespawned != nil {
+		return fmt.Sprintf("EntityRespawned: %s at %s", u.EntityRespawned.ID, u.EntityRespawned.Position)
+	}
+	if u.EntityHealed != nil {
+		return fmt.Sprintf("EntityHealed: %s: %v (%v now)", u.EntityHealed.ID, u.EntityHealed.Amount, u.EntityHealed.Health)
+	}
+	if u.ItemPickedUp != nil {
+		return fmt.Sprintf("ItemPickedUp: %s: %s", u.ItemPickedUp.ID, u.ItemPickedUp.LootID)
+	}
+	if u.ItemDropped != nil {
+		return fmt.Sprintf("ItemDropped: %s: %v %s", u.ItemDropped.ID, u.ItemDropped.Count, u.ItemDropped.Item)
+	}
+	if u.ItemUsed != nil {
+		return fmt.Sprintf("ItemUsed: %s: %s", u.ItemUsed.ID, u.ItemUsed.Item)
+	}
+	if u.InventoryChanged != nil {
+		return fmt.Sprintf("InventoryChanged: %s: %v", u.InventoryChanged.ID, u.InventoryChanged.Inventory)
+	}
+	if u.ItemEquipped != nil {
+		return fmt.Sprintf("ItemEquipped: %s: %s", u.ItemEquipped.ID, u.ItemEquipped.Item)
+	}
+	if u.ItemUnequipped != nil {
+		return fmt.Sprintf("ItemUnequipped: %s: %s", u.ItemUnequipped.ID, u.ItemUnequipped.Slot)
+	}
+	if u.StatsChanged != nil {
+		return fmt.Sprintf("StatsChanged: %s: level %v, %s", u.StatsChanged.ID, u.StatsChanged.Level, u.StatsChanged.Stats)
+	}
+	if u.ExperienceGained != nil {
+		return fmt.Sprintf("ExperienceGained: %s: %v from %s", u.ExperienceGained.ID, u.ExperienceGained.Amount, u.ExperienceGained.Source)
+	}
+	if u.ExperienceChanged != nil {
+		return fmt.Sprintf("ExperienceChanged: %s: level %v, %v xp", u.ExperienceChanged.ID, u.ExperienceChanged.Progress.Level, u.ExperienceChanged.Progress.XP)
+	}
+	if u.LevelUp != nil {
+		return fmt.Sprintf("LevelUp: %s reached level %v", u.LevelUp.ID, u.LevelUp.Level)
+	}
+	if u.PlayerPortaled != nil {
+		return fmt.Sprintf("PlayerPortaled: %s to %s at %s", u.PlayerPortaled.ID, u.PlayerPortaled.Zone, u.PlayerPortaled.Position)
+	}
+	if u.TradeRequested != nil {
+		return fmt.Sprintf("TradeRequested: %s with %s", u.TradeRequested.ID, u.TradeRequested.With)
+	}
+	if u.TradeAccepted != nil {
+		return fmt.Sprintf("TradeAccepted: %s with %s", u.TradeAccepted.ID, u.TradeAccepted.With)
+	}
+	if u.TradeOffered != nil {
+		return fmt.Sprintf("TradeOffered: %s: %v", u.TradeOffered.ID, u.TradeOffered.Offer)
+	}
+	if u.TradeConfirmed != nil {
+		return fmt.Sprintf("TradeConfirmed: %s", u.TradeConfirmed.ID)
+	}
+	if u.TradeCancelled != nil {
+		return fmt.Sprintf("TradeCancelled: %s", u.TradeCancelled.ID)
+	}
+	if u.TradeChanged != nil {
+		return fmt.Sprintf("TradeChanged: %s: %s with %s: %v for %v", u.TradeChanged.ID,
+			u.TradeChanged.Trade.From, u.TradeChanged.Trade.To, u.TradeChanged.Trade.FromSide.Offer, u.TradeChanged.Trade.ToSide.Offer)
+	}
+	if u.PlayerSynced != nil {
+		return fmt.Sprintf("PlayerSynced: %s", u.PlayerSynced.Player.ID)
+	}
+	if u.TradeClosed != nil {
+		return fmt.Sprintf("TradeClosed: %s: %s (%s)", u.TradeClosed.ID, u.TradeClosed.TradeID, u.TradeClosed.Reason)
+	}
+	if u.ProjectileSpawned != nil {
+		return fmt.Sprintf("ProjectileSpawned: %s from %s", u.ProjectileSpawned.Projectile.ID, u.ProjectileSpawned.Projectile.Position)
+	}
+	if u.ProjectileImpact != nil {
+		return fmt.Sprintf("ProjectileImpact: %s hit %q at %s", u.ProjectileImpact.ID, u.ProjectileImpact.HitID, u.ProjectileImpact.Position)
+	}
 
 	return "empty update"
 }
@@ -131,6 +593,42 @@ func (r Request) String() string {
 	if r.SpeakRequest != nil {
 		return fmt.Sprintf("SpeakRequest: %s", r.SpeakRequest.Text)
 	}
+	if r.PickupRequest != nil {
+		return fmt.Sprintf("PickupRequest: %s", r.PickupRequest.LootID)
+	}
+	if r.DropRequest != nil {
+		return fmt.Sprintf("DropRequest: %v %s", r.DropRequest.Count, r.DropRequest.Item)
+	}
+	if r.UseRequest != nil {
+		return fmt.Sprintf("UseRequest: %s", r.UseRequest.Item)
+	}
+	if r.EquipRequest != nil {
+		return fmt.Sprintf("EquipRequest: %s", r.EquipRequest.Item)
+	}
+	if r.UnequipRequest != nil {
+		return fmt.Sprintf("UnequipRequest: %s", r.UnequipRequest.Slot)
+	}
+	if r.TradeRequest != nil {
+		return fmt.Sprintf("TradeRequest: %s", r.TradeRequest.With)
+	}
+	if r.TradeAcceptRequest != nil {
+		return fmt.Sprintf("TradeAcceptRequest: %s", r.TradeAcceptRequest.With)
+	}
+	if r.TradeOfferRequest != nil {
+		return fmt.Sprintf("TradeOfferRequest: %v", r.TradeOfferRequest.Offer)
+	}
+	if r.TradeConfirmRequest != nil {
+		return "TradeConfirmRequest"
+	}
+	if r.TradeCancelRequest != nil {
+		return "TradeCancelRequest"
+	}
+	if r.RespawnRequest != nil {
+		return "RespawnRequest"
+	}
+	if r.AttackRequest != nil {
+		return fmt.Sprintf("AttackRequest: %v at %s", r.AttackRequest.Action, r.AttackRequest.Target)
+	}
 
 	return "empty request"
 }
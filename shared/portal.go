@@ -0,0 +1,65 @@
+package shared
+
+import (
+	"github.com/faiface/pixel"
+	"github.com/ilackarms/pkg/errors"
+)
+
+// Portal moves players who walk into it to another zone
+type Portal struct {
+	Area pixel.Rect `json:"area"`
+	// name of the zone the portal leads to
+	Zone string `json:"zone"`
+	// where players come out in that zone
+	Destination pixel.Vec `json:"destination"`
+}
+
+// portalAt returns the portal covering pos, if any
+func (m *TileMap) portalAt(pos pixel.Vec) (Portal, bool) {
+	for _, portal := range m.Portals {
+		if portal.Area.Contains(pos) {
+			return portal, true
+		}
+	}
+	return Portal{}, false
+}
+
+// enterPortal takes player out of the world if it stands in a portal
+// the server moves it on to the other zone once it sees the PlayerPortaled update
+// caller must hold playersLock
+func (w *World) enterPortal(player *Player) {
+	if w.Map == nil || !player.Alive() {
+		return
+	}
+	portal, ok := w.Map.portalAt(player.Position)
+	if !ok {
+		return
+	}
+	player.Active = false
+	player.Destination = player.Position
+	w.spatialIndex().Remove(player.ID)
+	w.closeTradesOf(player.ID, nil, player.ID+" left")
+	w.finishUpdate(&Update{RemovePlayer: &RemovePlayer{ID: player.ID}})
+	w.finishUpdate(&Update{PlayerPortaled: &PlayerPortaled{
+		ID:       player.ID,
+		Zone:     portal.Zone,
+		Position: portal.Destination,
+	}})
+}
+
+// DeletePlayer removes the player with id from the world for good
+// and returns it, e.g. to move it to another world
+func (w *World) DeletePlayer(id string) (*Player, error) {
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	player, ok := w.Players[id]
+	if !ok {
+		return nil, errors.New("player "+id+" requested but not found", nil)
+	}
+	delete(w.Players, id)
+	w.spatialIndex().Remove(id)
+	if w.authoritative {
+		w.closeTradesOf(id, nil, id+" left")
+	}
+	return player, nil
+}
@@ -0,0 +1,52 @@
+package shared
+
+import (
+	"time"
+
+	"github.com/faiface/pixel"
+)
+
+// Move is a destination a client picked for its own player,
+// together with the tick of the client's world it was applied at
+type Move struct {
+	Seq         uint64
+	Tick        uint64
+	Destination pixel.Vec
+}
+
+// walkDelta returns how far entity walks towards its destination in dt,
+// before collisions. zero if it is not walking
+func walkDelta(entity *Entity, dt time.Duration) pixel.Vec {
+	if entity.Speed == 0 || !entity.Alive() || WithinRange(entity.Destination, entity.Position, 0.5) {
+		return pixel.ZV
+	}
+	// TODO change this to use astar pathing
+	return entity.Destination.Sub(entity.Position).Unit().Scaled(entity.Speed * dt.Seconds())
+}
+
+// Replay walks a copy of player id from position, starting at tick with
+// destination, and returns where it is at the current tick of the world
+// each of moves changes the destination from the tick after it was applied
+// the world itself is not changed; other entities are taken to stand
+// where they are now
+func (w *World) Replay(id string, position, destination pixel.Vec, tick uint64, moves []Move) (pixel.Vec, error) {
+	player, err := w.getActivePlayer(id)
+	if err != nil {
+		return pixel.ZV, err
+	}
+	w.playersLock.RLock()
+	defer w.playersLock.RUnlock()
+	entity := player.Entity
+	entity.Position = position
+	entity.Destination = destination
+	for t := tick + 1; t <= w.Tick; t++ {
+		for len(moves) > 0 && moves[0].Tick < t {
+			entity.Destination = moves[0].Destination
+			moves = moves[1:]
+		}
+		if delta := walkDelta(&entity, TickDuration); delta != pixel.ZV {
+			entity.Position = w.slide(&entity, delta)
+		}
+	}
+	return entity.Position, nil
+}
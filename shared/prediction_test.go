@@ -0,0 +1,85 @@
+package shared
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+func TestReplay(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	// how far a player walks in a tick
+	step := basePlayerSpeed * TickDuration.Seconds()
+	for _, test := range []struct {
+		name        string
+		destination pixel.Vec
+		tick        uint64
+		moves       []Move
+		expect      pixel.Vec
+	}{
+		{
+			name:   "standing",
+			expect: pixel.V(0, 0),
+		},
+		{
+			name:        "walking",
+			destination: pixel.V(10, 0),
+			expect:      pixel.V(10*step, 0),
+		},
+		{
+			name:        "nothing to replay",
+			destination: pixel.V(10, 0),
+			tick:        10,
+			expect:      pixel.V(0, 0),
+		},
+		{
+			name:        "close enough to the destination",
+			destination: pixel.V(0.3, 0),
+			expect:      pixel.V(0, 0),
+		},
+		{
+			name:   "move applied later",
+			moves:  []Move{{Seq: 1, Tick: 4, Destination: pixel.V(10, 0)}},
+			expect: pixel.V(6*step, 0),
+		},
+		{
+			name:        "turning back",
+			destination: pixel.V(10, 0),
+			moves:       []Move{{Seq: 1, Tick: 5, Destination: pixel.V(-10, 0)}},
+			expect:      pixel.V(0, 0),
+		},
+		{
+			name: "several moves",
+			moves: []Move{
+				{Seq: 1, Tick: 0, Destination: pixel.V(10, 0)},
+				{Seq: 2, Tick: 2, Destination: pixel.V(2*step, 10)},
+			},
+			expect: pixel.V(2*step, 8*step),
+		},
+	} {
+		w := NewEmptyWorld()
+		if err := w.ApplyUpdates(&Update{AddPlayer: &AddPlayer{ID: "player"}}); err != nil {
+			t.Fatal(err)
+		}
+		w.Tick = 10
+		position, err := w.Replay("player", pixel.ZV, test.destination, test.tick, test.moves)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !WithinRange(position, test.expect, 1e-9) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expect, position)
+		}
+		if player, _ := w.GetPlayer("player"); player.Position != pixel.ZV || player.Destination != pixel.ZV {
+			t.Errorf("%s: expected the world to be left alone, got player at %v walking to %v", test.name, player.Position, player.Destination)
+		}
+	}
+
+	if _, err := NewEmptyWorld().Replay("nobody", pixel.ZV, pixel.ZV, 0, nil); err == nil {
+		t.Error("expected replaying a missing player to fail")
+	}
+}
@@ -0,0 +1,203 @@
+package shared
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/faiface/pixel"
+	"github.com/ilackarms/pkg/errors"
+)
+
+// XPSource is something players gain experience from
+type XPSource string
+
+const (
+	XP_KILL    XPSource = "kill"
+	XP_QUEST   XPSource = "quest"
+	XP_EXPLORE XPSource = "explore"
+)
+
+// players within this distance see each other level up
+const levelUpRange = 12.0
+
+// Progression is the table players level up by
+type Progression struct {
+	// total experience needed for each level, starting with level 1
+	// the last entry is the highest level
+	Levels []int `json:"levels"`
+	// stats gained with every level after the first
+	Growth Stats `json:"growth"`
+	// experience given for each source, unless the source says otherwise
+	Rewards map[XPSource]int `json:"rewards"`
+}
+
+// worlds without a table have a single level and give no experience
+var noProgression = &Progression{Levels: []int{0}}
+
+// LoadProgression reads a Progression from a json file
+func LoadProgression(path string) (*Progression, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.New("reading progression file "+path, err)
+	}
+	var p Progression
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, errors.New("parsing progression json", err)
+	}
+	if len(p.Levels) == 0 || p.Levels[0] != 0 {
+		return nil, errors.New("level 1 must need 0 experience", nil)
+	}
+	for i := 1; i < len(p.Levels); i++ {
+		if p.Levels[i] <= p.Levels[i-1] {
+			return nil, errors.New("levels must need more and more experience", nil)
+		}
+	}
+	return &p, nil
+}
+
+// Level returns the level reached with xp
+func (p *Progression) Level(xp int) int {
+	level := 1
+	for level < len(p.Levels) && xp >= p.Levels[level] {
+		level++
+	}
+	return level
+}
+
+// Progress is how far a player has come; kept with the PlayerRecord
+type Progress struct {
+	Level int
+	XP    int
+	// names of the map regions the player has visited
+	Explored []string `,omitempty`
+}
+
+func (p Progress) DeepCopy() Progress {
+	cpy := p
+	cpy.Explored = make([]string, len(p.Explored))
+	copy(cpy.Explored, p.Explored)
+	return cpy
+}
+
+func (p Progress) explored(region string) bool {
+	for _, name := range p.Explored {
+		if name == region {
+			return true
+		}
+	}
+	return false
+}
+
+// Region is a named area of a map that players gain experience for finding
+type Region struct {
+	Name string     `json:"name"`
+	Area pixel.Rect `json:"area"`
+}
+
+// SetProgression sets the table players level up by
+// only the authoritative world needs one, see LoadProgression
+func (w *World) SetProgression(p *Progression) {
+	w.progression = p
+}
+
+func (w *World) getProgression() *Progression {
+	if w.progression == nil {
+		return noProgression
+	}
+	return w.progression
+}
+
+// grantXP gives player experience and levels it up
+// amount 0 gives the reward of the progression table for source
+// caller must hold playersLock
+func (w *World) grantXP(player *Player, source XPSource, amount int) {
+	progression := w.getProgression()
+	if amount == 0 {
+		amount = progression.Rewards[source]
+	}
+	if amount <= 0 {
+		return
+	}
+	player.XP += amount
+	level := progression.Level(player.XP)
+	if level > player.Level {
+		player.Level = level
+		// the new level is sent along even if the stats stay the same
+		w.setStats(&player.Entity, w.playerStats(player))
+		w.statsChanged(player)
+		w.finishUpdate(&Update{LevelUp: &LevelUp{
+			ID:       player.ID,
+			Level:    level,
+			Position: player.Position,
+		}})
+	}
+	w.experienceChanged(player)
+}
+
+// experienceChanged tells player how far it has come
+// caller must hold playersLock
+func (w *World) experienceChanged(player *Player) {
+	w.finishUpdate(&Update{ExperienceChanged: &ExperienceChanged{
+		ID:       player.ID,
+		Progress: player.Progress.DeepCopy(),
+	}})
+}
+
+// explore rewards player for entering map regions it has not visited before
+// caller must hold playersLock
+func (w *World) explore(player *Player) {
+	if w.Map == nil {
+		return
+	}
+	for _, region := range w.Map.Regions {
+		if player.Progress.explored(region.Name) || !region.Area.Contains(player.Position) {
+			continue
+		}
+		player.Explored = append(player.Explored, region.Name)
+		w.grantXP(player, XP_EXPLORE, 0)
+	}
+}
+
+// experience given by kills is resolved by the authoritative world;
+// the server applies ExperienceGained for sources such as quests
+func (w *World) applyExperienceGained(gained *ExperienceGained) error {
+	if !w.authoritative {
+		return nil
+	}
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	player, ok := w.Players[gained.ID]
+	if !ok {
+		return errors.New("player "+gained.ID+" requested but not found", nil)
+	}
+	w.grantXP(player, gained.Source, gained.Amount)
+	return nil
+}
+
+func (w *World) applyExperienceChanged(changed *ExperienceChanged) error {
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	player, ok := w.Players[changed.ID]
+	if !ok {
+		return errors.New("player "+changed.ID+" requested but not found", nil)
+	}
+	player.Progress = changed.Progress.DeepCopy()
+	if player.Level < 1 {
+		player.Level = 1
+	}
+	if w.authoritative {
+		w.updateStats(player)
+	}
+	return nil
+}
+
+func (w *World) applyLevelUp(levelUp *LevelUp) error {
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	player, ok := w.Players[levelUp.ID]
+	if !ok {
+		return errors.New("player "+levelUp.ID+" requested but not found", nil)
+	}
+	player.Level = levelUp.Level
+	return nil
+}
@@ -0,0 +1,152 @@
+package shared
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+// loadProgression loads the table the server uses
+func loadProgression(t *testing.T) *Progression {
+	progression, err := LoadProgression("../server/progression.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return progression
+}
+
+func TestProgressionLevel(t *testing.T) {
+	progression := loadProgression(t)
+	for _, test := range []struct {
+		xp    int
+		level int
+	}{
+		{0, 1},
+		{99, 1},
+		{100, 2},
+		{249, 2},
+		{250, 3},
+		{5999, 9},
+		{6000, 10},
+		// the last level is the highest
+		{100000, 10},
+	} {
+		if level := progression.Level(test.xp); level != test.level {
+			t.Errorf("expected %v xp to be level %v, got %v", test.xp, test.level, level)
+		}
+	}
+}
+
+func TestGrantXP(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	progression := loadProgression(t)
+	for _, test := range []struct {
+		name   string
+		start  Progress
+		source XPSource
+		amount int
+		expect Progress
+		// max health afterwards; 0 if it is not checked
+		maxHealth int
+	}{
+		{
+			name:      "reward of the table",
+			start:     Progress{Level: 1},
+			source:    XP_KILL,
+			expect:    Progress{Level: 1, XP: 20},
+			maxHealth: 100,
+		},
+		{
+			name:      "level up",
+			start:     Progress{Level: 1, XP: 20},
+			source:    XP_KILL,
+			amount:    80,
+			expect:    Progress{Level: 2, XP: 100},
+			maxHealth: 110,
+		},
+		{
+			name:      "several levels at once",
+			start:     Progress{Level: 1},
+			source:    XP_QUEST,
+			amount:    500,
+			expect:    Progress{Level: 4, XP: 500},
+			maxHealth: 130,
+		},
+		{
+			name:   "source without reward",
+			start:  Progress{Level: 1, XP: 20},
+			source: XPSource("nothing"),
+			expect: Progress{Level: 1, XP: 20},
+		},
+		{
+			name:   "no negative experience",
+			start:  Progress{Level: 2, XP: 120},
+			source: XP_KILL,
+			amount: -50,
+			expect: Progress{Level: 2, XP: 120},
+		},
+		{
+			name:   "levels are never lost",
+			start:  Progress{Level: 5, XP: 10},
+			source: XP_EXPLORE,
+			expect: Progress{Level: 5, XP: 60},
+		},
+	} {
+		w := NewEmptyWorld()
+		w.SetAuthoritative()
+		w.SetProgression(progression)
+		go func() {
+			for range w.ProcessedUpdates() {
+			}
+		}()
+		if err := w.ApplyUpdates(&Update{AddPlayer: &AddPlayer{ID: "player"}}); err != nil {
+			t.Fatal(err)
+		}
+		w.playersLock.Lock()
+		player := w.Players["player"]
+		player.Progress = test.start
+		w.grantXP(player, test.source, test.amount)
+		progress, maxHealth := player.Progress, player.MaxHealth
+		w.playersLock.Unlock()
+		if progress.Level != test.expect.Level || progress.XP != test.expect.XP {
+			t.Errorf("%s: expected level %v with %v xp, got level %v with %v xp",
+				test.name, test.expect.Level, test.expect.XP, progress.Level, progress.XP)
+		}
+		if test.maxHealth != 0 && maxHealth != test.maxHealth {
+			t.Errorf("%s: expected max health %v, got %v", test.name, test.maxHealth, maxHealth)
+		}
+	}
+}
+
+func TestLevelUpChangesStats(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	// levels that add nothing are still sent to everyone
+	w := NewEmptyWorld()
+	w.SetAuthoritative()
+	w.SetProgression(&Progression{Levels: []int{0, 10}})
+	if err := w.ApplyUpdates(&Update{AddPlayer: &AddPlayer{ID: "player"}}); err != nil {
+		t.Fatal(err)
+	}
+	w.playersLock.Lock()
+	w.grantXP(w.Players["player"], XP_QUEST, 10)
+	w.playersLock.Unlock()
+	for {
+		select {
+		case update := <-w.ProcessedUpdates():
+			if changed := update.StatsChanged; changed != nil {
+				if changed.ID != "player" || changed.Level != 2 {
+					t.Fatalf("expected player to be level 2, got %#v", changed)
+				}
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected the level to be sent with the stats")
+		}
+	}
+}
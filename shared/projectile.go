@@ -0,0 +1,171 @@
+package shared
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/faiface/pixel"
+	"github.com/ilackarms/pkg/errors"
+)
+
+const (
+	projectileRadius = 0.15
+	// projectiles are moved in steps no longer than this
+	// so that they can not skip over thin obstacles
+	projectileSubstep = 0.25
+)
+
+// Projectile is fired by ranged attacks and flies in a straight line
+// until it hits something or has flown its range
+// clients are only told where a projectile starts and where it ends;
+// in between they move it themselves
+type Projectile struct {
+	ID string
+	// entity that fired the projectile; it can not be hit by it
+	OwnerID   string
+	Action    Action
+	Position  pixel.Vec
+	Direction pixel.Vec
+	Speed     float64
+	// distance left to fly before the projectile expires
+	Range  float64
+	Damage int
+}
+
+func (p *Projectile) DeepCopy() *Projectile {
+	cpy := *p
+	return &cpy
+}
+
+// fire spawns the projectile of a ranged attack
+// caller must hold playersLock
+func (w *World) fire(attacker *Entity, action Action, aim pixel.Vec, stats Attack) {
+	direction := UnitVec(aim.Sub(attacker.Position))
+	if direction == pixel.ZV {
+		direction = DOWN.ToVec()
+	}
+	projectile := &Projectile{
+		ID:        fmt.Sprintf("%s-%v", attacker.ID, w.Tick),
+		OwnerID:   attacker.ID,
+		Action:    action,
+		Position:  attacker.Position.Add(direction.Scaled(attacker.Radius())),
+		Direction: direction,
+		Speed:     stats.ProjectileSpeed,
+		Range:     stats.Range,
+		Damage:    stats.Damage + attacker.Attack,
+	}
+	w.Projectiles[projectile.ID] = projectile
+	w.finishUpdate(&Update{ProjectileSpawned: &ProjectileSpawned{Projectile: projectile.DeepCopy()}})
+}
+
+// stepProjectiles moves every projectile
+// only the authoritative world decides what they hit
+// caller must hold playersLock
+func (w *World) stepProjectiles() {
+	ids := make([]string, 0, len(w.Projectiles))
+	for id := range w.Projectiles {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		w.stepProjectile(w.Projectiles[id])
+	}
+}
+
+// caller must hold playersLock
+func (w *World) stepProjectile(p *Projectile) {
+	distance := math.Min(p.Speed*TickDuration.Seconds(), p.Range)
+	for distance > 0 {
+		move := math.Min(distance, projectileSubstep)
+		distance -= move
+		p.Range -= move
+		p.Position = p.Position.Add(p.Direction.Scaled(move))
+		if !w.authoritative {
+			continue
+		}
+		if w.Map != nil && w.Map.Blocked(RectFromCenter(p.Position, projectileRadius*2, projectileRadius*2)) {
+			w.impact(p, "")
+			return
+		}
+		if target := w.projectileTarget(p); target != nil {
+			w.damage(target, p.OwnerID, p.Damage)
+			w.impact(p, target.ID)
+			return
+		}
+	}
+	if p.Range <= 0 {
+		if w.authoritative {
+			w.impact(p, "")
+			return
+		}
+		// clients wait for the impact, but stop drawing the projectile
+		delete(w.Projectiles, p.ID)
+	}
+}
+
+// projectileTarget returns the living entity p is touching, if any
+// caller must hold playersLock
+func (w *World) projectileTarget(p *Projectile) *Entity {
+	area := RectFromCenter(p.Position, projectileRadius*2, projectileRadius*2)
+	for _, id := range w.spatialIndex().QueryRect(area) {
+		target := w.entity(id)
+		if id == p.OwnerID || target.MaxHealth == 0 || !target.Alive() {
+			continue
+		}
+		if WithinRange(p.Position, target.Position, target.Radius()+projectileRadius) {
+			return target
+		}
+	}
+	return nil
+}
+
+// caller must hold playersLock
+func (w *World) impact(p *Projectile, hitID string) {
+	delete(w.Projectiles, p.ID)
+	w.finishUpdate(&Update{ProjectileImpact: &ProjectileImpact{
+		ID:       p.ID,
+		HitID:    hitID,
+		Position: p.Position,
+	}})
+}
+
+func (w *World) applyProjectileSpawned(spawned *ProjectileSpawned) error {
+	if spawned.Projectile == nil {
+		return errors.New("no projectile given to spawn", nil)
+	}
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	if w.Projectiles == nil {
+		w.Projectiles = make(map[string]*Projectile)
+	}
+	w.Projectiles[spawned.Projectile.ID] = spawned.Projectile.DeepCopy()
+	return nil
+}
+
+// the projectile may already be gone on clients if it flew its whole range
+func (w *World) applyProjectileImpact(impact *ProjectileImpact) error {
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	delete(w.Projectiles, impact.ID)
+	return nil
+}
+
+// GetProjectile returns a reference to a projectile in flight
+// Objects returned by GetProjectile should be read-only
+func (w *World) GetProjectile(id string) (*Projectile, bool) {
+	w.playersLock.RLock()
+	defer w.playersLock.RUnlock()
+	projectile, ok := w.Projectiles[id]
+	return projectile, ok
+}
+
+// ForEachProjectile calls f on each projectile in flight
+// This is intended for reading only
+func (w *World) ForEachProjectile(f func(projectile *Projectile)) {
+	w.playersLock.RLock()
+	defer w.playersLock.RUnlock()
+	for _, projectile := range w.Projectiles {
+		f(projectile)
+	}
+}
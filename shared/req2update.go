@@ -12,12 +12,64 @@ func ToUpdate(sourceID string, reqContent interface{}) *Update {
 		return &Update{PlayerDestination: &PlayerDestination{
 			ID:          sourceID,
 			Destination: content.Destination,
+			Seq:         content.Seq,
 		}}
 	case *SpeakRequest:
 		return &Update{PlayerSpoke: &PlayerSpoke{
 			ID:   sourceID,
 			Text: content.Text,
 		}}
+	case *PickupRequest:
+		return &Update{ItemPickedUp: &ItemPickedUp{
+			ID:     sourceID,
+			LootID: content.LootID,
+		}}
+	case *DropRequest:
+		return &Update{ItemDropped: &ItemDropped{
+			ID:    sourceID,
+			Item:  content.Item,
+			Count: content.Count,
+		}}
+	case *UseRequest:
+		return &Update{ItemUsed: &ItemUsed{
+			ID:   sourceID,
+			Item: content.Item,
+		}}
+	case *EquipRequest:
+		return &Update{ItemEquipped: &ItemEquipped{
+			ID:   sourceID,
+			Item: content.Item,
+		}}
+	case *UnequipRequest:
+		return &Update{ItemUnequipped: &ItemUnequipped{
+			ID:   sourceID,
+			Slot: content.Slot,
+		}}
+	case *TradeRequest:
+		return &Update{TradeRequested: &TradeRequested{
+			ID:   sourceID,
+			With: content.With,
+		}}
+	case *TradeAcceptRequest:
+		return &Update{TradeAccepted: &TradeAccepted{
+			ID:   sourceID,
+			With: content.With,
+		}}
+	case *TradeOfferRequest:
+		return &Update{TradeOffered: &TradeOffered{
+			ID:    sourceID,
+			Offer: content.Offer,
+		}}
+	case *TradeConfirmRequest:
+		return &Update{TradeConfirmed: &TradeConfirmed{ID: sourceID}}
+	case *TradeCancelRequest:
+		return &Update{TradeCancelled: &TradeCancelled{ID: sourceID}}
+	case *AttackRequest:
+		return &Update{EntityAttacked: &EntityAttacked{
+			ID:     sourceID,
+			Action: content.Action,
+			Target: content.Target,
+		}}
 	}
 	panic(fmt.Sprintf("unknown request type %#v", reqContent))
 }
@@ -0,0 +1,149 @@
+package shared
+
+import (
+	"math"
+	"sort"
+
+	"github.com/faiface/pixel"
+)
+
+const (
+	// width and height of one spatial hash cell in world coordinates
+	spatialCellSize = 4.0
+)
+
+type cellKey struct {
+	X, Y int
+}
+
+type cellRange struct {
+	min, max cellKey
+}
+
+func (r cellRange) forEach(f func(key cellKey)) {
+	for y := r.min.Y; y <= r.max.Y; y++ {
+		for x := r.min.X; x <= r.max.X; x++ {
+			f(cellKey{X: x, Y: y})
+		}
+	}
+}
+
+// SpatialHash is a uniform grid that indexes entity bounds by ID
+// it is used to avoid checking every entity against every other entity
+// SpatialHash is not safe for concurrent modification
+type SpatialHash struct {
+	cellSize float64
+	cells    map[cellKey]map[string]struct{}
+	bounds   map[string]pixel.Rect
+	ranges   map[string]cellRange
+}
+
+func NewSpatialHash(cellSize float64) *SpatialHash {
+	return &SpatialHash{
+		cellSize: cellSize,
+		cells:    make(map[cellKey]map[string]struct{}),
+		bounds:   make(map[string]pixel.Rect),
+		ranges:   make(map[string]cellRange),
+	}
+}
+
+func (h *SpatialHash) Len() int {
+	return len(h.bounds)
+}
+
+// Insert adds id to the hash, or moves it if it already exists
+func (h *SpatialHash) Insert(id string, bounds pixel.Rect) {
+	cells := h.cellsOf(bounds)
+	h.bounds[id] = bounds
+	if old, ok := h.ranges[id]; ok {
+		if old == cells {
+			return
+		}
+		h.unlink(id, old)
+	}
+	h.ranges[id] = cells
+	cells.forEach(func(key cellKey) {
+		cell, ok := h.cells[key]
+		if !ok {
+			cell = make(map[string]struct{})
+			h.cells[key] = cell
+		}
+		cell[id] = struct{}{}
+	})
+}
+
+// Remove deletes id from the hash; removing an unknown id is a no-op
+func (h *SpatialHash) Remove(id string) {
+	cells, ok := h.ranges[id]
+	if !ok {
+		return
+	}
+	h.unlink(id, cells)
+	delete(h.ranges, id)
+	delete(h.bounds, id)
+}
+
+// QueryRect returns the sorted IDs of all entities whose bounds overlap rect
+func (h *SpatialHash) QueryRect(rect pixel.Rect) []string {
+	return h.query(rect, func(bounds pixel.Rect) bool {
+		return overlaps(rect, bounds)
+	})
+}
+
+// QueryRadius returns the sorted IDs of all entities
+// whose center lies within radius of center
+func (h *SpatialHash) QueryRadius(center pixel.Vec, radius float64) []string {
+	rect := RectFromCenter(center, radius*2, radius*2)
+	return h.query(rect, func(bounds pixel.Rect) bool {
+		return WithinRange(center, bounds.Center(), radius)
+	})
+}
+
+func (h *SpatialHash) query(rect pixel.Rect, match func(bounds pixel.Rect) bool) []string {
+	var ids []string
+	seen := make(map[string]struct{})
+	h.cellsOf(rect).forEach(func(key cellKey) {
+		for id := range h.cells[key] {
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			seen[id] = struct{}{}
+			if match(h.bounds[id]) {
+				ids = append(ids, id)
+			}
+		}
+	})
+	// map iteration is random; keep results stable
+	sort.Strings(ids)
+	return ids
+}
+
+func (h *SpatialHash) unlink(id string, cells cellRange) {
+	cells.forEach(func(key cellKey) {
+		cell := h.cells[key]
+		delete(cell, id)
+		if len(cell) == 0 {
+			delete(h.cells, key)
+		}
+	})
+}
+
+func (h *SpatialHash) cellsOf(rect pixel.Rect) cellRange {
+	return cellRange{
+		min: h.cellAt(rect.Min),
+		max: h.cellAt(rect.Max),
+	}
+}
+
+func (h *SpatialHash) cellAt(v pixel.Vec) cellKey {
+	return cellKey{
+		X: int(math.Floor(v.X / h.cellSize)),
+		Y: int(math.Floor(v.Y / h.cellSize)),
+	}
+}
+
+// overlaps returns whether r1 and r2 overlap or touch
+func overlaps(r1, r2 pixel.Rect) bool {
+	return r1.Min.X <= r2.Max.X && r2.Min.X <= r1.Max.X &&
+		r1.Min.Y <= r2.Max.Y && r2.Min.Y <= r1.Max.Y
+}
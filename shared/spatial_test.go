@@ -0,0 +1,90 @@
+package shared
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+func TestSpatialHashQuery(t *testing.T) {
+	h := NewSpatialHash(spatialCellSize)
+	h.Insert("a", RectFromCenter(pixel.V(0, 0), 1, 1))
+	h.Insert("b", RectFromCenter(pixel.V(3, 0), 1, 1))
+	h.Insert("c", RectFromCenter(pixel.V(-10, 10), 1, 1))
+
+	if ids := h.QueryRect(pixel.R(-1, -1, 3, 1)); fmt.Sprint(ids) != "[a b]" {
+		t.Fatalf("expected [a b], got %v", ids)
+	}
+	if ids := h.QueryRadius(pixel.V(-9, 9), 2); fmt.Sprint(ids) != "[c]" {
+		t.Fatalf("expected [c], got %v", ids)
+	}
+
+	// move b across cells
+	h.Insert("b", RectFromCenter(pixel.V(-10, 9), 1, 1))
+	if ids := h.QueryRadius(pixel.V(-9, 9), 2); fmt.Sprint(ids) != "[b c]" {
+		t.Fatalf("expected [b c], got %v", ids)
+	}
+	if ids := h.QueryRect(pixel.R(2, -1, 4, 1)); len(ids) != 0 {
+		t.Fatalf("expected b to have moved, got %v", ids)
+	}
+
+	h.Remove("c")
+	if ids := h.QueryRadius(pixel.V(-9, 9), 2); fmt.Sprint(ids) != "[b]" {
+		t.Fatalf("expected [b], got %v", ids)
+	}
+	if h.Len() != 2 {
+		t.Fatalf("expected 2 entries, got %v", h.Len())
+	}
+}
+
+func newBenchmarkWorld(n int) *World {
+	w := NewEmptyWorld()
+	size := float64(n) / 10
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("player-%v", i)
+		pos := pixel.V(rand.Float64()*size, rand.Float64()*size)
+		w.addPlayer(&AddPlayer{ID: id, Position: pos})
+		w.updateDestination(&PlayerDestination{ID: id, Destination: pos.Add(RandVec(-10, 10))})
+	}
+	return w
+}
+
+func benchmarkStep(b *testing.B, n int) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+	w := newBenchmarkWorld(n)
+	// nobody broadcasts the processed updates here
+	go func() {
+		for range w.ProcessedUpdates() {
+		}
+	}()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// otherwise every step copies all the ones before it
+		b.StopTimer()
+		w.Keep(1)
+		b.StartTimer()
+		w.Step()
+	}
+}
+
+func benchmarkQueryRadius(b *testing.B, n int) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+	w := newBenchmarkWorld(n)
+	size := float64(n) / 10
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.QueryRadius(pixel.V(rand.Float64()*size, rand.Float64()*size), 10)
+	}
+}
+
+func BenchmarkStep1k(b *testing.B)         { benchmarkStep(b, 1000) }
+func BenchmarkStep10k(b *testing.B)        { benchmarkStep(b, 10000) }
+func BenchmarkQueryRadius1k(b *testing.B)  { benchmarkQueryRadius(b, 1000) }
+func BenchmarkQueryRadius10k(b *testing.B) { benchmarkQueryRadius(b, 10000) }
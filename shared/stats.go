@@ -0,0 +1,222 @@
+package shared
+
+import (
+	"fmt"
+
+	"github.com/ilackarms/pkg/errors"
+)
+
+// Stats are the numbers that decide how well an entity moves and fights
+type Stats struct {
+	Speed     float64 `json:"speed"`
+	MaxHealth int     `json:"maxHealth"`
+	// added to the damage of every attack
+	Attack int `json:"attack"`
+	// subtracted from the damage of every hit taken
+	Defense int `json:"defense"`
+}
+
+func (s Stats) Add(other Stats) Stats {
+	return Stats{
+		Speed:     s.Speed + other.Speed,
+		MaxHealth: s.MaxHealth + other.MaxHealth,
+		Attack:    s.Attack + other.Attack,
+		Defense:   s.Defense + other.Defense,
+	}
+}
+
+func (s Stats) Scaled(n int) Stats {
+	return Stats{
+		Speed:     s.Speed * float64(n),
+		MaxHealth: s.MaxHealth * n,
+		Attack:    s.Attack * n,
+		Defense:   s.Defense * n,
+	}
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("speed %.1f, health %v, attack %v, defense %v", s.Speed, s.MaxHealth, s.Attack, s.Defense)
+}
+
+var basePlayerStats = Stats{
+	Speed:     basePlayerSpeed,
+	MaxHealth: basePlayerHealth,
+}
+
+const (
+	// entities can never be slowed down to less than this
+	minSpeed = 0.5
+)
+
+// EquipSlot is a place on the body an item can be worn
+type EquipSlot string
+
+const (
+	SLOT_WEAPON EquipSlot = "weapon"
+	SLOT_HEAD   EquipSlot = "head"
+	SLOT_BODY   EquipSlot = "body"
+	SLOT_FEET   EquipSlot = "feet"
+)
+
+// EquipSlots lists every slot in the order they are shown to players
+var EquipSlots = []EquipSlot{SLOT_WEAPON, SLOT_HEAD, SLOT_BODY, SLOT_FEET}
+
+// Equipment maps slots to the IDs of the items equipped in them
+type Equipment map[EquipSlot]string
+
+func (e Equipment) DeepCopy() Equipment {
+	if e == nil {
+		return nil
+	}
+	cpy := make(Equipment, len(e))
+	for slot, item := range e {
+		cpy[slot] = item
+	}
+	return cpy
+}
+
+// Stats returns the sum of the bonuses of all equipped items
+func (e Equipment) Stats() Stats {
+	var bonus Stats
+	for _, item := range e {
+		bonus = bonus.Add(Items[item].Stats)
+	}
+	return bonus
+}
+
+// Stats returns the entity's current stats
+func (e *Entity) Stats() Stats {
+	return Stats{
+		Speed:     e.Speed,
+		MaxHealth: e.MaxHealth,
+		Attack:    e.Attack,
+		Defense:   e.Defense,
+	}
+}
+
+// caller must hold playersLock
+func (w *World) setStats(entity *Entity, stats Stats) {
+	entity.Speed = stats.Speed
+	entity.MaxHealth = stats.MaxHealth
+	entity.Attack = stats.Attack
+	entity.Defense = stats.Defense
+	if entity.Health > entity.MaxHealth {
+		entity.Health = entity.MaxHealth
+	}
+}
+
+// playerStats derives the stats of player from its base stats,
+// level and equipment
+func (w *World) playerStats(player *Player) Stats {
+	levels := player.Level - 1
+	if levels < 0 {
+		levels = 0
+	}
+	stats := basePlayerStats.
+		Add(w.getProgression().Growth.Scaled(levels)).
+		Add(player.Equipment.Stats())
+	if stats.Speed < minSpeed {
+		stats.Speed = minSpeed
+	}
+	if stats.MaxHealth < 1 {
+		stats.MaxHealth = 1
+	}
+	return stats
+}
+
+// updateStats recalculates the stats of player in the authoritative world
+// and tells everyone if they changed
+// caller must hold playersLock
+func (w *World) updateStats(player *Player) {
+	stats := w.playerStats(player)
+	if stats == player.Stats() {
+		return
+	}
+	w.setStats(&player.Entity, stats)
+	w.statsChanged(player)
+}
+
+// statsChanged tells everyone the stats and level of player
+// caller must hold playersLock
+func (w *World) statsChanged(player *Player) {
+	w.finishUpdate(&Update{StatsChanged: &StatsChanged{
+		ID:     player.ID,
+		Stats:  player.Stats(),
+		Health: player.Health,
+		Level:  player.Level,
+	}})
+}
+
+func (w *World) applyStatsChanged(changed *StatsChanged) error {
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	entity, err := w.getActiveEntity(changed.ID)
+	if err != nil {
+		return err
+	}
+	w.setStats(entity, changed.Stats)
+	entity.Health = changed.Health
+	if player, ok := w.Players[changed.ID]; ok && changed.Level > 0 {
+		player.Level = changed.Level
+	}
+	return nil
+}
+
+// the equipment updates below are only resolved by the authoritative world,
+// which sends out their effects as separate updates
+
+func (w *World) applyItemEquipped(equip *ItemEquipped) error {
+	if !w.authoritative {
+		return nil
+	}
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	player, err := w.getLivingPlayer(equip.ID)
+	if err != nil {
+		return err
+	}
+	def, ok := Items[equip.Item]
+	if !ok || def.Slot == "" {
+		return errors.New("item "+equip.Item+" can not be equipped", nil)
+	}
+	inventory := player.Inventory.DeepCopy()
+	if err := inventory.Remove(equip.Item, 1); err != nil {
+		return err
+	}
+	if old, ok := player.Equipment[def.Slot]; ok {
+		if err := inventory.Add(ItemStack{Item: old, Count: 1}); err != nil {
+			return errors.New("no room to take off "+old, err)
+		}
+	}
+	if player.Equipment == nil {
+		player.Equipment = make(Equipment)
+	}
+	player.Inventory = inventory
+	player.Equipment[def.Slot] = equip.Item
+	w.updateStats(player)
+	w.inventoryChanged(player)
+	return nil
+}
+
+func (w *World) applyItemUnequipped(unequip *ItemUnequipped) error {
+	if !w.authoritative {
+		return nil
+	}
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	player, err := w.getLivingPlayer(unequip.ID)
+	if err != nil {
+		return err
+	}
+	item, ok := player.Equipment[unequip.Slot]
+	if !ok {
+		return errors.New("nothing equipped in slot "+string(unequip.Slot), nil)
+	}
+	if err := player.Inventory.Add(ItemStack{Item: item, Count: 1}); err != nil {
+		return errors.New("no room to take off "+item, err)
+	}
+	delete(player.Equipment, unequip.Slot)
+	w.updateStats(player)
+	w.inventoryChanged(player)
+	return nil
+}
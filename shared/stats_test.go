@@ -0,0 +1,64 @@
+package shared
+
+import "testing"
+
+func TestPlayerStats(t *testing.T) {
+	progression := loadProgression(t)
+	for _, test := range []struct {
+		name      string
+		level     int
+		equipment Equipment
+		// the server's table if nil
+		progression *Progression
+		expect      Stats
+	}{
+		{
+			name:   "base",
+			level:  1,
+			expect: Stats{Speed: 2, MaxHealth: 100},
+		},
+		{
+			name:   "no level yet",
+			expect: Stats{Speed: 2, MaxHealth: 100},
+		},
+		{
+			name:      "weapon",
+			level:     1,
+			equipment: Equipment{SLOT_WEAPON: "short-sword"},
+			expect:    Stats{Speed: 2, MaxHealth: 100, Attack: 5},
+		},
+		{
+			name:      "armor slows and boots speed up",
+			level:     1,
+			equipment: Equipment{SLOT_BODY: "chainmail", SLOT_FEET: "leather-boots"},
+			expect:    Stats{Speed: 2.2, MaxHealth: 100, Defense: 5},
+		},
+		{
+			name:      "levels and equipment add up",
+			level:     3,
+			equipment: Equipment{SLOT_HEAD: "leather-cap", SLOT_WEAPON: "short-sword"},
+			expect:    Stats{Speed: 2, MaxHealth: 130, Attack: 7, Defense: 3},
+		},
+		{
+			name:        "never slower than the minimum",
+			level:       3,
+			equipment:   Equipment{SLOT_BODY: "chainmail"},
+			progression: &Progression{Levels: []int{0, 10, 20}, Growth: Stats{Speed: -1, MaxHealth: -100}},
+			expect:      Stats{Speed: minSpeed, MaxHealth: 1, Defense: 5},
+		},
+	} {
+		w := NewEmptyWorld()
+		if test.progression == nil {
+			test.progression = progression
+		}
+		w.SetProgression(test.progression)
+		player := &Player{PlayerRecord: PlayerRecord{
+			Progress:  Progress{Level: test.level},
+			Equipment: test.equipment,
+		}}
+		// speed is compared as it is shown, as the bonuses of items are added up in any order
+		if stats := w.playerStats(player); stats.String() != test.expect.String() {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expect, stats)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package shared
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"math/rand"
+
+	"github.com/faiface/pixel"
+	"github.com/ilackarms/pkg/errors"
+)
+
+// TileType describes one kind of terrain
+type TileType struct {
+	Name string
+	// players can only stand on walkable tiles
+	Walkable bool
+	// client asset used to draw the tile, e.g. sprites/grass.png
+	// tiles without a sprite are drawn as solid color
+	Sprite string
+}
+
+// TileMap is the terrain of a world
+// every tile is 1x1 in world coordinates; the tile at (x, y)
+// covers the area from (x, y) to (x+1, y+1)
+type TileMap struct {
+	Name string
+	// world coordinates of the bottom-left corner of the map
+	Origin pixel.Vec
+	// size in tiles
+	Width  int
+	Height int
+	Types  []TileType
+	// row-major indices into Types, starting with the bottom row
+	Tiles []byte
+	// positions where players may enter the world
+	SpawnPoints []pixel.Vec
+	// positions where dead players come back to life
+	// defaults to SpawnPoints
+	RespawnPoints []pixel.Vec
+	// what happens to players who die on this map
+	Death DeathRules
+	// npcs placed in the world when the server starts
+	NPCs []*Entity
+	// areas players gain experience for exploring
+	Regions []Region
+	// areas that lead to other zones
+	Portals []Portal
+	// area entities may move in; defaults to Bounds()
+	PlayArea pixel.Rect
+}
+
+// tileMapFile is the on-disk format of a TileMap
+// Rows are listed top to bottom, one character per tile.
+// each character must be a key of Legend.
+type tileMapFile struct {
+	Name          string              `json:"name"`
+	Origin        pixel.Vec           `json:"origin"`
+	Legend        map[string]TileType `json:"legend"`
+	Rows          []string            `json:"rows"`
+	SpawnPoints   []pixel.Vec         `json:"spawnPoints"`
+	RespawnPoints []pixel.Vec         `json:"respawnPoints"`
+	Death         *deathRulesFile     `json:"death"`
+	NPCs          []npcFile           `json:"npcs"`
+	Regions       []Region            `json:"regions"`
+	Portals       []Portal            `json:"portals"`
+	PlayArea      *pixel.Rect         `json:"playArea"`
+}
+
+type npcFile struct {
+	ID       string    `json:"id"`
+	Position pixel.Vec `json:"position"`
+	// defaults to half the speed of a player
+	Speed    float64   `json:"speed"`
+	Health   int       `json:"health"`
+	Behavior *Behavior `json:"behavior"`
+	// dropped when the npc is killed
+	Loot []ItemStack `json:"loot"`
+	// experience for killing the npc
+	XP int `json:"xp"`
+}
+
+// LoadTileMap reads a TileMap from a json map file
+func LoadTileMap(path string) (*TileMap, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.New("reading map file "+path, err)
+	}
+	return ParseTileMap(data)
+}
+
+// ParseTileMap parses a TileMap from the contents of a json map file
+func ParseTileMap(data []byte) (*TileMap, error) {
+	var file tileMapFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, errors.New("parsing map json", err)
+	}
+	if len(file.Rows) == 0 {
+		return nil, errors.New("map "+file.Name+" has no rows", nil)
+	}
+	m := &TileMap{
+		Name:          file.Name,
+		Origin:        file.Origin,
+		Width:         len(file.Rows[0]),
+		Height:        len(file.Rows),
+		SpawnPoints:   file.SpawnPoints,
+		RespawnPoints: file.RespawnPoints,
+		Regions:       file.Regions,
+		Portals:       file.Portals,
+	}
+	if len(m.RespawnPoints) == 0 {
+		m.RespawnPoints = m.SpawnPoints
+	}
+	m.PlayArea = m.Bounds()
+	if file.PlayArea != nil {
+		bounds := m.Bounds()
+		if file.PlayArea.Area() == 0 || !bounds.Contains(file.PlayArea.Min) || !bounds.Contains(file.PlayArea.Max) {
+			return nil, errors.New("map "+file.Name+" play area must lie within the map", nil)
+		}
+		m.PlayArea = *file.PlayArea
+	}
+	death, err := file.Death.rules()
+	if err != nil {
+		return nil, errors.New("map "+file.Name+" has invalid death rules", err)
+	}
+	m.Death = death
+	if len(file.Legend) > math.MaxUint8 {
+		return nil, errors.New("map "+file.Name+" defines too many tile types", nil)
+	}
+	indices := make(map[byte]byte)
+	for key, tileType := range file.Legend {
+		if len(key) != 1 {
+			return nil, errors.New("legend key "+key+" must be a single character", nil)
+		}
+		indices[key[0]] = byte(len(m.Types))
+		m.Types = append(m.Types, tileType)
+	}
+	m.Tiles = make([]byte, m.Width*m.Height)
+	for i, row := range file.Rows {
+		if len(row) != m.Width {
+			return nil, errors.New("map "+file.Name+" rows must all be the same width", nil)
+		}
+		// rows are written top to bottom, tiles are stored bottom to top
+		y := m.Height - 1 - i
+		for x := 0; x < m.Width; x++ {
+			index, ok := indices[row[x]]
+			if !ok {
+				return nil, errors.New("tile "+string(row[x])+" missing from legend", nil)
+			}
+			m.Tiles[y*m.Width+x] = index
+		}
+	}
+	for _, points := range [][]pixel.Vec{m.SpawnPoints, m.RespawnPoints} {
+		for _, spawn := range points {
+			if !m.Walkable(spawn) || !m.PlayArea.Contains(spawn) {
+				return nil, errors.New("spawn point "+spawn.String()+" is not walkable", nil)
+			}
+		}
+	}
+	for _, npc := range file.NPCs {
+		if !m.Walkable(npc.Position) {
+			return nil, errors.New("npc "+npc.ID+" is not placed on a walkable tile", nil)
+		}
+		for _, stack := range npc.Loot {
+			if _, ok := Items[stack.Item]; !ok || stack.Count <= 0 {
+				return nil, errors.New("npc "+npc.ID+" has invalid loot "+stack.String(), nil)
+			}
+		}
+		speed := npc.Speed
+		if speed == 0 {
+			speed = basePlayerSpeed / 2
+		}
+		health := npc.Health
+		if health == 0 {
+			health = baseNPCHealth
+		}
+		m.NPCs = append(m.NPCs, &Entity{
+			ID:          npc.ID,
+			Kind:        E_NPC,
+			Position:    npc.Position,
+			Destination: npc.Position,
+			Speed:       speed,
+			Size:        defaultSize,
+			Solid:       true,
+			Health:      health,
+			MaxHealth:   health,
+			Behavior:    npc.Behavior,
+			Items:       npc.Loot,
+			XPReward:    npc.XP,
+		})
+	}
+	regions := make(map[string]bool)
+	for _, region := range file.Regions {
+		if region.Name == "" || regions[region.Name] {
+			return nil, errors.New("map "+file.Name+" regions must have unique names", nil)
+		}
+		regions[region.Name] = true
+	}
+	// portal destinations can only be checked once the other zones are loaded
+	for _, portal := range file.Portals {
+		if portal.Zone == "" || portal.Area.Area() == 0 {
+			return nil, errors.New("map "+file.Name+" has a portal without zone or area", nil)
+		}
+	}
+	return m, nil
+}
+
+// Bounds returns the area covered by the map in world coordinates
+func (m *TileMap) Bounds() pixel.Rect {
+	return pixel.R(m.Origin.X, m.Origin.Y, m.Origin.X+float64(m.Width), m.Origin.Y+float64(m.Height))
+}
+
+// TileAt returns the type of the tile containing v
+// returns false if v is outside the map
+func (m *TileMap) TileAt(v pixel.Vec) (*TileType, bool) {
+	x := int(math.Floor(v.X - m.Origin.X))
+	y := int(math.Floor(v.Y - m.Origin.Y))
+	return m.tile(x, y)
+}
+
+// ForEach calls f with the world position of the
+// bottom-left corner of each tile and its type
+func (m *TileMap) ForEach(f func(pos pixel.Vec, tileType *TileType)) {
+	for y := 0; y < m.Height; y++ {
+		for x := 0; x < m.Width; x++ {
+			tileType, _ := m.tile(x, y)
+			f(m.Origin.Add(pixel.V(float64(x), float64(y))), tileType)
+		}
+	}
+}
+
+// Walkable returns whether the tile containing v can be walked on
+// anything outside the map is not walkable
+func (m *TileMap) Walkable(v pixel.Vec) bool {
+	tileType, ok := m.TileAt(v)
+	return ok && tileType.Walkable
+}
+
+// Blocked returns whether any tile overlapping rect is not walkable
+// touching the edge of a tile does not count as overlapping
+func (m *TileMap) Blocked(rect pixel.Rect) bool {
+	minX := rect.Min.X - m.Origin.X
+	minY := rect.Min.Y - m.Origin.Y
+	maxX := rect.Max.X - m.Origin.X
+	maxY := rect.Max.Y - m.Origin.Y
+	for y := math.Floor(minY); y < maxY; y++ {
+		for x := math.Floor(minX); x < maxX; x++ {
+			tileType, ok := m.tile(int(x), int(y))
+			if !ok || !tileType.Walkable {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RandomSpawnPoint picks one of the map's spawn points
+// returns false if the map defines none
+func (m *TileMap) RandomSpawnPoint() (pixel.Vec, bool) {
+	if len(m.SpawnPoints) == 0 {
+		return pixel.ZV, false
+	}
+	return m.SpawnPoints[rand.Intn(len(m.SpawnPoints))], true
+}
+
+func (m *TileMap) tile(x, y int) (*TileType, bool) {
+	if x < 0 || y < 0 || x >= m.Width || y >= m.Height {
+		return nil, false
+	}
+	index := int(m.Tiles[y*m.Width+x])
+	if index >= len(m.Types) {
+		return nil, false
+	}
+	return &m.Types[index], true
+}
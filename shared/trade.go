@@ -0,0 +1,329 @@
+package shared
+
+import (
+	"sort"
+
+	"github.com/ilackarms/pkg/errors"
+)
+
+const (
+	// how close two players have to stay while trading
+	tradeRange = 4.0
+)
+
+// Trade is an exchange of items between two players
+// a trade starts when From asks To, and is open once To accepts it.
+// both players then offer items; once both have confirmed the same offers,
+// the authoritative world swaps the items in one go
+// trades are known by the ID of the player who asked for them
+type Trade struct {
+	From     string
+	To       string
+	Accepted bool
+	FromSide TradeSide
+	ToSide   TradeSide
+}
+
+// TradeSide is what one of the players in a trade gives
+type TradeSide struct {
+	// currency is offered as a stack of gold
+	Offer     []ItemStack `,omitempty`
+	Confirmed bool
+}
+
+func (t *Trade) DeepCopy() *Trade {
+	cpy := *t
+	cpy.FromSide.Offer = copyStacks(t.FromSide.Offer)
+	cpy.ToSide.Offer = copyStacks(t.ToSide.Offer)
+	return &cpy
+}
+
+// Involves returns whether the player with id is part of the trade
+func (t *Trade) Involves(id string) bool {
+	return t.From == id || t.To == id
+}
+
+// Side returns the side of the trade of the player with id
+func (t *Trade) Side(id string) *TradeSide {
+	if id == t.From {
+		return &t.FromSide
+	}
+	return &t.ToSide
+}
+
+// Partner returns who the player with id trades with
+func (t *Trade) Partner(id string) string {
+	if id == t.From {
+		return t.To
+	}
+	return t.From
+}
+
+// GetTrade returns a copy of the open or requested trade
+// the player with id is part of, preferring open trades
+func (w *World) GetTrade(id string) (*Trade, bool) {
+	w.playersLock.RLock()
+	defer w.playersLock.RUnlock()
+	var found *Trade
+	for _, tradeID := range w.tradeIDs() {
+		trade := w.Trades[tradeID]
+		if trade.Involves(id) && (found == nil || trade.Accepted) {
+			found = trade
+		}
+	}
+	if found == nil {
+		return nil, false
+	}
+	return found.DeepCopy(), true
+}
+
+// caller must hold playersLock
+func (w *World) tradeIDs() []string {
+	ids := make([]string, 0, len(w.Trades))
+	for id := range w.Trades {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// openTrade returns the accepted trade the player with id is part of
+// caller must hold playersLock
+func (w *World) openTrade(id string) (*Trade, error) {
+	for _, tradeID := range w.tradeIDs() {
+		trade := w.Trades[tradeID]
+		if trade.Accepted && trade.Involves(id) {
+			return trade, nil
+		}
+	}
+	return nil, errors.New("player "+id+" is not trading", nil)
+}
+
+// traders returns both players of a trade if they are still able to trade
+// caller must hold playersLock
+func (w *World) traders(from, to string) (*Player, *Player, error) {
+	fromPlayer, err := w.getLivingPlayer(from)
+	if err != nil {
+		return nil, nil, err
+	}
+	toPlayer, err := w.getLivingPlayer(to)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !WithinRange(fromPlayer.Position, toPlayer.Position, tradeRange) {
+		return nil, nil, errors.New("players "+from+" and "+to+" are too far apart to trade", nil)
+	}
+	return fromPlayer, toPlayer, nil
+}
+
+// tradeChanged tells both players of trade what it looks like now
+// caller must hold playersLock
+func (w *World) tradeChanged(trade *Trade) {
+	for _, id := range []string{trade.From, trade.To} {
+		w.finishUpdate(&Update{TradeChanged: &TradeChanged{ID: id, Trade: trade.DeepCopy()}})
+	}
+}
+
+// closeTrade ends trade and tells both players why
+// caller must hold playersLock
+func (w *World) closeTrade(trade *Trade, completed bool, reason string) {
+	delete(w.Trades, trade.From)
+	for _, id := range []string{trade.From, trade.To} {
+		w.finishUpdate(&Update{TradeClosed: &TradeClosed{
+			ID:        id,
+			TradeID:   trade.From,
+			Completed: completed,
+			Reason:    reason,
+		}})
+	}
+}
+
+// closeTradesOf closes every trade the player with id is part of,
+// except keep
+// caller must hold playersLock
+func (w *World) closeTradesOf(id string, keep *Trade, reason string) {
+	for _, tradeID := range w.tradeIDs() {
+		trade := w.Trades[tradeID]
+		if trade != keep && trade.Involves(id) {
+			w.closeTrade(trade, false, reason)
+		}
+	}
+}
+
+// checkTrades closes trades whose players have left, died or walked apart
+// caller must hold playersLock
+func (w *World) checkTrades() {
+	for _, tradeID := range w.tradeIDs() {
+		trade := w.Trades[tradeID]
+		if _, _, err := w.traders(trade.From, trade.To); err != nil {
+			w.closeTrade(trade, false, err.Error())
+		}
+	}
+}
+
+// exchange swaps the offers of both players of trade
+// if either player can not hold what they get, neither inventory is changed
+// caller must hold playersLock
+func (w *World) exchange(trade *Trade, from, to *Player) error {
+	fromInventory := from.Inventory.DeepCopy()
+	toInventory := to.Inventory.DeepCopy()
+	for _, stack := range trade.FromSide.Offer {
+		if err := fromInventory.Remove(stack.Item, stack.Count); err != nil {
+			return err
+		}
+	}
+	for _, stack := range trade.ToSide.Offer {
+		if err := toInventory.Remove(stack.Item, stack.Count); err != nil {
+			return err
+		}
+	}
+	if err := fromInventory.Add(trade.ToSide.Offer...); err != nil {
+		return errors.New(from.ID+" can not take the offer", err)
+	}
+	if err := toInventory.Add(trade.FromSide.Offer...); err != nil {
+		return errors.New(to.ID+" can not take the offer", err)
+	}
+	from.Inventory = fromInventory
+	to.Inventory = toInventory
+	w.inventoryChanged(from)
+	w.inventoryChanged(to)
+	return nil
+}
+
+// the trade updates below are only resolved by the authoritative world,
+// which sends out the resulting TradeChanged and TradeClosed updates
+
+func (w *World) applyTradeRequested(requested *TradeRequested) error {
+	if !w.authoritative {
+		return nil
+	}
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	if requested.ID == requested.With {
+		return errors.New("player "+requested.ID+" can not trade with itself", nil)
+	}
+	if _, _, err := w.traders(requested.ID, requested.With); err != nil {
+		return err
+	}
+	if _, err := w.openTrade(requested.ID); err == nil {
+		return errors.New("player "+requested.ID+" is already trading", nil)
+	}
+	if _, err := w.openTrade(requested.With); err == nil {
+		return errors.New("player "+requested.With+" is already trading", nil)
+	}
+	// asking again replaces an earlier request
+	if old, ok := w.Trades[requested.ID]; ok {
+		w.closeTrade(old, false, "request withdrawn")
+	}
+	trade := &Trade{From: requested.ID, To: requested.With}
+	w.Trades[trade.From] = trade
+	w.tradeChanged(trade)
+	return nil
+}
+
+func (w *World) applyTradeAccepted(accepted *TradeAccepted) error {
+	if !w.authoritative {
+		return nil
+	}
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	trade, ok := w.Trades[accepted.With]
+	if !ok || trade.To != accepted.ID || trade.Accepted {
+		return errors.New("player "+accepted.With+" did not ask "+accepted.ID+" to trade", nil)
+	}
+	if _, _, err := w.traders(trade.From, trade.To); err != nil {
+		return err
+	}
+	trade.Accepted = true
+	// players only trade with one other player at a time
+	w.closeTradesOf(trade.From, trade, trade.From+" is trading with someone else")
+	w.closeTradesOf(trade.To, trade, trade.To+" is trading with someone else")
+	w.tradeChanged(trade)
+	return nil
+}
+
+func (w *World) applyTradeOffered(offered *TradeOffered) error {
+	if !w.authoritative {
+		return nil
+	}
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	trade, err := w.openTrade(offered.ID)
+	if err != nil {
+		return err
+	}
+	player, err := w.getLivingPlayer(offered.ID)
+	if err != nil {
+		return err
+	}
+	// the offer must be in the inventory now; it is checked again on exchange
+	inventory := player.Inventory.DeepCopy()
+	for _, stack := range offered.Offer {
+		if err := inventory.Remove(stack.Item, stack.Count); err != nil {
+			return err
+		}
+	}
+	trade.Side(offered.ID).Offer = copyStacks(offered.Offer)
+	// a changed offer has to be confirmed again by both players
+	trade.FromSide.Confirmed = false
+	trade.ToSide.Confirmed = false
+	w.tradeChanged(trade)
+	return nil
+}
+
+func (w *World) applyTradeConfirmed(confirmed *TradeConfirmed) error {
+	if !w.authoritative {
+		return nil
+	}
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	trade, err := w.openTrade(confirmed.ID)
+	if err != nil {
+		return err
+	}
+	trade.Side(confirmed.ID).Confirmed = true
+	if !trade.FromSide.Confirmed || !trade.ToSide.Confirmed {
+		w.tradeChanged(trade)
+		return nil
+	}
+	from, to, err := w.traders(trade.From, trade.To)
+	if err == nil {
+		err = w.exchange(trade, from, to)
+	}
+	if err != nil {
+		w.closeTrade(trade, false, err.Error())
+		return err
+	}
+	w.closeTrade(trade, true, "trade completed")
+	return nil
+}
+
+func (w *World) applyTradeCancelled(cancelled *TradeCancelled) error {
+	if !w.authoritative {
+		return nil
+	}
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	w.closeTradesOf(cancelled.ID, nil, "cancelled by "+cancelled.ID)
+	return nil
+}
+
+func (w *World) applyTradeChanged(changed *TradeChanged) error {
+	if changed.Trade == nil {
+		return errors.New("no trade given to change", nil)
+	}
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	if w.Trades == nil {
+		w.Trades = make(map[string]*Trade)
+	}
+	w.Trades[changed.Trade.From] = changed.Trade.DeepCopy()
+	return nil
+}
+
+func (w *World) applyTradeClosed(closed *TradeClosed) error {
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
+	delete(w.Trades, closed.TradeID)
+	return nil
+}
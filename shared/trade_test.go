@@ -0,0 +1,201 @@
+package shared
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/faiface/pixel"
+)
+
+func offer(id string, stacks ...ItemStack) *Update {
+	return &Update{TradeOffered: &TradeOffered{ID: id, Offer: stacks}}
+}
+
+func confirm(id string) *Update {
+	return &Update{TradeConfirmed: &TradeConfirmed{ID: id}}
+}
+
+// tradeWorld returns an authoritative world in which players a and b
+// stand next to each other, carry the given items and have opened a trade
+func tradeWorld(t *testing.T, a, b Inventory) *World {
+	w := NewEmptyWorld()
+	w.SetAuthoritative()
+	go func() {
+		for range w.ProcessedUpdates() {
+		}
+	}()
+	if err := w.ApplyUpdates(
+		&Update{AddPlayer: &AddPlayer{ID: "a", Position: pixel.V(0, 0)}},
+		&Update{AddPlayer: &AddPlayer{ID: "b", Position: pixel.V(1, 0)}},
+		&Update{InventoryChanged: &InventoryChanged{ID: "a", Inventory: a}},
+		&Update{InventoryChanged: &InventoryChanged{ID: "b", Inventory: b}},
+		&Update{TradeRequested: &TradeRequested{ID: "a", With: "b"}},
+		&Update{TradeAccepted: &TradeAccepted{ID: "b", With: "a"}},
+	); err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestTrade(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	for _, test := range []struct {
+		name    string
+		a, b    Inventory
+		updates []*Update
+		// whether the last update is refused
+		fails bool
+		// inventories afterwards
+		expectA, expectB Inventory
+		// whether the trade is still open, and the confirmations of a and b
+		open      bool
+		confirmed [2]bool
+	}{
+		{
+			name:    "exchange",
+			a:       Inventory{{"gold", 15}},
+			b:       Inventory{{"short-sword", 1}, {"bread", 2}},
+			updates: []*Update{offer("a", ItemStack{"gold", 10}), offer("b", ItemStack{"short-sword", 1}), confirm("b"), confirm("a")},
+			expectA: Inventory{{"gold", 5}, {"short-sword", 1}},
+			expectB: Inventory{{"bread", 2}, {"gold", 10}},
+		},
+		{
+			name:    "gift",
+			a:       Inventory{{"bread", 3}},
+			updates: []*Update{offer("a", ItemStack{"bread", 3}), confirm("a"), confirm("b")},
+			expectB: Inventory{{"bread", 3}},
+		},
+		{
+			name:      "waiting for the other side",
+			a:         Inventory{{"gold", 15}},
+			b:         Inventory{{"short-sword", 1}},
+			updates:   []*Update{offer("a", ItemStack{"gold", 10}), offer("b", ItemStack{"short-sword", 1}), confirm("a")},
+			expectA:   Inventory{{"gold", 15}},
+			expectB:   Inventory{{"short-sword", 1}},
+			open:      true,
+			confirmed: [2]bool{true, false},
+		},
+		{
+			name: "changed offer resets both confirmations",
+			a:    Inventory{{"gold", 15}},
+			b:    Inventory{{"short-sword", 1}, {"bread", 2}},
+			updates: []*Update{offer("a", ItemStack{"gold", 10}), offer("b", ItemStack{"short-sword", 1}), confirm("a"),
+				offer("b", ItemStack{"bread", 1})},
+			expectA: Inventory{{"gold", 15}},
+			expectB: Inventory{{"short-sword", 1}, {"bread", 2}},
+			open:    true,
+		},
+		{
+			name: "confirming after a change does not complete the trade",
+			a:    Inventory{{"gold", 15}},
+			b:    Inventory{{"short-sword", 1}, {"bread", 2}},
+			updates: []*Update{offer("a", ItemStack{"gold", 10}), offer("b", ItemStack{"short-sword", 1}), confirm("a"),
+				offer("b", ItemStack{"bread", 1}), confirm("b")},
+			expectA:   Inventory{{"gold", 15}},
+			expectB:   Inventory{{"short-sword", 1}, {"bread", 2}},
+			open:      true,
+			confirmed: [2]bool{false, true},
+		},
+		{
+			name:    "offer not carried",
+			a:       Inventory{{"gold", 15}},
+			updates: []*Update{offer("a", ItemStack{"gold", 20})},
+			fails:   true,
+			expectA: Inventory{{"gold", 15}},
+			open:    true,
+		},
+		{
+			name: "offer spent before the exchange",
+			a:    Inventory{{"gold", 15}},
+			b:    Inventory{{"short-sword", 1}},
+			updates: []*Update{offer("a", ItemStack{"gold", 10}), offer("b", ItemStack{"short-sword", 1}), confirm("a"),
+				{InventoryChanged: &InventoryChanged{ID: "a", Inventory: Inventory{{"gold", 5}}}}, confirm("b")},
+			fails:   true,
+			expectA: Inventory{{"gold", 5}},
+			expectB: Inventory{{"short-sword", 1}},
+		},
+		{
+			name:    "no room for the offer",
+			a:       Inventory{{"bread", 1}},
+			b:       fullInventory(),
+			updates: []*Update{offer("a", ItemStack{"bread", 1}), confirm("a"), confirm("b")},
+			fails:   true,
+			expectA: Inventory{{"bread", 1}},
+			expectB: fullInventory(),
+		},
+	} {
+		w := tradeWorld(t, test.a, test.b)
+		var err error
+		for i, update := range test.updates {
+			err = w.ApplyUpdates(update)
+			if err != nil && i < len(test.updates)-1 {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+		}
+		if test.fails != (err != nil) {
+			t.Errorf("%s: expected last update to fail: %v, got %v", test.name, test.fails, err)
+		}
+		a, _ := w.GetPlayer("a")
+		b, _ := w.GetPlayer("b")
+		if fmt.Sprint(a.Inventory) != fmt.Sprint(test.expectA) || fmt.Sprint(b.Inventory) != fmt.Sprint(test.expectB) {
+			t.Errorf("%s: expected inventories %v and %v, got %v and %v", test.name, test.expectA, test.expectB, a.Inventory, b.Inventory)
+		}
+		trade, ok := w.GetTrade("a")
+		if ok != test.open {
+			t.Errorf("%s: expected trade to be open: %v, got %v", test.name, test.open, ok)
+			continue
+		}
+		if ok && [2]bool{trade.FromSide.Confirmed, trade.ToSide.Confirmed} != test.confirmed {
+			t.Errorf("%s: expected confirmations %v, got %v", test.name, test.confirmed, [2]bool{trade.FromSide.Confirmed, trade.ToSide.Confirmed})
+		}
+	}
+}
+
+func TestTradeRequestedAgain(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	w := NewEmptyWorld()
+	w.SetAuthoritative()
+	// b applies the trade updates the server would send it
+	b := NewEmptyWorld()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for update := range w.ProcessedUpdates() {
+			switch {
+			case update.TradeChanged != nil && update.TradeChanged.ID == "b",
+				update.TradeClosed != nil && update.TradeClosed.ID == "b":
+				if err := b.ApplyUpdates(update); err != nil {
+					t.Error(err)
+				}
+			case update.AddPlayer != nil && update.AddPlayer.ID == "c":
+				// everything before has been seen
+				return
+			}
+		}
+	}()
+	if err := w.ApplyUpdates(
+		&Update{AddPlayer: &AddPlayer{ID: "a", Position: pixel.V(0, 0)}},
+		&Update{AddPlayer: &AddPlayer{ID: "b", Position: pixel.V(1, 0)}},
+		&Update{TradeRequested: &TradeRequested{ID: "a", With: "b"}},
+		&Update{TradeRequested: &TradeRequested{ID: "a", With: "b"}},
+		&Update{AddPlayer: &AddPlayer{ID: "c", Position: pixel.V(5, 5)}},
+	); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected every update to be processed")
+	}
+	if _, ok := b.Trades["a"]; !ok {
+		t.Fatal("expected the second request to replace the first, not to be closed with it")
+	}
+}
@@ -5,8 +5,6 @@ import (
 	"image/color"
 	"strings"
 	"time"
-
-	"github.com/faiface/pixel"
 )
 
 const fatalErrSig = "**FATAL_ERR**"
@@ -16,22 +14,18 @@ type ClientPlayer struct {
 	Color  color.Color
 }
 
+// Player is the entity controlled by a connected client
 type Player struct {
-	// global unique UUID
-	ID string
-	// cartesian coordinates
-	Position    pixel.Vec
-	Destination pixel.Vec
-	// speed is the magnitude of player's velocity
-	// in any direction of movement
-	Speed float64
-	// size in 2 dimensions (x=w, y=h)
-	Size pixel.Vec
+	Entity `,inline`
+	// kept between sessions; see PlayerRecord
+	PlayerRecord `,inline`
 	// player speech; max buffer size 4
 	SpeechBuffer []SpeechMesage
-	// if set to false, player is treaded as though it has been deleted
-	// this allows us to activate/deactivate players without deleting from state
-	Active bool
+	// sequence number of the last move of the player applied by
+	// the server, and the tick it was applied at
+	// clients check their predicted movement against these
+	Ack     uint64 `,omitempty`
+	AckTick uint64 `,omitempty`
 }
 
 func (p *Player) DeepCopy() *Player {
@@ -40,13 +34,11 @@ func (p *Player) DeepCopy() *Player {
 		speechCopy[i] = txt
 	}
 	return &Player{
-		ID:           p.ID,
-		Position:     p.Position,
-		Destination:  p.Destination,
-		Speed:        p.Speed,
-		Size:         p.Size,
+		Entity:       *p.Entity.DeepCopy(),
+		PlayerRecord: *p.PlayerRecord.DeepCopy(),
 		SpeechBuffer: speechCopy,
-		Active:       p.Active,
+		Ack:          p.Ack,
+		AckTick:      p.AckTick,
 	}
 }
 
@@ -11,6 +11,14 @@ import (
 
 const (
 	basePlayerSpeed = 2.0
+
+	// TicksPerSecond is the fixed rate at which every world is simulated
+	// server and clients step with the same dt so their simulations agree
+	TicksPerSecond = 10
+	TickDuration   = time.Second / TicksPerSecond
+
+	// processed updates that can wait to be read without being queued
+	processedBuffer = 1024
 )
 
 var (
@@ -20,22 +28,94 @@ var (
 type World struct {
 	//needs to be exported to support serialization
 	//treat this field as unexported
-	Players     map[string]*Player
+	Players map[string]*Player
+	// every entity that is not a player, by ID
+	Entities map[string]*Entity
+	// projectiles in flight, by ID
+	Projectiles map[string]*Projectile
+	// requested and open trades, by the ID of the player who asked
+	// clients only know about their own trades
+	Trades map[string]*Trade
+	// guards Players, Entities, Projectiles and Trades
 	playersLock sync.RWMutex
+	// terrain of the world; may be nil for a world without terrain
+	// the map is never modified after loading and is shared between snapshots
+	Map *TileMap
+	// index of active entity hitboxes, built lazily
+	// so that deserialized worlds and snapshots get one too
+	index     *SpatialHash
+	indexOnce sync.Once
 	// these are used for creating a series of buffered world snapshots
 	//automatically created on each step
 	previous *World
 	Updated  time.Time
+	// number of steps simulated so far
+	Tick uint64
+	// time passed to Advance that has not been simulated yet
+	accumulated time.Duration
+	// see SetAuthoritative
+	authoritative bool
+	// see SetProgression
+	progression *Progression
 	// processed is for updates that have been processed
 	processed chan *Update
+	// processed updates not sent on processed yet, oldest first
+	// guarded by pendingLock, see finishUpdate
+	pending     []*Update
+	forwarding  bool
+	pendingLock sync.Mutex
 }
 
 func NewEmptyWorld() *World {
 	return &World{
-		Players:   make(map[string]*Player),
-		processed: make(chan *Update),
-		Updated:   time.Now(),
+		Players:     make(map[string]*Player),
+		Entities:    make(map[string]*Entity),
+		Projectiles: make(map[string]*Projectile),
+		Trades:      make(map[string]*Trade),
+		processed:   make(chan *Update, processedBuffer),
+		Updated:     time.Now(),
+	}
+}
+
+// NewWorld creates an empty world with terrain
+func NewWorld(tileMap *TileMap) *World {
+	w := NewEmptyWorld()
+	w.Map = tileMap
+	return w
+}
+
+// SetAuthoritative makes this world the one that thinks for npcs
+// and resolves combat. only the server's world should be authoritative;
+// other worlds follow along through the updates it produces
+func (w *World) SetAuthoritative() {
+	w.authoritative = true
+}
+
+// PlayArea returns the area entities may move in
+// returns false for worlds without a map, which have no bounds
+func (w *World) PlayArea() (pixel.Rect, bool) {
+	if w.Map == nil {
+		return pixel.Rect{}, false
 	}
+	return w.Map.PlayArea, true
+}
+
+// InPlayArea returns whether v is a valid position within the play area
+func (w *World) InPlayArea(v pixel.Vec) bool {
+	if !Finite(v) {
+		return false
+	}
+	area, ok := w.PlayArea()
+	return !ok || area.Contains(v)
+}
+
+// ClampToPlayArea returns the point of the play area closest to v
+func (w *World) ClampToPlayArea(v pixel.Vec) pixel.Vec {
+	area, ok := w.PlayArea()
+	if !ok {
+		return v
+	}
+	return ClampVec(v, area)
 }
 
 func (w *World) ProcessedUpdates() <-chan *Update {
@@ -44,23 +124,92 @@ func (w *World) ProcessedUpdates() <-chan *Update {
 
 func (w *World) DeepCopy() *World {
 	cpy := NewEmptyWorld()
+	w.playersLock.RLock()
+	defer w.playersLock.RUnlock()
 	if w.previous != nil {
 		cpy.previous = w.previous.DeepCopy()
 	}
-	w.playersLock.RLock()
-	defer w.playersLock.RUnlock()
 	for id, player := range w.Players {
 		cpy.Players[id] = player.DeepCopy()
 	}
+	for id, entity := range w.Entities {
+		cpy.Entities[id] = entity.DeepCopy()
+	}
+	for id, projectile := range w.Projectiles {
+		cpy.Projectiles[id] = projectile.DeepCopy()
+	}
+	for id, trade := range w.Trades {
+		cpy.Trades[id] = trade.DeepCopy()
+	}
 	cpy.Updated = w.Updated
+	cpy.Tick = w.Tick
+	cpy.Map = w.Map
+	return cpy
+}
+
+// VisibleTo returns a copy of w without the state
+// that only the player with id may see, such as other players' inventories
+func (w *World) VisibleTo(id string) *World {
+	cpy := w.DeepCopy()
+	cpy.previous = nil
+	for playerID, player := range cpy.Players {
+		if playerID != id {
+			player.PlayerRecord = PlayerRecord{
+				Progress:   Progress{Level: player.Level},
+				Appearance: player.Appearance,
+			}
+		}
+	}
+	for tradeID, trade := range cpy.Trades {
+		if !trade.Involves(id) {
+			delete(cpy.Trades, tradeID)
+		}
+	}
 	return cpy
 }
 
 func (w *World) finishUpdate(update *Update) {
 	update.Processed = time.Now()
-	go func() {
+	update.Tick = w.Tick
+	// worlds received from the server have no channel,
+	// nobody could ever read from it
+	if w.processed == nil {
+		return
+	}
+	// the caller holds playersLock while whoever reads the updates
+	// may be waiting for it, so sending must never block.
+	// once the buffer is full, updates are queued for a single goroutine
+	// to send, and so are all that follow until the queue is empty,
+	// so that they arrive in the order they happened
+	w.pendingLock.Lock()
+	defer w.pendingLock.Unlock()
+	if !w.forwarding {
+		select {
+		case w.processed <- update:
+			return
+		default:
+		}
+		w.forwarding = true
+		go w.forwardProcessed()
+	}
+	w.pending = append(w.pending, update)
+}
+
+// forwardProcessed sends pending updates on processed until there are none left
+func (w *World) forwardProcessed() {
+	for {
+		w.pendingLock.Lock()
+		if len(w.pending) == 0 {
+			w.forwarding = false
+			w.pendingLock.Unlock()
+			return
+		}
+		update := w.pending[0]
+		w.pending[0] = nil
+		w.pending = w.pending[1:]
+		w.pendingLock.Unlock()
 		w.processed <- update
-	}()
+	}
 }
 
 func (w *World) ApplyUpdates(updates ...*Update) error {
@@ -90,9 +239,103 @@ func (w *World) applyUpdate(update *Update) error {
 	if update.WorldState != nil {
 		return w.setWorldState(update.WorldState)
 	}
+	if update.PlayerSynced != nil {
+		return w.applyPlayerSynced(update.PlayerSynced)
+	}
 	if update.RemovePlayer != nil {
 		return w.applyRemovePlayer(update.RemovePlayer)
 	}
+	if update.PlayerPortaled != nil {
+		// only the server acts on portals
+		return nil
+	}
+	if update.AddEntity != nil {
+		return w.addEntity(update.AddEntity)
+	}
+	if update.EntityDestination != nil {
+		return w.updateEntityDestination(update.EntityDestination)
+	}
+	if update.EntityPosition != nil {
+		return w.updateEntityPosition(update.EntityPosition)
+	}
+	if update.RemoveEntity != nil {
+		return w.applyRemoveEntity(update.RemoveEntity)
+	}
+	if update.EntityAttacked != nil {
+		return w.applyAttack(update.EntityAttacked)
+	}
+	if update.EntityDamaged != nil {
+		return w.applyDamaged(update.EntityDamaged)
+	}
+	if update.EntityDied != nil {
+		return w.applyDied(update.EntityDied)
+	}
+	if update.PlayerRespawned != nil {
+		return w.applyRespawn(update.PlayerRespawned)
+	}
+	if update.EntityRespawned != nil {
+		return w.applyEntityRespawned(update.EntityRespawned)
+	}
+	if update.EntityHealed != nil {
+		return w.applyHealed(update.EntityHealed)
+	}
+	if update.ItemPickedUp != nil {
+		return w.applyItemPickedUp(update.ItemPickedUp)
+	}
+	if update.ItemDropped != nil {
+		return w.applyItemDropped(update.ItemDropped)
+	}
+	if update.ItemUsed != nil {
+		return w.applyItemUsed(update.ItemUsed)
+	}
+	if update.InventoryChanged != nil {
+		return w.applyInventoryChanged(update.InventoryChanged)
+	}
+	if update.ItemEquipped != nil {
+		return w.applyItemEquipped(update.ItemEquipped)
+	}
+	if update.ItemUnequipped != nil {
+		return w.applyItemUnequipped(update.ItemUnequipped)
+	}
+	if update.StatsChanged != nil {
+		return w.applyStatsChanged(update.StatsChanged)
+	}
+	if update.ExperienceGained != nil {
+		return w.applyExperienceGained(update.ExperienceGained)
+	}
+	if update.ExperienceChanged != nil {
+		return w.applyExperienceChanged(update.ExperienceChanged)
+	}
+	if update.LevelUp != nil {
+		return w.applyLevelUp(update.LevelUp)
+	}
+	if update.TradeRequested != nil {
+		return w.applyTradeRequested(update.TradeRequested)
+	}
+	if update.TradeAccepted != nil {
+		return w.applyTradeAccepted(update.TradeAccepted)
+	}
+	if update.TradeOffered != nil {
+		return w.applyTradeOffered(update.TradeOffered)
+	}
+	if update.TradeConfirmed != nil {
+		return w.applyTradeConfirmed(update.TradeConfirmed)
+	}
+	if update.TradeCancelled != nil {
+		return w.applyTradeCancelled(update.TradeCancelled)
+	}
+	if update.TradeChanged != nil {
+		return w.applyTradeChanged(update.TradeChanged)
+	}
+	if update.TradeClosed != nil {
+		return w.applyTradeClosed(update.TradeClosed)
+	}
+	if update.ProjectileSpawned != nil {
+		return w.applyProjectileSpawned(update.ProjectileSpawned)
+	}
+	if update.ProjectileImpact != nil {
+		return w.applyProjectileImpact(update.ProjectileImpact)
+	}
 	return errors.New("empty update given? wtf", nil)
 }
 
@@ -117,6 +360,8 @@ func (w *World) Before(t time.Time) *World {
 }
 
 func (w *World) Prev() *World {
+	w.playersLock.RLock()
+	defer w.playersLock.RUnlock()
 	return w.previous
 }
 
@@ -137,57 +382,171 @@ func (w *World) Trim(t time.Time) {
 }
 
 // Keep drops all snapshots after the nth
+// every step adds one, so worlds that are stepped should call this
+// after stepping to keep their history from growing without bound
 func (w *World) Keep(n int) {
-	if n == 1 {
-		w.previous = nil
-	}
+	w.playersLock.Lock()
+	defer w.playersLock.Unlock()
 	// n should always be >= 1
-	if n < 1 {
+	if n <= 1 {
+		w.previous = nil
 		return
 	}
-	w.Keep(n - 1)
+	if w.previous != nil {
+		w.previous.Keep(n - 1)
+	}
+}
+
+// Advance steps the world once for every TickDuration in elapsed
+// time left over is carried into the next call to Advance
+// returns the number of steps taken
+func (w *World) Advance(elapsed time.Duration) (int, error) {
+	w.accumulated += elapsed
+	steps := 0
+	for w.accumulated >= TickDuration {
+		w.accumulated -= TickDuration
+		if err := w.Step(); err != nil {
+			return steps, err
+		}
+		steps++
+	}
+	return steps, nil
 }
 
 // process game-world self update
 // step wraps the previous state for rolling back
-func (w *World) Step(dt time.Duration) (err error) {
-	w.previous = w.DeepCopy()
-	w.Updated = time.Now()
+// every step simulates exactly TickDuration, so stepping two worlds
+// with the same state and updates always gives the same result
+func (w *World) Step() (err error) {
+	previous := w.DeepCopy()
 	w.playersLock.Lock()
 	defer w.playersLock.Unlock()
-	for id, player := range w.Players {
-		// update player positions based on speed and destination
-		if !WithinRange(player.Destination, player.Position, 0.5) {
-			// TODO change this to use astar pathing
-			//newPos := RoundVec(player.Position.Add(player.Destination.Sub(player.Position).Unit().Scaled(player.Speed*dt.Seconds())), 2)
-			newPos := player.Position.Add(player.Destination.Sub(player.Position).Unit().Scaled(player.Speed * dt.Seconds()))
-			//newPos := player.Destination
-			//check collisions
-			var collisionFound bool
-			hitbox := RectFromCenter(newPos, player.Size.X, player.Size.Y)
-			for otherID, otherPlayer := range w.Players {
-				// player cant collide with self
-				if id == otherID {
-					continue
-				}
-				otherHitbox := RectFromCenter(otherPlayer.Position, otherPlayer.Size.X, otherPlayer.Size.Y)
-				if hitbox.Intersect(otherHitbox).Area() > 0 {
-					collisionFound = true
-					break
-				}
+	w.previous = previous
+	w.Updated = time.Now()
+	w.Tick++
+	dt := TickDuration
+	// entities are always stepped in the same order so that
+	// the server and clients reach the same result
+	ids := w.activeEntityIDs()
+	w.finishActions(ids)
+	if w.authoritative {
+		w.respawnNPCs()
+		for _, id := range ids {
+			entity := w.entity(id)
+			if entity.Alive() && w.think(entity) {
+				w.finishUpdate(&Update{EntityDestination: &EntityDestination{ID: id, Destination: entity.Destination}})
 			}
-			if collisionFound {
-				continue
+		}
+	}
+	// entities that moved, or started or stopped walking
+	moved := make(map[string]bool)
+	walking := make(map[string]bool)
+	// push apart entities that overlap, e.g. after spawning on the same spot
+	for _, id := range ids {
+		for _, otherID := range w.separate(w.entity(id), dt) {
+			moved[id] = true
+			moved[otherID] = true
+		}
+	}
+	for _, id := range ids {
+		entity := w.entity(id)
+		// update entity positions based on speed and destination
+		if delta := walkDelta(entity, dt); delta != pixel.ZV {
+			newPos := w.slide(entity, delta)
+			if newPos != entity.Position {
+				w.setPosition(entity, newPos)
+				moved[id] = true
+				walking[id] = true
+				w.face(entity, delta)
 			}
-			player.Position = newPos
-			log.Printf("player updated to: %#v", player)
-			// on new player position, send internal update
-			w.finishUpdate(&Update{PlayerPosition: &PlayerPosition{ID: player.ID, Position: newPos}})
+		}
+		if w.setMotion(entity, entity.Facing, walking[id]) {
+			moved[id] = true
+		}
+	}
+	w.stepProjectiles()
+	if w.authoritative {
+		w.checkTrades()
+	}
+	for _, id := range ids {
+		if !moved[id] {
+			continue
+		}
+		entity := w.entity(id)
+		log.Printf("%s updated to: %#v", entity.Kind, entity)
+		// on new entity position, send internal update
+		if entity.Kind == E_PLAYER {
+			player := w.Players[id]
+			w.finishUpdate(&Update{PlayerPosition: &PlayerPosition{
+				ID:       entity.ID,
+				Position: entity.Position,
+				Facing:   entity.Facing,
+				Walking:  walking[id],
+				Ack:      player.Ack,
+				AckTick:  player.AckTick,
+			}})
+			if w.authoritative {
+				w.explore(w.Players[id])
+				w.enterPortal(w.Players[id])
+			}
+		} else {
+			w.finishUpdate(&Update{EntityPosition: &EntityPosition{
+				ID:       entity.ID,
+				Position: entity.Position,
+				Facing:   entity.Facing,
+				Walking:  walking[id],
+			}})
 		}
 	}
 	return nil
 }
 
+// QueryRect returns the active entities, including players,
+// whose hitboxes overlap rect
+// Entities returned by QueryRect should be read-only
+func (w *World) QueryRect(rect pixel.Rect) []*Entity {
+	w.playersLock.RLock()
+	defer w.playersLock.RUnlock()
+	return w.entitiesByID(w.spatialIndex().QueryRect(rect))
+}
+
+// QueryRadius returns the active entities, including players,
+// positioned within radius of center
+// Entities returned by QueryRadius should be read-only
+func (w *World) QueryRadius(center pixel.Vec, radius float64) []*Entity {
+	w.playersLock.RLock()
+	defer w.playersLock.RUnlock()
+	return w.entitiesByID(w.spatialIndex().QueryRadius(center, radius))
+}
+
+// caller must hold playersLock
+func (w *World) entitiesByID(ids []string) []*Entity {
+	entities := make([]*Entity, len(ids))
+	for i, id := range ids {
+		entities[i] = w.entity(id)
+	}
+	return entities
+}
+
+// spatialIndex returns the index of active entities, building it on first use
+// caller must hold playersLock
+func (w *World) spatialIndex() *SpatialHash {
+	w.indexOnce.Do(func() {
+		w.index = NewSpatialHash(spatialCellSize)
+		for id, player := range w.Players {
+			if player.Active {
+				w.index.Insert(id, player.Hitbox())
+			}
+		}
+		for id, entity := range w.Entities {
+			if entity.Active {
+				w.index.Insert(id, entity.Hitbox())
+			}
+		}
+	})
+	return w.index
+}
+
 // GetPlayer returns a referece to player
 // PLEASE do not use this reference to modify player directly!
 // Objects returned by GetPlayer should be read-only
@@ -200,6 +559,18 @@ func (w *World) GetPlayer(id string) (*Player, bool) {
 	return player, true
 }
 
+// GetRecord returns a copy of the record of player id,
+// taken while the world is not changing it
+func (w *World) GetRecord(id string) (*PlayerRecord, bool) {
+	w.playersLock.RLock()
+	defer w.playersLock.RUnlock()
+	player, ok := w.Players[id]
+	if !ok {
+		return nil, false
+	}
+	return player.PlayerRecord.DeepCopy(), true
+}
+
 // ForEach calls f on each player in the world
 // PLEASE do not use this to modify player
 // This is intended for reading only
@@ -217,17 +588,42 @@ func (w *World) addPlayer(added *AddPlayer) error {
 		if player.Active {
 			return errors.New("player "+added.ID+" already active!", nil)
 		}
+		w.playersLock.Lock()
 		player.Active = true
+		w.spatialIndex().Insert(added.ID, player.Hitbox())
+		w.playersLock.Unlock()
 		return nil
 	}
+	health := basePlayerHealth
+	if added.Health > 0 {
+		health = added.Health
+	}
+	appearance := added.Appearance
+	if appearance.Body.Sheet == "" {
+		appearance = DefaultAppearance
+	}
+	level := 1
+	if added.Level > 0 {
+		level = added.Level
+	}
 	w.setPlayer(added.ID, &Player{
-		ID:           added.ID,
-		Position:     added.Position,
-		Destination:  added.Position,
-		Speed:        basePlayerSpeed,
-		Size:         defaultSize,
+		Entity: Entity{
+			ID:          added.ID,
+			Kind:        E_PLAYER,
+			Position:    added.Position,
+			Destination: added.Position,
+			Speed:       basePlayerSpeed,
+			Size:        defaultSize,
+			Solid:       true,
+			Active:      true,
+			Health:      health,
+			MaxHealth:   basePlayerHealth,
+		},
+		PlayerRecord: PlayerRecord{
+			Progress:   Progress{Level: level},
+			Appearance: appearance,
+		},
 		SpeechBuffer: []SpeechMesage{},
-		Active:       true,
 	})
 	return nil
 }
@@ -237,7 +633,16 @@ func (w *World) updateDestination(dest *PlayerDestination) error {
 	if err != nil {
 		return err
 	}
+	// the server clamps destinations before they get here;
+	// anything else was not sent by it
+	if w.authoritative && !w.InPlayArea(dest.Destination) {
+		return errors.New("destination "+dest.Destination.String()+" of player "+dest.ID+" is outside the play area", nil)
+	}
 	player.Destination = dest.Destination
+	if w.authoritative && dest.Seq > 0 {
+		player.Ack = dest.Seq
+		player.AckTick = w.Tick
+	}
 	log.Printf("NEW PLAYER DESTINATION REQUESTED: %v", player.Destination)
 	return nil
 }
@@ -247,7 +652,10 @@ func (w *World) updatePosition(moved *PlayerPosition) error {
 	if err != nil {
 		return err
 	}
-	player.Position = moved.Position
+	w.playersLock.Lock()
+	w.setPosition(&player.Entity, moved.Position)
+	w.setMotion(&player.Entity, moved.Facing, moved.Walking)
+	w.playersLock.Unlock()
 	return nil
 }
 
@@ -272,12 +680,27 @@ func (w *World) setWorldState(worldState *WorldState) error {
 	return nil
 }
 
+// the player is taken as it is, unlike AddPlayer, which creates a new one
+func (w *World) applyPlayerSynced(synced *PlayerSynced) error {
+	if synced.Player == nil {
+		return errors.New("no player given to sync", nil)
+	}
+	w.setPlayer(synced.Player.ID, synced.Player.DeepCopy())
+	return nil
+}
+
 func (w *World) applyRemovePlayer(removed *RemovePlayer) error {
 	player, err := w.getActivePlayer(removed.ID)
 	if err != nil {
 		return err
 	}
+	w.playersLock.Lock()
 	player.Active = false
+	w.spatialIndex().Remove(removed.ID)
+	if w.authoritative {
+		w.closeTradesOf(removed.ID, nil, removed.ID+" left")
+	}
+	w.playersLock.Unlock()
 	return nil
 }
 
@@ -305,5 +728,8 @@ func (w *World) getPlayer(id string) (*Player, error) {
 func (w *World) setPlayer(id string, player *Player) {
 	w.playersLock.Lock()
 	w.Players[id] = player
+	if player.Active {
+		w.spatialIndex().Insert(id, player.Hitbox())
+	}
 	w.playersLock.Unlock()
 }
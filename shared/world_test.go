@@ -0,0 +1,136 @@
+package shared
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/faiface/pixel"
+)
+
+// worldState returns the simulated state of w in a form
+// where any difference in bits shows up when comparing
+func worldState(w *World) string {
+	var ids []string
+	w.ForEach(func(player *Player) {
+		ids = append(ids, player.ID)
+	})
+	sort.Strings(ids)
+	state := fmt.Sprintf("tick %v\n", w.Tick)
+	for _, id := range ids {
+		player, _ := w.GetPlayer(id)
+		state += fmt.Sprintf("%s %x %x %x %x %v\n", id,
+			math.Float64bits(player.Position.X), math.Float64bits(player.Position.Y),
+			math.Float64bits(player.Destination.X), math.Float64bits(player.Destination.Y),
+			player.Active)
+	}
+	return state
+}
+
+func TestStepDeterministic(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	tileMap, err := LoadTileMap("../server/maps/overworld.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// players crowd the same spots and walk through each other and into walls
+	var updates [][]*Update
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("player-%v", i)
+		updates = append(updates, []*Update{
+			{AddPlayer: &AddPlayer{ID: id, Position: tileMap.SpawnPoints[i%len(tileMap.SpawnPoints)]}},
+			{PlayerDestination: &PlayerDestination{ID: id, Destination: pixel.V(float64(i-10)*3, float64(10-i)*2)}},
+		})
+	}
+	updates = append(updates, []*Update{
+		{RemovePlayer: &RemovePlayer{ID: "player-3"}},
+		{PlayerDestination: &PlayerDestination{ID: "player-4", Destination: pixel.V(-40, 0)}},
+	})
+
+	w1 := NewWorld(tileMap)
+	w2 := NewWorld(tileMap)
+	for _, w := range []*World{w1, w2} {
+		go func(w *World) {
+			for range w.ProcessedUpdates() {
+			}
+		}(w)
+	}
+
+	for _, batch := range updates {
+		if err := w1.ApplyUpdates(batch...); err != nil {
+			t.Fatal(err)
+		}
+		if err := w2.ApplyUpdates(batch...); err != nil {
+			t.Fatal(err)
+		}
+		// w1 steps on time, w2 gets the same time in uneven chunks
+		if _, err := w1.Advance(TickDuration * 3); err != nil {
+			t.Fatal(err)
+		}
+		for _, elapsed := range []time.Duration{TickDuration / 3, TickDuration * 2, TickDuration*2/3 + 1} {
+			if _, err := w2.Advance(elapsed); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if s1, s2 := worldState(w1), worldState(w2); s1 != s2 {
+			t.Fatalf("worlds diverged:\n%s\n%s", s1, s2)
+		}
+	}
+	if w1.Tick != uint64(3*len(updates)) {
+		t.Fatalf("expected %v ticks, got %v", 3*len(updates), w1.Tick)
+	}
+}
+
+func TestKeep(t *testing.T) {
+	w := NewEmptyWorld()
+	for i := 0; i < 5; i++ {
+		if err := w.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if w.Len() != 6 {
+		t.Fatalf("expected every step to add a snapshot, got %v", w.Len())
+	}
+	for _, n := range []int{3, 3, 1, 0} {
+		w.Keep(n)
+		expect := n
+		if n < 1 {
+			expect = 1
+		}
+		if w.Len() != expect {
+			t.Fatalf("expected %v snapshots after Keep(%v), got %v", expect, n, w.Len())
+		}
+	}
+}
+
+func TestProcessedInOrder(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	w := NewEmptyWorld()
+	// more than fit in the buffer, so that some are queued
+	const n = processedBuffer * 2
+	for i := 0; i < n; i++ {
+		if err := w.ApplyUpdates(&Update{AddPlayer: &AddPlayer{ID: fmt.Sprintf("player-%v", i)}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case update := <-w.ProcessedUpdates():
+			if id := fmt.Sprintf("player-%v", i); update.AddPlayer == nil || update.AddPlayer.ID != id {
+				t.Fatalf("expected %s to be added next, got %s", id, update)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected %v processed updates, got %v", n, i)
+		}
+	}
+}